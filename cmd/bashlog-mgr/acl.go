@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/acl"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const aclUsage = "bashlog-mgr acl <name> [grant|revoke <role> <name>...|clear]"
+
+// handleACL shows the access control list serve holds a workspace's API
+// requests to, or grants and revokes roles in it. Principals are the
+// names of API tokens, people signed in with the provider and the roles
+// their claims map to, as token:<name>, user:<name> and role:<name>, a
+// bare name being a token's, or * for all of them
+func handleACL(basePath string, args []string) {
+	if len(args) == 0 {
+		failUsage(aclUsage, "workspace name required")
+	}
+	name := args[0]
+	wsPath := requireWorkspace(basePath, name)
+	list := acl.Load(wsPath)
+
+	if len(args) == 1 {
+		if list == nil {
+			fmt.Printf("Workspace '%s' has no access list: everyone serve lets in may read, record into and comment on it\n", name)
+			return
+		}
+		fmt.Printf("Workspace '%s':\n", name)
+		for _, role := range acl.Roles {
+			if principals, ok := list[role]; ok {
+				fmt.Printf("  %-10s %s\n", role, strings.Join(principals, ", "))
+			}
+		}
+		return
+	}
+
+	if workspace.IsMounted(wsPath) {
+		fail(exitConflict, "workspace '%s' is mounted read-only", name)
+	}
+	action := args[1]
+	if action == "clear" {
+		if len(args) > 2 {
+			failUsage(aclUsage, "clear takes no arguments")
+		}
+		if err := acl.Clear(wsPath); err != nil {
+			fail(exitFailure, "could not clear access list: %v", err)
+		}
+		logEvent(wsPath, workspace.Event{Op: "acl", Detail: "cleared the access list"})
+		fmt.Printf("✓ Workspace '%s' is open to everyone serve lets in\n", name)
+		return
+	}
+	if action != "grant" && action != "revoke" {
+		failUsage(aclUsage, "unknown action '"+action+"'")
+	}
+	if len(args) < 4 {
+		failUsage(aclUsage, action+" needs a role and at least one name")
+	}
+	role, err := acl.ParseRole(args[2])
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	if list == nil {
+		list = make(acl.List)
+	}
+	principals := list[role]
+	names := make([]string, len(args)-3)
+	for i, who := range args[3:] {
+		if who == "" || strings.ContainsAny(who, ", \t=") {
+			fail(exitUsage, "invalid name '%s'", who)
+		}
+		who = acl.Qualify(who)
+		names[i] = who
+		if action == "grant" {
+			if !contains(principals, who) {
+				principals = append(principals, who)
+			}
+			continue
+		}
+		kept := principals[:0]
+		for _, p := range principals {
+			if p != who {
+				kept = append(kept, p)
+			}
+		}
+		principals = kept
+	}
+	list[role] = principals
+
+	if err := acl.Save(wsPath, list); err != nil {
+		fail(exitFailure, "could not save access list: %v", err)
+	}
+	logEvent(wsPath, workspace.Event{Op: "acl", Detail: action + " " + string(role) + " " + strings.Join(names, " ")})
+	if action == "grant" {
+		fmt.Printf("✓ Granted %s of workspace '%s' to %s\n", role, name, strings.Join(names, ", "))
+	} else {
+		fmt.Printf("✓ Revoked %s of workspace '%s' from %s\n", role, name, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/audit"
+)
+
+// auditLogFile is the trail of bashlog-mgr operations, relative to $HOME
+const auditLogFile = ".bashlog/audit.log"
+
+// pendingAudit is the operation being run, written to auditPath when it
+// exits, whichever way it does
+var (
+	pendingAudit *audit.Record
+	auditPath    string
+)
+
+// beginAudit notes the operation about to run
+func beginAudit(path, action string, args []string) {
+	r := audit.Record{Time: time.Now(), Action: action, Args: args}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	r.Host, _ = os.Hostname()
+	pendingAudit = &r
+	auditPath = path
+}
+
+// finishAudit records the running operation with its exit status. A
+// failure to record is reported but doesn't fail the operation
+func finishAudit(exit int) {
+	if pendingAudit == nil {
+		return
+	}
+	r := *pendingAudit
+	pendingAudit = nil
+	r.Exit = exit
+	if err := audit.Append(auditPath, r); err != nil {
+		slog.Warn("could not write audit log", "path", auditPath, "err", err)
+	}
+}
+
+// handleAuditLog shows the recorded operations, most recent last
+func handleAuditLog(path string, args []string) {
+	fs := flag.NewFlagSet("audit-log", flag.ExitOnError)
+	action := fs.String("action", "", "Only show this operation, e.g. delete or export")
+	userName := fs.String("user", "", "Only show operations by this user")
+	wsName := fs.String("workspace", "", "Only show operations naming this workspace")
+	since := fs.String("since", "", "Only show operations within this long, e.g. 24h or 7d")
+	limit := fs.Int("limit", 50, "Show at most this many operations (0 for all)")
+	verify := fs.Bool("verify", false, "Check that no record was altered or removed")
+	fs.Parse(args)
+
+	records, err := audit.Read(path)
+	if err != nil {
+		fail(exitFailure, "could not read audit log: %v", err)
+	}
+
+	if *verify {
+		if err := audit.Verify(records); err != nil {
+			fail(exitProblems, "audit log %s has been tampered with: %v", path, err)
+		}
+		fmt.Printf("✓ Audit log intact (%d records)\n", len(records))
+		return
+	}
+
+	var cutoff time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			fail(exitUsage, "invalid --since '%s': %v", *since, err)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	var shown []audit.Record
+	for _, r := range records {
+		if (*action == "" || r.Action == *action) &&
+			(*userName == "" || r.User == *userName) &&
+			(*wsName == "" || contains(r.Args, *wsName)) &&
+			(cutoff.IsZero() || r.Time.After(cutoff)) {
+			shown = append(shown, r)
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println("No matching operations")
+		return
+	}
+
+	total := len(shown)
+	if *limit > 0 && total > *limit {
+		shown = shown[total-*limit:]
+	}
+	fmt.Printf("%-19s  %-24s %-14s %-4s %s\n", "TIME", "USER", "OPERATION", "EXIT", "ARGUMENTS")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, r := range shown {
+		fmt.Printf("%-19s  %-24s %-14s %-4d %s\n",
+			r.Time.Local().Format("2006-01-02 15:04:05"), r.User+"@"+r.Host, r.Action, r.Exit, strings.Join(r.Args, " "))
+	}
+	if len(shown) < total {
+		fmt.Printf("(%d of %d operations, use --limit 0 for all)\n", len(shown), total)
+	}
+}
+
+// parseAge reads a duration, also accepting whole days such as "7d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("expected a number of days")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
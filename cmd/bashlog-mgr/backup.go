@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/keyring"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// manifestFile describes the contents of a backup directory
+const manifestFile = "manifest.txt"
+
+// handleBackup copies workspaces into a backup directory, holding each
+// workspace's lock while it is copied so in-flight writes can't tear it.
+// With --encrypt each workspace's files are encrypted with its own key
+func handleBackup(basePath, keysPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	all := fs.Bool("all", false, "Back up every workspace")
+	output := fs.String("output", "", "Directory to write the backup to")
+	encrypt := fs.Bool("encrypt", false, "Encrypt each workspace with its own key, generated if it has none")
+	names := parseInterspersed(fs, args)
+
+	if *output == "" || (*all == (len(names) > 0)) {
+		failUsage("bashlog-mgr backup --all|<name>... --output <dir> [--encrypt]", "an output directory and either --all or workspace names are required")
+	}
+
+	if *all {
+		workspaces, err := getWorkspaces(basePath)
+		if err != nil {
+			fail(exitFailure, "could not read workspaces: %v", err)
+		}
+		for _, ws := range workspaces {
+			names = append(names, ws.Name)
+		}
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		requireWorkspace(basePath, name)
+		paths[i] = workspacePath(basePath, name)
+	}
+	requireSensitiveUnlock(settingsPath, "back up", names, paths)
+
+	keys := make(map[string]string)
+	for i, name := range names {
+		if !*encrypt {
+			break
+		}
+		id, created, err := ensureWorkspaceKey(keysPath, paths[i], false)
+		if err != nil {
+			fail(exitCodeFor(err), "could not set up the key of workspace '%s': %v", name, err)
+		}
+		if created {
+			fmt.Printf("Workspace '%s' has new key %s\n", name, id)
+		}
+		keys[name] = id
+	}
+
+	if entries, err := os.ReadDir(*output); err == nil && len(entries) > 0 {
+		fail(exitConflict, "output directory %s is not empty", *output)
+	}
+	if err := fsperm.Default.MkdirAll(*output); err != nil {
+		fail(exitFailure, "could not create output directory: %v", err)
+	}
+
+	for _, name := range names {
+		copier := copyFile
+		if id := keys[name]; id != "" {
+			copier = func(src, dest string) error { return sealFile(keysPath, id, src, dest) }
+		}
+		if err := backupWorkspace(workspacePath(basePath, name), filepath.Join(*output, name), copier); err != nil {
+			fail(exitFailure, "could not back up workspace '%s': %v", name, err)
+		}
+	}
+
+	manifest := fmt.Sprintf("created=%s\nworkspaces=%s\n", time.Now().Format(time.RFC3339), strings.Join(names, ","))
+	if *encrypt {
+		manifest += "encrypted=true\n"
+	}
+	if err := fsperm.Default.WriteFile(filepath.Join(*output, manifestFile), []byte(manifest)); err != nil {
+		fail(exitFailure, "could not write manifest: %v", err)
+	}
+
+	fmt.Printf("✓ Backed up %d workspace(s) to %s\n", len(names), *output)
+	if *encrypt {
+		fmt.Println("  Restoring it elsewhere takes the workspaces' keys (export them with: bashlog-mgr keys <name> --export <file>)")
+	}
+}
+
+// backupWorkspace copies a workspace under its shared lock, each file with
+// copier
+func backupWorkspace(wsPath, dest string, copier func(src, dest string) error) error {
+	lock, err := workspace.RLockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	slog.Debug("backing up workspace", "path", wsPath, "dest", dest)
+
+	return copyWorkspace(wsPath, dest, copier)
+}
+
+// handleRestore brings workspaces back from a backup directory, all of them
+// or only those named, or a single deleted workspace back from the trash
+func handleRestore(basePath, trashPath, keysPath string, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "Replace workspaces that already exist")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage("bashlog-mgr restore <name> | <dir> [name...] [--force]", "workspace name or backup directory required")
+	}
+
+	backupPath := positional[0]
+	manifest := workspace.ReadConfig(filepath.Join(backupPath, manifestFile))
+	if manifest["workspaces"] == "" && len(positional) == 1 && isValidName(backupPath) {
+		restoreFromTrash(basePath, trashPath, backupPath)
+		return
+	}
+	if manifest["workspaces"] == "" {
+		fail(exitNotFound, "%s is not a bashlog backup", backupPath)
+	}
+	available := strings.Split(manifest["workspaces"], ",")
+
+	names := positional[1:]
+	if len(names) == 0 {
+		names = available
+	}
+	for _, name := range names {
+		if !isValidName(name) || !contains(available, name) {
+			fail(exitNotFound, "workspace '%s' is not in the backup", name)
+		}
+		if _, err := os.Stat(filepath.Join(basePath, name)); err == nil && !*force {
+			fail(exitConflict, "workspace '%s' already exists (use --force to replace it)", name)
+		}
+	}
+
+	if err := fsperm.Default.MkdirAll(basePath); err != nil {
+		fail(exitFailure, "could not create workspace directory: %v", err)
+	}
+
+	for _, name := range names {
+		if err := restoreWorkspace(filepath.Join(backupPath, name), basePath, name, keysPath); err != nil {
+			if errors.Is(err, keyring.ErrNoKey) {
+				fail(exitCodeFor(err), "could not restore workspace '%s': %v (import it with: bashlog-mgr keys --import <file>)", name, err)
+			}
+			fail(exitFailure, "could not restore workspace '%s': %v", name, err)
+		}
+		fmt.Printf("✓ Workspace '%s' restored\n", name)
+	}
+}
+
+// restoreWorkspace copies a backed-up workspace next to its destination and
+// swaps it into place, so a failed restore leaves the original untouched.
+// Encrypted files are decrypted with the keys in keysPath
+func restoreWorkspace(src, basePath, name, keysPath string) error {
+	wsPath := filepath.Join(basePath, name)
+	staging := filepath.Join(basePath, "."+name+".restore")
+	slog.Debug("restoring workspace", "src", src, "staging", staging)
+	os.RemoveAll(staging)
+
+	open := func(src, dest string) error { return openFile(keysPath, src, dest) }
+	if err := copyWorkspace(src, staging, open); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+
+	if _, err := os.Stat(wsPath); err == nil {
+		lock, err := workspace.LockWorkspace(wsPath)
+		if err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+		defer lock.Unlock()
+
+		old := filepath.Join(basePath, "."+name+".old")
+		if err := os.Rename(wsPath, old); err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+		defer os.RemoveAll(old)
+	}
+
+	return os.Rename(staging, wsPath)
+}
+
+// copyWorkspace copies a workspace's files into dest, skipping its lock
+// and the caches derived from its history, with the permissions they have
+// and the workspace's mode for directories, each file with copier.
+// A mounted workspace is copied from the directory it links to
+func copyWorkspace(src, dest string, copier func(src, dest string) error) error {
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	mode := workspace.FileMode(src)
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if d.IsDir() {
+			if d.Name() == workspace.DaysDir {
+				return filepath.SkipDir
+			}
+			return mode.MkdirAll(target)
+		}
+		if !d.Type().IsRegular() || d.Name() == workspace.LockFile || d.Name() == workspace.StatsFile {
+			return nil
+		}
+		return copier(path, target)
+	})
+}
+
+// copyFile copies a regular file, preserving its permissions and
+// modification time
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+// sealFile copies a regular file like copyFile, encrypted with the key id
+// from keysPath
+func sealFile(keysPath, id, src, dest string) error {
+	return transformFile(src, dest, func(data []byte) ([]byte, error) {
+		return keyring.Seal(keysPath, id, data)
+	})
+}
+
+// openFile copies a regular file like copyFile, decrypted with the key
+// from keysPath it was encrypted with if it was encrypted
+func openFile(keysPath, src, dest string) error {
+	return transformFile(src, dest, func(data []byte) ([]byte, error) {
+		if !keyring.IsSealed(data) {
+			return data, nil
+		}
+		data, _, err := keyring.Open(keysPath, data)
+		return data, err
+	})
+}
+
+// transformFile writes src with transform applied to dest, preserving its
+// permissions and modification time
+func transformFile(src, dest string, transform func([]byte) ([]byte, error)) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if data, err = transform(data); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
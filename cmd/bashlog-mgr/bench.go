@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// benchBatch is how many commands each synthetic ingest appends at once,
+// roughly what an import or a busy session writes
+const benchBatch = 100
+
+var benchWords = [][]string{
+	{"git", "ls", "cd", "make", "go", "docker", "kubectl", "grep", "cat", "ssh", "vim", "curl"},
+	{"status", "-la", "build", "test", "run", "logs", "get", "apply", "-rn", "diff", "push", "pull"},
+	{"./...", "pods", "src/", "main.go", "--all", "-f", "deploy.yaml", "origin", "HEAD", "/var/log", "TODO", "host1"},
+}
+
+// handleBench generates synthetic workspaces in a scratch directory and
+// measures ingest, read, and search throughput over them
+func handleBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	workspaces := fs.Int("workspaces", 10, "Number of synthetic workspaces")
+	commands := fs.Int("commands", 10000, "Commands per workspace")
+	query := fs.String("query", "deploy", "Substring to search for")
+	seed := fs.Int64("seed", 1, "Random seed for the generated commands")
+	keep := fs.Bool("keep", false, "Keep the generated workspaces instead of removing them")
+	fs.Parse(args)
+
+	if *workspaces < 1 || *commands < 1 {
+		fail(exitUsage, "--workspaces and --commands must be positive")
+	}
+
+	dir, err := os.MkdirTemp("", "bashlog-bench-")
+	if err != nil {
+		fail(exitFailure, "could not create bench directory: %v", err)
+	}
+	if *keep {
+		fmt.Printf("Workspaces kept in: %s\n", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	total := *workspaces * *commands
+	fmt.Printf("Benchmarking %d workspaces × %d commands\n\n", *workspaces, *commands)
+	fmt.Printf("%-10s %12s %16s\n", "PHASE", "TIME", "COMMANDS/SEC")
+	fmt.Println(strings.Repeat("-", 40))
+
+	var paths []string
+	elapsed := timed(func() {
+		for i := 0; i < *workspaces; i++ {
+			wsPath := filepath.Join(dir, fmt.Sprintf("bench-%d", i))
+			if err := benchIngest(wsPath, *commands, rng); err != nil {
+				fail(exitFailure, "could not generate workspace: %v", err)
+			}
+			paths = append(paths, wsPath)
+		}
+	})
+	printBenchPhase("ingest", elapsed, total)
+
+	histories := make([][]workspace.Entry, len(paths))
+	elapsed = timed(func() {
+		for i, wsPath := range paths {
+			entries, err := workspace.ReadHistory(filepath.Join(wsPath, "history.log"))
+			if err != nil {
+				fail(exitFailure, "could not read workspace: %v", err)
+			}
+			histories[i] = entries
+		}
+	})
+	printBenchPhase("read", elapsed, total)
+
+	matches := 0
+	elapsed = timed(func() {
+		for _, entries := range histories {
+			for _, e := range entries {
+				if strings.Contains(e.Command, *query) {
+					matches++
+				}
+			}
+		}
+	})
+	printBenchPhase("search", elapsed, total)
+
+	elapsed = timed(func() {
+		for _, entries := range histories {
+			workspace.Unique(entries)
+		}
+	})
+	printBenchPhase("unique", elapsed, total)
+
+	fmt.Printf("\n%d commands matched %q\n", matches, *query)
+}
+
+// benchIngest creates a workspace and appends synthetic commands to it in
+// batches, through the same path imports use
+func benchIngest(wsPath string, commands int, rng *rand.Rand) error {
+	if err := fsperm.Default.MkdirAll(wsPath); err != nil {
+		return err
+	}
+	config := fmt.Sprintf("name=%s\ncreated=%s\ncommands=0\n", filepath.Base(wsPath), time.Now().Format(time.RFC3339))
+	if err := fsperm.Default.WriteFile(filepath.Join(wsPath, configFile), []byte(config)); err != nil {
+		return err
+	}
+
+	when := time.Now().Add(-time.Duration(commands) * time.Minute)
+	for written := 0; written < commands; {
+		n := benchBatch
+		if commands-written < n {
+			n = commands - written
+		}
+
+		batch := make([]workspace.Entry, n)
+		for i := range batch {
+			when = when.Add(time.Duration(rng.Intn(120)) * time.Second)
+			batch[i] = workspace.Entry{Command: syntheticCommand(rng), Time: when}
+		}
+		if err := workspace.Append(wsPath, batch); err != nil {
+			return err
+		}
+		written += n
+	}
+	return nil
+}
+
+// syntheticCommand builds a plausible command line from benchWords
+func syntheticCommand(rng *rand.Rand) string {
+	words := make([]string, len(benchWords))
+	for i, choices := range benchWords {
+		words[i] = choices[rng.Intn(len(choices))]
+	}
+	return strings.Join(words, " ")
+}
+
+func timed(f func()) time.Duration {
+	start := time.Now()
+	f()
+	return time.Since(start)
+}
+
+func printBenchPhase(phase string, elapsed time.Duration, commands int) {
+	rate := float64(commands) / elapsed.Seconds()
+	fmt.Printf("%-10s %12s %16.0f\n", phase, elapsed.Round(time.Microsecond), rate)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// matchWorkspaces expands workspace names and glob patterns such as
+// 'tmp-*' into the names of existing workspaces, in list order. A pattern
+// that matches nothing is an error, as is a malformed one
+func matchWorkspaces(basePath string, patterns []string) ([]string, error) {
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matched := false
+		for _, ws := range workspaces {
+			ok, err := path.Match(pattern, ws.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%w: pattern '%s': %v", errInvalidArgs, pattern, err)
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !seen[ws.Name] {
+				seen[ws.Name] = true
+				names = append(names, ws.Name)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("workspace '%s' %w", pattern, errNotFound)
+		}
+	}
+	return names, nil
+}
+
+// requireWorkspaces is matchWorkspaces for command handlers, exiting when
+// the patterns don't resolve
+func requireWorkspaces(basePath string, patterns []string) []string {
+	names, err := matchWorkspaces(basePath, patterns)
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+	return names
+}
+
+// confirmWorkspaces lists the workspaces an action will apply to and asks
+// for confirmation, unless yes is set
+func confirmWorkspaces(action string, names []string, yes bool) bool {
+	if yes {
+		return true
+	}
+
+	if len(names) == 1 {
+		fmt.Printf("Are you sure you want to %s workspace '%s'? (yes/no): ", action, names[0])
+	} else {
+		fmt.Printf("This will %s %d workspaces:\n", action, len(names))
+		for _, name := range names {
+			fmt.Printf("  %s\n", name)
+		}
+		fmt.Printf("Are you sure? (yes/no): ")
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "yes" || response == "y"
+}
+
+// handleArchive packs workspaces into compressed tarballs and removes them
+// from the workspace directory
+func handleArchive(basePath, archivePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	output := fs.String("output", archivePath, "Directory to write archives to")
+	yes := fs.Bool("yes", false, "Archive without asking for confirmation")
+	patterns := parseInterspersed(fs, args)
+
+	if len(patterns) == 0 {
+		failUsage("bashlog-mgr archive <name|pattern>... [--output dir] [--yes]", "workspace name or pattern required")
+	}
+
+	names := requireWorkspaces(basePath, patterns)
+	if !confirmWorkspaces("archive", names, *yes) {
+		fmt.Println("Archive cancelled")
+		return
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = workspacePath(basePath, name)
+	}
+	requireSensitiveUnlock(settingsPath, "archive", names, paths)
+
+	if err := fsperm.Default.MkdirAll(*output); err != nil {
+		fail(exitFailure, "could not create archive directory: %v", err)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	for _, name := range names {
+		dest := filepath.Join(*output, fmt.Sprintf("%s-%s.tar.gz", name, stamp))
+		if err := archiveWorkspace(workspacePath(basePath, name), dest); err != nil {
+			os.Remove(dest)
+			fail(exitFailure, "could not archive workspace '%s': %v", name, err)
+		}
+		fmt.Printf("✓ Workspace '%s' archived to %s\n", name, dest)
+	}
+}
+
+// archiveWorkspace writes the workspace to a tarball at dest under its
+// lock, then removes it
+func archiveWorkspace(wsPath, dest string) error {
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Logged first, for the tarball to hold it
+	if err := workspace.LogEvent(wsPath, workspace.Event{Op: "archive", Detail: "archived to " + dest}); err != nil {
+		return err
+	}
+	f, err := fsperm.Default.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if err := workspace.WriteArchive(f, wsPath); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(wsPath)
+}
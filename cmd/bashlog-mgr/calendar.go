@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/storage"
+)
+
+const calendarUsage = "bashlog-mgr calendar [name] [--year 2024] [--month 2024-07]"
+
+// calendarShades grade a day's commands against the busiest day shown,
+// from a quarter of it up
+var calendarShades = []rune("░▒▓█")
+
+// handleCalendar draws a contribution calendar of the commands run each
+// day, in one workspace or all of them: a column per week, a row per
+// weekday, over the last year by default, a calendar year with --year, or
+// one month, with each day's count, with --month
+func handleCalendar(basePath string, args []string) {
+	fs := flag.NewFlagSet("calendar", flag.ExitOnError)
+	year := fs.Int("year", 0, "Show this calendar year instead of the last 12 months")
+	month := fs.String("month", "", "Show one month, as 2024-07, or as 7 for that month of --year or this year")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) > 1 {
+		failUsage(calendarUsage, "at most one workspace name expected")
+	}
+	label := "all workspaces"
+	var paths []string
+	if len(positional) == 1 {
+		label = fmt.Sprintf("'%s'", positional[0])
+		paths = []string{requireWorkspace(basePath, positional[0])}
+	} else {
+		workspaces, err := getWorkspaces(basePath)
+		if err != nil {
+			fail(exitFailure, "could not read workspaces: %v", err)
+		}
+		for _, ws := range workspaces {
+			paths = append(paths, ws.Path)
+		}
+	}
+
+	now := time.Now()
+	if *month != "" {
+		first, err := parseMonth(*month, *year, now)
+		if err != nil {
+			fail(exitUsage, "invalid --month '%s': %v", *month, err)
+		}
+		printMonthCalendar(label, dailyCommands(paths), first, now)
+		return
+	}
+
+	y, m, d := now.Date()
+	last := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	first := last.AddDate(-1, 0, 1)
+	if *year != 0 {
+		first = time.Date(*year, time.January, 1, 0, 0, 0, 0, time.Local)
+		last = time.Date(*year, time.December, 31, 0, 0, 0, 0, time.Local)
+	}
+	printYearCalendar(label, dailyCommands(paths), first, last, now)
+}
+
+// dailyCommands adds up the commands per local day, "2006-01-02", of the
+// workspaces at paths, from their stats caches
+func dailyCommands(paths []string) map[string]int {
+	dailies := make([]map[string]int, len(paths))
+	scanEach("Reading workspaces", len(paths), func(i int) {
+		if stats, err := storage.For(paths[i]).Stats(paths[i], defaultIdleAfter); err == nil {
+			dailies[i] = stats.Daily
+		}
+	})
+	total := make(map[string]int)
+	for _, daily := range dailies {
+		for day, n := range daily {
+			total[day] += n
+		}
+	}
+	return total
+}
+
+// parseMonth reads --month as "2024-07", or as a month number of year,
+// this year when year is 0, returning the first of the month
+func parseMonth(s string, year int, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01", s, time.Local); err == nil {
+		return t, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 12 {
+		return time.Time{}, fmt.Errorf("expected a month such as 2024-07, or 1 to 12")
+	}
+	if year == 0 {
+		year = now.Year()
+	}
+	return time.Date(year, time.Month(n), 1, 0, 0, 0, 0, time.Local), nil
+}
+
+// shade is how a day with count commands is drawn next to the busiest,
+// most: a dot for none, then darker blocks for busier days
+func shade(count, most int) rune {
+	if count == 0 {
+		return '·'
+	}
+	return calendarShades[(count*len(calendarShades)-1)/most]
+}
+
+// weekRow is the row a day is drawn in, weeks starting on Monday
+func weekRow(t time.Time) int {
+	return (int(t.Weekday()) + 6) % 7
+}
+
+// printYearCalendar draws the days from first to last as columns of
+// weeks, labelled with the month each starts, leaving days after now blank
+func printYearCalendar(label string, daily map[string]int, first, last, now time.Time) {
+	start := first.AddDate(0, 0, -weekRow(first))
+	weeks := 0
+	for week := start; !week.After(last); week = week.AddDate(0, 0, 7) {
+		weeks++
+	}
+
+	most, total, active := 0, 0, 0
+	busiest := ""
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		n := daily[day.Format(time.DateOnly)]
+		total += n
+		if n > 0 {
+			active++
+		}
+		if n > most {
+			most, busiest = n, day.Format(time.DateOnly)
+		}
+	}
+
+	fmt.Printf("\n=== Activity of %s, %s to %s ===\n\n", label, first.Format(time.DateOnly), last.Format(time.DateOnly))
+
+	// A month's name goes over the week it starts in, when there is room
+	months := []rune(strings.Repeat(" ", weeks+3))
+	for w, free := 0, 0; w < weeks; w++ {
+		weekStart := start.AddDate(0, 0, 7*w)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if day.Day() == 1 && !day.Before(first) && !day.After(last) && w >= free {
+				copy(months[w:], []rune(day.Format("Jan")))
+				free = w + 4
+			}
+		}
+	}
+	fmt.Printf("    %s\n", strings.TrimRight(string(months), " "))
+
+	for row := 0; row < 7; row++ {
+		var b strings.Builder
+		for w := 0; w < weeks; w++ {
+			day := start.AddDate(0, 0, 7*w+row)
+			if day.Before(first) || day.After(last) || day.After(now) {
+				b.WriteRune(' ')
+				continue
+			}
+			b.WriteRune(shade(daily[day.Format(time.DateOnly)], most))
+		}
+		fmt.Printf("%s %s\n", start.AddDate(0, 0, row).Format("Mon"), strings.TrimRight(b.String(), " "))
+	}
+
+	fmt.Printf("\n    Less ·%s More\n", string(calendarShades))
+	if total == 0 {
+		fmt.Println("\nNo commands in this period")
+		return
+	}
+	fmt.Printf("\n%d commands on %d days, busiest %s (%d)\n", total, active, busiest, most)
+}
+
+// printMonthCalendar draws the month starting first as a calendar, a row
+// per week, with the commands run each day
+func printMonthCalendar(label string, daily map[string]int, first, now time.Time) {
+	next := first.AddDate(0, 1, 0)
+	most, total := 0, 0
+	for day := first; day.Before(next); day = day.AddDate(0, 0, 1) {
+		n := daily[day.Format(time.DateOnly)]
+		total += n
+		most = max(most, n)
+	}
+
+	fmt.Printf("\n=== Activity of %s in %s ===\n\n", label, first.Format("January 2006"))
+	var header strings.Builder
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(&header, "%-9s", first.AddDate(0, 0, i-weekRow(first)).Format("Mon"))
+	}
+	fmt.Println(strings.TrimRight(header.String(), " "))
+	fmt.Println(strings.Repeat("-", 63))
+
+	line := strings.Repeat(" ", 9*weekRow(first))
+	for day := first; day.Before(next); day = day.AddDate(0, 0, 1) {
+		n := daily[day.Format(time.DateOnly)]
+		switch {
+		case day.After(now):
+			line += fmt.Sprintf("%2d       ", day.Day())
+		case n == 0:
+			line += fmt.Sprintf("%2d %c     ", day.Day(), shade(n, most))
+		default:
+			line += fmt.Sprintf("%2d %c %-4d", day.Day(), shade(n, most), n)
+		}
+		if weekRow(day) == 6 {
+			fmt.Println(strings.TrimRight(line, " "))
+			line = ""
+		}
+	}
+	if line != "" {
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+
+	if total == 0 {
+		fmt.Println("\nNo commands this month")
+		return
+	}
+	fmt.Printf("\n%d commands\n", total)
+}
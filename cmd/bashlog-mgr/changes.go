@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+const changesUsage = "bashlog-mgr changes <name> [session] [--files]"
+
+// handleChanges reports what a session recorded into a workspace changed
+// on disk: the files each of its commands created, modified and deleted
+// under the directory it was started in. Only sessions run with bashlog
+// --watch-files are watched; the most recent of them is reported unless
+// another session is named
+func handleChanges(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	files := fs.Bool("files", false, "List each file changed once, with the last command changing it, instead of grouping them by command")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		failUsage(changesUsage, "workspace name required")
+	}
+	name := positional[0]
+	requireWorkspace(basePath, name)
+
+	sessions, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		fail(exitFailure, "could not read sessions: %v", err)
+	}
+	if len(positional) == 1 {
+		watched := sessions[:0]
+		for _, m := range sessions {
+			if m.WatchedDir != "" {
+				watched = append(watched, m)
+			}
+		}
+		if len(watched) == 0 {
+			fail(exitNotFound, "no sessions of '%s' were watched for file changes (record one with: bashlog --watch-files --workspace %s)", name, name)
+		}
+		sessions = watched
+	}
+	m, err := pickSession(sessions, positional[1:])
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+	if m.WatchedDir == "" {
+		fail(exitNotFound, "session %s wasn't watched for file changes (recorded without --watch-files)", m.Name())
+	}
+
+	changes, err := m.Changes()
+	if err != nil {
+		fail(exitFailure, "could not read the file changes of %s: %v", m.Name(), err)
+	}
+	fmt.Printf("Session %s, started %s in %s\n\n", m.Name(), m.Started.Local().Format("2006-01-02 15:04:05"), m.WatchedDir)
+	if len(changes) == 0 {
+		fmt.Println("No files changed")
+		return
+	}
+	if *files {
+		printChangedFiles(changes)
+	} else {
+		printCommandChanges(changes)
+	}
+}
+
+// printCommandChanges lists the files each command changed, then how many
+// files were changed and how
+func printCommandChanges(changes []session.CommandChanges) {
+	counts := make(map[string]int)
+	for _, c := range changes {
+		command := c.Command
+		if command == "" {
+			command = "(before the first command)"
+		}
+		fmt.Printf("%s  %s\n", c.Time.Local().Format("15:04:05"), command)
+		for _, ch := range c.Changes {
+			fmt.Printf("          %-9s %s\n", ch.Op, ch.Path)
+			counts[ch.Op]++
+		}
+	}
+	printChangeSummary(counts, len(changes))
+}
+
+// printChangedFiles lists every file changed once, with what the session
+// did to it overall and the last command that changed it
+func printChangedFiles(changes []session.CommandChanges) {
+	ops := make(map[string]string)
+	last := make(map[string]string)
+	var order []string
+	for _, c := range changes {
+		for _, ch := range c.Changes {
+			op, seen := ops[ch.Path]
+			switch {
+			case !seen:
+				order = append(order, ch.Path)
+				op = ch.Op
+			case op == "":
+				op = ch.Op
+			default:
+				op = session.MergeChange(op, ch.Op)
+			}
+			ops[ch.Path], last[ch.Path] = op, c.Command
+		}
+	}
+
+	fmt.Printf("%-9s %-40s %s\n", "CHANGE", "PATH", "LAST CHANGED BY")
+	fmt.Println(strings.Repeat("-", 80))
+	counts := make(map[string]int)
+	for _, path := range order {
+		if ops[path] == "" {
+			continue
+		}
+		command := last[path]
+		if command == "" {
+			command = "-"
+		}
+		fmt.Printf("%-9s %-40s %s\n", ops[path], path, command)
+		counts[ops[path]]++
+	}
+	printChangeSummary(counts, len(changes))
+}
+
+// printChangeSummary prints how many files were changed, how, and by how
+// many commands
+func printChangeSummary(counts map[string]int, commands int) {
+	total := 0
+	var summary []string
+	for _, op := range []string{session.ChangeCreated, session.ChangeModified, session.ChangeDeleted} {
+		if counts[op] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[op], op))
+			total += counts[op]
+		}
+	}
+	fmt.Printf("\n%d changes by %d commands: %s\n", total, commands, strings.Join(summary, ", "))
+}
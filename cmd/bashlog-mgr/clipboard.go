@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/platform"
+)
+
+// osc52Limit is the most data terminals reliably accept in one OSC 52
+// sequence
+const osc52Limit = 74994
+
+// copyToClipboard puts text on the system clipboard, falling back to OSC
+// 52, which asks the terminal itself to set the clipboard and also works
+// over ssh. It returns the method used
+func copyToClipboard(text string, forceOSC52 bool) (string, error) {
+	if !forceOSC52 {
+		method, err := platform.Copy(text)
+		if !errors.Is(err, platform.ErrUnsupported) {
+			return method, err
+		}
+	}
+
+	if err := copyOSC52(text); err != nil {
+		return "", err
+	}
+	return "OSC 52", nil
+}
+
+// copyOSC52 writes an OSC 52 clipboard sequence to the terminal, wrapped
+// for tmux and screen so they pass it on
+func copyOSC52(text string) error {
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	if len(encoded) > osc52Limit {
+		return errors.New("command too long for OSC 52")
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal for OSC 52: %w", err)
+	}
+	defer tty.Close()
+
+	seq := "\x1b]52;c;" + encoded + "\a"
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = "\x1bPtmux;\x1b" + seq + "\x1b\\"
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = "\x1bP" + seq + "\x1b\\"
+	}
+	_, err = tty.WriteString(seq)
+	return err
+}
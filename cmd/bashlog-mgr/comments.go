@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/acl"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// maxCommentLength bounds a comment's text, in bytes
+const maxCommentLength = 8 << 10
+
+// apiComment is a comment as the API returns it, with N, the number of
+// the command it is on, when that command is still in the history
+type apiComment struct {
+	workspace.Comment
+	N int `json:"n,omitempty"`
+}
+
+// apiNewComment is the body of a comment posted to the API: its text, and
+// what it is on, by command number, session ID or the comment it replies
+// to
+type apiNewComment struct {
+	N       int    `json:"n,omitempty"`
+	Session string `json:"session,omitempty"`
+	Parent  string `json:"parent,omitempty"`
+	Text    string `json:"text"`
+}
+
+// commandNumbers maps each command of the workspace at wsPath, as comments
+// identify it, to its number
+func commandNumbers(wsPath string) (map[workspace.Entry]int, error) {
+	numbers := make(map[workspace.Entry]int)
+	n := 0
+	err := storage.For(wsPath).Iterate(wsPath, func(e workspace.Entry) bool {
+		n++
+		if !e.Time.IsZero() {
+			numbers[workspace.Entry{Command: e.Command, Time: time.Unix(e.Time.Unix(), 0)}] = n
+		}
+		return true
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return numbers, err
+}
+
+// numberOf returns the number of the command c is on, or 0
+func numberOf(numbers map[workspace.Entry]int, c workspace.Comment) int {
+	if c.Command == "" {
+		return 0
+	}
+	return numbers[workspace.Entry{Command: c.Command, Time: time.Unix(c.CommandTime, 0)}]
+}
+
+// workspaceComments answers /api/v1/workspaces/{name}/comments: GET lists
+// the comments, oldest first, optionally only those on command n or on a
+// session, and POST adds one as the token's name
+func (s *apiServer) workspaceComments(w http.ResponseWriter, r *http.Request) {
+	name, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/workspaces/"), "/comments")
+	if !isValidName(name) {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	wsPath := workspacePath(s.basePath, name)
+	if _, err := os.Stat(filepath.Join(wsPath, workspace.ConfigFile)); err != nil {
+		apiError(w, http.StatusNotFound, "workspace '%s' not found", name)
+		return
+	}
+	need := acl.Read
+	if r.Method == http.MethodPost {
+		need = acl.Comment
+	}
+	if !allowed(w, r, wsPath, name, need) {
+		return
+	}
+	numbers, err := commandNumbers(wsPath)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not read history: %v", err)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		s.addComment(w, r, wsPath, name, numbers)
+		return
+	}
+
+	query := r.URL.Query()
+	n := 0
+	if v := query.Get("n"); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &n); err != nil || n < 1 {
+			apiError(w, http.StatusBadRequest, "n must be a command number")
+			return
+		}
+	}
+	sessionID := query.Get("session")
+	comments, err := workspace.ReadComments(wsPath)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not read comments: %v", err)
+		return
+	}
+	shown := []apiComment{}
+	for _, c := range comments {
+		ac := apiComment{Comment: c, N: numberOf(numbers, c)}
+		if (n == 0 || ac.N == n) && (sessionID == "" || c.Session == sessionID) {
+			shown = append(shown, ac)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]apiComment{"comments": shown})
+}
+
+// addComment records the comment posted in r, answering with it as
+// recorded
+func (s *apiServer) addComment(w http.ResponseWriter, r *http.Request, wsPath, name string, numbers map[workspace.Entry]int) {
+	if workspace.IsMounted(wsPath) {
+		apiError(w, http.StatusConflict, "workspace '%s' is mounted read-only", name)
+		return
+	}
+	var posted apiNewComment
+	body := http.MaxBytesReader(w, r.Body, 2*maxCommentLength)
+	if err := json.NewDecoder(body).Decode(&posted); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid comment: %v", err)
+		return
+	}
+	posted.Text = strings.TrimSpace(posted.Text)
+	switch targets := btoi(posted.N != 0) + btoi(posted.Session != "") + btoi(posted.Parent != ""); {
+	case posted.Text == "":
+		apiError(w, http.StatusBadRequest, "invalid comment: text is required")
+		return
+	case len(posted.Text) > maxCommentLength:
+		apiError(w, http.StatusBadRequest, "invalid comment: text is longer than %d bytes", maxCommentLength)
+		return
+	case targets != 1:
+		apiError(w, http.StatusBadRequest, "invalid comment: give exactly one of n, session and parent")
+		return
+	case strings.ContainsAny(posted.Session, "\r\n"):
+		apiError(w, http.StatusBadRequest, "invalid comment: session must be one line")
+		return
+	}
+
+	c := workspace.Comment{Author: tokenName(r), Parent: posted.Parent, Session: posted.Session, Text: posted.Text}
+	if posted.N != 0 {
+		for e, n := range numbers {
+			if n == posted.N {
+				c.Command, c.CommandTime = e.Command, e.Time.Unix()
+			}
+		}
+		if c.Command == "" {
+			apiError(w, http.StatusNotFound, "no timestamped command %d in workspace '%s'", posted.N, name)
+			return
+		}
+	}
+
+	added, err := workspace.AddComment(wsPath, c)
+	if errors.Is(err, workspace.ErrNoParent) {
+		apiError(w, http.StatusNotFound, "comment '%s' not found", posted.Parent)
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not record comment: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apiComment{Comment: added, N: numberOf(numbers, added)})
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleComments shows the comment threads left on a workspace through
+// the API, or only those on command n
+func handleComments(basePath string, args []string) {
+	fs := flag.NewFlagSet("comments", flag.ExitOnError)
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		failUsage("bashlog-mgr comments <name> [n]", "workspace name required")
+	}
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+	only := 0
+	if len(positional) == 2 {
+		if _, err := fmt.Sscanf(positional[1], "%d", &only); err != nil || only < 1 {
+			fail(exitUsage, "invalid command number '%s'", positional[1])
+		}
+	}
+
+	comments, err := workspace.ReadComments(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read comments of '%s': %v", name, err)
+	}
+	numbers, err := commandNumbers(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read history of '%s': %v", name, err)
+	}
+
+	ordered, depth := workspace.Threads(comments)
+	shown := 0
+	for i, c := range ordered {
+		n := numberOf(numbers, c)
+		if only != 0 && n != only {
+			continue
+		}
+		indent := strings.Repeat("    ", depth[i])
+		if depth[i] == 0 {
+			switch {
+			case c.Session != "":
+				fmt.Printf("\nOn session %s\n", c.Session)
+			case n != 0:
+				fmt.Printf("\nOn %d. %s\n", n, redactRead(c.Command))
+			default:
+				fmt.Printf("\nOn %s (no longer in the history)\n", redactRead(c.Command))
+			}
+		}
+		fmt.Printf("%s  %s, %s [%s]\n", indent, c.Author, c.Time.Local().Format("2006-01-02 15:04"), c.ID)
+		for _, line := range strings.Split(c.Text, "\n") {
+			fmt.Printf("%s    %s\n", indent, line)
+		}
+		shown++
+	}
+	if shown == 0 {
+		fmt.Printf("No comments in workspace '%s'\n", name)
+	}
+}
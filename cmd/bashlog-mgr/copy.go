@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// commandRef resolves a command reference as shown by history: n is the
+// command's position in the workspace history, and a negative n counts
+// back from the most recent command (-1)
+func commandRef(basePath, name, ref string) (workspace.Entry, int, error) {
+	n, err := strconv.Atoi(ref)
+	if err != nil || n == 0 {
+		return workspace.Entry{}, 0, fmt.Errorf("%w: command reference '%s' must be a history number or a negative offset", errInvalidArgs, ref)
+	}
+
+	wsPath := workspacePath(basePath, name)
+	entries, err := storage.Read(wsPath)
+	if err != nil {
+		return workspace.Entry{}, 0, fmt.Errorf("workspace '%s': %w", name, err)
+	}
+
+	if n < 0 {
+		n = len(entries) + n + 1
+	}
+	if n < 1 || n > len(entries) {
+		return workspace.Entry{}, 0, fmt.Errorf("command %s %w in workspace '%s' (%d commands)", ref, errNotFound, name, len(entries))
+	}
+	return entries[n-1], n, nil
+}
+
+// handleCopy puts a recorded command on the clipboard
+func handleCopy(basePath string, args []string) {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	osc52 := fs.Bool("osc52", false, "Always copy through the terminal with OSC 52, e.g. over ssh")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 2 {
+		failUsage("bashlog-mgr copy <name> <n> [--osc52]", "workspace name and command number required")
+	}
+
+	entry, n, err := commandRef(basePath, positional[0], positional[1])
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+
+	command := redactRead(entry.Command)
+	method, err := copyToClipboard(command, *osc52)
+	if err != nil {
+		fail(exitFailure, "could not copy to the clipboard: %v", err)
+	}
+	fmt.Printf("✓ Copied command %d to the clipboard (%s): %s\n", n, method, command)
+}
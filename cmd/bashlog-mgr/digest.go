@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/notify"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// digestPeriods maps --period values to the window they cover
+var digestPeriods = map[string]time.Duration{
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+}
+
+// Digest summarizes activity over a period
+type Digest struct {
+	Period     string
+	Start, End time.Time
+
+	Sessions       int
+	SessionTime    time.Duration
+	FailedSessions []*session.Meta
+	Workspaces     []WorkspaceDigest
+	IdleWorkspaces []string
+}
+
+// WorkspaceDigest is one workspace's part of a digest
+type WorkspaceDigest struct {
+	Name        string
+	Commands    int
+	ActiveDays  int
+	NewCommands int
+	Top         []workspace.UniqueEntry
+}
+
+// handleDigest prints a summary of recent activity as Markdown or as an
+// email ready for sendmail, meant to be run from cron and posted to a team
+// channel
+func handleDigest(basePath, logsPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	period := fs.String("period", "weekly", "Period to summarize: daily, weekly, or monthly")
+	output := fs.String("output", "md", "Output format: md or email")
+	to := fs.String("to", "", "Recipient for --output email")
+	top := fs.Int("top", 5, "Number of top commands to list per workspace")
+	notifyTo := fs.String("notify", "", "Also post the digest to these notification targets (comma-separated)")
+	patterns := parseInterspersed(fs, args)
+
+	window, ok := digestPeriods[*period]
+	if !ok {
+		fail(exitUsage, "unsupported period '%s' (want daily, weekly, or monthly)", *period)
+	}
+	if *output != "md" && *output != "email" {
+		fail(exitUsage, "unsupported output format '%s'", *output)
+	}
+	if *output == "email" && *to == "" {
+		failUsage("bashlog-mgr digest --output email --to <address>", "recipient required for email output")
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	names, err := matchWorkspaces(basePath, patterns)
+	if err != nil && !(len(patterns) == 1 && patterns[0] == "*") {
+		fail(exitCodeFor(err), "%v", err)
+	}
+
+	end := time.Now()
+	digest, err := buildDigest(basePath, logsPath, names, *period, end.Add(-window), end, *top)
+	if err != nil {
+		fail(exitFailure, "could not build digest: %v", err)
+	}
+
+	if *notifyTo != "" {
+		if err := sendNotification(settingsPath, strings.Split(*notifyTo, ","), digestMessage(digest)); err != nil {
+			fail(exitCodeFor(err), "could not send digest: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Digest sent to %s\n", *notifyTo)
+	}
+
+	if *output == "email" {
+		writeDigestEmail(os.Stdout, digest, *to)
+		return
+	}
+	writeDigestMarkdown(os.Stdout, digest)
+}
+
+// digestMessage condenses a digest into a chat notification
+func digestMessage(d *Digest) notify.Message {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%d sessions, %s recorded, %d failed\n", d.Sessions, formatDuration(d.SessionTime), len(d.FailedSessions))
+	for _, ws := range d.Workspaces {
+		fmt.Fprintf(&text, "\n%s: %d commands on %d day(s), %d new", ws.Name, ws.Commands, ws.ActiveDays, ws.NewCommands)
+		if len(ws.Top) > 0 {
+			fmt.Fprintf(&text, "; top: `%s` (%d)", ws.Top[0].Command, ws.Top[0].Count)
+		}
+	}
+	if len(d.IdleWorkspaces) > 0 {
+		fmt.Fprintf(&text, "\n\nNo activity: %s", strings.Join(d.IdleWorkspaces, ", "))
+	}
+
+	host, _ := os.Hostname()
+	return notify.Message{Title: d.Title(), Text: text.String(), Host: host}
+}
+
+// buildDigest collects the sessions started and commands run in
+// [start, end)
+func buildDigest(basePath, logsPath string, names []string, period string, start, end time.Time, top int) (*Digest, error) {
+	d := &Digest{Period: period, Start: start, End: end}
+
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range metas {
+		if m.Started.Before(start) || !m.Started.Before(end) {
+			continue
+		}
+		d.Sessions++
+		d.SessionTime += m.Duration
+		if m.Finished() && m.ExitStatus != 0 {
+			d.FailedSessions = append(d.FailedSessions, m)
+		}
+	}
+	sort.Slice(d.FailedSessions, func(i, j int) bool {
+		return d.FailedSessions[i].Started.Before(d.FailedSessions[j].Started)
+	})
+
+	for _, name := range names {
+		entries, err := storage.Read(workspacePath(basePath, name))
+		if err != nil {
+			return nil, err
+		}
+		redactEntries(entries)
+
+		ws := WorkspaceDigest{Name: name}
+		seenBefore := make(map[string]bool)
+		newCommands := make(map[string]bool)
+		days := make(map[string]bool)
+		var inPeriod []workspace.Entry
+
+		for _, e := range entries {
+			switch {
+			case e.Time.IsZero() || e.Time.Before(start):
+				seenBefore[e.Command] = true
+			case e.Time.Before(end):
+				inPeriod = append(inPeriod, e)
+				days[e.Time.Format("2006-01-02")] = true
+				if !seenBefore[e.Command] {
+					newCommands[e.Command] = true
+				}
+			}
+		}
+
+		if len(inPeriod) == 0 {
+			d.IdleWorkspaces = append(d.IdleWorkspaces, name)
+			continue
+		}
+
+		ws.Commands = len(inPeriod)
+		ws.ActiveDays = len(days)
+		ws.NewCommands = len(newCommands)
+		ws.Top = workspace.Unique(inPeriod)
+		sort.SliceStable(ws.Top, func(i, j int) bool {
+			return ws.Top[i].Count > ws.Top[j].Count
+		})
+		if len(ws.Top) > top {
+			ws.Top = ws.Top[:top]
+		}
+		d.Workspaces = append(d.Workspaces, ws)
+	}
+
+	sort.SliceStable(d.Workspaces, func(i, j int) bool {
+		return d.Workspaces[i].Commands > d.Workspaces[j].Commands
+	})
+
+	return d, nil
+}
+
+// Title returns the digest's heading, also used as the email subject
+func (d *Digest) Title() string {
+	return fmt.Sprintf("bashlog %s digest: %s to %s", d.Period,
+		d.Start.Format("2006-01-02"), d.End.Format("2006-01-02"))
+}
+
+func writeDigestMarkdown(w io.Writer, d *Digest) {
+	fmt.Fprintf(w, "# %s\n\n", d.Title())
+
+	fmt.Fprintf(w, "## Sessions\n\n")
+	fmt.Fprintf(w, "- %d sessions started, %s recorded\n", d.Sessions, formatDuration(d.SessionTime))
+	if len(d.FailedSessions) > 0 {
+		fmt.Fprintf(w, "- %d ended with a failure:\n", len(d.FailedSessions))
+		for _, m := range d.FailedSessions {
+			fmt.Fprintf(w, "  - `%s`: exit %d (%s)\n", m.Name(), m.ExitStatus, m.EndReason)
+		}
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "## Workspaces\n\n")
+	if len(d.Workspaces) == 0 {
+		fmt.Fprintf(w, "No commands were logged.\n\n")
+	}
+	for _, ws := range d.Workspaces {
+		fmt.Fprintf(w, "### %s\n\n", ws.Name)
+		fmt.Fprintf(w, "%d commands on %d day(s), %d new\n\n", ws.Commands, ws.ActiveDays, ws.NewCommands)
+		fmt.Fprintf(w, "| Count | Command |\n|------:|---------|\n")
+		for _, u := range ws.Top {
+			fmt.Fprintf(w, "| %d | `%s` |\n", u.Count, strings.ReplaceAll(u.Command, "|", "\\|"))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(d.IdleWorkspaces) > 0 {
+		fmt.Fprintf(w, "No activity: %s\n", strings.Join(d.IdleWorkspaces, ", "))
+	}
+}
+
+// writeDigestEmail writes the digest as an RFC 5322 message, to be piped
+// into sendmail -t
+func writeDigestEmail(w io.Writer, d *Digest, to string) {
+	from := "bashlog"
+	if u, err := user.Current(); err == nil {
+		from = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		from += "@" + host
+	}
+
+	fmt.Fprintf(w, "From: %s\r\n", from)
+	fmt.Fprintf(w, "To: %s\r\n", to)
+	fmt.Fprintf(w, "Subject: %s\r\n", d.Title())
+	fmt.Fprintf(w, "Date: %s\r\n", d.End.Format(time.RFC1123Z))
+	fmt.Fprintf(w, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(w, "Content-Type: text/markdown; charset=UTF-8\r\n")
+	fmt.Fprintf(w, "\r\n")
+
+	var body strings.Builder
+	writeDigestMarkdown(&body, d)
+	fmt.Fprint(w, strings.ReplaceAll(body.String(), "\n", "\r\n"))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/interhack86/bashlog/internal/keyring"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Exit codes, stable so scripts can branch on them
+const (
+	exitFailure  = 1 // any failure not covered below
+	exitUsage    = 2 // missing or invalid arguments
+	exitNotFound = 3 // a workspace, snapshot, backup or file doesn't exist
+	exitConflict = 4 // the target already exists
+	exitProblems = 5 // fsck found problems it was not asked to repair, or a check failed
+)
+
+// errorCodes names each exit code in machine-readable errors
+var errorCodes = map[int]string{
+	exitFailure:  "failure",
+	exitUsage:    "usage",
+	exitNotFound: "not_found",
+	exitConflict: "conflict",
+	exitProblems: "problems_found",
+}
+
+// Sentinel errors, wrapped by operations so handlers can pick exit codes
+var (
+	errNotFound    = errors.New("not found")
+	errInvalidArgs = errors.New("invalid argument")
+)
+
+// exitCodeFor picks the exit code for an error from a failed operation
+func exitCodeFor(err error) int {
+	switch {
+	case errors.Is(err, errNotFound) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, keyring.ErrNoKey):
+		return exitNotFound
+	case errors.Is(err, errInvalidArgs):
+		return exitUsage
+	case errors.Is(err, workspace.ErrReadOnly):
+		return exitConflict
+	}
+	return exitFailure
+}
+
+// errorFormat is how errors are reported on stderr: "text" or "json"
+var errorFormat = "text"
+
+// cliError is an error as reported with --error-format json
+type cliError struct {
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message"`
+	Usage    string `json:"usage,omitempty"`
+}
+
+// fail reports an error and exits with exitCode
+func fail(exitCode int, format string, args ...any) {
+	report(cliError{
+		Code:     errorCodes[exitCode],
+		ExitCode: exitCode,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// failUsage reports invalid arguments along with the command's usage line
+func failUsage(usage, format string, args ...any) {
+	report(cliError{
+		Code:     errorCodes[exitUsage],
+		ExitCode: exitUsage,
+		Message:  fmt.Sprintf(format, args...),
+		Usage:    usage,
+	})
+}
+
+func report(e cliError) {
+	if errorFormat == "json" {
+		enc := json.NewEncoder(os.Stderr)
+		enc.SetEscapeHTML(false)
+		enc.Encode(map[string]cliError{"error": e})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", e.Message)
+		if e.Usage != "" {
+			fmt.Fprintf(os.Stderr, "Usage: %s\n", e.Usage)
+		}
+	}
+	finishAudit(e.ExitCode)
+	os.Exit(e.ExitCode)
+}
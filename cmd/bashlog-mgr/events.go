@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const eventsUsage = "bashlog-mgr events <name> [--limit n] [--undo]"
+
+// logEvent logs a metadata change already made to the workspace at
+// wsPath. Failing to log is reported but doesn't undo the change
+func logEvent(wsPath string, e workspace.Event) {
+	if err := workspace.LogEvent(wsPath, e); err != nil {
+		slog.Warn("could not log workspace event", "path", wsPath, "op", e.Op, "err", err)
+	}
+}
+
+// handleEvents shows the log of changes to a workspace's metadata, most
+// recent last, or with --undo reverts the latest change to a setting not
+// yet undone; access-list changes and archiving are logged only. Undoing
+// the change that marked a workspace sensitive asks for the passphrase or
+// a code, as protect --off does
+func handleEvents(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "Show at most this many events (0 for all)")
+	undo := fs.Bool("undo", false, "Revert the latest change to a setting not yet undone")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage(eventsUsage, "workspace name required")
+	}
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	if *undo {
+		undoEvent(wsPath, settingsPath, name)
+		return
+	}
+
+	events, err := workspace.ReadEvents(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read events of workspace '%s': %v", name, err)
+	}
+	if len(events) == 0 {
+		fmt.Printf("No changes logged for workspace '%s'\n", name)
+		return
+	}
+	if *limit > 0 && len(events) > *limit {
+		events = events[len(events)-*limit:]
+	}
+	for _, e := range events {
+		fmt.Printf("%4d  %s  %-10s %-12s %s\n", e.Seq, e.Time.Local().Format("2006-01-02 15:04:05"), e.User, e.Op, e.Describe())
+	}
+}
+
+// undoEvent reverts the latest change to the workspace at wsPath, redoing
+// what the change's command does beyond its config
+func undoEvent(wsPath, settingsPath, name string) {
+	if workspace.IsMounted(wsPath) {
+		fail(exitConflict, "workspace '%s' is mounted read-only", name)
+	}
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not lock workspace '%s': %v", name, err)
+	}
+	defer lock.Unlock()
+
+	e, err := workspace.LastUndoable(wsPath)
+	if errors.Is(err, workspace.ErrNothingToUndo) {
+		fail(exitNotFound, "workspace '%s' has no change to undo", name)
+	}
+	if err != nil {
+		fail(exitConflict, "%v", err)
+	}
+	if e.Key == sensitiveKey && isSensitive(wsPath) {
+		requireUnlock(settingsPath, "unprotect", []string{name})
+	}
+	if err := workspace.Undo(wsPath, e); err != nil {
+		fail(exitCodeFor(err), "could not undo change %d: %v", e.Seq, err)
+	}
+	// The mode is applied to the workspace's files, not only its config
+	if e.Key == fsperm.Setting {
+		if err := workspace.FileMode(wsPath).Apply(wsPath); err != nil {
+			fail(exitFailure, "could not change the permissions of workspace '%s' back: %v", name, err)
+		}
+	}
+	restored := "unset"
+	if e.Old != nil {
+		restored = *e.Old
+	}
+	fmt.Printf("✓ Undid change %d (%s) of workspace '%s': %s is %s again\n", e.Seq, e.Op, name, e.Key, restored)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/atuin"
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/notebook"
+	"github.com/interhack86/bashlog/internal/redact"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/transcript"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// exportExtensions are the file extensions of formats written to files,
+// used when exporting several workspaces into a directory
+var exportExtensions = map[string]string{
+	"bash":     ".bash_history",
+	"markdown": ".md",
+	"ipynb":    ".ipynb",
+}
+
+// handleExport exports workspace history into another tool's format
+func handleExport(basePath, logsPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "atuin", "Output format: atuin, bash, markdown or ipynb")
+	output := fs.String("output", "", "Output path (default: atuin's database, or stdout); a directory when exporting several workspaces to files")
+	all := fs.Bool("all", false, "Export every workspace")
+	sessionID := fs.String("session", "", "For notebooks, only export this session (ID or unique prefix)")
+	redaction := fs.String("redact", "", "Mask hostnames, usernames or paths as this redaction profile says, e.g. internal or external-vendor")
+	positional := parseInterspersed(fs, args)
+
+	if *all == (len(positional) > 0) {
+		failUsage("bashlog-mgr export <name|pattern>...|--all --format atuin|bash|markdown|ipynb [--output path] [--redact profile]", "workspace names or --all required")
+	}
+	if *format == "md" {
+		*format = "markdown"
+	}
+	if _, ok := exportExtensions[*format]; !ok && *format != "atuin" {
+		fail(exitUsage, "unsupported export format '%s'", *format)
+	}
+	if *sessionID != "" && !isNotebook(*format) {
+		fail(exitUsage, "--session only applies to markdown and ipynb exports")
+	}
+	var profile *redact.Profile
+	if *redaction != "" {
+		profiles, err := redact.Profiles(workspace.ReadConfig(settingsPath))
+		if err != nil {
+			fail(exitFailure, "could not read redaction profiles: %v", err)
+		}
+		if profile = profiles[*redaction]; profile == nil {
+			fail(exitUsage, "unknown redaction profile '%s' (expected one of %s)", *redaction, strings.Join(redact.Names(profiles), ", "))
+		}
+	}
+
+	if *all {
+		positional = []string{"*"}
+	}
+	names := requireWorkspaces(basePath, positional)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = workspacePath(basePath, name)
+	}
+	requireSensitiveUnlock(settingsPath, "export", names, paths)
+
+	// Several file exports go into one file each under --output, decided
+	// by the request rather than by how many workspaces happen to match
+	perWorkspace := *format != "atuin" && *output != "" && *output != "-" &&
+		(len(positional) > 1 || strings.ContainsAny(positional[0], "*?["))
+
+	if len(names) > 1 {
+		fmt.Fprintf(os.Stderr, "Exporting %d workspaces: %s\n", len(names), strings.Join(names, ", "))
+	}
+
+	dest := *output
+	var err error
+	switch {
+	case *format == "atuin" && dest == "":
+		dest, err = atuin.DefaultPath()
+		if err != nil {
+			fail(exitFailure, "could not export history: %v", err)
+		}
+	case perWorkspace:
+		if err := fsperm.Default.MkdirAll(dest); err != nil {
+			fail(exitFailure, "could not create output directory: %v", err)
+		}
+	}
+
+	for _, name := range names {
+		target := dest
+		if perWorkspace {
+			target = filepath.Join(dest, name+exportExtensions[*format])
+		}
+
+		var r *redact.Redactor
+		if profile != nil {
+			r = workspaceRedactor(workspacePath(basePath, name), logsPath, profile)
+		}
+		var count int
+		var err error
+		if isNotebook(*format) {
+			count, err = exportNotebook(workspacePath(basePath, name), logsPath, *sessionID, *format, target, r)
+		} else {
+			count, err = exportWorkspace(workspacePath(basePath, name), *format, target, r)
+		}
+		if err != nil {
+			fail(exitCodeFor(err), "could not export workspace '%s': %v", name, err)
+		}
+		if target != "" && target != "-" {
+			masked := ""
+			if profile != nil {
+				masked = fmt.Sprintf(", masking %s (%s)", strings.Join(profile.Fields(), ", "), profile.Name)
+			}
+			fmt.Printf("✓ Exported %d commands from workspace '%s' to %s%s\n", count, name, target, masked)
+		}
+	}
+}
+
+// workspaceRedactor returns a Redactor for profile that also masks the
+// hosts the workspace's commands were recorded on and the users who ran
+// its sessions, wherever they appear
+func workspaceRedactor(wsPath, logsPath string, profile *redact.Profile) *redact.Redactor {
+	var hosts, users []string
+	if recorded, err := workspace.ReadHosts(wsPath); err == nil {
+		hosts = recorded.Names()
+	}
+	if host, err := os.Hostname(); err == nil {
+		hosts = append(hosts, host)
+	}
+	if sessions, err := workspaceSessions(logsPath, filepath.Base(wsPath)); err == nil {
+		for _, m := range sessions {
+			users = append(users, m.User)
+		}
+	}
+	if current, err := user.Current(); err == nil {
+		users = append(users, current.Username)
+	}
+	return profile.New(hosts, users)
+}
+
+// exportWorkspace exports one workspace's history to dest, which is empty
+// or "-" for stdout in bash format, masked by r unless it is nil, and of
+// its secrets as redact.on-read says
+func exportWorkspace(wsPath, format, dest string, r *redact.Redactor) (int, error) {
+	entries, err := storage.Read(wsPath)
+	if err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		entries[i].Command = redactRead(entries[i].Command)
+		if r != nil {
+			entries[i].Command = r.Command(entries[i].Command)
+		}
+	}
+
+	config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
+	createdAt, err := time.Parse(time.RFC3339, config["created"])
+	if err != nil {
+		// Untimed commands would otherwise be given the zero time
+		createdAt = inferCreated(wsPath, entries)
+	}
+
+	if format == "atuin" {
+		return atuin.Export(dest, entries, createdAt)
+	}
+
+	entries = workspace.FillTimestamps(entries, createdAt)
+	if dest == "" || dest == "-" {
+		return len(entries), workspace.WriteHistory(os.Stdout, entries)
+	}
+	return exportBashHistory(dest, entries)
+}
+
+// exportBashHistory writes entries to a new bash_history file at dest
+func exportBashHistory(dest string, entries []workspace.Entry) (int, error) {
+	f, err := fsperm.Default.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := workspace.WriteHistory(f, entries); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(entries), f.Close()
+}
+
+func isNotebook(format string) bool {
+	return format == "markdown" || format == "ipynb"
+}
+
+// exportNotebook writes a workspace's sessions as a notebook, pairing each
+// command with its output where a transcript was recorded. Commands that
+// came from elsewhere, such as imports, appear without output when the
+// workspace has no sessions. Commands and output are masked by r unless it
+// is nil, and of their secrets as redact.on-read says
+func exportNotebook(wsPath, logsPath, sessionID, format, dest string, r *redact.Redactor) (int, error) {
+	name := filepath.Base(wsPath)
+	sessions, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		return 0, err
+	}
+	if sessionID != "" {
+		m, err := pickSession(sessions, []string{sessionID})
+		if err != nil {
+			return 0, err
+		}
+		sessions = []*session.Meta{m}
+	}
+
+	nb := notebook.Notebook{Title: "Workspace " + name}
+	count := 0
+	for _, m := range sessions {
+		entries, err := m.Commands()
+		if err != nil {
+			return 0, err
+		}
+		section, err := sessionSection(m, entries)
+		if err != nil {
+			return 0, err
+		}
+		nb.Sections = append(nb.Sections, section)
+		count += len(section.Cells)
+	}
+
+	if len(sessions) == 0 {
+		entries, err := storage.Read(wsPath)
+		if err != nil {
+			return 0, err
+		}
+		section := notebook.Section{Heading: "History", Note: "_No sessions were recorded into this workspace, so there is no output._"}
+		for _, e := range entries {
+			section.Cells = append(section.Cells, transcript.Cell{Command: e.Command, Time: e.Time})
+		}
+		nb.Sections = append(nb.Sections, section)
+		count = len(entries)
+	}
+	for _, section := range nb.Sections {
+		for i := range section.Cells {
+			cell := &section.Cells[i]
+			cell.Command, cell.Output = redactRead(cell.Command), redactRead(cell.Output)
+			if r != nil {
+				cell.Command, cell.Output = r.Command(cell.Command), r.Text(cell.Output)
+			}
+		}
+	}
+
+	write := notebook.WriteMarkdown
+	if format == "ipynb" {
+		write = notebook.WriteJupyter
+	}
+	if dest == "" || dest == "-" {
+		return count, write(os.Stdout, nb)
+	}
+	f, err := fsperm.Default.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return 0, err
+	}
+	if err := write(f, nb); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return count, f.Close()
+}
+
+// sessionSection pairs a session's commands with their output from its
+// transcript, when it has one
+func sessionSection(m *session.Meta, entries []workspace.Entry) (notebook.Section, error) {
+	section := notebook.Section{Heading: fmt.Sprintf("Session %s (%s, %s)", m.Name(), m.Shell, m.Started.Format(time.DateTime))}
+
+	commands := make([]string, len(entries))
+	times := make([]time.Time, len(entries))
+	for i, e := range entries {
+		commands[i] = e.Command
+		times[i] = e.Time
+	}
+
+	path, ok := m.Transcript()
+	if !ok {
+		section.Note = "_Recorded without --pty, so there is no output._"
+		section.Cells = transcript.Split("", commands, times)
+		return section, nil
+	}
+
+	plain, cleanup, err := readablePath(path)
+	if err != nil {
+		return section, err
+	}
+	defer cleanup()
+	raw, err := os.ReadFile(plain)
+	if err != nil {
+		return section, err
+	}
+	section.Cells = transcript.Split(transcript.Clean(raw), commands, times)
+	return section, nil
+}
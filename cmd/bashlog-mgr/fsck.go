@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// problem is an inconsistency found by fsck, with the fix --repair applies
+type problem struct {
+	where   string
+	message string
+	fix     func() error
+}
+
+// handleFsck validates workspace structure and recorded sessions, and with
+// --repair rebuilds what can be derived from the underlying logs
+func handleFsck(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Fix the problems found")
+	fs.Parse(args)
+
+	problems, err := checkWorkspaces(basePath)
+	if err != nil {
+		fail(exitFailure, "could not scan workspaces: %v", err)
+	}
+
+	sessionProblems, err := checkSessions(logsPath)
+	if err != nil {
+		fail(exitFailure, "could not scan sessions: %v", err)
+	}
+	problems = append(problems, sessionProblems...)
+
+	if len(problems) == 0 {
+		fmt.Println("✓ No problems found")
+		return
+	}
+
+	failed := 0
+	for _, p := range problems {
+		if !*repair {
+			fmt.Printf("✗ %s: %s\n", p.where, p.message)
+			continue
+		}
+
+		if err := p.fix(); err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %s (repair failed: %v)\n", p.where, p.message, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✓ %s: %s (repaired)\n", p.where, p.message)
+	}
+
+	if !*repair {
+		fmt.Println()
+		fail(exitProblems, "%d problem(s) found. Run 'bashlog-mgr fsck --repair' to fix them.", len(problems))
+	}
+	if failed > 0 {
+		fail(exitFailure, "%d of %d problem(s) could not be repaired", failed, len(problems))
+	}
+}
+
+// checkWorkspaces validates each workspace's config and history, in every
+// workspace root
+func checkWorkspaces(basePath string) ([]problem, error) {
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []problem
+	for _, ws := range workspaces {
+		if ws.MountedFrom != "" {
+			// Mounted workspaces are read-only, so not fsck's to repair
+			continue
+		}
+		slog.Debug("checking workspace", "name", ws.Name)
+		problems = append(problems, checkWorkspace(ws.Path)...)
+	}
+	return problems, nil
+}
+
+func checkWorkspace(wsPath string) []problem {
+	name := filepath.Base(wsPath)
+	where := "workspace " + name
+	configPath := filepath.Join(wsPath, configFile)
+	backend := storage.For(wsPath)
+	store := workspace.HistoryFile
+	if backend.Name() != storage.Files {
+		store = backend.Name() + " storage"
+	}
+
+	var problems []problem
+
+	history, err := storage.Read(wsPath)
+	if os.IsNotExist(err) {
+		problems = append(problems, problem{where, store + " is missing", func() error {
+			return backend.OpenWorkspace(wsPath)
+		}})
+	} else if err != nil {
+		// Nothing can be rebuilt from an unreadable history
+		return append(problems, problem{where, fmt.Sprintf("%s is unreadable: %v", store, err), func() error {
+			return err
+		}})
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return append(problems, problem{where, "config.txt is missing", func() error {
+			return rebuildConfig(wsPath, history)
+		}})
+	}
+
+	config := workspace.ReadConfig(configPath)
+
+	if config["name"] != name {
+		problems = append(problems, problem{where, fmt.Sprintf("config name is %q", config["name"]), func() error {
+			return workspace.SetConfigValue(configPath, "name", name)
+		}})
+	}
+
+	if _, err := time.Parse(time.RFC3339, config["created"]); err != nil {
+		problems = append(problems, problem{where, fmt.Sprintf("created timestamp %q is unparseable", config["created"]), func() error {
+			return workspace.SetConfigValue(configPath, "created", inferCreated(wsPath, history).Format(time.RFC3339))
+		}})
+	}
+
+	if count, err := strconv.Atoi(config["commands"]); err != nil || count != len(history) {
+		problems = append(problems, problem{where, fmt.Sprintf("command count is %q but history has %d commands", config["commands"], len(history)), func() error {
+			return workspace.SetConfigValue(configPath, "commands", strconv.Itoa(len(history)))
+		}})
+	}
+
+	return problems
+}
+
+// rebuildConfig recreates a workspace config from its history
+func rebuildConfig(wsPath string, history []workspace.Entry) error {
+	config := fmt.Sprintf("name=%s\ncreated=%s\ncommands=%d\n",
+		filepath.Base(wsPath), inferCreated(wsPath, history).Format(time.RFC3339), len(history))
+	return fsperm.Default.WriteFile(filepath.Join(wsPath, configFile), []byte(config))
+}
+
+// inferCreated estimates when a workspace was created: the time of its
+// first timestamped command, or the modification time of its directory
+func inferCreated(wsPath string, history []workspace.Entry) time.Time {
+	for _, e := range history {
+		if !e.Time.IsZero() {
+			return e.Time
+		}
+	}
+	if info, err := os.Stat(wsPath); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// checkSessions finds sessions left unfinished by a killed recorder and
+// session files without metadata
+func checkSessions(logsPath string) ([]problem, error) {
+	var problems []problem
+
+	orphans, err := session.FindOrphans(logsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orphans {
+		o := o
+		problems = append(problems, problem{
+			"session " + o.Meta.Name(),
+			fmt.Sprintf("not finalized (recorder pid %d gone, last activity %s)", o.PID, o.Ended.Format("2006-01-02 15:04:05")),
+			o.Finalize,
+		})
+	}
+
+	strays, err := session.FindStrays(logsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strays {
+		s := s
+		problems = append(problems, problem{
+			"session file " + s.Path,
+			"has no metadata",
+			s.Recover,
+		})
+	}
+
+	return problems, nil
+}
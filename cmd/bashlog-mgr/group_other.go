@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// groupOf returns nothing, as files have no owning group here
+func groupOf(path string) string {
+	return ""
+}
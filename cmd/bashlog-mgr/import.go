@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/interhack86/bashlog/internal/atuin"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/shellhist"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// handleImport imports command history from another tool into a workspace,
+// or from bashlog's own session logs, merging the history every session
+// keeps of its own into one
+func handleImport(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "atuin", "Source format (atuin, or bashlog for recorded sessions)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage("bashlog-mgr import <name> --format atuin|bashlog [path]", "workspace name required")
+	}
+
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	var entries []workspace.Entry
+	var source string
+	var err error
+
+	switch *format {
+	case "atuin":
+		source, err = sourcePath(positional, atuin.DefaultPath)
+		if err == nil {
+			entries, err = atuin.Import(source)
+		}
+	case "bashlog":
+		source, _ = sourcePath(positional, func() (string, error) { return logsPath, nil })
+		if _, err = os.Stat(source); err == nil {
+			entries, err = session.ReadHistory(source)
+		}
+	default:
+		fail(exitUsage, "unsupported import format '%s'", *format)
+	}
+
+	if err != nil {
+		fail(exitCodeFor(err), "could not import history: %v", err)
+	}
+
+	if err := storage.For(wsPath).AppendRecord(wsPath, entries); err != nil {
+		fail(exitFailure, "could not write history: %v", err)
+	}
+	if err := workspace.AddOrigins(wsPath, workspace.OriginImport, entries); err != nil {
+		fail(exitFailure, "could not record where the commands came from: %v", err)
+	}
+	if err := workspace.AddTransfers(wsPath, entries); err != nil {
+		fail(exitFailure, "could not record file transfers: %v", err)
+	}
+
+	fmt.Printf("✓ Imported %d commands from %s into workspace '%s'\n", len(entries), source, name)
+}
+
+// handleImportHistory imports an existing shell history file into a workspace
+func handleImportHistory(basePath string, args []string) {
+	fs := flag.NewFlagSet("import-history", flag.ExitOnError)
+	format := fs.String("format", "", "History format: bash, zsh, fish or ksh (default: detect)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) < 2 {
+		failUsage("bashlog-mgr import-history <name> <file> [--format bash|zsh|fish|ksh]", "workspace name and history file required")
+	}
+
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	entries, detected, err := shellhist.ReadFile(positional[1], *format)
+	if err != nil {
+		fail(exitCodeFor(err), "could not read history file: %v", err)
+	}
+
+	if err := storage.For(wsPath).AppendRecord(wsPath, entries); err != nil {
+		fail(exitFailure, "could not write history: %v", err)
+	}
+	if err := workspace.AddOrigins(wsPath, workspace.OriginImport, entries); err != nil {
+		fail(exitFailure, "could not record where the commands came from: %v", err)
+	}
+	if err := workspace.AddTransfers(wsPath, entries); err != nil {
+		fail(exitFailure, "could not record file transfers: %v", err)
+	}
+
+	fmt.Printf("✓ Imported %d commands (%s format) from %s into workspace '%s'\n",
+		len(entries), detected, positional[1], name)
+}
+
+// sourcePath returns the optional path argument following the workspace
+// name, falling back to the tool's default location
+func sourcePath(positional []string, fallback func() (string, error)) (string, error) {
+	if len(positional) > 1 {
+		return positional[1], nil
+	}
+	return fallback()
+}
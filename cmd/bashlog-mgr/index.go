@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const indexUsage = "bashlog-mgr index status|rebuild [--workspace pattern]"
+
+// handleIndex shows the state of the caches derived from workspaces'
+// history files, the stats and the day rollups, or with "rebuild" derives
+// them afresh, clearing out what interrupted writes left
+func handleIndex(basePath string, args []string) {
+	if len(args) == 0 || (args[0] != "status" && args[0] != "rebuild") {
+		failUsage(indexUsage, "status or rebuild required")
+	}
+	rebuild := args[0] == "rebuild"
+
+	fs := flag.NewFlagSet("index "+args[0], flag.ExitOnError)
+	pattern := fs.String("workspace", "*", "Only the workspaces matching this name or glob pattern")
+	if positional := parseInterspersed(fs, args[1:]); len(positional) > 0 {
+		failUsage(indexUsage, "unexpected argument '"+positional[0]+"'")
+	}
+
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		fail(exitFailure, "could not list workspaces: %v", err)
+	}
+	if len(workspaces) == 0 {
+		fmt.Println("No workspaces.")
+		return
+	}
+	selected := make(map[string]bool)
+	for _, name := range requireWorkspaces(basePath, []string{*pattern}) {
+		selected[name] = true
+	}
+
+	needed, failed := 0, 0
+	for _, ws := range workspaces {
+		if !selected[ws.Name] {
+			continue
+		}
+		if b := storage.For(ws.Path); b.Name() != storage.Files {
+			fmt.Printf("%-20s %s storage, indexed by the database\n", ws.Name, b.Name())
+			continue
+		}
+
+		if rebuild {
+			if ws.MountedFrom != "" {
+				fmt.Printf("- %s is mounted read-only from %s, its caches are rebuilt there\n", ws.Name, ws.MountedFrom)
+				continue
+			}
+			if err := workspace.RebuildCaches(ws.Path, defaultIdleAfter); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", ws.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ %s rebuilt\n", ws.Name)
+			continue
+		}
+
+		caches, err := workspace.CheckCaches(ws.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", ws.Name, err)
+			failed++
+			continue
+		}
+		leftover, _ := workspace.LeftoverFiles(ws.Path)
+		var states []string
+		damaged := len(leftover) > 0
+		for _, c := range caches {
+			state := c.Name + " " + c.State
+			if c.Detail != "" {
+				state += " (" + c.Detail + ")"
+			}
+			states = append(states, state)
+			damaged = damaged || c.State == workspace.CacheCorrupt
+		}
+		fmt.Printf("%-20s %s\n", ws.Name, strings.Join(states, ", "))
+		if len(leftover) > 0 {
+			fmt.Printf("  left over from interrupted writes: %s\n", strings.Join(leftover, ", "))
+		}
+		if damaged {
+			needed++
+		}
+	}
+
+	if failed > 0 {
+		fail(exitFailure, "%d workspace(s) failed", failed)
+	}
+	if needed > 0 {
+		fmt.Printf("\n%d workspace(s) have damaged caches, which are rebuilt when next read. Run 'bashlog-mgr index rebuild' to rebuild them now.\n", needed)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/keyring"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const keysUsage = "bashlog-mgr keys [name|pattern...] [--rotate] | <name> --export <file> | --import <file>"
+
+// keysDir holds the workspaces' encryption keys, a file each
+const keysDir = ".bashlog/keys"
+
+// encryptionKey, in a workspace's config, is the ID of the key in keysDir
+// its backups are encrypted with. Each workspace has its own, so handing
+// over one to restore a backup gives away no other
+const encryptionKey = "encryption.key"
+
+// workspaceKey returns the ID of the encryption key of the workspace at
+// wsPath, empty if it has none yet
+func workspaceKey(wsPath string) string {
+	return workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))[encryptionKey]
+}
+
+// ensureWorkspaceKey returns the ID of the encryption key of the workspace
+// at wsPath, generating one and recording it in the workspace's config if
+// it has none, or if rotate says to replace it. A replaced key stays in the
+// keyring for the backups it encrypted
+func ensureWorkspaceKey(keysPath, wsPath string, rotate bool) (id string, created bool, err error) {
+	if id = workspaceKey(wsPath); id != "" && !rotate {
+		if _, err := keyring.Load(keysPath, id); err != nil {
+			return "", false, err
+		}
+		return id, false, nil
+	}
+	if id, err = keyring.New(keysPath); err != nil {
+		return "", false, err
+	}
+	if err := workspace.ChangeConfig(wsPath, "keys", encryptionKey, id); err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// handleKeys lists the workspaces' encryption keys, generates or rotates
+// them, and exports or imports one to restore a backup elsewhere
+func handleKeys(basePath, keysPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	rotate := fs.Bool("rotate", false, "Replace the workspaces' keys with new ones, keeping the old for earlier backups")
+	export := fs.String("export", "", "Write the workspace's key to a file")
+	importPath := fs.String("import", "", "Add a key exported from another machine to the keyring")
+	patterns := parseInterspersed(fs, args)
+
+	switch {
+	case *importPath != "":
+		if len(patterns) > 0 || *export != "" || *rotate {
+			failUsage(keysUsage, "--import takes no workspace names or other options")
+		}
+		data, err := os.ReadFile(*importPath)
+		if err != nil {
+			fail(exitCodeFor(err), "could not read key: %v", err)
+		}
+		id, err := keyring.Import(keysPath, string(data))
+		if err != nil {
+			fail(exitFailure, "could not import key: %v", err)
+		}
+		fmt.Printf("✓ Key %s imported\n", id)
+		return
+	case *export != "":
+		if len(patterns) != 1 || *rotate {
+			failUsage(keysUsage, "--export takes a single workspace name")
+		}
+		exportKey(basePath, keysPath, settingsPath, patterns[0], *export)
+		return
+	case len(patterns) == 0:
+		if *rotate {
+			failUsage(keysUsage, "workspace names required with --rotate")
+		}
+		listKeys(basePath, keysPath)
+		return
+	}
+
+	names := requireWorkspaces(basePath, patterns)
+	for _, name := range names {
+		id, created, err := ensureWorkspaceKey(keysPath, workspacePath(basePath, name), *rotate)
+		if err != nil {
+			fail(exitCodeFor(err), "could not set up the key of workspace '%s': %v", name, err)
+		}
+		switch {
+		case *rotate:
+			fmt.Printf("✓ Workspace '%s' now encrypts with key %s\n", name, id)
+		case created:
+			fmt.Printf("✓ Workspace '%s' has new key %s\n", name, id)
+		default:
+			fmt.Printf("Workspace '%s' encrypts with key %s\n", name, id)
+		}
+	}
+}
+
+// listKeys prints each workspace's key, and whether the keyring has it
+func listKeys(basePath, keysPath string) {
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		fail(exitFailure, "could not list workspaces: %v", err)
+	}
+	for _, ws := range workspaces {
+		id := workspaceKey(workspacePath(basePath, ws.Name))
+		switch _, err := keyring.Load(keysPath, id); {
+		case id == "":
+			fmt.Printf("  %-20s (none)\n", ws.Name)
+		case errors.Is(err, keyring.ErrNoKey):
+			fmt.Printf("  %-20s %s (missing from the keyring, import it with: bashlog-mgr keys --import <file>)\n", ws.Name, id)
+		case err != nil:
+			fmt.Printf("  %-20s %s (%v)\n", ws.Name, id, err)
+		default:
+			fmt.Printf("  %-20s %s\n", ws.Name, id)
+		}
+	}
+}
+
+// exportKey writes the key of workspace name to path, where only its owner
+// can read it, after unlocking the workspace if it is sensitive
+func exportKey(basePath, keysPath, settingsPath, name, path string) {
+	requireWorkspace(basePath, name)
+	wsPath := workspacePath(basePath, name)
+	id := workspaceKey(wsPath)
+	if id == "" {
+		fail(exitNotFound, "workspace '%s' has no key yet (generate one with: bashlog-mgr keys %s)", name, name)
+	}
+	requireSensitiveUnlock(settingsPath, "export the key of", []string{name}, []string{wsPath})
+	exported, err := keyring.Export(keysPath, id)
+	if err != nil {
+		fail(exitCodeFor(err), "could not export key: %v", err)
+	}
+	f, err := fsperm.Private.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		fail(exitCodeFor(err), "could not write key: %v", err)
+	}
+	if _, err := f.WriteString(exported); err != nil {
+		f.Close()
+		fail(exitFailure, "could not write key: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		fail(exitFailure, "could not write key: %v", err)
+	}
+	fmt.Printf("✓ Key %s of workspace '%s' written to %s\n", id, name, path)
+	fmt.Println("  It decrypts this workspace's backups and no other's; keep it safe")
+}
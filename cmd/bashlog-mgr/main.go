@@ -1,74 +1,235 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/interhack86/bashlog/internal/category"
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/logger"
+	"github.com/interhack86/bashlog/internal/migrate"
+	"github.com/interhack86/bashlog/internal/platform"
+	"github.com/interhack86/bashlog/internal/risk"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
 )
 
 const (
 	workspaceDir = ".bashlog-workspaces"
-	configFile   = "config.txt"
+	configFile   = workspace.ConfigFile
+
+	// archiveDir is where archived workspaces are written, relative to $HOME
+	archiveDir = ".bashlog-archive"
+	// trashDir holds deleted workspaces until trashRetention passes,
+	// relative to $HOME
+	trashDir = ".bashlog-trash"
+	// sessionLogDir is where bashlog records sessions, relative to $HOME
+	sessionLogDir = ".bashlog/logs"
+	// settingsFile holds settings shared by all workspaces, such as
+	// notification targets, relative to $HOME
+	settingsFile = ".bashlog/config.txt"
 )
 
 // Workspace represents a bash logging workspace
+// workspaceRoots are the directories holding workspaces, the local root
+// first, as configured with root.<name> settings
+var workspaceRoots []workspace.Root
+
 type Workspace struct {
-	Name      string
-	CreatedAt time.Time
-	Path      string
+	Name         string
+	Root         string
+	CreatedAt    time.Time
+	Path         string
 	CommandCount int
+
+	// MountedFrom is the source of a read-only mounted workspace
+	MountedFrom string
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	global := flag.NewFlagSet("bashlog-mgr", flag.ExitOnError)
+	global.Usage = printUsage
+	logLevel := global.String("log-level", "warn", "Diagnostics to print to stderr: debug, info, warn, or error")
+	logFormat := global.String("log-format", logger.FormatText, "Diagnostic log format: text or json")
+	global.StringVar(&errorFormat, "error-format", "text", "Error report format: text or json")
+	global.Parse(os.Args[1:])
+
+	if errorFormat != "text" && errorFormat != "json" {
+		errorFormat = "text"
+		failUsage("bashlog-mgr [--error-format text|json] <command>", "unknown error format")
+	}
+
+	if err := logger.Setup(os.Stderr, *logLevel, *logFormat); err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	if global.NArg() == 0 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not determine home directory: %v\n", err)
-		os.Exit(1)
+		fail(exitFailure, "could not determine home directory: %v", err)
 	}
 
 	basePath := filepath.Join(homeDir, workspaceDir)
-
-	command := os.Args[1]
-	args := os.Args[2:]
+	settings := workspace.ReadConfig(filepath.Join(homeDir, settingsFile))
+	workspaceRoots = workspace.Roots(settings, basePath)
+	if err := fsperm.Configure(settings); err != nil {
+		fail(exitFailure, "%v (in ~/%s)", err, settingsFile)
+	}
+	if err := storage.Configure(settings); err != nil {
+		fail(exitFailure, "%v (in ~/%s)", err, settingsFile)
+	}
+	basePath = workspaceRoots[0].Path
+	redactOnRead = settings[redactOnReadKey] == "true"
+	logsPath := filepath.Join(homeDir, sessionLogDir)
+	trashPath := filepath.Join(homeDir, trashDir)
+	settingsPath := filepath.Join(homeDir, settingsFile)
+	mountCachePath := filepath.Join(homeDir, mountCacheDir)
+	keysPath := filepath.Join(homeDir, keysDir)
+
+	command := global.Arg(0)
+	args := global.Args()[1:]
+
+	if command != "help" {
+		beginAudit(filepath.Join(homeDir, auditLogFile), command, args)
+	}
 
 	switch command {
 	case "list":
-		handleList(basePath)
+		handleList(basePath, args)
 	case "create":
 		handleCreate(basePath, args)
 	case "delete":
-		handleDelete(basePath, args)
+		handleDelete(basePath, trashPath, settingsPath, args)
+	case "archive":
+		handleArchive(basePath, filepath.Join(homeDir, archiveDir), settingsPath, args)
 	case "view":
-		handleView(basePath, args)
+		handleView(basePath, logsPath, args)
+	case "notes":
+		handleNotes(basePath, args)
+	case "comments":
+		handleComments(basePath, args)
+	case "open":
+		handleOpen(basePath, logsPath, args)
+	case "sessions":
+		handleSessions(basePath, logsPath, args)
+	case "changes":
+		handleChanges(basePath, logsPath, args)
+	case "recall":
+		handleRecall(basePath, logsPath, args)
 	case "stats":
 		handleStats(basePath, args)
 	case "history":
-		handleHistory(basePath, args)
+		handleHistory(basePath, settingsPath, args)
+	case "search":
+		handleSearch(basePath, settingsPath, args)
+	case "show":
+		handleShow(basePath, args)
+	case "copy":
+		handleCopy(basePath, args)
+	case "run":
+		handleRun(basePath, logsPath, args)
+	case "to-ansible":
+		handleToAnsible(basePath, logsPath, args)
+	case "to-dockerfile":
+		handleToDockerfile(basePath, logsPath, args)
+	case "import-history":
+		handleImportHistory(basePath, args)
+	case "import":
+		handleImport(basePath, logsPath, args)
+	case "export":
+		handleExport(basePath, logsPath, settingsPath, args)
+	case "publish":
+		handlePublish(basePath, logsPath, settingsPath, args)
+	case "mount":
+		handleMount(basePath, mountCachePath, args)
+	case "unmount":
+		handleUnmount(basePath, mountCachePath, args)
+	case "sync":
+		handleSync(basePath, args)
+	case "snapshot":
+		handleSnapshot(basePath, args)
+	case "snapshots":
+		handleSnapshots(basePath, args)
+	case "backup":
+		handleBackup(basePath, keysPath, settingsPath, args)
+	case "restore":
+		handleRestore(basePath, trashPath, keysPath, args)
+	case "trash":
+		handleTrash(trashPath, settingsPath, args)
+	case "digest":
+		handleDigest(basePath, logsPath, settingsPath, args)
+	case "report":
+		handleReport(basePath, logsPath, settingsPath, args)
+	case "notify":
+		handleNotify(settingsPath, args)
+	case "rules":
+		handleRules(settingsPath, args)
+	case "scrub":
+		handleScrub(basePath, logsPath, settingsPath, args)
+	case "fsck":
+		handleFsck(basePath, logsPath, args)
+	case "migrate":
+		handleMigrate(basePath, args)
+	case "index":
+		handleIndex(basePath, args)
+	case "bench":
+		handleBench(args)
+	case "audit-log":
+		handleAuditLog(auditPath, args)
+	case "transfers":
+		handleTransfers(basePath, args)
+	case "timeline":
+		handleTimeline(basePath, logsPath, args)
+	case "calendar":
+		handleCalendar(basePath, args)
+	case "tail":
+		handleTail(basePath, args)
+	case "watch":
+		handleWatch(basePath, settingsPath, args)
+	case "serve":
+		handleServe(basePath, settingsPath, args)
+	case "acl":
+		handleACL(basePath, args)
+	case "permissions":
+		handlePermissions(basePath, args)
+	case "protect":
+		handleProtect(basePath, settingsPath, args)
+	case "keys":
+		handleKeys(basePath, keysPath, settingsPath, args)
+	case "events":
+		handleEvents(basePath, settingsPath, args)
 	case "help":
 		printUsage()
 	default:
+		if errorFormat == "json" {
+			fail(exitUsage, "unknown command: %s", command)
+		}
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
+	finishAudit(0)
 }
 
 // handleList displays all available workspaces
-func handleList(basePath string) {
+func handleList(basePath string, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	activity := fs.Bool("activity", false, "Show commands per day over the last 30 days")
+	fs.Parse(args)
+
 	workspaces, err := getWorkspaces(basePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading workspaces: %v\n", err)
-		os.Exit(1)
+		fail(exitFailure, "could not read workspaces: %v", err)
 	}
 
 	if len(workspaces) == 0 {
@@ -76,145 +237,291 @@ func handleList(basePath string) {
 		return
 	}
 
+	if *activity {
+		now := time.Now()
+		fmt.Printf("%-20s %-10s %s\n", "NAME", "COMMANDS", "ACTIVITY (30 DAYS)")
+		fmt.Println(strings.Repeat("-", 62))
+		sparklines := make([]string, len(workspaces))
+		scanEach("Reading workspaces", len(workspaces), func(i int) {
+			sparklines[i] = workspaceActivity(workspaces[i].Path, now)
+		})
+		for i, ws := range workspaces {
+			fmt.Printf("%-20s %-10d %s\n", ws.Name, ws.CommandCount, sparklines[i])
+		}
+		return
+	}
+
 	fmt.Printf("%-20s %-19s %-10s %s\n", "NAME", "CREATED", "COMMANDS", "PATH")
 	fmt.Println(strings.Repeat("-", 70))
 
 	for _, ws := range workspaces {
+		where := ws.Path
+		if ws.MountedFrom != "" {
+			where = ws.MountedFrom + " (read-only)"
+		}
+		if ws.Root != workspace.LocalRoot {
+			where += " [" + ws.Root + "]"
+		}
 		fmt.Printf("%-20s %-19s %-10d %s\n",
 			ws.Name,
 			ws.CreatedAt.Format("2006-01-02 15:04:05"),
 			ws.CommandCount,
-			ws.Path)
+			where)
 	}
 }
 
 // handleCreate creates a new workspace
 func handleCreate(basePath string, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: workspace name required\n")
-		fmt.Fprintf(os.Stderr, "Usage: bashlog-mgr create <name>\n")
-		os.Exit(1)
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	rootName := fs.String("root", workspace.LocalRoot, "Workspace root to create it in, as set with root.<name> in ~/"+settingsFile)
+	modeName := fs.String("mode", "", "Permissions of its files: private, group for a team workspace, or an octal mode such as 0640 (default: files.mode setting, else private)")
+	group := fs.String("group", "", "Group to share a --mode group workspace with (default: your primary group)")
+	storageName := fs.String("storage", "", "Where to keep its commands: "+strings.Join(storage.Names(), " or ")+" (default: storage setting, else files)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage(createUsage, "workspace name required")
+	}
+	mode := fsperm.Default
+	if *modeName != "" {
+		var err error
+		if mode, err = fsperm.Parse(*modeName); err != nil {
+			fail(exitUsage, "%v", err)
+		}
+	}
+	if *group != "" && mode != fsperm.Group {
+		failUsage(createUsage, "--group is for --mode group")
+	}
+	backend := storage.Default
+	if *storageName != "" {
+		var err error
+		if backend, err = storage.New(*storageName); err != nil {
+			fail(exitUsage, "%v", err)
+		}
 	}
 
-	name := args[0]
+	name := positional[0]
 
 	// Validate workspace name
 	if !isValidName(name) {
-		fmt.Fprintf(os.Stderr, "Error: invalid workspace name '%s'\n", name)
-		fmt.Fprintf(os.Stderr, "Names must contain only alphanumeric characters, hyphens, and underscores\n")
-		os.Exit(1)
+		fail(exitUsage, "invalid workspace name '%s': names must contain only alphanumeric characters, hyphens, and underscores", name)
 	}
 
-	wsPath := filepath.Join(basePath, name)
+	root, ok := workspace.FindRoot(workspaceRoots, *rootName)
+	if !ok {
+		fail(exitNotFound, "workspace root '%s' not found (configure it with root.%s=<path> in ~/%s)", *rootName, *rootName, settingsFile)
+	}
 
-	// Check if workspace already exists
-	if _, err := os.Stat(wsPath); err == nil {
-		fmt.Fprintf(os.Stderr, "Error: workspace '%s' already exists\n", name)
-		os.Exit(1)
+	// Check if workspace already exists, in any root since names must
+	// stay unique to be looked up
+	if existing, ok := workspace.Find(workspaceRoots, name); ok {
+		fail(exitConflict, "workspace '%s' already exists (%s)", name, existing)
 	}
+	wsPath := filepath.Join(root.Path, name)
 
 	// Create workspace directory structure
-	if err := os.MkdirAll(wsPath, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating workspace: %v\n", err)
-		os.Exit(1)
+	if err := fsperm.Default.MkdirAll(root.Path); err != nil {
+		fail(exitFailure, "could not create workspace: %v", err)
+	}
+	if err := mode.MkdirAll(wsPath); err != nil {
+		fail(exitFailure, "could not create workspace: %v", err)
+	}
+	if *group != "" {
+		if err := shareWithGroup(wsPath, *group, mode); err != nil {
+			os.RemoveAll(wsPath)
+			fail(exitFailure, "could not share workspace with group '%s': %v", *group, err)
+		}
 	}
 
-	// Create config file
+	// Create config file, recording the mode so every file added later
+	// gets it, whoever adds it, and the backend its commands are kept in
 	configPath := filepath.Join(wsPath, configFile)
-	config := fmt.Sprintf("name=%s\ncreated=%s\ncommands=0\n",
-		name, time.Now().Format(time.RFC3339))
+	config := fmt.Sprintf("name=%s\ncreated=%s\ncommands=0\n%s=%s\n%s=%s\n%s=%d\n",
+		name, time.Now().Format(time.RFC3339), fsperm.Setting, mode, storage.Setting, backend.Name(),
+		migrate.LayoutKey, migrate.Latest())
 
-	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating config file: %v\n", err)
-		os.Exit(1)
+	if err := mode.WriteFile(configPath, []byte(config)); err != nil {
+		fail(exitFailure, "could not create config file: %v", err)
 	}
 
-	// Create history file
-	historyPath := filepath.Join(wsPath, "history.log")
-	if err := os.WriteFile(historyPath, []byte(""), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating history file: %v\n", err)
-		os.Exit(1)
+	if err := backend.OpenWorkspace(wsPath); err != nil {
+		os.RemoveAll(wsPath)
+		fail(exitFailure, "could not create %s storage: %v", backend.Name(), err)
 	}
 
 	fmt.Printf("✓ Workspace '%s' created successfully at %s\n", name, wsPath)
 }
 
-// handleDelete removes a workspace
-func handleDelete(basePath string, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: workspace name required\n")
-		fmt.Fprintf(os.Stderr, "Usage: bashlog-mgr delete <name>\n")
-		os.Exit(1)
+// handleDelete moves workspaces to the trash, or removes them for good
+// with --permanent
+func handleDelete(basePath, trashPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	var yes bool
+	fs.BoolVar(&yes, "yes", false, "Delete without asking for confirmation")
+	fs.BoolVar(&yes, "force", false, "Same as --yes")
+	dryRun := fs.Bool("dry-run", false, "Print what would be removed without removing it")
+	permanent := fs.Bool("permanent", false, "Remove the workspace instead of moving it to the trash")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage("bashlog-mgr delete <name|pattern>... [--yes] [--dry-run] [--permanent]", "workspace name or pattern required")
 	}
 
-	name := args[0]
-	wsPath := filepath.Join(basePath, name)
-
-	// Check if workspace exists
-	if _, err := os.Stat(wsPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: workspace '%s' not found\n", name)
-		os.Exit(1)
+	names := requireWorkspaces(basePath, positional)
+	for _, name := range names {
+		if workspace.IsMounted(workspacePath(basePath, name)) {
+			fail(exitConflict, "workspace '%s' is mounted read-only (remove it with: bashlog-mgr unmount %s)", name, name)
+		}
+	}
+	systemTrash := workspace.ReadConfig(settingsPath)[trashKey] == trashSystem
+	trashName := "trash"
+	if systemTrash {
+		trashName = "system trash"
 	}
 
-	// Confirm deletion
-	fmt.Printf("Are you sure you want to delete workspace '%s'? (yes/no): ", name)
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.TrimSpace(strings.ToLower(response))
+	if *dryRun {
+		for _, name := range names {
+			wsPath := workspacePath(basePath, name)
+			if !*permanent {
+				fmt.Printf("would move %s to the %s\n", wsPath, trashName)
+				continue
+			}
+			if err := printRemoval(wsPath); err != nil {
+				fail(exitFailure, "could not list workspace '%s': %v", name, err)
+			}
+		}
+		return
+	}
 
-	if response != "yes" && response != "y" {
+	action := "delete"
+	if *permanent {
+		action = "permanently delete"
+	}
+	if !confirmWorkspaces(action, names, yes) {
 		fmt.Println("Deletion cancelled")
 		return
 	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = workspacePath(basePath, name)
+	}
+	requireSensitiveUnlock(settingsPath, action, names, paths)
+
+	now := time.Now()
+	purgeExpiredTrash(trashPath, now)
+
+	for _, name := range names {
+		wsPath := workspacePath(basePath, name)
+		if *permanent {
+			if err := os.RemoveAll(wsPath); err != nil {
+				fail(exitFailure, "could not delete workspace '%s': %v", name, err)
+			}
+			fmt.Printf("✓ Workspace '%s' deleted successfully\n", name)
+			continue
+		}
+
+		if systemTrash {
+			dest, err := platform.Trash(wsPath)
+			if err != nil {
+				fail(exitFailure, "could not move workspace '%s' to the system trash: %v", name, err)
+			}
+			fmt.Printf("✓ Workspace '%s' moved to %s (restore it from there)\n", name, dest)
+			continue
+		}
+		if err := moveToTrash(wsPath, trashPath, now); err != nil {
+			fail(exitFailure, "could not delete workspace '%s': %v", name, err)
+		}
+		fmt.Printf("✓ Workspace '%s' moved to trash (restore with: bashlog-mgr restore %s)\n", name, name)
+	}
+}
 
-	if err := os.RemoveAll(wsPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error deleting workspace: %v\n", err)
-		os.Exit(1)
+// printRemoval lists every file a removal of path would delete, for
+// --dry-run
+func printRemoval(path string) error {
+	var files int
+	var size int64
+
+	err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("would remove %s (%d bytes)\n", p, info.Size())
+		files++
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("✓ Workspace '%s' deleted successfully\n", name)
+	fmt.Printf("would remove %s\n\n%d file(s), %d bytes\n", path, files, size)
+	return nil
 }
 
 // handleView displays workspace details
-func handleView(basePath string, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: workspace name required\n")
-		fmt.Fprintf(os.Stderr, "Usage: bashlog-mgr view <name>\n")
-		os.Exit(1)
+func handleView(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	atFlag := fs.String("at", "", "Show the workspace as it was at this time, e.g. '2024-06-01 14:00' or '2d ago'")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage("bashlog-mgr view <name> [--at time]", "workspace name required")
 	}
 
-	name := args[0]
-	wsPath := filepath.Join(basePath, name)
+	name := positional[0]
+	wsPath := workspacePath(basePath, name)
 
 	// Check if workspace exists
 	if _, err := os.Stat(wsPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: workspace '%s' not found\n", name)
-		os.Exit(1)
+		fail(exitNotFound, "workspace '%s' not found", name)
+	}
+
+	if *atFlag != "" {
+		at, err := parseInstant(*atFlag)
+		if err != nil {
+			fail(exitUsage, "invalid --at '%s': %v", *atFlag, err)
+		}
+		viewAt(logsPath, name, wsPath, at)
+		return
 	}
 
 	// Read config
-	config := readConfig(filepath.Join(wsPath, configFile))
+	config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
 
 	fmt.Printf("\n=== Workspace: %s ===\n", name)
 	fmt.Printf("Path: %s\n", wsPath)
 	fmt.Printf("Created: %s\n", config["created"])
 	fmt.Printf("Commands Logged: %s\n", config["commands"])
+	fmt.Printf("Activity (30 days): %s\n", workspaceActivity(wsPath, time.Now()))
 
-	// Show recent history
-	historyPath := filepath.Join(wsPath, "history.log")
-	if data, err := os.ReadFile(historyPath); err == nil {
-		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
-		count := len(lines)
-		if count > 0 && lines[0] != "" {
-			fmt.Printf("\nRecent Commands (last 5):\n")
-			start := count - 5
-			if start < 0 {
-				start = 0
+	if notes, err := readNotes(wsPath); err == nil && notes != "" {
+		fmt.Printf("\nNotes:\n")
+		for _, line := range strings.Split(notes, "\n") {
+			fmt.Println(strings.TrimRight("  "+line, " "))
+		}
+	}
+
+	if entries, err := storage.Read(wsPath); err == nil {
+		if risky := riskyCommands(name, entries, risk.High); len(risky) > 0 {
+			fmt.Printf("\nHigh-Risk Commands (%d):\n", len(risky))
+			if len(risky) > 5 {
+				risky = risky[len(risky)-5:]
 			}
-			for i := start; i < count; i++ {
-				if lines[i] != "" {
-					fmt.Printf("  %s\n", lines[i])
-				}
+			printRisky(risky, false)
+		}
+
+		// Show recent history
+		if len(entries) > 0 {
+			fmt.Printf("\nRecent Commands (last 5):\n")
+			for _, e := range entries[max(0, len(entries)-5):] {
+				fmt.Printf("  %s\n", redactRead(e.Command))
 			}
 		}
 	}
@@ -223,10 +530,17 @@ func handleView(basePath string, args []string) {
 
 // handleStats displays workspace statistics
 func handleStats(basePath string, args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	idleAfter := fs.Duration("idle", defaultIdleAfter, "Gap between commands after which time counts as idle")
+	topRisky := fs.Int("risky", 10, "Number of high-risk commands to list")
+	byCategory := fs.Bool("by-category", false, "Break commands down by category")
+	categoryName := fs.String("category", "", "Only count commands in this category")
+	fs.Parse(args)
+	cat := parseCategoryFlag(*categoryName)
+
 	workspaces, err := getWorkspaces(basePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading workspaces: %v\n", err)
-		os.Exit(1)
+		fail(exitFailure, "could not read workspaces: %v", err)
 	}
 
 	if len(workspaces) == 0 {
@@ -235,11 +549,44 @@ func handleStats(basePath string, args []string) {
 	}
 
 	totalCommands := 0
+	var activeTime, idleTime time.Duration
+	var risky []riskyEntry
+	var all []workspace.Entry
 	oldestWorkspace := workspaces[0]
 	newestWorkspace := workspaces[0]
 
-	for _, ws := range workspaces {
+	// Each workspace is summed up in parallel, then the sums are combined
+	// in order
+	type summary struct {
+		entries      []workspace.Entry
+		active, idle time.Duration
+		risky        []riskyEntry
+	}
+	summaries := make([]summary, len(workspaces))
+	scanEach("Reading workspaces", len(workspaces), func(i int) {
+		ws, sum := workspaces[i], &summaries[i]
+		if cat == "" && !*byCategory {
+			// The common case doesn't need the histories themselves, so
+			// it comes from the workspaces' stats caches
+			if stats, err := storage.For(ws.Path).Stats(ws.Path, *idleAfter); err == nil {
+				sum.active, sum.idle = stats.Active, stats.Idle
+				sum.risky = riskyCommands(ws.Name, stats.Risky, risk.High)
+			}
+			return
+		}
+		if entries, err := storage.Read(ws.Path); err == nil {
+			sum.entries = filterCategory(entries, cat)
+			sum.active, sum.idle = workspace.Activity(sum.entries, *idleAfter)
+			sum.risky = riskyCommands(ws.Name, sum.entries, risk.High)
+		}
+	})
+
+	for i, ws := range workspaces {
 		totalCommands += ws.CommandCount
+		all = append(all, summaries[i].entries...)
+		activeTime += summaries[i].active
+		idleTime += summaries[i].idle
+		risky = append(risky, summaries[i].risky...)
 		if ws.CreatedAt.Before(oldestWorkspace.CreatedAt) {
 			oldestWorkspace = ws
 		}
@@ -250,97 +597,307 @@ func handleStats(basePath string, args []string) {
 
 	fmt.Println("\n=== Workspace Statistics ===")
 	fmt.Printf("Total Workspaces: %d\n", len(workspaces))
+	if cat != "" {
+		fmt.Printf("Category: %s\n", cat)
+		totalCommands = len(all)
+	}
 	fmt.Printf("Total Commands Logged: %d\n", totalCommands)
 	if len(workspaces) > 0 {
 		fmt.Printf("Average Commands per Workspace: %.2f\n", float64(totalCommands)/float64(len(workspaces)))
 	}
+	fmt.Printf("Active Time: %s\n", formatDuration(activeTime))
+	fmt.Printf("Idle Time: %s (gaps over %s)\n", formatDuration(idleTime), formatDuration(*idleAfter))
 	fmt.Printf("Oldest Workspace: %s (created %s)\n", oldestWorkspace.Name, oldestWorkspace.CreatedAt.Format("2006-01-02"))
 	fmt.Printf("Newest Workspace: %s (created %s)\n", newestWorkspace.Name, newestWorkspace.CreatedAt.Format("2006-01-02"))
+	fmt.Printf("High-Risk Commands: %d\n", len(risky))
+	if len(risky) > 0 {
+		sort.SliceStable(risky, func(i, j int) bool { return risky[i].Time.After(risky[j].Time) })
+		if len(risky) > *topRisky {
+			risky = risky[:*topRisky]
+		}
+		fmt.Printf("\nMost Recent High-Risk Commands:\n")
+		printRisky(risky, true)
+	}
+	if *byCategory && len(all) > 0 {
+		printCategoryBreakdown(all)
+	}
 	fmt.Println()
 }
 
+const historyUsage = "bashlog-mgr history <name> [lines] [--date day] [--unique] [--category name] [--tag tag] [--host name] [--origin name|--interactive] [--template text|--format name] [--to file]"
+
 // handleHistory displays command history for a workspace
-func handleHistory(basePath string, args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: workspace name required\n")
-		fmt.Fprintf(os.Stderr, "Usage: bashlog-mgr history <name> [lines]\n")
-		os.Exit(1)
+func handleHistory(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	unique := fs.Bool("unique", false, "Collapse repeated commands, showing use count and last use")
+	categoryName := fs.String("category", "", "Only show commands in this category ("+categoryNames()+")")
+	tag := fs.String("tag", "", "Only show commands with this tag")
+	host := fs.String("host", "", "Only show commands recorded on this host")
+	originName := fs.String("origin", "", "Only show commands from this origin ("+strings.Join(workspace.Origins, ", ")+")")
+	interactive := fs.Bool("interactive", false, "Only show commands typed at a prompt, same as --origin interactive")
+	date := fs.String("date", "", "Show every command run on this day: 2024-07-03, today, yesterday or a weekday such as tuesday")
+	results := resultFlags(fs)
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage(historyUsage, "workspace name required")
+	}
+	results.check(historyUsage)
+	cat := parseCategoryFlag(*categoryName)
+	origin := parseOriginFlag(*originName, *interactive)
+	var day time.Time
+	if *date != "" {
+		var err error
+		if day, err = parseDay(*date, time.Now()); err != nil {
+			fail(exitUsage, "invalid --date '%s': %v", *date, err)
+		}
 	}
 
-	name := args[0]
-	wsPath := filepath.Join(basePath, name)
+	name := positional[0]
+	wsPath := workspacePath(basePath, name)
 
 	// Check if workspace exists
 	if _, err := os.Stat(wsPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: workspace '%s' not found\n", name)
-		os.Exit(1)
+		fail(exitNotFound, "workspace '%s' not found", name)
 	}
 
 	// Parse number of lines to display (default: 20)
 	lines := 20
-	if len(args) > 1 {
-		fmt.Sscanf(args[1], "%d", &lines)
+	if len(positional) > 1 {
+		fmt.Sscanf(positional[1], "%d", &lines)
 	}
 
-	historyPath := filepath.Join(wsPath, "history.log")
-	data, err := os.ReadFile(historyPath)
+	// Commands are numbered by their position in the whole history, so the
+	// numbers stay valid references for copy and run when filtering. A
+	// day's commands come from its rollup, numbered already
+	var entries []workspace.Entry
+	var numbers []int
+	if *date != "" {
+		days, err := storage.ReadDay(wsPath, day)
+		if err != nil {
+			fail(exitFailure, "could not read history: %v", err)
+		}
+		for _, e := range days {
+			entries = append(entries, e.Entry)
+			numbers = append(numbers, e.Number)
+		}
+	} else {
+		all, err := storage.Read(wsPath)
+		if err != nil {
+			fail(exitFailure, "could not read history: %v", err)
+		}
+		for i, e := range all {
+			entries = append(entries, e)
+			numbers = append(numbers, i+1)
+		}
+	}
+	tags, err := workspace.ReadTags(wsPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
-		os.Exit(1)
+		fail(exitFailure, "could not read tags: %v", err)
+	}
+	hosts, err := workspace.ReadHosts(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read hosts: %v", err)
+	}
+	origins, err := workspace.ReadOrigins(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read origins: %v", err)
 	}
 
-	if len(data) == 0 {
-		fmt.Printf("No command history for workspace '%s'\n", name)
+	var kept []workspace.Entry
+	var keptNumbers []int
+	for i, e := range entries {
+		if (cat == "" || category.Matches(e.Command, cat)) && (*tag == "" || tags.Has(e, *tag)) && (*host == "" || hosts.Matches(e, *host)) && (origin == "" || origins.Of(e) == origin) {
+			kept = append(kept, e)
+			keptNumbers = append(keptNumbers, numbers[i])
+		}
+	}
+	entries, numbers = kept, keptNumbers
+
+	if len(entries) == 0 && !results.active() {
+		switch {
+		case cat != "" || *tag != "" || *host != "" || origin != "":
+			fmt.Printf("No matching commands in workspace '%s'\n", name)
+		case *date != "":
+			fmt.Printf("No commands in workspace '%s' on %s\n", name, day.Format("Monday 2006-01-02"))
+		default:
+			fmt.Printf("No command history for workspace '%s'\n", name)
+		}
+		return
+	}
+
+	if *date != "" {
+		lines = len(entries)
+	}
+	if results.active() {
+		results.write(basePath, settingsPath, "History of workspace "+name, historyRows(name, entries, numbers, tags, *unique, lines))
+		return
+	}
+	if *unique {
+		printUniqueHistory(name, workspace.Unique(entries), lines)
+		return
+	}
+	if *date != "" {
+		printDayHistory(name, day, entries, numbers, tags)
 		return
 	}
 
-	historyLines := strings.Split(strings.TrimSpace(string(data)), "\n")
-	
 	// Display last N lines
 	fmt.Printf("\n=== Command History for '%s' (last %d commands) ===\n", name, lines)
 	fmt.Println(strings.Repeat("-", 80))
 
-	start := len(historyLines) - lines
+	start := len(entries) - lines
+	if start < 0 {
+		start = 0
+	}
+
+	for i, entry := range entries[start:] {
+		fmt.Printf("%3d. %s%s\n", numbers[start+i], redactRead(entry.Command), formatTags(tags.Of(entry)))
+	}
+	fmt.Println()
+}
+
+// historyRows returns the last lines of entries, or of the distinct
+// commands among them, as results
+func historyRows(name string, entries []workspace.Entry, numbers []int, tags workspace.Tags, unique bool, lines int) []resultRow {
+	var rows []resultRow
+	if unique {
+		for _, u := range workspace.Unique(entries) {
+			row := newResultRow(name, 0, workspace.Entry{Command: u.Command, Time: u.LastUsed}, nil)
+			row.Count = u.Count
+			rows = append(rows, row)
+		}
+	} else {
+		for i, e := range entries {
+			rows = append(rows, newResultRow(name, numbers[i], e, tags.Of(e)))
+		}
+	}
+	if lines >= 0 && len(rows) > lines {
+		rows = rows[len(rows)-lines:]
+	}
+	return rows
+}
+
+// printUniqueHistory displays the last N distinct commands of a workspace
+func printUniqueHistory(name string, unique []workspace.UniqueEntry, lines int) {
+	fmt.Printf("\n=== Unique Commands for '%s' (last %d of %d) ===\n", name, lines, len(unique))
+	fmt.Printf("%-4s %-19s %-6s %s\n", "", "LAST USED", "COUNT", "COMMAND")
+	fmt.Println(strings.Repeat("-", 80))
+
+	start := len(unique) - lines
 	if start < 0 {
 		start = 0
 	}
 
-	for i, line := range historyLines[start:] {
-		if line != "" {
-			fmt.Printf("%3d. %s\n", i+1, line)
+	for i, u := range unique[start:] {
+		lastUsed := "-"
+		if !u.LastUsed.IsZero() {
+			lastUsed = u.LastUsed.Format("2006-01-02 15:04:05")
 		}
+		fmt.Printf("%3d. %-19s %-6d %s\n", i+1, lastUsed, u.Count, redactRead(u.Command))
 	}
 	fmt.Println()
 }
 
-// Helper functions
+// printDayHistory displays every command a workspace ran on day, with the
+// time each ran
+func printDayHistory(name string, day time.Time, entries []workspace.Entry, numbers []int, tags workspace.Tags) {
+	fmt.Printf("\n=== Command History for '%s' on %s (%d commands) ===\n", name, day.Format("Monday 2006-01-02"), len(entries))
+	fmt.Println(strings.Repeat("-", 80))
+	for i, entry := range entries {
+		fmt.Printf("%3d. %s  %s%s\n", numbers[i], entry.Time.Local().Format("15:04:05"), redactRead(entry.Command), formatTags(tags.Of(entry)))
+	}
+	fmt.Println()
+}
 
-func getWorkspaces(basePath string) ([]Workspace, error) {
-	entries, err := os.ReadDir(basePath)
+// parseDay reads the day --date names, relative to now: a date such as
+// "2024-07-03", "today", "yesterday", or a weekday name for the latest
+// such day before today, so "tuesday" is last Tuesday
+func parseDay(s string, now time.Time) (time.Time, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	switch word := strings.ToLower(s); word {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	default:
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if name := strings.ToLower(wd.String()); word == name || word == name[:3] {
+				back := (int(today.Weekday()) - int(wd) + 6) % 7
+				return today.AddDate(0, 0, -back-1), nil
+			}
+		}
+	}
+	day, err := time.ParseInLocation(time.DateOnly, s, time.Local)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []Workspace{}, nil
+		return time.Time{}, fmt.Errorf("expected a date such as '2024-07-03', today, yesterday or a weekday")
+	}
+	return day, nil
+}
+
+// Helper functions
+
+// parseInterspersed parses flags that may appear before, between, or after
+// positional arguments and returns the positional arguments in order.
+// Negative numbers such as -1 are positional arguments, not flags
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		i := 0
+		for i < len(args) && !(isNegativeNumber(args[i]) && (i == 0 || !takesValue(fs, args[i-1]))) {
+			i++
 		}
-		return nil, err
+		fs.Parse(args[:i])
+		rest := append(fs.Args(), args[i:]...)
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
+}
 
-	var workspaces []Workspace
+func isNegativeNumber(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil && strings.HasPrefix(arg, "-")
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			wsPath := filepath.Join(basePath, entry.Name())
-			config := readConfig(filepath.Join(wsPath, configFile))
+// takesValue reports whether arg is a flag of fs whose value is the next
+// argument, as in --exit -1
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if name == arg || strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !bf.IsBoolFlag()
+}
 
-			createdTime, _ := time.Parse(time.RFC3339, config["created"])
-			commandCount := 0
-			fmt.Sscanf(config["commands"], "%d", &commandCount)
+func getWorkspaces(basePath string) ([]Workspace, error) {
+	roots := workspaceRoots
+	if len(roots) == 0 {
+		roots = []workspace.Root{{Name: workspace.LocalRoot, Path: basePath}}
+	}
 
-			workspaces = append(workspaces, Workspace{
-				Name:         entry.Name(),
-				CreatedAt:    createdTime,
-				Path:         wsPath,
-				CommandCount: commandCount,
-			})
+	var workspaces []Workspace
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		found, err := rootWorkspaces(root)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %w", root.Name, err)
+		}
+		// A name in an earlier root hides the same name in later ones, as
+		// it does when the workspace is looked up
+		for _, ws := range found {
+			if !seen[ws.Name] {
+				seen[ws.Name] = true
+				workspaces = append(workspaces, ws)
+			}
 		}
 	}
 
@@ -352,22 +909,83 @@ func getWorkspaces(basePath string) ([]Workspace, error) {
 	return workspaces, nil
 }
 
-func readConfig(configPath string) map[string]string {
-	config := make(map[string]string)
-	data, err := os.ReadFile(configPath)
+// rootWorkspaces lists the workspaces in one root, in directory order
+func rootWorkspaces(root workspace.Root) ([]Workspace, error) {
+	entries, err := os.ReadDir(root.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Workspace{}, nil
+		}
+		return nil, err
+	}
+
+	mounts, err := workspace.ReadMounts(root.Path)
 	if err != nil {
-		return config
+		return nil, err
+	}
+	mountedFrom := make(map[string]string)
+	for _, m := range mounts {
+		mountedFrom[m.Name] = m.Source
+	}
+
+	var names []string
+	for _, entry := range entries {
+		// Dot-directories are staging areas, not workspaces
+		isDir := entry.IsDir() || (mountedFrom[entry.Name()] != "" && entry.Type()&os.ModeSymlink != 0)
+		if isDir && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			config[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	// Configs are read in parallel, since on a large synced tree each read
+	// can mean a round trip
+	workspaces := make([]Workspace, len(names))
+	scanEach("Scanning workspaces in "+root.Name, len(names), func(i int) {
+		wsPath := filepath.Join(root.Path, names[i])
+		config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
+
+		createdTime, _ := time.Parse(time.RFC3339, config["created"])
+		commandCount := 0
+		fmt.Sscanf(config["commands"], "%d", &commandCount)
+
+		workspaces[i] = Workspace{
+			Name:         names[i],
+			Root:         root.Name,
+			CreatedAt:    createdTime,
+			Path:         wsPath,
+			CommandCount: commandCount,
+			MountedFrom:  mountedFrom[names[i]],
 		}
+	})
+	return workspaces, nil
+}
+
+// workspacePath is where workspace name lives: in the first root holding
+// it, or in the local root at basePath for a workspace that doesn't exist
+func workspacePath(basePath, name string) string {
+	if p, ok := workspace.Find(workspaceRoots, name); ok {
+		return p
 	}
+	return filepath.Join(basePath, name)
+}
 
-	return config
+// requireWorkspace returns the path of the named workspace, exiting if it
+// does not exist
+func requireWorkspace(basePath, name string) string {
+	wsPath := workspacePath(basePath, name)
+	if _, err := os.Stat(wsPath); err != nil {
+		fail(exitNotFound, "workspace '%s' not found", name)
+	}
+	return wsPath
+}
+
+// formatDuration renders d to the minute, without trailing zero units
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	s := d.Round(time.Minute).String()
+	return strings.TrimSuffix(s, "0s")
 }
 
 func isValidName(name string) bool {
@@ -388,28 +1006,435 @@ func isValidName(name string) bool {
 }
 
 func printUsage() {
-	fmt.Println(`bashlog-mgr - Bash Command Logging Workspace Manager
+	fmt.Print(`bashlog-mgr - Bash Command Logging Workspace Manager
 
 Usage:
-  bashlog-mgr <command> [options]
+  bashlog-mgr [--log-level level] [--log-format text|json]
+              [--error-format text|json] <command> [options]
+
+Diagnostics are written to stderr at --log-level (debug, info, warn, error;
+default warn), leaving stdout for command output. With --error-format json,
+errors are reported on stderr as {"error": {"code", "exit_code", "message"}}.
+
+Exit codes:
+  0  success
+  1  failure
+  2  invalid arguments
+  3  workspace, snapshot, backup or file not found
+  4  target already exists
+  5  fsck found problems (run with --repair to fix them), or audit-log
+     --verify found the log tampered with
 
 Commands:
-  list              List all workspaces with statistics
-  create <name>     Create a new workspace
-  delete <name>     Delete a workspace (with confirmation)
-  view <name>       View detailed information about a workspace
-  stats             Display overall statistics across all workspaces
-  history <name> [lines]  Show command history for a workspace (default: last 20 lines)
+  list [--activity] List all workspaces with statistics, or with a sparkline
+                    of commands per day over the last 30 days
+  create <name> [--root name] [--mode private|group|0640] [--group name]
+         [--storage files|sqlite|postgres]
+                    Create a new workspace, in the local root or a configured
+                    one; --mode group makes it a team workspace its group can
+                    record into and read
+  permissions <name> [private|group|0640] [--group name]
+                    Show the permissions a workspace's files get, or change
+                    them for the files it has and those added later
+  acl <name> [grant|revoke <role> <name>...|clear]
+                    Show who serve lets at a workspace, or grant and revoke
+                    roles: owners, readers, auditors or appenders, to
+                    token:<name>, user:<name> or role:<name> (a bare name
+                    is a token's)
+  delete <name|pattern>... [--yes] [--dry-run] [--permanent]
+                    Move workspaces, e.g. 'tmp-*', to the trash for 30 days
+                    (with confirmation unless --yes/--force; --dry-run lists
+                    what would be removed; --permanent skips the trash); with
+                    trash=system in ~/.bashlog/config.txt, to the desktop's
+                    trash bin instead, to restore from the file manager
+  archive <name|pattern>... [--output dir] [--yes]
+                    Pack workspaces into tarballs (default ~/.bashlog-archive/)
+                    and remove them
+  view <name> [--at time]
+                    View detailed information about a workspace, including
+                    its notes and most recent high-risk commands; --at shows
+                    its commands and active sessions as of a past time,
+                    using snapshots taken by then
+  notes <name> [--edit]
+                    Show a workspace's notes.md, or open it in $VISUAL or
+                    $EDITOR (created if needed)
+  comments <name> [n]
+                    Show the comment threads reviewers left on a workspace's
+                    commands and sessions through serve, or those on command n
+  open <name> [session] [--editor] [--list]
+                    Open a session transcript recorded into a workspace (the
+                    latest by default) in $PAGER, or $EDITOR with --editor
+  sessions [name] [--egress] [--terminal] [--summary] [--clock]
+                    List recorded sessions, or those of a workspace, as trees
+                    of the sessions started from them, including privileged
+                    shells started with sudo -i, sudo -s or su; --egress
+                    adds the outbound connections of sessions recorded with
+                    bashlog --egress, --terminal the terminal each ran in,
+                    with its resizes and window titles, --summary what was
+                    printed when each ended, and --clock the NTP state of the
+                    clock and the commands timed by the monotonic clock, so
+                    they stay right when the wall clock jumped
+  changes <name> [session] [--files]
+                    Show the files each command of a session created, modified
+                    and deleted, for sessions run with bashlog --watch-files
+                    (the latest by default); --files lists each file once
+  stats [--idle 30m] [--risky 10] [--by-category] [--category name]
+                    Display overall statistics across all workspaces, including
+                    active and idle time from gaps between commands and the
+                    most recent high-risk commands (deletions, privilege
+                    escalation, exfiltration, package installs); --by-category
+                    breaks commands down by category
+  history <name> [lines] [--date day] [--unique] [--category name]
+          [--tag tag] [--host name] [--origin name|--interactive]
+          [--template text|--format name] [--to file]
+                    Show command history for a workspace (default: last 20
+                    lines), numbered by position for copy and run;
+                    --interactive leaves out commands run by scripts and
+                    tools through bashlog -c, and imported ones; --date
+                    shows every command of one day (2024-07-03, today,
+                    yesterday or a weekday for the latest one); --template
+                    prints each command through a Go template, and --to
+                    writes them to a file, in --format bash, atuin,
+                    markdown or ipynb (default: from the file's extension)
+  tail <name> [n] [--follow] [--remote url --token token]
+                    Show the last n commands (default 10); --follow keeps
+                    printing new ones, from a serve instance with --remote
+  watch [name|pattern...] [--notify target,...] [--json]
+                    Print commands as any workspace receives them, including
+                    workspaces created meanwhile, and post them to
+                    notification targets, e.g. to keep an eye on a bastion
+  transfers <name> [--tool name] [--direction dir] [--since 7d] [--scan]
+                    Report the file transfers made with scp, sftp, rsync,
+                    curl -O/-o/-T and wget: source, destination and which way
+                    (upload, download, remote, local, session); --scan finds
+                    them in the history instead of the recorded ones
+  transfers <name> --record on|off
+                    Record the workspace's transfers as its commands come in
+  timeline <name> [--since 1d]
+                    Draw recent commands against time, with concurrent
+                    sessions side by side as lanes
+  recall [--around '30m ago'] [--span 30m] [--workspace pattern]
+                    Tell what you were doing around a time, to pick up after
+                    an interruption: the commands run across workspaces as
+                    stretches of work, each with its directory and git branch,
+                    and which failed
+  calendar [name] [--year 2024] [--month 2024-07]
+                    Draw a calendar of the commands run each day, in a
+                    workspace or all of them, over the last 12 months, a year,
+                    or one month with each day's count
+  show <name> <n> [--output]
+                    Show command n's details, or with --output what it printed
+                    (recorded for sessions run with bashlog --pty)
+  copy <name> <n> [--osc52]
+                    Put command n (or -1 for the latest) on the clipboard via
+                    pbcopy, wl-copy, xclip, xsel or clip.exe, or OSC 52
+  run <name> <n> [--confirm] [--cd]
+                    Re-run command n in the current directory, or with --cd
+                    the one it ran in, and record it as a new command tagged
+                    rerun-of-<n>; exits with its status
+  search [query] [--workspace pattern] [--category name] [--tag tag]
+         [--host name] [--origin name|--interactive] [-i] [--output]
+         [--limit 50] [--template text|--format name] [--to file]
+                    Find commands containing query across workspaces; with
+                    --output, commands whose output captured in --pty
+                    sessions contains it, with the line that matched;
+                    --template and --to as for history
+  import-history <name> <file> [--format bash|zsh|fish|ksh]
+                    Import an existing shell history file (format detected by default)
+  import <name> --format atuin|bashlog [path]
+                    Import command history from atuin's database, or every
+                    session bashlog recorded (~/.bashlog/logs by default),
+                    merging the sessions' histories in time order
+  export <name|pattern>...|--all --format atuin|bash|markdown|ipynb
+         [--output path] [--session id] [--redact profile]
+                    Export workspace history into atuin's database, a
+                    HISTTIMEFORMAT-compatible bash_history file, or a notebook
+                    pairing each command with its output from --pty sessions
+                    (stdout by default; one file per workspace when --output
+                    is given for several); --redact masks what the profile
+                    says before sharing: internal masks usernames,
+                    external-vendor hostnames, usernames and paths, and more
+                    are defined as redact.<name>.mask=hostnames,paths,... in
+                    ~/.bashlog/config.txt
+  publish <name> --output dir [--redact profile] [--force]
+                    Write a workspace out as a static site, an index of its
+                    sessions and history with a page per session showing
+                    the output and a search that runs in the browser, to
+                    share read-only from any web server or GitHub Pages
+  to-ansible <session|workspace> [--output file]
+                    Turn recorded package, service and file commands into an
+                    Ansible playbook skeleton, keeping the rest as shell tasks
+  to-dockerfile <session|workspace> [--from image] [--output file]
+                    Turn a recorded provisioning session into RUN, ENV and
+                    WORKDIR lines as a starting point for a Dockerfile
+  mount <path|url> [--name name]
+                    Add a workspace directory, archive or http(s) URL of an
+                    archive (an NFS share, a synced folder, an export) as a
+                    read-only workspace without copying it in
+  unmount <name>    Remove a mounted workspace, leaving its source alone
+  sync <name|pattern>...|--all [--dir path] [--merge]
+                    Push this machine's commands to its own log in a shared
+                    directory (remembered per workspace); --merge also adds
+                    what other machines pushed. Each machine only appends to
+                    its own log, so syncing the directory never conflicts
+  snapshot <name> [snapshot-name]
+                    Take a named point-in-time snapshot of a workspace
+  snapshots list <name>
+                    List a workspace's snapshots
+  snapshot diff <name> <a> [b|current]
+                    Show commands added between two snapshots
+  backup --all|<name>... --output <dir> [--encrypt]
+                    Copy workspaces into a backup directory, locking each one
+                    so in-flight writes can't corrupt the copy; --encrypt
+                    encrypts each with its own key, so none opens another's
+  restore <name>    Restore a deleted workspace from the trash
+  restore <dir> [name...] [--force]
+                    Restore all or the named workspaces from a backup
+  trash list|empty [--yes] [--dry-run]
+                    List deleted workspaces or remove them for good
+  digest [name|pattern...] [--period daily|weekly|monthly] [--output md|email]
+         [--notify target,...]
+                    Summarize sessions, failures and top commands per
+                    workspace, e.g. from cron for a team channel
+  report [--custom name [name|pattern...] [--since 7d] [--to file]]
+                    List the custom reports defined in ~/.bashlog/reports,
+                    or run one over workspaces' commands and sessions
+  notify [target [message]]
+                    List notification targets, or send a test message to one
+  rules [test '<command>' [--workspace name] [--exit N] [--duration d]]
+                    Validate and list alert rules, or show which ones a
+                    command would match
+  scrub <name|pattern>...|--all [--dry-run] [--yes]
+                    Mask the passwords, tokens and keys recorded in workspaces
+                    for good, in their history, output and comments and in
+                    their sessions' logs; with redact.on-read=true in
+                    ~/.bashlog/config.txt, view, history, search, show and
+                    export mask them on the way out instead, leaving the logs
+  fsck [--repair]   Check workspaces and sessions for missing config, bad
+                    timestamps, wrong command counts, unfinished or orphaned
+                    sessions, and repair them from the underlying logs
+  migrate status|up [--workspace pattern] [--dry-run]
+                    Show the workspaces whose layout or storage schema is
+                    older than this bashlog's, or bring them up to date
+  index status|rebuild [--workspace pattern]
+                    Check the stats and day rollups cached from workspaces'
+                    history for corruption, or rebuild them from it
+  audit-log [--action op] [--user name] [--workspace name] [--since 7d]
+            [--limit 50] [--verify]
+                    Show who ran which bashlog-mgr operations on what, and
+                    when, from ~/.bashlog/audit.log; --verify checks that no
+                    record before the last was altered or removed
+  serve [--listen addr] [--tls-cert file --tls-key file]
+                    Serve a REST API over the workspaces, for dashboards
+                    and recorders shipping their sessions, and at / a web UI
+                    for reviewing them with threaded comments; see "REST API"
+  protect [name|pattern...] [--off] [--set-passphrase] [--setup-totp]
+                    Mark workspaces sensitive, so deleting, purging or
+                    exporting them asks for a passphrase or TOTP code; with
+                    no workspaces, show what is set and protected
+  keys [name|pattern...] [--rotate] | <name> --export <file> | --import <file>
+                    List the workspaces' encryption keys, kept in
+                    ~/.bashlog/keys, generate or rotate them, or export or
+                    import one to restore a workspace's backup elsewhere
+  events <name> [--limit 50] [--undo]
+                    Show the log of changes to a workspace's settings, keys,
+                    access list and archiving, or undo the latest change to
+                    a setting
+  bench [--workspaces N] [--commands N] [--query text]
+                    Measure ingest, read and search throughput on generated
+                    workspaces in a scratch directory
   help              Show this help message
 
 Examples:
   bashlog-mgr list
+  bashlog-mgr list --activity
   bashlog-mgr create my-project
+  bashlog-mgr create incident-42 --root team --mode group --group oncall
+  bashlog-mgr permissions incident-42
+  bashlog-mgr acl prod-bastion grant appenders '*'
+  bashlog-mgr acl prod-bastion grant auditors role:security
   bashlog-mgr delete old-workspace
+  bashlog-mgr delete 'tmp-*' --dry-run
+  bashlog-mgr archive 'incident-2023-*'
   bashlog-mgr view my-project
+  bashlog-mgr view my-project --at '2024-06-01 14:00'
+  bashlog-mgr notes my-project --edit
+  bashlog-mgr comments incident-42
+  bashlog-mgr open my-project --list
+  bashlog-mgr sessions my-project
+  bashlog-mgr sessions my-project --egress
+  bashlog-mgr sessions my-project --terminal
+  bashlog-mgr sessions my-project --summary
+  bashlog-mgr sessions my-project --clock
+  bashlog-mgr changes my-project --files
   bashlog-mgr stats
+  bashlog-mgr stats --by-category
   bashlog-mgr history my-project 50
-
-Workspaces are stored in: ~/.bashlog-workspaces/
+  bashlog-mgr history my-project --unique
+  bashlog-mgr history my-project --date tuesday
+  bashlog-mgr history my-project --category git
+  bashlog-mgr history my-project --tag deploy
+  bashlog-mgr show my-project -1 --output
+  bashlog-mgr timeline my-project --since 6h
+  bashlog-mgr recall --around '2h ago' --span 1h
+  bashlog-mgr calendar my-project --month 2024-07
+  bashlog-mgr tail my-project --follow
+  bashlog-mgr watch 'prod-*' --notify team
+  bashlog-mgr transfers prod-bastion --direction upload --since 7d
+  bashlog-mgr tail prod-bastion --remote https://collector:8750 --token "$TOKEN"
+  bashlog-mgr copy my-project 42
+  bashlog-mgr run my-project -1 --confirm
+  bashlog-mgr search deploy --workspace 'prod-*' --category containers
+  bashlog-mgr search --output "connection refused" -i
+  bashlog-mgr search kubectl --limit 0 --template '{{.Timestamp}} {{.Cmd}}'
+  bashlog-mgr history my-project --date today --to today.md
+  bashlog-mgr history my-project 50 --host web-1
+  bashlog-mgr import-history my-project ~/.bash_history
+  bashlog-mgr import my-project --format atuin
+  bashlog-mgr import my-project --format bashlog
+  bashlog-mgr export my-project --format atuin --output /tmp/history.db
+  bashlog-mgr export my-project --format bash --output ~/my-project.bash_history
+  bashlog-mgr export --all --format bash --output ~/bash-histories/
+  bashlog-mgr export my-project --format ipynb --output debugging.ipynb
+  bashlog-mgr export my-project --format markdown --redact external-vendor --output vendor.md
+  bashlog-mgr publish my-project --output site/ --redact external-vendor
+  bashlog-mgr to-ansible 2024-05-01-140322 --output fix-nginx.yml
+  bashlog-mgr to-dockerfile 2024-05-01_14:03 --from debian:bookworm-slim
+  bashlog-mgr mount /mnt/team/bashlog/incident-42 --name incident-42
+  bashlog-mgr sync my-project --dir ~/Sync/bashlog --merge
+  bashlog-mgr snapshot my-project before-upgrade
+  bashlog-mgr snapshot diff my-project before-upgrade current
+  bashlog-mgr backup --all --output ~/bashlog-backup
+  bashlog-mgr restore ~/bashlog-backup my-project --force
+  bashlog-mgr backup incident-42 --output /mnt/usb/incident-42 --encrypt
+  bashlog-mgr keys incident-42 --export incident-42.key
+  bashlog-mgr events my-project --undo
+  bashlog-mgr restore old-workspace
+  bashlog-mgr trash empty --dry-run
+  bashlog-mgr digest --period weekly --output email --to team@example.com | sendmail -t
+  bashlog-mgr digest --period daily --notify team
+  bashlog-mgr report --custom oncall 'prod-*' --since 24h
+  bashlog-mgr scrub --all --dry-run
+  bashlog-mgr fsck --repair
+  bashlog-mgr migrate up --dry-run
+  bashlog-mgr index rebuild --workspace project-a
+  bashlog-mgr audit-log --action delete --since 30d
+  bashlog-mgr protect --set-passphrase
+  bashlog-mgr protect incident-42
+
+Notification targets are Slack or Discord webhooks set in ~/.bashlog/config.txt:
+  notify.team.type=slack
+  notify.team.url=https://hooks.slack.com/services/...
+
+Alert rules in the same file are evaluated against commands bashlog records,
+e.g. with bashlog --workspace <name>; matches are logged to ~/.bashlog/rule-hits.log:
+  rule.rmrf.command=rm\s+-rf
+  rule.rmrf.workspace=prod-*
+  rule.rmrf.notify=team
+  rule.failed.exit=!=0
+  rule.failed.exec=logger -t bashlog "$BASHLOG_COMMAND failed"
+  rule.slow.duration=>10m
+  rule.slow.tag=slow
+  rule.rmrf.terminal=bell
+Actions run as the session ends, except terminal, which rings the bell (bell),
+has the terminal raise a desktop notification (osc9) or raises one itself
+(desktop) in the session as the command returns.
+
+Tag rules tag matching commands as they are recorded into a workspace, for
+history --tag and search --tag:
+  tag.deploy=terraform apply|kubectl apply
+
+Custom reports are Go text/template files, ~/.bashlog/reports/<name>.tmpl, run
+on .Name, .Since, .Generated, .Commands (fields as for history --template),
+.Workspaces (.Name, .Created, .Commands, .Sessions) and .Sessions; a comment
+opening the file describes the report. Besides join and json, templates have
+top n commands, days commands, category command and duration d:
+  {{/* Commands per workspace */}}
+  {{range .Workspaces}}{{.Name}}: {{len .Commands}} on {{days .Commands}} day(s)
+  {{range top 3 .Commands}}  {{.Count}}x {{.Command}}
+  {{end}}{{end}}
+
+REST API (serve): requests need an "Authorization: Bearer <token>" header with a
+token set in ~/.bashlog/config.txt as api.token.<name>=<token>. List endpoints
+take limit (default 100, at most 1000) and the next_cursor of the previous
+page as cursor, and stream their results, as JSON or with format=ndjson as
+one record per line:
+  GET /api/v1/workspaces
+  GET /api/v1/workspaces/<name>/history
+  GET /api/v1/search?q=text[&workspace=pattern][&i=1]
+  GET /ws/workspaces/<name>/stream[?backlog=n]  (WebSocket, new commands live)
+  POST /api/v1/workspaces/<name>/commands       (sessions shipped by
+                    bashlog --remote URL --token T; batches are spooled in
+                    ~/.bashlog/spool/ while the server is unreachable)
+  GET /api/v1/workspaces/<name>/comments[?n=12][&session=id]
+  POST /api/v1/workspaces/<name>/comments       (body {"text": ..., and one
+                    of "n": command, "session": id or "parent": comment id};
+                    the comment is signed with the token's name)
+Each token is limited to api.rate requests a second (default 10, bursts of
+api.burst, default 20), api.max_concurrent at once (4) not counting open
+streams, pages of api.max_results records (1000) and about api.max_bytes
+bytes (8 MiB); add .<name> to a setting to change it for one token, e.g.
+api.rate.dash=2
+A workspace given an access list with acl is open only to the tokens it
+names, * for all: owners may do everything, readers read and comment,
+auditors read and see the list, and appenders only post commands, so
+recorders can ship a bastion's sessions that only the security team reads.
+Workspaces without one are open to every token
+
+Single sign-on (serve): with an OpenID Connect provider such as Okta, Google
+or Keycloak set up, the web UI has people sign in with it rather than paste
+a token, and scripts can send the ID tokens it issues them as bearer tokens.
+Claims are mapped to role names, which access lists grant roles to as
+role:<name>, and people by their username claim as user:<name>; only those
+mapped to a role get in. The provider is told of
+<serve's URL>/auth/callback, unless oidc.redirect_url says otherwise:
+  oidc.issuer=https://login.example.com/realms/ops
+  oidc.client_id=bashlog
+  oidc.client_secret=...
+  oidc.scopes=openid email profile groups
+  oidc.username_claim=email
+  oidc.role.security=groups:sec-team,groups:auditors
+  oidc.role.sre=realm_access.roles:sre
+Then 'bashlog-mgr acl prod grant auditors role:security' lets the sec-team
+group read prod. Sessions last oidc.session (default 8h) and end when serve
+stops
+
+Workspace roots: workspaces are stored in ~/.bashlog-workspaces/, and more
+roots, such as a team root on a network mount, can be added to
+~/.bashlog/config.txt. list, search and the other commands span every root
+(on a name clash the local root wins); create --root picks one:
+  root.team=/mnt/shared/bashlog-workspaces
+
+File permissions: bashlog and bashlog-mgr create what they write private to
+you, directories 0700 and files 0600, unless files.mode in
+~/.bashlog/config.txt says otherwise. A workspace created with --mode, or
+changed with permissions, keeps its own mode whoever writes to it; group
+makes directories 2770 and files 0660, so a team shares it:
+  files.mode=private
+
+Storage: a workspace's commands are kept in its history.log, in bash history
+format; from layout 2 on (migrate up) with the exit status and duration of
+each command on its timestamp line, as #<unix-seconds> {"v":2,"exit":0,"ms":12},
+which bash still reads, and older lines read as before. Commands sourced
+files and functions ran, which bash sessions record with bashlog --sources,
+carry the file:line they come from ("src") there too, and are told apart
+with history --origin sourced. Or with
+--storage sqlite in an SQLite database, history.db, through the sqlite3 tool,
+or with --storage postgres in a PostgreSQL database a team server's
+workspaces share, its schema migrated on first use, or by migrate up after
+an upgrade. The storage setting in
+~/.bashlog/config.txt picks the default for new workspaces; each keeps the
+one it was created with. Postgres workspaces belong to an owner,
+storage.postgres.owner or you, so teams can share a database; the password
+is best left to $PGPASSWORD:
+  storage=postgres
+  storage.postgres.url=postgres://bashlog@db.internal/bashlog?sslmode=require
+  storage.postgres.pool=4
+
+Sessions: each has an ID, a ULID such as 01J0Z3M8B4R6Q5T9W2XKEHN7CA, and an
+alias for people such as 2024-05-01-140322 (-2, -3 for sessions started in
+the same second). open, changes, export and to-ansible take either, or a
+unique prefix. Sessions recorded before IDs keep theirs, such as
+session_2024-05-01_14:03:22
 `)
 }
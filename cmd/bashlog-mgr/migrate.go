@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/interhack86/bashlog/internal/migrate"
+	"github.com/interhack86/bashlog/internal/storage"
+)
+
+const migrateUsage = "bashlog-mgr migrate status|up [--workspace pattern] [--dry-run]"
+
+// handleMigrate shows which workspaces are at an older layout or storage
+// schema than this bashlog, or with "up" brings them up to date
+func handleMigrate(basePath string, args []string) {
+	if len(args) == 0 || (args[0] != "status" && args[0] != "up") {
+		failUsage(migrateUsage, "status or up required")
+	}
+	up := args[0] == "up"
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	pattern := fs.String("workspace", "*", "Only migrate the workspaces matching this name or glob pattern")
+	dryRun := fs.Bool("dry-run", false, "With up, show what would be applied without applying it")
+	if positional := parseInterspersed(fs, args[1:]); len(positional) > 0 {
+		failUsage(migrateUsage, "unexpected argument '"+positional[0]+"'")
+	}
+	if *dryRun && !up {
+		failUsage(migrateUsage, "--dry-run is for up")
+	}
+
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		fail(exitFailure, "could not list workspaces: %v", err)
+	}
+	if len(workspaces) == 0 {
+		fmt.Println("No workspaces.")
+		return
+	}
+	selected := make(map[string]bool)
+	for _, name := range requireWorkspaces(basePath, []string{*pattern}) {
+		selected[name] = true
+	}
+
+	pending, failed := 0, 0
+	for _, ws := range workspaces {
+		if !selected[ws.Name] {
+			continue
+		}
+		steps, err := migrate.Pending(ws.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", ws.Name, err)
+			failed++
+			continue
+		}
+		current, _ := migrate.Version(ws.Path)
+		schema := schemaStatus(ws.Path)
+		behind := len(steps) > 0 || schema.behind
+
+		switch {
+		case !up || *dryRun:
+			fmt.Printf("%-20s layout %d of %d, %s\n", ws.Name, current, migrate.Latest(), schema.text)
+			for _, step := range steps {
+				fmt.Printf("  pending: layout %d: %s\n", step.Version, step.Summary)
+			}
+			if schema.behind {
+				fmt.Printf("  pending: %s schema migrations\n", storage.For(ws.Path).Name())
+			}
+			if behind {
+				pending++
+			}
+		case !behind:
+			fmt.Printf("✓ %s is up to date\n", ws.Name)
+		case ws.MountedFrom != "":
+			fmt.Printf("- %s is mounted read-only from %s, migrate it there\n", ws.Name, ws.MountedFrom)
+		default:
+			applied, err := migrate.Up(ws.Path)
+			for _, step := range applied {
+				fmt.Printf("  applied: layout %d: %s\n", step.Version, step.Summary)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: %v\n", ws.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ %s migrated\n", ws.Name)
+		}
+	}
+
+	if failed > 0 {
+		fail(exitFailure, "%d workspace(s) could not be migrated", failed)
+	}
+	if pending > 0 {
+		fmt.Printf("\n%d workspace(s) to migrate. Run 'bashlog-mgr migrate up' to migrate them.\n", pending)
+	}
+}
+
+// schemaState describes the storage schema of a workspace for migrate
+type schemaState struct {
+	text   string
+	behind bool
+}
+
+// schemaStatus reports the storage schema version of the workspace at
+// wsPath, for backends that have one
+func schemaStatus(wsPath string) schemaState {
+	backend := storage.For(wsPath)
+	m, ok := backend.(storage.Migrator)
+	if !ok {
+		return schemaState{text: backend.Name() + " storage"}
+	}
+	current, latest, err := m.SchemaVersion(wsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return schemaState{text: fmt.Sprintf("%s schema missing", backend.Name()), behind: true}
+	}
+	if err != nil {
+		return schemaState{text: fmt.Sprintf("%s schema unknown (%v)", backend.Name(), err)}
+	}
+	return schemaState{
+		text:   fmt.Sprintf("%s schema %d of %d", backend.Name(), current, latest),
+		behind: current < latest,
+	}
+}
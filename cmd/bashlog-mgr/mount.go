@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// mountCacheDir holds workspaces mounted from URLs or tarballs, extracted
+// once, relative to $HOME
+const mountCacheDir = ".bashlog/mounts"
+
+// mountDownloadTimeout bounds fetching a workspace to mount
+const mountDownloadTimeout = 5 * time.Minute
+
+// handleMount registers a foreign workspace (a shared or synced directory,
+// an archive or an export) as read-only, without copying it in
+func handleMount(basePath, cachePath string, args []string) {
+	fs := flag.NewFlagSet("mount", flag.ExitOnError)
+	name := fs.String("name", "", "Workspace name (default: the directory or archive name)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage("bashlog-mgr mount <path|url> [--name name]", "a workspace directory, archive or URL required")
+	}
+	source := positional[0]
+
+	if *name == "" {
+		*name = mountName(source)
+	}
+	if !isValidName(*name) {
+		fail(exitUsage, "invalid workspace name '%s': pick one with --name", *name)
+	}
+	if _, err := os.Lstat(workspacePath(basePath, *name)); err == nil {
+		fail(exitConflict, "workspace '%s' already exists (pick another with --name)", *name)
+	}
+
+	dir, err := mountSource(source, filepath.Join(cachePath, *name))
+	if err != nil {
+		fail(exitFailure, "could not mount %s: %v", source, err)
+	}
+	if err := workspace.AddMount(basePath, *name, dir, source); err != nil {
+		fail(exitFailure, "could not mount %s: %v", source, err)
+	}
+	fmt.Printf("✓ Mounted %s read-only as workspace '%s'\n", source, *name)
+}
+
+// handleUnmount removes a mounted workspace, leaving its source untouched
+func handleUnmount(basePath, cachePath string, args []string) {
+	if len(args) != 1 {
+		failUsage("bashlog-mgr unmount <name>", "workspace name required")
+	}
+	name := args[0]
+
+	if err := workspace.RemoveMount(basePath, name); err != nil {
+		fail(exitNotFound, "%v", err)
+	}
+	// Only copies extracted from archives or URLs are ours to remove
+	os.RemoveAll(filepath.Join(cachePath, name))
+	fmt.Printf("✓ Unmounted workspace '%s'\n", name)
+}
+
+// mountName derives a workspace name from a mount source
+func mountName(source string) string {
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Path != "" {
+		source = u.Path
+	}
+	base := filepath.Base(strings.TrimRight(source, "/"))
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+// mountSource returns the workspace directory to link for source. URLs
+// and archives are extracted into cache first
+func mountSource(source, cache string) (string, error) {
+	u, err := url.Parse(source)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		return extractWorkspace(cache, func() (io.ReadCloser, error) { return download(source) })
+	case err == nil && u.Scheme == "file":
+		source = u.Path
+	}
+
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return extractWorkspace(cache, func() (io.ReadCloser, error) { return os.Open(abs) })
+	}
+	return abs, checkWorkspaceDir(abs)
+}
+
+func download(source string) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: mountDownloadTimeout}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// extractWorkspace unpacks a tarball, gzipped or not, such as the ones
+// archive writes, into cache and returns the workspace directory in it
+func extractWorkspace(cache string, open func() (io.ReadCloser, error)) (string, error) {
+	if err := fsperm.Default.MkdirAll(filepath.Dir(cache)); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(cache), "."+filepath.Base(cache)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	in, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if err := untar(in, tmp); err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(cache); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, cache); err != nil {
+		return "", err
+	}
+
+	// Archives are rooted at the workspace's own directory
+	dir := cache
+	if entries, err := os.ReadDir(cache); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		dir = filepath.Join(cache, entries[0].Name())
+	}
+	if err := checkWorkspaceDir(dir); err != nil {
+		os.RemoveAll(cache)
+		return "", err
+	}
+	return dir, nil
+}
+
+// untar extracts the directories and regular files of a tarball into
+// dest, refusing entries that would land outside it
+func untar(r io.Reader, dest string) error {
+	buffered := bufio.NewReader(r)
+	var in io.Reader = buffered
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not a workspace archive: %w", err)
+		}
+
+		target := filepath.Join(dest, hdr.Name)
+		if !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry '%s' escapes the workspace", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := fsperm.Default.MkdirAll(target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := fsperm.Default.MkdirAll(filepath.Dir(target)); err != nil {
+				return err
+			}
+			f, err := fsperm.Default.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkWorkspaceDir makes sure dir looks like a workspace
+func checkWorkspaceDir(dir string) error {
+	for _, name := range []string{workspace.HistoryFile, workspace.ConfigFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a workspace (no %s or %s)", dir, workspace.HistoryFile, workspace.ConfigFile)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// handleNotes shows a workspace's notes, or opens them in the user's
+// editor with --edit, creating the file first if needed
+func handleNotes(basePath string, args []string) {
+	fs := flag.NewFlagSet("notes", flag.ExitOnError)
+	edit := fs.Bool("edit", false, "Open the notes in $VISUAL or $EDITOR")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage("bashlog-mgr notes <name> [--edit]", "workspace name required")
+	}
+
+	name := positional[0]
+	wsPath := workspacePath(basePath, name)
+	if _, err := os.Stat(wsPath); err != nil {
+		fail(exitNotFound, "workspace '%s' not found", name)
+	}
+	notesPath := filepath.Join(wsPath, workspace.NotesFile)
+
+	if !*edit {
+		notes, err := readNotes(wsPath)
+		if err != nil {
+			fail(exitFailure, "could not read notes: %v", err)
+		}
+		if notes == "" {
+			fmt.Printf("No notes for workspace '%s' (add some with: bashlog-mgr notes %s --edit)\n", name, name)
+			return
+		}
+		fmt.Println(notes)
+		return
+	}
+
+	if workspace.IsMounted(wsPath) {
+		fail(exitConflict, "workspace '%s' is mounted read-only", name)
+	}
+	if _, err := os.Stat(notesPath); os.IsNotExist(err) {
+		if err := workspace.FileMode(wsPath).WriteFile(notesPath, []byte("# "+name+"\n\n")); err != nil {
+			fail(exitFailure, "could not create notes: %v", err)
+		}
+	}
+	if err := runEditor(notesPath); err != nil {
+		fail(exitFailure, "editor failed: %v", err)
+	}
+}
+
+// readNotes returns a workspace's notes, trimmed, or "" when it has none
+func readNotes(wsPath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(wsPath, workspace.NotesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// editorCommand is the user's preferred editor, as a shell command
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := os.Getenv(env); e != "" {
+			return e
+		}
+	}
+	return "vi"
+}
+
+// runEditor opens path in the user's editor on the current terminal. The
+// editor variable may carry arguments, e.g. "code --wait"
+func runEditor(path string) error {
+	return runInteractive(editorCommand(), path)
+}
+
+// runInteractive runs a user-configured command line through the shell,
+// passing path as its last argument, attached to the terminal
+func runInteractive(command, path string) error {
+	cmd := exec.Command("/bin/sh", "-c", command+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
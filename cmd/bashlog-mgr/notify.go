@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/notify"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// sendTimeout bounds how long a command waits on all notification targets
+const sendTimeout = 30 * time.Second
+
+// loadSinks returns the notification targets defined in the settings file
+func loadSinks(settingsPath string) (map[string]notify.Sink, error) {
+	return notify.Targets(workspace.ReadConfig(settingsPath))
+}
+
+// sendNotification posts m to each named target, reporting every failure
+func sendNotification(settingsPath string, targets []string, m notify.Message) error {
+	sinks, err := loadSinks(settingsPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	var failed []string
+	for _, name := range targets {
+		sink, ok := sinks[name]
+		if !ok {
+			return fmt.Errorf("notification target '%s' %w", name, errNotFound)
+		}
+		if err := sink.Send(ctx, m); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// handleNotify lists the configured targets, or sends a test message to one
+func handleNotify(settingsPath string, args []string) {
+	if len(args) == 0 {
+		sinks, err := loadSinks(settingsPath)
+		if err != nil {
+			fail(exitFailure, "could not read notification targets: %v", err)
+		}
+		if len(sinks) == 0 {
+			fmt.Printf("No notification targets. Add notify.<name>.type and notify.<name>.url to %s\n", settingsPath)
+			return
+		}
+		names := make([]string, 0, len(sinks))
+		for name := range sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-20s %s\n", name, sinks[name])
+		}
+		return
+	}
+
+	text := "Test notification from bashlog-mgr"
+	if len(args) > 1 {
+		text = strings.Join(args[1:], " ")
+	}
+	host, _ := os.Hostname()
+
+	err := sendNotification(settingsPath, []string{args[0]}, notify.Message{
+		Title: "bashlog",
+		Text:  text,
+		Host:  host,
+	})
+	if err != nil {
+		fail(exitCodeFor(err), "could not send notification: %v", err)
+	}
+	fmt.Printf("✓ Notification sent to '%s'\n", args[0])
+}
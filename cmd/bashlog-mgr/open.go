@@ -0,0 +1,257 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const openUsage = "bashlog-mgr open <name> [session] [--editor] [--list]"
+
+// handleOpen opens a session transcript recorded into a workspace, the
+// most recent by default, in the user's pager or editor. Sessions without
+// a transcript fall back to the workspace history
+func handleOpen(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	useEditor := fs.Bool("editor", false, "Open in $VISUAL or $EDITOR instead of $PAGER")
+	list := fs.Bool("list", false, "List the workspace's sessions instead of opening one")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		failUsage(openUsage, "workspace name required")
+	}
+
+	name := positional[0]
+	wsPath := workspacePath(basePath, name)
+	if _, err := os.Stat(wsPath); err != nil {
+		fail(exitNotFound, "workspace '%s' not found", name)
+	}
+
+	sessions, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		fail(exitFailure, "could not read sessions: %v", err)
+	}
+
+	if *list {
+		printSessions(name, sessions)
+		return
+	}
+
+	target := filepath.Join(wsPath, workspace.HistoryFile)
+	if len(positional) == 2 || len(sessions) > 0 {
+		m, err := pickSession(sessions, positional[1:])
+		if err != nil {
+			fail(exitCodeFor(err), "%v", err)
+		}
+		if transcript, ok := m.Transcript(); ok {
+			target = transcript
+		} else {
+			fmt.Fprintf(os.Stderr, "Session %s has no transcript (recorded without --pty), opening the workspace history\n", m.Name())
+		}
+	}
+
+	var path string
+	var cleanup func()
+	if b := storage.For(wsPath); target == filepath.Join(wsPath, workspace.HistoryFile) && b.Name() != storage.Files {
+		path, cleanup, err = historyCopy(wsPath)
+	} else {
+		path, cleanup, err = readablePath(target)
+	}
+	if err == nil && redactOnRead {
+		path, cleanup, err = redactedCopy(path, cleanup)
+	}
+	if err != nil {
+		fail(exitFailure, "could not prepare %s: %v", target, err)
+	}
+	defer cleanup()
+
+	command := pagerCommand()
+	if *useEditor {
+		command = editorCommand()
+	}
+	if err := runInteractive(command, path); err != nil {
+		cleanup()
+		fail(exitFailure, "could not open %s: %v", target, err)
+	}
+}
+
+// workspaceSessions returns the sessions recorded into a workspace, oldest
+// first
+func workspaceSessions(logsPath, name string) ([]*session.Meta, error) {
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*session.Meta
+	for _, m := range metas {
+		if m.Workspace == name {
+			sessions = append(sessions, m)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Started.Before(sessions[j].Started) })
+	return sessions, nil
+}
+
+// pickSession finds the session named by an ID or alias, or a unique
+// prefix of one, as Meta.Matches takes them, or the most recent session
+// when none is named
+func pickSession(sessions []*session.Meta, names []string) (*session.Meta, error) {
+	if len(names) == 0 {
+		if len(sessions) == 0 {
+			return nil, fmt.Errorf("no sessions %w", errNotFound)
+		}
+		return sessions[len(sessions)-1], nil
+	}
+
+	want := names[0]
+	var found []*session.Meta
+	for _, m := range sessions {
+		match, exact := m.Matches(want)
+		if exact {
+			return m, nil
+		}
+		if match {
+			found = append(found, m)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("session '%s' %w", want, errNotFound)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%w: '%s' matches %d sessions, use --list to see them", errInvalidArgs, want, len(found))
+}
+
+// printSessions lists a workspace's sessions
+func printSessions(name string, sessions []*session.Meta) {
+	if len(sessions) == 0 {
+		fmt.Printf("No sessions recorded into workspace '%s'\n", name)
+		return
+	}
+
+	fmt.Printf("%-20s %-26s %-8s %-10s %s\n", "SESSION", "ID", "SHELL", "DURATION", "TRANSCRIPT")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, m := range sessions {
+		duration := "running"
+		if m.Finished() {
+			duration = formatDuration(m.Duration)
+		}
+		transcript := "-"
+		if p, ok := m.Transcript(); ok {
+			transcript = p
+		}
+		fmt.Printf("%-20s %-26s %-8s %-10s %s\n", m.Name(), m.SessionID, m.Shell, duration, transcript)
+	}
+}
+
+// pagerCommand is the user's preferred pager, as a shell command. less
+// gets -R so recorded colors render instead of showing as escapes
+func pagerCommand() string {
+	if p := os.Getenv("PAGER"); p != "" {
+		return p
+	}
+	return "less -R"
+}
+
+// readablePath returns a plain-text path for file, decompressing a .gz
+// file into a private temporary file that cleanup removes
+func readablePath(file string) (path string, cleanup func(), err error) {
+	noop := func() {}
+	if !strings.HasSuffix(file, ".gz") {
+		return file, noop, nil
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return "", noop, err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return "", noop, err
+	}
+
+	tmp, err := os.CreateTemp("", "bashlog-*-"+strings.TrimSuffix(filepath.Base(file), ".gz"))
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup = func() { os.Remove(tmp.Name()) }
+	if _, err := io.Copy(tmp, zr); err != nil {
+		tmp.Close()
+		cleanup()
+		return "", noop, err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// redactedCopy writes file, masked as redactRead does, to a private
+// temporary file, for reading with redact.on-read set. Edits to it are not
+// kept. cleanup is what file needs removed, and is chained into the one
+// returned
+func redactedCopy(file string, cleanup func()) (path string, cleanupCopy func(), err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	tmp, err := os.CreateTemp("", "bashlog-*-"+filepath.Base(file))
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	cleanupCopy = func() {
+		os.Remove(tmp.Name())
+		cleanup()
+	}
+	if _, err := tmp.WriteString(redactRead(string(data))); err != nil {
+		tmp.Close()
+		cleanupCopy()
+		return "", func() {}, err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanupCopy()
+		return "", func() {}, err
+	}
+	return tmp.Name(), cleanupCopy, nil
+}
+
+// historyCopy writes the history of a workspace kept in other storage than
+// a history file out to a temporary one, for reading. Edits to it are not
+// kept
+func historyCopy(wsPath string) (path string, cleanup func(), err error) {
+	noop := func() {}
+	entries, err := storage.Read(wsPath)
+	if err != nil {
+		return "", noop, err
+	}
+	tmp, err := os.CreateTemp("", "bashlog-*-"+filepath.Base(wsPath)+".log")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup = func() { os.Remove(tmp.Name()) }
+	if err := workspace.WriteHistory(tmp, entries); err != nil {
+		tmp.Close()
+		cleanup()
+		return "", noop, err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return tmp.Name(), cleanup, nil
+}
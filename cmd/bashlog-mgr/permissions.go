@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const (
+	createUsage      = "bashlog-mgr create <name> [--root name] [--mode private|group|0640] [--group name] [--storage files|sqlite|postgres]"
+	permissionsUsage = "bashlog-mgr permissions <name> [private|group|0640] [--group name]"
+)
+
+// shareWithGroup gives wsPath and everything in it to group, and then the
+// permissions of mode, which changing the group can clear
+func shareWithGroup(wsPath, group string, mode fsperm.Mode) error {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return fmt.Errorf("group %s has a non-numeric gid %s", group, g.Gid)
+	}
+	err = filepath.Walk(wsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, -1, gid)
+	})
+	if err != nil {
+		return err
+	}
+	return mode.Apply(wsPath)
+}
+
+// handlePermissions shows the mode a workspace's files are created with,
+// or changes it, applying it to the files it already has. A workspace
+// shared with a group this way is a team workspace, which its members can
+// all record into and read
+func handlePermissions(basePath string, args []string) {
+	fs := flag.NewFlagSet("permissions", flag.ExitOnError)
+	group := fs.String("group", "", "With group, the group to share the workspace with (default: its current group)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		failUsage(permissionsUsage, "workspace name required")
+	}
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	if len(positional) == 1 {
+		if *group != "" {
+			failUsage(permissionsUsage, "--group needs a mode")
+		}
+		mode := workspace.FileMode(wsPath)
+		fmt.Printf("Workspace '%s': %s (%s)", name, mode, mode.Describe())
+		if g := groupOf(wsPath); g != "" {
+			fmt.Printf(", group %s", g)
+		}
+		fmt.Println()
+		return
+	}
+
+	mode, err := fsperm.Parse(positional[1])
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+	if *group != "" && mode != fsperm.Group {
+		failUsage(permissionsUsage, "--group is for the group mode")
+	}
+	if workspace.IsMounted(wsPath) {
+		fail(exitConflict, "workspace '%s' is mounted read-only", name)
+	}
+
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not lock workspace '%s': %v", name, err)
+	}
+	defer lock.Unlock()
+	if err := workspace.ChangeConfig(wsPath, "permissions", fsperm.Setting, mode.String()); err != nil {
+		fail(exitFailure, "could not update workspace '%s': %v", name, err)
+	}
+	if *group != "" {
+		err = shareWithGroup(wsPath, *group, mode)
+	} else {
+		err = mode.Apply(wsPath)
+	}
+	if err != nil {
+		fail(exitFailure, "could not change the permissions of workspace '%s': %v", name, err)
+	}
+
+	fmt.Printf("✓ Workspace '%s' is now %s\n", name, mode)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/protect"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Settings holding the credentials that guard sensitive workspaces
+const (
+	passphraseKey = "protect.passphrase"
+	totpKey       = "protect.totp"
+)
+
+// sensitiveKey marks a workspace, in its config, as needing the passphrase
+// or a TOTP code before it is deleted, purged or exported
+const sensitiveKey = "sensitive"
+
+// isSensitive reports whether the workspace at wsPath is marked sensitive
+func isSensitive(wsPath string) bool {
+	return workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))[sensitiveKey] == "true"
+}
+
+// handleProtect marks workspaces sensitive, or with --off unmarks them,
+// and sets the passphrase or TOTP secret that unlocks them
+func handleProtect(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("protect", flag.ExitOnError)
+	off := fs.Bool("off", false, "Unmark the workspaces, after asking for the passphrase or a code")
+	setPassphrase := fs.Bool("set-passphrase", false, "Set the passphrase that unlocks sensitive workspaces")
+	setupTOTP := fs.Bool("setup-totp", false, "Generate a TOTP secret for an authenticator app")
+	positional := parseInterspersed(fs, args)
+
+	switch {
+	case *setPassphrase:
+		changePassphrase(settingsPath)
+		return
+	case *setupTOTP:
+		changeTOTP(settingsPath)
+		return
+	case len(positional) == 0:
+		showProtection(basePath, settingsPath)
+		return
+	}
+
+	names := requireWorkspaces(basePath, positional)
+	if *off {
+		requireUnlock(settingsPath, "unprotect", names)
+	} else if !hasCredentials(settingsPath) {
+		fail(exitFailure, "no passphrase or TOTP secret set (set one with: bashlog-mgr protect --set-passphrase)")
+	}
+
+	for _, name := range names {
+		value := "true"
+		if *off {
+			value = "false"
+		}
+		if err := workspace.ChangeConfig(workspacePath(basePath, name), "protect", sensitiveKey, value); err != nil {
+			fail(exitCodeFor(err), "could not update workspace '%s': %v", name, err)
+		}
+		if *off {
+			fmt.Printf("✓ Workspace '%s' is no longer sensitive\n", name)
+		} else {
+			fmt.Printf("✓ Workspace '%s' marked sensitive\n", name)
+		}
+	}
+}
+
+// showProtection prints which credentials are set and which workspaces
+// they guard
+func showProtection(basePath, settingsPath string) {
+	settings := workspace.ReadConfig(settingsPath)
+	set := func(key string) string {
+		if settings[key] != "" {
+			return "set"
+		}
+		return "not set"
+	}
+	fmt.Printf("Passphrase: %s\n", set(passphraseKey))
+	fmt.Printf("TOTP:       %s\n", set(totpKey))
+
+	workspaces, err := getWorkspaces(basePath)
+	if err != nil {
+		fail(exitFailure, "could not list workspaces: %v", err)
+	}
+	var sensitive []string
+	for _, ws := range workspaces {
+		if isSensitive(ws.Path) {
+			sensitive = append(sensitive, ws.Name)
+		}
+	}
+	if len(sensitive) == 0 {
+		fmt.Println("Sensitive:  none")
+		return
+	}
+	fmt.Printf("Sensitive:  %s\n", strings.Join(sensitive, ", "))
+}
+
+// changePassphrase sets the passphrase, asking for the current passphrase
+// or a code first if credentials are already set
+func changePassphrase(settingsPath string) {
+	if hasCredentials(settingsPath) {
+		requireUnlock(settingsPath, "change the passphrase for", nil)
+	}
+	passphrase, err := readSecret("New passphrase: ")
+	if err != nil {
+		fail(exitFailure, "could not read passphrase: %v", err)
+	}
+	if passphrase == "" {
+		fail(exitUsage, "passphrase can't be empty")
+	}
+	again, err := readSecret("Repeat passphrase: ")
+	if err != nil {
+		fail(exitFailure, "could not read passphrase: %v", err)
+	}
+	if again != passphrase {
+		fail(exitFailure, "passphrases don't match")
+	}
+
+	hash, err := protect.HashPassphrase(passphrase)
+	if err != nil {
+		fail(exitFailure, "could not hash passphrase: %v", err)
+	}
+	if err := writeSetting(settingsPath, passphraseKey, hash); err != nil {
+		fail(exitFailure, "could not save passphrase: %v", err)
+	}
+	fmt.Println("✓ Passphrase set")
+}
+
+// changeTOTP generates a new TOTP secret and prints it for an
+// authenticator app, asking for the current credentials first if set
+func changeTOTP(settingsPath string) {
+	if hasCredentials(settingsPath) {
+		requireUnlock(settingsPath, "replace the TOTP secret for", nil)
+	}
+	secret, err := protect.NewTOTPSecret()
+	if err != nil {
+		fail(exitFailure, "could not generate TOTP secret: %v", err)
+	}
+	if err := writeSetting(settingsPath, totpKey, secret); err != nil {
+		fail(exitFailure, "could not save TOTP secret: %v", err)
+	}
+
+	account := "bashlog"
+	if u, err := user.Current(); err == nil {
+		account = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		account += "@" + host
+	}
+	fmt.Println("✓ TOTP secret set. Add it to an authenticator app:")
+	fmt.Printf("  Secret: %s\n", secret)
+	fmt.Printf("  URI:    %s\n", protect.TOTPURI(secret, account))
+}
+
+// writeSetting sets key in the settings file, which holds credentials and
+// so is kept readable by its owner only
+func writeSetting(settingsPath, key, value string) error {
+	if err := fsperm.Default.MkdirAll(filepath.Dir(settingsPath)); err != nil {
+		return err
+	}
+	if err := workspace.SetConfigValue(settingsPath, key, value); err != nil {
+		return err
+	}
+	return os.Chmod(settingsPath, fsperm.Private.File)
+}
+
+// hasCredentials reports whether a passphrase or TOTP secret is set
+func hasCredentials(settingsPath string) bool {
+	settings := workspace.ReadConfig(settingsPath)
+	return settings[passphraseKey] != "" || settings[totpKey] != ""
+}
+
+// requireSensitiveUnlock asks for the passphrase or a code before action
+// is carried out on the workspaces at paths, if any of them is sensitive,
+// and exits if it isn't given
+func requireSensitiveUnlock(settingsPath, action string, names, paths []string) {
+	var sensitive []string
+	for i, p := range paths {
+		if isSensitive(p) {
+			sensitive = append(sensitive, names[i])
+		}
+	}
+	if len(sensitive) > 0 {
+		requireUnlock(settingsPath, action, sensitive)
+	}
+}
+
+// requireUnlock asks on the terminal for the passphrase or a TOTP code and
+// exits unless one of them checks out
+func requireUnlock(settingsPath, action string, names []string) {
+	settings := workspace.ReadConfig(settingsPath)
+	hash, secret := settings[passphraseKey], settings[totpKey]
+	if hash == "" && secret == "" {
+		fail(exitFailure, "workspace '%s' is sensitive but no passphrase or TOTP secret is set (set one with: bashlog-mgr protect --set-passphrase)", strings.Join(names, "', '"))
+	}
+
+	var prompt string
+	switch {
+	case len(names) == 0:
+		prompt = fmt.Sprintf("To %s sensitive workspaces, enter ", action)
+	case len(names) == 1:
+		prompt = fmt.Sprintf("Workspace '%s' is sensitive. To %s it, enter ", names[0], action)
+	default:
+		prompt = fmt.Sprintf("Workspaces '%s' are sensitive. To %s them, enter ", strings.Join(names, "', '"), action)
+	}
+	switch {
+	case hash != "" && secret != "":
+		prompt += "the passphrase or a TOTP code: "
+	case hash != "":
+		prompt += "the passphrase: "
+	default:
+		prompt += "a TOTP code: "
+	}
+
+	answer, err := readSecret(prompt)
+	if err != nil {
+		fail(exitFailure, "could not read passphrase: %v", err)
+	}
+	if (hash != "" && protect.CheckPassphrase(hash, answer)) ||
+		(secret != "" && protect.CheckTOTP(secret, strings.ReplaceAll(answer, " ", ""), time.Now())) {
+		return
+	}
+	fail(exitFailure, "wrong passphrase or code")
+}
+
+// readSecret prompts on the terminal and reads a line without echoing it.
+// It reads the terminal rather than stdin so piped input can't answer it
+func readSecret(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.New("a terminal is required to enter it")
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	if restore := noEcho(tty); restore != nil {
+		defer restore()
+	}
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	fmt.Fprintln(tty)
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// noEcho turns off echo on tty and returns a function that restores the
+// previous settings, or nil if stty isn't available
+func noEcho(tty *os.File) func() {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = tty
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return nil
+	}
+	stty("-echo")
+	return func() { stty(saved) }
+}
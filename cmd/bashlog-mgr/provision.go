@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/provision"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// recordedCommands resolves a session ID (or unique prefix) to the
+// commands recorded during that session, falling back to the whole
+// history of a workspace by that name. It returns a title naming what was
+// found
+func recordedCommands(basePath, logsPath, ref string) (string, []workspace.Entry, error) {
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		return "", nil, err
+	}
+	m, err := pickSession(metas, []string{ref})
+	if err == nil {
+		entries, err := m.Commands()
+		return "session " + m.Name(), entries, err
+	}
+	if !errors.Is(err, errNotFound) {
+		return "", nil, err
+	}
+
+	wsPath := workspacePath(basePath, ref)
+	if _, statErr := os.Stat(filepath.Join(wsPath, workspace.ConfigFile)); statErr != nil {
+		return "", nil, fmt.Errorf("session or workspace '%s' %w", ref, errNotFound)
+	}
+	entries, err := storage.Read(wsPath)
+	return "workspace " + ref, entries, err
+}
+
+// handleToAnsible converts a recorded session into an Ansible playbook
+// skeleton
+func handleToAnsible(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("to-ansible", flag.ExitOnError)
+	handleConversion(fs, provision.Ansible, basePath, logsPath, args)
+}
+
+// handleToDockerfile converts a recorded provisioning session into a
+// Dockerfile
+func handleToDockerfile(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("to-dockerfile", flag.ExitOnError)
+	from := fs.String("from", "", "Base image (default: guessed from the package manager used)")
+	convert := func(w io.Writer, title string, steps []provision.Step) error {
+		return provision.Dockerfile(w, title, *from, steps)
+	}
+	handleConversion(fs, convert, basePath, logsPath, args)
+}
+
+// handleConversion runs a provisioning converter over the commands of a
+// session or workspace, writing to stdout or --output. fs carries the
+// converter's own flags
+func handleConversion(fs *flag.FlagSet, convert func(io.Writer, string, []provision.Step) error, basePath, logsPath string, args []string) {
+	output := fs.String("output", "", "Write to this file instead of stdout")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage("bashlog-mgr "+fs.Name()+" <session|workspace> [--output file]", "session or workspace required")
+	}
+	title, entries, err := recordedCommands(basePath, logsPath, positional[0])
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+	if len(entries) == 0 {
+		fail(exitNotFound, "no commands recorded in %s", title)
+	}
+
+	commands := make([]string, len(entries))
+	for i, e := range entries {
+		commands[i] = redactRead(e.Command)
+	}
+	steps := provision.Steps(commands)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fail(exitFailure, "could not create %s: %v", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := convert(w, title, steps); err != nil {
+		fail(exitFailure, "could not write output: %v", err)
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "✓ Converted %d commands from %s to %s\n", len(entries), title, *output)
+	}
+}
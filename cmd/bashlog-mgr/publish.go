@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/redact"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/transcript"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const publishUsage = "bashlog-mgr publish <name> --output dir [--redact profile] [--force]"
+
+// publishSession is a session as its page and the index show it
+type publishSession struct {
+	Page    string
+	Name    string
+	Shell   string
+	User    string
+	Host    string
+	Started time.Time
+	Cells   []transcript.Cell
+	Note    string
+}
+
+// publishEntry is a command in the search index, with the page and anchor
+// it is shown at. Keys are short, as the index holds every command
+type publishEntry struct {
+	Command string `json:"c"`
+	Time    string `json:"t,omitempty"`
+	Page    string `json:"p"`
+	Anchor  string `json:"a"`
+}
+
+// handlePublish writes a workspace out as a static site that any web
+// server, or GitHub Pages, can serve for read-only sharing: an index of its
+// sessions and history, a page per session with each command's output, and
+// a search over every command that runs in the browser
+func handlePublish(basePath, logsPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	output := fs.String("output", "", "Directory to write the site to")
+	redaction := fs.String("redact", "", "Mask hostnames, usernames or paths as this redaction profile says, e.g. external-vendor")
+	force := fs.Bool("force", false, "Write into an output directory that isn't empty, replacing the site's files")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage(publishUsage, "one workspace name required")
+	}
+	if *output == "" {
+		failUsage(publishUsage, "--output required")
+	}
+	var profile *redact.Profile
+	if *redaction != "" {
+		profiles, err := redact.Profiles(workspace.ReadConfig(settingsPath))
+		if err != nil {
+			fail(exitFailure, "could not read redaction profiles: %v", err)
+		}
+		if profile = profiles[*redaction]; profile == nil {
+			fail(exitUsage, "unknown redaction profile '%s' (expected one of %s)", *redaction, strings.Join(redact.Names(profiles), ", "))
+		}
+	}
+
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+	requireSensitiveUnlock(settingsPath, "publish", []string{name}, []string{wsPath})
+
+	if existing, err := os.ReadDir(*output); err == nil && len(existing) > 0 && !*force {
+		fail(exitConflict, "%s is not empty (use --force to write into it)", *output)
+	}
+
+	var r *redact.Redactor
+	if profile != nil {
+		r = workspaceRedactor(wsPath, logsPath, profile)
+	}
+	pages, err := publishWorkspace(wsPath, logsPath, *output, r)
+	if err != nil {
+		fail(exitCodeFor(err), "could not publish workspace '%s': %v", name, err)
+	}
+
+	masked := ""
+	if profile != nil {
+		masked = fmt.Sprintf(", masking %s (%s)", strings.Join(profile.Fields(), ", "), profile.Name)
+	}
+	fmt.Printf("✓ Published workspace '%s' to %s (%d pages%s)\n", name, *output, pages, masked)
+	fmt.Printf("  Open %s, or copy the directory to a web server\n", filepath.Join(*output, "index.html"))
+}
+
+// publishWorkspace writes the site of the workspace at wsPath into dir,
+// masked by r unless it is nil, and returns how many pages it has
+func publishWorkspace(wsPath, logsPath, dir string, r *redact.Redactor) (int, error) {
+	name := filepath.Base(wsPath)
+	history, err := storage.Read(wsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	redactEntries(history)
+	metas, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		return 0, err
+	}
+	mask := func(s string) string {
+		if r == nil {
+			return s
+		}
+		return r.Text(s)
+	}
+
+	var sessions []publishSession
+	for _, m := range metas {
+		entries, err := m.Commands()
+		if err != nil {
+			return 0, err
+		}
+		section, err := sessionSection(m, entries)
+		if err != nil {
+			return 0, err
+		}
+		for i := range section.Cells {
+			cell := &section.Cells[i]
+			cell.Command, cell.Output = redactRead(cell.Command), redactRead(cell.Output)
+			if r != nil {
+				cell.Command, cell.Output = r.Command(cell.Command), r.Text(cell.Output)
+			}
+		}
+		sessions = append(sessions, publishSession{
+			Page:    "sessions/" + publishFileName(m.Name()) + ".html",
+			Name:    m.Name(),
+			Shell:   m.Shell,
+			User:    mask(m.User),
+			Host:    mask(m.Host.Name),
+			Started: m.Started,
+			Cells:   section.Cells,
+			Note:    strings.Trim(section.Note, "_"),
+		})
+	}
+	if r != nil {
+		for i := range history {
+			history[i].Command = r.Command(history[i].Command)
+		}
+	}
+
+	if err := fsperm.Default.MkdirAll(filepath.Join(dir, "sessions")); err != nil {
+		return 0, err
+	}
+
+	var index []publishEntry
+	for i, e := range history {
+		index = append(index, publishEntry{Command: e.Command, Time: publishTime(e.Time), Page: "index.html", Anchor: fmt.Sprintf("c%d", i+1)})
+	}
+	for _, s := range sessions {
+		for i, c := range s.Cells {
+			index = append(index, publishEntry{Command: c.Command, Time: publishTime(c.Time), Page: s.Page, Anchor: fmt.Sprintf("c%d", i+1)})
+		}
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return 0, err
+	}
+
+	config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
+	created, _ := time.Parse(time.RFC3339, config["created"])
+	site := map[string]any{
+		"Name":      name,
+		"Created":   created,
+		"Published": time.Now(),
+		"Sessions":  sessions,
+		"History":   history,
+	}
+
+	files := map[string][]byte{
+		"style.css":       []byte(publishStyle),
+		"search.js":       []byte(publishSearchScript),
+		"search-index.js": append(append([]byte("window.BASHLOG_INDEX = "), data...), ";\n"...),
+	}
+	var page strings.Builder
+	if err := publishIndexPage.Execute(&page, site); err != nil {
+		return 0, err
+	}
+	files["index.html"] = []byte(page.String())
+	for _, s := range sessions {
+		page.Reset()
+		if err := publishSessionPage.Execute(&page, map[string]any{"Workspace": name, "Session": s}); err != nil {
+			return 0, err
+		}
+		files[s.Page] = []byte(page.String())
+	}
+
+	for file, content := range files {
+		if err := fsperm.Default.WriteFile(filepath.Join(dir, filepath.FromSlash(file)), content); err != nil {
+			return 0, err
+		}
+	}
+	return 1 + len(sessions), nil
+}
+
+// publishFileName makes a session name safe as a file name on any web
+// server, as old names such as session_2024-05-01_14:03:22 have colons
+func publishFileName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == '_' || c == '.' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+			return c
+		}
+		return '-'
+	}, name)
+}
+
+func publishTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateTime)
+}
+
+var publishFuncs = template.FuncMap{
+	"time": publishTime,
+	"inc":  func(i int) int { return i + 1 },
+}
+
+var publishIndexPage = template.Must(template.New("index").Funcs(publishFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} · bashlog</title>
+<link rel="stylesheet" href="style.css">
+</head>
+<body>
+<header><b>bashlog</b> {{.Name}}</header>
+<main>
+<p class="meta">{{if not .Created.IsZero}}Created {{time .Created}} · {{end}}{{len .History}} commands · {{len .Sessions}} sessions · published {{time .Published}}</p>
+<input id="search" type="search" placeholder="Search commands" autofocus>
+<div id="results"></div>
+{{if .Sessions}}<h2>Sessions</h2>
+<table>
+<tr><th>Session</th><th>Started</th><th>Shell</th><th>User</th><th>Host</th><th>Commands</th></tr>
+{{range .Sessions}}<tr><td><a href="{{.Page}}">{{.Name}}</a></td><td>{{time .Started}}</td><td>{{.Shell}}</td><td>{{.User}}</td><td>{{.Host}}</td><td>{{len .Cells}}</td></tr>
+{{end}}</table>
+{{end}}<h2>History</h2>
+{{range $i, $e := .History}}<div class="cmd" id="c{{inc $i}}"><span class="n">{{inc $i}}.</span>{{with time $e.Time}}<span class="time">{{.}}</span>{{end}}{{$e.Command}}</div>
+{{else}}<p class="meta">No commands recorded.</p>
+{{end}}</main>
+<script src="search-index.js"></script>
+<script src="search.js"></script>
+</body>
+</html>
+`))
+
+var publishSessionPage = template.Must(template.New("session").Funcs(publishFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Name}} · {{.Workspace}} · bashlog</title>
+<link rel="stylesheet" href="../style.css">
+</head>
+<body>
+<header><b>bashlog</b> <a href="../index.html">{{.Workspace}}</a> / {{.Session.Name}}</header>
+<main>
+{{with .Session}}<p class="meta">{{.Shell}} session started {{time .Started}}{{with .User}} by {{.}}{{end}}{{with .Host}} on {{.}}{{end}} · {{len .Cells}} commands</p>
+{{with .Note}}<p class="meta">{{.}}</p>
+{{end}}{{range $i, $c := .Cells}}<div class="cell" id="c{{inc $i}}">
+<div class="cmd"><span class="n">{{inc $i}}.</span>{{with time $c.Time}}<span class="time">{{.}}</span>{{end}}{{$c.Command}}</div>
+{{with $c.Output}}<pre class="output">{{.}}</pre>
+{{end}}</div>
+{{end}}{{end}}</main>
+</body>
+</html>
+`))
+
+const publishStyle = `body { font: 14px system-ui, sans-serif; margin: 0; color: #222; }
+header { padding: .6em 1em; background: #222; color: #eee; }
+header a { color: #eee; }
+main { padding: 1em; max-width: 70em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: .2em .8em .2em 0; border-bottom: 1px solid #eee; }
+input[type=search] { font: inherit; width: 100%; box-sizing: border-box; padding: .3em; }
+.meta { color: #666; }
+.cmd { font-family: ui-monospace, monospace; padding: .25em .4em; border-bottom: 1px solid #eee; white-space: pre-wrap; }
+.cmd:target { background: #fff6d0; }
+.n, .time { color: #888; margin-right: .6em; }
+.output { margin: 0 0 .6em 2em; padding: .5em; background: #f6f6f6; overflow-x: auto; }
+#results a { display: block; color: inherit; text-decoration: none; }
+#results a:hover { background: #f4f4f4; }
+`
+
+// publishSearchScript searches the index search-index.js loads as the
+// query is typed. The index is a script rather than JSON so that the site
+// also works opened straight from disk, where browsers won't fetch files
+const publishSearchScript = `"use strict";
+(function () {
+  const input = document.getElementById("search");
+  const results = document.getElementById("results");
+  const index = window.BASHLOG_INDEX || [];
+  const limit = 200;
+  input.addEventListener("input", function () {
+    const q = input.value.trim().toLowerCase();
+    results.replaceChildren();
+    if (!q) return;
+    let shown = 0;
+    for (const e of index) {
+      if (e.c.toLowerCase().indexOf(q) < 0) continue;
+      if (shown++ === limit) {
+        results.append(Object.assign(document.createElement("p"), { className: "meta", textContent: "More matches not shown; refine the search." }));
+        break;
+      }
+      const a = document.createElement("a");
+      a.href = e.p + "#" + e.a;
+      a.className = "cmd";
+      if (e.t) a.append(Object.assign(document.createElement("span"), { className: "time", textContent: e.t }));
+      a.append(document.createTextNode(e.c));
+      results.append(a);
+    }
+    if (!shown) results.append(Object.assign(document.createElement("p"), { className: "meta", textContent: "No matches." }));
+  });
+})();
+`
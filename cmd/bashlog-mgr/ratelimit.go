@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for the API limits, each overridable in the settings for all
+// tokens (api.rate=5) or for one (api.rate.<token name>=5)
+const (
+	defaultAPIRate       = 10.0
+	defaultAPIBurst      = 20
+	defaultAPIConcurrent = 4
+	defaultAPIMaxResults = maxPageSize
+	defaultAPIMaxBytes   = 8 << 20
+)
+
+// apiLimits bounds what one token may ask of the server: Rate requests a
+// second on average with bursts of up to Burst, at most Concurrent at a
+// time, and pages of at most MaxResults records and about MaxBytes
+type apiLimits struct {
+	Rate       float64
+	Burst      int
+	Concurrent int
+	MaxResults int
+	MaxBytes   int64
+}
+
+// readAPILimits returns the limits for the token called name
+func readAPILimits(settings map[string]string, name string) apiLimits {
+	setting := func(key string) string {
+		if v := settings["api."+key+"."+name]; v != "" {
+			return v
+		}
+		return settings["api."+key]
+	}
+	number := func(key string, def float64) float64 {
+		if v, err := strconv.ParseFloat(setting(key), 64); err == nil && v > 0 {
+			return v
+		}
+		return def
+	}
+	return apiLimits{
+		Rate:       number("rate", defaultAPIRate),
+		Burst:      int(number("burst", defaultAPIBurst)),
+		Concurrent: int(number("max_concurrent", defaultAPIConcurrent)),
+		MaxResults: int(math.Min(number("max_results", defaultAPIMaxResults), maxPageSize)),
+		MaxBytes:   int64(number("max_bytes", defaultAPIMaxBytes)),
+	}
+}
+
+// tokenLimiter enforces one token's limits
+type tokenLimiter struct {
+	limits apiLimits
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	inFlight int
+}
+
+func newTokenLimiter(limits apiLimits) *tokenLimiter {
+	return &tokenLimiter{limits: limits, tokens: float64(limits.Burst)}
+}
+
+// acquire admits a request at now, or returns how long to wait before
+// retrying. An admitted request must be released when it is done
+func (l *tokenLimiter) acquire(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = math.Min(float64(l.limits.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limits.Rate)
+	}
+	l.last = now
+
+	if l.inFlight >= l.limits.Concurrent {
+		return false, time.Second
+	}
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / l.limits.Rate * float64(time.Second))
+	}
+	l.tokens--
+	l.inFlight++
+	return true, 0
+}
+
+func (l *tokenLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+}
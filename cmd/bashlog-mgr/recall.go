@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/shellparse"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const recallUsage = "bashlog-mgr recall [--around '30m ago'] [--span 30m] [--workspace pattern]"
+
+// recallBreak is how long a pause starts a new stretch of work in recall's
+// narrative, even in the same place
+const recallBreak = 10 * time.Minute
+
+// recallShown is how many commands of a stretch recall lists before
+// summing up the rest
+const recallShown = 8
+
+// recalled is a command recall tells of, with where it ran when the
+// session it was typed in recorded that
+type recalled struct {
+	workspace string
+	entry     workspace.Entry
+	dir       string
+	status    *int
+}
+
+// stretch is a run of commands in one workspace and directory without a
+// long pause
+type stretch struct {
+	workspace, dir, branch string
+	commands               []recalled
+}
+
+// handleRecall tells what was being done around a time, 30 minutes ago by
+// default, to pick up after an interruption: the commands run across the
+// workspaces as stretches of work, each with the directory and git branch
+// it was in, and how it ended
+func handleRecall(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("recall", flag.ExitOnError)
+	around := fs.String("around", "30m ago", "The time to recall, such as '30m ago', '14:00' or '2024-06-01 14:00'")
+	spanFlag := fs.String("span", "30m", "How far either side of --around to look, such as 30m, 2h or 1d")
+	pattern := fs.String("workspace", "*", "Only recall workspaces matching this name or pattern")
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 0 {
+		failUsage(recallUsage, "unexpected arguments")
+	}
+
+	at, err := parseInstant(*around)
+	if err != nil {
+		fail(exitUsage, "invalid --around '%s': %v", *around, err)
+	}
+	span, err := parseAge(*spanFlag)
+	if err != nil || span <= 0 {
+		fail(exitUsage, "invalid --span '%s': expected a duration such as 30m", *spanFlag)
+	}
+	from, to := at.Add(-span), at.Add(span)
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+
+	names := requireWorkspaces(basePath, []string{*pattern})
+	commands := recallCommands(basePath, logsPath, names, from, to)
+
+	fmt.Printf("\n=== Around %s (%s to %s) ===\n", at.Local().Format("2006-01-02 15:04"), from.Local().Format("15:04"), to.Local().Format("15:04"))
+	if len(commands) == 0 {
+		fmt.Println("\nNothing was recorded then")
+		return
+	}
+	stretches := splitStretches(commands)
+	for _, s := range stretches {
+		printStretch(s)
+	}
+
+	last := stretches[len(stretches)-1]
+	lastCmd := last.commands[len(last.commands)-1]
+	fmt.Printf("\nLast: %s in %s", redactRead(lastCmd.entry.Command), stretchPlace(last))
+	if lastCmd.status != nil && *lastCmd.status != 0 {
+		fmt.Printf(", which failed (exit %d)", *lastCmd.status)
+	}
+	fmt.Println()
+}
+
+// recallCommands gathers the commands run between from and to, oldest
+// first: those of the sessions recorded into the workspaces named, which
+// know where they ran, including sessions still running, and the rest of
+// the workspaces' histories, such as commands shipped from other machines
+func recallCommands(basePath, logsPath string, names []string, from, to time.Time) []recalled {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	type key struct {
+		workspace string
+		entry     workspace.Entry
+	}
+	seen := make(map[key]bool)
+	var commands []recalled
+	add := func(r recalled) {
+		if r.entry.Time.Before(from) || r.entry.Time.After(to) {
+			return
+		}
+		k := key{r.workspace, workspace.Entry{Command: r.entry.Command, Time: time.Unix(r.entry.Time.Unix(), 0)}}
+		if !seen[k] {
+			seen[k] = true
+			commands = append(commands, r)
+		}
+	}
+
+	metas, _ := session.ListMeta(logsPath)
+	for _, m := range metas {
+		if !wanted[m.Workspace] || m.Started.After(to) || m.Finished() && m.Ended.Before(from) {
+			continue
+		}
+		entries, err := m.Commands()
+		if err != nil {
+			continue
+		}
+		statuses, _ := session.ReadStatuses(m.HistoryFile())
+		for i, s := range session.MatchStatuses(entries, statuses) {
+			r := recalled{workspace: m.Workspace, entry: entries[i]}
+			if s != nil {
+				r.dir, r.status = s.Dir, &s.Status
+			}
+			add(r)
+		}
+	}
+	for _, name := range names {
+		entries, err := storage.Read(workspacePath(basePath, name))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.Time.IsZero() {
+				add(recalled{workspace: name, entry: e})
+			}
+		}
+	}
+
+	sort.SliceStable(commands, func(i, j int) bool { return commands[i].entry.Time.Before(commands[j].entry.Time) })
+	return commands
+}
+
+// splitStretches groups commands into stretches of work, following the git
+// branch each directory was on from the commands that switched it, or
+// failing that from the repository as it is now
+func splitStretches(commands []recalled) []stretch {
+	branches := make(map[string]string)
+	var stretches []stretch
+	for i, c := range commands {
+		dir := c.dir
+		if dir == "" && len(stretches) > 0 && stretches[len(stretches)-1].workspace == c.workspace {
+			dir = stretches[len(stretches)-1].dir
+		}
+		if _, ok := branches[dir]; !ok && dir != "" {
+			branches[dir] = repoBranch(dir)
+		}
+
+		n := len(stretches)
+		if n == 0 || stretches[n-1].workspace != c.workspace || stretches[n-1].dir != dir ||
+			c.entry.Time.Sub(commands[i-1].entry.Time) > recallBreak {
+			stretches = append(stretches, stretch{workspace: c.workspace, dir: dir, branch: branches[dir]})
+			n++
+		}
+		stretches[n-1].commands = append(stretches[n-1].commands, c)
+		if b, ok := switchedBranch(c.entry.Command); ok && dir != "" {
+			branches[dir] = b
+			stretches[n-1].branch = b
+		}
+	}
+	return stretches
+}
+
+// printStretch tells of one stretch of work: when and where, and its
+// commands, repeats run back to back once, with how each failed
+func printStretch(s stretch) {
+	first, last := s.commands[0].entry.Time, s.commands[len(s.commands)-1].entry.Time
+	when := first.Local().Format("15:04")
+	if last.Sub(first) >= time.Minute {
+		when += "–" + last.Local().Format("15:04")
+	}
+	fmt.Printf("\n%-11s %s\n", when, stretchPlace(s))
+
+	shown, hidden, failed := 0, 0, 0
+	for i, c := range s.commands {
+		if c.status != nil && *c.status != 0 {
+			failed++
+		}
+		if i > 0 && c.entry.Command == s.commands[i-1].entry.Command {
+			continue
+		}
+		if shown == recallShown {
+			hidden++
+			continue
+		}
+		shown++
+		line := "  " + redactRead(c.entry.Command)
+		if c.status != nil && *c.status != 0 {
+			line += fmt.Sprintf("   ✗ exit %d", *c.status)
+		}
+		fmt.Println(line)
+	}
+	if hidden > 0 {
+		fmt.Printf("  … and %d more\n", hidden)
+	}
+	if failed > 1 {
+		fmt.Printf("  (%d of %d commands failed)\n", failed, len(s.commands))
+	}
+}
+
+// stretchPlace describes where a stretch was spent, as
+// "my-project, ~/src/app on branch main"
+func stretchPlace(s stretch) string {
+	place := s.workspace
+	if place == "" {
+		place = "no workspace"
+	}
+	if s.dir != "" {
+		place += ", " + homeRelative(s.dir)
+	}
+	if s.branch != "" {
+		place += " on branch " + s.branch
+	}
+	return place
+}
+
+// homeRelative shortens a path in the home directory to start with ~
+func homeRelative(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(path, home+"/"); ok {
+		return "~/" + rest
+	}
+	return path
+}
+
+// switchedBranch returns the branch a git checkout or switch in line moved
+// to, when it names one
+func switchedBranch(line string) (string, bool) {
+	branch, found := "", false
+	for _, c := range shellparse.Parse(line) {
+		name, args, _ := c.Program()
+		if name != "git" || len(args) < 2 || args[0] != "checkout" && args[0] != "switch" {
+			continue
+		}
+		var operands []string
+		for i := 1; i < len(args); i++ {
+			switch a := args[i]; {
+			case a == "--":
+				i = len(args)
+			case a == "-b" || a == "-B" || a == "-c" || a == "-C":
+				if i+1 < len(args) {
+					operands = append(operands[:0], args[i+1])
+					i = len(args)
+				}
+			case strings.HasPrefix(a, "-"):
+			default:
+				operands = append(operands, a)
+			}
+		}
+		// A checkout of files, as git checkout main -- file, means no
+		// switch when more than the branch is named
+		if len(operands) == 1 && operands[0] != "." {
+			branch, found = operands[0], true
+		}
+	}
+	return branch, found
+}
+
+// repoBranch returns the branch the git repository holding dir has checked
+// out now, if it is on this machine and on a branch
+func repoBranch(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		head, err := os.ReadFile(filepath.Join(d, ".git", "HEAD"))
+		if err == nil {
+			ref, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if !ok {
+				return ""
+			}
+			return ref
+		}
+		if parent := filepath.Dir(d); parent == d {
+			return ""
+		}
+	}
+}
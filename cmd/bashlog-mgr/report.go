@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/category"
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const reportUsage = "bashlog-mgr report [--custom name [pattern...] [--since 7d] [--to file]]"
+
+const (
+	// reportsDir holds custom report templates, next to settingsFile
+	reportsDir = "reports"
+	// reportExtension ends the names of report template files
+	reportExtension = ".tmpl"
+)
+
+// reportData is what a custom report's template is run on
+type reportData struct {
+	Name      string
+	Generated time.Time
+	// Since is when the period reported on starts, zero for all time
+	Since time.Time
+	// Commands are every workspace's commands in the period, as Workspaces
+	// has them
+	Commands   []resultRow
+	Workspaces []reportWorkspace
+	// Sessions were recorded into the workspaces and started in the period
+	Sessions []*session.Meta
+}
+
+// reportWorkspace is a workspace's part of a report
+type reportWorkspace struct {
+	Name     string
+	Created  time.Time
+	Commands []resultRow
+	Sessions []*session.Meta
+}
+
+// handleReport runs a report a team defined as a Go template in
+// ~/.bashlog/reports/<name>.tmpl over the workspaces' commands and
+// sessions, or lists the reports defined
+func handleReport(basePath, logsPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	custom := fs.String("custom", "", "Run the report defined in ~/.bashlog/reports/<name>.tmpl")
+	since := fs.String("since", "7d", "How far back the report covers, e.g. 24h or 30d (0 for all time)")
+	to := fs.String("to", "", "Write the report to this new file instead of stdout")
+	patterns := parseInterspersed(fs, args)
+
+	dir := filepath.Join(filepath.Dir(settingsPath), reportsDir)
+	if *custom == "" {
+		if len(patterns) > 0 {
+			failUsage(reportUsage, "--custom required to report on workspaces")
+		}
+		listReports(dir)
+		return
+	}
+	if !isValidName(*custom) {
+		fail(exitUsage, "invalid report name '%s'", *custom)
+	}
+	age, err := parseAge(*since)
+	if err != nil {
+		fail(exitUsage, "invalid --since '%s': %v", *since, err)
+	}
+
+	tmpl, err := loadReport(dir, *custom)
+	if errors.Is(err, os.ErrNotExist) {
+		fail(exitNotFound, "no report '%s' (define it in %s)", *custom, filepath.Join(dir, *custom+reportExtension))
+	}
+	if err != nil {
+		fail(exitUsage, "invalid report '%s': %v", *custom, err)
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	names := requireWorkspaces(basePath, patterns)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = workspacePath(basePath, name)
+	}
+	requireSensitiveUnlock(settingsPath, "report", names, paths)
+
+	data := reportData{Name: *custom, Generated: time.Now()}
+	if age > 0 {
+		data.Since = data.Generated.Add(-age)
+	}
+	if err := collectReport(&data, basePath, logsPath, names); err != nil {
+		fail(exitFailure, "could not read workspaces: %v", err)
+	}
+
+	if *to == "" {
+		if err := tmpl.Execute(os.Stdout, data); err != nil {
+			fail(exitFailure, "could not run report '%s': %v", *custom, err)
+		}
+		return
+	}
+	if err := writeReport(*to, tmpl, data); err != nil {
+		fail(exitCodeFor(err), "could not write report '%s': %v", *custom, err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Wrote report '%s' on %d workspace(s) to %s\n", *custom, len(data.Workspaces), *to)
+}
+
+// writeReport runs tmpl into the new file path, removing it if the report
+// can't be written whole
+func writeReport(path string, tmpl *template.Template, data reportData) error {
+	f, err := fsperm.Default.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	err = tmpl.Execute(f, data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// loadReport parses the report called name in dir
+func loadReport(dir, name string) (*template.Template, error) {
+	text, err := os.ReadFile(filepath.Join(dir, name+reportExtension))
+	if err != nil {
+		return nil, err
+	}
+	return template.New(name).Funcs(resultFuncs).Funcs(reportFuncs).Parse(string(text))
+}
+
+// reportDescription returns what a report template says it is in a comment
+// opening it, as {{/* Weekly on-call summary */}}
+func reportDescription(text string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(text), "{{/*")
+	if !ok {
+		return ""
+	}
+	comment, _, _ := strings.Cut(rest, "*/")
+	line, _, _ := strings.Cut(strings.TrimSpace(comment), "\n")
+	return strings.TrimSpace(line)
+}
+
+// listReports prints the reports defined in dir, checking each parses
+func listReports(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+reportExtension))
+	if err != nil {
+		fail(exitFailure, "could not list reports: %v", err)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No custom reports. Define one as a Go template in %s\n", filepath.Join(dir, "<name>"+reportExtension))
+		return
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), reportExtension)
+		text, err := os.ReadFile(file)
+		if err == nil {
+			_, err = loadReport(dir, name)
+		}
+		if err != nil {
+			fmt.Printf("✗ %-20s %v\n", name, err)
+			continue
+		}
+		fmt.Printf("  %-20s %s\n", name, reportDescription(string(text)))
+	}
+}
+
+// collectReport fills in the commands and sessions of the workspaces called
+// names since data.Since
+func collectReport(data *reportData, basePath, logsPath string, names []string) error {
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		return err
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Started.Before(metas[j].Started) })
+
+	for _, name := range names {
+		wsPath := workspacePath(basePath, name)
+		entries, err := storage.Read(wsPath)
+		if err != nil {
+			return err
+		}
+		tags, err := workspace.ReadTags(wsPath)
+		if err != nil {
+			return err
+		}
+		config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
+		ws := reportWorkspace{Name: name}
+		ws.Created, _ = time.Parse(time.RFC3339, config["created"])
+
+		for i, e := range entries {
+			// Commands recorded without a time are only reported on when
+			// the report covers all time
+			if !data.Since.IsZero() && (e.Time.IsZero() || e.Time.Before(data.Since)) {
+				continue
+			}
+			ws.Commands = append(ws.Commands, newResultRow(name, i+1, e, tags.Of(e)))
+		}
+		for _, m := range metas {
+			if m.Workspace == name && !m.Started.Before(data.Since) {
+				ws.Sessions = append(ws.Sessions, m)
+			}
+		}
+		data.Commands = append(data.Commands, ws.Commands...)
+		data.Sessions = append(data.Sessions, ws.Sessions...)
+		data.Workspaces = append(data.Workspaces, ws)
+	}
+	sort.SliceStable(data.Sessions, func(i, j int) bool { return data.Sessions[i].Started.Before(data.Sessions[j].Started) })
+	return nil
+}
+
+// reportFuncs are the functions report templates have, beyond --template's
+var reportFuncs = template.FuncMap{
+	// top returns the n commands run most often among rows, most first
+	"top": func(n int, rows []resultRow) []workspace.UniqueEntry {
+		unique := workspace.Unique(resultEntries(rows))
+		sort.SliceStable(unique, func(i, j int) bool { return unique[i].Count > unique[j].Count })
+		if len(unique) > n {
+			unique = unique[:n]
+		}
+		return unique
+	},
+	// days returns on how many days any of rows ran
+	"days": func(rows []resultRow) int {
+		days := make(map[string]bool)
+		for _, row := range rows {
+			if !row.Time.IsZero() {
+				days[row.Time.Format(time.DateOnly)] = true
+			}
+		}
+		return len(days)
+	},
+	"category": func(command string) string {
+		return string(category.Primary(command))
+	},
+	"duration": formatDuration,
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/atuin"
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/notebook"
+	"github.com/interhack86/bashlog/internal/transcript"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// resultFormats are the export formats results can be written in
+var resultFormats = []string{"bash", "atuin", "markdown", "ipynb"}
+
+// resultRow is a command history or search shows, as --template sees it
+type resultRow struct {
+	// Number is the command's position in its workspace's history, 0 when
+	// not known, as for search matches
+	Number    int
+	Workspace string
+	// Timestamp is Time as history shows it, empty when not recorded
+	Timestamp string
+	Time      time.Time
+	Cmd       string
+	Tags      []string
+	// Snippet is the line of output search --output matched
+	Snippet string
+	// Count is how often history --unique saw the command
+	Count int
+}
+
+// resultOutput sends the results of history and search through a template,
+// one line per command, or writes them to a file in an export format,
+// instead of printing the usual table
+type resultOutput struct {
+	template string
+	to       string
+	format   string
+
+	tmpl *template.Template
+}
+
+// resultFlags adds --template, --to and --format to fs
+func resultFlags(fs *flag.FlagSet) *resultOutput {
+	o := &resultOutput{}
+	fs.StringVar(&o.template, "template", "", "Print each command through this Go template, e.g. '{{.Timestamp}} {{.Cmd}}'; fields are Number, Workspace, Timestamp, Time, Cmd, Tags, Snippet and Count")
+	fs.StringVar(&o.to, "to", "", "Write the commands to this new file instead, in --format or as --template says")
+	fs.StringVar(&o.format, "format", "", "Write the commands in this export format: "+strings.Join(resultFormats, ", ")+" (default: from --to's extension, else bash)")
+	return o
+}
+
+// check validates the flags once they are parsed, failing with usage
+func (o *resultOutput) check(usage string) {
+	if o.template != "" && o.format != "" {
+		failUsage(usage, "--template and --format are alternatives")
+	}
+	if o.format == "md" {
+		o.format = "markdown"
+	}
+	if o.format != "" && !contains(resultFormats, o.format) {
+		fail(exitUsage, "unsupported format '%s' (expected one of %s)", o.format, strings.Join(resultFormats, ", "))
+	}
+	if o.format == "" && o.template == "" && o.to != "" {
+		o.format = "bash"
+		switch strings.ToLower(filepath.Ext(o.to)) {
+		case ".md":
+			o.format = "markdown"
+		case ".ipynb":
+			o.format = "ipynb"
+		}
+	}
+	if o.template != "" {
+		tmpl, err := template.New("template").Funcs(resultFuncs).Parse(o.template)
+		if err != nil {
+			fail(exitUsage, "invalid --template: %v", err)
+		}
+		o.tmpl = tmpl
+	}
+}
+
+// active reports whether results go through a template or to a file
+// rather than the table
+func (o *resultOutput) active() bool {
+	return o.template != "" || o.to != "" || o.format != ""
+}
+
+var resultFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// write writes rows as the flags say, titled for the notebook formats.
+// Writing to a file asks for the passphrase or a code first if any of the
+// workspaces of rows, kept under basePath, is sensitive
+func (o *resultOutput) write(basePath, settingsPath, title string, rows []resultRow) {
+	if o.format == "atuin" || o.to != "" && o.to != "-" {
+		var names, paths []string
+		for _, row := range rows {
+			if !contains(names, row.Workspace) {
+				names = append(names, row.Workspace)
+				paths = append(paths, workspacePath(basePath, row.Workspace))
+			}
+		}
+		requireSensitiveUnlock(settingsPath, "write out", names, paths)
+	}
+
+	var err error
+	if o.format == "atuin" {
+		err = o.writeAtuin(rows)
+	} else {
+		err = o.writeFile(title, rows)
+	}
+	if err != nil {
+		fail(exitCodeFor(err), "could not write results: %v", err)
+	}
+	if o.to != "" {
+		fmt.Fprintf(os.Stderr, "✓ Wrote %d commands to %s\n", len(rows), o.to)
+	}
+}
+
+func (o *resultOutput) writeAtuin(rows []resultRow) error {
+	dest := o.to
+	if dest == "" {
+		var err error
+		if dest, err = atuin.DefaultPath(); err != nil {
+			return err
+		}
+		o.to = dest
+	}
+	_, err := atuin.Export(dest, resultEntries(rows), time.Now())
+	return err
+}
+
+func (o *resultOutput) writeFile(title string, rows []resultRow) error {
+	w := io.Writer(os.Stdout)
+	if o.to != "" && o.to != "-" {
+		f, err := fsperm.Default.OpenFile(o.to, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	} else {
+		o.to = ""
+	}
+
+	switch o.format {
+	case "bash":
+		return workspace.WriteHistory(w, resultEntries(rows))
+	case "markdown":
+		return notebook.WriteMarkdown(w, resultNotebook(title, rows))
+	case "ipynb":
+		return notebook.WriteJupyter(w, resultNotebook(title, rows))
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		if err := o.tmpl.Execute(&b, row); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func resultEntries(rows []resultRow) []workspace.Entry {
+	entries := make([]workspace.Entry, len(rows))
+	for i, row := range rows {
+		entries[i] = workspace.Entry{Command: row.Cmd, Time: row.Time}
+	}
+	return entries
+}
+
+// resultNotebook makes a section of each workspace's run of rows, with the
+// output search --output matched
+func resultNotebook(title string, rows []resultRow) notebook.Notebook {
+	nb := notebook.Notebook{Title: title}
+	for _, row := range rows {
+		if len(nb.Sections) == 0 || nb.Sections[len(nb.Sections)-1].Heading != "Workspace "+row.Workspace {
+			nb.Sections = append(nb.Sections, notebook.Section{Heading: "Workspace " + row.Workspace})
+		}
+		section := &nb.Sections[len(nb.Sections)-1]
+		section.Cells = append(section.Cells, transcript.Cell{Command: row.Cmd, Time: row.Time, Output: row.Snippet})
+	}
+	return nb
+}
+
+// newResultRow returns the row of a command e of the workspace called name,
+// its secrets masked as redact.on-read says
+func newResultRow(name string, number int, e workspace.Entry, tags []string) resultRow {
+	row := resultRow{Number: number, Workspace: name, Time: e.Time, Cmd: redactRead(e.Command), Tags: tags}
+	if !e.Time.IsZero() {
+		row.Timestamp = e.Time.Format(time.DateTime)
+	}
+	return row
+}
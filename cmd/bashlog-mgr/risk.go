@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/risk"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// riskyEntry is a history entry that scored at or above some risk level
+type riskyEntry struct {
+	workspace.Entry
+	Workspace string
+	Level     risk.Level
+	Reasons   []risk.Reason
+}
+
+// riskyCommands returns the entries scoring at least min, in history order
+func riskyCommands(wsName string, entries []workspace.Entry, min risk.Level) []riskyEntry {
+	var risky []riskyEntry
+	for _, e := range entries {
+		level, reasons := risk.Score(e.Command)
+		if level >= min {
+			risky = append(risky, riskyEntry{Entry: e, Workspace: wsName, Level: level, Reasons: reasons})
+		}
+	}
+	return risky
+}
+
+// printRisky lists risky entries with the reasons they were flagged
+func printRisky(risky []riskyEntry, showWorkspace bool) {
+	for _, r := range risky {
+		when := ""
+		if !r.Time.IsZero() {
+			when = r.Time.Format("2006-01-02 15:04") + "  "
+		}
+		where := ""
+		if showWorkspace {
+			where = "[" + r.Workspace + "] "
+		}
+		fmt.Printf("  %s%s%s\n", when, where, redactRead(r.Command))
+		fmt.Printf("      %s\n", riskSummary(r.Reasons, r.Level))
+	}
+}
+
+// riskSummary joins the reasons that reached level
+func riskSummary(reasons []risk.Reason, level risk.Level) string {
+	var msgs []string
+	for _, r := range reasons {
+		if r.Level == level {
+			msgs = append(msgs, r.Message)
+		}
+	}
+	return level.String() + ": " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/rules"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// handleRules validates and lists the alert rules, or with "test" shows
+// which rules a command would match without carrying out their actions
+func handleRules(settingsPath string, args []string) {
+	engine, err := rules.NewEngine(workspace.ReadConfig(settingsPath), "")
+	if err != nil {
+		fail(exitFailure, "invalid rules in %s: %v", settingsPath, err)
+	}
+
+	if len(args) > 0 && args[0] == "test" {
+		testRules(engine, args[1:])
+		return
+	}
+
+	if len(engine.Rules) == 0 {
+		fmt.Printf("No rules. Add rule.<name>.<setting> lines to %s\n", settingsPath)
+		return
+	}
+
+	fmt.Printf("%-16s %-40s %s\n", "RULE", "CONDITIONS", "ACTIONS")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, r := range engine.Rules {
+		var conds, actions []string
+		if r.Command != nil {
+			conds = append(conds, "command~"+r.Command.String())
+		}
+		if r.User != "" {
+			conds = append(conds, "user="+r.User)
+		}
+		if r.Workspace != "" {
+			conds = append(conds, "workspace="+r.Workspace)
+		}
+		if r.Exit != nil {
+			conds = append(conds, "exit "+r.Exit.String())
+		}
+		if r.Duration != nil {
+			conds = append(conds, "duration "+r.Duration.String())
+		}
+		if len(r.Notify) > 0 {
+			actions = append(actions, "notify:"+strings.Join(r.Notify, ","))
+		}
+		if r.Exec != "" {
+			actions = append(actions, "exec")
+		}
+		if r.Tag != "" {
+			actions = append(actions, "tag:"+r.Tag)
+		}
+		fmt.Printf("%-16s %-40s %s\n", r.Name, strings.Join(conds, " "), strings.Join(actions, " "))
+	}
+}
+
+func testRules(engine *rules.Engine, args []string) {
+	fs := flag.NewFlagSet("rules test", flag.ExitOnError)
+	ws := fs.String("workspace", "", "Workspace the command was recorded into")
+	exit := fs.Int("exit", -1, "Exit code of the command (unknown when negative)")
+	duration := fs.Duration("duration", 0, "How long the command ran (unknown when zero)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 {
+		failUsage("bashlog-mgr rules test '<command>' [--workspace name] [--exit N] [--duration d]", "command required")
+	}
+
+	ev := rules.Event{
+		Command:     strings.Join(positional, " "),
+		Workspace:   *ws,
+		HasExit:     *exit >= 0,
+		ExitCode:    *exit,
+		HasDuration: *duration > 0,
+		Duration:    *duration,
+	}
+	if u, err := user.Current(); err == nil {
+		ev.User = u.Username
+	}
+	ev.Host, _ = os.Hostname()
+
+	matched := 0
+	for _, r := range engine.Rules {
+		if r.Match(ev) {
+			fmt.Printf("✓ %s\n", r.Name)
+			matched++
+		}
+	}
+	if matched == 0 {
+		fmt.Println("No rules match")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// rerunTag marks commands re-run with bashlog-mgr run; a second tag,
+// "rerun-of-<n>", links the new record to the original command n
+const rerunTag = "rerun"
+
+// handleRun re-executes a recorded command through the user's shell and
+// logs the re-run as a new command in the workspace
+func handleRun(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	confirm := fs.Bool("confirm", false, "Show the command and ask before running it")
+	cd := fs.Bool("cd", false, "Run in the command's recorded working directory")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 2 {
+		failUsage("bashlog-mgr run <name> <n> [--confirm] [--cd]", "workspace name and command number required")
+	}
+	name := positional[0]
+
+	entry, n, err := commandRef(basePath, name, positional[1])
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+
+	dir := ""
+	if *cd {
+		if dir = recordedDir(logsPath, name, entry); dir == "" {
+			fail(exitNotFound, "command %d has no recorded working directory", n)
+		}
+	}
+
+	if *confirm && !confirmRun(entry.Command) {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	rerun := workspace.Entry{Command: entry.Command, Time: time.Now()}
+	status := runRecorded(entry.Command, dir)
+	tags := []string{rerunTag, rerunTag + "-of-" + strconv.Itoa(n)}
+
+	wsPath := workspacePath(basePath, name)
+	record := workspace.Record{Entry: rerun, HasExit: true, Exit: status, HasDuration: true, Duration: time.Since(rerun.Time), Tags: tags}
+	if err := storage.AppendRecords(wsPath, []workspace.Record{record}); err != nil {
+		fail(exitFailure, "could not record the re-run: %v", err)
+	}
+	tagged := workspace.Tagged{Entry: rerun, Tags: tags}
+	if err := workspace.AddTags(wsPath, []workspace.Tagged{tagged}); err != nil {
+		fail(exitFailure, "could not link the re-run to command %d: %v", n, err)
+	}
+
+	finishAudit(status)
+	os.Exit(status)
+}
+
+// confirmRun shows a command and asks whether to run it
+func confirmRun(command string) bool {
+	fmt.Printf("  %s\nRun this command? (yes/no): ", command)
+	response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "yes" || response == "y"
+}
+
+// recordedDir returns the directory e ran in, as the status a session
+// recorded into workspace name kept for it says, or "" if none did
+func recordedDir(logsPath, name string, e workspace.Entry) string {
+	sessions, _ := workspaceSessions(logsPath, name)
+	for _, m := range sessions {
+		entries, err := m.Commands()
+		if err != nil {
+			continue
+		}
+		statuses, _ := session.ReadStatuses(m.HistoryFile())
+		for i, s := range session.MatchStatuses(entries, statuses) {
+			if s != nil && entries[i].Command == e.Command && entries[i].Time.Unix() == e.Time.Unix() {
+				return s.Dir
+			}
+		}
+	}
+	return ""
+}
+
+// runRecorded runs command through $SHELL in dir, or the current directory
+// if dir is "", attached to the terminal, and returns its exit status
+func runRecorded(command, dir string) int {
+	sh := os.Getenv("SHELL")
+	if sh == "" {
+		sh = "/bin/sh"
+	}
+
+	cmd := exec.Command(sh, "-c", command)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: could not run command: %v\n", err)
+		return exitFailure
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scanWorkers bounds how many workspaces are read at once. Reading is
+// mostly waiting on the filesystem, a synced or network one especially,
+// so this is more than the CPUs
+const scanWorkers = 16
+
+// progressDelay is how long a scan runs before it shows its progress, so
+// quick ones print nothing
+const progressDelay = 300 * time.Millisecond
+
+// scanEach calls fn for 0..n-1 on up to scanWorkers goroutines, showing
+// progress as label on a terminal if it takes a while
+func scanEach(label string, n int, fn func(i int)) {
+	p := startProgress(label, n)
+	defer p.stop()
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(scanWorkers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+				p.done.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// progress counts finished items and reports them on stderr
+type progress struct {
+	label string
+	total int
+	done  atomic.Int64
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func startProgress(label string, total int) *progress {
+	p := &progress{label: label, total: total, quit: make(chan struct{})}
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return p
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case <-p.quit:
+			return
+		case <-time.After(progressDelay):
+		}
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			fmt.Fprintf(os.Stderr, "\r%s %d/%d", p.label, p.done.Load(), p.total)
+			select {
+			case <-p.quit:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p
+}
+
+// stop clears the progress line, if one was shown
+func (p *progress) stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/redact"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const scrubUsage = "bashlog-mgr scrub <name|pattern>...|--all [--dry-run] [--yes]"
+
+// redactOnReadKey, set to "true" in ~/.bashlog/config.txt, masks the
+// secrets of commands and their output wherever they are shown, so those
+// recorded before anything masked them aren't shown again
+const redactOnReadKey = "redact.on-read"
+
+// redactOnRead is set from redactOnReadKey
+var redactOnRead bool
+
+// redactRead masks the secrets in s when redactOnRead says to
+func redactRead(s string) string {
+	if !redactOnRead {
+		return s
+	}
+	return redact.Secrets(s)
+}
+
+// redactEntries masks the commands of entries in place, as redactRead
+// does, and returns them
+func redactEntries(entries []workspace.Entry) []workspace.Entry {
+	for i := range entries {
+		entries[i].Command = redactRead(entries[i].Command)
+	}
+	return entries
+}
+
+// handleScrub masks the secrets recorded in workspaces for good: in their
+// history and everything keyed on it, and in the logs of the sessions
+// recorded into them
+func handleScrub(basePath, logsPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("scrub", flag.ExitOnError)
+	all := fs.Bool("all", false, "Scrub every workspace")
+	dryRun := fs.Bool("dry-run", false, "Print what would be masked without changing anything")
+	var yes bool
+	fs.BoolVar(&yes, "yes", false, "Scrub without asking for confirmation")
+	fs.BoolVar(&yes, "force", false, "Same as --yes")
+	patterns := parseInterspersed(fs, args)
+
+	if *all {
+		if len(patterns) > 0 {
+			failUsage(scrubUsage, "workspace names and --all are alternatives")
+		}
+		patterns = []string{"*"}
+	}
+	if len(patterns) == 0 {
+		failUsage(scrubUsage, "workspace names or --all required")
+	}
+	names := requireWorkspaces(basePath, patterns)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = workspacePath(basePath, name)
+		if workspace.IsMounted(paths[i]) {
+			fail(exitConflict, "workspace '%s' is mounted read-only and can't be scrubbed", name)
+		}
+		if b := storage.For(paths[i]).Name(); b != storage.Files {
+			fail(exitUsage, "workspace '%s' keeps its commands in %s, which scrub can't rewrite", name, b)
+		}
+	}
+	requireSensitiveUnlock(settingsPath, "scrub", names, paths)
+	if !*dryRun && !confirmWorkspaces("permanently mask the secrets in", names, yes) {
+		fmt.Println("Scrub cancelled")
+		return
+	}
+
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		fail(exitFailure, "could not list sessions: %v", err)
+	}
+
+	verb := "✓ Masked"
+	if *dryRun {
+		verb = "Would mask"
+	}
+	total := 0
+	for i, name := range names {
+		changed, err := workspace.Scrub(paths[i], redact.Secrets, *dryRun)
+		if err != nil {
+			fail(exitCodeFor(err), "could not scrub workspace '%s': %v", name, err)
+		}
+		for _, m := range metas {
+			if m.Workspace != name {
+				continue
+			}
+			files := []string{m.HistoryFile(), session.SourcesPath(m.HistoryFile()), strings.TrimSuffix(m.Path, ".meta") + ".log", session.SummaryPath(m.Path)}
+			for _, path := range files {
+				n, err := scrubFile(path, *dryRun)
+				if err != nil {
+					fail(exitCodeFor(err), "could not scrub session %s: %v", m.Name(), err)
+				}
+				if n > 0 {
+					changed["session "+m.Name()] += n
+				}
+			}
+		}
+
+		files := make([]string, 0, len(changed))
+		for file := range changed {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		count := 0
+		for _, file := range files {
+			fmt.Printf("  %s: %d line(s)\n", file, changed[file])
+			count += changed[file]
+		}
+		fmt.Printf("%s %d line(s) with secrets in workspace '%s'\n", verb, count, name)
+		total += count
+	}
+	if total > 0 && !*dryRun {
+		fmt.Println("  Snapshots and backups made before now still hold them")
+	}
+}
+
+// scrubFile masks the secrets in each line of a session's history
+// segment, sourced commands, transcript or summary, returning how many
+// changed
+func scrubFile(path string, dryRun bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(string(data), "\n")
+	changed := 0
+	for i, line := range lines {
+		if scrubbed := redact.Secrets(line); scrubbed != line {
+			lines[i] = scrubbed
+			changed++
+		}
+	}
+	if changed == 0 || dryRun {
+		return changed, nil
+	}
+	tmp := path + ".scrub"
+	if err := fsperm.Default.WriteFile(tmp, []byte(strings.Join(lines, "\n"))); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return changed, nil
+}
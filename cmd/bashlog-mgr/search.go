@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/interhack86/bashlog/internal/category"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const searchUsage = "bashlog-mgr search [query] [--workspace pattern] [--category name] [--tag tag] [--host name] [--origin name|--interactive] [--output] [--limit n] [--template text|--format name] [--to file]"
+
+// handleSearch finds commands containing a substring across workspaces,
+// or with --output, commands whose captured output contains it, each with
+// the line of output that matched
+func handleSearch(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	pattern := fs.String("workspace", "*", "Only search workspaces matching this name or pattern")
+	categoryName := fs.String("category", "", "Only show commands in this category ("+categoryNames()+")")
+	tag := fs.String("tag", "", "Only show commands with this tag")
+	host := fs.String("host", "", "Only show commands recorded on this host")
+	originName := fs.String("origin", "", "Only show commands from this origin ("+strings.Join(workspace.Origins, ", ")+")")
+	interactive := fs.Bool("interactive", false, "Only show commands typed at a prompt, same as --origin interactive")
+	ignoreCase := fs.Bool("i", false, "Match case-insensitively")
+	inOutput := fs.Bool("output", false, "Match the query against what commands printed, as captured from bashlog --pty sessions, instead of the commands")
+	limit := fs.Int("limit", 50, "Show at most this many matches, most recent last (0 for all)")
+	results := resultFlags(fs)
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) > 1 {
+		failUsage(searchUsage, "expected a single query, quote it to search for spaces")
+	}
+	query := ""
+	if len(positional) == 1 {
+		query = positional[0]
+	}
+	if query == "" && *categoryName == "" && *tag == "" && *host == "" && *originName == "" && !*interactive {
+		failUsage(searchUsage, "a query, --category, --tag, --host or --origin is required")
+	}
+	if *inOutput && query == "" {
+		failUsage(searchUsage, "--output needs a query to look for in the output")
+	}
+	results.check(searchUsage)
+	cat := parseCategoryFlag(*categoryName)
+	origin := parseOriginFlag(*originName, *interactive)
+
+	type match struct {
+		workspace string
+		entry     workspace.Entry
+		tags      []string
+		snippet   string
+	}
+	var matches []match
+	for _, name := range requireWorkspaces(basePath, []string{*pattern}) {
+		wsPath := workspacePath(basePath, name)
+		var entries []workspace.Entry
+		var err error
+		if *inOutput {
+			entries, err = storage.Read(wsPath)
+		} else {
+			entries, err = storage.For(wsPath).Search(wsPath, query, *ignoreCase)
+		}
+		if err != nil {
+			fail(exitFailure, "could not read history of '%s': %v", name, err)
+		}
+		tags, err := workspace.ReadTags(wsPath)
+		if err != nil {
+			fail(exitFailure, "could not read tags of '%s': %v", name, err)
+		}
+		entries = filterCategory(entries, cat)
+		if *tag != "" {
+			entries = workspace.FilterTag(entries, tags, *tag)
+		}
+		if *host != "" {
+			hosts, err := workspace.ReadHosts(wsPath)
+			if err != nil {
+				fail(exitFailure, "could not read hosts of '%s': %v", name, err)
+			}
+			entries = workspace.FilterHost(entries, hosts, *host)
+		}
+		if origin != "" {
+			origins, err := workspace.ReadOrigins(wsPath)
+			if err != nil {
+				fail(exitFailure, "could not read origins of '%s': %v", name, err)
+			}
+			entries = workspace.FilterOrigin(entries, origins, origin)
+		}
+		if *inOutput {
+			outputs, err := workspace.ReadOutputs(wsPath)
+			if err != nil {
+				fail(exitFailure, "could not read output of '%s': %v", name, err)
+			}
+			for _, e := range entries {
+				out, ok := outputs.Of(e)
+				if !ok {
+					continue
+				}
+				if snippet, ok := outputSnippet(redactRead(out), query, *ignoreCase); ok {
+					matches = append(matches, match{name, e, tags.Of(e), snippet})
+				}
+			}
+			continue
+		}
+		for _, e := range entries {
+			// What was masked isn't found either
+			if _, ok := outputSnippet(redactRead(e.Command), query, *ignoreCase); ok || query == "" {
+				matches = append(matches, match{name, e, tags.Of(e), ""})
+			}
+		}
+	}
+
+	if len(matches) == 0 && !results.active() {
+		if *inOutput {
+			fmt.Println("No command printed a match (output is only captured in bashlog --pty sessions)")
+			return
+		}
+		fmt.Println("No matching commands")
+		return
+	}
+
+	shown := matches
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+	if results.active() {
+		rows := make([]resultRow, len(shown))
+		for i, m := range shown {
+			rows[i] = newResultRow(m.workspace, 0, m.entry, m.tags)
+			rows[i].Snippet = m.snippet
+		}
+		results.write(basePath, settingsPath, "Search results", rows)
+		if len(shown) < len(matches) {
+			fmt.Fprintf(os.Stderr, "(%d of %d matches, use --limit 0 for all)\n", len(shown), len(matches))
+		}
+		return
+	}
+	for _, m := range shown {
+		when := "-"
+		if !m.entry.Time.IsZero() {
+			when = m.entry.Time.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-19s  %-20s %s%s\n", when, m.workspace, redactRead(m.entry.Command), formatTags(m.tags))
+		if m.snippet != "" {
+			fmt.Printf("%21s│ %s\n", "", m.snippet)
+		}
+	}
+	if len(shown) < len(matches) {
+		fmt.Printf("(%d of %d matches, use --limit 0 for all)\n", len(shown), len(matches))
+	}
+}
+
+// snippetWidth is how much of a line of output is shown around a match
+const snippetWidth = 100
+
+// outputSnippet returns the first line of out containing query, cut down
+// to snippetWidth characters around the match
+func outputSnippet(out, query string, ignoreCase bool) (string, bool) {
+	if ignoreCase {
+		query = strings.ToLower(query)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		haystack := line
+		if ignoreCase {
+			haystack = strings.ToLower(line)
+		}
+		i := strings.Index(haystack, query)
+		if i < 0 {
+			continue
+		}
+		runes := []rune(line)
+		if len(runes) <= snippetWidth {
+			return line, true
+		}
+		at := utf8.RuneCountInString(haystack[:i])
+		start := max(0, min(at-snippetWidth/3, len(runes)-snippetWidth))
+		snippet := strings.TrimSpace(string(runes[start : start+snippetWidth]))
+		if start > 0 {
+			snippet = "…" + snippet
+		}
+		if start+snippetWidth < len(runes) {
+			snippet += "…"
+		}
+		return snippet, true
+	}
+	return "", false
+}
+
+// parseCategoryFlag resolves a --category value, "" meaning no filter
+func parseCategoryFlag(name string) category.Category {
+	if name == "" {
+		return ""
+	}
+	c, err := category.Parse(name)
+	if err != nil {
+		fail(exitUsage, "%v (expected one of %s)", err, categoryNames())
+	}
+	return c
+}
+
+// parseOriginFlag resolves --origin, or --interactive, "" meaning no
+// filter
+func parseOriginFlag(name string, interactive bool) string {
+	if interactive {
+		if name != "" && name != workspace.OriginInteractive {
+			fail(exitUsage, "--interactive and --origin %s contradict each other", name)
+		}
+		return workspace.OriginInteractive
+	}
+	if name == "" {
+		return ""
+	}
+	origin, err := workspace.ParseOrigin(name)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+	return origin
+}
+
+// filterCategory keeps the entries that run something in category c
+func filterCategory(entries []workspace.Entry, c category.Category) []workspace.Entry {
+	if c == "" {
+		return entries
+	}
+	var kept []workspace.Entry
+	for _, e := range entries {
+		if category.Matches(e.Command, c) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// printCategoryBreakdown counts entries by primary category
+func printCategoryBreakdown(entries []workspace.Entry) {
+	counts := make(map[category.Category]int)
+	for _, e := range entries {
+		counts[category.Primary(e.Command)]++
+	}
+
+	fmt.Printf("\nCommands by Category:\n")
+	for _, c := range category.All {
+		n := counts[c]
+		if n == 0 {
+			continue
+		}
+		pct := float64(n) * 100 / float64(len(entries))
+		bar := strings.Repeat("█", int(pct/5+0.5))
+		fmt.Printf("  %-20s %6d  %5.1f%%  %s\n", c, n, pct, bar)
+	}
+}
+
+// formatTags renders tags after a command, e.g. "  [deploy, prod]"
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "  [" + strings.Join(tags, ", ") + "]"
+}
+
+func categoryNames() string {
+	names := make([]string, len(category.All))
+	for i, c := range category.All {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
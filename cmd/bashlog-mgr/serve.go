@@ -0,0 +1,763 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/acl"
+	"github.com/interhack86/bashlog/internal/remote"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/websocket"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// streamPingInterval is how often an idle stream checks its client is
+// still there
+const streamPingInterval = 30 * time.Second
+
+// defaultListen keeps the API on this machine unless asked otherwise
+const defaultListen = "127.0.0.1:8750"
+
+// Page sizes for list and search endpoints
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// streamFlushEvery is how many records are sent between flushes, so
+// clients start receiving a large page before it is complete
+const streamFlushEvery = 50
+
+// apiTokenPrefix starts the settings naming the tokens the API accepts, as
+// api.token.<name>=<token>
+const apiTokenPrefix = "api.token."
+
+// apiServer answers the REST API over the workspaces, which is read-only
+// but for recorders posting the commands of their sessions and reviewers
+// commenting on them. A workspace with an access control list is open
+// only to the tokens it names, for what their roles allow
+type apiServer struct {
+	basePath string
+	// tokens maps each accepted bearer token to its name, and limiters
+	// each name to the limits its requests are held to
+	tokens   map[string]string
+	limiters map[string]*tokenLimiter
+	// sso signs people in with an OpenID Connect provider, if set up
+	sso *sso
+}
+
+// limiterKey holds the request's tokenLimiter in its context
+type limiterKey struct{}
+
+// tokenNameKey holds the name of the request's token in its context
+type tokenNameKey struct{}
+
+// principalsKey holds the names the request holds roles as in its context
+type principalsKey struct{}
+
+// releaseKey holds the func that gives back the request's slot of its
+// token's concurrent requests, which may be called more than once
+type releaseKey struct{}
+
+// tokenName returns the name of the token r was made with, which is who
+// the API takes the request to be from. For someone signed in with the
+// provider it is the name the provider knows them by
+func tokenName(r *http.Request) string {
+	name, _ := r.Context().Value(tokenNameKey{}).(string)
+	return name
+}
+
+// principalsOf returns who r was made as, for workspace access control
+// lists: the token's name, or someone signed in's own and those their
+// claims map to, each named with its kind
+func principalsOf(r *http.Request) []string {
+	if principals, ok := r.Context().Value(principalsKey{}).([]string); ok {
+		return principals
+	}
+	return []string{acl.TokenKind + tokenName(r)}
+}
+
+// allowed reports whether r may do p with the workspace at wsPath, as its
+// access control list says, answering 403 if not
+func allowed(w http.ResponseWriter, r *http.Request, wsPath, name string, p acl.Permission) bool {
+	if acl.Load(wsPath).Allows(p, principalsOf(r)...) {
+		return true
+	}
+	apiError(w, http.StatusForbidden, "'%s' has no %s access to workspace '%s'", tokenName(r), p, name)
+	return false
+}
+
+// limitsOf returns the limits of the token r was made with
+func limitsOf(r *http.Request) apiLimits {
+	if l, ok := r.Context().Value(limiterKey{}).(*tokenLimiter); ok {
+		return l.limits
+	}
+	return readAPILimits(nil, "")
+}
+
+// apiWorkspace is a workspace as the API lists it
+type apiWorkspace struct {
+	Name     string    `json:"name"`
+	Root     string    `json:"root"`
+	Created  time.Time `json:"created"`
+	Commands int       `json:"commands"`
+	ReadOnly bool      `json:"read_only,omitempty"`
+	// Access is what the token may do with it, and ACL who else may, for
+	// those allowed to see it
+	Access []acl.Permission `json:"access"`
+	ACL    acl.List         `json:"acl,omitempty"`
+}
+
+// apiCommand is a recorded command. N is its position in the workspace
+// history, as history numbers it
+type apiCommand struct {
+	Workspace string `json:"workspace"`
+	N         int    `json:"n"`
+	Time      string `json:"time,omitempty"`
+	Command   string `json:"command"`
+}
+
+func newAPICommand(name string, n int, e workspace.Entry) apiCommand {
+	c := apiCommand{Workspace: name, N: n, Command: redactRead(e.Command)}
+	if !e.Time.IsZero() {
+		c.Time = e.Time.UTC().Format(time.RFC3339)
+	}
+	return c
+}
+
+// apiCursor is where a page left off: the workspace, the byte offset in
+// its history and the number of the last command read. Clients get it
+// encoded and opaque
+type apiCursor struct {
+	Workspace string `json:"w,omitempty"`
+	Offset    int64  `json:"o,omitempty"`
+	N         int    `json:"n,omitempty"`
+}
+
+func (c apiCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (apiCursor, error) {
+	var c apiCursor
+	if s == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Offset < 0 || c.N < 0 {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// handleServe runs the REST API until interrupted
+func handleServe(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", defaultListen, "Address to listen on")
+	certFile := fs.String("tls-cert", "", "Serve HTTPS with this certificate")
+	keyFile := fs.String("tls-key", "", "Private key for --tls-cert")
+	fs.Parse(args)
+
+	if (*certFile == "") != (*keyFile == "") {
+		fail(exitUsage, "--tls-cert and --tls-key go together")
+	}
+
+	s := &apiServer{basePath: basePath, tokens: make(map[string]string), limiters: make(map[string]*tokenLimiter)}
+	settings := workspace.ReadConfig(settingsPath)
+	for key, value := range settings {
+		if name, ok := strings.CutPrefix(key, apiTokenPrefix); ok && name != "" && value != "" {
+			s.tokens[value] = name
+			s.limiters[name] = newTokenLimiter(readAPILimits(settings, name))
+		}
+	}
+	var err error
+	if s.sso, err = newSSO(settings); err != nil {
+		fail(exitFailure, "could not set up sign-in: %v (in %s)", err, settingsPath)
+	}
+	if len(s.tokens) == 0 && s.sso == nil {
+		fail(exitFailure, "no API tokens set. Add %s<name>=<secret> lines to %s, or %s and the other oidc settings", apiTokenPrefix, settingsPath, ssoIssuerSetting)
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	scheme := "http"
+	if *certFile != "" {
+		scheme = "https"
+	}
+	fmt.Fprintf(os.Stderr, "Serving the bashlog API on %s://%s (Ctrl-C to stop)\n", scheme, *listen)
+	if s.sso != nil {
+		fmt.Fprintf(os.Stderr, "Signing in with %s\n", s.sso.provider.Issuer)
+	}
+
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fail(exitFailure, "could not serve: %v", err)
+	}
+}
+
+// routes serves the API and streams to token holders and those signed in,
+// and the web UI, which fetches everything it shows from the API, and the
+// sign-in pages to anyone
+func (s *apiServer) routes() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/api/v1/workspaces", s.listWorkspaces)
+	api.HandleFunc("/api/v1/workspaces/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/commands"):
+			s.receiveCommands(w, r)
+		case strings.HasSuffix(r.URL.Path, "/comments"):
+			s.workspaceComments(w, r)
+		default:
+			s.workspaceHistory(w, r)
+		}
+	})
+	api.HandleFunc("/api/v1/search", s.search)
+	api.HandleFunc("/ws/workspaces/", s.streamWorkspace)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.authenticate(api))
+	mux.Handle("/ws/", s.authenticate(api))
+	mux.HandleFunc("/", serveWebUI)
+	if s.sso != nil {
+		mux.Handle("/auth/", s.sso.routes())
+	} else {
+		mux.HandleFunc("/auth/session", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintln(w, `{"sso":false}`)
+		})
+	}
+	return mux
+}
+
+// authenticate lets through requests bearing one of the configured tokens,
+// or from someone signed in with the provider, within that token's or
+// person's rate and concurrency limits
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name := ""
+		if ok {
+			for t, n := range s.tokens {
+				if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+					name = n
+				}
+			}
+		}
+		var principals []string
+		limiter := s.limiters[name]
+		if name == "" && s.sso != nil {
+			var cookie bool
+			name, principals, cookie = s.sso.authenticate(r)
+			// WebSocket handshakes are GETs, but can carry the cookie
+			// from any site as well
+			if cookie && (r.Method != http.MethodGet || strings.HasPrefix(r.URL.Path, "/ws/")) && !sameOrigin(r) {
+				apiError(w, http.StatusForbidden, "requests signed in with the web UI's session must come from it")
+				return
+			}
+			if name != "" {
+				limiter = s.sso.limiter(name)
+			}
+		}
+		if name == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bashlog"`)
+			apiError(w, http.StatusUnauthorized, "missing or unknown token")
+			return
+		}
+		posts := strings.HasSuffix(r.URL.Path, "/commands") || strings.HasSuffix(r.URL.Path, "/comments")
+		if r.Method != http.MethodGet && !(r.Method == http.MethodPost && posts) {
+			apiError(w, http.StatusMethodNotAllowed, "only GET is supported, and POST to a workspace's commands and comments")
+			return
+		}
+
+		if ok, wait := limiter.acquire(time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			apiError(w, http.StatusTooManyRequests, "rate limit exceeded for token '%s', retry in %s", name, wait.Round(time.Millisecond))
+			return
+		}
+		release := sync.OnceFunc(limiter.release)
+		defer release()
+
+		slog.Debug("api request", "token", name, "path", r.URL.Path, "query", r.URL.RawQuery)
+		ctx := context.WithValue(context.WithValue(r.Context(), limiterKey{}, limiter), tokenNameKey{}, name)
+		ctx = context.WithValue(ctx, releaseKey{}, release)
+		if principals != nil {
+			ctx = context.WithValue(ctx, principalsKey{}, principals)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func apiError(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// pageSize reads the limit parameter, which can't exceed the token's
+// maximum result size
+func pageSize(r *http.Request) (int, error) {
+	most := limitsOf(r).MaxResults
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return min(defaultPageSize, most), nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > most {
+		return 0, fmt.Errorf("limit must be between 1 and %d", most)
+	}
+	return n, nil
+}
+
+// pageWriter streams a page of records as they are found rather than
+// building it in memory: as a JSON object holding the records under key
+// and the next cursor, or with format=ndjson as one record per line and a
+// last line holding the next cursor. A page is cut short, with a cursor to
+// carry on from, once it grows past the token's byte limit
+type pageWriter struct {
+	w        http.ResponseWriter
+	ndjson   bool
+	count    int
+	limit    int
+	bytes    int64
+	maxBytes int64
+}
+
+func newPageWriter(w http.ResponseWriter, r *http.Request, key string, limit int) *pageWriter {
+	p := &pageWriter{w: w, ndjson: r.URL.Query().Get("format") == "ndjson", limit: limit, maxBytes: limitsOf(r).MaxBytes}
+	if p.ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, "{%q:[", key)
+	}
+	return p
+}
+
+// add sends one record, flushing every streamFlushEvery of them
+func (p *pageWriter) add(v any) {
+	data, _ := json.Marshal(v)
+	p.bytes += int64(len(data)) + 1
+	if !p.ndjson && p.count > 0 {
+		p.w.Write([]byte(","))
+	}
+	p.w.Write(data)
+	if p.ndjson {
+		p.w.Write([]byte("\n"))
+	}
+	p.count++
+	if p.count%streamFlushEvery == 0 {
+		if f, ok := p.w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// full reports whether the page holds as many records, or bytes, as it
+// may
+func (p *pageWriter) full() bool {
+	return p.count >= p.limit || p.bytes >= p.maxBytes
+}
+
+// end finishes the page with the cursor of the next one, "" on the last
+// page. With headers long sent, an error met mid-way is reported in the
+// body
+func (p *pageWriter) end(next string, err error) {
+	tail := map[string]string{}
+	if next != "" {
+		tail["next_cursor"] = next
+	}
+	if err != nil {
+		tail["error"] = err.Error()
+		slog.Warn("api page failed", "err", err)
+	}
+	data, _ := json.Marshal(tail)
+	if p.ndjson {
+		p.w.Write(append(data, '\n'))
+		return
+	}
+	// Splice the tail's fields in after the records
+	fmt.Fprint(p.w, "]")
+	if len(tail) > 0 {
+		fmt.Fprint(p.w, ","+string(data[1:]))
+	} else {
+		fmt.Fprint(p.w, "}")
+	}
+	fmt.Fprint(p.w, "\n")
+}
+
+// listWorkspaces answers GET /api/v1/workspaces, in name order, leaving
+// out those the token has no access to
+func (s *apiServer) listWorkspaces(w http.ResponseWriter, r *http.Request) {
+	limit, err := pageSize(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	cursor, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	workspaces, err := getWorkspaces(s.basePath)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not read workspaces: %v", err)
+		return
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+
+	// The cursor names the last workspace sent, and the next page starts
+	// after it
+	page := newPageWriter(w, r, "workspaces", limit)
+	next, last := "", ""
+	for _, ws := range workspaces {
+		if ws.Name <= cursor.Workspace {
+			continue
+		}
+		list := acl.Load(ws.Path)
+		access := list.Granted(principalsOf(r)...)
+		if len(access) == 0 {
+			continue
+		}
+		if page.full() {
+			next = apiCursor{Workspace: last}.encode()
+			break
+		}
+		aw := apiWorkspace{Name: ws.Name, Root: ws.Root, Created: ws.CreatedAt, Commands: ws.CommandCount, ReadOnly: ws.MountedFrom != "", Access: access}
+		if list.Allows(acl.Inspect, principalsOf(r)...) {
+			aw.ACL = list
+		}
+		page.add(aw)
+		last = ws.Name
+	}
+	page.end(next, nil)
+}
+
+// workspaceHistory answers GET /api/v1/workspaces/{name}/history, oldest
+// command first
+func (s *apiServer) workspaceHistory(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/workspaces/"), "/history")
+	if !ok || !isValidName(name) {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	wsPath := workspacePath(s.basePath, name)
+	if _, err := os.Stat(wsPath); err != nil {
+		apiError(w, http.StatusNotFound, "workspace '%s' not found", name)
+		return
+	}
+	if !allowed(w, r, wsPath, name, acl.Read) {
+		return
+	}
+	limit, err := pageSize(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	cursor, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil || (cursor.Workspace != "" && cursor.Workspace != name) {
+		apiError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	historyPath := filepath.Join(wsPath, "history.log")
+	if info, err := os.Stat(historyPath); err == nil && info.Size() < cursor.Offset {
+		apiError(w, http.StatusGone, "history has been rewritten since the cursor was issued, start over")
+		return
+	}
+
+	page := newPageWriter(w, r, "commands", limit)
+	n, next := cursor.N, ""
+	err = scanCommands(wsPath, cursor, func(e workspace.Entry, offset int64) bool {
+		if r.Context().Err() != nil {
+			return false
+		}
+		n++
+		page.add(newAPICommand(name, n, e))
+		if page.full() {
+			next = apiCursor{Workspace: name, Offset: offset, N: n}.encode()
+			return false
+		}
+		return true
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	page.end(next, err)
+}
+
+// scanCommands calls fn with the commands of the workspace at wsPath from
+// cursor on, each with the offset to resume past it from, until fn returns
+// false. History files are paged by byte offset, so a page costs the same
+// however deep it is; other storage by the number of commands before it
+func scanCommands(wsPath string, cursor apiCursor, fn func(e workspace.Entry, offset int64) bool) error {
+	b := storage.For(wsPath)
+	if b.Name() == storage.Files {
+		return workspace.ScanHistory(filepath.Join(wsPath, workspace.HistoryFile), cursor.Offset, fn)
+	}
+	n := 0
+	return b.Iterate(wsPath, func(e workspace.Entry) bool {
+		n++
+		return n <= cursor.N || fn(e, 0)
+	})
+}
+
+// receiveCommands answers POST /api/v1/workspaces/{name}/commands, taking
+// a batch of commands from a recorder shipping its sessions here. A batch
+// received before is acknowledged without being recorded again
+func (s *apiServer) receiveCommands(w http.ResponseWriter, r *http.Request) {
+	name, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/workspaces/"), "/commands")
+	if r.Method != http.MethodPost {
+		apiError(w, http.StatusMethodNotAllowed, "commands are posted")
+		return
+	}
+	if !isValidName(name) {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	wsPath := workspacePath(s.basePath, name)
+	if _, err := os.Stat(filepath.Join(wsPath, workspace.ConfigFile)); err != nil {
+		apiError(w, http.StatusNotFound, "workspace '%s' not found", name)
+		return
+	}
+	if !allowed(w, r, wsPath, name, acl.Append) {
+		return
+	}
+	if workspace.IsMounted(wsPath) {
+		apiError(w, http.StatusConflict, "workspace '%s' is mounted read-only", name)
+		return
+	}
+
+	var batch remote.Batch
+	body := http.MaxBytesReader(w, r.Body, limitsOf(r).MaxBytes)
+	if err := json.NewDecoder(body).Decode(&batch); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid batch: %v", err)
+		return
+	}
+	if strings.ContainsAny(batch.ID, "\r\n") || strings.ContainsAny(batch.Host, "\r\n") {
+		apiError(w, http.StatusBadRequest, "invalid batch: id and host must be one line")
+		return
+	}
+	if batch.Origin != "" {
+		if _, err := workspace.ParseOrigin(batch.Origin); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid batch: %v", err)
+			return
+		}
+	}
+	for _, c := range batch.Commands {
+		if strings.TrimSpace(c.Command) == "" {
+			apiError(w, http.StatusBadRequest, "invalid batch: empty command")
+			return
+		}
+	}
+
+	n, err := remote.Receive(wsPath, batch)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not record commands: %v", err)
+		return
+	}
+	slog.Info("received commands", "workspace", name, "batch", batch.ID, "host", batch.Host, "commands", n)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"appended": n})
+}
+
+// search answers GET /api/v1/search?q=text, scanning the workspaces
+// matching the workspace parameter that the token may read, in name order
+// and each history oldest first. With i=1 the match ignores case
+func (s *apiServer) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		apiError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	ignoreCase := query.Get("i") == "1" || query.Get("i") == "true"
+	if ignoreCase {
+		q = strings.ToLower(q)
+	}
+	pattern := query.Get("workspace")
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid workspace pattern '%s'", pattern)
+		return
+	}
+	limit, err := pageSize(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	cursor, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	workspaces, err := getWorkspaces(s.basePath)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "could not read workspaces: %v", err)
+		return
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+
+	page := newPageWriter(w, r, "commands", limit)
+	next := ""
+	for _, ws := range workspaces {
+		if next != "" {
+			break
+		}
+		if ws.Name < cursor.Workspace {
+			continue
+		}
+		if ok, _ := path.Match(pattern, ws.Name); !ok || !acl.Load(ws.Path).Allows(acl.Read, principalsOf(r)...) {
+			continue
+		}
+		offset, n := int64(0), 0
+		if ws.Name == cursor.Workspace {
+			offset, n = cursor.Offset, cursor.N
+		}
+
+		err = scanCommands(ws.Path, apiCursor{Offset: offset, N: n}, func(e workspace.Entry, offset int64) bool {
+			if r.Context().Err() != nil {
+				return false
+			}
+			n++
+			cmd := redactRead(e.Command)
+			if ignoreCase {
+				cmd = strings.ToLower(cmd)
+			}
+			if !strings.Contains(cmd, q) {
+				return true
+			}
+			page.add(newAPICommand(ws.Name, n, e))
+			if page.full() {
+				next = apiCursor{Workspace: ws.Name, Offset: offset, N: n}.encode()
+				return false
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			break
+		}
+		err = nil
+		if r.Context().Err() != nil {
+			return
+		}
+	}
+	page.end(next, err)
+}
+
+// streamWorkspace answers GET /ws/workspaces/{name}/stream, a WebSocket
+// over which each command recorded into the workspace is pushed as it
+// arrives, as a JSON message, after the last backlog commands
+func (s *apiServer) streamWorkspace(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/ws/workspaces/"), "/stream")
+	if !ok || !isValidName(name) {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	wsPath := workspacePath(s.basePath, name)
+	if _, err := os.Stat(wsPath); err != nil {
+		apiError(w, http.StatusNotFound, "workspace '%s' not found", name)
+		return
+	}
+	if !allowed(w, r, wsPath, name, acl.Read) {
+		return
+	}
+	if b := storage.For(wsPath); b.Name() != storage.Files {
+		apiError(w, http.StatusConflict, "workspace '%s' keeps its commands in %s, and only history files can be streamed", name, b.Name())
+		return
+	}
+	backlog := 0
+	if v := r.URL.Query().Get("backlog"); v != "" {
+		n, err := strconv.Atoi(v)
+		if most := limitsOf(r).MaxResults; err != nil || n < 0 || n > most {
+			apiError(w, http.StatusBadRequest, "backlog must be between 0 and %d", most)
+			return
+		}
+		backlog = n
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		slog.Debug("websocket upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+	// A stream can stay open for days, and holding its slot that long
+	// would starve the token's other requests
+	if release, ok := r.Context().Value(releaseKey{}).(func()); ok {
+		release()
+	}
+
+	// The client only ever closes or answers pings, and reading is how
+	// either is noticed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(streamPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if conn.Ping() != nil {
+					cancel()
+				}
+			}
+		}
+	}()
+
+	err = followHistory(ctx, filepath.Join(wsPath, "history.log"), backlog, func(n int, e workspace.Entry) error {
+		data, _ := json.Marshal(newAPICommand(name, n, e))
+		return conn.WriteText(data)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Debug("workspace stream ended", "workspace", name, "err", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+const sessionsUsage = "bashlog-mgr sessions [name] [--egress] [--terminal] [--summary] [--clock]"
+
+// escalationMatch is how soon after an escalation was noted the child
+// session it started is expected to have begun
+const escalationMatch = time.Minute
+
+// handleSessions lists recorded sessions, or those of the trees that
+// recorded into the named workspace, showing which session each was
+// started from and the privileged shells started with sudo or su. With
+// --egress, the outbound connections of sessions recorded with bashlog
+// --egress are listed under them, and with --terminal the terminal each
+// ran in, with when it was resized and retitled. --summary shows the
+// summary printed when each session ended, and --clock the state of the
+// clock each was recorded by, with its commands timed by the monotonic
+// clock
+func handleSessions(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("sessions", flag.ExitOnError)
+	var details sessionDetails
+	fs.BoolVar(&details.egress, "egress", false, "List the outbound connections each session's commands made, for sessions recorded with bashlog --egress")
+	fs.BoolVar(&details.summary, "summary", false, "Show the summary printed when each session ended")
+	fs.BoolVar(&details.terminal, "terminal", false, "List the terminal each session ran in, and its resizes and window titles (titles are seen in --pty sessions only)")
+	fs.BoolVar(&details.clock, "clock", false, "Show how each session's clock was kept, and its commands by when they ran into it and for how long, as the monotonic clock measured")
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		failUsage(sessionsUsage, "at most one workspace name expected")
+	}
+	name := ""
+	if len(positional) == 1 {
+		name = positional[0]
+		requireWorkspace(basePath, name)
+	}
+
+	metas, err := session.ListMeta(logsPath)
+	if err != nil {
+		fail(exitFailure, "could not read sessions: %v", err)
+	}
+	printLineage(metas, name, details)
+}
+
+// sessionDetails are what is listed under each session besides its row
+type sessionDetails struct {
+	egress   bool
+	terminal bool
+	summary  bool
+	clock    bool
+}
+
+// printLineage prints sessions as trees of the sessions started from them,
+// keeping only the trees with a session recorded into workspace when one
+// is named, with the details asked for under each
+func printLineage(metas []*session.Meta, workspace string, details sessionDetails) {
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Started.Before(metas[j].Started) })
+	byID := make(map[string]*session.Meta, len(metas))
+	for _, m := range metas {
+		byID[m.SessionID] = m
+	}
+	children := make(map[string][]*session.Meta)
+	var roots []*session.Meta
+	for _, m := range metas {
+		if _, ok := byID[m.ParentSessionID]; ok && m.ParentSessionID != m.SessionID {
+			children[m.ParentSessionID] = append(children[m.ParentSessionID], m)
+		} else {
+			roots = append(roots, m)
+		}
+	}
+
+	var inWorkspace func(m *session.Meta) bool
+	inWorkspace = func(m *session.Meta) bool {
+		if m.Workspace == workspace {
+			return true
+		}
+		for _, c := range children[m.SessionID] {
+			if inWorkspace(c) {
+				return true
+			}
+		}
+		return false
+	}
+	if workspace != "" {
+		kept := roots[:0]
+		for _, m := range roots {
+			if inWorkspace(m) {
+				kept = append(kept, m)
+			}
+		}
+		roots = kept
+	}
+
+	if len(roots) == 0 {
+		if workspace != "" {
+			fmt.Printf("No sessions recorded into workspace '%s'\n", workspace)
+		} else {
+			fmt.Println("No sessions recorded")
+		}
+		return
+	}
+
+	fmt.Printf("%-40s %-10s %-6s %-9s %-14s %s\n", "SESSION", "USER", "SHELL", "DURATION", "WORKSPACE", "STARTED WITH")
+	fmt.Println(strings.Repeat("-", 100))
+	var printTree func(m *session.Meta, indent string)
+	printTree = func(m *session.Meta, indent string) {
+		printLineageRow(m, indent, byID)
+		below := "└ "
+		if indent != "" {
+			below = "  " + indent
+		}
+		printSessionDetails(m, strings.Repeat(" ", len([]rune(indent)))+"  ", details)
+		for _, c := range children[m.SessionID] {
+			printTree(c, below)
+		}
+		escalations, _ := m.Escalations()
+		for _, e := range escalations {
+			if !escalationRecorded(e, children[m.SessionID]) {
+				fmt.Printf("%-40s %-10s %-6s %-9s %-14s %s, recorded in %s's logs\n", below+"escalated at "+e.Time.Format("15:04:05"), e.User, "-", "-", "-", e.Method, e.User)
+			}
+		}
+	}
+	for _, m := range roots {
+		printTree(m, "")
+	}
+}
+
+// printLineageRow prints one session of a tree. A session started from
+// one that isn't listed, such as a root shell whose parent is in another
+// user's logs, names where it came from
+func printLineageRow(m *session.Meta, indent string, byID map[string]*session.Meta) {
+	duration := "running"
+	if m.Finished() {
+		duration = formatDuration(m.Duration)
+	}
+	user, ws := m.User, m.Workspace
+	if user == "" {
+		user = "-"
+	}
+	if ws == "" {
+		ws = "-"
+	}
+	origin := m.Escalation
+	if _, ok := byID[m.ParentSessionID]; m.ParentSessionID != "" && !ok {
+		from := "from " + m.ParentSessionID
+		if m.EscalatedFrom != "" {
+			from = "by " + m.EscalatedFrom + " " + from
+		}
+		origin = strings.TrimSpace(origin + " " + from)
+	}
+	if origin == "" {
+		origin = "-"
+	}
+	fmt.Printf("%-40s %-10s %-6s %-9s %-14s %s\n", indent+m.Name(), user, m.Shell, duration, ws, origin)
+}
+
+// printSessionDetails prints the details asked for of a session under its
+// row
+func printSessionDetails(m *session.Meta, indent string, details sessionDetails) {
+	if details.terminal {
+		if t := m.Terminal.String(); t != "" {
+			fmt.Printf("%sterminal: %s\n", indent, t)
+		}
+		events, _ := m.TerminalEvents()
+		for _, e := range events {
+			switch e.Kind {
+			case session.TerminalResized:
+				fmt.Printf("%s%s resized to %s\n", indent, e.Time.Local().Format("15:04:05"), e.Value)
+			case session.TerminalTitle:
+				fmt.Printf("%s%s titled %q\n", indent, e.Time.Local().Format("15:04:05"), e.Value)
+			}
+		}
+	}
+	if details.summary {
+		if summary, ok := m.Summary(); ok {
+			for _, line := range strings.Split(strings.TrimRight(summary, "\n"), "\n") {
+				fmt.Printf("%s%s\n", indent, line)
+			}
+		}
+	}
+	if details.egress {
+		for _, c := range m.Egress {
+			fmt.Printf("%s→ %s\n", indent, c)
+		}
+	}
+	if details.clock {
+		printSessionClock(m, indent)
+	}
+}
+
+// clockDisagrees is how far a command's recorded time may be from the time
+// the monotonic clock puts it at before the difference is pointed out
+const clockDisagrees = 2 * time.Second
+
+// printSessionClock prints the clock a session was recorded by and each
+// of its commands the hooks timed, by how far into the session it began
+// and how long it ran. Where the wall clock jumped, the time a command was
+// recorded at is shown next to the time it really started
+func printSessionClock(m *session.Meta, indent string) {
+	fmt.Printf("%sclock: %s\n", indent, m.Clock)
+	entries, _ := m.Commands()
+	statuses, _ := session.ReadStatuses(m.HistoryFile())
+	for i, s := range session.MatchStatuses(entries, statuses) {
+		if s == nil {
+			continue
+		}
+		offset, ok := s.Offset(m)
+		if !ok {
+			continue
+		}
+		took := "-"
+		if elapsed, ok := s.Elapsed(); ok {
+			took = formatElapsed(elapsed)
+		}
+		at := m.Started.Add(offset)
+		line := fmt.Sprintf("%s+%s %s %8s  %s", indent, formatOffset(offset), at.Local().Format("15:04:05"), took, redactRead(entries[i].Command))
+		if diff := entries[i].Time.Sub(at); diff >= clockDisagrees || diff <= -clockDisagrees {
+			line += fmt.Sprintf("  (recorded at %s)", entries[i].Time.Local().Format("15:04:05"))
+		}
+		fmt.Println(line)
+	}
+}
+
+// formatOffset shows how far into a session something happened, as
+// h:mm:ss
+func formatOffset(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// formatElapsed shows how long a command ran, to a tenth of a second
+// under a minute
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return formatDuration(d)
+}
+
+// escalationRecorded reports whether one of the sessions started from a
+// session is the privileged shell e noted, so it isn't listed twice
+func escalationRecorded(e session.Escalation, children []*session.Meta) bool {
+	for _, c := range children {
+		if c.Escalation == e.Method && !c.Started.Before(e.Time.Add(-time.Second)) && c.Started.Sub(e.Time) < escalationMatch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/category"
+	"github.com/interhack86/bashlog/internal/risk"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// handleShow displays one recorded command, or with --output what it
+// printed
+func handleShow(basePath string, args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	output := fs.Bool("output", false, "Print the command's recorded output instead of its details")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 2 {
+		failUsage("bashlog-mgr show <name> <n> [--output]", "workspace name and command number required")
+	}
+	name := positional[0]
+	wsPath := workspacePath(basePath, name)
+
+	entry, n, err := commandRef(basePath, name, positional[1])
+	if err != nil {
+		fail(exitCodeFor(err), "%v", err)
+	}
+	outputs, err := workspace.ReadOutputs(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read recorded output: %v", err)
+	}
+	printed, captured := outputs.Of(entry)
+
+	if *output {
+		if !captured {
+			fail(exitNotFound, "no output was recorded for command %d (only sessions run with bashlog --pty capture it)", n)
+		}
+		if printed != "" {
+			fmt.Println(redactRead(printed))
+		}
+		return
+	}
+
+	tags, err := workspace.ReadTags(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read tags: %v", err)
+	}
+	hosts, err := workspace.ReadHosts(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read hosts: %v", err)
+	}
+	origins, err := workspace.ReadOrigins(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read origins: %v", err)
+	}
+
+	fmt.Printf("\n=== Command %d in %s ===\n", n, name)
+	if !entry.Time.IsZero() {
+		fmt.Printf("Time: %s\n", entry.Time.Format("2006-01-02 15:04:05"))
+	}
+	if host := hosts.Of(entry); host != "" {
+		fmt.Printf("Host: %s\n", host)
+	}
+	fmt.Printf("Origin: %s\n", origins.Of(entry))
+	// Exit status, duration and source are kept in v2 records only
+	if records, err := storage.ReadRecords(wsPath); err == nil && n <= len(records) {
+		r := records[n-1]
+		switch {
+		case r.Source != "" && r.Func != "" && r.Func != "source":
+			fmt.Printf("Source: %s (in %s)\n", r.Source, r.Func)
+		case r.Source != "":
+			fmt.Printf("Source: %s\n", r.Source)
+		}
+		if r.HasExit {
+			fmt.Printf("Exit: %d\n", r.Exit)
+		}
+		if r.HasDuration {
+			fmt.Printf("Duration: %s\n", formatDuration(r.Duration))
+		}
+	}
+	fmt.Printf("Category: %s\n", category.Primary(entry.Command))
+	if t := tags.Of(entry); len(t) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(t, ", "))
+	}
+	if level, reasons := risk.Score(entry.Command); level > risk.None {
+		fmt.Printf("Risk: %s\n", riskSummary(reasons, level))
+	}
+	switch {
+	case !captured:
+		fmt.Printf("Output: not recorded\n")
+	case printed == "":
+		fmt.Printf("Output: none\n")
+	case !strings.Contains(printed, "\n"):
+		fmt.Printf("Output: 1 line (bashlog-mgr show %s %d --output)\n", name, n)
+	default:
+		fmt.Printf("Output: %d lines (bashlog-mgr show %s %d --output)\n", strings.Count(printed, "\n")+1, name, n)
+	}
+
+	fmt.Printf("\n")
+	for _, line := range strings.Split(redactRead(entry.Command), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+}
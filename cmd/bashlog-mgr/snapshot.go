@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// snapshotDir holds a workspace's snapshots, one directory each
+const snapshotDir = ".snapshots"
+
+// currentSnapshot names the live workspace history in snapshot diffs
+const currentSnapshot = "current"
+
+// Snapshot is a point-in-time copy of a workspace's history
+type Snapshot struct {
+	Name         string
+	CreatedAt    time.Time
+	CommandCount int
+	Path         string
+}
+
+// handleSnapshot creates a named snapshot of a workspace, or with "diff"
+// compares two snapshots
+func handleSnapshot(basePath string, args []string) {
+	if len(args) > 0 && args[0] == "diff" {
+		handleSnapshotDiff(basePath, args[1:])
+		return
+	}
+
+	if len(args) == 0 {
+		failUsage("bashlog-mgr snapshot <name> [snapshot-name]", "workspace name required")
+	}
+
+	wsPath := requireWorkspace(basePath, args[0])
+
+	now := time.Now()
+	snapName := now.Format("20060102-150405")
+	if len(args) > 1 {
+		snapName = args[1]
+	}
+	if !isValidName(snapName) || snapName == currentSnapshot {
+		fail(exitUsage, "invalid snapshot name '%s'", snapName)
+	}
+
+	snapPath := filepath.Join(wsPath, snapshotDir, snapName)
+	if _, err := os.Stat(snapPath); err == nil {
+		fail(exitConflict, "snapshot '%s' already exists", snapName)
+	}
+
+	count, err := createSnapshot(wsPath, snapPath, now)
+	if err != nil {
+		os.RemoveAll(snapPath)
+		fail(exitFailure, "could not create snapshot: %v", err)
+	}
+
+	fmt.Printf("✓ Snapshot '%s' of workspace '%s' created (%d commands)\n", snapName, args[0], count)
+}
+
+// createSnapshot writes the workspace history into snapPath, as a history
+// file whatever the workspace's storage, under the workspace lock and
+// records when it was taken
+func createSnapshot(wsPath, snapPath string, now time.Time) (int, error) {
+	lock, err := workspace.RLockWorkspace(wsPath)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+
+	mode := workspace.FileMode(wsPath)
+	if err := mode.MkdirAll(snapPath); err != nil {
+		return 0, err
+	}
+	entries, err := storage.Read(wsPath)
+	if err != nil {
+		return 0, err
+	}
+	var history bytes.Buffer
+	if err := workspace.WriteHistory(&history, entries); err != nil {
+		return 0, err
+	}
+	if err := mode.WriteFile(filepath.Join(snapPath, "history.log"), history.Bytes()); err != nil {
+		return 0, err
+	}
+
+	config := fmt.Sprintf("created=%s\ncommands=%d\n", now.Format(time.RFC3339Nano), len(entries))
+	return len(entries), mode.WriteFile(filepath.Join(snapPath, configFile), []byte(config))
+}
+
+// handleSnapshots lists the snapshots of a workspace
+func handleSnapshots(basePath string, args []string) {
+	if len(args) > 0 && args[0] == "list" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		failUsage("bashlog-mgr snapshots list <name>", "workspace name required")
+	}
+
+	wsPath := requireWorkspace(basePath, args[0])
+	snapshots, err := getSnapshots(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read snapshots: %v", err)
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Printf("No snapshots of '%s'. Create one with: bashlog-mgr snapshot %s <snapshot-name>\n", args[0], args[0])
+		return
+	}
+
+	fmt.Printf("%-20s %-19s %s\n", "NAME", "CREATED", "COMMANDS")
+	fmt.Println(strings.Repeat("-", 50))
+	for _, s := range snapshots {
+		fmt.Printf("%-20s %-19s %d\n", s.Name, s.CreatedAt.Format("2006-01-02 15:04:05"), s.CommandCount)
+	}
+}
+
+// handleSnapshotDiff shows the commands added and removed between two
+// snapshots; "current" stands for the live history
+func handleSnapshotDiff(basePath string, args []string) {
+	if len(args) < 2 {
+		failUsage("bashlog-mgr snapshot diff <name> <a> [b|current]", "workspace and snapshot names required")
+	}
+
+	wsPath := requireWorkspace(basePath, args[0])
+	from, to := args[1], currentSnapshot
+	if len(args) > 2 {
+		to = args[2]
+	}
+
+	a, err := readSnapshotHistory(wsPath, from)
+	if err != nil {
+		fail(exitCodeFor(err), "could not read snapshot '%s': %v", from, err)
+	}
+	b, err := readSnapshotHistory(wsPath, to)
+	if err != nil {
+		fail(exitCodeFor(err), "could not read snapshot '%s': %v", to, err)
+	}
+
+	added, removed := workspace.Diff(a, b)
+	fmt.Printf("=== %s: %s..%s ===\n", args[0], from, to)
+	for _, e := range removed {
+		fmt.Printf("- %s\n", redactRead(e.Command))
+	}
+	for _, e := range added {
+		fmt.Printf("+ %s\n", redactRead(e.Command))
+	}
+	fmt.Printf("\n%d added, %d removed\n", len(added), len(removed))
+}
+
+// readSnapshotHistory reads the history of a snapshot, or the live history
+// for "current"
+func readSnapshotHistory(wsPath, name string) ([]workspace.Entry, error) {
+	if name == currentSnapshot {
+		return storage.Read(wsPath)
+	}
+	if !isValidName(name) {
+		return nil, fmt.Errorf("invalid snapshot name")
+	}
+	entries, err := workspace.ReadHistory(filepath.Join(wsPath, snapshotDir, name, "history.log"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %w", errNotFound)
+	}
+	return entries, err
+}
+
+// getSnapshots returns a workspace's snapshots, oldest first
+func getSnapshots(wsPath string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(filepath.Join(wsPath, snapshotDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapPath := filepath.Join(wsPath, snapshotDir, entry.Name())
+		config := workspace.ReadConfig(filepath.Join(snapPath, configFile))
+
+		createdTime, _ := time.Parse(time.RFC3339, config["created"])
+		commandCount := 0
+		fmt.Sscanf(config["commands"], "%d", &commandCount)
+
+		snapshots = append(snapshots, Snapshot{
+			Name:         entry.Name(),
+			CreatedAt:    createdTime,
+			CommandCount: commandCount,
+			Path:         snapPath,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/storage"
+)
+
+// activityDays is the window shown by activity sparklines
+const activityDays = 30
+
+// defaultIdleAfter is the gap between commands after which time counts as
+// idle, unless stats is given another with --idle
+const defaultIdleAfter = 30 * time.Minute
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders counts as one block per value, scaled to the largest,
+// with idle days shown as dots so gaps stand out
+func sparkline(counts []int) string {
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	var b strings.Builder
+	for _, c := range counts {
+		if c == 0 {
+			b.WriteRune('·')
+			continue
+		}
+		b.WriteRune(sparkBlocks[(c*len(sparkBlocks)-1)/max])
+	}
+	return b.String()
+}
+
+// workspaceActivity returns the sparkline of commands per day over the
+// last activityDays days
+func workspaceActivity(wsPath string, now time.Time) string {
+	stats, err := storage.For(wsPath).Stats(wsPath, defaultIdleAfter)
+	if err != nil {
+		return strings.Repeat("?", activityDays)
+	}
+	return sparkline(stats.DailyCounts(now, activityDays))
+}
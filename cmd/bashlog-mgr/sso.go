@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/acl"
+	"github.com/interhack86/bashlog/internal/oidc"
+)
+
+// Settings of ~/.bashlog/config.txt signing people in to serve with an
+// OpenID Connect provider
+const (
+	ssoIssuerSetting   = "oidc.issuer"
+	ssoClientSetting   = "oidc.client_id"
+	ssoSecretSetting   = "oidc.client_secret"
+	ssoRedirectSetting = "oidc.redirect_url"
+	ssoScopesSetting   = "oidc.scopes"
+	ssoUserSetting     = "oidc.username_claim"
+	ssoSessionSetting  = "oidc.session"
+	// ssoRolePrefix starts the settings mapping claims to the names access
+	// lists grant roles to, as oidc.role.<name>=<claim>:<value>,...
+	ssoRolePrefix = "oidc.role."
+)
+
+// Cookies the web UI is signed in with
+const (
+	ssoSessionCookie = "bashlog_session"
+	ssoLoginCookie   = "bashlog_login"
+)
+
+const (
+	defaultSSOScopes  = "openid email profile"
+	defaultSSOUser    = "email"
+	defaultSSOSession = 8 * time.Hour
+	// ssoLoginTimeout is how long a login may take at the provider
+	ssoLoginTimeout = 10 * time.Minute
+)
+
+// ssoRole is a name granted to those whose claim holds value
+type ssoRole struct {
+	name  string
+	claim string
+	value string
+}
+
+// ssoSession is someone signed in to the web UI
+type ssoSession struct {
+	user       string
+	principals []string
+	expires    time.Time
+}
+
+// ssoLogin is a login waiting for the provider to send the browser back
+type ssoLogin struct {
+	oidc.Login
+	redirectURL string
+	expires     time.Time
+}
+
+// sso signs people in to serve with an OpenID Connect provider: browsers
+// through its login page, scripts with the ID tokens it issued them as
+// bearer tokens. Their claims are mapped to names that access lists grant
+// roles to, as they do to token names
+type sso struct {
+	provider    *oidc.Provider
+	redirectURL string
+	userClaim   string
+	roles       []ssoRole
+	lifetime    time.Duration
+	settings    map[string]string
+
+	mu       sync.Mutex
+	sessions map[string]ssoSession
+	logins   map[string]ssoLogin
+	limiters map[string]*tokenLimiter
+}
+
+// newSSO returns the sign-in settings configure, nil if they set no
+// issuer
+func newSSO(settings map[string]string) (*sso, error) {
+	issuer := settings[ssoIssuerSetting]
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := settings[ssoClientSetting]
+	if clientID == "" {
+		return nil, fmt.Errorf("%s needs %s", ssoIssuerSetting, ssoClientSetting)
+	}
+
+	s := &sso{
+		redirectURL: settings[ssoRedirectSetting],
+		userClaim:   settings[ssoUserSetting],
+		lifetime:    defaultSSOSession,
+		settings:    settings,
+		sessions:    make(map[string]ssoSession),
+		logins:      make(map[string]ssoLogin),
+		limiters:    make(map[string]*tokenLimiter),
+	}
+	if s.userClaim == "" {
+		s.userClaim = defaultSSOUser
+	}
+	if v := settings[ssoSessionSetting]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: invalid duration %q", ssoSessionSetting, v)
+		}
+		s.lifetime = d
+	}
+	for key, value := range settings {
+		name, ok := strings.CutPrefix(key, ssoRolePrefix)
+		if !ok {
+			continue
+		}
+		if !isValidName(name) {
+			return nil, fmt.Errorf("%s: invalid name %q", key, name)
+		}
+		for _, match := range strings.Split(value, ",") {
+			claim, want, ok := strings.Cut(strings.TrimSpace(match), ":")
+			if !ok || claim == "" || want == "" {
+				return nil, fmt.Errorf("%s: want <claim>:<value>, not %q", key, match)
+			}
+			s.roles = append(s.roles, ssoRole{name: name, claim: claim, value: want})
+		}
+	}
+	// Signing in proves who someone is to the provider, which for Google
+	// is anyone with an account, so only those given a role get in
+	if len(s.roles) == 0 {
+		return nil, fmt.Errorf("%s needs at least one %s<name>=<claim>:<value> setting saying who may sign in", ssoIssuerSetting, ssoRolePrefix)
+	}
+	sort.Slice(s.roles, func(i, j int) bool { return s.roles[i].name < s.roles[j].name })
+
+	scopes := strings.Fields(settings[ssoScopesSetting])
+	if len(scopes) == 0 {
+		scopes = strings.Fields(defaultSSOScopes)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oidc.Timeout)
+	defer cancel()
+	provider, err := oidc.Discover(ctx, issuer, clientID, settings[ssoSecretSetting], scopes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ssoIssuerSetting, err)
+	}
+	s.provider = provider
+	return s, nil
+}
+
+// identify maps claims to who they are and the principals they hold as,
+// their own as a user and those of the roles they are mapped to, refusing
+// those mapped to none
+func (s *sso) identify(claims oidc.Claims) (string, []string, error) {
+	user := ""
+	if values := claims.Values(s.userClaim); len(values) > 0 {
+		user = values[0]
+	}
+	if user == "" {
+		return "", nil, fmt.Errorf("ID token has no %s claim", s.userClaim)
+	}
+	principals := []string{acl.UserKind + user}
+	for _, role := range s.roles {
+		if contains(claims.Values(role.claim), role.value) && !contains(principals, acl.RoleKind+role.name) {
+			principals = append(principals, acl.RoleKind+role.name)
+		}
+	}
+	if len(principals) == 1 {
+		return "", nil, fmt.Errorf("%s has no bashlog role", user)
+	}
+	return user, principals, nil
+}
+
+// authenticate returns who r was made by, from the session cookie of a
+// web UI signed in, or an ID token as bearer token. cookie reports which
+func (s *sso) authenticate(r *http.Request) (user string, principals []string, cookie bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if !oidc.IsToken(token) {
+			return "", nil, false
+		}
+		claims, err := s.provider.Verify(r.Context(), token)
+		if err != nil {
+			slog.Debug("rejected ID token", "err", err)
+			return "", nil, false
+		}
+		user, principals, err := s.identify(claims)
+		if err != nil {
+			slog.Debug("rejected ID token", "err", err)
+			return "", nil, false
+		}
+		return user, principals, false
+	}
+
+	c, err := r.Cookie(ssoSessionCookie)
+	if err != nil {
+		return "", nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[c.Value]
+	if !ok || time.Now().After(session.expires) {
+		delete(s.sessions, c.Value)
+		return "", nil, false
+	}
+	return session.user, session.principals, true
+}
+
+// limiter returns the limits user's requests are held to, as a token of
+// that name's would be
+func (s *sso) limiter(user string) *tokenLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[user]
+	if !ok {
+		l = newTokenLimiter(readAPILimits(s.settings, user))
+		s.limiters[user] = l
+	}
+	return l
+}
+
+// routes serves /auth/: login sends the browser to the provider, callback
+// takes it back, logout ends the session and session says who is signed
+// in
+func (s *sso) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/login", s.login)
+	mux.HandleFunc("/auth/callback", s.callback)
+	mux.HandleFunc("/auth/logout", s.logout)
+	mux.HandleFunc("/auth/session", s.session)
+	return mux
+}
+
+func (s *sso) login(w http.ResponseWriter, r *http.Request) {
+	redirectURL := s.redirectURL
+	if redirectURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		redirectURL = scheme + "://" + r.Host + "/auth/callback"
+	}
+	l := ssoLogin{Login: oidc.NewLogin(), redirectURL: redirectURL, expires: time.Now().Add(ssoLoginTimeout)}
+
+	s.mu.Lock()
+	for state, pending := range s.logins {
+		if time.Now().After(pending.expires) {
+			delete(s.logins, state)
+		}
+	}
+	s.logins[l.State] = l
+	s.mu.Unlock()
+
+	// The cookie ties the login to this browser, so nobody can have
+	// someone else's finish it. Lax lets it through the provider's redirect
+	http.SetCookie(w, &http.Cookie{
+		Name: ssoLoginCookie, Value: l.State, Path: "/auth/", MaxAge: int(ssoLoginTimeout.Seconds()),
+		HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.provider.AuthURL(l.Login, redirectURL), http.StatusFound)
+}
+
+func (s *sso) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		apiError(w, http.StatusUnauthorized, "sign-in failed: %s %s", e, query.Get("error_description"))
+		return
+	}
+	state := query.Get("state")
+	c, err := r.Cookie(ssoLoginCookie)
+	if err != nil || state == "" || c.Value != state {
+		apiError(w, http.StatusBadRequest, "sign-in was not started from this browser, start over")
+		return
+	}
+	s.mu.Lock()
+	l, ok := s.logins[state]
+	delete(s.logins, state)
+	s.mu.Unlock()
+	if !ok || time.Now().After(l.expires) {
+		apiError(w, http.StatusBadRequest, "sign-in took too long, start over")
+		return
+	}
+
+	claims, err := s.provider.Exchange(r.Context(), l.Login, query.Get("code"), l.redirectURL)
+	if err != nil {
+		slog.Info("sign-in failed", "err", err)
+		apiError(w, http.StatusUnauthorized, "sign-in failed: %v", err)
+		return
+	}
+	user, principals, err := s.identify(claims)
+	if err != nil {
+		slog.Info("sign-in refused", "err", err)
+		apiError(w, http.StatusForbidden, "%v", err)
+		return
+	}
+
+	id := oidc.Random()
+	s.mu.Lock()
+	for old, session := range s.sessions {
+		if time.Now().After(session.expires) {
+			delete(s.sessions, old)
+		}
+	}
+	s.sessions[id] = ssoSession{user: user, principals: principals, expires: time.Now().Add(s.lifetime)}
+	s.mu.Unlock()
+	slog.Info("signed in", "user", user, "as", roleNames(principals))
+
+	http.SetCookie(w, &http.Cookie{Name: ssoLoginCookie, Path: "/auth/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name: ssoSessionCookie, Value: id, Path: "/", MaxAge: int(s.lifetime.Seconds()),
+		HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *sso) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !sameOrigin(r) {
+		apiError(w, http.StatusMethodNotAllowed, "sign out is posted from the web UI")
+		return
+	}
+	if c, err := r.Cookie(ssoSessionCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, c.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: ssoSessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *sso) session(w http.ResponseWriter, r *http.Request) {
+	answer := map[string]any{"sso": true}
+	if _, err := r.Cookie(ssoSessionCookie); err == nil {
+		if user, principals, ok := s.authenticate(r); ok {
+			answer["user"], answer["as"] = user, roleNames(principals)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer)
+}
+
+// roleNames returns the names of the roles among principals
+func roleNames(principals []string) []string {
+	var names []string
+	for _, p := range principals {
+		if name, ok := strings.CutPrefix(p, acl.RoleKind); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// sameOrigin reports whether r was sent by a page of this server, as
+// browsers say of the requests they send. Requests made with the session
+// cookie are checked, so other sites can't make them on a user's behalf
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "http://"+r.Host || origin == "https://"+r.Host
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// syncDirKey is the workspace config key remembering its sync directory
+const syncDirKey = "sync_dir"
+
+const syncUsage = "bashlog-mgr sync <name|pattern>...|--all [--dir path] [--merge]"
+
+// handleSync shares workspaces between machines through a directory that
+// is kept in sync by other means (Syncthing, Dropbox, a git repository).
+// Each machine appends its own commands to its own log there, and --merge
+// pulls in what the other machines pushed
+func handleSync(basePath string, args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	dir := fs.String("dir", "", "Sync directory, remembered per workspace (default: the one used last)")
+	merge := fs.Bool("merge", false, "Also add the commands other machines pushed")
+	all := fs.Bool("all", false, "Sync every workspace")
+	positional := parseInterspersed(fs, args)
+
+	if *all == (len(positional) > 0) {
+		failUsage(syncUsage, "workspace names or --all required")
+	}
+	if *all {
+		positional = []string{"*"}
+	}
+
+	var root string
+	if *dir != "" {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			fail(exitFailure, "invalid sync directory: %v", err)
+		}
+		root = abs
+	}
+
+	host := session.CurrentHost()
+	hostKey := workspace.HostKey(host.Name, host.MachineID)
+
+	failed := 0
+	for _, name := range requireWorkspaces(basePath, positional) {
+		wsPath := workspacePath(basePath, name)
+		configPath := filepath.Join(wsPath, configFile)
+
+		wsRoot := root
+		if wsRoot == "" {
+			wsRoot = workspace.ReadConfig(configPath)[syncDirKey]
+		}
+		if wsRoot == "" {
+			fmt.Fprintf(os.Stderr, "✗ %s: no sync directory yet (use --dir)\n", name)
+			failed++
+			continue
+		}
+		syncDir := filepath.Join(wsRoot, name)
+
+		pushed, err := workspace.Push(wsPath, syncDir, hostKey, host.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: could not push: %v\n", name, err)
+			failed++
+			continue
+		}
+		if root != "" {
+			if err := workspace.ChangeConfig(wsPath, "sync", syncDirKey, root); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %s: could not remember sync directory: %v\n", name, err)
+				failed++
+				continue
+			}
+		}
+
+		if !*merge {
+			fmt.Printf("✓ %s: pushed %d commands to %s\n", name, pushed, syncDir)
+			continue
+		}
+		merged, err := workspace.Merge(wsPath, syncDir, hostKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: could not merge: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✓ %s: pushed %d, merged %d commands from other machines\n", name, pushed, merged)
+	}
+
+	if failed > 0 {
+		fail(exitFailure, "%d workspace(s) failed to sync", failed)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/websocket"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// followInterval is how often a followed history is checked for new
+// commands
+const followInterval = 500 * time.Millisecond
+
+const tailUsage = "bashlog-mgr tail <name> [n] [--follow] [--remote url --token token]"
+
+// handleTail prints a workspace's last commands and with --follow keeps
+// printing new ones as they are recorded, locally or from a bashlog-mgr
+// serve instance with --remote
+func handleTail(basePath string, args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "Keep printing commands as they are recorded")
+	fs.BoolVar(follow, "f", false, "Same as --follow")
+	remote := fs.String("remote", "", "Follow the workspace on this bashlog-mgr serve URL instead (implies --follow)")
+	token := fs.String("token", os.Getenv("BASHLOG_TOKEN"), "API token for --remote (default: $BASHLOG_TOKEN)")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) == 0 || len(positional) > 2 {
+		failUsage(tailUsage, "workspace name required")
+	}
+	name := positional[0]
+	lines := 10
+	if len(positional) == 2 {
+		n, err := strconv.Atoi(positional[1])
+		if err != nil || n < 0 {
+			fail(exitUsage, "invalid number of commands '%s'", positional[1])
+		}
+		lines = n
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *remote != "" {
+		if *token == "" {
+			fail(exitUsage, "--remote needs --token or $BASHLOG_TOKEN")
+		}
+		if err := tailRemote(ctx, *remote, *token, name, lines); err != nil {
+			fail(exitFailure, "%v", err)
+		}
+		return
+	}
+
+	wsPath := requireWorkspace(basePath, name)
+	if !*follow {
+		entries, err := storage.Read(wsPath)
+		if err != nil && !os.IsNotExist(err) {
+			fail(exitFailure, "could not read history of '%s': %v", name, err)
+		}
+		start := max(len(entries)-lines, 0)
+		for i, e := range entries[start:] {
+			printTailed(start+i+1, e.Command)
+		}
+		return
+	}
+
+	if b := storage.For(wsPath); b.Name() != storage.Files {
+		fail(exitUsage, "'%s' keeps its commands in %s, and only history files can be followed", name, b.Name())
+	}
+	err := followHistory(ctx, filepath.Join(wsPath, workspace.HistoryFile), lines, func(n int, e workspace.Entry) error {
+		printTailed(n, e.Command)
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fail(exitFailure, "could not follow '%s': %v", name, err)
+	}
+}
+
+func printTailed(n int, command string) {
+	fmt.Printf("%3d. %s\n", n, redactRead(command))
+}
+
+// followHistory calls fn with the last backlog commands of the history at
+// path, then with each command appended to it, numbered by position, until
+// ctx is done or fn fails
+func followHistory(ctx context.Context, path string, backlog int, fn func(n int, e workspace.Entry) error) error {
+	type numbered struct {
+		n int
+		e workspace.Entry
+	}
+	var recent []numbered
+	cursor := &historyCursor{path: path}
+	err := cursor.next(func(n int, e workspace.Entry) error {
+		if backlog > 0 {
+			if len(recent) == backlog {
+				recent = recent[1:]
+			}
+			recent = append(recent, numbered{n, e})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range recent {
+		if err := fn(r.n, r.e); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := cursor.next(fn); err != nil {
+			return err
+		}
+	}
+}
+
+// historyCursor reads the commands of a history file from where it last got
+// to, numbering them by position
+type historyCursor struct {
+	path   string
+	offset int64
+	n      int
+}
+
+// next calls fn with each command appended to the history since the last
+// call, every command on the first, until fn fails. fn may be nil to skip
+// them. A history rewritten meanwhile, shorter than where the cursor had
+// got to, is picked up again from its end, as after a restore
+func (c *historyCursor) next(fn func(n int, e workspace.Entry) error) error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		// Not recorded into yet
+		return nil
+	}
+	if info.Size() < c.offset {
+		c.offset, c.n = 0, 0
+		fn = nil
+	}
+	if info.Size() == c.offset {
+		return nil
+	}
+
+	var failed error
+	err = workspace.ScanHistory(c.path, c.offset, func(e workspace.Entry, next int64) bool {
+		c.n++
+		c.offset = next
+		if fn != nil {
+			failed = fn(c.n, e)
+		}
+		return failed == nil
+	})
+	if failed != nil {
+		return failed
+	}
+	return err
+}
+
+// tailRemote follows a workspace over a serve instance's WebSocket stream
+func tailRemote(ctx context.Context, base, token, name string, backlog int) error {
+	u, err := url.Parse(strings.TrimRight(base, "/") + "/ws/workspaces/" + url.PathEscape(name) + "/stream")
+	if err != nil {
+		return fmt.Errorf("invalid --remote URL: %v", err)
+	}
+	u.RawQuery = url.Values{"backlog": {strconv.Itoa(backlog)}}.Encode()
+
+	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	conn, err := websocket.Dial(dialCtx, u.String(), http.Header{"Authorization": {"Bearer " + token}})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %v", base, err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, websocket.ErrClosed) {
+				return fmt.Errorf("%s closed the stream", base)
+			}
+			return err
+		}
+		var c apiCommand
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("unexpected message from %s: %v", base, err)
+		}
+		printTailed(c.N, c.Command)
+	}
+}
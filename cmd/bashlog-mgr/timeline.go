@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// timelineCommandWidth is how much of each command the timeline shows
+const timelineCommandWidth = 72
+
+// Kinds of timeline event, in the order they are drawn when they happen
+// at the same second
+const (
+	eventStart = iota
+	eventCommand
+	eventEnd
+)
+
+// timelineEvent is one row of the timeline
+type timelineEvent struct {
+	at   time.Time
+	kind int
+	lane int
+	text string
+}
+
+// handleTimeline draws a workspace's recent activity with time running
+// down the page, each session in a lane of its own, so commands typed in
+// overlapping terminals can be told apart
+func handleTimeline(basePath, logsPath string, args []string) {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	since := fs.String("since", "1d", "How far back to start, e.g. 6h or 7d")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage("bashlog-mgr timeline <name> [--since 1d]", "workspace name required")
+	}
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	age, err := parseAge(*since)
+	if err != nil {
+		fail(exitUsage, "invalid --since '%s': %v", *since, err)
+	}
+	now := time.Now()
+	from := now.Add(-age)
+
+	sessions, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		fail(exitFailure, "could not read sessions: %v", err)
+	}
+	history, err := storage.Read(wsPath)
+	if err != nil {
+		fail(exitFailure, "could not read history of '%s': %v", name, err)
+	}
+	redactEntries(history)
+
+	events, lanes := timelineEvents(sessions, history, from, now)
+	if len(events) == 0 {
+		fmt.Printf("No activity in '%s' since %s\n", name, from.Format("2006-01-02 15:04"))
+		return
+	}
+
+	fmt.Printf("=== %s: %s .. %s ===\n", name, from.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04"))
+	drawTimeline(events, lanes)
+	fmt.Println("\n┬ session start  ● command  ┴ session end  ○ command outside a recorded session")
+}
+
+// timelineEvents turns the sessions and commands between from and to into
+// events, placing each session in the first lane free when it starts.
+// Workspace commands that no session accounts for, such as imported
+// ones, get a lane of their own after the sessions'. It returns the
+// events in drawing order and the number of lanes
+func timelineEvents(sessions []*session.Meta, history []workspace.Entry, from, to time.Time) ([]timelineEvent, int) {
+	type key struct {
+		unix    int64
+		command string
+	}
+	var events []timelineEvent
+	var laneEnds []time.Time
+
+	// Sessions of a shell started the same day share a history file, so a
+	// command can fall within several of them. It goes to the one started
+	// most recently before it, the terminal most likely in use
+	owner := make(map[key]*session.Meta)
+	var commands []timelineEvent
+	commandAt := make(map[key]int)
+
+	for _, m := range sessions {
+		end := to
+		if m.Finished() {
+			end = m.Ended
+		}
+		if end.Before(from) || m.Started.After(to) {
+			continue
+		}
+
+		lane := len(laneEnds)
+		for i, e := range laneEnds {
+			if e.Before(m.Started) {
+				lane = i
+				break
+			}
+		}
+		if lane == len(laneEnds) {
+			laneEnds = append(laneEnds, end)
+		} else {
+			laneEnds[lane] = end
+		}
+
+		label := fmt.Sprintf("%s (%s", m.Name(), m.Shell)
+		if m.Host.Name != "" {
+			label += " on " + m.Host.Name
+		}
+		label += ")"
+		start := m.Started
+		if start.Before(from) {
+			start = from
+			label += ", started " + m.Started.Format("2006-01-02 15:04:05")
+		}
+		events = append(events, timelineEvent{at: start, kind: eventStart, lane: lane, text: label})
+		if m.Finished() && !m.Ended.After(to) {
+			events = append(events, timelineEvent{at: m.Ended, kind: eventEnd, lane: lane,
+				text: fmt.Sprintf("%s ended (exit %d)", m.Name(), m.ExitStatus)})
+		}
+
+		entries, err := m.Commands()
+		if err != nil {
+			continue
+		}
+		for _, c := range redactEntries(entries) {
+			k := key{c.Time.Unix(), c.Command}
+			if o, ok := owner[k]; ok {
+				if o.Started.After(m.Started) {
+					continue
+				}
+				owner[k] = m
+				if i, ok := commandAt[k]; ok {
+					commands[i].lane = lane
+				}
+				continue
+			}
+			owner[k] = m
+			if c.Time.Before(from) || c.Time.After(to) {
+				continue
+			}
+			commandAt[k] = len(commands)
+			commands = append(commands, timelineEvent{at: c.Time, kind: eventCommand, lane: lane, text: c.Command})
+		}
+	}
+	events = append(events, commands...)
+
+	lanes := len(laneEnds)
+	other := false
+	for _, e := range history {
+		if e.Time.IsZero() || e.Time.Before(from) || e.Time.After(to) {
+			continue
+		}
+		if _, ok := owner[key{e.Time.Unix(), e.Command}]; ok {
+			continue
+		}
+		events = append(events, timelineEvent{at: e.Time, kind: eventCommand, lane: lanes, text: e.Command})
+		other = true
+	}
+	if other {
+		lanes++
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.at.Truncate(time.Second).Equal(b.at.Truncate(time.Second)) {
+			return a.at.Before(b.at)
+		}
+		return a.kind < b.kind
+	})
+	return events, lanes
+}
+
+// drawTimeline prints one row per event, with a line down every lane
+// whose session is running and the day printed whenever it changes
+func drawTimeline(events []timelineEvent, lanes int) {
+	active := make([]bool, lanes)
+	day := ""
+	for _, ev := range events {
+		if d := ev.at.Format("2006-01-02"); d != day {
+			day = d
+			fmt.Printf("\n%s\n", d)
+		}
+		if ev.kind == eventStart {
+			active[ev.lane] = true
+		}
+
+		var cells strings.Builder
+		for l := 0; l < lanes; l++ {
+			switch {
+			case l == ev.lane && ev.kind == eventStart:
+				cells.WriteString("┬ ")
+			case l == ev.lane && ev.kind == eventEnd:
+				cells.WriteString("┴ ")
+			case l == ev.lane && !active[l]:
+				cells.WriteString("○ ")
+			case l == ev.lane:
+				cells.WriteString("● ")
+			case active[l]:
+				cells.WriteString("│ ")
+			default:
+				cells.WriteString("  ")
+			}
+		}
+
+		text := strings.ReplaceAll(ev.text, "\n", "; ")
+		if r := []rune(text); len(r) > timelineCommandWidth {
+			text = string(r[:timelineCommandWidth-1]) + "…"
+		}
+		fmt.Printf("  %s  %s %s\n", ev.at.Format("15:04:05"), cells.String(), text)
+
+		if ev.kind == eventEnd {
+			active[ev.lane] = false
+		}
+	}
+}
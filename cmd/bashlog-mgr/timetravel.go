@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/risk"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// instantLayouts are the forms --at accepts, in local time unless they
+// carry a zone
+var instantLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseInstant reads a point in time such as "2024-06-01 14:00", "14:00"
+// today, "now", or a while before now such as "30m ago" or "2d ago"
+func parseInstant(s string) (time.Time, error) {
+	now := time.Now()
+	if s == "now" {
+		return now, nil
+	}
+	if age, ok := strings.CutSuffix(s, " ago"); ok {
+		if d, err := parseAge(strings.TrimSpace(age)); err == nil {
+			return now.Add(-d), nil
+		}
+	}
+	for _, layout := range instantLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", s, time.Local); err == nil {
+		y, m, d := now.Date()
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("expected a time such as '2024-06-01 14:00', '14:00' or '30m ago'")
+}
+
+// historyAt reconstructs a workspace's history as of at: the latest
+// snapshot taken by then, which also keeps commands since edited out of
+// the history, plus the live commands timestamped up to at. It also
+// returns the snapshot used, if any, and how many live commands carry no
+// timestamp and so can't be placed
+func historyAt(wsPath string, at time.Time) ([]workspace.Entry, *Snapshot, int, error) {
+	live, err := storage.Read(wsPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	snapshots, err := getSnapshots(wsPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var base *Snapshot
+	for i := range snapshots {
+		if !snapshots[i].CreatedAt.After(at) {
+			base = &snapshots[i]
+		}
+	}
+
+	type key struct {
+		unix    int64
+		command string
+	}
+	var entries []workspace.Entry
+	seen := make(map[key]bool)
+	if base != nil {
+		entries, err = workspace.ReadHistory(filepath.Join(base.Path, "history.log"))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		for _, e := range entries {
+			seen[key{e.Time.Unix(), e.Command}] = true
+		}
+	}
+
+	undated := 0
+	for _, e := range live {
+		switch {
+		case e.Time.IsZero():
+			if base == nil {
+				undated++
+			}
+		case !e.Time.After(at) && !seen[key{e.Time.Unix(), e.Command}]:
+			entries = append(entries, e)
+		}
+	}
+	return entries, base, undated, nil
+}
+
+// sessionsActiveAt returns the workspace's sessions that had started and
+// not yet ended at at
+func sessionsActiveAt(logsPath, name string, at time.Time) ([]*session.Meta, error) {
+	sessions, err := workspaceSessions(logsPath, name)
+	if err != nil {
+		return nil, err
+	}
+	var active []*session.Meta
+	for _, m := range sessions {
+		if !m.Started.After(at) && (!m.Finished() || m.Ended.After(at)) {
+			active = append(active, m)
+		}
+	}
+	return active, nil
+}
+
+// viewAt shows a workspace as it was at a past instant
+func viewAt(logsPath, name, wsPath string, at time.Time) {
+	config := workspace.ReadConfig(filepath.Join(wsPath, configFile))
+	if created, err := time.Parse(time.RFC3339, config["created"]); err == nil && created.After(at) {
+		fail(exitNotFound, "workspace '%s' was created %s, after %s", name, created.Local().Format("2006-01-02 15:04:05"), at.Format("2006-01-02 15:04:05"))
+	}
+
+	entries, snapshot, undated, err := historyAt(wsPath, at)
+	if err != nil {
+		fail(exitFailure, "could not read history of '%s': %v", name, err)
+	}
+	active, err := sessionsActiveAt(logsPath, name, at)
+	if err != nil {
+		fail(exitFailure, "could not read sessions: %v", err)
+	}
+
+	fmt.Printf("\n=== Workspace: %s at %s ===\n", name, at.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Path: %s\n", wsPath)
+	fmt.Printf("Created: %s\n", config["created"])
+	fmt.Printf("Commands Logged: %d\n", len(entries))
+	if undated > 0 {
+		fmt.Printf("  (%d commands without timestamps not counted)\n", undated)
+	}
+	if snapshot != nil {
+		fmt.Printf("Based on snapshot: %s (%s)\n", snapshot.Name, snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("Activity (30 days): %s\n", sparkline(workspace.DailyCounts(entries, at, activityDays)))
+
+	fmt.Printf("\nActive Sessions (%d):\n", len(active))
+	for _, m := range active {
+		fmt.Printf("  %-32s %-8s started %s", m.Name(), m.Shell, m.Started.Local().Format("2006-01-02 15:04:05"))
+		if m.Host.Name != "" {
+			fmt.Printf(" on %s", m.Host.Name)
+		}
+		fmt.Println()
+	}
+
+	if risky := riskyCommands(name, entries, risk.High); len(risky) > 0 {
+		fmt.Printf("\nHigh-Risk Commands (%d):\n", len(risky))
+		if len(risky) > 5 {
+			risky = risky[len(risky)-5:]
+		}
+		printRisky(risky, false)
+	}
+
+	if len(entries) > 0 {
+		fmt.Printf("\nLast Commands (last 5):\n")
+		for _, e := range entries[max(len(entries)-5, 0):] {
+			when := ""
+			if !e.Time.IsZero() {
+				when = e.Time.Local().Format("2006-01-02 15:04:05") + "  "
+			}
+			fmt.Printf("  %s%s\n", when, redactRead(e.Command))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+const transfersUsage = "bashlog-mgr transfers <name> [--tool name] [--direction dir] [--since 7d] [--scan] [--record on|off]"
+
+// handleTransfers reports the file transfers a workspace's commands made
+// with scp, sftp, rsync, curl and wget: what went where, and which way.
+// Recording them as commands come in is turned on per workspace with
+// --record on; --scan looks through the history instead, covering
+// commands from before recording was on
+func handleTransfers(basePath string, args []string) {
+	fs := flag.NewFlagSet("transfers", flag.ExitOnError)
+	tool := fs.String("tool", "", "Only show transfers made with this tool (scp, sftp, rsync, curl or wget)")
+	dir := fs.String("direction", "", "Only show transfers going this way: "+strings.Join(shellparse.Directions, ", "))
+	since := fs.String("since", "", "Only show transfers within this long, e.g. 24h or 7d")
+	scan := fs.Bool("scan", false, "Find transfers in the whole history instead of reading the recorded ones")
+	record := fs.String("record", "", "Turn recording the workspace's transfers on or off")
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) != 1 {
+		failUsage(transfersUsage, "workspace name required")
+	}
+	name := positional[0]
+	wsPath := requireWorkspace(basePath, name)
+
+	if *record != "" {
+		setTransferRecording(wsPath, name, *record)
+		return
+	}
+	if *dir != "" && !contains(shellparse.Directions, *dir) {
+		fail(exitUsage, "unknown direction '%s' (expected one of %s)", *dir, strings.Join(shellparse.Directions, ", "))
+	}
+	var cutoff time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			fail(exitUsage, "invalid --since '%s': %v", *since, err)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	var transfers []workspace.Transfer
+	if *scan {
+		history, err := storage.Read(wsPath)
+		if err != nil && !os.IsNotExist(err) {
+			fail(exitFailure, "could not read history of '%s': %v", name, err)
+		}
+		transfers = workspace.DetectTransfers(history)
+	} else {
+		if !workspace.RecordsTransfers(wsPath) {
+			fmt.Fprintf(os.Stderr, "Transfers aren't recorded for '%s' (turn on with: bashlog-mgr transfers %s --record on); use --scan to look through its history\n", name, name)
+		}
+		var err error
+		if transfers, err = workspace.ReadTransfers(wsPath); err != nil {
+			fail(exitFailure, "could not read transfers of '%s': %v", name, err)
+		}
+	}
+
+	var shown []workspace.Transfer
+	for _, t := range transfers {
+		if (*tool == "" || t.Tool == *tool) &&
+			(*dir == "" || t.Direction == *dir) &&
+			(cutoff.IsZero() || t.Time.After(cutoff)) {
+			shown = append(shown, t)
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Printf("No matching transfers in '%s'\n", name)
+		return
+	}
+	printTransfers(shown)
+}
+
+// printTransfers lists transfers, then how many went each way
+func printTransfers(transfers []workspace.Transfer) {
+	fmt.Printf("%-19s  %-6s %-9s %s\n", "TIME", "TOOL", "DIRECTION", "SOURCE -> DESTINATION")
+	fmt.Println(strings.Repeat("-", 80))
+	counts := make(map[string]int)
+	for _, t := range transfers {
+		when := "-"
+		if !t.Time.IsZero() {
+			when = t.Time.Local().Format("2006-01-02 15:04:05")
+		}
+		route := t.Destination
+		if len(t.Sources) > 0 {
+			route = strings.Join(t.Sources, " ") + " -> " + t.Destination
+		}
+		fmt.Printf("%-19s  %-6s %-9s %s\n", when, t.Tool, t.Direction, route)
+		counts[t.Direction]++
+	}
+
+	var summary []string
+	for _, d := range shellparse.Directions {
+		if counts[d] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[d], d))
+		}
+	}
+	fmt.Printf("\n%d transfers: %s\n", len(transfers), strings.Join(summary, ", "))
+}
+
+// setTransferRecording turns recording a workspace's transfers on or off
+func setTransferRecording(wsPath, name, value string) {
+	if value != "on" && value != "off" {
+		fail(exitUsage, "invalid --record '%s' (use on or off)", value)
+	}
+	if workspace.IsMounted(wsPath) {
+		fail(exitConflict, "workspace '%s' is mounted read-only", name)
+	}
+	err := workspace.ChangeConfig(wsPath, "transfers", workspace.TransfersKey, fmt.Sprint(value == "on"))
+	if err != nil {
+		fail(exitCodeFor(err), "could not update workspace '%s': %v", name, err)
+	}
+	if value == "on" {
+		fmt.Printf("✓ Recording file transfers of workspace '%s' from now on (see earlier ones with --scan)\n", name)
+	} else {
+		fmt.Printf("✓ No longer recording file transfers of workspace '%s'\n", name)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// trashRetention is how long deleted workspaces are kept before they are
+// removed for good
+const trashRetention = 30 * 24 * time.Hour
+
+// trashKey, in the settings, set to trashSystem has delete move workspaces
+// to the desktop's trash bin rather than bashlog's own, for those who
+// restore files from the file manager
+const (
+	trashKey    = "trash"
+	trashSystem = "system"
+)
+
+// trashInfoFile records where a trashed workspace came from and when
+const trashInfoFile = ".trashinfo"
+
+// TrashEntry is a deleted workspace waiting in the trash
+type TrashEntry struct {
+	Name      string
+	DeletedAt time.Time
+	Path      string
+}
+
+// Expires returns when the entry is removed for good
+func (e TrashEntry) Expires() time.Time {
+	return e.DeletedAt.Add(trashRetention)
+}
+
+// moveToTrash moves a workspace into the trash under its name plus the
+// deletion time, so the same name can be trashed repeatedly
+func moveToTrash(wsPath, trashPath string, now time.Time) error {
+	if err := fsperm.Default.MkdirAll(trashPath); err != nil {
+		return err
+	}
+
+	name := filepath.Base(wsPath)
+	info := fmt.Sprintf("name=%s\ndeleted=%s\n", name, now.Format(time.RFC3339Nano))
+	if err := workspace.FileMode(wsPath).WriteFile(filepath.Join(wsPath, trashInfoFile), []byte(info)); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(trashPath, fmt.Sprintf("%s.%d", name, now.UnixNano()))
+	if err := os.Rename(wsPath, dest); err != nil {
+		os.Remove(filepath.Join(wsPath, trashInfoFile))
+		return err
+	}
+	return nil
+}
+
+// getTrash returns the entries in the trash, newest first
+func getTrash(trashPath string) ([]TrashEntry, error) {
+	dirs, err := os.ReadDir(trashPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []TrashEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		path := filepath.Join(trashPath, d.Name())
+		info := workspace.ReadConfig(filepath.Join(path, trashInfoFile))
+		deleted, err := time.Parse(time.RFC3339Nano, info["deleted"])
+		if err != nil || info["name"] == "" {
+			slog.Warn("skipping unrecognized trash entry", "path", path)
+			continue
+		}
+		entries = append(entries, TrashEntry{Name: info["name"], DeletedAt: deleted, Path: path})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+// purgeExpiredTrash removes trash entries past the retention window
+func purgeExpiredTrash(trashPath string, now time.Time) {
+	entries, err := getTrash(trashPath)
+	if err != nil {
+		slog.Warn("could not read trash", "err", err)
+		return
+	}
+	for _, e := range entries {
+		if now.After(e.Expires()) {
+			slog.Debug("purging expired trash entry", "name", e.Name, "deleted", e.DeletedAt)
+			if err := os.RemoveAll(e.Path); err != nil {
+				slog.Warn("could not purge trash entry", "path", e.Path, "err", err)
+			}
+		}
+	}
+}
+
+// restoreFromTrash moves the most recently deleted workspace called name
+// back into place
+func restoreFromTrash(basePath, trashPath, name string) {
+	entries, err := getTrash(trashPath)
+	if err != nil {
+		fail(exitFailure, "could not read trash: %v", err)
+	}
+
+	for _, e := range entries {
+		if e.Name != name {
+			continue
+		}
+
+		wsPath := filepath.Join(basePath, name)
+		if _, err := os.Stat(workspacePath(basePath, name)); err == nil {
+			fail(exitConflict, "workspace '%s' already exists", name)
+		}
+		if err := fsperm.Default.MkdirAll(basePath); err != nil {
+			fail(exitFailure, "could not create workspace directory: %v", err)
+		}
+		if err := os.Rename(e.Path, wsPath); err != nil {
+			fail(exitFailure, "could not restore workspace '%s': %v", name, err)
+		}
+		os.Remove(filepath.Join(wsPath, trashInfoFile))
+
+		fmt.Printf("✓ Workspace '%s' restored from trash (deleted %s)\n", name, e.DeletedAt.Format("2006-01-02 15:04:05"))
+		return
+	}
+
+	fail(exitNotFound, "workspace '%s' not found in trash", name)
+}
+
+// handleTrash lists or empties the trash
+func handleTrash(trashPath, settingsPath string, args []string) {
+	if len(args) == 0 {
+		failUsage("bashlog-mgr trash list|empty [--yes] [--dry-run]", "trash command required")
+	}
+
+	switch args[0] {
+	case "list":
+		listTrash(trashPath)
+	case "empty":
+		emptyTrash(trashPath, settingsPath, args[1:])
+	default:
+		failUsage("bashlog-mgr trash list|empty [--yes] [--dry-run]", "unknown trash command '%s'", args[0])
+	}
+}
+
+func listTrash(trashPath string) {
+	entries, err := getTrash(trashPath)
+	if err != nil {
+		fail(exitFailure, "could not read trash: %v", err)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("Trash is empty")
+		return
+	}
+
+	fmt.Printf("%-20s %-19s %s\n", "NAME", "DELETED", "EXPIRES")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, e := range entries {
+		fmt.Printf("%-20s %-19s %s\n", e.Name,
+			e.DeletedAt.Format("2006-01-02 15:04:05"),
+			e.Expires().Format("2006-01-02 15:04:05"))
+	}
+}
+
+func emptyTrash(trashPath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("trash empty", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "Empty without asking for confirmation")
+	dryRun := fs.Bool("dry-run", false, "Print what would be removed without removing it")
+	fs.Parse(args)
+
+	entries, err := getTrash(trashPath)
+	if err != nil {
+		fail(exitFailure, "could not read trash: %v", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("Trash is empty")
+		return
+	}
+
+	if *dryRun {
+		for _, e := range entries {
+			if err := printRemoval(e.Path); err != nil {
+				fail(exitFailure, "could not list trash entry '%s': %v", e.Name, err)
+			}
+		}
+		return
+	}
+
+	names := make([]string, len(entries))
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+		paths[i] = e.Path
+	}
+	if !confirmWorkspaces("permanently delete", names, *yes) {
+		fmt.Println("Trash not emptied")
+		return
+	}
+	requireSensitiveUnlock(settingsPath, "permanently delete", names, paths)
+
+	for _, e := range entries {
+		if err := os.RemoveAll(e.Path); err != nil {
+			fail(exitFailure, "could not remove trash entry '%s': %v", e.Name, err)
+		}
+	}
+	fmt.Printf("✓ Permanently deleted %d workspace(s)\n", len(entries))
+}
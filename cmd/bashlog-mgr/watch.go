@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/notify"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// watchRescanInterval is how often watch looks for workspaces created or
+// deleted, and checks those kept in a database
+const watchRescanInterval = 5 * time.Second
+
+// watchEvent is a command a watched workspace received, masked as
+// redact.on-read says
+type watchEvent struct {
+	Time      time.Time `json:"time"`
+	Workspace string    `json:"workspace"`
+	Number    int       `json:"n"`
+	Command   string    `json:"command"`
+}
+
+// watchedWorkspace is where watch has got to in a workspace: a cursor into
+// its history file, or the command count of one kept in a database
+type watchedWorkspace struct {
+	cursor *historyCursor
+	count  int
+}
+
+// handleWatch prints commands as any workspace in the roots receives them,
+// and with --notify posts them to notification targets, for keeping an eye
+// on a shared bastion. Workspaces created while watching are picked up
+func handleWatch(basePath, settingsPath string, args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	notifyTo := fs.String("notify", "", "Also post new commands to these notification targets (comma-separated)")
+	asJSON := fs.Bool("json", false, "Print each command as a line of JSON")
+	patterns := parseInterspersed(fs, args)
+
+	var targets []string
+	if *notifyTo != "" {
+		targets = strings.Split(*notifyTo, ",")
+		sinks, err := loadSinks(settingsPath)
+		if err != nil {
+			fail(exitFailure, "could not read notification targets: %v", err)
+		}
+		for _, t := range targets {
+			if _, ok := sinks[t]; !ok {
+				fail(exitNotFound, "notification target '%s' not found", t)
+			}
+		}
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	// A pattern matching nothing yet may match workspaces created later
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			fail(exitUsage, "invalid pattern '%s': %v", p, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	emit := func(events []watchEvent) {
+		for _, e := range events {
+			if *asJSON {
+				data, _ := json.Marshal(e)
+				fmt.Println(string(data))
+				continue
+			}
+			when := "-"
+			if !e.Time.IsZero() {
+				when = e.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-19s  %-20s %4d. %s\n", when, e.Workspace, e.Number, e.Command)
+		}
+		if len(targets) > 0 && len(events) > 0 {
+			if err := sendNotification(settingsPath, targets, watchMessage(events)); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ could not notify %s: %v\n", *notifyTo, err)
+			}
+		}
+	}
+
+	watched := make(map[string]*watchedWorkspace)
+	rescan := func(first bool) {
+		workspaces, err := getWorkspaces(basePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ could not list workspaces: %v\n", err)
+			return
+		}
+		seen := make(map[string]bool)
+		for _, ws := range workspaces {
+			if !matchesAny(ws.Name, patterns) {
+				continue
+			}
+			seen[ws.Path] = true
+			w, ok := watched[ws.Path]
+			if !ok {
+				w = &watchedWorkspace{}
+				if storage.For(ws.Path).Name() == storage.Files {
+					w.cursor = &historyCursor{path: filepath.Join(ws.Path, workspace.HistoryFile)}
+				}
+				watched[ws.Path] = w
+				// What workspaces held when watch started is old news;
+				// all a workspace created since has received is new
+				if first {
+					watchSkip(w, ws)
+					continue
+				}
+			}
+			if w.cursor == nil {
+				emit(watchDatabase(w, ws))
+			}
+		}
+		for wsPath := range watched {
+			if !seen[wsPath] {
+				delete(watched, wsPath)
+			}
+		}
+	}
+
+	rescan(true)
+	fmt.Fprintf(os.Stderr, "Watching %d workspace(s) for new commands (Ctrl-C to stop)\n", len(watched))
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	lastScan := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if time.Since(lastScan) >= watchRescanInterval {
+			rescan(false)
+			lastScan = time.Now()
+		}
+		for wsPath, w := range watched {
+			if w.cursor == nil {
+				continue
+			}
+			name := filepath.Base(wsPath)
+			var events []watchEvent
+			err := w.cursor.next(func(n int, e workspace.Entry) error {
+				events = append(events, watchEvent{Time: e.Time, Workspace: name, Number: n, Command: redactRead(e.Command)})
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ could not read history of '%s': %v\n", name, err)
+			}
+			emit(events)
+		}
+	}
+}
+
+// watchSkip moves w past the commands ws already has
+func watchSkip(w *watchedWorkspace, ws Workspace) {
+	if w.cursor != nil {
+		w.cursor.next(nil)
+		return
+	}
+	w.count = ws.CommandCount
+}
+
+// watchDatabase returns the commands a workspace kept in a database has
+// received since w's count, read when its config's count has gone up
+func watchDatabase(w *watchedWorkspace, ws Workspace) []watchEvent {
+	if ws.CommandCount <= w.count {
+		w.count = ws.CommandCount
+		return nil
+	}
+	entries, err := storage.Read(ws.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ could not read history of '%s': %v\n", ws.Name, err)
+		return nil
+	}
+	var events []watchEvent
+	for i := w.count; i < len(entries); i++ {
+		events = append(events, watchEvent{Time: entries[i].Time, Workspace: ws.Name, Number: i + 1, Command: redactRead(entries[i].Command)})
+	}
+	w.count = len(entries)
+	return events
+}
+
+// watchMessage is the notification for a workspace's new commands
+func watchMessage(events []watchEvent) notify.Message {
+	var text strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&text, "%d. `%s`\n", e.Number, e.Command)
+	}
+	m := notify.Message{
+		Title:     fmt.Sprintf("%d new command(s) in %s", len(events), events[0].Workspace),
+		Text:      strings.TrimSuffix(text.String(), "\n"),
+		Workspace: events[0].Workspace,
+	}
+	if len(events) == 1 {
+		m.Title = "New command in " + events[0].Workspace
+		m.Command = events[0].Command
+	}
+	return m
+}
+
+// matchesAny reports whether name matches one of the glob patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
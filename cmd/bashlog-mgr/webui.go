@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// webUIPage is the page serve answers / with: a viewer of the workspaces'
+// histories for reviewing them together, leaving threaded comments on
+// commands and sessions. It holds no data itself; the browser asks the API
+// for everything with the token the reviewer gives, which is kept for the
+// tab only, or as they signed in with the provider when serve has one, and
+// offers only what the workspace's access list lets that
+// token do
+const webUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>bashlog</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 0; color: #222; }
+header { display: flex; gap: .5em; align-items: center; padding: .6em 1em; background: #222; color: #eee; }
+header b { margin-right: 1em; }
+main { padding: 1em; max-width: 70em; }
+input, select, textarea, button { font: inherit; }
+textarea { width: 100%; box-sizing: border-box; }
+.cmd { font-family: ui-monospace, monospace; padding: .25em .4em; border-bottom: 1px solid #eee; cursor: pointer; white-space: pre-wrap; }
+.cmd:hover { background: #f4f4f4; }
+.n, .time { color: #888; margin-right: .6em; }
+.count { background: #2a6; color: #fff; border-radius: 1em; padding: 0 .5em; margin-left: .6em; font-family: system-ui, sans-serif; font-size: 12px; }
+.thread { margin: .3em 0 .8em 2em; padding: .5em; border-left: 3px solid #2a6; background: #fafafa; }
+.comment { margin: .3em 0; }
+.meta { color: #666; font-size: 12px; }
+.text { white-space: pre-wrap; }
+.error { color: #b00; }
+.acl { color: #666; font-size: 12px; margin-bottom: 1em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+</style>
+</head>
+<body>
+<header>
+<b>bashlog</b>
+<input id="token" type="password" placeholder="API token" size="24">
+<button id="signin" hidden>Sign in</button>
+<span id="who"></span>
+<button id="signout" hidden>Sign out</button>
+<select id="workspace"></select>
+<button id="load">Open</button>
+<span id="status"></span>
+</header>
+<main>
+<div id="acl" class="acl"></div>
+<div id="history"></div>
+<h2>Sessions</h2>
+<div id="sessions"></div>
+<form id="session-form">
+<input id="session-id" placeholder="Session ID" size="30">
+<textarea id="session-text" rows="2" placeholder="Comment on a session"></textarea>
+<button>Comment</button>
+</form>
+</main>
+<script>` + webUIScript + `</script>
+</body>
+</html>
+`
+
+const webUIScript = `
+"use strict";
+const $ = id => document.getElementById(id);
+let comments = [];
+let workspaces = [];
+let canComment = false;
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+async function api(path, options) {
+  options = options || {};
+  const auth = $("token").value ? { Authorization: "Bearer " + $("token").value } : {};
+  options.headers = Object.assign(auth, options.headers);
+  const res = await fetch(path, options);
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error || res.statusText);
+  return body;
+}
+
+function status(text, error) {
+  $("status").textContent = text;
+  $("status").className = error ? "error" : "";
+}
+
+async function listWorkspaces() {
+  sessionStorage.setItem("bashlog-token", $("token").value);
+  try {
+    const body = await api("/api/v1/workspaces?limit=1000");
+    workspaces = body.workspaces;
+    $("workspace").replaceChildren(...workspaces.map(w => {
+      const readable = w.access.includes("read");
+      const option = el("option", "", w.name + (readable ? "" : " (append only)"));
+      option.value = w.name;
+      option.disabled = !readable;
+      return option;
+    }));
+    status("");
+  } catch (e) {
+    status(e.message, true);
+  }
+}
+
+async function readHistory(name) {
+  let all = [], cursor = "";
+  do {
+    const body = await api("/api/v1/workspaces/" + name + "/history?limit=1000" + (cursor ? "&cursor=" + cursor : ""));
+    all = all.concat(body.commands);
+    cursor = body.next_cursor;
+  } while (cursor);
+  return all;
+}
+
+function renderThread(box, on) {
+  box.replaceChildren();
+  const ids = new Set(comments.map(c => c.id));
+  const walk = (parent, depth) => {
+    comments.filter(c => (parent ? c.parent === parent : (!c.parent || !ids.has(c.parent)) && on(c))).forEach(c => {
+      const div = el("div", "comment");
+      div.style.marginLeft = (depth * 1.5) + "em";
+      div.append(el("div", "meta", c.author + ", " + new Date(c.time).toLocaleString()), el("div", "text", c.text));
+      if (canComment) {
+        const reply = el("button", "", "Reply");
+        reply.onclick = () => commentForm(div, { parent: c.id }, () => renderThread(box, on));
+        div.append(reply);
+      }
+      box.append(div);
+      walk(c.id, depth + 1);
+    });
+  };
+  walk("", 0);
+}
+
+function commentForm(parent, target, done) {
+  const form = el("form");
+  const text = el("textarea");
+  text.rows = 2;
+  form.append(text, el("button", "", "Comment"));
+  form.onsubmit = async ev => {
+    ev.preventDefault();
+    try {
+      const c = await api("/api/v1/workspaces/" + $("workspace").value + "/comments", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(Object.assign({ text: text.value }, target)),
+      });
+      comments.push(c);
+      done();
+      render();
+    } catch (e) {
+      status(e.message, true);
+    }
+  };
+  parent.append(form);
+  text.focus();
+}
+
+let commands = [];
+
+function render() {
+  const box = $("history");
+  const open = new Set([...box.querySelectorAll(".thread")].map(t => t.dataset.n));
+  box.replaceChildren();
+  commands.forEach(c => {
+    const row = el("div", "cmd");
+    row.append(el("span", "n", c.n + "."));
+    if (c.time) row.append(el("span", "time", new Date(c.time).toLocaleString()));
+    row.append(document.createTextNode(c.command));
+    const count = comments.filter(x => x.n === c.n).length;
+    if (count) row.append(el("span", "count", count));
+    const thread = el("div", "thread");
+    thread.dataset.n = c.n;
+    const show = () => {
+      renderThread(thread, x => x.n === c.n);
+      if (!canComment) return;
+      if (c.time) commentForm(thread, { n: c.n }, show);
+      else thread.append(el("div", "meta", "Commands without a timestamp can't be commented on"));
+    };
+    row.onclick = () => {
+      if (thread.isConnected) thread.remove();
+      else { row.after(thread); show(); }
+    };
+    box.append(row);
+    if (open.has(String(c.n))) { box.append(thread); show(); }
+  });
+
+  const sessions = $("sessions");
+  sessions.replaceChildren();
+  [...new Set(comments.filter(c => c.session).map(c => c.session))].forEach(id => {
+    sessions.append(el("div", "cmd", id));
+    const thread = el("div", "thread");
+    const show = () => renderThread(thread, x => x.session === id);
+    show();
+    sessions.append(thread);
+  });
+}
+
+async function openWorkspace() {
+  const name = $("workspace").value;
+  if (!name) return;
+  const ws = workspaces.find(w => w.name === name) || { access: [] };
+  canComment = ws.access.includes("comment");
+  $("session-form").hidden = !canComment;
+  $("acl").textContent = "You may " + ws.access.join(", ") + "." + (ws.acl ? " " +
+    Object.entries(ws.acl).map(([role, who]) => role + ": " + (who.join(", ") || "none")).join("; ") : "");
+  status("Loading " + name + "...");
+  try {
+    [commands, comments] = await Promise.all([readHistory(name), api("/api/v1/workspaces/" + name + "/comments").then(b => b.comments)]);
+    render();
+    status(commands.length + " commands, " + comments.length + " comments");
+  } catch (e) {
+    status(e.message, true);
+  }
+}
+
+$("token").value = sessionStorage.getItem("bashlog-token") || "";
+$("token").onchange = listWorkspaces;
+$("load").onclick = openWorkspace;
+$("session-form").onsubmit = async ev => {
+  ev.preventDefault();
+  try {
+    const c = await api("/api/v1/workspaces/" + $("workspace").value + "/comments", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ session: $("session-id").value, text: $("session-text").value }),
+    });
+    comments.push(c);
+    $("session-text").value = "";
+    render();
+  } catch (e) {
+    status(e.message, true);
+  }
+};
+$("signin").onclick = () => { location.href = "/auth/login"; };
+$("signout").onclick = async () => {
+  await fetch("/auth/logout", { method: "POST" });
+  location.reload();
+};
+fetch("/auth/session").then(res => res.json()).then(s => {
+  if (s.user) {
+    $("token").hidden = true;
+    $("who").textContent = s.user;
+    $("signout").hidden = false;
+    listWorkspaces();
+    return;
+  }
+  $("signin").hidden = !s.sso;
+  if ($("token").value) listWorkspaces();
+}).catch(() => { if ($("token").value) listWorkspaces(); });
+`
+
+// webUIPolicy lets the page run its own script and talk to this server,
+// and nothing else
+var webUIPolicy = func() string {
+	sum := sha256.Sum256([]byte(webUIScript))
+	return "default-src 'none'; style-src 'unsafe-inline'; connect-src 'self'; script-src 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}()
+
+// serveWebUI answers GET / with the web UI. The page needs no token; the
+// API calls it makes do
+func serveWebUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		apiError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apiError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", webUIPolicy)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Write([]byte(webUIPage))
+}
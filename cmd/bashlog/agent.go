@@ -0,0 +1,65 @@
+//go:build agent
+
+package main
+
+import "errors"
+
+// agentBuild makes this bashlog-agent, bashlog built with -tags agent:
+//
+//	go build -tags agent -o bashlog-agent ./cmd/bashlog
+//
+// It only records. What reads history back, search and suggest and their
+// key bindings, and doctor, which reads the shell's history and settings,
+// are left out, as is the profiler, so a host recording for a shared
+// workspace carries nothing that serves the history to whoever gets onto
+// it. Reading is left to bashlog-mgr, on the machine the workspaces are
+// kept on. Started as root with --run-as, it records as that user instead
+const agentBuild = true
+
+const commandsUsage = `Usage: bashlog-agent [options] [-- shell arguments]
+       bashlog-agent mark <note>   (inside a session: add a marker to its log)
+       bashlog-agent pause | resume (inside a session: stop recording for a moment, e.g. to type a password)
+       bashlog-agent install-hooks [--shell bash|zsh|fish] [--workspace name]
+                             (record every new shell, not only ones started with bashlog-agent)
+       bashlog-agent uninstall-hooks [--shell name]
+       bashlog-agent ingest --workspace <name> [--format jsonl] [--origin script] < records
+                             (add commands other recorders, e.g. CI jobs, wrote, one JSON
+                             object a line: {"command":"make","time":"...","exit":0,"ms":900})
+       bashlog-agent ci [--file steps] [--name name] [--artifact file] [--keep-going]
+                             (run a CI job's steps, one command a line, recording them into a
+                             workspace written out as a tarball for bashlog-mgr mount)
+       bashlog-agent make --workspace <name> [--via runner] [--shell path] [target...]
+                             (run make, or another task runner, recording each recipe line
+                             with its output and timing, tagged make:<target>)
+       bashlog-agent drive <script.yaml> [options]
+                             (run a session typing a script's input as its output asks for
+                             it, expect-style, recording it as any session is)
+       bashlog-agent cron add "<schedule> <command>" --workspace <name> | list | remove <id>
+                             (run commands on a crontab schedule, each run recorded with its
+                             output; bashlog-agent cron run is the scheduler, for the service manager)
+
+bashlog-agent only records; read what it recorded with bashlog-mgr.
+`
+
+// errRecordOnly is returned by the commands bashlog-agent leaves out
+var errRecordOnly = errors.New("not in bashlog-agent, which only records; use bashlog or bashlog-mgr")
+
+func init() {
+	hiddenFlags["no-search-key"] = true
+}
+
+func runSearch(args []string) error {
+	return errRecordOnly
+}
+
+func runSuggest(args []string) error {
+	return errRecordOnly
+}
+
+func runDoctor(args []string) error {
+	return errRecordOnly
+}
+
+func startProfiler(addr string) error {
+	return errRecordOnly
+}
@@ -0,0 +1,10 @@
+//go:build agent && !unix
+
+package main
+
+import "errors"
+
+// runAs fails, as there are no users to switch to here
+func runAs(name string) error {
+	return errors.New("--run-as is not supported on this platform")
+}
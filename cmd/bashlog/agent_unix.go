@@ -0,0 +1,68 @@
+//go:build agent && unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// runAs switches the process to the user name, their groups and home, for
+// recording as them when started as root. Once switched there is no way
+// back to root, which is checked. Started as anyone else, it only accepts
+// that user
+func runAs(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("user %s has a non-numeric uid %s", name, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("user %s has a non-numeric gid %s", name, u.Gid)
+	}
+	if os.Geteuid() != 0 {
+		if os.Getuid() != uid || os.Geteuid() != uid {
+			return fmt.Errorf("only root can record as another user (%s)", name)
+		}
+		return nil
+	}
+
+	var groups []int
+	ids, err := u.GroupIds()
+	if err != nil {
+		return fmt.Errorf("could not read the groups of %s: %w", name, err)
+	}
+	for _, id := range ids {
+		if g, err := strconv.Atoi(id); err == nil {
+			groups = append(groups, g)
+		}
+	}
+	// Groups go first, while there is still the right to change them
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("could still switch back to root after switching to %s", name)
+	}
+
+	os.Setenv("HOME", u.HomeDir)
+	os.Setenv("USER", u.Username)
+	os.Setenv("LOGNAME", u.Username)
+	for _, v := range []string{"SUDO_USER", "SUDO_UID", "SUDO_GID", "SUDO_COMMAND"} {
+		os.Unsetenv(v)
+	}
+	return nil
+}
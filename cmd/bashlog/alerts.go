@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/platform"
+	"github.com/interhack86/bashlog/internal/pty"
+	"github.com/interhack86/bashlog/internal/rules"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// alertInterval is how often the session's history is checked for commands
+// matching rules that warn in the terminal
+const alertInterval = time.Second
+
+// alertCommandLength is how much of a command an OSC 9 notification shows
+const alertCommandLength = 80
+
+// terminalAlerts warns in the session's terminal when a command matches a
+// rule with a terminal action, as soon as the prompt comes back, rather than
+// when the session ends as for the rules' other actions
+type terminalAlerts struct {
+	config *Config
+	rules  []*rules.Rule
+	out    io.Writer
+	// tmux only passes OSC 9 on to the terminal wrapped for it
+	tmux bool
+
+	size int64
+	// settled is set once the history file stops growing, so the status
+	// the prompt writes after it is there too
+	settled bool
+	seen    int
+}
+
+// newTerminalAlerts returns the terminal warnings of the rules in the
+// settings, nil when none warn or bashlog has no terminal to warn in
+func newTerminalAlerts(config *Config) *terminalAlerts {
+	if !pty.IsTerminal(os.Stderr) {
+		return nil
+	}
+	ruleset, err := rules.Parse(workspace.ReadConfig(config.SettingsFile))
+	if err != nil {
+		// Reported as the session ends, when the rules are evaluated
+		return nil
+	}
+	a := &terminalAlerts{config: config, out: os.Stderr, tmux: os.Getenv("TMUX") != "", settled: true}
+	for _, r := range ruleset {
+		if r.Terminal != "" {
+			a.rules = append(a.rules, r)
+		}
+	}
+	if len(a.rules) == 0 {
+		return nil
+	}
+	return a
+}
+
+// check warns of the commands recorded since the last check that match
+func (a *terminalAlerts) check() {
+	info, err := os.Stat(a.config.HistFile)
+	if err != nil {
+		return
+	}
+	if info.Size() != a.size {
+		a.size = info.Size()
+		a.settled = false
+		return
+	}
+	if a.settled {
+		return
+	}
+	a.settled = true
+
+	entries, err := sessionEntries(a.config)
+	if err != nil || len(entries) <= a.seen {
+		return
+	}
+	records := sessionRecords(a.config, entries)
+	for _, ev := range sessionEvents(a.config, records[a.seen:]) {
+		for _, r := range a.rules {
+			if r.Match(ev) {
+				a.warn(r, ev)
+			}
+		}
+	}
+	a.seen = len(entries)
+}
+
+// warn gives the terminal warning of r for ev
+func (a *terminalAlerts) warn(r *rules.Rule, ev rules.Event) {
+	slog.Debug("rule matched, warning in terminal", "rule", r.Name, "command", ev.Command)
+	if r.Terminal == rules.TerminalBell {
+		io.WriteString(a.out, "\a")
+		return
+	}
+	if r.Terminal == rules.TerminalDesktop {
+		// The tools take a moment, and the session doesn't wait on them
+		go func() {
+			err := platform.Notify("bashlog rule "+r.Name+" matched", alertText(ev.Command, alertCommandLength))
+			if err != nil {
+				slog.Debug("no desktop notification, using OSC 9", "err", err)
+				a.osc9(r, ev)
+			}
+		}()
+		return
+	}
+	a.osc9(r, ev)
+}
+
+// osc9 writes the OSC 9 notification of r for ev
+func (a *terminalAlerts) osc9(r *rules.Rule, ev rules.Event) {
+	seq := fmt.Sprintf("\x1b]9;bashlog rule %s matched: %s\a", alertText(r.Name, alertCommandLength), alertText(ev.Command, alertCommandLength))
+	if a.tmux {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	io.WriteString(a.out, seq)
+}
+
+// alertText makes s safe to put in an escape sequence, dropping control
+// characters, and cuts it to max runes
+func alertText(s string, max int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+			continue
+		}
+		if n == max {
+			b.WriteString("…")
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
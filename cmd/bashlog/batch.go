@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/rules"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// batchRecord is a command fed to "bashlog ingest", one JSON object a line,
+// as {"command":"make test","time":"2024-05-01T14:03:00Z","exit":0,"ms":1200}.
+// Only command is required; a command without a time is taken to run as
+// it is ingested
+type batchRecord struct {
+	Command  string    `json:"command"`
+	Time     time.Time `json:"time"`
+	Exit     *int      `json:"exit,omitempty"`
+	Duration *int64    `json:"ms,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	// Host is where the command ran, this machine when empty
+	Host   string `json:"host,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// runIngest implements "bashlog ingest --workspace x", which appends the
+// command records read from stdin to a workspace, as a session's are when
+// it ends, so recorders bashlog doesn't run, CI jobs, other shells and
+// scripts, feed the same store. The records are all read and checked before
+// any is added, so a bad line adds none
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	wsName := fs.String("workspace", "", "Workspace to add the commands to")
+	format := fs.String("format", "jsonl", "Format of the records on stdin: jsonl, a JSON object a line")
+	origin := fs.String("origin", workspace.OriginScript, "Where the commands came from: "+strings.Join(workspace.Origins, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *wsName == "" || fs.NArg() > 0 {
+		return errors.New("usage: bashlog ingest --workspace <name> [--format jsonl] [--origin script] < records")
+	}
+	if *format != "jsonl" {
+		return fmt.Errorf("unknown format %q (want jsonl)", *format)
+	}
+	if _, err := workspace.ParseOrigin(*origin); err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if err := configureSettings(homeDir); err != nil {
+		return err
+	}
+	config := &Config{
+		SettingsFile: filepath.Join(homeDir, ".bashlog", "config.txt"),
+		HitLog:       filepath.Join(homeDir, ".bashlog", "rule-hits.log"),
+	}
+	if err := useWorkspace(config, *wsName); err != nil {
+		return err
+	}
+
+	batch, err := readBatch(os.Stdin, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := ingestBatch(config, *origin, batch); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "bashlog: added %d command(s) to workspace '%s'\n", len(batch), config.Workspace)
+	return nil
+}
+
+// ingestBatch adds batch to the workspace of config, with where its
+// commands ran and came from and what they printed, and passes it through
+// the alert rules
+func ingestBatch(config *Config, origin string, batch []batchRecord) error {
+	records, hosts, outputs := batchRecords(batch)
+	entries := workspace.EntriesOf(records)
+
+	if err := storage.AppendRecords(config.WorkspacePath, records); err != nil {
+		return fmt.Errorf("failed to add commands to workspace '%s': %w", config.Workspace, err)
+	}
+	for host, hosted := range hosts {
+		if err := workspace.AddHosts(config.WorkspacePath, host, hosted); err != nil {
+			slog.Warn("failed to record command hosts", "workspace", config.Workspace, "err", err)
+		}
+	}
+	if err := workspace.AddOrigins(config.WorkspacePath, origin, entries); err != nil {
+		slog.Warn("failed to record command origins", "workspace", config.Workspace, "err", err)
+	}
+	if err := workspace.AddTransfers(config.WorkspacePath, entries); err != nil {
+		slog.Warn("failed to record file transfers", "workspace", config.Workspace, "err", err)
+	}
+	if err := workspace.AddOutputs(config.WorkspacePath, outputs); err != nil {
+		slog.Warn("failed to store command output", "workspace", config.Workspace, "err", err)
+	}
+	// Readers look tags up in the tags file, as they do those added later
+	var tagged []workspace.Tagged
+	for _, r := range records {
+		if len(r.Tags) > 0 {
+			tagged = append(tagged, workspace.Tagged{Entry: r.Entry, Tags: r.Tags})
+		}
+	}
+	if err := workspace.AddTags(config.WorkspacePath, tagged); err != nil {
+		slog.Warn("failed to tag commands", "workspace", config.Workspace, "err", err)
+	}
+	evaluateBatch(config, batch, records)
+	return nil
+}
+
+// readBatch reads the records of r, one JSON object a line, skipping blank
+// lines. Records without a time are given now
+func readBatch(r io.Reader, now time.Time) ([]batchRecord, error) {
+	var batch []batchRecord
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.TrimSpace(line) != "" {
+			var rec batchRecord
+			if jsonErr := json.Unmarshal([]byte(line), &rec); jsonErr != nil {
+				return nil, fmt.Errorf("line %d: invalid record: %v", n, jsonErr)
+			}
+			if strings.TrimSpace(rec.Command) == "" {
+				return nil, fmt.Errorf("line %d: record has no command", n)
+			}
+			if strings.ContainsAny(rec.Host, "\t\r\n") {
+				return nil, fmt.Errorf("line %d: host must be one word", n)
+			}
+			if rec.Time.IsZero() {
+				rec.Time = now
+			}
+			batch = append(batch, rec)
+		}
+		if err == io.EOF {
+			return batch, nil
+		}
+	}
+}
+
+// batchRecords returns batch as workspace records, with the commands that
+// ran on each host and the output of those that have it. Commands are
+// flattened to a line as the history keeps them, so what is keyed on them
+// matches the history
+func batchRecords(batch []batchRecord) ([]workspace.Record, map[string][]workspace.Entry, []workspace.Output) {
+	host, _ := os.Hostname()
+	records := make([]workspace.Record, len(batch))
+	hosts := make(map[string][]workspace.Entry)
+	var outputs []workspace.Output
+	for i, b := range batch {
+		e := workspace.Entry{Command: workspace.FlattenCommand(b.Command), Time: b.Time}
+		records[i] = workspace.Record{Entry: e, Version: workspace.RecordV1, Tags: b.Tags}
+		if b.Exit != nil {
+			records[i].HasExit, records[i].Exit = true, *b.Exit
+		}
+		if b.Duration != nil {
+			records[i].HasDuration, records[i].Duration = true, time.Duration(*b.Duration)*time.Millisecond
+		}
+		h := b.Host
+		if h == "" {
+			h = host
+		}
+		hosts[h] = append(hosts[h], e)
+		if b.Output != "" {
+			outputs = append(outputs, workspace.Output{Entry: e, Output: b.Output})
+		}
+	}
+	return records, hosts, outputs
+}
+
+// evaluateBatch passes ingested records through the alert rules, as a
+// session's commands are, and tags the commands with the hits' tags
+func evaluateBatch(config *Config, batch []batchRecord, records []workspace.Record) {
+	engine, err := rules.NewEngine(workspace.ReadConfig(config.SettingsFile), config.HitLog)
+	if err != nil {
+		slog.Warn("failed to load rules", "settings", config.SettingsFile, "err", err)
+		return
+	}
+	if len(engine.Rules) == 0 {
+		return
+	}
+
+	events := sessionEvents(config, records)
+	for i, b := range batch {
+		if b.Host != "" {
+			events[i].Host = b.Host
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rulesTimeout)
+	defer cancel()
+	hits, err := engine.Evaluate(ctx, events)
+	if err != nil {
+		slog.Warn("rule actions failed", "err", err)
+	}
+	if err := workspace.AddTags(config.WorkspacePath, hitTags(hits)); err != nil {
+		slog.Warn("failed to tag commands", "workspace", config.Workspace, "err", err)
+	}
+}
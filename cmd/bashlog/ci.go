@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/migrate"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// ciOutputLimit is how much of each step's output is kept in the
+// workspace; the job's own log still has all of it
+const ciOutputLimit = 1 << 20
+
+// ciJobVariables name the job in the CI systems bashlog knows, to name the
+// workspace of a run after, first found first
+var ciJobVariables = []string{"GITHUB_RUN_ID", "CI_JOB_ID", "BUILD_TAG", "CIRCLE_BUILD_NUM", "BUILDKITE_BUILD_NUMBER"}
+
+// runCI implements "bashlog ci", which runs the steps of a CI job, one
+// command a line from a file or stdin, each in its own shell, printing
+// their output as they run, and records them, with their output, exit
+// status and duration, into a workspace of their own written out as a
+// tarball. Kept as a build artifact, it is reviewed like any recorded
+// session, once mounted with bashlog-mgr mount. The job stops at the first
+// step that fails, unless --keep-going, and ends with its status
+func runCI(args []string) error {
+	fs := flag.NewFlagSet("ci", flag.ContinueOnError)
+	file := fs.String("file", "", "File with the steps to run, one command a line (default: stdin)")
+	name := fs.String("name", "", "Name of the run's workspace (default: ci- and the job ID the CI system sets)")
+	artifact := fs.String("artifact", "", "Where to write the run's workspace, as a tarball (default: its name and .tar.gz, which bashlog-mgr mount names it after)")
+	shellName := fs.String("shell", "bash", "Shell each step is run with")
+	keepGoing := fs.Bool("keep-going", false, "Run every step even after one fails, ending with the first failure's status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: bashlog ci [--file steps] [--name name] [--artifact file] [--shell bash] [--keep-going]")
+	}
+
+	in := io.Reader(os.Stdin)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	steps, err := readSteps(in)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return errors.New("no steps to run")
+	}
+	if *name == "" {
+		*name = ciName()
+	} else if workspaceName(*name) != *name {
+		return fmt.Errorf("invalid workspace name '%s': names must contain only alphanumeric characters, hyphens, and underscores", *name)
+	}
+	if *artifact == "" {
+		*artifact = *name + ".tar.gz"
+	}
+	shellPath, err := exec.LookPath(*shellName)
+	if err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if err := configureSettings(homeDir); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp("", "bashlog-ci-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	config := &Config{
+		Workspace:     *name,
+		WorkspacePath: filepath.Join(tmp, *name),
+		SettingsFile:  filepath.Join(homeDir, ".bashlog", "config.txt"),
+		HitLog:        filepath.Join(homeDir, ".bashlog", "rule-hits.log"),
+	}
+	if err := createCIWorkspace(config.WorkspacePath, *name); err != nil {
+		return fmt.Errorf("failed to create the run's workspace: %w", err)
+	}
+
+	var batch []batchRecord
+	status := 0
+	for i, step := range steps {
+		if status != 0 && !*keepGoing {
+			fmt.Fprintf(os.Stderr, "bashlog: skipping %d step(s) after the failure\n", len(steps)-i)
+			break
+		}
+		rec := runStep(shellPath, step)
+		if *rec.Exit != 0 {
+			fmt.Fprintf(os.Stderr, "bashlog: step %d exited with status %d\n", i+1, *rec.Exit)
+			if status == 0 {
+				status = *rec.Exit
+			}
+		}
+		batch = append(batch, rec)
+	}
+
+	if err := ingestBatch(config, workspace.OriginScript, batch); err != nil {
+		return err
+	}
+	if err := writeCIArtifact(config.WorkspacePath, *artifact); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *artifact, err)
+	}
+	fmt.Fprintf(os.Stderr, "bashlog: recorded %d step(s) to %s (review with: bashlog-mgr mount %s)\n", len(batch), *artifact, *artifact)
+	if status != 0 {
+		return &exitError{code: status}
+	}
+	return nil
+}
+
+// readSteps reads the commands of r, one a line, joining lines ending in a
+// backslash to the next, as the shell does, and skipping blank lines and
+// # comments
+func readSteps(r io.Reader) ([]string, error) {
+	var steps []string
+	var pending string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := pending + scanner.Text()
+		pending = ""
+		if strings.HasSuffix(line, `\`) {
+			pending = line + "\n"
+			continue
+		}
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			steps = append(steps, line)
+		}
+	}
+	if strings.TrimSpace(pending) != "" {
+		steps = append(steps, strings.TrimSuffix(strings.TrimSuffix(pending, "\n"), `\`))
+	}
+	return steps, scanner.Err()
+}
+
+// runStep runs step with the shell at shellPath, passing its output through
+// to bashlog's, and returns it as a record of when it ran, how long for,
+// how it ended and what it printed
+func runStep(shellPath, step string) batchRecord {
+	fmt.Fprintf(os.Stderr, "+ %s\n", step)
+	out := &limitedBuffer{limit: ciOutputLimit}
+	cmd := exec.Command(shellPath, "-c", step)
+	cmd.Stdout = io.MultiWriter(os.Stdout, out)
+	cmd.Stderr = io.MultiWriter(os.Stderr, out)
+
+	started := time.Now()
+	err := shellStatus(cmd, cmd.Run())
+	ms := time.Since(started).Milliseconds()
+	code := exitStatus(err)
+	if err != nil && code == -1 {
+		fmt.Fprintf(os.Stderr, "bashlog: %v\n", err)
+		code = 127
+	}
+	return batchRecord{Command: step, Time: started, Exit: &code, Duration: &ms, Output: out.String()}
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and notes what
+// it leaves out. Stdout and stderr write to it from their own goroutines
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated by bashlog]\n"
+	}
+	return b.buf.String()
+}
+
+// ciName names the workspace of a run after the job ID the CI system
+// sets, or the time it started when there is none
+func ciName() string {
+	for _, v := range ciJobVariables {
+		if id := os.Getenv(v); id != "" {
+			return workspaceName("ci-" + id)
+		}
+	}
+	return "ci-" + time.Now().Format("20060102-150405")
+}
+
+// workspaceName replaces what a workspace name can't hold in s with
+// hyphens
+func workspaceName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// createCIWorkspace creates the workspace of a run at wsPath, as
+// bashlog-mgr create would with the settings' mode, kept in files so the
+// tarball holds it all
+func createCIWorkspace(wsPath, name string) error {
+	if err := fsperm.Default.MkdirAll(wsPath); err != nil {
+		return err
+	}
+	config := fmt.Sprintf("name=%s\ncreated=%s\ncommands=0\n%s=%s\n%s=%s\n%s=%d\n",
+		name, time.Now().Format(time.RFC3339), fsperm.Setting, fsperm.Default, storage.Setting, storage.Files,
+		migrate.LayoutKey, migrate.Latest())
+	return fsperm.Default.WriteFile(filepath.Join(wsPath, workspace.ConfigFile), []byte(config))
+}
+
+// writeCIArtifact writes the workspace at wsPath to path as a tarball
+func writeCIArtifact(wsPath, path string) error {
+	f, err := fsperm.Default.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if err := workspace.WriteArchive(f, wsPath); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
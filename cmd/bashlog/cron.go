@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/cron"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// cronTable is where the jobs of bashlog cron are kept, in ~/.bashlog
+const cronTable = "cron.txt"
+
+// cronTagPrefix starts the tag of a scheduled command naming its job, as
+// in cron:3
+const cronTagPrefix = "cron:"
+
+const cronUsage = `usage: bashlog cron add "<schedule> <command>" --workspace <name>
+       bashlog cron list
+       bashlog cron remove <id>
+       bashlog cron run [--shell /bin/sh]`
+
+// runCron implements "bashlog cron", which keeps jobs to run on a schedule,
+// written as crontab lines, each recording into a workspace. bashlog cron
+// run is the scheduler that runs them, meant to be kept running by the
+// service manager; it reads the jobs again every minute, so jobs added or
+// removed take effect without restarting it
+func runCron(args []string) error {
+	if len(args) == 0 {
+		return errors.New(cronUsage)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	table := filepath.Join(homeDir, ".bashlog", cronTable)
+
+	switch args[0] {
+	case "add":
+		return cronAdd(homeDir, table, args[1:])
+	case "list":
+		return cronList(table, args[1:])
+	case "remove":
+		return cronRemove(table, args[1:])
+	case "run":
+		return cronRun(homeDir, table, args[1:])
+	}
+	return fmt.Errorf("unknown cron command '%s'\n%s", args[0], cronUsage)
+}
+
+// cronAdd adds a job, checking its workspace exists first
+func cronAdd(homeDir, table string, args []string) error {
+	fs := flag.NewFlagSet("cron add", flag.ContinueOnError)
+	wsName := fs.String("workspace", "", "Workspace the job's runs are recorded into")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// The line comes before --workspace or after it
+	if fs.NArg() == 0 {
+		return errors.New(cronUsage)
+	}
+	line := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if *wsName == "" || fs.NArg() > 0 {
+		return errors.New(cronUsage)
+	}
+	schedule, command, err := cron.ParseLine(line)
+	if err != nil {
+		return err
+	}
+	config := &Config{SettingsFile: filepath.Join(homeDir, ".bashlog", "config.txt")}
+	if err := useWorkspace(config, *wsName); err != nil {
+		return err
+	}
+
+	jobs, err := cron.Load(table)
+	if err != nil {
+		return err
+	}
+	job := cron.Job{ID: cron.NextID(jobs), Workspace: *wsName, Schedule: schedule, Command: command}
+	if err := cron.Save(table, append(jobs, job)); err != nil {
+		return fmt.Errorf("failed to save the job: %w", err)
+	}
+	fmt.Printf("✓ Added job %d, recording into workspace '%s': %s\n", job.ID, job.Workspace, job)
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		fmt.Printf("  Next run %s, once bashlog cron run is running\n", next.Format("2006-01-02 15:04"))
+	} else {
+		fmt.Println("  Warning: the schedule never comes round")
+	}
+	return nil
+}
+
+// cronList prints the jobs and when each next runs
+func cronList(table string, args []string) error {
+	if len(args) > 0 {
+		return errors.New(cronUsage)
+	}
+	jobs, err := cron.Load(table)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs (add one with: bashlog cron add \"0 3 * * * backup.sh\" --workspace ops)")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tWORKSPACE\tSCHEDULE\tNEXT RUN\tCOMMAND")
+	now := time.Now()
+	for _, j := range jobs {
+		next := "never"
+		if t := j.Schedule.Next(now); !t.IsZero() {
+			next = t.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", j.ID, j.Workspace, j.Schedule, next, j.Command)
+	}
+	return w.Flush()
+}
+
+// cronRemove removes a job; a run under way finishes
+func cronRemove(table string, args []string) error {
+	if len(args) != 1 {
+		return errors.New(cronUsage)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid job id '%s'", args[0])
+	}
+	jobs, err := cron.Load(table)
+	if err != nil {
+		return err
+	}
+	for i, j := range jobs {
+		if j.ID == id {
+			if err := cron.Save(table, append(jobs[:i:i], jobs[i+1:]...)); err != nil {
+				return fmt.Errorf("failed to save the jobs: %w", err)
+			}
+			fmt.Printf("✓ Removed job %d: %s\n", id, j)
+			return nil
+		}
+	}
+	return fmt.Errorf("no job %d (see bashlog cron list)", id)
+}
+
+// cronRun is the scheduler: at the start of each minute it runs the jobs
+// due, each with the shell in a goroutine of its own, and records the run,
+// with its output, exit status and duration, into the job's workspace,
+// tagged with the job. A job still running when it is next due is not
+// started again. Minutes missed while the machine slept are skipped, as
+// cron does. It stops on SIGINT or SIGTERM once the runs under way end
+func cronRun(homeDir, table string, args []string) error {
+	fs := flag.NewFlagSet("cron run", flag.ContinueOnError)
+	shellName := fs.String("shell", "/bin/sh", "Shell each job is run with, as cron does")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(cronUsage)
+	}
+	shellPath, err := exec.LookPath(*shellName)
+	if err != nil {
+		return err
+	}
+	if err := configureSettings(homeDir); err != nil {
+		return err
+	}
+	if _, err := cron.Load(table); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running = make(map[int]bool)
+	)
+	slog.Info("cron scheduler started", "jobs", table)
+	next := time.Now().Truncate(time.Minute).Add(time.Minute)
+	for {
+		select {
+		case sig := <-signals:
+			if isResize(sig) {
+				continue
+			}
+			slog.Info("cron scheduler stopping, waiting for runs under way", "signal", sig.String())
+			wg.Wait()
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		minute := next
+		next = time.Now().Truncate(time.Minute).Add(time.Minute)
+		if next.Sub(minute) > time.Minute {
+			slog.Warn("cron scheduler fell behind, skipping missed minutes", "from", minute.Format("15:04"), "to", next.Add(-time.Minute).Format("15:04"))
+			minute = next.Add(-time.Minute)
+		}
+
+		jobs, err := cron.Load(table)
+		if err != nil {
+			slog.Error("failed to read cron jobs", "err", err)
+			continue
+		}
+		for _, job := range jobs {
+			if !job.Schedule.Due(minute) {
+				continue
+			}
+			mu.Lock()
+			busy := running[job.ID]
+			running[job.ID] = true
+			mu.Unlock()
+			if busy {
+				slog.Warn("cron job still running, skipping this run", "job", job.ID)
+				continue
+			}
+			wg.Add(1)
+			go func(job cron.Job) {
+				defer wg.Done()
+				defer func() {
+					mu.Lock()
+					delete(running, job.ID)
+					mu.Unlock()
+				}()
+				runCronJob(homeDir, shellPath, job)
+			}(job)
+		}
+	}
+}
+
+// runCronJob runs a job once and records the run into its workspace
+func runCronJob(homeDir, shellPath string, job cron.Job) {
+	config := &Config{
+		SettingsFile: filepath.Join(homeDir, ".bashlog", "config.txt"),
+		HitLog:       filepath.Join(homeDir, ".bashlog", "rule-hits.log"),
+	}
+	if err := useWorkspace(config, job.Workspace); err != nil {
+		slog.Error("cron job not run", "job", job.ID, "err", err)
+		return
+	}
+
+	slog.Info("cron job started", "job", job.ID, "command", job.Command)
+	out := &limitedBuffer{limit: ciOutputLimit}
+	cmd := exec.Command(shellPath, "-c", job.Command)
+	cmd.Dir = homeDir
+	cmd.Stdout, cmd.Stderr = out, out
+
+	started := time.Now()
+	err := shellStatus(cmd, cmd.Run())
+	ms := time.Since(started).Milliseconds()
+	code := exitStatus(err)
+	if err != nil && code == -1 {
+		io.WriteString(out, err.Error()+"\n")
+		code = 127
+	}
+	slog.Info("cron job finished", "job", job.ID, "exit", code, "duration", time.Duration(ms)*time.Millisecond)
+
+	rec := batchRecord{Command: job.Command, Time: started, Exit: &code, Duration: &ms, Output: out.String(),
+		Tags: []string{cronTagPrefix + strconv.Itoa(job.ID)}}
+	if err := ingestBatch(config, workspace.OriginScript, []batchRecord{rec}); err != nil {
+		slog.Error("failed to record cron job", "job", job.ID, "err", err)
+	}
+}
@@ -0,0 +1,369 @@
+//go:build !agent
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/remote"
+	"github.com/interhack86/bashlog/internal/shell"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// doctorTimeout bounds each check that runs a shell or reaches the server
+const doctorTimeout = 10 * time.Second
+
+// maxClockSkew is how far this machine's clock may drift from the
+// server's before recorded times stop lining up across machines
+const maxClockSkew = 5 * time.Second
+
+// doctorProbe is the command run in a test session to see the shell's
+// hook record it
+const doctorProbe = "echo bashlog-doctor-probe"
+
+// syntaxCheck is how each shell is asked to parse a script without
+// running it; shells missing here only get the live check
+var syntaxCheck = map[string][]string{
+	"bash": {"-n"},
+	"zsh":  {"-n"},
+	"fish": {"--no-execute"},
+	"sh":   {"-n"},
+}
+
+// doctor collects the outcome of the checks
+type doctor struct {
+	problems, warnings int
+}
+
+func (d *doctor) ok(check, format string, args ...any) {
+	fmt.Printf("✓ %-12s %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(check, fix, format string, args ...any) {
+	d.warnings++
+	fmt.Printf("! %-12s %s\n", check, fmt.Sprintf(format, args...))
+	if fix != "" {
+		fmt.Printf("  %-12s fix: %s\n", "", fix)
+	}
+}
+
+func (d *doctor) fail(check, fix, format string, args ...any) {
+	d.problems++
+	fmt.Printf("✗ %-12s %s\n", check, fmt.Sprintf(format, args...))
+	if fix != "" {
+		fmt.Printf("  %-12s fix: %s\n", "", fix)
+	}
+}
+
+// runDoctor checks that sessions can be recorded as configured: the shell
+// and its generated init script, the hook that records commands, the
+// permissions of the log directories, the remote server and the clock
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	shellName := fs.String("shell", "", "Shell to check, by name or path (default: $SHELL)")
+	tz := fs.String("tz", "UTC", "Timezone sessions are logged in, as given to bashlog --tz")
+	remoteURL := fs.String("remote", "", "bashlog-mgr serve URL to check (default: remote.url setting)")
+	token := fs.String("token", os.Getenv("BASHLOG_TOKEN"), "API token for --remote (default: $BASHLOG_TOKEN, then remote.token setting)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dataDir := filepath.Join(homeDir, ".bashlog")
+	settingsPath := filepath.Join(dataDir, "config.txt")
+	settings := workspace.ReadConfig(settingsPath)
+
+	d := &doctor{}
+	if err := fsperm.Configure(settings); err != nil {
+		d.fail("settings", "set files.mode to private, group or an octal mode such as 0640 in "+settingsPath, "%v", err)
+	}
+	prefix, err := incognitoPrefix(&Config{SettingsFile: settingsPath}, "")
+	if err != nil {
+		d.fail("settings", "fix incognito.prefix in "+settingsPath, "%v", err)
+	}
+	d.checkShell(*shellName, prefix)
+	d.checkPermissions(dataDir, settingsPath, settings, filepath.Join(homeDir, ".bashlog-workspaces"))
+	skew, haveSkew := d.checkRemote(settings, *remoteURL, *token, filepath.Join(dataDir, "spool"))
+	d.checkClock(*tz, skew, haveSkew)
+
+	fmt.Println()
+	switch {
+	case d.problems > 0:
+		fmt.Printf("%d problem(s), %d warning(s)\n", d.problems, d.warnings)
+		return fmt.Errorf("sessions may not be recorded as expected")
+	case d.warnings > 0:
+		fmt.Printf("No problems, %d warning(s)\n", d.warnings)
+	default:
+		fmt.Println("No problems found")
+	}
+	return nil
+}
+
+// checkShell resolves the shell, looks for the hook install-hooks adds to
+// its startup file, checks the init script bashlog generates for it
+// parses, and starts a test session to see its hook record a
+// command
+func (d *doctor) checkShell(name, incognito string) {
+	adapter, path, err := resolveShell(name)
+	if err != nil {
+		d.fail("shell", "set $SHELL, or pass --shell, to one of "+strings.Join(shell.Names(), ", ")+" listed in /etc/shells", "%v", err)
+		return
+	}
+	version, err := adapter.DetectVersion(path)
+	if err != nil {
+		d.warn("shell", "", "%s at %s, version unknown: %v", adapter.Name(), path, err)
+	} else {
+		d.ok("shell", "%s %s at %s", adapter.Name(), version, path)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if rc, ok := shell.HookInstalled(adapter.Name(), home); ok {
+			d.ok("startup", "new %s shells start under bashlog (hook in %s)", adapter.Name(), rc)
+		} else {
+			d.ok("startup", "only shells started with bashlog are recorded; bashlog install-hooks records every new one")
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "bashlog-doctor-")
+	if err != nil {
+		d.fail("init script", "", "could not create a scratch directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	opts := shell.InitOptions{
+		SessionID: "doctor",
+		Timezone:  "UTC",
+		LogDir:    dir,
+		HistFile:  filepath.Join(dir, "."+adapter.Name()+"_history"),
+		SearchKey: true,
+		Escalate:  true,
+		Sources:   true,
+
+		IncognitoPrefix: incognito,
+	}
+	content, err := adapter.GenerateInit(opts)
+	if err != nil {
+		d.fail("init script", "report this as a bug, with the shell and version above", "could not be generated: %v", err)
+		return
+	}
+	initFile := filepath.Join(dir, "init", adapter.InitFileName())
+	os.MkdirAll(filepath.Dir(initFile), 0700)
+	if err := os.WriteFile(initFile, []byte(content), 0600); err != nil {
+		d.fail("init script", "", "could not be written: %v", err)
+		return
+	}
+
+	if flags, ok := syntaxCheck[adapter.Name()]; ok {
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		out, err := exec.CommandContext(ctx, path, append(flags, initFile)...).CombinedOutput()
+		cancel()
+		if err != nil {
+			d.fail("init script", "report this as a bug, with the shell version and this output", "%s rejects the generated script: %s", adapter.Name(), firstLine(out, err))
+			return
+		}
+		d.ok("init script", "generated script parses")
+	}
+
+	// Start the shell as a session would, but read commands from a pipe
+	args, env := adapter.LaunchArgs(initFile, false)
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), "BASHLOG_SESSION_ID=doctor", "BASHLOG_LOG_FILE="+filepath.Join(dir, "session.log"))
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdin = strings.NewReader(doctorProbe + "\nexit\n")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	runErr := cmd.Run()
+
+	entries, _ := workspace.ReadHistory(opts.HistFile)
+	for _, e := range entries {
+		if e.Command == doctorProbe {
+			d.ok("hook", "commands are recorded")
+			return
+		}
+	}
+	var warning string
+	for _, line := range strings.Split(output.String(), "\n") {
+		if strings.HasPrefix(line, "bashlog: ") {
+			warning = strings.TrimSpace(strings.TrimPrefix(line, "bashlog: "))
+		}
+	}
+	switch {
+	case warning != "":
+		d.fail("hook", "record a shell bashlog supports fully, e.g. --shell bash", "%s", warning)
+	case ctx.Err() != nil:
+		d.fail("hook", "check your shell startup files for commands that wait for input", "the test session didn't finish within %s", doctorTimeout)
+	case runErr != nil && len(entries) == 0:
+		d.fail("hook", "check your shell startup files, which the session loads", "the test session failed: %s", firstLine(output.Bytes(), runErr))
+	default:
+		d.fail("hook", "check your shell startup files don't reset "+histVariable(adapter.Name())+" or the prompt hooks after bashlog sets them", "a test command wasn't recorded")
+	}
+}
+
+// histVariable is what a startup file would override to stop recording
+func histVariable(shellName string) string {
+	switch shellName {
+	case "bash":
+		return "HISTFILE, PROMPT_COMMAND"
+	case "zsh":
+		return "preexec_functions"
+	}
+	return "the history settings"
+}
+
+func firstLine(out []byte, err error) string {
+	if line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n"); line != "" {
+		return line
+	}
+	return err.Error()
+}
+
+// checkPermissions checks the log directories can be written, and that
+// what they record isn't open to other users
+func (d *doctor) checkPermissions(dataDir, settingsPath string, settings map[string]string, workspacesDir string) {
+	logsDir := filepath.Join(dataDir, "logs")
+	if err := fsperm.Default.MkdirAll(logsDir); err != nil {
+		d.fail("logs", "make sure "+dataDir+" is a directory you own: ls -ld "+dataDir, "can't create %s: %v", logsDir, err)
+		return
+	}
+	probe, err := os.CreateTemp(logsDir, ".doctor-")
+	if err != nil {
+		d.fail("logs", "chown -R $USER "+dataDir+" && chmod u+rwx "+logsDir, "%s isn't writable: %v", logsDir, err)
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	var open []string
+	for _, dir := range []string{dataDir, logsDir, workspacesDir} {
+		if info, err := os.Stat(dir); err == nil && info.Mode().Perm()&0004 != 0 {
+			open = append(open, dir)
+		}
+	}
+	if len(open) > 0 {
+		d.warn("logs", "chmod -R go-rwx "+strings.Join(open, " "), "other users can read %s, and the commands recorded there", strings.Join(open, ", "))
+	} else {
+		d.ok("logs", "%s is writable and private", logsDir)
+	}
+
+	secret := false
+	for key := range settings {
+		if strings.HasPrefix(key, "api.token.") || key == "remote.token" || strings.HasPrefix(key, "protect.") {
+			secret = true
+		}
+	}
+	if info, err := os.Stat(settingsPath); err == nil && secret && info.Mode().Perm()&0077 != 0 {
+		d.warn("settings", "chmod 600 "+settingsPath, "%s holds tokens or passphrases but is readable by others", settingsPath)
+	}
+}
+
+// checkRemote checks the server sessions are shipped to, if any, answers
+// and accepts the token, returning how far its clock is from ours
+func (d *doctor) checkRemote(settings map[string]string, url, token, spool string) (time.Duration, bool) {
+	if url == "" {
+		url = settings["remote.url"]
+	}
+	if token == "" {
+		token = settings["remote.token"]
+	}
+	if url == "" {
+		return 0, false
+	}
+
+	pending := (&remote.Client{Spool: spool}).Pending()
+	if pending > 0 {
+		d.warn("spool", "they are sent when the next session ends; check the server below is reachable", "%d batch(es) of commands are waiting in %s", pending, spool)
+	}
+	if token == "" {
+		d.fail("remote", "pass --token, set $BASHLOG_TOKEN or add remote.token=<token> to the settings", "%s is set but no token is", url)
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(url, "/")+"/api/v1/workspaces?limit=1", nil)
+	if err != nil {
+		d.fail("remote", "set remote.url to the server's address, e.g. https://collector:8443", "invalid URL %s: %v", url, err)
+		return 0, false
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	sent := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		d.fail("remote", "check bashlog-mgr serve is running on the server, and that "+url+" is the address it listens on", "%s is unreachable: %v", url, err)
+		return 0, false
+	}
+	resp.Body.Close()
+	rtt := time.Since(sent)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		d.ok("remote", "%s accepts the token (%s)", url, rtt.Round(time.Millisecond))
+	case http.StatusUnauthorized:
+		d.fail("remote", "ask the server's admin for a token set as api.token.<name> in its settings", "%s doesn't accept the token", url)
+	default:
+		d.fail("remote", "check "+url+" is a bashlog-mgr serve instance", "%s answered %s", url, resp.Status)
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	// The Date header has second precision and was stamped mid-request
+	return sent.Add(rtt / 2).Sub(date), true
+}
+
+// checkClock checks the timezone sessions are logged in exists and the
+// clock agrees with the server's, since commands from several machines
+// are ordered by time
+func (d *doctor) checkClock(tz string, skew time.Duration, haveSkew bool) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		d.fail("timezone", "pass a zone from the tz database, e.g. --tz Europe/Berlin, or install its data (tzdata)", "'%s' is not a known timezone: %v", tz, err)
+		return
+	}
+	now := time.Now()
+	_, configured := now.In(loc).Zone()
+	localName, local := now.Zone()
+	if configured != local {
+		d.warn("timezone", "pass --tz with your zone if you'd rather days follow local time", "sessions are logged in %s (%s) while this machine is on %s (%s), so their dates follow %s days", tz, formatOffset(configured), localName, formatOffset(local), tz)
+	} else {
+		d.ok("timezone", "sessions are logged in %s", tz)
+	}
+
+	if !haveSkew {
+		return
+	}
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew+time.Second {
+		d.fail("clock", "enable time synchronization, e.g. sudo timedatectl set-ntp true", "this machine's clock is %s off the server's", skew.Round(time.Second))
+		return
+	}
+	d.ok("clock", "within %s of the server's", maxClockSkew)
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
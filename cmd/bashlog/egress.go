@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// egressInterval is how often the session's sockets are sampled. A
+// connection opened and closed in between goes unseen
+const egressInterval = 250 * time.Millisecond
+
+// maxEgress bounds the connections kept for one session
+const maxEgress = 500
+
+// egressMonitor samples the outbound connections of the recorded shell
+// and every process it starts
+type egressMonitor struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	conns []session.Connection
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+	done     chan struct{}
+}
+
+// newEgressMonitor checks outbound connections can be watched here
+func newEgressMonitor() (*egressMonitor, error) {
+	if err := egressSupported(); err != nil {
+		return nil, err
+	}
+	return &egressMonitor{
+		seen:    make(map[string]bool),
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// start samples the connections of pid and its descendants until stop
+func (m *egressMonitor) start(pid int) {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(egressInterval)
+		defer ticker.Stop()
+		for {
+			m.add(sampleEgress(pid))
+			select {
+			case <-m.stopped:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop ends sampling, waiting for a sample under way
+func (m *egressMonitor) stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopped)
+		<-m.done
+	})
+}
+
+func (m *egressMonitor) add(conns []session.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range conns {
+		key := c.Proto + " " + c.Remote
+		if m.seen[key] || len(m.conns) >= maxEgress {
+			continue
+		}
+		m.seen[key] = true
+		m.conns = append(m.conns, c)
+	}
+}
+
+// connections returns the distinct connections seen, in the order they
+// were first seen
+func (m *egressMonitor) connections() []session.Connection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]session.Connection(nil), m.conns...)
+}
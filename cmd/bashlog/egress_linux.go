@@ -0,0 +1,178 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// egressSupported checks /proc exposes the socket tables
+func egressSupported() error {
+	if _, err := os.Stat("/proc/net/tcp"); err != nil {
+		return fmt.Errorf("--egress needs /proc: %w", err)
+	}
+	return nil
+}
+
+// sampleEgress returns the outbound connections held right now by root
+// and its descendants: sockets they have open that the kernel's socket
+// tables list as connected to another machine. Connections accepted from
+// elsewhere, and ones to this machine, aren't egress and are left out
+func sampleEgress(root int) []session.Connection {
+	// The socket inodes the processes hold, and which process holds each
+	sockets := make(map[string]string)
+	for pid, comm := range descendants(root) {
+		dir := fmt.Sprintf("/proc/%d/fd", pid)
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(dir + "/" + fd.Name())
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				sockets[strings.TrimSuffix(inode, "]")] = comm
+			}
+		}
+	}
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	var conns []session.Connection
+	for _, table := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		conns = append(conns, connectedSockets(fmt.Sprintf("/proc/%d/net/%s", root, table), strings.TrimSuffix(table, "6"), sockets)...)
+	}
+	return conns
+}
+
+// tcpListen is the state of a listening TCP socket in /proc/net/tcp
+const tcpListen = "0A"
+
+// connectedSockets reads a /proc/net socket table, returning the outbound
+// connections of the sockets listed
+func connectedSockets(path, proto string, sockets map[string]string) []session.Connection {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	type socket struct {
+		local, remote netip.AddrPort
+		state, inode  string
+	}
+	var table []socket
+	listening := make(map[uint16]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // The header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err1 := parseProcAddr(fields[1])
+		remote, err2 := parseProcAddr(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		s := socket{local: local, remote: remote, state: fields[3], inode: fields[9]}
+		if proto == "tcp" && s.state == tcpListen {
+			listening[local.Port()] = true
+		}
+		table = append(table, s)
+	}
+
+	var conns []session.Connection
+	for _, s := range table {
+		comm, ok := sockets[s.inode]
+		if !ok || s.remote.Port() == 0 || s.remote.Addr().IsLoopback() || s.remote.Addr().IsUnspecified() {
+			continue
+		}
+		if proto == "tcp" && (s.state == tcpListen || listening[s.local.Port()]) {
+			continue
+		}
+		conns = append(conns, session.Connection{Proto: proto, Remote: s.remote.String(), Process: comm})
+	}
+	return conns
+}
+
+// parseProcAddr parses an address as /proc/net tables print it: the IP
+// in hex, as the 32-bit words it is stored in, in host (little-endian)
+// order, then the port in hex
+func parseProcAddr(s string) (netip.AddrPort, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q", s)
+	}
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil || len(raw) != 4 && len(raw) != 16 {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid port in %q", s)
+	}
+	ip, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(ip.Unmap(), uint16(port)), nil
+}
+
+// descendants returns root and every process below it, with the command
+// name each runs
+func descendants(root int) map[int]string {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	children := make(map[int][]int)
+	comms := make(map[int]string)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// "pid (comm) state ppid ...", where comm may hold spaces and
+		// parentheses of its own
+		lparen, rparen := strings.IndexByte(string(stat), '('), strings.LastIndexByte(string(stat), ')')
+		if lparen < 0 || rparen < lparen {
+			continue
+		}
+		fields := strings.Fields(string(stat[rparen+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		children[ppid] = append(children[ppid], pid)
+		comms[pid] = string(stat[lparen+1 : rparen])
+	}
+
+	found := make(map[int]string)
+	queue := []int{root}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if _, ok := found[pid]; ok {
+			continue
+		}
+		found[pid] = comms[pid]
+		queue = append(queue, children[pid]...)
+	}
+	return found
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// egressSupported fails, as connections are sampled from /proc
+func egressSupported() error {
+	return errors.New("--egress needs Linux, where connections are sampled from /proc")
+}
+
+func sampleEgress(pid int) []session.Connection {
+	return nil
+}
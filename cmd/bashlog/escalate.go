@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// escalation is a privileged shell about to be started with sudo or su
+type escalation struct {
+	// user is who the shell runs as and method how it was asked for, as
+	// typed, such as "sudo -i"
+	user   string
+	method string
+	login  bool
+	// pty asks for the shell to get a terminal of its own, for su, which
+	// detaches the command it runs from the caller's
+	pty bool
+
+	// wrap returns the tool's arguments starting child in place of the
+	// shell
+	wrap func(child []string) []string
+}
+
+// runEscalate implements "bashlog escalate sudo|su [arguments]", run by
+// the session's sudo and su shell functions. When they start a privileged
+// shell, as with sudo -i, sudo -s or su -, the shell is started under
+// bashlog instead, as a child session linked to this one and recorded by
+// the user it runs as. Anything else, such as sudo running a command, is
+// handed to the tool untouched
+func runEscalate(args []string) error {
+	if len(args) == 0 || args[0] != "sudo" && args[0] != "su" {
+		return errors.New("usage: bashlog escalate sudo|su [arguments]")
+	}
+	tool := args[0]
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return err
+	}
+
+	argv := args
+	if e, ok := parseEscalation(tool, args[1:]); ok && os.Getenv("BASHLOG_SESSION_ID") != "" {
+		if child, err := escalatedSession(e); err != nil {
+			fmt.Fprintf(os.Stderr, "bashlog: not recording the shell started with %s: %v\n", e.method, err)
+		} else {
+			argv = append([]string{tool}, e.wrap(child)...)
+			noteEscalation(e)
+		}
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// parseEscalation reports whether the arguments to sudo or su start an
+// interactive shell, and how
+func parseEscalation(tool string, args []string) (*escalation, bool) {
+	if tool == "sudo" {
+		return parseSudo(args)
+	}
+	return parseSu(args)
+}
+
+// sudoValueOptions are the sudo options taking a value
+var sudoValueOptions = map[string]bool{
+	"-C": true, "-D": true, "-g": true, "-h": true, "-p": true, "-R": true, "-r": true, "-T": true, "-t": true, "-U": true, "-u": true,
+	"--close-from": true, "--chdir": true, "--group": true, "--host": true, "--prompt": true, "--chroot": true,
+	"--role": true, "--type": true, "--command-timeout": true, "--other-user": true, "--user": true,
+}
+
+// parseSudo recognizes sudo -i and sudo -s without a command, and sudo
+// su starting a shell
+func parseSudo(args []string) (*escalation, bool) {
+	e := &escalation{user: "root", method: strings.Join(append([]string{"sudo"}, args...), " ")}
+	shell := false
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch {
+			case name == "--login":
+				shell, e.login = true, true
+			case name == "--shell":
+				shell = true
+			case name == "--edit" || name == "--list" || name == "--validate" || name == "--version" || name == "--help" || name == "--background":
+				return nil, false
+			case sudoValueOptions[name]:
+				if !hasValue {
+					if i++; i == len(args) {
+						return nil, false
+					}
+					value = args[i]
+				}
+				if name == "--user" {
+					e.user = value
+				}
+			}
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			opt := "-" + arg[j:j+1]
+			switch {
+			case opt == "-i":
+				shell, e.login = true, true
+			case opt == "-s":
+				shell = true
+			case strings.Contains("elvVKb", arg[j:j+1]):
+				return nil, false
+			case sudoValueOptions[opt]:
+				value := arg[j+1:]
+				if value == "" {
+					if i++; i == len(args) {
+						return nil, false
+					}
+					value = args[i]
+				}
+				if opt == "-u" {
+					e.user = value
+				}
+				j = len(arg)
+			}
+		}
+	}
+	options, command := args[:i], args[i:]
+
+	if len(command) > 0 && filepath.Base(command[0]) == "su" {
+		su, ok := parseSu(command[1:])
+		if !ok {
+			return nil, false
+		}
+		su.method = e.method
+		wrapSu := su.wrap
+		su.wrap = func(child []string) []string {
+			return append(append(append([]string{}, options...), command[0]), wrapSu(child)...)
+		}
+		return su, true
+	}
+	if !shell || len(command) > 0 {
+		return nil, false
+	}
+	e.wrap = func(child []string) []string {
+		return append(append(append([]string{}, options...), "--"), child...)
+	}
+	return e, true
+}
+
+// suValueOptions are the su options taking a value
+var suValueOptions = map[string]bool{
+	"-s": true, "-g": true, "-G": true, "-w": true,
+	"--shell": true, "--group": true, "--supp-group": true, "--whitelist-environment": true,
+}
+
+// parseSu recognizes su starting a shell, that is without -c
+func parseSu(args []string) (*escalation, bool) {
+	e := &escalation{user: "root", method: strings.Join(append([]string{"su"}, args...), " ")}
+	var options, operands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-" || arg == "-l" || arg == "--login":
+			e.login = true
+		case arg == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case arg == "-c" || strings.HasPrefix(arg, "--command") || strings.HasPrefix(arg, "--session-command"):
+			return nil, false
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg, "=")
+			options = append(options, arg)
+			if suValueOptions[name] && !hasValue {
+				if i++; i == len(args) {
+					return nil, false
+				}
+				options = append(options, args[i])
+			}
+		case strings.HasPrefix(arg, "-"):
+			if strings.ContainsRune(arg, 'c') && !suValueOptions[arg[:2]] {
+				return nil, false
+			}
+			options = append(options, arg)
+			if suValueOptions[arg] {
+				if i++; i == len(args) {
+					return nil, false
+				}
+				options = append(options, args[i])
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	// Words after the user are arguments to the shell, which bashlog
+	// can't pass on
+	if len(operands) > 1 {
+		return nil, false
+	}
+	if len(operands) == 1 {
+		e.user = operands[0]
+	}
+
+	e.pty = true
+	e.wrap = func(child []string) []string {
+		args := append([]string{}, options...)
+		if e.login {
+			args = append(args, "-l")
+		}
+		quoted := make([]string, len(child))
+		for i, word := range child {
+			quoted[i] = quoteShell(word)
+		}
+		args = append(args, "-c", strings.Join(quoted, " "))
+		return append(args, operands...)
+	}
+	return e, true
+}
+
+// escalatedSession returns the command the privileged side runs: bashlog
+// itself, with the session's ID and depth passed across the environment
+// sudo and su reset. HOME is set explicitly so the shell is recorded in
+// the target user's own logs, never in files this user could tamper with
+func escalatedSession(e *escalation) ([]string, error) {
+	target, err := lookupUser(e.user)
+	if err != nil {
+		return nil, err
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(target.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("can't tell the user ID of %s", target.Username)
+	}
+	// The privileged side runs this binary, so it must not be one this
+	// user could swap for something else
+	if err := replaceableBy(bin, uid); err != nil {
+		return nil, fmt.Errorf("%v; install bashlog where only %s can write, such as /usr/local/bin", err, target.Username)
+	}
+
+	from := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		from = current.Username
+	}
+	child := []string{
+		"env",
+		"HOME=" + target.HomeDir,
+		"BASHLOG_SESSION_ID=" + os.Getenv("BASHLOG_SESSION_ID"),
+		"BASHLOG_SESSION_DEPTH=" + os.Getenv("BASHLOG_SESSION_DEPTH"),
+		"BASHLOG_WORKSPACE=",
+		bin, "--nested", "link", "--escalated-from", from, "--escalation", e.method,
+	}
+	if e.login {
+		child = append(child, "--login")
+	}
+	if e.pty {
+		child = append(child, "--pty")
+	}
+	return child, nil
+}
+
+// lookupUser finds the user sudo -u and su take, by name or, in sudo's
+// #uid form, by ID
+func lookupUser(name string) (*user.User, error) {
+	if id, ok := strings.CutPrefix(name, "#"); ok {
+		return user.LookupId(id)
+	}
+	return user.Lookup(name)
+}
+
+// noteEscalation records, next to the session's metadata, that it started
+// the shell, which the user may not be able to read the recording of
+func noteEscalation(e *escalation) {
+	logFile := os.Getenv("BASHLOG_LOG_FILE")
+	if logFile == "" {
+		return
+	}
+	metaPath := strings.TrimSuffix(logFile, ".log") + ".meta"
+	err := session.RecordEscalation(metaPath, session.Escalation{Time: time.Now(), User: e.user, Method: e.method})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bashlog: failed to note the escalation in the session: %v\n", err)
+	}
+}
+
+// quoteShell quotes s as a single word for the shell su runs its command
+// with
+func quoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
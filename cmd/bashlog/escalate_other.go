@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// replaceableBy fails, as there is no sudo or su to escalate with here
+func replaceableBy(path string, uid int) error {
+	return errors.New("privileged shells can't be recorded on this platform")
+}
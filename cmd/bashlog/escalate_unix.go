@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// replaceableBy returns an error when anyone but root or the user uid
+// could replace the file at path, by owning or being able to write to it
+// or its directory. A sticky directory such as /tmp only lets them
+// replace their own files
+func replaceableBy(path string, uid int) error {
+	for _, p := range []string{path, filepath.Dir(path)} {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("can't tell who owns %s", p)
+		}
+		if st.Uid != 0 && int(st.Uid) != uid {
+			return fmt.Errorf("%s belongs to another user", p)
+		}
+		if info.Mode().Perm()&0022 != 0 && !(info.IsDir() && info.Mode()&os.ModeSticky != 0) {
+			return fmt.Errorf("%s is writable by other users", p)
+		}
+	}
+	return nil
+}
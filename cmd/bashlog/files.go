@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// maxFileEvents bounds the file events kept for one session
+const maxFileEvents = 100000
+
+// fileEvent is a change to a file, as the watcher saw it happen
+type fileEvent struct {
+	time time.Time
+	op   string
+	path string
+}
+
+// fileWatcher records the files created, modified and deleted in a
+// directory tree while the session runs, so they can be put down to the
+// commands that made them
+type fileWatcher struct {
+	root string
+	// skip are directories left unwatched: bashlog's own, whose changes
+	// are the recording itself, and .git directories
+	skip []string
+
+	mu      sync.Mutex
+	events  []fileEvent
+	dropped bool
+
+	// stop ends watching, once the events under way have been read
+	stop func()
+}
+
+// watchedTree returns the directory --watch-files watches, the working
+// directory, and the directories in it to leave out
+func watchedTree(config *Config) (string, []string, error) {
+	root, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil, err
+	}
+	skip := []string{filepath.Join(homeDir, ".bashlog")}
+	for _, r := range workspace.Roots(workspace.ReadConfig(config.SettingsFile), filepath.Join(homeDir, ".bashlog-workspaces")) {
+		skip = append(skip, r.Path)
+	}
+	return root, skip, nil
+}
+
+// skipped reports whether dir is left unwatched
+func (w *fileWatcher) skipped(dir string) bool {
+	if filepath.Base(dir) == ".git" {
+		return true
+	}
+	for _, s := range w.skip {
+		if dir == s || strings.HasPrefix(dir, s+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// record notes a change to path, given relative to the watched tree
+func (w *fileWatcher) record(op, path string, isDir bool, t time.Time) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return
+	}
+	if isDir {
+		rel += "/"
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.events) >= maxFileEvents {
+		if !w.dropped {
+			slog.Warn("too many file changes, no longer recording them", "limit", maxFileEvents)
+			w.dropped = true
+		}
+		return
+	}
+	w.events = append(w.events, fileEvent{time: t, op: op, path: rel})
+}
+
+// recordChanges stops watching files and records what the session's
+// commands changed on disk
+func recordChanges(config *Config) {
+	if config.Files == nil {
+		return
+	}
+	config.Files.stop()
+
+	entries, err := sessionEntries(config)
+	if err != nil {
+		slog.Warn("failed to read session history", "err", err)
+	}
+	config.Files.mu.Lock()
+	changes := changesByCommand(config.Files.events, entries)
+	config.Files.mu.Unlock()
+	if err := session.WriteChanges(config.MetaFile, changes); err != nil {
+		slog.Warn("failed to record file changes", "err", err)
+	}
+}
+
+// changesByCommand puts each file event down to the command running when
+// it happened, the last one started before it, and merges the events of
+// each file into what the command did to it overall. History times
+// commands to the second, so a change made in the second another command
+// started is put down to that one
+func changesByCommand(events []fileEvent, entries []workspace.Entry) []session.CommandChanges {
+	type changed struct {
+		ops   map[string]string
+		order []string
+	}
+	byCommand := make(map[int]*changed)
+	for _, ev := range events {
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].Time.After(ev.time) }) - 1
+		c := byCommand[i]
+		if c == nil {
+			c = &changed{ops: make(map[string]string)}
+			byCommand[i] = c
+		}
+		op, seen := c.ops[ev.path]
+		if !seen {
+			c.order = append(c.order, ev.path)
+			op = ev.op
+		} else if op == "" {
+			op = ev.op
+		} else {
+			op = session.MergeChange(op, ev.op)
+		}
+		c.ops[ev.path] = op
+	}
+
+	var indexes []int
+	for i := range byCommand {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var changes []session.CommandChanges
+	for _, i := range indexes {
+		cc := session.CommandChanges{}
+		if i >= 0 {
+			cc.Time, cc.Command = entries[i].Time, entries[i].Command
+		} else if len(events) > 0 {
+			cc.Time = events[0].time
+		}
+		for _, path := range byCommand[i].order {
+			if op := byCommand[i].ops[path]; op != "" {
+				cc.Changes = append(cc.Changes, session.Change{Op: op, Path: path})
+			}
+		}
+		if len(cc.Changes) > 0 {
+			changes = append(changes, cc)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// fileWatchMask is what inotify reports for each watched directory
+const fileWatchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// maxWatchedDirs bounds the directories watched, well below the usual
+// per-user inotify limit so other programs can still watch theirs
+const maxWatchedDirs = 8192
+
+// stopDrain is how long stopping waits for events still queued
+const stopDrain = 50 * time.Millisecond
+
+// inotifyWatch watches a tree's directories with inotify, adding the
+// directories created in it as they appear
+type inotifyWatch struct {
+	w    *fileWatcher
+	fd   int
+	file *os.File
+	dirs map[int32]string
+
+	full     bool
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newFileWatcher starts watching the tree at root, but for the
+// directories in skip
+func newFileWatcher(root string, skip []string) (*fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("can't watch files: %w", err)
+	}
+	w := &fileWatcher{root: root, skip: skip}
+	in := &inotifyWatch{
+		w:    w,
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int32]string),
+		done: make(chan struct{}),
+	}
+	in.watchTree(root, time.Time{})
+	if len(in.dirs) == 0 {
+		in.file.Close()
+		return nil, fmt.Errorf("can't watch %s for changes", root)
+	}
+	w.stop = in.stop
+	go in.read()
+	return w, nil
+}
+
+// watchTree watches dir and the directories below it. For a directory
+// created during the session, at created, what is already in it was
+// created too, before its watch was in place
+func (in *inotifyWatch) watchTree(dir string, created time.Time) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if !created.IsZero() {
+				in.w.record(session.ChangeCreated, path, false, created)
+			}
+			return nil
+		}
+		if in.w.skipped(path) {
+			return filepath.SkipDir
+		}
+		if len(in.dirs) >= maxWatchedDirs {
+			if !in.full {
+				slog.Warn("too many directories to watch, leaving the rest out", "limit", maxWatchedDirs)
+				in.full = true
+			}
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(in.fd, path, fileWatchMask)
+		if err != nil {
+			return filepath.SkipDir
+		}
+		in.dirs[int32(wd)] = path
+		if !created.IsZero() && path != dir {
+			in.w.record(session.ChangeCreated, path, true, created)
+		}
+		return nil
+	})
+}
+
+// read handles events until stopped
+func (in *inotifyWatch) read() {
+	defer close(in.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := in.file.Read(buf)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			if start+nameLen > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			off = start + nameLen
+			in.handle(wd, mask, name, now)
+		}
+	}
+}
+
+// handle records one event, watching directories created in the tree
+func (in *inotifyWatch) handle(wd int32, mask uint32, name string, t time.Time) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		slog.Warn("file changes came too fast to follow, some were missed")
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(in.dirs, wd)
+		return
+	}
+	dir, ok := in.dirs[wd]
+	if !ok || name == "" {
+		return
+	}
+	path := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if isDir && in.w.skipped(path) {
+		return
+	}
+
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		in.w.record(session.ChangeCreated, path, isDir, t)
+		if isDir {
+			in.watchTree(path, t)
+		}
+	case mask&syscall.IN_CLOSE_WRITE != 0:
+		in.w.record(session.ChangeModified, path, false, t)
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		in.w.record(session.ChangeDeleted, path, isDir, t)
+		if isDir && mask&syscall.IN_MOVED_FROM != 0 {
+			in.unwatchTree(path)
+		}
+	}
+}
+
+// unwatchTree stops watching a directory moved away, whose watches would
+// otherwise report its files under their old paths
+func (in *inotifyWatch) unwatchTree(dir string) {
+	for wd, path := range in.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(in.fd, uint32(wd))
+			delete(in.dirs, wd)
+		}
+	}
+}
+
+// stop reads the events still queued, then closes the watch
+func (in *inotifyWatch) stop() {
+	in.stopOnce.Do(func() {
+		if err := in.file.SetReadDeadline(time.Now().Add(stopDrain)); err != nil {
+			in.file.Close()
+			<-in.done
+			return
+		}
+		<-in.done
+		in.file.Close()
+	})
+}
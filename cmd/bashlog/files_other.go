@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newFileWatcher would watch root for changes, which needs inotify
+func newFileWatcher(root string, skip []string) (*fileWatcher, error) {
+	return nil, errors.New("--watch-files needs Linux, where changes are watched with inotify")
+}
@@ -0,0 +1,42 @@
+//go:build !agent
+
+package main
+
+import "errors"
+
+// agentBuild is true in bashlog-agent, the record-only build of bashlog
+// made with -tags agent, for hosts where nothing should read history back
+const agentBuild = false
+
+// commandsUsage lists the commands in the usage message
+const commandsUsage = `Usage: bashlog [options] [-- shell arguments]
+       bashlog mark <note>   (inside a session: add a marker to its log)
+       bashlog pause | resume (inside a session: stop recording for a moment, e.g. to type a password)
+       bashlog search [query] (pick a command from everything recorded; bound to Ctrl-R)
+       bashlog suggest [--limit 5] <prefix>
+                             (complete a command line from everything recorded; bound to Alt-S)
+       bashlog install-hooks [--shell bash|zsh|fish] [--workspace name]
+                             (record every new shell, not only ones started with bashlog)
+       bashlog uninstall-hooks [--shell name]
+       bashlog doctor        (check sessions can be recorded, with fixes for what can't)
+       bashlog ingest --workspace <name> [--format jsonl] [--origin script] < records
+                             (add commands other recorders, e.g. CI jobs, wrote, one JSON
+                             object a line: {"command":"make","time":"...","exit":0,"ms":900})
+       bashlog ci [--file steps] [--name name] [--artifact file] [--keep-going]
+                             (run a CI job's steps, one command a line, recording them into a
+                             workspace written out as a tarball for bashlog-mgr mount)
+       bashlog make --workspace <name> [--via runner] [--shell path] [target...]
+                             (run make, or another task runner, recording each recipe line
+                             with its output and timing, tagged make:<target>)
+       bashlog drive <script.yaml> [options]
+                             (run a session typing a script's input as its output asks for
+                             it, expect-style, recording it as any session is)
+       bashlog cron add "<schedule> <command>" --workspace <name> | list | remove <id>
+                             (run commands on a crontab schedule, each run recorded with its
+                             output; bashlog cron run is the scheduler, for the service manager)
+`
+
+// runAs is only done by bashlog-agent
+func runAs(name string) error {
+	return errors.New("--run-as is only supported by bashlog-agent")
+}
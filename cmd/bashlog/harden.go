@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// hardening is what --hardened does to bashlog itself, for deployments
+// where the recorder must hold no more than it needs: it won't run as root
+// unless allowed, keeps its logs to the user, 0600 in 0700 directories,
+// and once the shell is running gives up its capabilities and the system
+// calls it has no use for, such as ptrace, mount and setuid, which are
+// then refused. The shell is left as it would be without bashlog
+type hardening struct {
+	// shellUmask is the umask bashlog was started with, which the shell
+	// is started with too
+	shellUmask int
+}
+
+// privateUmask is bashlog's umask when hardened
+const privateUmask = 0077
+
+// startHardening hardens bashlog from the start, before it writes
+// anything, refusing to run as root unless allowRoot
+func startHardening(allowRoot bool) (*hardening, error) {
+	if err := hardeningSupported(); err != nil {
+		return nil, err
+	}
+	if os.Geteuid() == 0 && !allowRoot {
+		return nil, errors.New("--hardened refuses to run as root; record as a user, or allow it with --allow-root")
+	}
+	return &hardening{shellUmask: setUmask(privateUmask)}, nil
+}
+
+// lockFiles makes the directories holding the session's logs private to
+// the user, whatever files.mode says and in case they were made before
+// bashlog was hardened, and has everything else bashlog writes created
+// private too
+func (h *hardening) lockFiles(config *Config) error {
+	fsperm.Default = fsperm.Private
+	logs := filepath.Dir(config.LogDir)
+	for _, dir := range []string{filepath.Dir(logs), logs, config.LogDir} {
+		if err := os.Chmod(dir, fsperm.Private.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startShell calls start, which starts the shell, with the umask bashlog
+// was started with
+func (h *hardening) startShell(start func() error) error {
+	setUmask(h.shellUmask)
+	defer setUmask(privateUmask)
+	return start()
+}
+
+// lockDown drops bashlog's capabilities and applies its seccomp filter,
+// once the shell it records has been started without them
+func (h *hardening) lockDown() error {
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("could not drop capabilities: %w", err)
+	}
+	if err := applySeccomp(); err != nil {
+		return fmt.Errorf("could not apply the seccomp filter: %w", err)
+	}
+	return nil
+}
+
+// startShell calls start, which starts the shell, as hardening has it
+// started when set
+func (c *Config) startShell(start func() error) error {
+	if c.Hardening == nil {
+		return start()
+	}
+	return c.Hardening.startShell(start)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prCapbsetRead   = 23
+	prCapbsetDrop   = 24
+	prSetNoNewPrivs = 38
+
+	linuxCapabilityVersion3 = 0x20080522
+
+	seccompSetModeFilter    = 1
+	seccompGetActionAvail   = 2
+	seccompFilterFlagTsync  = 1
+	seccompRetKillProcess   = 0x80000000
+	seccompRetErrno         = 0x00050000
+	seccompRetAllow         = 0x7fff0000
+	seccompDataArchOffset   = 4
+	seccompDataNumberOffset = 0
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective, permitted, inheritable uint32
+}
+
+// hardeningSupported fails, before the shell is started, where lockDown
+// would: on the architectures there is no seccomp filter for, on kernels
+// without seccomp filters, and in builds using cgo when bashlog has
+// capabilities to drop
+func hardeningSupported() error {
+	if auditArch == 0 {
+		return fmt.Errorf("--hardened has no seccomp filter for %s", runtime.GOARCH)
+	}
+	action := uint32(seccompRetKillProcess)
+	if _, _, errno := syscall.RawSyscall(sysSeccomp, seccompGetActionAvail, 0, uintptr(unsafe.Pointer(&action))); errno != 0 {
+		return fmt.Errorf("--hardened needs seccomp filters, which this kernel doesn't offer: %w", errno)
+	}
+	has, err := hasCapabilities()
+	if err != nil {
+		return fmt.Errorf("could not read bashlog's capabilities: %w", err)
+	}
+	if has {
+		// A harmless call, made to see whether all threads can be
+		// reached, as dropping the capabilities needs
+		if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prCapbsetRead, 0, 0); errno == syscall.ENOTSUP {
+			return errCgoCapabilities
+		}
+	}
+	return nil
+}
+
+// errCgoCapabilities is why a build using cgo can't be hardened when it
+// has capabilities
+var errCgoCapabilities = errors.New("this build of bashlog uses cgo, which keeps it from changing the capabilities of all its threads; build it with CGO_ENABLED=0")
+
+func setUmask(mask int) int {
+	return syscall.Umask(mask)
+}
+
+// dropCapabilities empties the capability sets of every thread of the
+// process, and its bounding set, so nothing it runs can gain them either.
+// As a user bashlog normally has none, and there is nothing to do
+func dropCapabilities() error {
+	if has, err := hasCapabilities(); err != nil || !has {
+		return err
+	}
+
+	// Capabilities belong to threads, and the runtime's threads all have
+	// to drop them
+	for c := uintptr(0); ; c++ {
+		_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prCapbsetDrop, c, 0)
+		if errno == syscall.EINVAL {
+			break
+		}
+		if errno == syscall.ENOTSUP {
+			return errCgoCapabilities
+		}
+		if errno != 0 {
+			return fmt.Errorf("dropping capability %d from the bounding set: %w", c, errno)
+		}
+	}
+	header := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// hasCapabilities reports whether bashlog holds any capabilities
+func hasCapabilities() (bool, error) {
+	header := capHeader{version: linuxCapabilityVersion3}
+	var data [2]capData
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return false, errno
+	}
+	return data[0].permitted != 0 || data[1].permitted != 0, nil
+}
+
+// applySeccomp keeps bashlog, and anything it runs, from gaining
+// privileges, and has the kernel refuse it deniedSyscalls with EPERM.
+// Other architectures' system calls kill it
+func applySeccomp() error {
+	// No new privileges is set on this thread, and the filter is then
+	// synchronised over all of them, taking it along
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("setting no new privileges: %w", errno)
+	}
+
+	filter := seccompFilter()
+	program := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	thread, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return errno
+	}
+	if thread != 0 {
+		return fmt.Errorf("thread %d could not take the filter", thread)
+	}
+	return nil
+}
+
+// seccompFilter is the BPF program checking each system call's
+// architecture and number
+func seccompFilter() []syscall.SockFilter {
+	numbers := make([]uint32, 0, len(deniedSyscalls))
+	for _, nr := range deniedSyscalls {
+		numbers = append(numbers, nr)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	filter := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataArchOffset},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: 1, K: auditArch},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: seccompDataNumberOffset},
+	}
+	// Every check jumps to the last instruction, which refuses the call
+	checks := len(numbers)
+	if x32SyscallBit != 0 {
+		checks++
+	}
+	deny := len(filter) + checks + 1
+	if x32SyscallBit != 0 {
+		filter = append(filter, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jt: uint8(deny - len(filter) - 1), K: x32SyscallBit})
+	}
+	for _, nr := range numbers {
+		filter = append(filter, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: uint8(deny - len(filter) - 1), K: nr})
+	}
+	return append(filter,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+}
@@ -0,0 +1,25 @@
+package main
+
+const (
+	auditArch  = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSeccomp = 317
+
+	// x32SyscallBit marks the calls of the x32 ABI, which are all refused
+	x32SyscallBit = 0x40000000
+)
+
+// deniedSyscalls are the system calls the recorder never makes, refused
+// when it is hardened: tracing and reading other processes, changing the
+// machine, its modules, time and names, namespaces, keys, identities and
+// capabilities
+var deniedSyscalls = map[string]uint32{
+	"ptrace": 101, "process_vm_readv": 310, "process_vm_writev": 311, "perf_event_open": 298, "bpf": 321, "userfaultfd": 323,
+	"mount": 165, "umount2": 166, "pivot_root": 155, "chroot": 161, "swapon": 167, "swapoff": 168, "reboot": 169,
+	"kexec_load": 246, "kexec_file_load": 320, "init_module": 175, "finit_module": 313, "delete_module": 176,
+	"iopl": 172, "ioperm": 173, "syslog": 103, "quotactl": 179, "acct": 163,
+	"settimeofday": 164, "clock_settime": 227, "adjtimex": 159, "sethostname": 170, "setdomainname": 171,
+	"unshare": 272, "setns": 308, "personality": 135, "open_by_handle_at": 304, "name_to_handle_at": 303,
+	"add_key": 248, "request_key": 249, "keyctl": 250,
+	"setuid": 105, "setgid": 106, "setreuid": 113, "setregid": 114, "setresuid": 117, "setresgid": 119,
+	"setgroups": 116, "setfsuid": 122, "setfsgid": 123, "capset": 126,
+}
@@ -0,0 +1,21 @@
+package main
+
+const (
+	auditArch     = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sysSeccomp    = 277
+	x32SyscallBit = 0
+)
+
+// deniedSyscalls are those of harden_linux_amd64.go, by their arm64
+// numbers, less iopl and ioperm, which it doesn't have
+var deniedSyscalls = map[string]uint32{
+	"ptrace": 117, "process_vm_readv": 270, "process_vm_writev": 271, "perf_event_open": 241, "bpf": 280, "userfaultfd": 282,
+	"mount": 40, "umount2": 39, "pivot_root": 41, "chroot": 51, "swapon": 224, "swapoff": 225, "reboot": 142,
+	"kexec_load": 104, "kexec_file_load": 294, "init_module": 105, "finit_module": 273, "delete_module": 106,
+	"syslog": 116, "quotactl": 60, "acct": 89,
+	"settimeofday": 170, "clock_settime": 112, "adjtimex": 171, "sethostname": 161, "setdomainname": 162,
+	"unshare": 97, "setns": 268, "personality": 92, "open_by_handle_at": 265, "name_to_handle_at": 264,
+	"add_key": 217, "request_key": 218, "keyctl": 219,
+	"setuid": 146, "setgid": 144, "setreuid": 145, "setregid": 143, "setresuid": 147, "setresgid": 149,
+	"setgroups": 159, "setfsuid": 151, "setfsgid": 152, "capset": 91,
+}
@@ -0,0 +1,13 @@
+//go:build linux && !amd64 && !arm64
+
+package main
+
+// There is no seccomp filter for this architecture, which
+// hardeningSupported reports
+const (
+	auditArch     = 0
+	sysSeccomp    = 0
+	x32SyscallBit = 0
+)
+
+var deniedSyscalls map[string]uint32
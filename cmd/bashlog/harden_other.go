@@ -0,0 +1,23 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// hardeningSupported fails, as hardening relies on Linux's capabilities
+// and seccomp
+func hardeningSupported() error {
+	return errors.New("--hardened needs Linux, for its capabilities and seccomp")
+}
+
+func setUmask(mask int) int {
+	return 0
+}
+
+func dropCapabilities() error {
+	return nil
+}
+
+func applySeccomp() error {
+	return nil
+}
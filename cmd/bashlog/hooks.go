@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shell"
+)
+
+// defaultHookWorkspace is the workspace hooked shells record into unless
+// told otherwise
+const defaultHookWorkspace = "default"
+
+// runInstallHooks makes every interactive shell of one kind start under
+// bashlog, recording into a workspace, by adding a snippet to its startup
+// file
+func runInstallHooks(args []string) error {
+	fs := flag.NewFlagSet("install-hooks", flag.ContinueOnError)
+	shellName := fs.String("shell", "", "Shell to hook: "+strings.Join(shell.HookShells, ", ")+" (default: $SHELL)")
+	ws := fs.String("workspace", defaultHookWorkspace, "Workspace hooked shells record into")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	name := *shellName
+	if name == "" {
+		name = filepath.Base(os.Getenv("SHELL"))
+	}
+	if _, err := shell.HookFile(name, ""); err != nil {
+		return fmt.Errorf("%v; pass --shell", err)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	// The workspace is checked now rather than by every shell started
+	config := &Config{SettingsFile: filepath.Join(homeDir, ".bashlog", "config.txt")}
+	if err := useWorkspace(config, *ws); err != nil {
+		return err
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate bashlog: %w", err)
+	}
+	if bin, err = filepath.EvalSymlinks(bin); err != nil {
+		return fmt.Errorf("failed to locate bashlog: %w", err)
+	}
+
+	path, err := shell.InstallHook(name, homeDir, bin, *ws)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	fmt.Printf("✓ New %s shells now record into workspace '%s' (hook added to %s)\n", name, *ws, path)
+	fmt.Println("  Set BASHLOG_NO_HOOK=1 to start one without, or remove the hook with: bashlog uninstall-hooks")
+	return nil
+}
+
+// runUninstallHooks removes the hooks install-hooks added, from one shell
+// or by default from all of them
+func runUninstallHooks(args []string) error {
+	fs := flag.NewFlagSet("uninstall-hooks", flag.ContinueOnError)
+	shellName := fs.String("shell", "", "Shell to unhook: "+strings.Join(shell.HookShells, ", ")+" (default: all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	names := shell.HookShells
+	if *shellName != "" {
+		names = []string{*shellName}
+	}
+
+	removed := 0
+	for _, name := range names {
+		path, found, err := shell.UninstallHook(name, homeDir)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", path, err)
+		}
+		if found {
+			removed++
+			fmt.Printf("✓ Removed the %s hook from %s\n", name, path)
+		}
+	}
+	if removed == 0 {
+		return errors.New("no hooks installed")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// idleMonitor tracks the last activity in a session. Terminal traffic is
+// observed through Write in PTY mode; otherwise commands appended to the
+// session history file count as activity.
+type idleMonitor struct {
+	timeout  time.Duration
+	histFile string
+
+	last    atomic.Int64
+	expired atomic.Bool
+}
+
+func newIdleMonitor(timeout time.Duration, histFile string) *idleMonitor {
+	m := &idleMonitor{timeout: timeout, histFile: histFile}
+	m.touch(time.Now())
+	return m
+}
+
+// Write records activity, so the monitor can be attached to terminal
+// streams
+func (m *idleMonitor) Write(p []byte) (int, error) {
+	m.touch(time.Now())
+	return len(p), nil
+}
+
+// Idle reports whether the session has been inactive for longer than the
+// timeout
+func (m *idleMonitor) Idle() bool {
+	if info, err := os.Stat(m.histFile); err == nil {
+		m.touch(info.ModTime())
+	}
+	return time.Since(time.Unix(0, m.last.Load())) > m.timeout
+}
+
+// Expired reports whether the session was closed for being idle
+func (m *idleMonitor) Expired() bool {
+	return m.expired.Load()
+}
+
+func (m *idleMonitor) expire() {
+	m.expired.Store(true)
+}
+
+// checkInterval returns how often to check for inactivity: often enough to
+// close the session close to its timeout without polling needlessly
+func (m *idleMonitor) checkInterval() time.Duration {
+	interval := m.timeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	return interval
+}
+
+// touch moves the last activity forward to t
+func (m *idleMonitor) touch(t time.Time) {
+	for {
+		last := m.last.Load()
+		if t.UnixNano() <= last || m.last.CompareAndSwap(last, t.UnixNano()) {
+			return
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/rules"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/transcript"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// rulesTimeout bounds how long evaluating rules may delay the end of a
+// session
+const rulesTimeout = time.Minute
+
+// commandResult is what bashlog knows about a command run with -c
+type commandResult struct {
+	entry    workspace.Entry
+	status   int
+	duration time.Duration
+}
+
+// exitStatus is the status reported for a session that ended with err
+func exitStatus(err error) int {
+	var exitErr *exitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case err != nil:
+		return -1
+	}
+	return 0
+}
+
+// useWorkspace records the session into the named bashlog-mgr workspace,
+// which must already exist in one of the workspace roots
+func useWorkspace(config *Config, name string) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	roots := workspace.Roots(workspace.ReadConfig(config.SettingsFile), filepath.Join(homeDir, ".bashlog-workspaces"))
+	wsPath, ok := workspace.Find(roots, name)
+	if !ok {
+		return fmt.Errorf("workspace '%s' not found (create it with: bashlog-mgr create %s)", name, name)
+	}
+	if _, err := os.Stat(filepath.Join(wsPath, workspace.ConfigFile)); err != nil {
+		return fmt.Errorf("workspace '%s' not found (create it with: bashlog-mgr create %s)", name, name)
+	}
+	if workspace.IsMounted(wsPath) {
+		return fmt.Errorf("workspace '%s' is mounted read-only and can't be recorded into", name)
+	}
+
+	config.Workspace = name
+	config.WorkspacePath = wsPath
+	return nil
+}
+
+// ingestSession passes the commands recorded during the session to their
+// workspace and through the alert rules, returning the rules' hits
+func ingestSession(config *Config) []rules.Hit {
+	entries, err := sessionEntries(config)
+	if err != nil {
+		slog.Warn("failed to read session history", "err", err)
+		return nil
+	}
+	sourced := sessionSourced(config)
+	if len(entries) == 0 && len(sourced) == 0 {
+		return nil
+	}
+
+	records := mergeRecords(sessionRecords(config, entries), sourced)
+	all := workspace.EntriesOf(records)
+
+	if config.WorkspacePath != "" {
+		if err := storage.AppendRecords(config.WorkspacePath, records); err != nil {
+			slog.Warn("failed to add commands to workspace", "workspace", config.Workspace, "err", err)
+		}
+		if err := workspace.AddHosts(config.WorkspacePath, config.Meta.Host.Name, all); err != nil {
+			slog.Warn("failed to record command hosts", "workspace", config.Workspace, "err", err)
+		}
+		if err := workspace.AddOrigins(config.WorkspacePath, sessionOrigin(config), entries); err != nil {
+			slog.Warn("failed to record command origins", "workspace", config.Workspace, "err", err)
+		}
+		if err := workspace.AddOrigins(config.WorkspacePath, workspace.OriginSourced, workspace.EntriesOf(sourced)); err != nil {
+			slog.Warn("failed to record command origins", "workspace", config.Workspace, "err", err)
+		}
+		if err := workspace.AddTransfers(config.WorkspacePath, all); err != nil {
+			slog.Warn("failed to record file transfers", "workspace", config.Workspace, "err", err)
+		}
+		if err := workspace.AddOutputs(config.WorkspacePath, sessionOutputs(config, entries)); err != nil {
+			slog.Warn("failed to store command output", "workspace", config.Workspace, "err", err)
+		}
+	}
+	// Only the commands typed at the prompt are shipped, as ship batches
+	// have one origin
+	if config.Remote != nil && len(entries) > 0 {
+		shipSession(config, entries)
+	}
+
+	engine, err := rules.NewEngine(workspace.ReadConfig(config.SettingsFile), config.HitLog)
+	if err != nil {
+		slog.Warn("failed to load rules", "settings", config.SettingsFile, "err", err)
+		return nil
+	}
+	if len(engine.Rules) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rulesTimeout)
+	defer cancel()
+	hits, err := engine.Evaluate(ctx, sessionEvents(config, records))
+	if err != nil {
+		slog.Warn("rule actions failed", "err", err)
+	}
+
+	if config.WorkspacePath != "" {
+		if err := workspace.AddTags(config.WorkspacePath, hitTags(hits)); err != nil {
+			slog.Warn("failed to tag commands", "workspace", config.Workspace, "err", err)
+		}
+	}
+	return hits
+}
+
+// sessionOrigin is where the session's commands came from: typed at its
+// prompt, or for a -c command, run by whatever started bashlog
+func sessionOrigin(config *Config) string {
+	if config.command != nil {
+		return workspace.OriginScript
+	}
+	return workspace.OriginInteractive
+}
+
+// sessionOutputs pairs the session's commands with what they printed,
+// when the session's output was recorded
+func sessionOutputs(config *Config, entries []workspace.Entry) []workspace.Output {
+	if !config.PTY {
+		return nil
+	}
+	raw, err := os.ReadFile(config.LogFile)
+	if os.IsNotExist(err) {
+		// Commands run with -c aren't recorded through the pseudo-terminal
+		return nil
+	}
+	if err != nil {
+		slog.Warn("failed to read session transcript", "log", config.LogFile, "err", err)
+		return nil
+	}
+
+	commands := make([]string, len(entries))
+	times := make([]time.Time, len(entries))
+	for i, e := range entries {
+		commands[i] = e.Command
+		times[i] = e.Time
+	}
+
+	var outputs []workspace.Output
+	for i, cell := range transcript.Split(transcript.Clean(raw), commands, times) {
+		if cell.Found {
+			outputs = append(outputs, workspace.Output{Entry: entries[i], Output: cell.Output})
+		}
+	}
+	return outputs
+}
+
+// hitTags collects the tags rule hits gave each command
+func hitTags(hits []rules.Hit) []workspace.Tagged {
+	var tagged []workspace.Tagged
+	index := make(map[workspace.Entry]int)
+	for _, h := range hits {
+		if h.Tag == "" {
+			continue
+		}
+		e := workspace.Entry{Command: h.Command, Time: h.Time}
+		i, ok := index[e]
+		if !ok {
+			i = len(tagged)
+			index[e] = i
+			tagged = append(tagged, workspace.Tagged{Entry: e})
+		}
+		tagged[i].Tags = append(tagged[i].Tags, h.Tag)
+	}
+	return tagged
+}
+
+// sessionEntries reads the commands appended to the history file since
+// the session started
+func sessionEntries(config *Config) ([]workspace.Entry, error) {
+	f, err := os.Open(config.HistFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(config.histOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	entries, err := workspace.ParseHistory(f)
+	if err != nil {
+		return nil, err
+	}
+	return workspace.FillTimestamps(entries, config.Meta.Started), nil
+}
+
+// sessionStatuses returns how each of the session's commands ended and
+// where it ran, nil for those the shell's hooks didn't record
+func sessionStatuses(config *Config, entries []workspace.Entry) []*session.CommandStatus {
+	statuses, err := session.ReadStatuses(config.HistFile)
+	if err != nil {
+		slog.Warn("failed to read command statuses", "err", err)
+	}
+	return session.MatchStatuses(entries, statuses)
+}
+
+// sessionRecords pairs entries with what is known of how they ended. A -c
+// command has a known exit code and duration, and commands typed at the
+// prompts of shells whose hooks record it a known exit code, and a
+// duration where the hooks could time them by the monotonic clock
+func sessionRecords(config *Config, entries []workspace.Entry) []workspace.Record {
+	statuses := sessionStatuses(config, entries)
+	records := workspace.RecordsOf(entries)
+	for i, e := range entries {
+		if s := statuses[i]; s != nil {
+			records[i].HasExit = true
+			records[i].Exit = s.Status
+			records[i].Duration, records[i].HasDuration = s.Elapsed()
+		}
+		if c := config.command; c != nil && e.Command == c.entry.Command {
+			records[i].HasExit = true
+			records[i].Exit = c.status
+			records[i].HasDuration = true
+			records[i].Duration = c.duration
+		}
+	}
+	return records
+}
+
+// sessionSourced returns the commands the session's sourced files and
+// functions ran, when recorded with --sources, as records of where they
+// come from
+func sessionSourced(config *Config) []workspace.Record {
+	if !config.Sources {
+		return nil
+	}
+	sourced, err := session.ReadSources(config.HistFile)
+	if err != nil {
+		slog.Warn("failed to read sourced commands", "err", err)
+	}
+	records := make([]workspace.Record, len(sourced))
+	for i, c := range sourced {
+		records[i] = workspace.Record{Entry: c.Entry(), Version: workspace.RecordV1, Source: c.Location(), Func: c.Func}
+	}
+	return records
+}
+
+// mergeRecords returns typed and sourced in the order they ran. A command
+// typed at the prompt keeps its place before those it ran in the same
+// second, as for a source typed there
+func mergeRecords(typed, sourced []workspace.Record) []workspace.Record {
+	if len(sourced) == 0 {
+		return typed
+	}
+	records := append(append([]workspace.Record(nil), typed...), sourced...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records
+}
+
+// sessionEvents describes records for the rules engine
+func sessionEvents(config *Config, records []workspace.Record) []rules.Event {
+	var username string
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	host, _ := os.Hostname()
+
+	events := make([]rules.Event, len(records))
+	for i, r := range records {
+		events[i] = rules.Event{
+			Command:     r.Command,
+			Time:        r.Time,
+			User:        username,
+			Host:        host,
+			Workspace:   config.Workspace,
+			SessionID:   config.SessionID,
+			HasExit:     r.HasExit,
+			ExitCode:    r.Exit,
+			HasDuration: r.HasDuration,
+			Duration:    r.Duration,
+		}
+	}
+	return events
+}
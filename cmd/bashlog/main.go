@@ -1,13 +1,26 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/interhack86/bashlog/internal/drive"
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/logger"
+	"github.com/interhack86/bashlog/internal/remote"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/shell"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
 )
 
 // Config holds the configuration for bashlog
@@ -17,39 +30,393 @@ type Config struct {
 	Time      string
 	LogDir    string
 	RCFile    string
+	HistFile  string
+	LogFile   string
+	MetaFile  string
 	SessionID string
+	// Alias is the session's name for people, unique among the day's
+	// sessions
+	Alias string
+
+	Shell        shell.Adapter
+	ShellPath    string
+	ShellVersion string
+
+	Login     bool
+	ShellArgs []string
+	PTY       bool
+
+	// SearchKey binds Ctrl-R to bashlog search, and Alt-S to bashlog
+	// suggest, in the session's shell
+	SearchKey bool
+
+	// IncognitoPrefix starts commands that are left unrecorded
+	IncognitoPrefix string
+
+	// InputCapture is "timing" or "content" when PTY input is recorded
+	InputCapture string
+
+	Idle *idleMonitor
+
+	// Alerts, when set, warns in the terminal of commands matching rules
+	// with a terminal action
+	Alerts *terminalAlerts
+
+	// Egress, when set, samples the outbound connections the session's
+	// commands make, for its metadata
+	Egress *egressMonitor
+
+	// Hardening, when set, is what --hardened does to bashlog itself
+	Hardening *hardening
+
+	// Files, when set, watches the working directory for the files the
+	// session's commands change
+	Files *fileWatcher
+
+	Meta    *session.Meta
+	Journal *session.Journal
+
+	// Terminal records the window being resized and retitled
+	Terminal *terminalRecorder
+
+	// Drive, when set, types a script's input into the PTY session in
+	// place of the user's
+	Drive *drive.Driver
+
+	// Recording is paused by bashlog pause, leaving the terminal out of the
+	// transcript until bashlog resume
+	Recording recordGate
+
+	// EndReason is set when the session is ended by a signal
+	EndReason string
+
+	// ParentSessionID is set for sessions started inside another session
+	ParentSessionID string
+	Depth           int
+
+	// EscalatedFrom and Escalation are set for a privileged shell started
+	// from a session with sudo or su: who started it, and how
+	EscalatedFrom string
+	Escalation    string
+
+	// Escalate wraps sudo and su in the shell, so privileged shells
+	// started with them are recorded as child sessions
+	Escalate bool
+
+	// Sources records the commands sourced files and functions run, with
+	// where they come from, beside those typed at the prompt. Only bash
+	// hooks do
+	Sources bool
+
+	// Workspace, when set, receives the session's commands when it ends
+	Workspace     string
+	WorkspacePath string
+
+	// Remote, when set, is sent the session's commands too, or alone when
+	// WorkspacePath is empty
+	Remote *remote.Client
+
+	// SettingsFile holds rules and notification targets; rule matches are
+	// appended to HitLog
+	SettingsFile string
+	HitLog       string
+
+	// histOffset is the size of HistFile when the session started, so its
+	// own commands can be picked out when it ends
+	histOffset int64
+
+	// command is the result of a -c command, known only in command mode
+	command *commandResult
+}
+
+// subcommand returns the run function of bashlog's subcommand name, or
+// nil when name starts a session
+func subcommand(name string) func(args []string) error {
+	switch name {
+	case "mark":
+		return runMark
+	case "pause", "resume":
+		return func([]string) error { return runPause(name == "pause") }
+	case "install-hooks":
+		return runInstallHooks
+	case "uninstall-hooks":
+		return runUninstallHooks
+	case "doctor":
+		return runDoctor
+	case "ingest":
+		return runIngest
+	case "ci":
+		return runCI
+	case "make":
+		return runMake
+	case "via-shell":
+		return runViaShell
+	case "cron":
+		return runCron
+	case "escalate":
+		return runEscalate
+	case "search":
+		return runSearch
+	case "suggest":
+		return runSuggest
+	}
+	return nil
+}
+
+// exitSubcommand exits with the status of the command a subcommand ran
+// when err carries one, and reports any other error as a failure
+func exitSubcommand(err error) {
+	if err == nil {
+		return
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	fmt.Fprintf(os.Stderr, "bashlog: %v\n", err)
+	os.Exit(1)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run := subcommand(os.Args[1]); run != nil {
+			exitSubcommand(run(os.Args[2:]))
+			return
+		}
+		// bashlog drive <script> is a PTY session whose input comes from
+		// the script, taking the session's other options after it
+		if os.Args[1] == "drive" {
+			if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+				fmt.Fprintln(os.Stderr, "bashlog: usage: bashlog drive <script.yaml> [options]")
+				os.Exit(2)
+			}
+			os.Args = append([]string{os.Args[0], "--pty", "--drive", os.Args[2]}, os.Args[3:]...)
+		}
+	}
+
 	// Define flags
 	tzFlag := flag.String("tz", "", "Timezone for logging (e.g., UTC, America/New_York)")
 	dateFlag := flag.String("date", "", "Date for logging (YYYY-MM-DD format)")
 	timeFlag := flag.String("time", "", "Time for logging (HH:MM:SS format)")
+	shellFlag := flag.String("shell", "", "Shell to record, by name ("+strings.Join(shell.Names(), ", ")+") or path (default: $SHELL)")
+	var loginFlag bool
+	flag.BoolVar(&loginFlag, "login", false, "Start the shell as a login shell")
+	flag.BoolVar(&loginFlag, "l", false, "Shorthand for --login")
+	ptyFlag := flag.Bool("pty", false, "Run the shell in a pseudo-terminal and record its output to the session log")
+	nestedFlag := flag.String("nested", "link", "When started inside a bashlog session: refuse, warn, or link a child session")
+	inputTimingFlag := flag.Bool("input-timing", false, "In PTY mode, record when input was typed (not what was typed)")
+	inputContentFlag := flag.Bool("input-content", false, "In PTY mode, also record the typed input itself, including anything typed at password prompts")
+	noSearchKeyFlag := flag.Bool("no-search-key", false, "Keep the shell's own Ctrl-R and Alt-S instead of binding them to bashlog search and suggest")
+	noSummaryFlag := flag.Bool("no-summary", false, "Don't print a summary of the session when its shell exits; it is kept for bashlog-mgr sessions --summary either way")
+	noEscalateFlag := flag.Bool("no-escalate", false, "Leave shells started with sudo -i, sudo -s or su unrecorded instead of recording them as child sessions")
+	sourcesFlag := flag.Bool("sources", false, "With bash, also record the commands sourced files and functions run, with the file and line they come from (bashlog-mgr history --origin sourced)")
+	escalatedFromFlag := flag.String("escalated-from", "", "User whose session started this one with sudo or su")
+	escalationFlag := flag.String("escalation", "", "How the session was started from --escalated-from, such as \"sudo -i\"")
+	incognitoFlag := flag.String("incognito-prefix", "", `Leave commands starting with this unrecorded: whitespace, or a word and a space such as ":q " (default: incognito.prefix setting)`)
+	egressFlag := flag.Bool("egress", false, "On Linux, record the outbound connections the session's commands make, sampled from /proc, in its metadata")
+	watchFilesFlag := flag.Bool("watch-files", false, "On Linux, record the files each command creates, modifies and deletes under the working directory")
+	idleFlag := flag.Duration("idle-timeout", 0, "Close the session after this long without activity (e.g. 30m)")
+	workspaceFlag := flag.String("workspace", os.Getenv("BASHLOG_WORKSPACE"), "Add the session's commands to this bashlog-mgr workspace when it ends (default: $BASHLOG_WORKSPACE)")
+	remoteFlag := flag.String("remote", "", "Also ship the session's commands to this bashlog-mgr serve URL, spooling them while it is unreachable (default: remote.url setting)")
+	tokenFlag := flag.String("token", os.Getenv("BASHLOG_TOKEN"), "API token for --remote (default: $BASHLOG_TOKEN, then remote.token setting)")
+	remoteOnlyFlag := flag.Bool("remote-only", false, "Ship commands to --remote only, without a local workspace")
+	hardenedFlag := flag.Bool("hardened", false, "On Linux, keep the logs to the user (0600) and, once the shell is running, give up capabilities and refuse unneeded system calls with seccomp; refuses to run as root")
+	allowRootFlag := flag.Bool("allow-root", false, "With --hardened, run as root all the same")
+	pprofFlag := flag.String("pprof", "", "Serve runtime profiles on this address (e.g. :6060)")
+	driveFlag := flag.String("drive", "", "Type the input of this script into the session, as bashlog drive does")
+	logLevelFlag := flag.String("log-level", "warn", "Diagnostics to print to stderr: debug, info, warn, or error")
+	logFormatFlag := flag.String("log-format", logger.FormatText, "Diagnostic log format: text or json")
+	var runAsFlag *string
+	if agentBuild {
+		runAsFlag = flag.String("run-as", "", "When started as root, switch to this user for good and record as them")
+	}
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s\nInside a session, sudo -i, sudo -s and su start the privileged shell as a\nchild session, recorded in the target user's logs (see --no-escalate).\n\nOptions:\n", commandsUsage)
+		printVisibleDefaults()
+	}
 	flag.Parse()
 
+	if err := logger.Setup(os.Stderr, *logLevelFlag, *logFormatFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "bashlog: %v\n", err)
+		os.Exit(2)
+	}
+
+	if runAsFlag != nil && *runAsFlag != "" {
+		if err := runAs(*runAsFlag); err != nil {
+			logger.Fatal("failed to drop privileges", "user", *runAsFlag, "err", err)
+		}
+	}
+
+	var hardened *hardening
+	if *hardenedFlag {
+		h, err := startHardening(*allowRootFlag)
+		if err != nil {
+			logger.Fatal("failed to harden", "err", err)
+		}
+		hardened = h
+	}
+
+	if *pprofFlag != "" {
+		if err := startProfiler(*pprofFlag); err != nil {
+			logger.Fatal("failed to start profiler", "err", err)
+		}
+	}
+
 	// Setup configuration
-	config, err := setupConfig(*tzFlag, *dateFlag, *timeFlag)
+	config, err := setupConfig(*tzFlag, *dateFlag, *timeFlag, *shellFlag)
 	if err != nil {
-		log.Fatalf("Failed to setup configuration: %v", err)
+		logger.Fatal("failed to set up configuration", "err", err)
+	}
+	if hardened != nil {
+		if err := hardened.lockFiles(config); err != nil {
+			logger.Fatal("failed to harden", "err", err)
+		}
+		config.Hardening = hardened
+	}
+	config.Login = loginFlag
+	config.ShellArgs = flag.Args()
+	config.PTY = *ptyFlag
+	// bashlog-agent has no search to bind Ctrl-R to
+	config.SearchKey = !*noSearchKeyFlag && !agentBuild
+	config.Escalate = !*noEscalateFlag
+	config.Sources = *sourcesFlag
+	if config.IncognitoPrefix, err = incognitoPrefix(config, *incognitoFlag); err != nil {
+		logger.Fatal("failed to set up configuration", "err", err)
+	}
+
+	switch {
+	case *inputContentFlag:
+		config.InputCapture = "content"
+	case *inputTimingFlag:
+		config.InputCapture = "timing"
+	}
+	if config.InputCapture != "" && !config.PTY {
+		logger.Fatal("failed to set up configuration", "err", "input capture requires --pty")
+	}
+
+	if *remoteOnlyFlag {
+		config.Workspace = *workspaceFlag
+	} else if *workspaceFlag != "" {
+		if err := useWorkspace(config, *workspaceFlag); err != nil {
+			logger.Fatal("failed to set up configuration", "err", err)
+		}
+	}
+	if err := useRemote(config, *remoteFlag, *tokenFlag, *remoteOnlyFlag); err != nil {
+		logger.Fatal("failed to set up configuration", "err", err)
+	}
+
+	if *driveFlag != "" {
+		if _, ok := commandArg(config.ShellArgs); ok || !config.PTY {
+			logger.Fatal("failed to set up configuration", "err", "a driven session needs an interactive shell in a pty")
+		}
+		script, err := drive.Load(*driveFlag)
+		if err != nil {
+			logger.Fatal("failed to set up configuration", "err", err)
+		}
+		config.Drive = drive.New(script)
+	}
+
+	if *egressFlag {
+		if config.Egress, err = newEgressMonitor(); err != nil {
+			logger.Fatal("failed to set up configuration", "err", err)
+		}
+	}
+
+	// Handle being started from a shell that is already being logged
+	if err := handleNesting(config, *nestedFlag); err != nil {
+		logger.Fatal("failed to set up configuration", "err", err)
+	}
+	if *idleFlag > 0 {
+		config.Idle = newIdleMonitor(*idleFlag, config.HistFile)
+	}
+	if *escalatedFromFlag != "" && config.ParentSessionID != "" {
+		config.EscalatedFrom = *escalatedFromFlag
+		config.Escalation = *escalationFlag
+	}
+
+	if *watchFilesFlag {
+		root, skip, err := watchedTree(config)
+		if err == nil {
+			config.Files, err = newFileWatcher(root, skip)
+		}
+		if err != nil {
+			logger.Fatal("failed to set up configuration", "err", err)
+		}
 	}
 
-	// Show session information
-	showSessionInfo(config)
+	// Record session metadata
+	if err := startSession(config); err != nil {
+		logger.Fatal("failed to write session metadata", "err", err)
+	}
 
-	// Create RC file
-	if err := createRCFile(config); err != nil {
-		log.Fatalf("Failed to create RC file: %v", err)
+	var runErr error
+	if command, ok := commandArg(config.ShellArgs); ok {
+		// Commands passed with -c run non-interactively, as the shell
+		// would run them without bashlog, and are recorded by bashlog
+		runErr = runCommand(config, command)
+	} else {
+		config.Alerts = newTerminalAlerts(config)
+
+		// Show session information
+		showSessionInfo(config)
+
+		// Create RC file
+		if err := createRCFile(config); err != nil {
+			logger.Fatal("failed to create RC file", "err", err)
+		}
+
+		// Run shell with logging
+		runErr = runShell(config)
+		os.RemoveAll(filepath.Dir(config.RCFile))
 	}
 
-	// Run shell with logging
-	if err := runShell(config); err != nil {
-		log.Fatalf("Failed to run shell: %v", err)
+	hits := ingestSession(config)
+	recordChanges(config)
+	if err := finishSession(config, runErr); err != nil {
+		slog.Warn("failed to finalize session metadata", "err", err)
+	}
+	if config.command == nil {
+		summarizeSession(config, hits, !*noSummaryFlag)
+	}
+	if runErr != nil {
+		exitWith(runErr)
 	}
 }
 
+// incognitoPrefix returns the prefix given with --incognito-prefix or
+// else in the incognito.prefix setting, which may be quoted to keep its
+// spaces, as in incognito.prefix=":q "
+func incognitoPrefix(config *Config, prefix string) (string, error) {
+	if prefix == "" {
+		prefix = workspace.ReadConfig(config.SettingsFile)["incognito.prefix"]
+		if strings.HasPrefix(prefix, `"`) {
+			unquoted, err := strconv.Unquote(prefix)
+			if err != nil {
+				return "", fmt.Errorf("invalid incognito.prefix setting %s: %w", prefix, err)
+			}
+			prefix = unquoted
+		}
+	}
+	if err := shell.ValidateIncognitoPrefix(prefix); err != nil {
+		return "", err
+	}
+	return prefix, nil
+}
+
+// configureSettings sets the modes bashlog creates files with, and where
+// workspaces keep their commands, from the files.mode and storage settings
+// of the user's config.txt
+func configureSettings(homeDir string) error {
+	settings := workspace.ReadConfig(filepath.Join(homeDir, ".bashlog", "config.txt"))
+	if err := fsperm.Configure(settings); err != nil {
+		return err
+	}
+	return storage.Configure(settings)
+}
+
 // setupConfig initializes the configuration for bashlog
-func setupConfig(tz, date, timeStr string) (*Config, error) {
+func setupConfig(tz, date, timeStr, shellName string) (*Config, error) {
 	config := &Config{
 		Timezone: tz,
 		Date:     date,
@@ -80,7 +447,11 @@ func setupConfig(tz, date, timeStr string) (*Config, error) {
 	}
 
 	// Generate session ID
-	config.SessionID = fmt.Sprintf("session_%s_%s", config.Date, config.Time)
+	id, err := session.NewID(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	config.SessionID = id
 
 	// Setup log directory
 	homeDir, err := os.UserHomeDir()
@@ -89,28 +460,114 @@ func setupConfig(tz, date, timeStr string) (*Config, error) {
 	}
 
 	config.LogDir = filepath.Join(homeDir, ".bashlog", "logs", config.Date)
+	if err := configureSettings(homeDir); err != nil {
+		return nil, err
+	}
 
 	// Create log directory if it doesn't exist
-	if err := os.MkdirAll(config.LogDir, 0755); err != nil {
+	if err := fsperm.Default.MkdirAll(config.LogDir); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
-	// Set RC file path
-	config.RCFile = filepath.Join(homeDir, ".bashlog", "bashlog.rc")
+	// Resolve the shell to record
+	adapter, shellPath, err := resolveShell(shellName)
+	if err != nil {
+		return nil, err
+	}
+	config.Shell = adapter
+	config.ShellPath = shellPath
+	if version, err := adapter.DetectVersion(shellPath); err == nil {
+		config.ShellVersion = version
+	}
+
+	// Set RC and history file paths. Each session has its own, so that
+	// sessions running side by side neither interleave their commands nor
+	// start with each other's init script
+	config.RCFile = filepath.Join(homeDir, ".bashlog", "init", adapter.Name(), config.SessionID, adapter.InitFileName())
+	config.HistFile = filepath.Join(config.LogDir, "."+adapter.Name()+"_history."+config.SessionID)
+	config.MetaFile = session.MetaPath(config.LogDir, config.SessionID)
+	config.LogFile = strings.TrimSuffix(config.MetaFile, ".meta") + ".log"
+	config.Alias = session.NewAlias(config.LogDir, config.Date, config.Time)
+	config.SettingsFile = filepath.Join(homeDir, ".bashlog", "config.txt")
+	config.HitLog = filepath.Join(homeDir, ".bashlog", "rule-hits.log")
 
 	return config, nil
 }
 
+// resolveShell returns the adapter and binary for the requested shell,
+// which may be an adapter name, a command name or a path. Without one, the
+// shell is taken from $SHELL, falling back to bash. The shell family is
+// detected from the binary itself, and the binary must be a valid login
+// shell.
+func resolveShell(requested string) (shell.Adapter, string, error) {
+	if requested == "" {
+		requested = os.Getenv("SHELL")
+	}
+	if requested == "" {
+		requested = "bash"
+	}
+
+	path, err := exec.LookPath(requested)
+	if err != nil {
+		return nil, "", fmt.Errorf("shell '%s' not found: %w", requested, err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, "", err
+	}
+
+	if err := shell.ValidateLoginShell(path); err != nil {
+		return nil, "", fmt.Errorf("refusing to start shell: %w", err)
+	}
+
+	// A registered name selects its adapter directly, so that e.g. sh can
+	// be recorded as sh even when it is bash underneath
+	if adapter, err := shell.Lookup(requested); err == nil {
+		return adapter, path, nil
+	}
+
+	adapter, err := shell.Detect(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return adapter, path, nil
+}
+
 // showSessionInfo displays information about the current session
 func showSessionInfo(config *Config) {
 	fmt.Println("====================================")
 	fmt.Println("         Bashlog Session Info")
 	fmt.Println("====================================")
+	fmt.Printf("Shell:       %s (%s %s)\n", config.ShellPath, config.Shell.Name(), config.ShellVersion)
 	fmt.Printf("Timezone:    %s\n", config.Timezone)
 	fmt.Printf("Date:        %s\n", config.Date)
 	fmt.Printf("Time:        %s\n", config.Time)
-	fmt.Printf("Session ID:  %s\n", config.SessionID)
+	fmt.Printf("Session ID:  %s (%s)\n", config.SessionID, config.Alias)
+	fmt.Printf("Host:        %s (%s)\n", config.Meta.Host.Name, config.Meta.Host.OS)
+	if config.ParentSessionID != "" {
+		fmt.Printf("Parent:      %s (depth %d)\n", config.ParentSessionID, config.Depth)
+	}
+	if config.EscalatedFrom != "" {
+		fmt.Printf("Escalated:   from %s with %s\n", config.EscalatedFrom, config.Escalation)
+	}
+	if t := config.Meta.Terminal.String(); t != "" {
+		fmt.Printf("Terminal:    %s\n", t)
+	}
 	fmt.Printf("Log Dir:     %s\n", config.LogDir)
+	if config.Alerts != nil {
+		fmt.Printf("Alerts:      %d rule(s) warn in this terminal\n", len(config.Alerts.rules))
+	}
+	if config.Egress != nil {
+		fmt.Printf("Egress:      recording outbound connections\n")
+	}
+	if config.Files != nil {
+		fmt.Printf("Files:       recording changes under %s\n", config.Files.root)
+	}
+	switch config.InputCapture {
+	case "timing":
+		fmt.Printf("Input:       recording keystroke timing (not content)\n")
+	case "content":
+		fmt.Printf("Input:       RECORDING EVERYTHING TYPED, including passwords\n")
+	}
 	fmt.Printf("RC File:     %s\n", config.RCFile)
 	fmt.Println("====================================")
 }
@@ -120,74 +577,272 @@ func createRCFile(config *Config) error {
 	rcDir := filepath.Dir(config.RCFile)
 
 	// Create RC directory if it doesn't exist
-	if err := os.MkdirAll(rcDir, 0755); err != nil {
+	if err := fsperm.Default.MkdirAll(rcDir); err != nil {
 		return fmt.Errorf("failed to create RC directory: %w", err)
 	}
 
-	// RC file content
-	content := fmt.Sprintf(`# Bashlog RC Configuration
-# Generated at %s
+	content, err := config.Shell.GenerateInit(shell.InitOptions{
+		SessionID: config.SessionID,
+		Timezone:  config.Timezone,
+		LogDir:    config.LogDir,
+		HistFile:  config.HistFile,
+		Login:     config.Login,
+		SearchKey: config.SearchKey,
+		Escalate:  config.Escalate,
+		Sources:   config.Sources,
+
+		IncognitoPrefix: config.IncognitoPrefix,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate RC file: %w", err)
+	}
+
+	// Write RC file
+	if err := fsperm.Default.WriteFile(config.RCFile, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write RC file: %w", err)
+	}
 
-# Timezone setting
-export BASHLOG_TIMEZONE="%s"
+	slog.Info("RC file created", "path", config.RCFile)
+	return nil
+}
 
-# Logging directory
-export BASHLOG_LOG_DIR="%s"
+// runShell executes an interactive shell with logging enabled
+func runShell(config *Config) error {
+	// Setup command
+	args, shellEnv := config.Shell.LaunchArgs(config.RCFile, config.Login)
+	cmd := exec.Command(config.ShellPath, append(args, config.ShellArgs...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(sessionEnv(config), shellEnv...)
 
-# Session ID
-export BASHLOG_SESSION_ID="%s"
+	slog.Info("starting shell", "shell", config.ShellPath, "log", config.LogFile)
 
-# Enable logging
-export BASHLOG_ENABLED=1
+	if config.PTY {
+		transcript, err := fsperm.Default.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+		if err != nil {
+			return fmt.Errorf("failed to open session log: %w", err)
+		}
+		defer syncClose(transcript)
 
-# Log history
-export HISTFILE="%s"
-export HISTSIZE=10000
-export HISTFILESIZE=10000
+		opts := ptyOptions{
+			Transcript:   transcript,
+			InputContent: config.InputCapture == "content",
+		}
+		if config.InputCapture != "" {
+			inputFile, err := fsperm.Private.OpenFile(inputLogFile(config), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+			if err != nil {
+				return fmt.Errorf("failed to open input log: %w", err)
+			}
+			defer syncClose(inputFile)
+			opts.Input = inputFile
+		}
 
-# Log command execution
-PROMPT_COMMAND="history -a; $PROMPT_COMMAND"
-`, time.Now().UTC().Format("2006-01-02 15:04:05"), config.Timezone, config.LogDir, config.SessionID, filepath.Join(config.LogDir, ".bash_history"))
+		return runInPTY(cmd, config, opts)
+	}
 
-	// Write RC file
-	if err := os.WriteFile(config.RCFile, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write RC file: %w", err)
+	// Execute shell
+	if err := config.startShell(cmd.Start); err != nil {
+		return fmt.Errorf("failed to run shell: %w", err)
 	}
 
-	log.Printf("RC file created at: %s", config.RCFile)
-	return nil
+	return wait(cmd, config, nil)
 }
 
-// runShell executes an interactive shell with logging enabled
-func runShell(config *Config) error {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+// runCommand runs the shell non-interactively with the pass-through
+// arguments, recording the -c command string in the session history
+// unless it starts with the incognito prefix
+func runCommand(config *Config, command string) error {
+	entry := workspace.Entry{Command: command, Time: time.Now()}
+	if config.IncognitoPrefix == "" || !strings.HasPrefix(command, config.IncognitoPrefix) {
+		if err := workspace.AppendHistory(config.HistFile, []workspace.Entry{entry}); err != nil {
+			return fmt.Errorf("failed to record command: %w", err)
+		}
 	}
 
-	// Create log file path
-	logFile := filepath.Join(config.LogDir, fmt.Sprintf("session_%s.log", config.Time))
+	args := config.ShellArgs
+	if config.Login {
+		args = append([]string{"-l"}, args...)
+	}
 
-	// Setup command
-	cmd := exec.Command(shell, "-i")
+	cmd := exec.Command(config.ShellPath, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Env = append(sessionEnv(config), "BASHLOG_HISTFILE="+config.HistFile)
+
+	if err := config.startShell(cmd.Start); err != nil {
+		return fmt.Errorf("failed to run shell: %w", err)
+	}
+
+	err := wait(cmd, config, nil)
+	config.command = &commandResult{
+		entry:    entry,
+		status:   exitStatus(err),
+		duration: time.Since(entry.Time),
+	}
+	return err
+}
 
-	// Set environment variables for the shell
+// sessionEnv returns the environment for the recorded shell
+func sessionEnv(config *Config) []string {
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("BASHLOG_SESSION_ID=%s", config.SessionID))
-	env = append(env, fmt.Sprintf("BASHLOG_LOG_FILE=%s", logFile))
+	env = append(env, fmt.Sprintf("BASHLOG_SESSION_ALIAS=%s", config.Alias))
+	env = append(env, fmt.Sprintf("BASHLOG_LOG_FILE=%s", config.LogFile))
+	env = append(env, fmt.Sprintf("BASHLOG_PID=%d", os.Getpid()))
 	env = append(env, fmt.Sprintf("BASHLOG_TIMEZONE=%s", config.Timezone))
-	cmd.Env = env
+	env = append(env, fmt.Sprintf("BASHLOG_PARENT_SESSION_ID=%s", config.ParentSessionID))
+	env = append(env, fmt.Sprintf("BASHLOG_SESSION_DEPTH=%d", config.Depth))
+	env = append(env, fmt.Sprintf("BASHLOG_WORKSPACE=%s", config.Workspace))
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, fmt.Sprintf("BASHLOG_BIN=%s", exe))
+	}
+	return env
+}
 
-	log.Printf("Starting shell: %s", shell)
-	log.Printf("Logging to: %s", logFile)
+// handleNesting applies the --nested policy when bashlog is started from a
+// shell that is itself being logged.
+func handleNesting(config *Config, policy string) error {
+	parent := os.Getenv("BASHLOG_SESSION_ID")
 
-	// Execute shell
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run shell: %w", err)
+	switch policy {
+	case "refuse", "warn", "link":
+	default:
+		return fmt.Errorf("invalid --nested value '%s' (use refuse, warn or link)", policy)
+	}
+
+	if parent == "" {
+		return nil
+	}
+
+	switch policy {
+	case "refuse":
+		return fmt.Errorf("already running inside bashlog session %s (use --nested=link to record a child session)", parent)
+	case "warn":
+		slog.Warn("already running inside a bashlog session, starting an unrelated session", "parent", parent)
+	case "link":
+		config.ParentSessionID = parent
+		depth := 0
+		fmt.Sscanf(os.Getenv("BASHLOG_SESSION_DEPTH"), "%d", &depth)
+		config.Depth = depth + 1
 	}
 
 	return nil
 }
+
+// commandArg returns the command string of a -c option in the pass-through
+// arguments, which may be combined with other single-letter options as in
+// -ec. Only options before the first operand are considered.
+func commandArg(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return "", false
+		}
+		if strings.HasPrefix(arg, "--") {
+			continue
+		}
+		if strings.Contains(arg[1:], "c") && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// startSession writes the session's metadata and opens its journal, which
+// lets bashlog-mgr fsck finalize the session if bashlog is killed
+func startSession(config *Config) error {
+	inputCapture := config.InputCapture
+	if inputCapture == "" {
+		inputCapture = "none"
+	}
+
+	config.Meta = &session.Meta{
+		SessionID:       config.SessionID,
+		Alias:           config.Alias,
+		Shell:           config.Shell.Name(),
+		ShellVersion:    config.ShellVersion,
+		Started:         time.Now(),
+		PTY:             config.PTY,
+		InputCapture:    inputCapture,
+		ParentSessionID: config.ParentSessionID,
+		Depth:           config.Depth,
+		EscalatedFrom:   config.EscalatedFrom,
+		Escalation:      config.Escalation,
+		Workspace:       config.Workspace,
+		Host:            session.CurrentHost(),
+		Terminal:        currentTerminal(),
+		Clock:           session.ReadClock(),
+	}
+	config.Terminal = newTerminalRecorder(config.MetaFile, config.Meta.Terminal)
+	if config.Files != nil {
+		config.Meta.WatchedDir = config.Files.root
+	}
+	if u, err := user.Current(); err == nil {
+		config.Meta.User = u.Username
+	}
+	if info, err := os.Stat(config.HistFile); err == nil {
+		config.histOffset = info.Size()
+	}
+	// The shell appends to these, and would otherwise create them with its
+	// own umask
+	appended := []string{config.HistFile, session.StatusPath(config.HistFile), session.StartPath(config.HistFile)}
+	if config.Sources {
+		appended = append(appended, session.SourcesPath(config.HistFile))
+	}
+	for _, path := range appended {
+		f, err := fsperm.Default.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if err := config.Meta.Write(config.MetaFile); err != nil {
+		return err
+	}
+
+	journal, err := session.CreateJournal(config.MetaFile)
+	if err != nil {
+		return err
+	}
+	config.Journal = journal
+	return nil
+}
+
+// finishSession records the end of the session in its metadata: when and
+// why it ended, how long it lasted and the shell's exit status. The journal
+// is only removed once the metadata is safely written.
+func finishSession(config *Config, runErr error) error {
+	status := exitStatus(runErr)
+
+	reason := "exit"
+	switch {
+	case config.EndReason != "":
+		reason = config.EndReason
+	case config.Idle != nil && config.Idle.Expired():
+		reason = "idle"
+	}
+
+	config.Journal.Record("ending", fmt.Sprintf("status=%d reason=%s", status, reason))
+
+	if config.Egress != nil {
+		config.Meta.Egress = config.Egress.connections()
+	}
+	config.Meta.Finish(time.Now(), status, reason)
+	if err := config.Meta.Write(config.MetaFile); err != nil {
+		return err
+	}
+	return config.Journal.Remove()
+}
+
+// syncClose flushes f to disk before closing it, so the end of a session
+// survives the machine going down shortly after
+func syncClose(f *os.File) {
+	f.Sync()
+	f.Close()
+}
+
+// inputLogFile returns the path input timing is recorded to
+func inputLogFile(config *Config) string {
+	return strings.TrimSuffix(config.LogFile, ".log") + ".input"
+}
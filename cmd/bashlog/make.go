@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Environment of the recipe lines a task runner runs, telling the shell
+// bashlog stands in for where to spool their records and which shell to run
+// them with
+const (
+	viaSpoolEnv = "BASHLOG_VIA_SPOOL"
+	viaShellEnv = "BASHLOG_VIA_SHELL"
+)
+
+// viaShellScript is the name, in the spool, of the script task runners are
+// given for their shell. They need a path to a program, and bashlog is only
+// the recorder's shell with the via-shell argument
+const viaShellScript = "sh"
+
+// targetTagPrefix starts the tag of a recipe line naming its make target,
+// as in make:build
+const targetTagPrefix = "make:"
+
+// runMake implements "bashlog make --workspace x [target...]", which runs
+// make with bashlog standing in for the shell it runs recipe lines with, so
+// each line is recorded into the workspace with its output, exit status and
+// duration, tagged with the target it belongs to. With --via, another task
+// runner is run instead, which must run its commands with $SHELL -c, and
+// its commands carry no target. Nested runs, as $(MAKE) starts, are
+// recorded alike. bashlog ends with the runner's status
+func runMake(args []string) error {
+	fs := flag.NewFlagSet("make", flag.ContinueOnError)
+	wsName := fs.String("workspace", "", "Workspace to record the recipe lines into")
+	via := fs.String("via", "", "Task runner to run instead of make, which runs its commands with $SHELL -c")
+	shellName := fs.String("shell", "", "Shell recipe lines are run with (default: /bin/sh for make, else $SHELL)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *wsName == "" {
+		return errors.New("usage: bashlog make --workspace <name> [--via runner] [--shell path] [--] [target or runner argument...]")
+	}
+
+	shellPath := *shellName
+	switch {
+	case shellPath != "":
+	case *via == "":
+		shellPath = "/bin/sh"
+	default:
+		shellPath = os.Getenv("SHELL")
+		if shellPath == "" {
+			shellPath = "/bin/sh"
+		}
+	}
+	shellPath, err := exec.LookPath(shellPath)
+	if err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	if err := configureSettings(homeDir); err != nil {
+		return err
+	}
+	config := &Config{
+		SettingsFile: filepath.Join(homeDir, ".bashlog", "config.txt"),
+		HitLog:       filepath.Join(homeDir, ".bashlog", "rule-hits.log"),
+	}
+	if err := useWorkspace(config, *wsName); err != nil {
+		return err
+	}
+
+	spool, err := os.MkdirTemp("", "bashlog-make-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(spool)
+	script, err := writeViaShell(spool)
+	if err != nil {
+		return err
+	}
+
+	runner := *via
+	runnerArgs := fs.Args()
+	env := append(os.Environ(), viaSpoolEnv+"="+spool, viaShellEnv+"="+shellPath)
+	if runner == "" {
+		// make ignores $SHELL, and takes the shell from its command line
+		// over the makefile's, in sub-makes too
+		runner = "make"
+		runnerArgs = append([]string{"SHELL=" + script, ".SHELLFLAGS=--target=$@ -c"}, runnerArgs...)
+	} else {
+		env = append(env, "SHELL="+script)
+	}
+	cmd := exec.Command(runner, runnerArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	runErr := shellStatus(cmd, cmd.Run())
+
+	batch, err := readSpool(spool)
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if err := ingestBatch(config, workspace.OriginScript, batch); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "bashlog: recorded %d recipe line(s) into workspace '%s'\n", len(batch), config.Workspace)
+	return runErr
+}
+
+// writeViaShell writes the script standing in for the shell of task
+// runners into spool, returning its path
+func writeViaShell(spool string) (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	quoted := "'" + strings.ReplaceAll(self, "'", `'\''`) + "'"
+	path := filepath.Join(spool, viaShellScript)
+	script := "#!/bin/sh\nexec " + quoted + " via-shell \"$@\"\n"
+	if err := os.WriteFile(path, []byte(script), 0o700); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// runViaShell implements "bashlog via-shell [--target=name] <shell args>",
+// run by task runners as their shell: it runs the shell in $BASHLOG_VIA_SHELL
+// with the arguments, passing its output through, and spools a record of
+// the command given with -c, and the target, for bashlog make to ingest.
+// It exits with the shell's status
+func runViaShell(args []string) error {
+	target := ""
+	if len(args) > 0 && strings.HasPrefix(args[0], "--target=") {
+		target = strings.TrimPrefix(args[0], "--target=")
+		args = args[1:]
+	}
+	shellPath := os.Getenv(viaShellEnv)
+	if shellPath == "" {
+		shellPath = "/bin/sh"
+	}
+	command := ""
+	for i, a := range args {
+		if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.Contains(a, "c") && i+1 < len(args) {
+			command = args[i+1]
+			break
+		}
+	}
+
+	out := &limitedBuffer{limit: ciOutputLimit}
+	cmd := exec.Command(shellPath, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, out)
+	cmd.Stderr = io.MultiWriter(os.Stderr, out)
+	started := time.Now()
+	err := shellStatus(cmd, cmd.Run())
+	ms := time.Since(started).Milliseconds()
+
+	spool := os.Getenv(viaSpoolEnv)
+	if spool != "" && strings.TrimSpace(command) != "" {
+		code := exitStatus(err)
+		rec := batchRecord{Command: command, Time: started, Exit: &code, Duration: &ms, Output: out.String()}
+		if target != "" {
+			rec.Tags = []string{targetTagPrefix + target}
+		}
+		if werr := spoolRecord(spool, rec); werr != nil {
+			fmt.Fprintf(os.Stderr, "bashlog: failed to record %q: %v\n", command, werr)
+		}
+	}
+	return err
+}
+
+// spoolRecord writes rec to a file of its own in spool, as recipe lines run
+// side by side with make -j
+func spoolRecord(spool string, rec batchRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	name := strconv.FormatInt(rec.Time.UnixNano(), 10) + "-" + strconv.Itoa(os.Getpid()) + ".json"
+	return fsperm.Private.WriteFile(filepath.Join(spool, name), append(data, '\n'))
+}
+
+// readSpool reads the records spooled by runViaShell in the order their
+// commands started
+func readSpool(spool string) ([]batchRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(spool, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var batch []batchRecord
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		recs, err := readBatch(f, time.Now())
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		batch = append(batch, recs...)
+	}
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Time.Before(batch[j].Time) })
+	return batch, nil
+}
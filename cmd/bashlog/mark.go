@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// runMark implements "bashlog mark <note>", run from inside a recorded
+// session: it appends an annotated marker to the session log so moments
+// such as "reproduced the bug here" can be found later
+func runMark(args []string) error {
+	note := strings.TrimSpace(strings.Join(args, " "))
+	if note == "" {
+		return errors.New("usage: bashlog mark <note>")
+	}
+
+	logFile := os.Getenv("BASHLOG_LOG_FILE")
+	if logFile == "" {
+		return errors.New("not inside a bashlog session")
+	}
+
+	now := time.Now()
+	if loc, err := time.LoadLocation(os.Getenv("BASHLOG_TIMEZONE")); err == nil {
+		now = now.In(loc)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := configureSettings(home); err != nil {
+			return err
+		}
+	}
+	f, err := fsperm.Default.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	// The transcript is raw terminal output, hence the carriage returns
+	if _, err := fmt.Fprintf(f, "\r\n%s\r\n", markLine(now, note)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// markLine is how a marker reads in the session log
+func markLine(t time.Time, note string) string {
+	return fmt.Sprintf("### bashlog mark %s: %s", t.Format("2006-01-02 15:04:05 MST"), strings.ReplaceAll(note, "\n", " "))
+}
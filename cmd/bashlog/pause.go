@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// runPause implements "bashlog pause" and "bashlog resume", run from
+// inside a session by the shell functions of the same name, which also
+// stop the shell's own hook recording commands. It marks the session log
+// and tells the session's bashlog process to stop or restart recording
+// the terminal, for a moment such as typing a password on the command
+// line
+func runPause(paused bool) error {
+	logFile := os.Getenv("BASHLOG_LOG_FILE")
+	pid, err := strconv.Atoi(os.Getenv("BASHLOG_PID"))
+	if logFile == "" || err != nil {
+		return errors.New("not inside a bashlog session")
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("session process not found: %w", err)
+	}
+
+	now := time.Now()
+	if loc, err := time.LoadLocation(os.Getenv("BASHLOG_TIMEZONE")); err == nil {
+		now = now.In(loc)
+	}
+
+	// Pausing stops the transcript before the marker and resuming starts
+	// it after, so that nothing typed while paused lands between them
+	if paused {
+		if err := signalPause(process, true); err != nil {
+			return err
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := configureSettings(home); err != nil {
+			return err
+		}
+	}
+	f, err := fsperm.Default.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "\r\n%s\r\n", pauseLine(now, paused)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !paused {
+		return signalPause(process, false)
+	}
+	fmt.Fprintln(os.Stderr, "bashlog: recording paused, run 'bashlog resume' to carry on")
+	return nil
+}
+
+// pauseLine is how pausing and resuming read in the session log
+func pauseLine(t time.Time, paused bool) string {
+	state := "resumed"
+	if paused {
+		state = "paused"
+	}
+	return fmt.Sprintf("### bashlog recording %s %s", state, t.Format("2006-01-02 15:04:05 MST"))
+}
+
+// recordGate drops what is written through it while recording is paused
+type recordGate struct {
+	paused atomic.Bool
+}
+
+// writer wraps w, or returns nil for a nil w
+func (g *recordGate) writer(w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	return gatedWriter{g, w}
+}
+
+type gatedWriter struct {
+	gate *recordGate
+	w    io.Writer
+}
+
+func (g gatedWriter) Write(p []byte) (int, error) {
+	if g.gate.paused.Load() {
+		return len(p), nil
+	}
+	return g.w.Write(p)
+}
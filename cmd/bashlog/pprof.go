@@ -0,0 +1,21 @@
+//go:build !agent
+
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// startProfiler serves net/http/pprof on addr for the life of the process
+func startProfiler(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("pprof listening", "url", "http://"+ln.Addr().String()+"/debug/pprof/")
+	go http.Serve(ln, nil)
+	return nil
+}
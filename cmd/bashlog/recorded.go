@@ -0,0 +1,69 @@
+//go:build !agent
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/redact"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// recordedWorkspace is a bashlog-mgr workspace search and suggest read
+type recordedWorkspace struct {
+	Path string
+	// Masked is set for workspaces marked sensitive, and for all when
+	// redact.on-read is set, whose commands are shown with their secrets
+	// masked
+	Masked bool
+}
+
+// recordedWorkspaces returns the workspaces of every root, with storage
+// configured to read them by the user's config.txt
+func recordedWorkspaces(homeDir string) ([]recordedWorkspace, error) {
+	if err := configureSettings(homeDir); err != nil {
+		return nil, err
+	}
+	settings := workspace.ReadConfig(filepath.Join(homeDir, ".bashlog", "config.txt"))
+	maskAll := settings["redact.on-read"] == "true"
+
+	var found []recordedWorkspace
+	for _, root := range workspace.Roots(settings, filepath.Join(homeDir, ".bashlog-workspaces")) {
+		dirs, _ := os.ReadDir(root.Path)
+		for _, d := range dirs {
+			wsPath := filepath.Join(root.Path, d.Name())
+			config := workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))
+			if !d.IsDir() || len(config) == 0 {
+				continue
+			}
+			found = append(found, recordedWorkspace{Path: wsPath, Masked: maskAll || config["sensitive"] == "true"})
+		}
+	}
+	return found, nil
+}
+
+// Entries reads the workspace's commands through its storage backend,
+// masked if the workspace is
+func (w recordedWorkspace) Entries() ([]workspace.Entry, error) {
+	entries, err := storage.Read(w.Path)
+	if err != nil || !w.Masked {
+		return entries, err
+	}
+	for i := range entries {
+		entries[i].Command = redact.Secrets(entries[i].Command)
+	}
+	return entries, nil
+}
+
+// Sources are the files whose changes show the workspace has new commands
+// or is masked differently: its config, whose command count each append
+// bumps, and its history file if it has one
+func (w recordedWorkspace) Sources() []string {
+	sources := []string{filepath.Join(w.Path, workspace.ConfigFile)}
+	if storage.For(w.Path).Name() == storage.Files {
+		sources = append(sources, filepath.Join(w.Path, workspace.HistoryFile))
+	}
+	return sources
+}
@@ -0,0 +1,189 @@
+//go:build !agent
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// searchPageSize is how many matches the built-in picker lists at once
+const searchPageSize = 15
+
+// runSearch implements "bashlog search [query]", bound to Ctrl-R inside
+// recorded sessions: it lets the user pick a command from everything
+// bashlog has recorded, across sessions and workspaces, and prints the
+// pick so the binding can put it on the command line. Cancelling prints
+// nothing
+func runSearch(args []string) error {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	query := strings.Join(args, " ")
+
+	commands, err := recordedCommands()
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		return errors.New("no commands recorded yet")
+	}
+
+	var picked string
+	if fzf, err := exec.LookPath("fzf"); err == nil {
+		picked, err = pickWithFzf(fzf, commands, query)
+		if err != nil {
+			return err
+		}
+	} else {
+		picked, err = pickFromList(commands, query)
+		if err != nil {
+			return err
+		}
+	}
+
+	if picked != "" {
+		fmt.Println(picked)
+	}
+	return nil
+}
+
+// recordedCommands returns every distinct command in the recorder's
+// session histories and the bashlog-mgr workspaces, most recent first
+func recordedCommands() ([]string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	workspaces, err := recordedWorkspaces(homeDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := session.ReadHistory(filepath.Join(homeDir, ".bashlog", "logs"))
+	for _, w := range workspaces {
+		found, err := w.Entries()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, found...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+
+	seen := make(map[string]bool)
+	var commands []string
+	for _, e := range entries {
+		if e.Command == "" || seen[e.Command] {
+			continue
+		}
+		seen[e.Command] = true
+		commands = append(commands, e.Command)
+	}
+	return commands, nil
+}
+
+// pickWithFzf lets fzf do the searching. fzf draws on the terminal itself,
+// so only its pick comes back on stdout
+func pickWithFzf(fzf string, commands []string, query string) (string, error) {
+	cmd := exec.Command(fzf, "--read0", "--print0", "--height=40%", "--reverse", "--tiebreak=index", "--prompt=bashlog> ", "--query="+query)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\x00"))
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+		// No match, or cancelled with Esc or Ctrl-C
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fzf: %w", err)
+	}
+	return string(bytes.TrimRight(out, "\x00\n")), nil
+}
+
+// pickFromList is the picker used without fzf: it lists the most recent
+// matches on the terminal and reads either a number to pick one or more
+// text to narrow the search down
+func pickFromList(commands []string, query string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to search on: %w", err)
+	}
+	defer tty.Close()
+	defer cookedMode(tty)()
+	input := bufio.NewReader(tty)
+
+	for {
+		matches := matchCommands(commands, query)
+		fmt.Fprintln(tty)
+		if len(matches) == 0 {
+			fmt.Fprintf(tty, "  no matches for '%s'\n", query)
+		}
+		for i := min(len(matches), searchPageSize) - 1; i >= 0; i-- {
+			fmt.Fprintf(tty, "  %2d  %s\n", i+1, strings.ReplaceAll(matches[i], "\n", "; "))
+		}
+		fmt.Fprintf(tty, "bashlog search [%s] (number picks, text narrows, empty cancels): ", query)
+
+		line, err := input.ReadString('\n')
+		if err != nil {
+			return "", nil
+		}
+		line = strings.TrimSpace(line)
+		switch n, err := strconv.Atoi(line); {
+		case line == "":
+			return "", nil
+		case err == nil && n >= 1 && n <= min(len(matches), searchPageSize):
+			return matches[n-1], nil
+		default:
+			query = strings.TrimSpace(query + " " + line)
+		}
+	}
+}
+
+// cookedMode puts the terminal back into line mode with echo for as long
+// as the picker reads from it, since line editors such as readline call
+// key bindings with the terminal still raw. It returns a function that
+// restores the previous settings
+func cookedMode(tty *os.File) func() {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = tty
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	stty("icanon", "echo", "icrnl")
+	return func() { stty(saved) }
+}
+
+// matchCommands keeps the commands containing every word of query,
+// ignoring case
+func matchCommands(commands []string, query string) []string {
+	words := strings.Fields(strings.ToLower(query))
+	var matches []string
+	for _, c := range commands {
+		lower := strings.ToLower(c)
+		all := true
+		for _, w := range words {
+			all = all && strings.Contains(lower, w)
+		}
+		if all {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/logger"
+	"github.com/interhack86/bashlog/internal/pty"
+)
+
+// exitError carries the recorded shell's exit status up to main, so that
+// bashlog exits with the same code as the shell it wraps
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("shell exited with status %d", e.code)
+}
+
+// exitWith exits with the shell's own status when err reports one, and
+// reports any other error as a failure to run the shell
+func exitWith(err error) {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	logger.Fatal("failed to run shell", "err", err)
+}
+
+// shutdownGrace is how long the shell has to exit after bashlog is asked to
+// terminate before it is killed
+const shutdownGrace = 5 * time.Second
+
+// driveSettle is how long a driven session must print nothing, once its
+// script is done, before bashlog ends it
+const driveSettle = 200 * time.Millisecond
+
+// wait waits for cmd, forwarding signals bashlog receives in the meantime.
+// Terminal resizes are recorded, and onResize, if set, is called for them
+// instead of forwarding them. With an idle timeout configured, the shell
+// is hung up once the session has been inactive for too long. When
+// bashlog itself is told to terminate or hang up, the shell gets
+// shutdownGrace to exit before it is killed, so that the session can
+// always be finalized. The signals sent by bashlog pause and resume stop
+// and restart recording the terminal. With --egress, the shell's outbound
+// connections are sampled meanwhile, and rules with a terminal action
+// checked against the commands the shell records. A hardened bashlog is
+// locked down first, and the shell killed if that fails.
+func wait(cmd *exec.Cmd, config *Config, onResize func()) error {
+	idle := config.Idle
+
+	if config.Hardening != nil {
+		if err := config.Hardening.lockDown(); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, append(forwardedSignals, pauseSignals...)...)
+	defer signal.Stop(signals)
+
+	if config.Egress != nil {
+		config.Egress.start(cmd.Process.Pid)
+		defer config.Egress.stop()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var idleCheck <-chan time.Time
+	if idle != nil {
+		ticker := time.NewTicker(idle.checkInterval())
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+
+	var alertCheck <-chan time.Time
+	if config.Alerts != nil {
+		ticker := time.NewTicker(alertInterval)
+		defer ticker.Stop()
+		alertCheck = ticker.C
+	}
+
+	heartbeat := time.NewTicker(time.Minute)
+	defer heartbeat.Stop()
+
+	var kill <-chan time.Time
+
+	for {
+		select {
+		case sig := <-signals:
+			if paused, ok := isPause(sig); ok {
+				config.Recording.paused.Store(paused)
+				if paused {
+					config.Journal.Record("paused", "")
+				} else {
+					config.Journal.Record("resumed", "")
+				}
+				continue
+			}
+			if isResize(sig) {
+				config.Terminal.resized()
+				if onResize != nil {
+					onResize()
+					continue
+				}
+			}
+			cmd.Process.Signal(sig)
+			if isShutdown(sig) && kill == nil {
+				config.EndReason = sig.String()
+				config.Journal.Record("signal", sig.String())
+				kill = time.After(shutdownGrace)
+			}
+		case <-kill:
+			slog.Warn("shell did not exit in time, killing it", "grace", shutdownGrace)
+			cmd.Process.Kill()
+		case <-alertCheck:
+			config.Alerts.check()
+		case <-heartbeat.C:
+			config.Journal.Record("alive", "")
+		case <-idleCheck:
+			if idle.Idle() && !idle.Expired() {
+				slog.Info("session idle, closing", "timeout", idle.timeout)
+				idle.expire()
+				cmd.Process.Signal(hangupSignal)
+			}
+		case err := <-done:
+			return shellStatus(cmd, err)
+		}
+	}
+}
+
+// shellStatus converts the result of waiting for the shell into an
+// exitError when the shell did not exit cleanly
+func shellStatus(cmd *exec.Cmd, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	if code, ok := exitCodeForSignal(cmd.ProcessState); ok {
+		return &exitError{code: code}
+	}
+	return &exitError{code: exitErr.ExitCode()}
+}
+
+// ptyOptions controls what is recorded from a PTY session
+type ptyOptions struct {
+	// Transcript receives everything the shell prints
+	Transcript io.Writer
+
+	// Input, if set, receives the timing of typed input, along with the
+	// input itself when InputContent is set
+	Input        io.Writer
+	InputContent bool
+}
+
+// runInPTY runs cmd on a pseudo-terminal, relaying the user's terminal to it
+func runInPTY(cmd *exec.Cmd, config *Config, opts ptyOptions) error {
+	idle := config.Idle
+
+	var master *os.File
+	err := config.startShell(func() (err error) {
+		master, err = pty.Start(cmd)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start shell in pty: %w", err)
+	}
+	defer master.Close()
+
+	resize := func() {
+		if size, err := pty.GetSize(os.Stdin); err == nil {
+			pty.SetSize(master, size)
+		}
+	}
+	resize()
+
+	// A driven session leaves the user's terminal as it is, for Ctrl-C to
+	// stop it
+	if pty.IsTerminal(os.Stdin) && config.Drive == nil {
+		state, err := pty.MakeRaw(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+		}
+		defer pty.Restore(os.Stdin, state)
+	}
+
+	var stdin io.Reader = os.Stdin
+	if opts.Input != nil {
+		stdin = io.TeeReader(stdin, config.Recording.writer(newInputRecorder(opts.Input, opts.InputContent)))
+	}
+	stdout := io.MultiWriter(os.Stdout, config.Recording.writer(opts.Transcript), config.Recording.writer(config.Terminal))
+	if idle != nil {
+		stdin = io.TeeReader(stdin, idle)
+		stdout = io.MultiWriter(stdout, idle)
+	}
+	var driveErr error
+	driven := make(chan struct{})
+	if config.Drive != nil {
+		stdout = io.MultiWriter(stdout, config.Drive)
+		go func() {
+			defer close(driven)
+			driveErr = driveSession(cmd, master, config, opts)
+		}()
+	} else {
+		close(driven)
+		go io.Copy(master, stdin)
+	}
+
+	// The copy ends with an error once the shell exits and the slave side
+	// closes; wait for it so that no trailing output is lost
+	output := make(chan struct{})
+	go func() {
+		io.Copy(stdout, master)
+		close(output)
+	}()
+
+	err = wait(cmd, config, resize)
+	<-output
+	<-driven
+	if driveErr != nil {
+		return &exitError{code: 1}
+	}
+	return err
+}
+
+// driveSession types the input of the session's script into master,
+// recorded as typed input is, and ends the shell with Ctrl-D once the
+// script is done and the shell has settled. A script that stops short
+// hangs the shell up
+func driveSession(cmd *exec.Cmd, master io.Writer, config *Config, opts ptyOptions) error {
+	input := master
+	if opts.Input != nil {
+		input = io.MultiWriter(input, config.Recording.writer(newInputRecorder(opts.Input, opts.InputContent)))
+	}
+	if config.Idle != nil {
+		input = io.MultiWriter(input, config.Idle)
+	}
+	if err := config.Drive.Run(input); err != nil {
+		fmt.Fprintf(os.Stderr, "\r\nbashlog: %v\r\n", err)
+		cmd.Process.Signal(hangupSignal)
+		return err
+	}
+	// Ctrl-D typed ahead of the shell's prompt can be lost as the shell
+	// sets the terminal up to read a line
+	config.Drive.Quiet(driveSettle)
+	io.WriteString(master, "\x04")
+	return nil
+}
+
+// inputRecorder logs each chunk of terminal input as a line holding the
+// seconds elapsed since the session started and the number of bytes, plus
+// the quoted bytes themselves when content recording was requested
+type inputRecorder struct {
+	w       io.Writer
+	start   time.Time
+	content bool
+}
+
+func newInputRecorder(w io.Writer, content bool) *inputRecorder {
+	return &inputRecorder{w: w, start: time.Now(), content: content}
+}
+
+func (r *inputRecorder) Write(p []byte) (int, error) {
+	elapsed := time.Since(r.start).Seconds()
+	if r.content {
+		fmt.Fprintf(r.w, "%.6f %d %s\n", elapsed, len(p), strconv.Quote(string(p)))
+	} else {
+		fmt.Fprintf(r.w, "%.6f %d\n", elapsed, len(p))
+	}
+	return len(p), nil
+}
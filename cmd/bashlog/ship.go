@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/interhack86/bashlog/internal/remote"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// useRemote ships the session's commands to the bashlog-mgr serve instance
+// at url when it ends, in addition to the local workspace or, with only,
+// instead of it. URL and token fall back on the remote.url and
+// remote.token settings
+func useRemote(config *Config, url, token string, only bool) error {
+	settings := workspace.ReadConfig(config.SettingsFile)
+	if url == "" {
+		url = settings["remote.url"]
+	}
+	if token == "" {
+		token = settings["remote.token"]
+	}
+	if url == "" {
+		if only {
+			return fmt.Errorf("--remote-only needs --remote or a remote.url setting")
+		}
+		return nil
+	}
+	if token == "" {
+		return fmt.Errorf("--remote needs --token, $BASHLOG_TOKEN or a remote.token setting")
+	}
+	if config.Workspace == "" {
+		return fmt.Errorf("--remote needs --workspace to ship commands into")
+	}
+
+	config.Remote = &remote.Client{
+		URL:   url,
+		Token: token,
+		Spool: filepath.Join(filepath.Dir(config.SettingsFile), "spool"),
+	}
+	return nil
+}
+
+// shipSession sends the session's commands to the remote server, keeping
+// them in the spool for the next session if it can't be reached
+func shipSession(config *Config, entries []workspace.Entry) {
+	host := config.Meta.Host
+	b := remote.NewBatch(batchID(workspace.HostKey(host.Name, host.MachineID), config.SessionID), config.Workspace, host.Name, entries)
+	b.Origin = sessionOrigin(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), remote.Timeout)
+	defer cancel()
+	sendErr, err := config.Remote.Deliver(ctx, b)
+	switch {
+	case err != nil:
+		slog.Error("failed to ship commands or spool them, they are only in the session log", "remote", config.Remote.URL, "send_err", sendErr, "err", err)
+	case sendErr != nil && !remote.Retryable(sendErr):
+		slog.Error("server refused the commands, kept in the spool as "+remote.RejectedSuffix, "remote", config.Remote.URL, "spool", config.Remote.Spool, "err", sendErr)
+	case sendErr != nil:
+		slog.Warn("could not ship commands, spooled until the server is reachable", "remote", config.Remote.URL, "pending", config.Remote.Pending(), "err", sendErr)
+	default:
+		slog.Debug("shipped commands", "remote", config.Remote.URL, "commands", len(entries))
+	}
+}
+
+// batchID names a session's batch, random beyond the host and session ID
+// since sessions started on one host in the same second share those
+func batchID(hostKey, sessionID string) string {
+	nonce := make([]byte, 6)
+	rand.Read(nonce)
+	return hostKey + "-" + sessionID + "-" + hex.EncodeToString(nonce)
+}
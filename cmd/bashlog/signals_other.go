@@ -0,0 +1,44 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// forwardedSignals are passed on to the recorded shell
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// hangupSignal asks the shell to close the session
+var hangupSignal = os.Kill
+
+// isShutdown always reports false, as only interrupts are forwarded here
+func isShutdown(sig os.Signal) bool {
+	return false
+}
+
+// isResize always reports false, as there is no resize signal here
+func isResize(sig os.Signal) bool {
+	return false
+}
+
+// exitCodeForSignal reports false, as processes are not killed by signals
+// on this platform
+func exitCodeForSignal(state *os.ProcessState) (int, bool) {
+	return 0, false
+}
+
+// pauseSignals is empty, as there are no user signals here
+var pauseSignals []os.Signal
+
+// isPause always reports false
+func isPause(sig os.Signal) (paused, ok bool) {
+	return false, false
+}
+
+// signalPause fails, as a session can't be signalled here; the shell
+// still stops recording commands
+func signalPause(p *os.Process, paused bool) error {
+	return errors.New("pausing the terminal recording isn't supported on this platform")
+}
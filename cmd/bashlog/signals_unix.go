@@ -0,0 +1,56 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are passed on to the recorded shell
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH}
+
+// hangupSignal asks the shell to close the session, saving its history
+const hangupSignal = syscall.SIGHUP
+
+// isShutdown reports whether sig asks bashlog to end the session
+func isShutdown(sig os.Signal) bool {
+	return sig == syscall.SIGTERM || sig == syscall.SIGHUP
+}
+
+// isResize reports whether sig reports a terminal window size change
+func isResize(sig os.Signal) bool {
+	return sig == syscall.SIGWINCH
+}
+
+// exitCodeForSignal follows the shell convention of 128 plus the signal
+// number for processes killed by a signal
+func exitCodeForSignal(state *os.ProcessState) (int, bool) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return 128 + int(status.Signal()), true
+}
+
+// pauseSignals pause and resume recording the terminal
+var pauseSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+// isPause reports whether sig pauses or resumes recording, and which
+func isPause(sig os.Signal) (paused, ok bool) {
+	switch sig {
+	case syscall.SIGUSR1:
+		return true, true
+	case syscall.SIGUSR2:
+		return false, true
+	}
+	return false, false
+}
+
+// signalPause asks the session's bashlog process to pause or resume
+func signalPause(p *os.Process, paused bool) error {
+	if paused {
+		return p.Signal(syscall.SIGUSR1)
+	}
+	return p.Signal(syscall.SIGUSR2)
+}
@@ -0,0 +1,79 @@
+//go:build !agent
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/suggest"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// runSuggest implements "bashlog suggest <prefix>", bound to Alt-S inside
+// recorded sessions: it prints the most likely completions of the command
+// line typed so far, best first, from everything bashlog has recorded. The
+// model is kept in ~/.bashlog/suggest.json and only rebuilt once what it
+// was built from has changed, so asking is quick enough for a key binding
+func runSuggest(args []string) error {
+	fs := flag.NewFlagSet("suggest", flag.ContinueOnError)
+	limit := fs.Int("limit", 5, "Print at most this many completions")
+	rebuild := fs.Bool("rebuild", false, "Rebuild the model even if nothing was recorded since it was built")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	prefix := strings.Join(fs.Args(), " ")
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	histories, _ := session.HistoryFiles(filepath.Join(homeDir, ".bashlog", "logs"))
+	workspaces, err := recordedWorkspaces(homeDir)
+	if err != nil {
+		return err
+	}
+	sources := suggestSources(homeDir, histories, workspaces)
+	modelPath := filepath.Join(homeDir, ".bashlog", "suggest.json")
+
+	model, err := suggest.Load(modelPath)
+	if err != nil || *rebuild || !model.Current(sources) {
+		var entries []workspace.Entry
+		for _, path := range histories {
+			if found, err := workspace.ReadHistory(path); err == nil {
+				entries = append(entries, found...)
+			}
+		}
+		for _, w := range workspaces {
+			if found, err := w.Entries(); err == nil {
+				entries = append(entries, found...)
+			}
+		}
+		model = suggest.Build(entries, time.Now())
+		model.Sources = sources
+		if err := model.Save(modelPath); err != nil {
+			return fmt.Errorf("failed to save the suggestion model: %w", err)
+		}
+	}
+
+	for _, s := range model.Complete(prefix, *limit) {
+		fmt.Println(s.Command)
+	}
+	return nil
+}
+
+// suggestSources returns the files whose changes show there is something
+// new to suggest from, as they are now: the recorder's session histories,
+// the workspaces' sources and the config.txt saying what is masked
+func suggestSources(homeDir string, histories []string, workspaces []recordedWorkspace) []suggest.Source {
+	paths := append([]string{filepath.Join(homeDir, ".bashlog", "config.txt")}, histories...)
+	for _, w := range workspaces {
+		paths = append(paths, w.Sources()...)
+	}
+	return suggest.Stat(paths)
+}
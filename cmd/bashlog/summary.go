@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/risk"
+	"github.com/interhack86/bashlog/internal/rules"
+	"github.com/interhack86/bashlog/internal/session"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// How much of each list the session summary shows
+const (
+	summaryFailures    = 5
+	summaryDirectories = 3
+	summaryNotable     = 5
+)
+
+// summarizeSession prints what the session did once its shell has exited,
+// and keeps the summary next to its metadata for bashlog-mgr sessions
+// --summary
+func summarizeSession(config *Config, hits []rules.Hit, show bool) {
+	entries, err := sessionEntries(config)
+	if err != nil {
+		slog.Warn("failed to read session history", "err", err)
+		return
+	}
+	summary := sessionSummary(config.Meta.Duration, entries, sessionStatuses(config, entries), hits)
+	if err := fsperm.Default.WriteFile(session.SummaryPath(config.MetaFile), []byte(summary)); err != nil {
+		slog.Warn("failed to store session summary", "err", err)
+	}
+	if show {
+		fmt.Print("\n" + summary)
+	}
+}
+
+// sessionSummary describes a session: how long it lasted, the commands it
+// ran and which of them failed, the directories worked in most, and the
+// commands rules tagged or that score as risky. Failures and directories
+// are known for shells whose hooks record them
+func sessionSummary(duration time.Duration, entries []workspace.Entry, statuses []*session.CommandStatus, hits []rules.Hit) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "====================================")
+	fmt.Fprintln(&b, "       Bashlog Session Summary")
+	fmt.Fprintln(&b, "====================================")
+	fmt.Fprintf(&b, "Duration:    %s\n", duration)
+
+	var failed []string
+	dirs := make(map[string]int)
+	known := 0
+	for i, s := range statuses {
+		if s == nil {
+			continue
+		}
+		known++
+		dirs[s.Dir]++
+		if s.Status != 0 {
+			failed = append(failed, fmt.Sprintf("exit %-3d %s", s.Status, entries[i].Command))
+		}
+	}
+	switch {
+	case known == 0:
+		fmt.Fprintf(&b, "Commands:    %d\n", len(entries))
+	case len(failed) == 0:
+		fmt.Fprintf(&b, "Commands:    %d, none failed\n", len(entries))
+	default:
+		fmt.Fprintf(&b, "Commands:    %d, %d failed\n", len(entries), len(failed))
+	}
+	summaryList(&b, "Failed:", failed, summaryFailures)
+
+	var top []string
+	for dir := range dirs {
+		top = append(top, dir)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if dirs[top[i]] != dirs[top[j]] {
+			return dirs[top[i]] > dirs[top[j]]
+		}
+		return top[i] < top[j]
+	})
+	if len(top) > summaryDirectories {
+		top = top[:summaryDirectories]
+	}
+	for i, dir := range top {
+		top[i] = fmt.Sprintf("%s (%d)", shortenHome(dir), dirs[dir])
+	}
+	if len(top) > 0 {
+		fmt.Fprintf(&b, "Directories: %s\n", strings.Join(top, ", "))
+	}
+
+	// Tagged commands first, then the risky ones rules didn't tag
+	var notable []string
+	tagged := make(map[workspace.Entry]bool)
+	for _, t := range hitTags(hits) {
+		tagged[t.Entry] = true
+		notable = append(notable, fmt.Sprintf("[%s] %s", strings.Join(t.Tags, ", "), t.Command))
+	}
+	for _, e := range entries {
+		if tagged[workspace.Entry{Command: e.Command, Time: e.Time}] {
+			continue
+		}
+		if level, _ := risk.Score(e.Command); level >= risk.High {
+			notable = append(notable, fmt.Sprintf("[%s risk] %s", level, e.Command))
+		}
+	}
+	summaryList(&b, "Notable:", notable, summaryNotable)
+	return b.String()
+}
+
+// summaryList adds a labelled list to a summary, one item per line, with
+// the most recent max items of a longer one
+func summaryList(b *strings.Builder, label string, items []string, max int) {
+	if len(items) == 0 {
+		return
+	}
+	if len(items) > max {
+		fmt.Fprintf(b, "%-12s (%d more before these)\n", label, len(items)-max)
+		items, label = items[len(items)-max:], ""
+	}
+	for _, item := range items {
+		fmt.Fprintf(b, "%-12s %s\n", label, item)
+		label = ""
+	}
+}
+
+// shortenHome writes a directory under the home directory with ~
+func shortenHome(dir string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rel, ok := strings.CutPrefix(dir, home+string(filepath.Separator)); ok {
+		return "~/" + rel
+	}
+	return dir
+}
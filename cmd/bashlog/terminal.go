@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/pty"
+	"github.com/interhack86/bashlog/internal/session"
+)
+
+// multiplexerTimeout bounds asking tmux where the session runs
+const multiplexerTimeout = time.Second
+
+// maxTitle bounds the window title kept from a single escape sequence
+const maxTitle = 512
+
+// emulatorHints tell terminal emulators apart by the variables they set,
+// for those that don't set TERM_PROGRAM
+var emulatorHints = []struct{ env, name string }{
+	{"KITTY_WINDOW_ID", "kitty"},
+	{"WEZTERM_PANE", "WezTerm"},
+	{"ALACRITTY_WINDOW_ID", "Alacritty"},
+	{"WT_SESSION", "Windows Terminal"},
+	{"KONSOLE_VERSION", "Konsole"},
+	{"GNOME_TERMINAL_SCREEN", "GNOME Terminal"},
+	{"TERMINATOR_UUID", "Terminator"},
+}
+
+// currentTerminal describes the terminal bashlog was started in
+func currentTerminal() session.Terminal {
+	t := session.Terminal{Term: os.Getenv("TERM"), Multiplexer: multiplexer()}
+	if program := os.Getenv("TERM_PROGRAM"); program != "" {
+		t.Program = strings.TrimSpace(program + " " + os.Getenv("TERM_PROGRAM_VERSION"))
+	} else {
+		for _, hint := range emulatorHints {
+			if os.Getenv(hint.env) != "" {
+				t.Program = hint.name
+				break
+			}
+		}
+		if t.Program == "" && os.Getenv("VTE_VERSION") != "" {
+			t.Program = "VTE " + os.Getenv("VTE_VERSION")
+		}
+	}
+	if size, err := pty.GetSize(os.Stdin); err == nil {
+		t.Cols, t.Rows = int(size.Cols), int(size.Rows)
+	}
+	return t
+}
+
+// multiplexer names the tmux, screen or zellij pane bashlog runs in
+func multiplexer() string {
+	switch {
+	case os.Getenv("TMUX") != "":
+		pane := os.Getenv("TMUX_PANE")
+		ctx, cancel := context.WithTimeout(context.Background(), multiplexerTimeout)
+		defer cancel()
+		args := []string{"display-message", "-p"}
+		if pane != "" {
+			args = append(args, "-t", pane)
+		}
+		if out, err := exec.CommandContext(ctx, "tmux", append(args, "#S:#I.#P")...).Output(); err == nil {
+			return "tmux " + strings.TrimSpace(string(out))
+		}
+		return strings.TrimSpace("tmux " + pane)
+	case os.Getenv("STY") != "":
+		if window := os.Getenv("WINDOW"); window != "" {
+			return "screen " + os.Getenv("STY") + ":" + window
+		}
+		return "screen " + os.Getenv("STY")
+	case os.Getenv("ZELLIJ") != "" || os.Getenv("ZELLIJ_SESSION_NAME") != "":
+		name := os.Getenv("ZELLIJ_SESSION_NAME")
+		if pane := os.Getenv("ZELLIJ_PANE_ID"); pane != "" {
+			name += ":" + pane
+		}
+		return strings.TrimSpace("zellij " + name)
+	}
+	return ""
+}
+
+// terminalRecorder records changes to the session's terminal: its window
+// being resized and, in PTY mode, the titles programs give it
+type terminalRecorder struct {
+	metaPath string
+
+	mu    sync.Mutex
+	size  string
+	title string
+
+	// The escape sequence being read from the shell's output
+	state   int
+	pending []byte
+}
+
+func newTerminalRecorder(metaPath string, start session.Terminal) *terminalRecorder {
+	return &terminalRecorder{metaPath: metaPath, size: start.Size()}
+}
+
+// resized records the window's new size, if it changed
+func (r *terminalRecorder) resized() {
+	size, err := pty.GetSize(os.Stdin)
+	if err != nil {
+		return
+	}
+	value := session.Terminal{Cols: int(size.Cols), Rows: int(size.Rows)}.Size()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if value == "" || value == r.size {
+		return
+	}
+	r.size = value
+	r.record(session.TerminalResized, value)
+}
+
+// States reading the shell's output for window title sequences
+const (
+	titleText = iota
+	titleEscape
+	titleOSC
+	titleOSCEscape
+)
+
+// Write reads the shell's output for OSC 0 and OSC 2 sequences, which set
+// the window title, recording each new title
+func (r *terminalRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range p {
+		switch r.state {
+		case titleText:
+			if c == 0x1b {
+				r.state = titleEscape
+			}
+		case titleEscape:
+			r.state = titleText
+			if c == ']' {
+				r.state = titleOSC
+				r.pending = r.pending[:0]
+			}
+		case titleOSC:
+			switch {
+			case c == 0x07:
+				r.endOSC()
+			case c == 0x1b:
+				r.state = titleOSCEscape
+			case len(r.pending) < maxTitle:
+				r.pending = append(r.pending, c)
+			}
+		case titleOSCEscape:
+			// ESC \ ends the sequence; any other escape abandons it
+			if c == '\\' {
+				r.endOSC()
+			} else {
+				r.state = titleText
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// endOSC handles a complete OSC sequence
+func (r *terminalRecorder) endOSC() {
+	r.state = titleText
+	param, title, ok := strings.Cut(string(r.pending), ";")
+	if !ok || param != "0" && param != "2" || title == r.title {
+		return
+	}
+	r.title = title
+	r.record(session.TerminalTitle, title)
+}
+
+func (r *terminalRecorder) record(kind, value string) {
+	err := session.RecordTerminal(r.metaPath, session.TerminalEvent{Time: time.Now(), Kind: kind, Value: value})
+	if err != nil {
+		slog.Warn("failed to record terminal change", "err", err)
+	}
+}
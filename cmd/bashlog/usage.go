@@ -0,0 +1,18 @@
+package main
+
+import "flag"
+
+// hiddenFlags are accepted but left out of the usage message
+var hiddenFlags = map[string]bool{"pprof": true, "escalated-from": true, "escalation": true, "drive": true}
+
+// printVisibleDefaults prints the defaults of all flags but the hidden ones
+func printVisibleDefaults() {
+	visible := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
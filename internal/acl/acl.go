@@ -0,0 +1,189 @@
+// Package acl decides who may do what with a workspace when it is served
+// by the API. A workspace's access control list names, for each role, the
+// principals holding it: API token names, people signed in to serve with
+// its OpenID Connect provider and the names their claims map to, or * for
+// everyone. Each is named with its kind, as token:ci, user:alice@example.com
+// or role:security, so a person can't take on a token's grants by sharing
+// its name; a name without a kind is a token's. A workspace without a list
+// is open to everyone, as before there were lists.
+package acl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Anyone is the principal every request holds
+const Anyone = "*"
+
+// The kinds of principal, which start their names
+const (
+	TokenKind = "token:"
+	UserKind  = "user:"
+	RoleKind  = "role:"
+)
+
+// Qualify returns the principal called who with its kind, taking a name
+// without one to be a token's
+func Qualify(who string) string {
+	if who == Anyone || strings.HasPrefix(who, TokenKind) || strings.HasPrefix(who, UserKind) || strings.HasPrefix(who, RoleKind) {
+		return who
+	}
+	return TokenKind + who
+}
+
+// keyPrefix starts the keys of a workspace's config file holding its list,
+// as acl.<role>=<principal>,<principal>
+const keyPrefix = "acl."
+
+// Role is a set of permissions on a workspace
+type Role string
+
+// Roles, in the order lists are shown
+const (
+	// Owner may do everything: read, record into, comment on and see who
+	// else has access to the workspace
+	Owner Role = "owners"
+	// Reader may read and comment on the workspace
+	Reader Role = "readers"
+	// Auditor may read the workspace and see who has access to it, but
+	// leaves it as it is, neither recording nor commenting
+	Auditor Role = "auditors"
+	// Appender may only record into the workspace, as recorders on the
+	// machines it logs do, and not read back what was recorded
+	Appender Role = "appenders"
+)
+
+// Roles lists the roles a list can grant
+var Roles = []Role{Owner, Reader, Auditor, Appender}
+
+// Permission is something a request can do with a workspace
+type Permission string
+
+// Permissions the API checks
+const (
+	Read    Permission = "read"
+	Append  Permission = "append"
+	Comment Permission = "comment"
+	// Inspect is seeing the workspace's list itself
+	Inspect Permission = "inspect"
+)
+
+// Permissions lists every permission, in the order they are shown
+var Permissions = []Permission{Read, Append, Comment, Inspect}
+
+var grants = map[Role][]Permission{
+	Owner:    {Read, Append, Comment, Inspect},
+	Reader:   {Read, Comment},
+	Auditor:  {Read, Inspect},
+	Appender: {Append},
+}
+
+// ParseRole returns the role called name, singular or plural
+func ParseRole(name string) (Role, error) {
+	for _, r := range Roles {
+		if name == string(r) || name+"s" == string(r) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q: want one of owners, readers, auditors or appenders", name)
+}
+
+// List is a workspace's access control list: the principals of each role
+type List map[Role][]string
+
+// Load returns the list of the workspace at wsPath, nil if it has none
+func Load(wsPath string) List {
+	var list List
+	for key, value := range workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile)) {
+		name, ok := strings.CutPrefix(key, keyPrefix)
+		if !ok {
+			continue
+		}
+		role, err := ParseRole(name)
+		if err != nil {
+			continue
+		}
+		if list == nil {
+			list = make(List)
+		}
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			if p = Qualify(p); !contains(list[role], p) {
+				list[role] = append(list[role], p)
+			}
+		}
+	}
+	return list
+}
+
+// Save records list for the workspace at wsPath, a role with no
+// principals left granting nothing but keeping the workspace listed
+func Save(wsPath string, list List) error {
+	configPath := filepath.Join(wsPath, workspace.ConfigFile)
+	for _, role := range Roles {
+		principals, ok := list[role]
+		if !ok {
+			continue
+		}
+		if err := workspace.SetConfigValue(configPath, keyPrefix+string(role), strings.Join(principals, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear removes the list of the workspace at wsPath, opening it to every
+// token again
+func Clear(wsPath string) error {
+	return workspace.DeleteConfigValues(filepath.Join(wsPath, workspace.ConfigFile), func(key string) bool {
+		return strings.HasPrefix(key, keyPrefix)
+	})
+}
+
+// Allows reports whether a request made as any of principals, named with
+// their kinds, may do p. A nil list allows everything
+func (l List) Allows(p Permission, principals ...string) bool {
+	if l == nil {
+		return true
+	}
+	for role, holders := range l {
+		if !contains(grants[role], p) {
+			continue
+		}
+		if contains(holders, Anyone) {
+			return true
+		}
+		for _, who := range principals {
+			if contains(holders, who) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Granted returns the permissions principals have, in Permissions order
+func (l List) Granted(principals ...string) []Permission {
+	var granted []Permission
+	for _, p := range Permissions {
+		if l.Allows(p, principals...) {
+			granted = append(granted, p)
+		}
+	}
+	return granted
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Package atuin converts between bashlog history and atuin's sqlite
+// history database.
+//
+// The database is accessed through the sqlite3 command-line tool so that
+// bashlog does not need a cgo sqlite driver.
+package atuin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/sqlite3"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// schema matches the history table created by atuin's migrations, so an
+// exported database can be dropped in place of ~/.local/share/atuin/history.db
+const schema = `CREATE TABLE IF NOT EXISTS history (
+	id text primary key,
+	timestamp integer not null,
+	duration integer not null,
+	exit integer not null,
+	command text not null,
+	cwd text not null,
+	session text not null,
+	hostname text not null,
+	deleted_at integer,
+	unique(timestamp, cwd, command)
+);
+`
+
+// DefaultPath returns the location of atuin's history database
+func DefaultPath() (string, error) {
+	if dataDir := os.Getenv("ATUIN_DATA_DIR"); dataDir != "" {
+		return dataDir + "/history.db", nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return homeDir + "/.local/share/atuin/history.db", nil
+}
+
+// Import reads all non-deleted commands from the atuin database at dbPath,
+// oldest first
+func Import(dbPath string) ([]workspace.Entry, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT timestamp, command FROM history WHERE deleted_at IS NULL ORDER BY timestamp"
+	out, err := sqlite3.Run(nil, "-readonly", "-json", dbPath, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Timestamp int64  `json:"timestamp"`
+		Command   string `json:"command"`
+	}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+
+	entries := make([]workspace.Entry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, workspace.Entry{
+			Command: row.Command,
+			Time:    time.Unix(0, row.Timestamp),
+		})
+	}
+	return entries, nil
+}
+
+// Export writes entries into the atuin database at dbPath, creating the
+// history table if needed, and returns the number of rows inserted.
+// Entries without a timestamp are placed just after the preceding entry,
+// or at fallback if none precedes them. Commands already present with the
+// same timestamp are skipped.
+func Export(dbPath string, entries []workspace.Entry, fallback time.Time) (int, error) {
+	session, err := newID()
+	if err != nil {
+		return 0, err
+	}
+	hostname := atuinHostname()
+
+	var script strings.Builder
+	script.WriteString(schema)
+	script.WriteString("BEGIN;\n")
+
+	last := fallback
+	for _, e := range entries {
+		ts := e.Time
+		if ts.IsZero() {
+			ts = last.Add(time.Nanosecond)
+		}
+		last = ts
+
+		id, err := newID()
+		if err != nil {
+			return 0, err
+		}
+
+		fmt.Fprintf(&script,
+			"INSERT OR IGNORE INTO history (id, timestamp, duration, exit, command, cwd, session, hostname) VALUES (%s, %d, -1, -1, %s, 'unknown', %s, %s);\n",
+			sqlite3.Quote(id), ts.UnixNano(), sqlite3.Quote(e.Command), sqlite3.Quote(session), sqlite3.Quote(hostname))
+	}
+
+	script.WriteString("COMMIT;\n")
+	script.WriteString("SELECT total_changes();\n")
+
+	out, err := sqlite3.Run(strings.NewReader(script.String()), dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	inserted, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	return inserted, nil
+}
+
+// atuinHostname returns the "hostname:username" pair atuin records
+func atuinHostname() string {
+	host, _ := os.Hostname()
+	name := ""
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return host + ":" + name
+}
+
+// newID returns a random 32 character hex id in the style atuin uses
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,138 @@
+// Package audit keeps the trail of bashlog-mgr operations: who viewed,
+// exported, deleted or restored which workspaces, and when. Records are
+// appended to a file only its owner can read, each chained to the one
+// before it by an unkeyed hash. That catches a record edited or removed in
+// the middle of the log, but not one dropped from its end, nor a tail
+// rewritten with its hashes recomputed by whoever can write the file.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Record is one operation
+type Record struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Host   string    `json:"host"`
+	Action string    `json:"action"`
+	Args   []string  `json:"args,omitempty"`
+
+	// Exit is the operation's exit status
+	Exit int `json:"exit"`
+
+	// Prev is the hash of the record before, "" for the first one, and
+	// Hash covers this record including Prev
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// sum hashes r without its own Hash
+func (r Record) sum() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Append chains r to the log at path and writes it, creating the log,
+// readable by its owner only, if needed
+func Append(path string, r Record) error {
+	if err := fsperm.Default.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := fsperm.Default.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// concurrent operations chain their records one after the other
+	if err := workspace.Flock(f, true); err != nil {
+		return err
+	}
+
+	last, err := lastHash(f)
+	if err != nil {
+		return err
+	}
+	r.Time = r.Time.UTC().Round(time.Millisecond)
+	r.Prev = last
+	r.Hash = r.sum()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// lastHash returns the hash of the last record in f
+func lastHash(f *os.File) (string, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return "", err
+	}
+	last := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			last = r.Hash
+		}
+	}
+	return last, scanner.Err()
+}
+
+// Read loads the log at path. A missing log has no records
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, fmt.Errorf("line %d: %w", n, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Verify checks the hash chain of records, as read from a log, and
+// returns an error naming the first record that was altered, or that
+// follows a removed one
+func Verify(records []Record) error {
+	prev := ""
+	for i, r := range records {
+		if r.Prev != prev {
+			return fmt.Errorf("record %d (%s %s): chain broken, a record before it was removed or altered", i+1, r.Time.Format(time.DateTime), r.Action)
+		}
+		if r.sum() != r.Hash {
+			return fmt.Errorf("record %d (%s %s): contents altered", i+1, r.Time.Format(time.DateTime), r.Action)
+		}
+		prev = r.Hash
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package category classifies recorded commands by what they work with,
+// from the programs the shell parser finds in each command line.
+package category
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// Category is a kind of command, such as git or networking
+type Category string
+
+const (
+	Git        Category = "git"
+	Containers Category = "containers"
+	Packages   Category = "package-management"
+	Networking Category = "networking"
+	FileOps    Category = "file-ops"
+	Editors    Category = "editors"
+	Other      Category = "other"
+)
+
+// All lists the categories in display order, Other last
+var All = []Category{Git, Containers, Packages, Networking, FileOps, Editors, Other}
+
+// programs maps program names to their category
+var programs = map[string]Category{}
+
+func init() {
+	add := func(c Category, names ...string) {
+		for _, n := range names {
+			programs[n] = c
+		}
+	}
+	add(Git, "git", "gh", "tig", "git-lfs", "lazygit", "hub")
+	add(Containers, "docker", "podman", "kubectl", "k9s", "helm", "docker-compose",
+		"minikube", "kind", "crictl", "nerdctl", "buildah", "skopeo", "oc", "k3s")
+	add(Packages, "apt", "apt-get", "apt-cache", "dpkg", "yum", "dnf", "rpm", "zypper",
+		"pacman", "yay", "apk", "brew", "port", "snap", "flatpak", "nix-env", "pip",
+		"pip3", "pipx", "poetry", "npm", "yarn", "pnpm", "gem", "bundle", "cargo", "composer")
+	add(Networking, "curl", "wget", "ssh", "scp", "sftp", "rsync", "ping", "traceroute",
+		"tracepath", "mtr", "dig", "nslookup", "host", "nc", "ncat", "netcat", "socat",
+		"telnet", "ftp", "ip", "ifconfig", "netstat", "ss", "nmap", "tcpdump", "iptables",
+		"nft", "ufw", "route", "arp", "whois", "http", "mosh")
+	add(FileOps, "ls", "cd", "cp", "mv", "rm", "mkdir", "rmdir", "touch", "ln", "chmod",
+		"chown", "chgrp", "find", "locate", "tar", "zip", "unzip", "gzip", "gunzip", "xz",
+		"cat", "less", "more", "head", "tail", "stat", "du", "df", "tree", "file", "pwd",
+		"dd", "shred", "truncate", "bat", "fd", "exa", "eza", "realpath", "basename", "dirname")
+	add(Editors, "vim", "vi", "nvim", "nano", "emacs", "emacsclient", "code", "subl",
+		"micro", "hx", "helix", "kak", "ed", "pico", "joe", "mcedit", "gedit", "kate")
+}
+
+// Parse returns the category named s, accepting unambiguous prefixes such
+// as "pkg" or "net"
+func Parse(s string) (Category, error) {
+	s = strings.ToLower(s)
+	aliases := map[string]Category{"pkg": Packages, "packages": Packages, "net": Networking,
+		"files": FileOps, "file": FileOps, "editor": Editors, "container": Containers}
+	if c, ok := aliases[s]; ok {
+		return c, nil
+	}
+
+	var found Category
+	for _, c := range All {
+		if string(c) == s {
+			return c, nil
+		}
+		if strings.HasPrefix(string(c), s) && s != "" {
+			if found != "" {
+				return "", fmt.Errorf("ambiguous category %q", s)
+			}
+			found = c
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("unknown category %q", s)
+	}
+	return found, nil
+}
+
+// Of returns the categories of the programs a command line runs, in the
+// order they first appear, or Other when none is known
+func Of(command string) []Category {
+	var cats []Category
+	seen := make(map[Category]bool)
+	for _, c := range shellparse.Parse(command) {
+		name, _, _ := c.Program()
+		cat, ok := programs[name]
+		if !ok || seen[cat] {
+			continue
+		}
+		seen[cat] = true
+		cats = append(cats, cat)
+	}
+	if len(cats) == 0 {
+		return []Category{Other}
+	}
+	return cats
+}
+
+// Primary returns the category of the first known program a command line
+// runs, which is what the command is counted under in breakdowns
+func Primary(command string) Category {
+	return Of(command)[0]
+}
+
+// Matches reports whether a command line runs anything in category c
+func Matches(command string, c Category) bool {
+	for _, cat := range Of(command) {
+		if cat == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package cron
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Job is a command run on a schedule into a workspace
+type Job struct {
+	ID        int
+	Workspace string
+	Schedule  *Schedule
+	Command   string
+}
+
+// String returns the job as a crontab line
+func (j Job) String() string {
+	return j.Schedule.String() + " " + j.Command
+}
+
+// ParseLine reads a crontab line, a schedule followed by its command, as
+// in "0 3 * * * backup.sh"
+func ParseLine(line string) (*Schedule, string, error) {
+	line = strings.TrimSpace(line)
+	n := len(fields)
+	if strings.HasPrefix(line, "@") {
+		n = 1
+	}
+	rest := line
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return nil, "", fmt.Errorf("%q has no command after its schedule, as in \"0 3 * * * backup.sh\"", line)
+		}
+		rest = rest[end:]
+	}
+	command := strings.TrimSpace(rest)
+	if command == "" || strings.ContainsAny(command, "\r\n") {
+		return nil, "", fmt.Errorf("%q needs a command on one line after its schedule", line)
+	}
+	// The table separates its fields with tabs
+	s, err := Parse(strings.Join(strings.Fields(line[:len(line)-len(rest)]), " "))
+	if err != nil {
+		return nil, "", err
+	}
+	return s, command, nil
+}
+
+// Load reads the jobs kept at path, one a line as id, workspace, schedule
+// and command separated by tabs. A table that doesn't exist has no jobs
+func Load(path string) ([]Job, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var jobs []Job
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		parts := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("%s:%d: expected id, workspace, schedule and command", path, n)
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("%s:%d: invalid job id %q", path, n, parts[0])
+		}
+		s, err := Parse(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		jobs = append(jobs, Job{ID: id, Workspace: parts[1], Schedule: s, Command: parts[3]})
+	}
+	return jobs, scanner.Err()
+}
+
+// Save replaces the jobs kept at path in one step
+func Save(path string, jobs []Job) error {
+	var b strings.Builder
+	for _, j := range jobs {
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%s\n", j.ID, j.Workspace, j.Schedule, j.Command)
+	}
+	if err := fsperm.Private.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := fsperm.Private.WriteFile(tmp, []byte(b.String())); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// NextID returns the ID for a job added to jobs, one past the highest
+func NextID(jobs []Job) int {
+	id := 1
+	for _, j := range jobs {
+		id = max(id, j.ID+1)
+	}
+	return id
+}
@@ -0,0 +1,136 @@
+package drive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/transcript"
+)
+
+// Driver plays a script into a session: it is written what the session
+// prints, and Run types the script's input once that output matches
+type Driver struct {
+	script *Script
+
+	mu sync.Mutex
+	// raw is what the session printed since the last match, and pending
+	// the plain text left over after it
+	raw     []byte
+	pending string
+	// echo is the last line typed, which the terminal shows again before
+	// what the line makes the session print
+	echo string
+	// more is signalled when output is written
+	more chan struct{}
+}
+
+// New returns a driver for script
+func New(script *Script) *Driver {
+	return &Driver{script: script, more: make(chan struct{}, 1)}
+}
+
+// Write takes output of the session
+func (d *Driver) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	d.raw = append(d.raw, p...)
+	d.mu.Unlock()
+	select {
+	case d.more <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Run plays the script, typing its input into input, and returns why it
+// stopped short, if it did
+func (d *Driver) Run(input io.Writer) error {
+	for _, st := range d.script.Steps {
+		if st.Sleep > 0 {
+			time.Sleep(st.Sleep)
+		}
+		if st.Expect != nil {
+			timeout := st.Timeout
+			if timeout == 0 {
+				timeout = d.script.Timeout
+			}
+			if !d.expect(st, timeout) {
+				return fmt.Errorf("%s:%d: timed out after %s waiting for /%s/", d.script.Name, st.Line, timeout, st.Pattern)
+			}
+		}
+		if st.HasSend {
+			if _, err := io.WriteString(input, st.Send); err != nil {
+				return fmt.Errorf("%s:%d: %w", d.script.Name, st.Line, err)
+			}
+			d.mu.Lock()
+			d.echo = lastLine(st.Send)
+			d.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// expect waits up to timeout for the output to match the step's pattern,
+// taking the output up to the end of the match as seen. The echo of what
+// was last typed is passed over, so a pattern isn't matched by the command
+// line that should make it appear
+func (d *Driver) expect(st Step, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		d.mu.Lock()
+		text := d.pending + transcript.Clean(d.raw)
+		if d.echo != "" {
+			if i := strings.Index(text, d.echo); i >= 0 {
+				text, d.echo = text[i+len(d.echo):], ""
+				d.pending, d.raw = text, nil
+			}
+		}
+		if loc := st.Expect.FindStringIndex(text); loc != nil {
+			d.pending, d.raw = text[loc[1]:], nil
+			d.mu.Unlock()
+			return true
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-d.more:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// lastLine returns the last line of what was typed, without its Enter
+func lastLine(typed string) string {
+	typed = strings.TrimRight(typed, "\r\n")
+	if i := strings.LastIndexAny(typed, "\r\n"); i >= 0 {
+		typed = typed[i+1:]
+	}
+	return strings.TrimSpace(typed)
+}
+
+// Quiet waits until the session has printed nothing for wait, as a shell
+// has once it is back at its prompt and reading input, or for the script's
+// timeout at most
+func (d *Driver) Quiet(wait time.Duration) {
+	deadline := time.NewTimer(d.script.Timeout)
+	defer deadline.Stop()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-d.more:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			return
+		case <-deadline.C:
+			return
+		}
+	}
+}
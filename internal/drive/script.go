@@ -0,0 +1,251 @@
+// Package drive plays scripted input into a terminal session, waiting for
+// what the session prints before each input the way expect does, so an
+// interactive procedure can be run again, and recorded, unattended.
+//
+// Scripts are written in a small subset of YAML:
+//
+//	# Log in and look around
+//	timeout: 10s
+//	steps:
+//	  - expect: '[$#]$'
+//	  - sendline: ssh web-1
+//	  - expect: "password:"
+//	    timeout: 30s
+//	  - send: "hunter2\r"
+//	  - sleep: 2s
+//	  - sendline: exit
+//
+// A step waits for sleep, then for the output to match the expect regular
+// expression, then types send as it is or sendline followed by Enter. The
+// output is matched as plain text, with escape sequences and the spaces
+// ending lines removed, and ^ and $ match where its lines begin and end;
+// the terminal's echo of the line last typed is passed over, so it is what
+// the line prints that matches. Each expect gives up after the step's
+// timeout or else the script's, 30 seconds when neither is set.
+package drive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long an expect waits when the script doesn't say
+const DefaultTimeout = 30 * time.Second
+
+// Step is one thing a script does
+type Step struct {
+	// Line is where the step starts in the script, for errors to point at
+	Line int
+
+	Sleep time.Duration
+	// Pattern is Expect as the script wrote it
+	Pattern string
+	Expect  *regexp.Regexp
+	Timeout time.Duration
+	// Send is typed as it is, with sendline's Enter already added
+	Send    string
+	HasSend bool
+}
+
+// Script is a parsed script
+type Script struct {
+	// Name is where the script was loaded from
+	Name    string
+	Timeout time.Duration
+	Steps   []Step
+}
+
+// Load reads the script at path
+func Load(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	s.Name = path
+	return s, nil
+}
+
+// Parse reads a script. Errors start with the line they are on, as "3: ..."
+func Parse(r io.Reader) (*Script, error) {
+	s := &Script{Timeout: DefaultTimeout}
+	var step *Step
+	inSteps := false
+	itemIndent := -1
+
+	finish := func() error {
+		if step == nil {
+			return nil
+		}
+		if step.Expect == nil && !step.HasSend && step.Sleep == 0 {
+			return fmt.Errorf("%d: step has none of expect, send, sendline or sleep", step.Line)
+		}
+		s.Steps = append(s.Steps, *step)
+		step = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		raw := stripComment(scanner.Text())
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		line := strings.TrimSpace(raw)
+
+		if indent == 0 {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			key, value, err := splitKey(line, n)
+			if err != nil {
+				return nil, err
+			}
+			inSteps = false
+			switch key {
+			case "timeout":
+				if s.Timeout, err = parseDuration(value, n); err != nil {
+					return nil, err
+				}
+			case "steps":
+				if value != "" {
+					return nil, fmt.Errorf("%d: steps is a list of steps, one \"- \" item each", n)
+				}
+				inSteps = true
+			default:
+				return nil, fmt.Errorf("%d: unknown setting %q (want timeout or steps)", n, key)
+			}
+			continue
+		}
+		if !inSteps {
+			return nil, fmt.Errorf("%d: unexpected indented line", n)
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			step = &Step{Line: n}
+			itemIndent = indent
+			line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+			if line == "" {
+				continue
+			}
+		} else if step == nil || indent <= itemIndent {
+			return nil, fmt.Errorf("%d: expected a \"- \" step", n)
+		}
+		key, value, err := splitKey(line, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := step.set(key, value, n); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("1: script has no steps")
+	}
+	return s, nil
+}
+
+// set sets the key of a step to the scalar value
+func (st *Step) set(key, value string, n int) error {
+	text, err := parseScalar(value, n)
+	if err != nil {
+		return err
+	}
+	switch key {
+	case "expect":
+		st.Pattern = text
+		if st.Expect, err = regexp.Compile("(?m)" + text); err != nil {
+			return fmt.Errorf("%d: invalid expect pattern: %v", n, err)
+		}
+	case "send", "sendline":
+		if st.HasSend {
+			return fmt.Errorf("%d: step sends twice", n)
+		}
+		st.Send, st.HasSend = text, true
+		if key == "sendline" {
+			st.Send += "\r"
+		}
+	case "timeout":
+		st.Timeout, err = parseDuration(value, n)
+	case "sleep":
+		st.Sleep, err = parseDuration(value, n)
+	default:
+		return fmt.Errorf("%d: unknown step key %q (want expect, send, sendline, timeout or sleep)", n, key)
+	}
+	return err
+}
+
+// splitKey splits "key: value"
+func splitKey(line string, n int) (string, string, error) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(key, `"' `) {
+		return "", "", fmt.Errorf("%d: expected key: value", n)
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// parseScalar reads a plain, 'single-quoted' or "double-quoted" value, the
+// last with the escapes of Go strings and YAML's \e for Escape
+func parseScalar(value string, n int) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(strings.ReplaceAll(value, `\e`, `\x1b`))
+		if err != nil {
+			return "", fmt.Errorf("%d: invalid double-quoted value %s", n, value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("%d: unterminated single-quoted value %s", n, value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+func parseDuration(value string, n int) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%d: invalid duration %q, e.g. 500ms or 10s", n, value)
+	}
+	return d, nil
+}
+
+// stripComment drops a # comment from line, unless the # is quoted or
+// not after a space
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote && !(quote == '"' && i > 0 && line[i-1] == '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
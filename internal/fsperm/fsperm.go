@@ -0,0 +1,164 @@
+// Package fsperm decides the permissions bashlog's logs and workspaces are
+// created with: private to their owner by default, or shared with a group
+// for team workspaces. Both binaries create what they write through it,
+// so they agree on who can read it.
+package fsperm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Mode is the permissions of the directories and files of one kind of
+// data
+type Mode struct {
+	Dir  os.FileMode
+	File os.FileMode
+}
+
+var (
+	// Private keeps everything to its owner
+	Private = Mode{Dir: 0700, File: 0600}
+	// Group shares everything with the group of the directory it is in,
+	// read and write. Directories are setgid, so what is created in them
+	// keeps the team's group whoever creates it
+	Group = Mode{Dir: 0770 | os.ModeSetgid, File: 0660}
+)
+
+// Setting is the key of ~/.bashlog/config.txt setting Default, and of a
+// workspace's config file setting its own mode
+const Setting = "files.mode"
+
+// Default is the mode of everything but workspaces with a mode of their
+// own: the session logs, settings, spools, exports and the like
+var Default = Private
+
+// Configure sets Default from settings, leaving it Private unless they
+// set Setting
+func Configure(settings map[string]string) error {
+	value, ok := settings[Setting]
+	if !ok {
+		return nil
+	}
+	m, err := Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", Setting, err)
+	}
+	Default = m
+	return nil
+}
+
+// Parse reads a mode as "private", "group", or the octal mode of files,
+// such as 0640, whose directories are searchable wherever the files are
+// readable
+func Parse(s string) (Mode, error) {
+	switch s {
+	case "private":
+		return Private, nil
+	case "group":
+		return Group, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return Mode{}, fmt.Errorf("invalid mode %q: want private, group or an octal file mode such as 0640", s)
+	}
+	file := os.FileMode(n)
+	if file&0600 != 0600 {
+		return Mode{}, fmt.Errorf("invalid mode %q: the owner must be able to read and write", s)
+	}
+	return Mode{Dir: file | (file&0444)>>2, File: file}, nil
+}
+
+// String is the mode as Parse reads it
+func (m Mode) String() string {
+	switch m {
+	case Private:
+		return "private"
+	case Group:
+		return "group"
+	}
+	return fmt.Sprintf("%04o", uint32(m.File))
+}
+
+// Describe gives the permissions in octal, as chmod takes them
+func (m Mode) Describe() string {
+	dir := uint32(m.Dir.Perm())
+	if m.Dir&os.ModeSetgid != 0 {
+		dir |= 02000
+	}
+	return fmt.Sprintf("directories %04o, files %04o", dir, uint32(m.File.Perm()))
+}
+
+// MkdirAll creates path and any parents it lacks, giving each directory
+// it creates the mode's permissions whatever the umask
+func (m Mode) MkdirAll(path string) error {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if err := os.MkdirAll(path, m.Dir.Perm()); err != nil {
+		return err
+	}
+	for _, dir := range missing {
+		if err := os.Chmod(dir, m.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenFile is os.OpenFile, giving a file it creates the mode's permissions
+// whatever the umask
+func (m Mode) OpenFile(path string, flag int) (*os.File, error) {
+	_, statErr := os.Lstat(path)
+	f, err := os.OpenFile(path, flag, m.File)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 && os.IsNotExist(statErr) {
+		if err := f.Chmod(m.File); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// WriteFile is os.WriteFile, giving a file it creates the mode's
+// permissions whatever the umask
+func (m Mode) WriteFile(path string, data []byte) error {
+	f, err := m.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Apply gives path, and everything under it when it is a directory, the
+// mode's permissions, for changing the mode of what already exists
+func (m Mode) Apply(path string) error {
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			return os.Chmod(p, m.Dir)
+		case info.Mode().IsRegular():
+			return os.Chmod(p, m.File)
+		}
+		return nil
+	})
+}
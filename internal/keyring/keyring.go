@@ -0,0 +1,174 @@
+// Package keyring keeps the encryption keys of workspaces, one each, so a
+// key exported to restore one workspace's backup, or leaked, exposes that
+// workspace alone. Keys are 256-bit AES keys kept in a directory, a file
+// each, named by ID; a workspace's config refers to its key by that ID. What
+// a key seals is AES-GCM after a header naming the key, so it can be
+// opened with the key alone, whichever workspace it ends up in.
+package keyring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// keySize is the length of keys, for AES-256
+const keySize = 32
+
+// keyExtension ends the names of key files
+const keyExtension = ".key"
+
+// sealedMagic starts the header of sealed data, "bashlog-sealed 1 <id>\n"
+const sealedMagic = "bashlog-sealed 1 "
+
+// exportMagic starts an exported key, "bashlog-key <id> <hex>\n"
+const exportMagic = "bashlog-key "
+
+// ErrNoKey is returned for a key the keyring doesn't have
+var ErrNoKey = errors.New("no such key")
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// New generates a key in dir, returning its ID
+func New(dir string) (string, error) {
+	raw := make([]byte, 8+keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw[:8])
+	return id, write(dir, id, raw[8:])
+}
+
+// write stores key as id in dir. Keys stay private to their owner whatever
+// files.mode says, as they unlock what a team's mode shares
+func write(dir, id string, key []byte) error {
+	if err := fsperm.Private.MkdirAll(dir); err != nil {
+		return err
+	}
+	f, err := fsperm.Private.OpenFile(filepath.Join(dir, id+keyExtension), os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the key id from dir
+func Load(dir, id string) ([]byte, error) {
+	if !idPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid key ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+keyExtension))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w %s", ErrNoKey, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("key %s is corrupt", id)
+	}
+	return key, nil
+}
+
+// Export returns the key id from dir in the form Import reads
+func Export(dir, id string) (string, error) {
+	key, err := Load(dir, id)
+	if err != nil {
+		return "", err
+	}
+	return exportMagic + id + " " + hex.EncodeToString(key) + "\n", nil
+}
+
+// Import adds a key Export returned to dir, returning its ID. A key the
+// keyring has already is left as it is
+func Import(dir, exported string) (string, error) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(exported), strings.TrimSpace(exportMagic)))
+	if !strings.HasPrefix(exported, exportMagic) || len(fields) != 2 || !idPattern.MatchString(fields[0]) {
+		return "", errors.New("not an exported bashlog key")
+	}
+	key, err := hex.DecodeString(fields[1])
+	if err != nil || len(key) != keySize {
+		return "", errors.New("not an exported bashlog key")
+	}
+	id := fields[0]
+	if have, err := Load(dir, id); err == nil {
+		if !bytes.Equal(have, key) {
+			return "", fmt.Errorf("a different key %s is in the keyring already", id)
+		}
+		return id, nil
+	}
+	return id, write(dir, id, key)
+}
+
+// IsSealed reports whether data was sealed by Seal
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealedMagic))
+}
+
+// Seal encrypts data with the key id from dir
+func Seal(dir, id string, data []byte) ([]byte, error) {
+	aead, err := open(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	header := []byte(sealedMagic + id + "\n")
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(append(header, nonce...), aead.Seal(nil, nonce, data, header)...)
+	return sealed, nil
+}
+
+// Open decrypts data Seal sealed, with the key its header names, from dir.
+// It returns the key's ID too, for errors to name it
+func Open(dir string, sealed []byte) ([]byte, string, error) {
+	if !IsSealed(sealed) {
+		return nil, "", errors.New("not sealed")
+	}
+	end := bytes.IndexByte(sealed, '\n')
+	if end < 0 {
+		return nil, "", errors.New("sealed data is corrupt")
+	}
+	header, rest := sealed[:end+1], sealed[end+1:]
+	id := string(header[len(sealedMagic):end])
+	aead, err := open(dir, id)
+	if err != nil {
+		return nil, id, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, id, errors.New("sealed data is corrupt")
+	}
+	data, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, id, fmt.Errorf("sealed data is corrupt or was sealed with another key %s", id)
+	}
+	return data, id, nil
+}
+
+func open(dir, id string) (cipher.AEAD, error) {
+	key, err := Load(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
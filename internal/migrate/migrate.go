@@ -0,0 +1,131 @@
+// Package migrate keeps the on-disk layout of workspaces versioned, so a
+// bashlog that changes what a workspace directory holds can bring old
+// workspaces along rather than misreading them.
+//
+// A workspace records the layout it is at in its config file. Workspaces
+// that don't were created before there were versions, at layout 0. The
+// store a backend keeps commands in is versioned apart, by
+// storage.Migrator.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// LayoutKey is the key of a workspace's config file recording its layout
+const LayoutKey = workspace.LayoutKey
+
+// ErrTooNew is returned for a workspace at a layout newer than Latest,
+// written by a newer bashlog
+var ErrTooNew = errors.New("workspace layout is newer than this bashlog knows")
+
+// Step brings a workspace from the layout before it to Version
+type Step struct {
+	Version int
+	// Summary says what the step changes, for migrate status
+	Summary string
+	// Apply changes the workspace at wsPath, already locked. It is applied
+	// once, but should leave a workspace it finds done alone
+	Apply func(wsPath string) error
+}
+
+// Steps are applied in order, and only ever added to
+var Steps = []Step{
+	{
+		Version: 1,
+		Summary: "record the storage backend in config.txt",
+		Apply: func(wsPath string) error {
+			configPath := filepath.Join(wsPath, workspace.ConfigFile)
+			if _, ok := workspace.ReadConfig(configPath)[storage.Setting]; ok {
+				return nil
+			}
+			// Workspaces from before there was a choice keep their
+			// commands in history.log, whatever the storage setting says
+			// now
+			return workspace.SetConfigValue(configPath, storage.Setting, storage.Files)
+		},
+	},
+	{
+		Version: workspace.LayoutRecordsV2,
+		Summary: "record exit status and duration in history.log (v2 records)",
+		Apply: func(wsPath string) error {
+			// Records already written stay v1, which v2 readers read
+			// alongside the new ones
+			return nil
+		},
+	},
+}
+
+// Latest is the layout workspaces are created at
+func Latest() int {
+	return Steps[len(Steps)-1].Version
+}
+
+// Version returns the layout the workspace at wsPath is at
+func Version(wsPath string) (int, error) {
+	value, ok := workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))[LayoutKey]
+	if !ok {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s: invalid layout %q", workspace.ConfigFile, value)
+	}
+	return v, nil
+}
+
+// Pending returns the steps the workspace at wsPath hasn't had yet
+func Pending(wsPath string) ([]Step, error) {
+	current, err := Version(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	if current > Latest() {
+		return nil, fmt.Errorf("%w: layout %d, latest %d", ErrTooNew, current, Latest())
+	}
+	var pending []Step
+	for _, step := range Steps {
+		if step.Version > current {
+			pending = append(pending, step)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending steps to the workspace at wsPath under its lock,
+// recording the layout after each, then migrates its storage schema. It
+// returns the steps applied
+func Up(wsPath string) ([]Step, error) {
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	pending, err := Pending(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(wsPath, workspace.ConfigFile)
+	for i, step := range pending {
+		if err := step.Apply(wsPath); err != nil {
+			return pending[:i], fmt.Errorf("layout %d: %w", step.Version, err)
+		}
+		if err := workspace.SetConfigValue(configPath, LayoutKey, strconv.Itoa(step.Version)); err != nil {
+			return pending[:i], err
+		}
+	}
+
+	if m, ok := storage.For(wsPath).(storage.Migrator); ok {
+		if err := m.MigrateSchema(wsPath); err != nil {
+			return pending, fmt.Errorf("%s schema: %w", storage.For(wsPath).Name(), err)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,149 @@
+// Package notebook writes recorded commands and their output as a
+// notebook, either Markdown or Jupyter's .ipynb format, with each command
+// and its output in cells of their own.
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/transcript"
+)
+
+// Notebook is a titled list of sections, one per recorded session
+type Notebook struct {
+	Title    string
+	Sections []Section
+}
+
+// Section is a run of commands under a heading
+type Section struct {
+	Heading string
+	// Note is shown under the heading, e.g. that no output was recorded
+	Note  string
+	Cells []transcript.Cell
+}
+
+// WriteMarkdown writes the notebook as Markdown, commands in bash code
+// blocks each followed by their output in a plain one
+func WriteMarkdown(w io.Writer, nb Notebook) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", nb.Title)
+	for _, s := range nb.Sections {
+		fmt.Fprintf(&b, "\n## %s\n", s.Heading)
+		if s.Note != "" {
+			fmt.Fprintf(&b, "\n%s\n", s.Note)
+		}
+		for _, c := range s.Cells {
+			b.WriteString("\n")
+			if !c.Time.IsZero() {
+				fmt.Fprintf(&b, "<sub>%s</sub>\n\n", c.Time.Format(time.DateTime))
+			}
+			writeFence(&b, "bash", c.Command)
+			if c.Output != "" {
+				b.WriteString("\n")
+				writeFence(&b, "text", c.Output)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeFence writes a fenced code block, with a fence longer than any run
+// of backticks in text
+func writeFence(b *strings.Builder, lang, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, lang, text, fence)
+}
+
+// ipynb follows nbformat 4
+type ipynb struct {
+	Cells         []ipynbCell    `json:"cells"`
+	Metadata      map[string]any `json:"metadata"`
+	NBFormat      int            `json:"nbformat"`
+	NBFormatMinor int            `json:"nbformat_minor"`
+}
+
+type ipynbCell struct {
+	CellType       string         `json:"cell_type"`
+	ExecutionCount *int           `json:"execution_count,omitempty"`
+	Metadata       map[string]any `json:"metadata"`
+	Source         []string       `json:"source"`
+	Outputs        *[]ipynbOutput `json:"outputs,omitempty"`
+}
+
+type ipynbOutput struct {
+	OutputType string   `json:"output_type"`
+	Name       string   `json:"name"`
+	Text       []string `json:"text"`
+}
+
+// WriteJupyter writes the notebook in Jupyter's format for a bash kernel,
+// with section headings as Markdown cells and each command as a code cell
+// carrying its output
+func WriteJupyter(w io.Writer, nb Notebook) error {
+	doc := ipynb{
+		Metadata: map[string]any{
+			"kernelspec":    map[string]string{"name": "bash", "display_name": "Bash", "language": "bash"},
+			"language_info": map[string]string{"name": "bash"},
+		},
+		NBFormat:      4,
+		NBFormatMinor: 5,
+		Cells:         []ipynbCell{markdownCell("# " + nb.Title)},
+	}
+
+	count := 0
+	for _, s := range nb.Sections {
+		heading := "## " + s.Heading
+		if s.Note != "" {
+			heading += "\n\n" + s.Note
+		}
+		doc.Cells = append(doc.Cells, markdownCell(heading))
+
+		for _, c := range s.Cells {
+			count++
+			n := count
+			outputs := []ipynbOutput{}
+			if c.Output != "" {
+				outputs = append(outputs, ipynbOutput{OutputType: "stream", Name: "stdout", Text: sourceLines(c.Output)})
+			}
+			meta := map[string]any{}
+			if !c.Time.IsZero() {
+				meta["bashlog"] = map[string]string{"time": c.Time.Format(time.RFC3339)}
+			}
+			doc.Cells = append(doc.Cells, ipynbCell{
+				CellType:       "code",
+				ExecutionCount: &n,
+				Metadata:       meta,
+				Source:         sourceLines(c.Command),
+				Outputs:        &outputs,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	return enc.Encode(doc)
+}
+
+func markdownCell(text string) ipynbCell {
+	return ipynbCell{CellType: "markdown", Metadata: map[string]any{}, Source: sourceLines(text)}
+}
+
+// sourceLines splits text the way notebooks store it: lines keeping their
+// newline, except the last
+func sourceLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,40 @@
+package notify
+
+import "context"
+
+// Discord posts to a Discord channel webhook
+type Discord struct {
+	WebhookURL string
+}
+
+func (d *Discord) String() string { return "discord" }
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+// discordDescriptionLimit is the longest embed description Discord accepts
+const discordDescriptionLimit = 4096
+
+// Send posts m as a single embed
+func (d *Discord) Send(ctx context.Context, m Message) error {
+	embed := discordEmbed{Title: m.Title, Description: m.Text}
+	if r := []rune(embed.Description); len(r) > discordDescriptionLimit {
+		embed.Description = string(r[:discordDescriptionLimit-1]) + "…"
+	}
+	for _, f := range m.fields() {
+		embed.Fields = append(embed.Fields, discordField{f.Name, f.Value, f.Name != "Command"})
+	}
+
+	return postJSON(ctx, d.WebhookURL, map[string]any{
+		"embeds": []discordEmbed{embed},
+	})
+}
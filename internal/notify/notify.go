@@ -0,0 +1,133 @@
+// Package notify posts bashlog notifications, such as rule matches and
+// digests, to chat webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a notification. Workspace, Host and Command are shown as
+// labelled fields when set; Fields adds any others.
+type Message struct {
+	Title     string
+	Text      string
+	Workspace string
+	Host      string
+	Command   string
+	Fields    []Field
+}
+
+// Field is a labelled value shown alongside a message
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Sink delivers messages to one destination
+type Sink interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// fields returns the message's fields, standard ones first
+func (m Message) fields() []Field {
+	var fields []Field
+	if m.Workspace != "" {
+		fields = append(fields, Field{"Workspace", m.Workspace})
+	}
+	if m.Host != "" {
+		fields = append(fields, Field{"Host", m.Host})
+	}
+	if m.Command != "" {
+		fields = append(fields, Field{"Command", "`" + m.Command + "`"})
+	}
+	return append(fields, m.Fields...)
+}
+
+// Targets reads notification targets from config values of the form
+// notify.<name>.type=slack|discord and notify.<name>.url=<webhook>
+func Targets(config map[string]string) (map[string]Sink, error) {
+	types := make(map[string]string)
+	urls := make(map[string]string)
+	for key, value := range config {
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[0] != "notify" {
+			continue
+		}
+		switch parts[2] {
+		case "type":
+			types[parts[1]] = value
+		case "url":
+			urls[parts[1]] = value
+		default:
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sinks := make(map[string]Sink)
+	for _, name := range names {
+		url := urls[name]
+		if url == "" {
+			return nil, fmt.Errorf("notify.%s.url is not set", name)
+		}
+		switch types[name] {
+		case "slack":
+			sinks[name] = &Slack{WebhookURL: url}
+		case "discord":
+			sinks[name] = &Discord{WebhookURL: url}
+		default:
+			return nil, fmt.Errorf("notify.%s.type: unknown type %q (want slack or discord)", name, types[name])
+		}
+	}
+	for name := range urls {
+		if _, ok := types[name]; !ok {
+			return nil, fmt.Errorf("notify.%s.type is not set", name)
+		}
+	}
+	return sinks, nil
+}
+
+// client is used for all webhook requests
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts payload to url and fails on any non-2xx response
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if msg := strings.TrimSpace(string(detail)); msg != "" {
+			return fmt.Errorf("webhook returned %s: %s", resp.Status, msg)
+		}
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
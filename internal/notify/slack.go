@@ -0,0 +1,45 @@
+package notify
+
+import "context"
+
+// Slack posts to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+}
+
+func (s *Slack) String() string { return "slack" }
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+// Send posts m as a header, its text, and a section of fields
+func (s *Slack) Send(ctx context.Context, m Message) error {
+	blocks := []slackBlock{{Type: "header", Text: &slackText{"plain_text", m.Title}}}
+	if m.Text != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{"mrkdwn", m.Text}})
+	}
+
+	var fields []slackText
+	for _, f := range m.fields() {
+		fields = append(fields, slackText{"mrkdwn", "*" + f.Name + "*\n" + f.Value})
+	}
+	// Slack allows at most 10 fields per section
+	for len(fields) > 0 {
+		n := min(len(fields), 10)
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields[:n]})
+		fields = fields[n:]
+	}
+
+	return postJSON(ctx, s.WebhookURL, map[string]any{
+		"text":   m.Title,
+		"blocks": blocks,
+	})
+}
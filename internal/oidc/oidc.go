@@ -0,0 +1,216 @@
+// Package oidc signs people in with an OpenID Connect provider, such as
+// Okta, Google or Keycloak, for serve: it sends browsers through the
+// provider's authorization code flow and verifies the ID tokens it issues,
+// whether they come back from that flow or are presented to the API as
+// bearer tokens by scripts.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout bounds each request to the provider
+const Timeout = 10 * time.Second
+
+// keyRefreshEvery is the most often the provider's keys are fetched again
+// for a token signed with a key not seen before, so forged key IDs can't
+// have serve hammer the provider
+const keyRefreshEvery = time.Minute
+
+// Provider is an OpenID Connect provider and the client registered with it
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+
+	http *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	keysFetch time.Time
+}
+
+// Discover reads the configuration the provider at issuer publishes
+func Discover(ctx context.Context, issuer, clientID, clientSecret string, scopes []string) (*Provider, error) {
+	p := &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		http:         &http.Client{Timeout: Timeout},
+	}
+	var config struct {
+		Issuer        string `json:"issuer"`
+		Authorization string `json:"authorization_endpoint"`
+		Token         string `json:"token_endpoint"`
+		JWKS          string `json:"jwks_uri"`
+	}
+	if err := p.get(ctx, p.Issuer+"/.well-known/openid-configuration", &config); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(config.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery: provider says its issuer is %q, not %q", config.Issuer, p.Issuer)
+	}
+	if config.Authorization == "" || config.Token == "" || config.JWKS == "" {
+		return nil, errors.New("discovery: provider configuration lacks endpoints")
+	}
+	// Keep the issuer as the provider writes it, which tokens must match
+	p.Issuer = config.Issuer
+	p.authEndpoint, p.tokenEndpoint, p.jwksURI = config.Authorization, config.Token, config.JWKS
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Login is an authorization request in progress: what the browser is sent
+// with to the provider, and what its answer is checked against
+type Login struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewLogin starts an authorization request
+func NewLogin() Login {
+	return Login{State: Random(), Nonce: Random(), Verifier: Random()}
+}
+
+// AuthURL is where the browser signs in with l, to be sent back to
+// redirectURL with a code
+func (p *Provider) AuthURL(l Login, redirectURL string) string {
+	challenge := sha256.Sum256([]byte(l.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {l.State},
+		"nonce":                 {l.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + q.Encode()
+}
+
+// Exchange trades the code the provider sent the browser back with for its
+// ID token, and verifies it
+func (p *Provider) Exchange(ctx context.Context, l Login, code, redirectURL string) (Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {l.Verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("token exchange: %s: %s", tokens.Error, tokens.Description)
+		}
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token exchange: no ID token returned")
+	}
+	claims, err := p.Verify(ctx, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != l.Nonce {
+		return nil, errors.New("ID token is for another login")
+	}
+	return claims, nil
+}
+
+// refreshKeys fetches the keys the provider signs tokens with
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set jwks
+	if err := p.get(ctx, p.jwksURI, &set); err != nil {
+		return fmt.Errorf("fetching keys: %w", err)
+	}
+	keys, err := set.parse()
+	if err != nil {
+		return fmt.Errorf("fetching keys: %w", err)
+	}
+	p.mu.Lock()
+	p.keys, p.keysFetch = keys, time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Provider) get(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, v)
+}
+
+// do sends req and decodes its JSON answer into v, even when it is an
+// error, so error fields can be read from it
+func (p *Provider) do(req *http.Request, v any) error {
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		json.Unmarshal(body, v)
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s returned invalid JSON: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// Random returns 32 random bytes encoded for URLs, for states, nonces and
+// session IDs
+func Random() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,29 @@
+// Package pbkdf2 derives keys from passwords with PBKDF2-HMAC-SHA256, as
+// RFC 8018 defines it, for the passphrase hashes of protect and the Hi
+// function of SCRAM.
+package pbkdf2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Key derives a single SHA-256 sized block from password and salt, which
+// is all either use needs
+func Key(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := mac.Sum(nil)
+	out := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
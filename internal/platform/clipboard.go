@@ -0,0 +1,42 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// clipboardTool is a tool that reads the clipboard contents from stdin
+type clipboardTool struct {
+	tool
+	args []string
+}
+
+var clipboardTools = []clipboardTool{
+	{tool{"pbcopy", isDarwin}, nil},
+	{tool{"wl-copy", func() bool { return os.Getenv("WAYLAND_DISPLAY") != "" }}, nil},
+	{tool{"xclip", func() bool { return os.Getenv("DISPLAY") != "" }}, []string{"-selection", "clipboard"}},
+	{tool{"xsel", func() bool { return os.Getenv("DISPLAY") != "" }}, []string{"--clipboard", "--input"}},
+	{tool{"clip.exe", func() bool { return isWindows() || isWSL() }}, nil},
+}
+
+// Copy puts text on the clipboard with the first tool available, returning
+// its name
+func Copy(text string) (string, error) {
+	if remote() {
+		return "", ErrUnsupported
+	}
+	for _, t := range clipboardTools {
+		if !t.available() {
+			continue
+		}
+		cmd := exec.Command(t.name, t.args...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%s: %w", t.name, err)
+		}
+		return t.name, nil
+	}
+	return "", ErrUnsupported
+}
@@ -0,0 +1,77 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// notifyTool is a tool that shows a desktop notification, given its
+// arguments for the title and body
+type notifyTool struct {
+	tool
+	args func(title, body string) []string
+}
+
+var notifyTools = []notifyTool{
+	{tool{"osascript", isDarwin}, func(title, body string) []string {
+		return []string{"-e", "display notification " + appleScriptString(body) + " with title " + appleScriptString(title)}
+	}},
+	{tool{"notify-send", func() bool { return hasDisplay() || os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" }}, func(title, body string) []string {
+		return []string{"--app-name=bashlog", "--", title, body}
+	}},
+	{tool{"powershell.exe", func() bool { return isWindows() || isWSL() }}, windowsNotifyArgs},
+}
+
+// notifyTimeout is how long a notification tool may take to hand the
+// notification over before it is given up on
+const notifyTimeout = 10 * time.Second
+
+// Notify shows a notification on the desktop with the first tool
+// available
+func Notify(title, body string) error {
+	if remote() {
+		return ErrUnsupported
+	}
+	for _, t := range notifyTools {
+		if !t.available() {
+			continue
+		}
+		cmd := exec.Command(t.name, t.args(title, body)...)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.name, err)
+			}
+		case <-time.After(notifyTimeout):
+			cmd.Process.Kill()
+			return fmt.Errorf("%s: timed out", t.name)
+		}
+		return nil
+	}
+	return ErrUnsupported
+}
+
+// appleScriptString quotes s as an AppleScript string
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// windowsNotifyArgs shows a notification as a balloon from the tray, which
+// every Windows desktop has without installing a module
+func windowsNotifyArgs(title, body string) []string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	script := "Add-Type -AssemblyName System.Windows.Forms; " +
+		"$n = New-Object System.Windows.Forms.NotifyIcon; " +
+		"$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; " +
+		"$n.ShowBalloonTip(10000, " + quote(title) + ", " + quote(body) + ", 'Info'); " +
+		"Start-Sleep -Seconds 5; $n.Dispose()"
+	return []string{"-NoProfile", "-NonInteractive", "-Command", script}
+}
@@ -0,0 +1,49 @@
+// Package platform reaches the desktop bashlog runs on: its clipboard, its
+// notifications and its trash bin, on Linux and the BSDs, macOS and
+// Windows, and from WSL to the Windows desktop. Each goes through the tools
+// the platform has for it, such as pbcopy, notify-send or PowerShell, and
+// reports ErrUnsupported where none is at hand, so callers can fall back to
+// what the terminal offers.
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ErrUnsupported is returned when the platform has no way of doing what
+// was asked from here, as over ssh or without a desktop session
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// tool is a platform command, usable where its check passes and it is
+// installed
+type tool struct {
+	name string
+	// usable reports whether the tool can reach the desktop from here
+	usable func() bool
+}
+
+// available reports whether t can be run
+func (t tool) available() bool {
+	if !t.usable() {
+		return false
+	}
+	_, err := exec.LookPath(t.name)
+	return err == nil
+}
+
+func isDarwin() bool  { return runtime.GOOS == "darwin" }
+func isWindows() bool { return runtime.GOOS == "windows" }
+
+// isWSL reports whether this is Linux under WSL, which reaches the
+// Windows desktop through its .exe tools
+func isWSL() bool { return os.Getenv("WSL_DISTRO_NAME") != "" }
+
+// hasDisplay reports whether an X11 or Wayland session is reachable
+func hasDisplay() bool { return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" }
+
+// remote reports whether bashlog runs over ssh, where the tools would
+// reach the remote machine's desktop rather than the user's
+func remote() bool { return os.Getenv("SSH_TTY") != "" }
@@ -0,0 +1,19 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Trash moves the file or directory at path to the desktop's trash bin,
+// where the file manager can restore it from, and returns where it went
+func Trash(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return "", err
+	}
+	return trash(abs)
+}
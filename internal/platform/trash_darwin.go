@@ -0,0 +1,37 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// trash moves path into ~/.Trash, the trash of the home volume. Finder
+// puts back only what it trashed itself, so it is dragged back from there
+func trash(path string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".Trash")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, uniqueName(dir, filepath.Base(path)))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// uniqueName returns name, or name with a number added, as a name not yet
+// taken in dir, for trashing the same name twice
+func uniqueName(dir, name string) string {
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s.%d", name, i)
+	}
+}
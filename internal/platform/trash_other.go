@@ -0,0 +1,90 @@
+//go:build !darwin && !windows
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// trash moves path into the home trash of the freedesktop.org trash
+// specification, which GNOME, KDE and the other Linux and BSD desktops
+// share, with the .trashinfo file they restore it by
+func trash(path string) (string, error) {
+	dir, err := homeTrash()
+	if err != nil {
+		return "", err
+	}
+	files, info := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	for _, d := range []string{files, info} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return "", err
+		}
+	}
+
+	// The info file is created first and exclusively, claiming the name
+	name := filepath.Base(path)
+	var infoPath string
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s.%d", name, i)
+		}
+		infoPath = filepath.Join(info, candidate+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escapePath(path), time.Now().Format("2006-01-02T15:04:05"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		name = candidate
+		break
+	}
+
+	dest := filepath.Join(files, name)
+	if err := os.Rename(path, dest); err != nil {
+		os.Remove(infoPath)
+		if errors.Is(err, syscall.EXDEV) {
+			return "", fmt.Errorf("%s is on another filesystem than the trash in %s", path, dir)
+		}
+		return "", err
+	}
+	return dest, nil
+}
+
+// homeTrash returns the home trash directory, in $XDG_DATA_HOME
+func homeTrash() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(data) {
+		return filepath.Join(data, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// escapePath writes path as the specification wants it, URL-escaped with
+// its slashes kept
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
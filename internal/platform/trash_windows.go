@@ -0,0 +1,28 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// trash sends path to the Recycle Bin through the .NET call Explorer's
+// delete makes, with no dialog
+func trash(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	call := "DeleteFile"
+	if info.IsDir() {
+		call = "DeleteDirectory"
+	}
+	script := "Add-Type -AssemblyName Microsoft.VisualBasic; " +
+		"[Microsoft.VisualBasic.FileIO.FileSystem]::" + call + "('" + strings.ReplaceAll(path, "'", "''") + "', 'OnlyErrorDialogs', 'SendToRecycleBin')"
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("powershell: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return "the Recycle Bin", nil
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import "errors"
+
+// ErrPoolClosed is returned for queries on a closed pool
+var ErrPoolClosed = errors.New("postgres: pool closed")
+
+// Pool shares up to a fixed number of connections between goroutines,
+// opening them as they're first needed and keeping them for reuse. A
+// server's API handlers each take one for as long as a query or
+// transaction runs, and wait while all are taken
+type Pool struct {
+	config Config
+	slots  chan struct{}
+	idle   chan *Conn
+	closed chan struct{}
+}
+
+// NewPool returns a pool of at most size connections made with config
+func NewPool(config Config, size int) *Pool {
+	size = max(size, 1)
+	return &Pool{
+		config: config,
+		slots:  make(chan struct{}, size),
+		idle:   make(chan *Conn, size),
+		closed: make(chan struct{}),
+	}
+}
+
+// Query runs one statement on a connection of the pool, as Conn.Query
+func (p *Pool) Query(sql string, args ...any) (*Result, error) {
+	var result *Result
+	err := p.With(func(c *Conn) error {
+		var err error
+		result, err = c.Query(sql, args...)
+		return err
+	})
+	return result, err
+}
+
+// Exec runs a script on a connection of the pool, as Conn.Exec
+func (p *Pool) Exec(script string) error {
+	return p.With(func(c *Conn) error { return c.Exec(script) })
+}
+
+// With calls fn with a connection of the pool to itself, for statements
+// that must share one, such as a transaction. A connection fn leaves
+// broken or in a transaction is closed rather than reused
+func (p *Pool) With(fn func(c *Conn) error) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	p.put(c)
+	return err
+}
+
+// Tx runs fn in a transaction, committed if fn succeeds and rolled back
+// otherwise
+func (p *Pool) Tx(fn func(c *Conn) error) error {
+	return p.With(func(c *Conn) error {
+		if err := c.Exec("BEGIN"); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			c.Exec("ROLLBACK")
+			return err
+		}
+		return c.Exec("COMMIT")
+	})
+}
+
+// Close closes the idle connections, and those in use as they are given
+// back
+func (p *Pool) Close() {
+	select {
+	case <-p.closed:
+		return
+	default:
+	}
+	close(p.closed)
+	for {
+		select {
+		case c := <-p.idle:
+			c.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (p *Pool) get() (*Conn, error) {
+	select {
+	case <-p.closed:
+		return nil, ErrPoolClosed
+	case p.slots <- struct{}{}:
+	}
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+	c, err := Connect(p.config)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *Pool) put(c *Conn) {
+	defer func() { <-p.slots }()
+	select {
+	case <-p.closed:
+		c.Close()
+		return
+	default:
+	}
+	if c.broken || c.InTransaction() {
+		c.Close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+}
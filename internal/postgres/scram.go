@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/pbkdf2"
+)
+
+// scramMechanism is the SASL mechanism the server's scram-sha-256
+// authentication uses. Channel binding isn't offered
+const scramMechanism = "SCRAM-SHA-256"
+
+// scramClient carries one SCRAM-SHA-256 exchange, as RFC 5802 and RFC 7677
+// describe it
+type scramClient struct {
+	password    string
+	nonce       string
+	firstBare   string
+	serverProof []byte
+}
+
+func newSCRAMClient(password string) (*scramClient, error) {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	return newSCRAMClientNonce(password, "", base64.RawStdEncoding.EncodeToString(raw)), nil
+}
+
+// newSCRAMClientNonce starts an exchange with the nonce given. The server
+// takes the user from the startup message, so it is usually left empty
+func newSCRAMClientNonce(password, user, nonce string) *scramClient {
+	return &scramClient{password: password, nonce: nonce, firstBare: "n=" + user + ",r=" + nonce}
+}
+
+// first is the client's first message
+func (s *scramClient) first() string {
+	return "n,," + s.firstBare
+}
+
+// final answers the server's first message with the client's proof
+func (s *scramClient) final(serverFirst string) (string, error) {
+	var nonce, salt string
+	iterations := 0
+	for _, attr := range strings.Split(serverFirst, ",") {
+		key, value, _ := strings.Cut(attr, "=")
+		switch key {
+		case "r":
+			nonce = value
+		case "s":
+			salt = value
+		case "i":
+			iterations, _ = strconv.Atoi(value)
+		}
+	}
+	if !strings.HasPrefix(nonce, s.nonce) || len(nonce) == len(s.nonce) {
+		return "", errors.New("postgres: the server's SCRAM nonce doesn't extend ours")
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil || iterations <= 0 {
+		return "", errors.New("postgres: malformed SCRAM challenge")
+	}
+
+	salted := pbkdf2.Key([]byte(s.password), saltBytes, iterations)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := s.firstBare + "," + serverFirst + "," + withoutProof
+
+	proof := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	s.serverProof = hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verify checks the server's final message proves it knew the password
+// too
+func (s *scramClient) verify(serverFinal string) error {
+	if e, ok := strings.CutPrefix(serverFinal, "e="); ok {
+		return errors.New("postgres: SCRAM authentication failed: " + e)
+	}
+	signature, ok := strings.CutPrefix(serverFinal, "v=")
+	if !ok {
+		return errors.New("postgres: malformed SCRAM completion")
+	}
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || s.serverProof == nil || subtle.ConstantTimeCompare(got, s.serverProof) != 1 {
+		return errors.New("postgres: the server's SCRAM signature doesn't match")
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,124 @@
+// Package protect checks the passphrase or TOTP code that guards
+// destructive operations on workspaces marked sensitive. Only a salted
+// hash of the passphrase is stored; a TOTP secret is stored as the base32
+// string authenticator apps are given.
+package protect
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/pbkdf2"
+)
+
+// passphraseIterations is the PBKDF2 work factor for new passphrase hashes
+const passphraseIterations = 200000
+
+// TOTP parameters, the defaults every authenticator app uses
+const (
+	totpStep   = 30 * time.Second
+	totpDigits = 6
+	// totpSkew is how many steps either side of now are accepted, for
+	// clocks that drift and codes typed as they roll over
+	totpSkew = 1
+)
+
+// HashPassphrase returns the stored form of passphrase:
+// pbkdf2-sha256$<iterations>$<salt>$<hash>
+func HashPassphrase(passphrase string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := pbkdf2.Key([]byte(passphrase), salt, passphraseIterations)
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passphraseIterations, enc.EncodeToString(salt), enc.EncodeToString(sum)), nil
+}
+
+// CheckPassphrase reports whether passphrase matches a hash from
+// HashPassphrase
+func CheckPassphrase(stored, passphrase string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(pbkdf2.Key([]byte(passphrase), salt, iterations), want) == 1
+}
+
+// totpEncoding is base32 without padding, as otpauth URIs carry it
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret, base32 encoded
+func NewTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// TOTPURI returns the otpauth:// URI authenticator apps import secret from,
+// usually as a QR code
+func TOTPURI(secret, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", "bashlog")
+	return "otpauth://totp/" + url.PathEscape("bashlog:"+account) + "?" + v.Encode()
+}
+
+// CheckTOTP reports whether code is the RFC 6238 code for secret at now,
+// or a step either side of it
+func CheckTOTP(secret, code string, now time.Time) bool {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+	counter := now.Unix() / int64(totpStep/time.Second)
+	for d := -totpSkew; d <= totpSkew; d++ {
+		want := totpCode(key, uint64(counter+int64(d)))
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// totpCode is the HOTP value of key at counter (RFC 4226)
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
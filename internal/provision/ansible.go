@@ -0,0 +1,385 @@
+package provision
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// task is one Ansible task. Args keep their order so the output reads
+// like a hand-written playbook
+type task struct {
+	name    string
+	module  string
+	args    []arg
+	become  bool
+	comment string
+}
+
+type arg struct {
+	key   string
+	value any // string, bool or []string
+}
+
+// Ansible writes a playbook skeleton replaying steps on all hosts
+func Ansible(w io.Writer, title string, steps []Step) error {
+	var tasks []task
+	env := map[string]string{}
+	var envOrder []string
+	become := false
+
+	for _, s := range steps {
+		switch s.Kind {
+		case Setenv:
+			if _, ok := env[s.Name]; !ok {
+				envOrder = append(envOrder, s.Name)
+			}
+			env[s.Name] = s.Value
+		case Edit:
+			tasks = append(tasks, task{
+				name:    "Update " + s.File,
+				module:  "ansible.builtin.copy",
+				args:    []arg{{"src", "files/" + baseName(s.File)}, {"dest", s.File}},
+				become:  s.Sudo,
+				comment: "TODO: the file was edited by hand; save the result as files/" + baseName(s.File),
+			})
+		case Run:
+			t := ansibleTask(s)
+			t.become = s.Sudo
+			tasks = append(tasks, t)
+		}
+		become = become || s.Sudo
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "---\n# Generated by bashlog-mgr to-ansible from %s\n", title)
+	fmt.Fprintf(b, "# A best-effort skeleton: review every task, especially the TODOs, before running it\n")
+	fmt.Fprintf(b, "- name: %s\n", yamlString("Replay "+title))
+	fmt.Fprintf(b, "  hosts: all\n")
+	if len(envOrder) > 0 {
+		fmt.Fprintf(b, "  environment:\n")
+		for _, n := range envOrder {
+			fmt.Fprintf(b, "    %s: %s\n", n, yamlString(env[n]))
+		}
+	}
+	fmt.Fprintf(b, "  tasks:\n")
+	if len(tasks) == 0 {
+		fmt.Fprintf(b, "    [] # no commands that change the system were recorded\n")
+	}
+	for i, t := range tasks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if t.comment != "" {
+			fmt.Fprintf(b, "    # %s\n", t.comment)
+		}
+		fmt.Fprintf(b, "    - name: %s\n", yamlString(t.name))
+		if t.become {
+			fmt.Fprintf(b, "      become: true\n")
+		}
+		fmt.Fprintf(b, "      %s:\n", t.module)
+		for _, a := range t.args {
+			switch v := a.value.(type) {
+			case []string:
+				fmt.Fprintf(b, "        %s:\n", a.key)
+				for _, item := range v {
+					fmt.Fprintf(b, "          - %s\n", yamlString(item))
+				}
+			case bool:
+				fmt.Fprintf(b, "        %s: %t\n", a.key, v)
+			default:
+				fmt.Fprintf(b, "        %s: %s\n", a.key, yamlString(fmt.Sprint(v)))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ansibleTask translates a Run step into a module call where the
+// command's meaning is clear, falling back to ansible.builtin.shell
+func ansibleTask(s Step) task {
+	name, args, single := s.Program()
+	if single && len(s.Pipeline[0].Redirects) == 0 {
+		if t, ok := moduleTask(name, args, s.Dir); ok {
+			return t
+		}
+	}
+	if single {
+		if t, ok := appendTask(s); ok {
+			return t
+		}
+	}
+
+	t := task{name: "Run " + truncate(s.Raw, 60), module: "ansible.builtin.shell", args: []arg{{"cmd", s.Raw}}}
+	if s.Dir != "" {
+		t.args = append(t.args, arg{"chdir", s.Dir})
+	}
+	t.comment = "TODO: replace with a module if one fits, and add creates/removes to make it idempotent"
+	return t
+}
+
+func moduleTask(name string, args []string, dir string) (task, bool) {
+	words := operands(args)
+	sub := ""
+	if len(words) > 0 {
+		sub = words[0]
+	}
+
+	switch name {
+	case "apt", "apt-get":
+		switch sub {
+		case "update":
+			return task{name: "Update the apt cache", module: "ansible.builtin.apt", args: []arg{{"update_cache", true}}}, true
+		case "upgrade", "dist-upgrade", "full-upgrade":
+			return task{name: "Upgrade packages", module: "ansible.builtin.apt", args: []arg{{"upgrade", pick(sub == "upgrade", "safe", "dist")}}}, true
+		case "install", "remove", "purge":
+			return packageTask("ansible.builtin.apt", sub, words[1:]), len(words) > 1
+		}
+	case "yum", "dnf":
+		switch sub {
+		case "install", "remove", "erase":
+			return packageTask("ansible.builtin."+name, sub, words[1:]), len(words) > 1
+		case "update", "upgrade":
+			if len(words) == 1 {
+				return task{name: "Upgrade packages", module: "ansible.builtin." + name, args: []arg{{"name", "*"}, {"state", "latest"}}}, true
+			}
+		}
+	case "pip", "pip3":
+		if sub == "install" && len(words) > 1 && !hasArg(args, "-r") {
+			return task{name: "Install Python packages", module: "ansible.builtin.pip", args: []arg{{"name", words[1:]}}}, true
+		}
+	case "systemctl":
+		return systemdTask(args)
+	case "service":
+		if len(words) == 2 {
+			if state, ok := serviceStates[words[1]]; ok {
+				return task{name: capitalize(words[1]) + " " + words[0], module: "ansible.builtin.service",
+					args: []arg{{"name", words[0]}, {"state", state}}}, true
+			}
+		}
+	case "mkdir":
+		if len(words) > 0 {
+			t := task{name: "Create " + strings.Join(words, ", "), module: "ansible.builtin.file", args: []arg{{"path", resolve(dir, words[0])}, {"state", "directory"}}}
+			if mode := optionValue(args, "-m", "--mode"); mode != "" {
+				t.args = append(t.args, arg{"mode", mode})
+			}
+			return t, len(words) == 1
+		}
+	case "touch":
+		if len(words) == 1 {
+			return task{name: "Touch " + words[0], module: "ansible.builtin.file", args: []arg{{"path", resolve(dir, words[0])}, {"state", "touch"}}}, true
+		}
+	case "rm", "rmdir":
+		if len(words) == 1 && !strings.ContainsAny(words[0], "*?[") {
+			return task{name: "Remove " + words[0], module: "ansible.builtin.file", args: []arg{{"path", resolve(dir, words[0])}, {"state", "absent"}}}, true
+		}
+	case "cp":
+		if len(words) == 2 {
+			t := task{name: "Copy " + words[0] + " to " + words[1], module: "ansible.builtin.copy",
+				args: []arg{{"src", resolve(dir, words[0])}, {"dest", resolve(dir, words[1])}, {"remote_src", true}}}
+			return t, !hasFlagLetter(args, 'r') && !hasFlagLetter(args, 'R') && !hasFlagLetter(args, 'a')
+		}
+	case "ln":
+		if len(words) == 2 && hasFlagLetter(args, 's') {
+			return task{name: "Link " + words[1] + " to " + words[0], module: "ansible.builtin.file",
+				args: []arg{{"src", words[0]}, {"dest", resolve(dir, words[1])}, {"state", "link"}}}, true
+		}
+	case "chmod":
+		if len(words) == 2 && !hasFlagLetter(args, 'R') {
+			return task{name: "Set the mode of " + words[1], module: "ansible.builtin.file",
+				args: []arg{{"path", resolve(dir, words[1])}, {"mode", words[0]}}}, true
+		}
+	case "chown":
+		if len(words) == 2 && !hasFlagLetter(args, 'R') {
+			owner, group, _ := strings.Cut(words[0], ":")
+			t := task{name: "Set the owner of " + words[1], module: "ansible.builtin.file", args: []arg{{"path", resolve(dir, words[1])}}}
+			if owner != "" {
+				t.args = append(t.args, arg{"owner", owner})
+			}
+			if group != "" {
+				t.args = append(t.args, arg{"group", group})
+			}
+			return t, true
+		}
+	case "useradd", "adduser":
+		if len(words) == 1 {
+			return task{name: "Create user " + words[0], module: "ansible.builtin.user", args: []arg{{"name", words[0]}}}, true
+		}
+	case "git":
+		if sub == "clone" && len(words) >= 2 {
+			repo := words[1]
+			dest := strings.TrimSuffix(baseName(repo), ".git")
+			if len(words) > 2 {
+				dest = words[2]
+			}
+			return task{name: "Clone " + repo, module: "ansible.builtin.git", args: []arg{{"repo", repo}, {"dest", resolve(dir, dest)}}}, true
+		}
+	}
+	return task{}, false
+}
+
+var serviceStates = map[string]string{
+	"start": "started", "stop": "stopped", "restart": "restarted", "reload": "reloaded",
+}
+
+func systemdTask(args []string) (task, bool) {
+	words := operands(args)
+	if len(words) < 2 {
+		if len(words) == 1 && words[0] == "daemon-reload" {
+			return task{name: "Reload systemd", module: "ansible.builtin.systemd", args: []arg{{"daemon_reload", true}}}, true
+		}
+		return task{}, false
+	}
+
+	verb, units := words[0], words[1:]
+	if len(units) != 1 {
+		return task{}, false
+	}
+	t := task{name: capitalize(verb) + " " + units[0], module: "ansible.builtin.systemd", args: []arg{{"name", units[0]}}}
+	switch verb {
+	case "enable", "disable":
+		t.args = append(t.args, arg{"enabled", verb == "enable"})
+		if hasArg(args, "--now") {
+			t.args = append(t.args, arg{"state", pick(verb == "enable", "started", "stopped")})
+		}
+	case "mask", "unmask":
+		t.args = append(t.args, arg{"masked", verb == "mask"})
+	default:
+		state, ok := serviceStates[verb]
+		if !ok {
+			return task{}, false
+		}
+		t.args = append(t.args, arg{"state", state})
+	}
+	return t, true
+}
+
+func packageTask(module, verb string, packages []string) task {
+	state := "present"
+	name := "Install " + strings.Join(packages, ", ")
+	if verb != "install" {
+		state = "absent"
+		name = "Remove " + strings.Join(packages, ", ")
+	}
+	return task{name: name, module: module, args: []arg{{"name", packages}, {"state", state}}}
+}
+
+// appendTask turns "echo text >> file" into a lineinfile task
+func appendTask(s Step) (task, bool) {
+	c := s.Pipeline[0]
+	name, args, _ := c.Program()
+	if name != "echo" || len(c.Redirects) != 1 || c.Redirects[0].Op != ">>" {
+		return task{}, false
+	}
+	words := operands(args)
+	if len(words) == 0 {
+		return task{}, false
+	}
+	file := resolve(s.Dir, c.Redirects[0].Target)
+	return task{name: "Add a line to " + file, module: "ansible.builtin.lineinfile",
+		args: []arg{{"path", file}, {"line", strings.Join(words, " ")}, {"create", true}}}, true
+}
+
+// operands drops options from args, keeping the values of the few
+// options that take one separately out of the result
+func operands(args []string) []string {
+	var out []string
+	skip := false
+	for _, a := range args {
+		switch {
+		case skip:
+			skip = false
+		case a == "-m" || a == "--mode" || a == "-o" || a == "-t":
+			skip = true
+		case strings.HasPrefix(a, "-"):
+		default:
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func optionValue(args []string, names ...string) string {
+	for i, a := range args {
+		for _, n := range names {
+			if a == n && i+1 < len(args) {
+				return args[i+1]
+			}
+			if strings.HasPrefix(a, n+"=") {
+				return a[len(n)+1:]
+			}
+		}
+	}
+	return ""
+}
+
+func hasArg(args []string, want string) bool {
+	for _, a := range args {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlagLetter(args []string, letter byte) bool {
+	for _, a := range args {
+		if len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], letter) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func pick(cond bool, a, b string) string {
+	if cond {
+		return a
+	}
+	return b
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func baseName(p string) string {
+	p = strings.TrimRight(p, "/")
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// plainYAML matches strings that need no quoting in YAML, short of the
+// sequences checked for in yamlString
+var plainYAML = regexp.MustCompile(`^[A-Za-z0-9_./~][A-Za-z0-9_./~@+=,:() -]*$`)
+
+// yamlString returns s as a YAML scalar, double-quoted unless it can't be
+// mistaken for anything but a string
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "", "yes", "no", "true", "false", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if plainYAML.MatchString(s) && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, ":") && !strings.Contains(s, ": ") {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return s
+		}
+	}
+	return strconv.Quote(s)
+}
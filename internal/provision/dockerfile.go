@@ -0,0 +1,160 @@
+package provision
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// DefaultBaseImage is used when the recorded commands don't point at a
+// distribution
+const DefaultBaseImage = "ubuntu:24.04"
+
+// Dockerfile writes a Dockerfile replaying steps on base, or on an image
+// guessed from the package manager used when base is empty
+func Dockerfile(w io.Writer, title, base string, steps []Step) error {
+	if base == "" {
+		base = guessBaseImage(steps)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# Generated by bashlog-mgr to-dockerfile from %s\n", title)
+	fmt.Fprintf(b, "# A starting point: check the base image and review every step before building\n")
+	fmt.Fprintf(b, "FROM %s\n", base)
+
+	var run []string
+	flush := func() {
+		if len(run) > 0 {
+			fmt.Fprintf(b, "RUN %s\n", strings.Join(run, " \\\n    && "))
+			run = nil
+		}
+	}
+
+	workdir := ""
+	for _, s := range steps {
+		switch s.Kind {
+		case Chdir:
+			dir := strings.Replace(s.Dir, "~", "/root", 1)
+			if dir == "" || !strings.HasPrefix(dir, "/") || dir == workdir {
+				continue
+			}
+			flush()
+			fmt.Fprintf(b, "WORKDIR %s\n", dir)
+			workdir = dir
+		case Setenv:
+			flush()
+			fmt.Fprintf(b, "ENV %s=%s\n", s.Name, dockerValue(s.Value))
+		case Edit:
+			flush()
+			file := strings.Replace(s.File, "~", "/root", 1)
+			fmt.Fprintf(b, "# TODO: %s was edited by hand; save the result next to this Dockerfile\n", file)
+			fmt.Fprintf(b, "COPY %s %s\n", baseName(file), file)
+		case Run:
+			if note, skip := buildTimeNote(s); skip {
+				flush()
+				fmt.Fprintf(b, "# %s\n", note)
+				continue
+			}
+			run = append(run, dockerCommand(s))
+		}
+	}
+	flush()
+	fmt.Fprintf(b, "# TODO: set the process the container runs\n# CMD [\"...\"]\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dockerCommand adapts a command to run unattended during a build
+func dockerCommand(s Step) string {
+	name, args, single := s.Program()
+	if !single {
+		return s.Raw
+	}
+
+	switch name {
+	case "apt", "apt-get":
+		if len(args) > 0 && args[0] == "update" {
+			return "apt-get update"
+		}
+		if len(args) > 0 && isChange(args[0]) {
+			return "DEBIAN_FRONTEND=noninteractive apt-get " + shellparse.Join(withYes(args))
+		}
+	case "yum", "dnf":
+		if len(args) > 0 && isChange(args[0]) {
+			return name + " " + shellparse.Join(withYes(args))
+		}
+	}
+	return s.Raw
+}
+
+func isChange(sub string) bool {
+	switch sub {
+	case "install", "upgrade", "dist-upgrade", "update", "remove", "purge", "erase", "autoremove":
+		return true
+	}
+	return false
+}
+
+// withYes adds -y after the subcommand unless the command already assumes
+// yes, as nothing can answer prompts during a build
+func withYes(args []string) []string {
+	for _, a := range args {
+		if a == "-y" || a == "--yes" || a == "--assumeyes" || a == "-qy" || a == "-yq" {
+			return args
+		}
+	}
+	return append([]string{args[0], "-y"}, args[1:]...)
+}
+
+// buildTimeNote explains commands that do nothing during a build, such as
+// managing services, which aren't running in an image being built
+func buildTimeNote(s Step) (string, bool) {
+	name, args, single := s.Program()
+	if !single {
+		return "", false
+	}
+	switch name {
+	case "systemctl", "service":
+		if len(args) > 0 && (args[0] == "daemon-reload" || len(args) > 1) {
+			return "TODO: " + s.Raw + " (services don't run during a build; start the process with CMD or ENTRYPOINT)", true
+		}
+	case "reboot", "shutdown":
+		return "skipped: " + s.Raw, true
+	}
+	return "", false
+}
+
+// dockerValue quotes an ENV value when it holds spaces or quotes
+func dockerValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\"'\\") {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	}
+	return v
+}
+
+// guessBaseImage picks an image matching the package manager the steps
+// use first
+func guessBaseImage(steps []Step) string {
+	for _, s := range steps {
+		name, _, single := s.Program()
+		if !single {
+			continue
+		}
+		switch name {
+		case "apt", "apt-get", "dpkg":
+			return "debian:bookworm"
+		case "dnf", "yum", "rpm":
+			return "fedora:latest"
+		case "apk":
+			return "alpine:latest"
+		case "pacman":
+			return "archlinux:latest"
+		case "zypper":
+			return "opensuse/leap:latest"
+		}
+	}
+	return DefaultBaseImage
+}
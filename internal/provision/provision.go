@@ -0,0 +1,230 @@
+// Package provision turns the commands of a recorded session into a
+// starting point for repeatable automation, such as an Ansible playbook.
+//
+// Conversion is best effort: commands with a well-known meaning (package
+// installs, service management, file manipulation) are translated, and
+// everything else is carried over verbatim for review. Read-only commands
+// such as ls or systemctl status are dropped.
+package provision
+
+import (
+	"path"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// Kind is what a step does
+type Kind int
+
+const (
+	// Run runs a command or pipeline
+	Run Kind = iota
+	// Chdir changes the working directory to Dir
+	Chdir
+	// Setenv sets the environment variable Name to Value
+	Setenv
+	// Edit opens File in an interactive editor, which can't be replayed
+	Edit
+)
+
+// Step is one command of a recorded session
+type Step struct {
+	Kind Kind
+
+	// Pipeline holds the simple commands of a Run step, joined by pipes
+	Pipeline []shellparse.Simple
+	// Raw is the step as written, without sudo
+	Raw string
+	// Sudo is set when the command ran through sudo or doas
+	Sudo bool
+
+	// Dir is the working directory the step ran in, or changed to for a
+	// Chdir step; "" when unknown
+	Dir string
+
+	Name  string
+	Value string
+	File  string
+}
+
+// Program returns the program and arguments of a single-command Run step,
+// looking through sudo and similar wrappers
+func (s Step) Program() (string, []string, bool) {
+	if s.Kind != Run || len(s.Pipeline) != 1 {
+		return "", nil, false
+	}
+	name, args, _ := s.Pipeline[0].Program()
+	return name, args, true
+}
+
+// Steps splits recorded command lines into steps, tracking the working
+// directory across cd commands and dropping read-only commands
+func Steps(commands []string) []Step {
+	var steps []Step
+	dir := ""
+
+	for _, line := range commands {
+		var pipeline []shellparse.Simple
+		for _, c := range shellparse.Parse(line) {
+			pipeline = append(pipeline, c)
+			if c.Op == "|" {
+				continue
+			}
+
+			if s, ok := classify(pipeline, dir); ok {
+				if s.Kind == Chdir {
+					dir = s.Dir
+				}
+				steps = append(steps, s)
+			}
+			pipeline = nil
+		}
+	}
+	return steps
+}
+
+// classify turns one pipeline into a step, reporting false for commands
+// that don't change the system
+func classify(pipeline []shellparse.Simple, dir string) (Step, bool) {
+	raws := make([]string, len(pipeline))
+	sudo := false
+	for i, c := range pipeline {
+		raws[i] = unwrap(c)
+		_, _, via := c.Program()
+		for _, w := range via {
+			sudo = sudo || w == "sudo" || w == "doas"
+		}
+	}
+	step := Step{Kind: Run, Pipeline: pipeline, Raw: strings.Join(raws, " | "), Sudo: sudo, Dir: dir}
+
+	first := pipeline[0]
+	name, args, _ := first.Program()
+
+	if len(pipeline) == 1 {
+		if name == "" && len(first.Assignments) > 0 {
+			n, v, _ := strings.Cut(first.Assignments[0], "=")
+			return Step{Kind: Setenv, Name: n, Value: v, Dir: dir}, true
+		}
+		switch name {
+		case "cd":
+			return Step{Kind: Chdir, Dir: changeDir(dir, args)}, true
+		case "export":
+			for _, a := range args {
+				if n, v, ok := strings.Cut(a, "="); ok {
+					return Step{Kind: Setenv, Name: n, Value: v, Dir: dir}, true
+				}
+			}
+			return Step{}, false
+		}
+		if isEditor(name) {
+			for _, a := range args {
+				if !strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "+") {
+					return Step{Kind: Edit, File: resolve(dir, a), Dir: dir, Sudo: sudo}, true
+				}
+			}
+			return Step{}, false
+		}
+		if len(first.Redirects) == 0 && isReadOnly(name, args) {
+			return Step{}, false
+		}
+	}
+	return step, true
+}
+
+// unwrap returns a command as written without a leading sudo or doas and
+// its options, since automation tools escalate privileges themselves
+func unwrap(c shellparse.Simple) string {
+	_, _, via := c.Program()
+	if len(via) == 0 || (via[0] != "sudo" && via[0] != "doas") {
+		return c.Raw
+	}
+	raw := strings.TrimSpace(c.Raw)
+	name, _, _ := c.Program()
+	if i := strings.Index(raw, name); i > 0 {
+		// Keep any wrappers after sudo, such as env or nice
+		return raw[i:]
+	}
+	return raw
+}
+
+// changeDir applies cd's arguments to dir
+func changeDir(dir string, args []string) string {
+	var target string
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			target = a
+			break
+		}
+	}
+	switch target {
+	case "", "~":
+		return "~"
+	case "-":
+		// The previous directory isn't tracked
+		return ""
+	}
+	return resolve(dir, target)
+}
+
+// resolve makes p absolute against dir where possible
+func resolve(dir, p string) string {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "~") || strings.HasPrefix(p, "$") || dir == "" {
+		return p
+	}
+	return path.Join(dir, p)
+}
+
+func isEditor(name string) bool {
+	switch name {
+	case "vi", "vim", "nvim", "nano", "emacs", "pico", "micro", "joe", "mcedit", "ed", "hx", "sudoedit":
+		return true
+	}
+	return false
+}
+
+// readOnly lists programs that only inspect the system
+var readOnly = map[string]bool{
+	"ls": true, "ll": true, "cat": true, "less": true, "more": true, "head": true, "tail": true,
+	"grep": true, "egrep": true, "rg": true, "ps": true, "top": true, "htop": true, "df": true,
+	"du": true, "free": true, "whoami": true, "id": true, "pwd": true, "history": true,
+	"clear": true, "exit": true, "logout": true, "man": true, "which": true, "type": true,
+	"env": true, "printenv": true, "uname": true, "hostname": true, "date": true, "uptime": true,
+	"journalctl": true, "dmesg": true, "stat": true, "file": true, "tree": true, "w": true,
+	"who": true, "last": true, "lsblk": true, "lscpu": true, "netstat": true, "ss": true,
+	"ping": true, "dig": true, "nslookup": true, "echo": true, "printf": true, "true": true,
+	"mark": true, "bashlog": true, "bashlog-mgr": true, "diff": true, "wc": true, "sort": true,
+}
+
+func isReadOnly(name string, args []string) bool {
+	if readOnly[name] {
+		return true
+	}
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch name {
+	case "systemctl", "service":
+		if name == "service" && len(args) > 1 {
+			sub = args[1]
+		}
+		return sub == "status" || sub == "list-units" || sub == "is-active" || sub == "is-enabled" || sub == "cat" || sub == "show"
+	case "apt", "apt-get", "apt-cache", "dpkg", "yum", "dnf", "rpm":
+		return sub == "search" || sub == "show" || sub == "list" || sub == "policy" || sub == "info" || sub == "-l" || sub == "-q" || sub == "-qa"
+	case "git":
+		return sub == "status" || sub == "log" || sub == "diff" || sub == "show"
+	case "docker":
+		return sub == "ps" || sub == "images" || sub == "logs" || sub == "inspect"
+	case "find":
+		for _, a := range args {
+			if a == "-delete" || a == "-exec" || a == "-execdir" {
+				return false
+			}
+		}
+		return true
+	case "ip":
+		return len(args) <= 1 || args[1] == "show" || args[1] == "list"
+	}
+	return false
+}
@@ -1,2 +1,18 @@
 // Package pty provides pseudo-terminal functionality for bashlog.
 package pty
+
+import "errors"
+
+// ErrUnsupported is returned on platforms without pseudo-terminal support
+var ErrUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+// Size is a terminal window size in character cells
+type Size struct {
+	Rows uint16
+	Cols uint16
+}
+
+// State holds terminal settings to be restored with Restore
+type State struct {
+	termios termios
+}
@@ -0,0 +1,136 @@
+//go:build linux
+
+package pty
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+type termios = syscall.Termios
+
+type winsize struct {
+	Rows   uint16
+	Cols   uint16
+	XPixel uint16
+	YPixel uint16
+}
+
+// Start runs cmd with its standard streams attached to a new
+// pseudo-terminal, which becomes its controlling terminal, and returns the
+// master side
+func Start(cmd *exec.Cmd) (*os.File, error) {
+	master, slaveName, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(slaveName, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	defer slave.Close()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	return master, nil
+}
+
+// GetSize returns the window size of the terminal f
+func GetSize(f *os.File) (Size, error) {
+	var ws winsize
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return Size{}, err
+	}
+	return Size{Rows: ws.Rows, Cols: ws.Cols}, nil
+}
+
+// SetSize sets the window size of the terminal f, which delivers SIGWINCH
+// to its foreground process group
+func SetSize(f *os.File, size Size) error {
+	ws := winsize{Rows: size.Rows, Cols: size.Cols}
+	return ioctl(f.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	var t termios
+	return ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&t))) == nil
+}
+
+// MakeRaw puts the terminal f into raw mode, so that input, including
+// control characters, passes through to the pseudo-terminal untouched
+func MakeRaw(f *os.File) (*State, error) {
+	var t termios
+	if err := ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return nil, err
+	}
+	state := &State{termios: t}
+
+	// Equivalent to cfmakeraw(3)
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(f.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&t))); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Restore returns the terminal f to a state saved by MakeRaw
+func Restore(f *os.File, state *State) error {
+	return ioctl(f.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&state.termios)))
+}
+
+// open allocates a pseudo-terminal pair and returns the master and the
+// path of the slave
+func open() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, "", err
+	}
+
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, "", err
+	}
+
+	return master, "/dev/pts/" + strconv.Itoa(int(n)), nil
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package pty
+
+import (
+	"os"
+	"os/exec"
+)
+
+type termios struct{}
+
+// Start is not supported on this platform
+func Start(cmd *exec.Cmd) (*os.File, error) { return nil, ErrUnsupported }
+
+// GetSize is not supported on this platform
+func GetSize(f *os.File) (Size, error) { return Size{}, ErrUnsupported }
+
+// SetSize is not supported on this platform
+func SetSize(f *os.File, size Size) error { return ErrUnsupported }
+
+// IsTerminal always reports false on this platform
+func IsTerminal(f *os.File) bool { return false }
+
+// MakeRaw is not supported on this platform
+func MakeRaw(f *os.File) (*State, error) { return nil, ErrUnsupported }
+
+// Restore is not supported on this platform
+func Restore(f *os.File, state *State) error { return ErrUnsupported }
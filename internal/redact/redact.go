@@ -0,0 +1,351 @@
+// Package redact masks the details that identify people and machines in
+// shared history: hostnames, usernames and paths. What is masked is
+// chosen by a named profile, so one workspace can be shared at different
+// levels of trust. Secrets, the passwords, tokens and keys commands were
+// typed with, are masked whatever the profile.
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// The fields a profile can mask
+const (
+	// Hostnames covers machine names, domain names and IP addresses
+	Hostnames = "hostnames"
+	Usernames = "usernames"
+	// Paths covers absolute and home-relative paths, other than those
+	// every machine has, such as /usr/bin
+	Paths = "paths"
+)
+
+// Fields are every field a profile can mask
+var Fields = []string{Hostnames, Usernames, Paths}
+
+// builtin are the profiles there are without any settings
+var builtin = map[string][]string{
+	// internal is for sharing within the organisation, where machines and
+	// paths mean something to the reader but who ran what isn't theirs
+	"internal": {Usernames},
+	// external-vendor is for sharing outside it
+	"external-vendor": {Hostnames, Usernames, Paths},
+}
+
+// Profile is a named choice of fields to mask
+type Profile struct {
+	Name string
+	Mask map[string]bool
+}
+
+// Fields returns the fields the profile masks, in the order of Fields
+func (p *Profile) Fields() []string {
+	var fields []string
+	for _, f := range Fields {
+		if p.Mask[f] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Profiles returns the built-in profiles along with those read from config
+// values of the form redact.<name>.mask=<field>,..., which replace a
+// built-in profile of the same name
+func Profiles(config map[string]string) (map[string]*Profile, error) {
+	masks := make(map[string][]string)
+	for name, fields := range builtin {
+		masks[name] = fields
+	}
+	for key, value := range config {
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[0] != "redact" {
+			continue
+		}
+		if parts[2] != "mask" {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		var fields []string
+		for _, f := range strings.Split(value, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+		masks[parts[1]] = fields
+	}
+
+	profiles := make(map[string]*Profile)
+	for name, fields := range masks {
+		p := &Profile{Name: name, Mask: make(map[string]bool)}
+		for _, f := range fields {
+			if !contains(Fields, f) {
+				return nil, fmt.Errorf("redact.%s.mask: unknown field %q (want %s)", name, f, strings.Join(Fields, ", "))
+			}
+			p.Mask[f] = true
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// Names returns the names of profiles, sorted
+func Names(profiles map[string]*Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor masks text for one profile. Each distinct value masked gets a
+// placeholder of its own, such as <host-1>, kept for everything the
+// Redactor masks, so a reader can still tell the same machine from
+// another
+type Redactor struct {
+	profile *Profile
+	// known are hosts and users already known to identify someone, such
+	// as the hosts a workspace's commands were recorded on
+	known        map[string]string
+	placeholders map[string]string
+	counts       map[string]int
+}
+
+// New returns a Redactor masking what p says, including wherever they
+// appear the hosts and users given
+func (p *Profile) New(hosts, users []string) *Redactor {
+	r := &Redactor{profile: p, known: make(map[string]string), placeholders: make(map[string]string), counts: make(map[string]int)}
+	for _, h := range hosts {
+		r.learn(Hostnames, h)
+	}
+	for _, u := range users {
+		r.learn(Usernames, u)
+	}
+	return r
+}
+
+// unmasked are account names every machine has, which say nothing about
+// who ran a command
+var unmasked = map[string]bool{"root": true, "nobody": true, "git": true}
+
+// learn records value as identifying, to be masked wherever it appears
+func (r *Redactor) learn(field, value string) {
+	if value != "" && r.profile.Mask[field] && !unmasked[value] && r.known[value] == "" {
+		r.known[value] = field
+	}
+}
+
+// placeholderNames name the placeholders of each field
+var placeholderNames = map[string]string{Hostnames: "host", Usernames: "user", Paths: "path"}
+
+// placeholder returns the placeholder standing for value
+func (r *Redactor) placeholder(field, value string) string {
+	key := field + "\x00" + value
+	if p, ok := r.placeholders[key]; ok {
+		return p
+	}
+	r.counts[field]++
+	p := fmt.Sprintf("<%s-%d>", placeholderNames[field], r.counts[field])
+	r.placeholders[key] = p
+	return p
+}
+
+// mask returns the placeholder for value if the profile masks field
+func (r *Redactor) mask(field, value string) string {
+	if !r.profile.Mask[field] || value == "" || field == Usernames && unmasked[value] {
+		return value
+	}
+	return r.placeholder(field, value)
+}
+
+// sshValueOptions are the options of ssh and the tools like it taking a
+// value
+var sshValueOptions = map[string]bool{
+	"-b": true, "-c": true, "-D": true, "-E": true, "-e": true, "-F": true, "-I": true, "-i": true, "-J": true,
+	"-L": true, "-l": true, "-m": true, "-O": true, "-o": true, "-p": true, "-Q": true, "-R": true, "-S": true, "-W": true, "-w": true,
+}
+
+// Command masks a command line. It also learns the hosts and users the
+// command names only by position, such as ssh's destination, so they are
+// masked afterwards wherever else they appear
+func (r *Redactor) Command(line string) string {
+	for _, c := range shellparse.Parse(line) {
+		name, args, _ := c.Program()
+		switch name {
+		case "ssh", "mosh", "ping", "telnet", "sftp":
+		default:
+			continue
+		}
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			if sshValueOptions[arg] && i+1 < len(args) {
+				if arg == "-l" {
+					r.learn(Usernames, args[i+1])
+				}
+				i++
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			user, host, found := strings.Cut(arg, "@")
+			if !found {
+				user, host = "", arg
+			}
+			r.learn(Usernames, user)
+			r.learn(Hostnames, strings.TrimSuffix(host, ":"))
+			break
+		}
+	}
+	return r.Text(line)
+}
+
+var (
+	urlPattern      = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s'"<>` + "`" + `]+`)
+	userHostPattern = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9._-]*)@([A-Za-z0-9][A-Za-z0-9.-]*[A-Za-z0-9])`)
+	// remotePathPattern is the host of an scp and rsync style host:path,
+	// which unlike a URL's scheme isn't followed by //
+	remotePathPattern = regexp.MustCompile(`(^|[\s'"=])([A-Za-z0-9][A-Za-z0-9.-]*[A-Za-z0-9]):(~|/[^/]|/$)`)
+	pathPattern       = regexp.MustCompile(`(^|[\s'"=:(])(~/[^\s'"` + "`" + `;|&<>()]*|/[^/\s'"` + "`" + `;|&<>()][^\s'"` + "`" + `;|&<>()]*)`)
+	homePattern       = regexp.MustCompile(`(/home/|/Users/)([A-Za-z_][A-Za-z0-9._-]*)`)
+	ipPattern         = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	domainPattern     = regexp.MustCompile(`(?i)\b[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*\.(com|net|org|io|dev|app|cloud|co|uk|de|fr|eu|us|info|biz|internal|local|lan|corp|intra|home|localdomain)\b`)
+)
+
+// commonPaths are the directories every machine has, whose paths are left
+// as they are
+var commonPaths = []string{"/bin", "/sbin", "/usr", "/lib", "/lib64", "/dev", "/proc", "/sys", "/opt/homebrew"}
+
+// isCommonPath reports whether path is or lies in one of commonPaths
+func isCommonPath(path string) bool {
+	for _, dir := range commonPaths {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Text masks free text, such as what a command printed, and its secrets
+func (r *Redactor) Text(s string) string {
+	s = Secrets(s)
+	s = urlPattern.ReplaceAllStringFunc(s, r.maskURL)
+	s = userHostPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := userHostPattern.FindStringSubmatch(m)
+		return r.mask(Usernames, sub[1]) + "@" + r.mask(Hostnames, sub[2])
+	})
+	s = remotePathPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := remotePathPattern.FindStringSubmatch(m)
+		return sub[1] + r.mask(Hostnames, sub[2]) + ":" + sub[3]
+	})
+	if r.profile.Mask[Paths] {
+		s = pathPattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := pathPattern.FindStringSubmatch(m)
+			if isCommonPath(sub[2]) {
+				return m
+			}
+			return sub[1] + r.placeholder(Paths, sub[2])
+		})
+	}
+	s = homePattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := homePattern.FindStringSubmatch(m)
+		return sub[1] + r.mask(Usernames, sub[2])
+	})
+	if r.profile.Mask[Hostnames] {
+		s = domainPattern.ReplaceAllStringFunc(s, func(m string) string { return r.placeholder(Hostnames, m) })
+		s = ipPattern.ReplaceAllStringFunc(s, func(m string) string { return r.placeholder(Hostnames, m) })
+	}
+	return r.maskKnown(s)
+}
+
+// maskURL masks the user, host and path of a URL, as the profile says,
+// and any password in it
+func (r *Redactor) maskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	var b strings.Builder
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(r.mask(Usernames, u.User.Username()))
+		// A password is never shared, whatever the profile
+		if _, ok := u.User.Password(); ok {
+			b.WriteString(":***")
+		}
+		b.WriteString("@")
+	}
+	b.WriteString(r.mask(Hostnames, u.Hostname()))
+	if port := u.Port(); port != "" {
+		b.WriteString(":" + port)
+	}
+	path := u.EscapedPath()
+	if path != "" && path != "/" && r.profile.Mask[Paths] {
+		path = "/" + r.placeholder(Paths, path)
+	}
+	b.WriteString(path)
+	if u.RawQuery != "" {
+		b.WriteString("?" + u.RawQuery)
+	}
+	return b.String()
+}
+
+// maskKnown masks the known hosts and users wherever they appear as words
+// of their own, longest first so a host isn't masked within a longer one
+func (r *Redactor) maskKnown(s string) string {
+	values := make([]string, 0, len(r.known))
+	for v := range r.known {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	for _, v := range values {
+		if !strings.Contains(s, v) {
+			continue
+		}
+		s = replaceWord(s, v, r.placeholder(r.known[v], v))
+	}
+	return s
+}
+
+// replaceWord replaces the occurrences of word in s not joined onto other
+// letters, digits or name characters
+func replaceWord(s, word, with string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, word)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(word)
+		if (i == 0 || !isNameByte(s[i-1])) && (end == len(s) || !isNameByte(s[end])) {
+			b.WriteString(s[:i] + with)
+		} else {
+			b.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '-' || c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
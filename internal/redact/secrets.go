@@ -0,0 +1,58 @@
+package redact
+
+import "regexp"
+
+// SecretMask is what a secret is replaced with, whatever it was
+const SecretMask = "***"
+
+// secretValue is the value of an option or a variable: a quoted string or
+// a word
+const secretValue = `('[^']*'|"[^"]*"|[^\s'"]+)`
+
+// secretPatterns find secrets in commands and their output. Each match is
+// replaced with its first group and third, if it has one, around
+// SecretMask
+var secretPatterns = []*regexp.Regexp{
+	// --password=x, --api-key x, --client-secret x and the like
+	regexp.MustCompile(`(?i)((?:^|\s)--?[a-z0-9-]*(?:password|passwd|passphrase|secret|token|api-?key|access-key|secret-key)(?:=|\s+))` + secretValue),
+	// PASSWORD=x, GITHUB_TOKEN=x, AWS_SECRET_ACCESS_KEY=x and the like, as
+	// assigned or exported
+	regexp.MustCompile(`(?i)(\b[a-z0-9_]*(?:password|passwd|passphrase|secret|token|api_?key|access_key|private_key)[a-z0-9_]*=)` + secretValue),
+	// mysql -pxyz, with the password joined onto the option
+	regexp.MustCompile(`(\bmysql(?:dump|admin)?\b[^|;&\n]*?\s-p)([^\s'"]+)`),
+	// sshpass -p x
+	regexp.MustCompile(`(\bsshpass\s+-p\s*)` + secretValue),
+	// curl -u user:password
+	regexp.MustCompile(`((?:^|\s)(?:-u|--user)(?:=|\s+)['"]?[^\s:'"]+:)([^\s'"@]+)`),
+	// The password of a URL
+	regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@'"]+:)([^\s@/'"]+)(@)`),
+	// Authorization: Bearer x, and API key headers
+	regexp.MustCompile(`(?i)(\bauthorization:\s*(?:bearer|basic|token)\s+)([^\s'"]+)`),
+	regexp.MustCompile(`(?i)(\bx-api-key:\s*)([^\s'"]+)`),
+	// Tokens recognisable by their shape: AWS access keys, GitHub, GitLab,
+	// Slack, Stripe and Google API tokens, and JWTs
+	regexp.MustCompile(`()\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`()\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|glpat-[A-Za-z0-9_-]{20,})`),
+	regexp.MustCompile(`()\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`()\b[rs]k_live_[0-9a-zA-Z]{24,}`),
+	regexp.MustCompile(`()\bAIza[0-9A-Za-z_-]{35}`),
+	regexp.MustCompile(`()\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	// Private keys pasted into a command or printed
+	regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----)[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`),
+}
+
+// Secrets masks the passwords, tokens and keys in s, such as a command
+// line or what it printed. Unlike a Redactor it keeps nothing between
+// calls, so the same text is always masked the same way
+func Secrets(s string) string {
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+SecretMask+"${3}")
+	}
+	return s
+}
+
+// HasSecrets reports whether Secrets would mask anything in s not masked
+// already
+func HasSecrets(s string) bool {
+	return Secrets(s) != s
+}
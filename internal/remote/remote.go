@@ -0,0 +1,284 @@
+// Package remote ships recorded commands to a central bashlog-mgr serve
+// instance. Batches that can't be delivered, because the server is down
+// or the machine offline, are spooled to disk and sent with the next
+// delivery.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/storage"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Timeout bounds one delivery, so an unreachable server delays the end of
+// a session by no more than this
+const Timeout = 10 * time.Second
+
+// Command is one recorded command
+type Command struct {
+	Time    time.Time `json:"time,omitempty"`
+	Command string    `json:"command"`
+}
+
+// Batch is the commands of one session, sent in one request. ID lets the
+// server recognize a batch it already has when a delivery is retried
+type Batch struct {
+	ID        string `json:"id"`
+	Workspace string `json:"workspace"`
+	Host      string `json:"host,omitempty"`
+	// Origin is where the commands came from, as workspace.Origins names
+	// it, interactive when empty
+	Origin   string    `json:"origin,omitempty"`
+	Commands []Command `json:"commands"`
+}
+
+// NewBatch builds the batch for entries
+func NewBatch(id, ws, host string, entries []workspace.Entry) Batch {
+	b := Batch{ID: id, Workspace: ws, Host: host}
+	for _, e := range entries {
+		b.Commands = append(b.Commands, Command{Time: e.Time, Command: e.Command})
+	}
+	return b
+}
+
+// Entries returns the batch's commands as workspace entries
+func (b Batch) Entries() []workspace.Entry {
+	entries := make([]workspace.Entry, len(b.Commands))
+	for i, c := range b.Commands {
+		entries[i] = workspace.Entry{Command: c.Command, Time: c.Time}
+	}
+	return entries
+}
+
+// CommandsPath is where a workspace's batches are posted on the server
+func CommandsPath(ws string) string {
+	return "/api/v1/workspaces/" + url.PathEscape(ws) + "/commands"
+}
+
+// Client delivers batches to the server at URL
+type Client struct {
+	URL   string
+	Token string
+	// Spool holds batches waiting to be delivered
+	Spool string
+
+	HTTP *http.Client
+}
+
+// RejectedSuffix is added to the name of a spooled batch the server
+// refused for good, so it is kept for a look but not sent again
+const RejectedSuffix = ".rejected"
+
+// StatusError is the server answering a batch with other than 200 OK
+type StatusError struct {
+	Code   int
+	Status string
+	// Message is the error the server gave, if any
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server returned %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("server returned %s", e.Status)
+}
+
+// Retryable reports whether a batch err kept from being sent may go
+// through later: after network errors, server errors and rate limiting,
+// but not when the server refused the batch itself
+func Retryable(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+}
+
+// Send delivers b. An error means the server didn't take it, a
+// *StatusError if it answered
+func (c *Client) Send(ctx context.Context, b Batch) error {
+	body, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+CommandsPath(b.Workspace), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: Timeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(msg, &apiErr)
+		return &StatusError{Code: resp.StatusCode, Status: resp.Status, Message: apiErr.Error}
+	}
+	return nil
+}
+
+// Deliver sends whatever is spooled and then b, spooling b if it can't be
+// sent, or setting it aside as Flush does if the server refused it. It
+// returns the error that kept b from being sent, after spooling it, and
+// an error only if spooling failed too
+func (c *Client) Deliver(ctx context.Context, b Batch) (sendErr, err error) {
+	if err := c.Flush(ctx); err != nil {
+		_, spoolErr := c.spool(b)
+		return err, spoolErr
+	}
+	if err := c.Send(ctx, b); err != nil {
+		p, spoolErr := c.spool(b)
+		if spoolErr == nil && !Retryable(err) {
+			spoolErr = os.Rename(p, p+RejectedSuffix)
+		}
+		return err, spoolErr
+	}
+	return nil, nil
+}
+
+// Flush sends the spooled batches, oldest first, removing each once the
+// server has it. A batch the server refused is renamed with
+// RejectedSuffix and skipped; Flush stops at the first that can't be sent
+// for any other reason
+func (c *Client) Flush(ctx context.Context) error {
+	paths, err := filepath.Glob(filepath.Join(c.Spool, "*.json"))
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var b Batch
+		if err := json.Unmarshal(data, &b); err != nil {
+			// Not ours to send, or torn by a crash while spooling
+			os.Rename(p, p+".bad")
+			continue
+		}
+		if err := c.Send(ctx, b); err != nil {
+			if Retryable(err) {
+				return err
+			}
+			slog.Warn("server refused a spooled batch, setting it aside", "batch", p+RejectedSuffix, "err", err)
+			os.Rename(p, p+RejectedSuffix)
+			continue
+		}
+		os.Remove(p)
+	}
+	return nil
+}
+
+// Pending counts the spooled batches
+func (c *Client) Pending() int {
+	paths, _ := filepath.Glob(filepath.Join(c.Spool, "*.json"))
+	return len(paths)
+}
+
+// spool writes b to the spool, named so batches sort by when they were
+// spooled, with the permissions of fsperm.Default, and returns its path
+func (c *Client) spool(b Batch) (string, error) {
+	if err := fsperm.Default.MkdirAll(c.Spool); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s.json", time.Now().UnixNano(), sanitize(b.ID))
+	tmp := filepath.Join(c.Spool, "."+name)
+	if err := fsperm.Default.WriteFile(tmp, data); err != nil {
+		return "", err
+	}
+	p := filepath.Join(c.Spool, name)
+	return p, os.Rename(tmp, p)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// ReceivedFile lists, one per line, the IDs of the batches a workspace
+// has received, so a batch delivered twice is only recorded once
+const ReceivedFile = ".received"
+
+// receiveMu keeps two deliveries of one batch from both being recorded
+var receiveMu sync.Mutex
+
+// Receive records b into the workspace at wsPath and returns how many
+// commands were added, none when the batch was already received
+func Receive(wsPath string, b Batch) (int, error) {
+	receiveMu.Lock()
+	defer receiveMu.Unlock()
+
+	receivedPath := filepath.Join(wsPath, ReceivedFile)
+	if b.ID != "" {
+		data, err := os.ReadFile(receivedPath)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		for _, id := range strings.Split(string(data), "\n") {
+			if id == b.ID {
+				return 0, nil
+			}
+		}
+	}
+
+	entries := b.Entries()
+	if err := storage.For(wsPath).AppendRecord(wsPath, entries); err != nil {
+		return 0, err
+	}
+	if err := workspace.AddHosts(wsPath, b.Host, entries); err != nil {
+		return len(entries), err
+	}
+	if err := workspace.AddOrigins(wsPath, b.Origin, entries); err != nil {
+		return len(entries), err
+	}
+	if err := workspace.AddTransfers(wsPath, entries); err != nil {
+		return len(entries), err
+	}
+	if b.ID == "" {
+		return len(entries), nil
+	}
+	f, err := workspace.FileMode(wsPath).OpenFile(receivedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return len(entries), err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, b.ID)
+	return len(entries), err
+}
@@ -0,0 +1,292 @@
+// Package risk scores recorded commands by how much damage they could do.
+//
+// Scoring is heuristic: each simple command of a command line is matched
+// against patterns for file deletion, privilege escalation, network
+// exfiltration and package installs, and the line gets the highest level
+// any of them reaches. It is meant to draw attention to commands worth a
+// second look, not to decide what was malicious.
+package risk
+
+import (
+	"path"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// Level is how risky a command is
+type Level int
+
+const (
+	None Level = iota
+	Low
+	Medium
+	High
+)
+
+func (l Level) String() string {
+	switch l {
+	case Low:
+		return "low"
+	case Medium:
+		return "medium"
+	case High:
+		return "high"
+	}
+	return "none"
+}
+
+// Category groups the reasons a command was scored
+type Category string
+
+const (
+	Deletion   Category = "deletion"
+	Privilege  Category = "privilege"
+	Network    Category = "network"
+	Packages   Category = "packages"
+	Filesystem Category = "filesystem"
+)
+
+// Reason is one pattern a command matched
+type Reason struct {
+	Category Category
+	Level    Level
+	Message  string
+}
+
+// Score rates a command line, returning its level and why
+func Score(command string) (Level, []Reason) {
+	var reasons []Reason
+
+	cmds := shellparse.Parse(command)
+	for i, c := range cmds {
+		name, args, via := c.Program()
+		for _, w := range via {
+			if w == "sudo" || w == "doas" {
+				reasons = append(reasons, Reason{Privilege, Medium, "runs as root via " + w})
+			}
+		}
+		reasons = append(reasons, scoreProgram(name, args)...)
+		reasons = append(reasons, scoreRedirects(c.Redirects)...)
+
+		// Piping a download straight into a shell runs unreviewed code
+		if c.Op == "|" && i+1 < len(cmds) && (name == "curl" || name == "wget") {
+			next, _, _ := cmds[i+1].Program()
+			if isShell(next) {
+				reasons = append(reasons, Reason{Network, High, "pipes a download into " + next})
+			}
+		}
+	}
+
+	level := None
+	for _, r := range reasons {
+		if r.Level > level {
+			level = r.Level
+		}
+	}
+	return level, reasons
+}
+
+func scoreProgram(name string, args []string) []Reason {
+	switch name {
+	case "rm":
+		return scoreRm(args)
+	case "shred", "wipefs":
+		return []Reason{{Deletion, High, name + " destroys data"}}
+	case "mkfs", "mke2fs", "fdisk", "parted", "sfdisk":
+		return []Reason{{Filesystem, High, name + " rewrites a disk"}}
+	case "dd":
+		for _, a := range args {
+			if strings.HasPrefix(a, "of=/dev/") {
+				return []Reason{{Filesystem, High, "dd writes to a device"}}
+			}
+		}
+	case "find":
+		for _, a := range args {
+			if a == "-delete" {
+				return []Reason{{Deletion, Medium, "find -delete removes files"}}
+			}
+		}
+	case "truncate":
+		return []Reason{{Deletion, Low, "truncate discards file contents"}}
+	case "su", "visudo", "passwd", "useradd", "usermod", "userdel", "groupadd", "setcap":
+		return []Reason{{Privilege, Medium, name + " changes users or privileges"}}
+	case "chmod":
+		return scoreChmod(args)
+	case "chown":
+		if hasFlag(args, 'R') {
+			return []Reason{{Privilege, Low, "chown -R changes ownership recursively"}}
+		}
+	case "curl":
+		return scoreCurl(args)
+	case "wget":
+		for _, a := range args {
+			if strings.HasPrefix(a, "--post-file") || strings.HasPrefix(a, "--body-file") {
+				return []Reason{{Network, High, "wget uploads a file"}}
+			}
+		}
+	case "nc", "ncat", "netcat", "socat":
+		return []Reason{{Network, Medium, name + " opens a raw network connection"}}
+	case "scp", "rsync", "sftp":
+		for _, a := range args {
+			if isRemote(a) {
+				return []Reason{{Network, Medium, name + " copies files to or from another host"}}
+			}
+		}
+	default:
+		if r, ok := scorePackages(name, args); ok {
+			return []Reason{r}
+		}
+	}
+	return nil
+}
+
+func scoreRm(args []string) []Reason {
+	recursive := hasFlag(args, 'r') || hasFlag(args, 'R') || contains(args, "--recursive")
+	force := hasFlag(args, 'f') || contains(args, "--force")
+	if !recursive {
+		return []Reason{{Deletion, Low, "rm removes files"}}
+	}
+
+	for _, a := range operands(args) {
+		clean := path.Clean(a)
+		if clean == "/" || clean == "~" || clean == "/*" || clean == "*" || clean == "." || clean == ".." ||
+			a == "$HOME" || a == "${HOME}" || strings.Count(clean, "/") == 1 && strings.HasPrefix(clean, "/") {
+			return []Reason{{Deletion, High, "rm -r on " + a}}
+		}
+	}
+	if force {
+		return []Reason{{Deletion, Medium, "rm -rf removes a tree without asking"}}
+	}
+	return []Reason{{Deletion, Low, "rm -r removes a tree"}}
+}
+
+func scoreChmod(args []string) []Reason {
+	for _, a := range operands(args) {
+		switch {
+		case strings.Contains(a, "+s") || len(a) == 4 && (a[0] == '4' || a[0] == '2' || a[0] == '6'):
+			return []Reason{{Privilege, High, "chmod sets the setuid or setgid bit"}}
+		case a == "777" || a == "0777" || a == "a+rwx" || a == "o+w":
+			return []Reason{{Privilege, Medium, "chmod makes files world-writable"}}
+		}
+	}
+	return nil
+}
+
+func scoreCurl(args []string) []Reason {
+	for i, a := range args {
+		switch {
+		case a == "-T" || strings.HasPrefix(a, "--upload-file"):
+			return []Reason{{Network, High, "curl uploads a file"}}
+		case (a == "-d" || a == "--data" || a == "--data-binary" || a == "-F" || a == "--form") && i+1 < len(args):
+			v := args[i+1]
+			if strings.HasPrefix(v, "@") || strings.Contains(v, "=@") || strings.Contains(v, "=<") {
+				return []Reason{{Network, High, "curl posts a local file"}}
+			}
+		}
+	}
+	return nil
+}
+
+// installers maps package managers to the subcommands that install
+var installers = map[string][]string{
+	"apt": {"install"}, "apt-get": {"install"}, "yum": {"install"}, "dnf": {"install"},
+	"zypper": {"install", "in"}, "pacman": {"-S", "-U"}, "apk": {"add"}, "brew": {"install"},
+	"pip": {"install"}, "pip3": {"install"}, "gem": {"install"}, "cargo": {"install"},
+	"go": {"install"}, "snap": {"install"}, "npm": {"install", "i"}, "yarn": {"global"},
+	"dpkg": {"-i"}, "rpm": {"-i", "-U", "-ivh", "-Uvh"},
+}
+
+func scorePackages(name string, args []string) (Reason, bool) {
+	subs, ok := installers[name]
+	if !ok || len(args) == 0 {
+		return Reason{}, false
+	}
+
+	for _, a := range args {
+		if !contains(subs, a) {
+			continue
+		}
+		// Project-local npm installs are routine
+		if name == "npm" && !contains(args, "-g") && !contains(args, "--global") {
+			return Reason{}, false
+		}
+		return Reason{Packages, Low, name + " installs packages"}, true
+	}
+	return Reason{}, false
+}
+
+func scoreRedirects(redirects []shellparse.Redirect) []Reason {
+	for _, r := range redirects {
+		if !strings.Contains(r.Op, ">") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(r.Target, "/dev/sd") || strings.HasPrefix(r.Target, "/dev/nvme"):
+			return []Reason{{Filesystem, High, "writes to a disk device"}}
+		case r.Target == "/etc/sudoers" || strings.HasPrefix(r.Target, "/etc/sudoers.d/"):
+			return []Reason{{Privilege, High, "writes to sudoers"}}
+		case r.Target == "/etc/passwd" || r.Target == "/etc/shadow":
+			return []Reason{{Privilege, High, "writes to " + r.Target}}
+		case strings.HasPrefix(r.Target, "/dev/tcp/") || strings.HasPrefix(r.Target, "/dev/udp/"):
+			return []Reason{{Network, High, "sends data over " + r.Target}}
+		}
+	}
+	return nil
+}
+
+func isShell(name string) bool {
+	switch name {
+	case "sh", "bash", "dash", "zsh", "ksh", "python", "python3", "perl", "ruby":
+		return true
+	}
+	return false
+}
+
+// isRemote reports whether an scp or rsync operand names another host
+func isRemote(a string) bool {
+	if strings.HasPrefix(a, "-") || strings.HasPrefix(a, "/") || strings.HasPrefix(a, ".") {
+		return false
+	}
+	colon := strings.IndexByte(a, ':')
+	return colon > 0 && !strings.Contains(a[:colon], "/")
+}
+
+// hasFlag reports whether a short flag appears, alone or combined
+func hasFlag(args []string, flag byte) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], flag) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func operands(args []string) []string {
+	var out []string
+	done := false
+	for _, a := range args {
+		switch {
+		case done:
+			out = append(out, a)
+		case a == "--":
+			done = true
+		case strings.HasPrefix(a, "-") && a != "-":
+		default:
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/notify"
+)
+
+// execTimeout bounds how long an exec action may run
+const execTimeout = 30 * time.Second
+
+// Engine evaluates rules and carries out their actions
+type Engine struct {
+	Rules []*Rule
+	Sinks map[string]notify.Sink
+
+	// HitLog, when set, is the file every match is appended to
+	HitLog string
+}
+
+// NewEngine builds an engine from the rules and notification targets in
+// the settings values, logging hits to hitLog
+func NewEngine(config map[string]string, hitLog string) (*Engine, error) {
+	rules, err := Parse(config)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := notify.Targets(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		for _, target := range r.Notify {
+			if _, ok := sinks[target]; !ok {
+				return nil, fmt.Errorf("rule.%s.notify: no notification target '%s'", r.Name, target)
+			}
+		}
+	}
+	return &Engine{Rules: rules, Sinks: sinks, HitLog: hitLog}, nil
+}
+
+// Hit is a rule match as stored in the hit log
+type Hit struct {
+	Time      time.Time `json:"time"`
+	Rule      string    `json:"rule"`
+	Tag       string    `json:"tag,omitempty"`
+	Command   string    `json:"command"`
+	User      string    `json:"user,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+}
+
+// Evaluate runs every rule against every event and carries out the
+// actions of those that match. A failed action doesn't stop the others;
+// all failures are returned together
+func (e *Engine) Evaluate(ctx context.Context, events []Event) ([]Hit, error) {
+	var hits []Hit
+	var errs []error
+
+	for _, ev := range events {
+		for _, r := range e.Rules {
+			if !r.Match(ev) {
+				continue
+			}
+			slog.Debug("rule matched", "rule", r.Name, "command", ev.Command)
+
+			hit := Hit{
+				Time:      ev.Time,
+				Rule:      r.Name,
+				Tag:       r.Tag,
+				Command:   ev.Command,
+				User:      ev.User,
+				Host:      ev.Host,
+				Workspace: ev.Workspace,
+				SessionID: ev.SessionID,
+			}
+			if ev.HasExit {
+				code := ev.ExitCode
+				hit.ExitCode = &code
+			}
+			hits = append(hits, hit)
+
+			for _, target := range r.Notify {
+				if err := e.Sinks[target].Send(ctx, hitMessage(r, ev)); err != nil {
+					errs = append(errs, fmt.Errorf("rule %s: notify %s: %w", r.Name, target, err))
+				}
+			}
+			if r.Exec != "" {
+				if err := runExec(ctx, r, ev); err != nil {
+					errs = append(errs, fmt.Errorf("rule %s: exec: %w", r.Name, err))
+				}
+			}
+		}
+	}
+
+	if e.HitLog != "" && len(hits) > 0 {
+		if err := appendHits(e.HitLog, hits); err != nil {
+			errs = append(errs, fmt.Errorf("recording rule hits: %w", err))
+		}
+	}
+	return hits, errors.Join(errs...)
+}
+
+// hitMessage describes a match for notification targets
+func hitMessage(r *Rule, ev Event) notify.Message {
+	m := notify.Message{
+		Title:     "bashlog rule matched: " + r.Name,
+		Workspace: ev.Workspace,
+		Host:      ev.Host,
+		Command:   ev.Command,
+	}
+	if ev.User != "" {
+		m.Fields = append(m.Fields, notify.Field{Name: "User", Value: ev.User})
+	}
+	if ev.HasExit {
+		m.Fields = append(m.Fields, notify.Field{Name: "Exit code", Value: strconv.Itoa(ev.ExitCode)})
+	}
+	if ev.HasDuration {
+		m.Fields = append(m.Fields, notify.Field{Name: "Duration", Value: ev.Duration.Round(time.Millisecond).String()})
+	}
+	if ev.SessionID != "" {
+		m.Fields = append(m.Fields, notify.Field{Name: "Session", Value: ev.SessionID})
+	}
+	if r.Tag != "" {
+		m.Fields = append(m.Fields, notify.Field{Name: "Tag", Value: r.Tag})
+	}
+	return m
+}
+
+// runExec runs the rule's command through sh with the event in its
+// environment
+func runExec(ctx context.Context, r *Rule, ev Event) error {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", r.Exec)
+	cmd.Env = append(os.Environ(),
+		"BASHLOG_RULE="+r.Name,
+		"BASHLOG_TAG="+r.Tag,
+		"BASHLOG_COMMAND="+ev.Command,
+		"BASHLOG_USER="+ev.User,
+		"BASHLOG_HOST="+ev.Host,
+		"BASHLOG_WORKSPACE="+ev.Workspace,
+		"BASHLOG_SESSION_ID="+ev.SessionID,
+	)
+	if ev.HasExit {
+		cmd.Env = append(cmd.Env, "BASHLOG_EXIT_CODE="+strconv.Itoa(ev.ExitCode))
+	}
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		slog.Debug("rule exec output", "rule", r.Name, "output", string(out))
+	}
+	return err
+}
+
+// appendHits appends hits to the hit log as JSON lines
+func appendHits(path string, hits []Hit) error {
+	f, err := fsperm.Default.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	for _, h := range hits {
+		if err := enc.Encode(h); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// ReadHits loads the hit log at path. A missing log has no hits
+func ReadHits(path string) ([]Hit, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var hits []Hit
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var h Hit
+		if err := dec.Decode(&h); err != nil {
+			return hits, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
@@ -0,0 +1,237 @@
+// Package rules evaluates user-defined alert rules against recorded
+// commands and carries out their actions.
+//
+// Rules are read from the bashlog settings file as key=value lines:
+//
+//	rule.<name>.command=<regexp>       the command line matches
+//	rule.<name>.exit=<cond>            exit code, e.g. 1, !=0, >1
+//	rule.<name>.duration=<cond>        run time, e.g. >5m, <1s
+//	rule.<name>.user=<glob>            the user who ran it
+//	rule.<name>.workspace=<glob>       the workspace it was recorded into
+//	rule.<name>.notify=<target>,...    post to notification targets
+//	rule.<name>.exec=<shell command>   run a local command
+//	rule.<name>.tag=<tag>              tag the command in the hit log
+//	rule.<name>.terminal=bell|osc9|desktop
+//	                                   warn in the session's terminal
+//
+// A rule matches when all of its conditions do. Exit code and duration
+// conditions only match events that carry them.
+//
+// Terminal warnings are given by the session the command ran in, as soon
+// as it is back at the prompt, with a bell or an OSC 9 notification, which
+// terminals such as iTerm2, WezTerm and Windows Terminal show on the
+// desktop, or with a notification bashlog asks the desktop for itself,
+// falling back to OSC 9 where it can't, as over ssh. The other actions are
+// carried out when the session ends.
+//
+// Tag rules are a shorthand for rules whose only condition is the command
+// and whose only action is tagging it, applied when commands are recorded
+// into a workspace:
+//
+//	tag.<tag>=<regexp>                 e.g. tag.deploy=terraform apply|kubectl apply
+package rules
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a recorded command as seen by the rules engine
+type Event struct {
+	Command   string
+	Time      time.Time
+	User      string
+	Host      string
+	Workspace string
+	SessionID string
+
+	// HasExit and HasDuration are set when the recorder knows the result
+	HasExit     bool
+	ExitCode    int
+	HasDuration bool
+	Duration    time.Duration
+}
+
+// Rule is a set of conditions and the actions taken when all of them hold
+type Rule struct {
+	Name string
+
+	Command   *regexp.Regexp
+	Exit      *comparison
+	Duration  *comparison
+	User      string
+	Workspace string
+
+	Notify []string
+	Exec   string
+	Tag    string
+	// Terminal is TerminalBell, TerminalOSC9 or TerminalDesktop for a rule
+	// warning in the session's terminal
+	Terminal string
+}
+
+// Terminal warnings
+const (
+	TerminalBell    = "bell"
+	TerminalOSC9    = "osc9"
+	TerminalDesktop = "desktop"
+)
+
+// comparison is a condition such as ">5m" or "!=0" on a numeric value
+type comparison struct {
+	op    string
+	value float64
+	raw   string
+}
+
+// String returns the condition as it was written
+func (c *comparison) String() string {
+	return c.raw
+}
+
+func (c *comparison) holds(v float64) bool {
+	switch c.op {
+	case "=":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case ">":
+		return v > c.value
+	default: // ">="
+		return v >= c.value
+	}
+}
+
+// parseComparison parses an operator and a value, using parse for the
+// value. A value alone compares for equality
+func parseComparison(s string, parse func(string) (float64, error)) (*comparison, error) {
+	s = strings.TrimSpace(s)
+	raw := s
+	op := "="
+	for _, candidate := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = strings.TrimSpace(s[len(candidate):])
+			break
+		}
+	}
+	v, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &comparison{op: op, value: v, raw: raw}, nil
+}
+
+func parseExitCode(s string) (float64, error) {
+	n, err := strconv.Atoi(s)
+	return float64(n), err
+}
+
+func parseDuration(s string) (float64, error) {
+	d, err := time.ParseDuration(s)
+	return float64(d), err
+}
+
+// Parse reads the rules defined in config, ordered by name
+func Parse(config map[string]string) ([]*Rule, error) {
+	byName := make(map[string]*Rule)
+
+	for key, value := range config {
+		parts := strings.Split(key, ".")
+		if len(parts) == 2 && parts[0] == "tag" {
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			byName[key] = &Rule{Name: key, Command: re, Tag: parts[1]}
+			continue
+		}
+		if len(parts) != 3 || parts[0] != "rule" {
+			continue
+		}
+		r := byName[parts[1]]
+		if r == nil {
+			r = &Rule{Name: parts[1]}
+			byName[parts[1]] = r
+		}
+
+		var err error
+		switch parts[2] {
+		case "command":
+			r.Command, err = regexp.Compile(value)
+		case "exit":
+			r.Exit, err = parseComparison(value, parseExitCode)
+		case "duration":
+			r.Duration, err = parseComparison(value, parseDuration)
+		case "user":
+			r.User = value
+			_, err = path.Match(value, "")
+		case "workspace":
+			r.Workspace = value
+			_, err = path.Match(value, "")
+		case "notify":
+			for _, target := range strings.Split(value, ",") {
+				if target = strings.TrimSpace(target); target != "" {
+					r.Notify = append(r.Notify, target)
+				}
+			}
+		case "exec":
+			r.Exec = value
+		case "tag":
+			r.Tag = value
+		case "terminal":
+			r.Terminal = value
+			if value != TerminalBell && value != TerminalOSC9 && value != TerminalDesktop {
+				err = fmt.Errorf("unknown warning '%s' (expected %s, %s or %s)", value, TerminalBell, TerminalOSC9, TerminalDesktop)
+			}
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	rules := make([]*Rule, 0, len(byName))
+	for _, r := range byName {
+		if len(r.Notify) == 0 && r.Exec == "" && r.Tag == "" && r.Terminal == "" {
+			return nil, fmt.Errorf("rule.%s has no action (notify, exec, tag or terminal)", r.Name)
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// Match reports whether every condition of the rule holds for e
+func (r *Rule) Match(e Event) bool {
+	if r.Command != nil && !r.Command.MatchString(e.Command) {
+		return false
+	}
+	if r.Exit != nil && (!e.HasExit || !r.Exit.holds(float64(e.ExitCode))) {
+		return false
+	}
+	if r.Duration != nil && (!e.HasDuration || !r.Duration.holds(float64(e.Duration))) {
+		return false
+	}
+	if r.User != "" {
+		if ok, _ := path.Match(r.User, e.User); !ok {
+			return false
+		}
+	}
+	if r.Workspace != "" {
+		if ok, _ := path.Match(r.Workspace, e.Workspace); !ok {
+			return false
+		}
+	}
+	return true
+}
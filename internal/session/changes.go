@@ -0,0 +1,104 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What a command did to a file
+const (
+	ChangeCreated  = "created"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// Change is a file a command created, modified or deleted. Directories
+// are given with a trailing slash
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+}
+
+// CommandChanges is what one of a session's commands changed on disk.
+// Changes made before the session's first command have no Command
+type CommandChanges struct {
+	Time    time.Time
+	Command string
+	Changes []Change
+}
+
+// ChangesPath returns the file the file changes of the session described
+// by metaPath are recorded in, as "<unix-seconds>\t<json>\t<command>"
+// lines like a workspace's transfers file
+func ChangesPath(metaPath string) string {
+	return strings.TrimSuffix(metaPath, ".meta") + ".changes"
+}
+
+// MergeChange returns what a file went through overall when a change was
+// followed by another: a file created then modified was created, and one
+// deleted then created again was modified. A file created then deleted
+// wasn't changed at all, which is reported as ""
+func MergeChange(earlier, later string) string {
+	switch {
+	case earlier == ChangeCreated && later == ChangeDeleted:
+		return ""
+	case earlier == ChangeCreated:
+		return ChangeCreated
+	case earlier == ChangeDeleted && later != ChangeDeleted:
+		return ChangeModified
+	}
+	return later
+}
+
+// WriteChanges records the file changes of the session described by
+// metaPath, replacing any recorded before
+func WriteChanges(metaPath string, changes []CommandChanges) error {
+	var b strings.Builder
+	for _, c := range changes {
+		value, err := json.Marshal(c.Changes)
+		if err != nil {
+			return err
+		}
+		command := strings.ReplaceAll(c.Command, "\n", " ")
+		fmt.Fprintf(&b, "%d\t%s\t%s\n", c.Time.Unix(), value, command)
+	}
+	return writeFileAtomic(ChangesPath(metaPath), []byte(b.String()))
+}
+
+// Changes returns what the session's commands changed on disk, in the
+// order they ran. Sessions that weren't watched have no changes
+func (m *Meta) Changes() ([]CommandChanges, error) {
+	f, err := os.Open(ChangesPath(m.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var changes []CommandChanges
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		c := CommandChanges{Time: time.Unix(unix, 0), Command: parts[2]}
+		if json.Unmarshal([]byte(parts[1]), &c.Changes) != nil {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock is what was known of the machine's clock when a session was
+// recorded. Timestamps are taken from the wall clock, which NTP or an
+// admin can step; the uptime, which only ever counts forward, is kept
+// alongside so durations and orderings can be worked out regardless
+type Clock struct {
+	// Uptime is the monotonic reading the session started at, 0 where the
+	// OS gives none to the shells
+	Uptime time.Duration
+
+	// Sync is "synced" or "unsynced" as the kernel's NTP state said when
+	// the session started, empty where it can't be read. Offset is how far
+	// the clock was then still being steered, and MaxError how far off it
+	// could be
+	Sync     string
+	Offset   time.Duration
+	MaxError time.Duration
+
+	// Jump is how far the wall clock moved over the session besides the
+	// time that passed, set when the session is finalized by the recorder
+	Jump time.Duration
+}
+
+// minClockJump is the smallest difference between the wall and monotonic
+// clocks over a session recorded as a jump
+const minClockJump = 100 * time.Millisecond
+
+// ReadClock reads the machine's clock for a session starting now
+func ReadClock() Clock {
+	c := Clock{}
+	c.Uptime, _ = Uptime()
+	c.Sync, c.Offset, c.MaxError = clockSync()
+	return c
+}
+
+// Uptime reads the monotonic clock the shell hooks time commands by: the
+// time since boot in /proc/uptime, which counts suspend too, so durations
+// spanning one stay right
+func Uptime() (time.Duration, bool) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	return parseUptime(fields[0])
+}
+
+// parseUptime reads an uptime as the hooks record it, "12345.67" seconds
+// or "-" where there was none
+func parseUptime(s string) (time.Duration, bool) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// String describes the clock, as "synced, offset +0.4ms, max error 12ms"
+func (c Clock) String() string {
+	var parts []string
+	switch c.Sync {
+	case "":
+		parts = append(parts, "sync unknown")
+	case "synced":
+		parts = append(parts, "synced", fmt.Sprintf("offset %+v", c.Offset), fmt.Sprintf("max error %v", c.MaxError))
+	default:
+		parts = append(parts, "not synced by NTP")
+	}
+	if c.Uptime == 0 {
+		parts = append(parts, "no monotonic clock")
+	}
+	if c.Jump != 0 {
+		parts = append(parts, fmt.Sprintf("wall clock jumped %+v", c.Jump))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// clockJump measures how far the wall clock moved between started and
+// ended besides the time that passed, from the monotonic readings Go
+// keeps in both. It is 0 when either was read back from a file
+func clockJump(started, ended time.Time) time.Duration {
+	jump := ended.Round(0).Sub(started.Round(0)) - ended.Sub(started)
+	if jump > -minClockJump && jump < minClockJump {
+		return 0
+	}
+	return jump.Round(time.Millisecond)
+}
+
+// writeClock adds the clock's lines to session metadata
+func writeClock(b *strings.Builder, c Clock) {
+	if c.Uptime != 0 {
+		fmt.Fprintf(b, "uptime=%.2f\n", c.Uptime.Seconds())
+	}
+	if c.Sync != "" {
+		fmt.Fprintf(b, "clock_sync=%s\n", c.Sync)
+	}
+	if c.Sync == "synced" {
+		fmt.Fprintf(b, "clock_offset=%s\n", c.Offset)
+		fmt.Fprintf(b, "clock_max_error=%s\n", c.MaxError)
+	}
+	if c.Jump != 0 {
+		fmt.Fprintf(b, "clock_jump=%s\n", c.Jump)
+	}
+}
+
+// readClock reads the clock's lines back from session metadata
+func readClock(values map[string]string) Clock {
+	c := Clock{Sync: values["clock_sync"]}
+	c.Uptime, _ = parseUptime(values["uptime"])
+	c.Offset, _ = time.ParseDuration(values["clock_offset"])
+	c.MaxError, _ = time.ParseDuration(values["clock_max_error"])
+	c.Jump, _ = time.ParseDuration(values["clock_jump"])
+	return c
+}
@@ -0,0 +1,31 @@
+package session
+
+import (
+	"syscall"
+	"time"
+)
+
+// The adjtimex status bits read
+const (
+	staUnsync = 0x40
+	staNano   = 0x2000
+)
+
+// clockSync asks the kernel how NTP is keeping the clock, as chrony, ntpd
+// and systemd-timesyncd leave it
+func clockSync() (sync string, offset, maxError time.Duration) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return "", 0, 0
+	}
+	// TIME_ERROR, the clock isn't synchronised
+	if state == 5 || tx.Status&staUnsync != 0 {
+		return "unsynced", 0, 0
+	}
+	offset = time.Duration(tx.Offset) * time.Microsecond
+	if tx.Status&staNano != 0 {
+		offset = time.Duration(tx.Offset)
+	}
+	return "synced", offset, time.Duration(tx.Maxerror) * time.Microsecond
+}
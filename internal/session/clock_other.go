@@ -0,0 +1,10 @@
+//go:build !linux
+
+package session
+
+import "time"
+
+// clockSync can't tell how the clock is kept outside Linux
+func clockSync() (sync string, offset, maxError time.Duration) {
+	return "", 0, 0
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// HistoryFile returns the file the session's commands were recorded to:
+// its own history segment, or for sessions recorded before each had one,
+// the history file shared by the shell's sessions that day
+func (m *Meta) HistoryFile() string {
+	shared := filepath.Join(filepath.Dir(m.Path), "."+m.Shell+"_history")
+	own := shared + "." + m.SessionID
+	if _, err := os.Stat(own); err == nil {
+		return own
+	}
+	return shared
+}
+
+// Commands returns the commands recorded during the session. Those in a
+// shared history file are picked from it by time
+func (m *Meta) Commands() ([]workspace.Entry, error) {
+	path := m.HistoryFile()
+	entries, err := workspace.ReadHistory(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if filepath.Base(path) != "."+m.Shell+"_history" {
+		return workspace.FillTimestamps(entries, m.Started), nil
+	}
+
+	end := m.Ended
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := m.Started.Truncate(time.Second)
+
+	var commands []workspace.Entry
+	for _, e := range entries {
+		if e.Time.IsZero() || e.Time.Before(start) || e.Time.After(end) {
+			continue
+		}
+		commands = append(commands, e)
+	}
+	return commands, nil
+}
+
+// ReadHistory returns the commands of every session recorded under root,
+// merging the sessions' history segments, and the shared files of older
+// sessions, into one history ordered by time
+func ReadHistory(root string) ([]workspace.Entry, error) {
+	paths, err := HistoryFiles(root)
+	var entries []workspace.Entry
+	for _, path := range paths {
+		found, err := workspace.ReadHistory(path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, found...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, err
+}
+
+// HistoryFiles returns the history segments, and the shared files of older
+// sessions, of every session recorded under root
+func HistoryFiles(root string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && isHistorySegment(d.Name()) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// isHistorySegment reports whether a file in a day's logs holds commands
+// in bash history format, as opposed to a shell's own history, such as
+// zsh's .native file, or the bookkeeping of the hooks
+func isHistorySegment(name string) bool {
+	if !strings.HasPrefix(name, ".") || !strings.Contains(name, "_history") {
+		return false
+	}
+	for _, ext := range []string{".native", ".seq", ".status", ".start", ".sources"} {
+		if strings.HasSuffix(name, ext) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Connection is an outbound connection a session's commands made, as far
+// as sampling the system's sockets caught it
+type Connection struct {
+	// Proto is tcp or udp, Remote the address and port connected to, and
+	// Process the command that held the socket when it was first seen
+	Proto   string
+	Remote  string
+	Process string
+}
+
+func (c Connection) String() string {
+	return fmt.Sprintf("%s %s %s", c.Proto, c.Remote, c.Process)
+}
+
+// formatEgress joins connections into the single line the metadata file
+// keeps them on
+func formatEgress(conns []Connection) string {
+	parts := make([]string, len(conns))
+	for i, c := range conns {
+		parts[i] = strings.ReplaceAll(c.String(), ",", "_")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseEgress reads the connections formatEgress wrote
+func parseEgress(line string) []Connection {
+	var conns []Connection
+	for _, part := range strings.Split(line, ",") {
+		fields := strings.Fields(part)
+		if len(fields) < 2 {
+			continue
+		}
+		c := Connection{Proto: fields[0], Remote: fields[1]}
+		if len(fields) > 2 {
+			c.Process = strings.Join(fields[2:], " ")
+		}
+		conns = append(conns, c)
+	}
+	return conns
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Escalation is a privileged shell started from a session with sudo or su.
+// The shell is recorded as a child session of its own, by the user it runs
+// as and so possibly out of reach of the session that started it, which
+// is why the session keeps a note of it too
+type Escalation struct {
+	Time time.Time
+	// User is who the shell runs as and Method how it was started, such
+	// as "sudo -i"
+	User   string
+	Method string
+}
+
+// EscalationsPath returns the file the escalations of the session
+// described by metaPath are noted in
+func EscalationsPath(metaPath string) string {
+	return strings.TrimSuffix(metaPath, ".meta") + ".escalations"
+}
+
+// RecordEscalation notes e against the session described by metaPath
+func RecordEscalation(metaPath string, e Escalation) error {
+	f, err := fsperm.Default.OpenFile(EscalationsPath(metaPath), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d\t%s\t%s\n", e.Time.Unix(), e.User, e.Method); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Escalations returns the privileged shells the session started, oldest
+// first
+func (m *Meta) Escalations() ([]Escalation, error) {
+	f, err := os.Open(EscalationsPath(m.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var escalations []Escalation
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		escalations = append(escalations, Escalation{Time: time.Unix(unix, 0), User: parts[1], Method: parts[2]})
+	}
+	return escalations, scanner.Err()
+}
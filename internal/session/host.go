@@ -0,0 +1,76 @@
+package session
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Host identifies the machine a session was recorded on, so workspaces
+// synced from several machines can be told apart
+type Host struct {
+	Name string
+
+	// MachineID is the stable ID the OS gives the machine, which survives
+	// renaming it. Empty where it can't be read
+	MachineID string
+
+	// OS describes the operating system, e.g. "linux/amd64 Ubuntu 24.04 LTS"
+	OS string
+}
+
+// CurrentHost describes the machine bashlog is running on
+func CurrentHost() Host {
+	name, _ := os.Hostname()
+	return Host{Name: name, MachineID: machineID(), OS: osDescription()}
+}
+
+// machineID reads the systemd/D-Bus machine ID, or on macOS the hardware
+// UUID
+func machineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+
+	if runtime.GOOS == "darwin" {
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return ""
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if _, value, ok := strings.Cut(line, `"IOPlatformUUID" = `); ok {
+				return strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return ""
+}
+
+// osDescription is GOOS/GOARCH followed by the distribution's name where
+// /etc/os-release gives one
+func osDescription() string {
+	desc := runtime.GOOS + "/" + runtime.GOARCH
+
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return desc
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+			if value = strings.Trim(value, `"'`); value != "" {
+				desc += " " + value
+			}
+			break
+		}
+	}
+	return desc
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// crockford is the alphabet of session IDs, Crockford's base32, which
+// leaves out letters easily misread as digits
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idLength is the length of a session ID
+const idLength = 26
+
+// NewID returns a new session ID, a ULID: the millisecond t falls in
+// followed by 80 random bits, as 26 characters of base32. IDs sort by
+// when the sessions started, sessions started in the same second get
+// different ones, and they need no quoting in file names
+func NewID(t time.Time) (string, error) {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits take 26 characters of 5 bits, with 2 bits to spare at the
+	// front
+	id := make([]byte, idLength)
+	for i := range id {
+		var v byte
+		for bit := i*5 - 2; bit < i*5+3; bit++ {
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		id[i] = crockford[v]
+	}
+	return string(id), nil
+}
+
+// IsID reports whether s is a session ID as NewID makes them. Sessions
+// recorded before had IDs such as session_2024-05-01_14:03:22
+func IsID(s string) bool {
+	if len(s) != idLength || s[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(crockford, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IDTime returns the time the session with ID id started at, to the
+// millisecond
+func IDTime(id string) (time.Time, bool) {
+	if !IsID(id) {
+		return time.Time{}, false
+	}
+	var ms int64
+	for i := 0; i < 10; i++ {
+		ms = ms<<5 | int64(strings.IndexByte(crockford, id[i]))
+	}
+	return time.UnixMilli(ms), true
+}
+
+// NewAlias returns a name for a session started at the date and clock
+// time given, such as 2024-05-01-140322, that is easier to read and type
+// than its ID. Aliases only need to be unique among a day's sessions, in
+// dir, so the second started in a second gets 2024-05-01-140322-2. Two
+// started at once may still share one, and are then told apart by ID
+func NewAlias(dir, date, clock string) string {
+	base := date + "-" + strings.ReplaceAll(clock, ":", "")
+	taken := make(map[string]bool)
+	if metas, err := ListMeta(dir); err == nil {
+		for _, m := range metas {
+			taken[m.Alias] = true
+		}
+	}
+	alias := base
+	for n := 2; taken[alias]; n++ {
+		alias = fmt.Sprintf("%s-%d", base, n)
+	}
+	return alias
+}
+
+// MetaPath returns the file the metadata of the session with ID id is
+// kept in, in dir. The session's other files share its name
+func MetaPath(dir, id string) string {
+	return filepath.Join(dir, id+".meta")
+}
+
+// isSessionFile reports whether a file in a day's logs is one of a
+// session's files, named by its ID, or by the time it started for
+// sessions recorded before they had IDs
+func isSessionFile(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasPrefix(name, "session_") || IsID(base)
+}
+
+// Name returns what the session is listed as: its alias, or its ID for
+// sessions recorded before they had one
+func (m *Meta) Name() string {
+	if m.Alias != "" {
+		return m.Alias
+	}
+	return m.SessionID
+}
+
+// Matches reports whether ref names the session: its ID, in either case,
+// or alias, or a prefix of either, or for older sessions, their ID with or
+// without "session_" and the date, or the time in their file name. Exact
+// is set when ref is the whole ID or alias
+func (m *Meta) Matches(ref string) (match, exact bool) {
+	if ref == "" {
+		return false, false
+	}
+	if IsID(m.SessionID) {
+		ref = strings.ToUpper(ref)
+	}
+	if ref == m.SessionID || ref == m.Alias {
+		return true, true
+	}
+	names := []string{m.SessionID, m.Alias, strings.TrimPrefix(m.SessionID, "session_")}
+	if m.Path != "" {
+		names = append(names, strings.TrimPrefix(strings.TrimSuffix(filepath.Base(m.Path), ".meta"), "session_"))
+	}
+	for _, name := range names {
+		if name != "" && strings.HasPrefix(name, ref) {
+			return true, false
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Journal is the write-ahead log of a running session. It exists from the
+// moment a session starts until its final metadata has been written, so a
+// journal left behind marks a session whose recorder did not finish.
+type Journal struct {
+	path string
+	f    *os.File
+}
+
+// JournalPath returns the journal path belonging to a metadata file
+func JournalPath(metaPath string) string {
+	return strings.TrimSuffix(metaPath, ".meta") + ".journal"
+}
+
+// CreateJournal starts the journal for the session described by metaPath,
+// recording the recorder's process ID
+func CreateJournal(metaPath string) (*Journal, error) {
+	path := JournalPath(metaPath)
+	f, err := fsperm.Default.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{path: path, f: f}
+	if err := j.Record("started", fmt.Sprintf("pid=%d", os.Getpid())); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Record appends an event to the journal and syncs it to disk
+func (j *Journal) Record(event, detail string) error {
+	line := time.Now().Format(time.RFC3339Nano) + " " + event
+	if detail != "" {
+		line += " " + detail
+	}
+	if _, err := fmt.Fprintln(j.f, line); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Remove closes and deletes the journal once the session is finalized
+func (j *Journal) Remove() error {
+	j.f.Close()
+	return os.Remove(j.path)
+}
+
+// journalState is what a journal tells about a session
+type journalState struct {
+	pid       int
+	lastEvent time.Time
+	// signal is the last signal the recorder reported receiving
+	signal string
+}
+
+func readJournal(path string) (journalState, error) {
+	var state journalState
+
+	f, err := os.Open(path)
+	if err != nil {
+		return state, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			// A torn final line from a crash mid-write
+			continue
+		}
+
+		if ts, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+			state.lastEvent = ts
+		}
+
+		switch fields[1] {
+		case "started":
+			for _, kv := range fields[2:] {
+				if v, ok := strings.CutPrefix(kv, "pid="); ok {
+					state.pid, _ = strconv.Atoi(v)
+				}
+			}
+		case "signal":
+			if len(fields) > 2 {
+				state.signal = strings.Join(fields[2:], " ")
+			}
+		}
+	}
+
+	return state, scanner.Err()
+}
+
+// lastActivity returns the latest modification time among the files of
+// the session whose metadata is at metaPath
+func lastActivity(metaPath string) time.Time {
+	var latest time.Time
+	prefix := strings.TrimSuffix(metaPath, ".meta")
+	matches, _ := filepath.Glob(prefix + ".*")
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
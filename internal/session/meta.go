@@ -0,0 +1,262 @@
+// Package session manages the metadata bashlog keeps for each recorded
+// session and its crash recovery journal.
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Meta describes a recorded session. It is stored as key=value lines, like
+// workspace config files.
+type Meta struct {
+	// SessionID is a ULID, as NewID makes them, and Alias a name for the
+	// session that is easier to read, as NewAlias makes them
+	SessionID    string
+	Alias        string
+	Shell        string
+	ShellVersion string
+	Started      time.Time
+	PTY          bool
+	InputCapture string
+
+	// Host is the machine the session was recorded on, and User who it
+	// was recorded as
+	Host Host
+	User string
+
+	ParentSessionID string
+	Depth           int
+
+	// EscalatedFrom is the user whose session started this one with
+	// Escalation, such as "sudo -i" or "su -"
+	EscalatedFrom string
+	Escalation    string
+
+	// Terminal is the terminal the session was started in. Later changes
+	// to it are in TerminalEvents
+	Terminal Terminal
+
+	// Workspace is the bashlog-mgr workspace the session records into
+	Workspace string
+
+	// Egress is the outbound connections the session's commands made,
+	// when they were watched for
+	Egress []Connection
+
+	// WatchedDir is the directory tree whose file changes were recorded,
+	// when they were watched for
+	WatchedDir string
+
+	// Clock is what was known of the machine's clock, for telling when the
+	// session's commands ran despite it jumping
+	Clock Clock
+
+	// Set once the session has been finalized
+	Ended      time.Time
+	Duration   time.Duration
+	ExitStatus int
+	EndReason  string
+
+	// Path is the file the metadata was read from. It isn't stored
+	Path string
+}
+
+// Finished reports whether the session has been finalized
+func (m *Meta) Finished() bool {
+	return !m.Ended.IsZero()
+}
+
+// Finish records the end of the session. While Started still holds its
+// monotonic reading, the duration is measured by it, and how far the wall
+// clock jumped meanwhile kept in Clock
+func (m *Meta) Finish(ended time.Time, status int, reason string) {
+	m.Ended = ended
+	m.Clock.Jump = clockJump(m.Started, ended)
+	m.Duration = ended.Sub(m.Started).Round(time.Second)
+	m.ExitStatus = status
+	m.EndReason = reason
+}
+
+// Write stores the metadata at path, replacing the file atomically so that
+// a crash never leaves it half-written
+func (m *Meta) Write(path string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "session_id=%s\n", m.SessionID)
+	if m.Alias != "" {
+		fmt.Fprintf(&b, "alias=%s\n", m.Alias)
+	}
+	fmt.Fprintf(&b, "shell=%s\n", m.Shell)
+	fmt.Fprintf(&b, "shell_version=%s\n", m.ShellVersion)
+	fmt.Fprintf(&b, "started=%s\n", m.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "pty=%t\n", m.PTY)
+	fmt.Fprintf(&b, "input_capture=%s\n", m.InputCapture)
+	fmt.Fprintf(&b, "host=%s\n", m.Host.Name)
+	fmt.Fprintf(&b, "machine_id=%s\n", m.Host.MachineID)
+	fmt.Fprintf(&b, "os=%s\n", m.Host.OS)
+	if m.User != "" {
+		fmt.Fprintf(&b, "user=%s\n", m.User)
+	}
+	if m.ParentSessionID != "" {
+		fmt.Fprintf(&b, "parent_session_id=%s\n", m.ParentSessionID)
+		fmt.Fprintf(&b, "depth=%d\n", m.Depth)
+	}
+	if m.EscalatedFrom != "" {
+		fmt.Fprintf(&b, "escalated_from=%s\n", m.EscalatedFrom)
+		fmt.Fprintf(&b, "escalation=%s\n", m.Escalation)
+	}
+	if m.Terminal.Term != "" {
+		fmt.Fprintf(&b, "term=%s\n", m.Terminal.Term)
+	}
+	if m.Terminal.Program != "" {
+		fmt.Fprintf(&b, "terminal=%s\n", m.Terminal.Program)
+	}
+	if size := m.Terminal.Size(); size != "" {
+		fmt.Fprintf(&b, "window=%s\n", size)
+	}
+	if m.Terminal.Multiplexer != "" {
+		fmt.Fprintf(&b, "multiplexer=%s\n", m.Terminal.Multiplexer)
+	}
+	if m.Workspace != "" {
+		fmt.Fprintf(&b, "workspace=%s\n", m.Workspace)
+	}
+	if m.WatchedDir != "" {
+		fmt.Fprintf(&b, "watched_dir=%s\n", m.WatchedDir)
+	}
+	if len(m.Egress) > 0 {
+		fmt.Fprintf(&b, "egress=%s\n", formatEgress(m.Egress))
+	}
+	writeClock(&b, m.Clock)
+	if m.Finished() {
+		fmt.Fprintf(&b, "ended=%s\n", m.Ended.Format(time.RFC3339))
+		fmt.Fprintf(&b, "duration=%s\n", m.Duration)
+		fmt.Fprintf(&b, "exit_status=%d\n", m.ExitStatus)
+		fmt.Fprintf(&b, "end_reason=%s\n", m.EndReason)
+	}
+
+	return writeFileAtomic(path, []byte(b.String()))
+}
+
+// ReadMeta loads session metadata from path
+func ReadMeta(path string) (*Meta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	m := &Meta{
+		SessionID:       values["session_id"],
+		Alias:           values["alias"],
+		Shell:           values["shell"],
+		ShellVersion:    values["shell_version"],
+		InputCapture:    values["input_capture"],
+		User:            values["user"],
+		ParentSessionID: values["parent_session_id"],
+		EscalatedFrom:   values["escalated_from"],
+		Escalation:      values["escalation"],
+		EndReason:       values["end_reason"],
+		Workspace:       values["workspace"],
+		WatchedDir:      values["watched_dir"],
+		Host: Host{
+			Name:      values["host"],
+			MachineID: values["machine_id"],
+			OS:        values["os"],
+		},
+		Terminal: Terminal{
+			Term:        values["term"],
+			Program:     values["terminal"],
+			Multiplexer: values["multiplexer"],
+		},
+		Path: path,
+	}
+	fmt.Sscanf(values["window"], "%dx%d", &m.Terminal.Cols, &m.Terminal.Rows)
+	m.Egress = parseEgress(values["egress"])
+	m.Clock = readClock(values)
+	m.Started, _ = time.Parse(time.RFC3339, values["started"])
+	m.Ended, _ = time.Parse(time.RFC3339, values["ended"])
+	m.Duration, _ = time.ParseDuration(values["duration"])
+	m.PTY, _ = strconv.ParseBool(values["pty"])
+	m.Depth, _ = strconv.Atoi(values["depth"])
+	m.ExitStatus, _ = strconv.Atoi(values["exit_status"])
+
+	return m, nil
+}
+
+// ListMeta loads the metadata of every session recorded under root, in
+// no particular order. Unreadable files are skipped
+func ListMeta(root string) ([]*Meta, error) {
+	var metas []*Meta
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".meta" {
+			return nil
+		}
+		if m, err := ReadMeta(path); err == nil {
+			metas = append(metas, m)
+		}
+		return nil
+	})
+
+	return metas, err
+}
+
+// Transcript returns the file holding the session's terminal output, which
+// is only recorded in PTY mode, and whether it exists. A compressed
+// transcript ends in .gz
+func (m *Meta) Transcript() (string, bool) {
+	base := strings.TrimSuffix(m.Path, ".meta")
+	for _, p := range []string{base + ".log", base + ".log.gz"} {
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it
+// and renames it into place, with the permissions of fsperm.Default
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fsperm.Default.File); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package session
+
+import "os"
+
+// processAlive reports whether a process with the given ID exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
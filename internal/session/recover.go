@@ -0,0 +1,153 @@
+package session
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Orphan is a session whose recorder exited without finalizing it
+type Orphan struct {
+	MetaPath string
+	Meta     *Meta
+	PID      int
+
+	// Ended is the best estimate of when the session ended: its last
+	// journal entry or file modification, whichever is later
+	Ended time.Time
+
+	// Reason is the signal reported in the journal, or "crashed"
+	Reason string
+}
+
+// FindOrphans walks root for sessions that still have a journal although
+// their recorder is no longer running
+func FindOrphans(root string) ([]Orphan, error) {
+	var orphans []Orphan
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".journal") {
+			return nil
+		}
+
+		state, err := readJournal(path)
+		if err != nil {
+			return err
+		}
+		if state.pid != 0 && processAlive(state.pid) {
+			return nil
+		}
+
+		metaPath := strings.TrimSuffix(path, ".journal") + ".meta"
+		meta, err := ReadMeta(metaPath)
+		if err != nil {
+			return fmt.Errorf("session journal %s has no readable metadata: %w", path, err)
+		}
+
+		ended := lastActivity(metaPath)
+		if state.lastEvent.After(ended) {
+			ended = state.lastEvent
+		}
+
+		reason := "crashed"
+		if state.signal != "" {
+			reason = state.signal
+		}
+
+		orphans = append(orphans, Orphan{
+			MetaPath: metaPath,
+			Meta:     meta,
+			PID:      state.pid,
+			Ended:    ended,
+			Reason:   reason,
+		})
+		return nil
+	})
+
+	return orphans, err
+}
+
+// Finalize writes the orphan's end metadata and removes its journal. The
+// shell's exit status is unknown, so it is recorded as -1.
+func (o Orphan) Finalize() error {
+	if !o.Meta.Finished() {
+		o.Meta.Finish(o.Ended, -1, o.Reason)
+		if err := o.Meta.Write(o.MetaPath); err != nil {
+			return err
+		}
+	}
+	return os.Remove(JournalPath(o.MetaPath))
+}
+
+// Stray is a session file without the metadata that should accompany it,
+// such as a transcript left by a recorder that failed early
+type Stray struct {
+	Path     string
+	MetaPath string
+}
+
+// FindStrays walks root for session transcripts and input logs with no
+// metadata file
+func FindStrays(root string) ([]Stray, error) {
+	var strays []Stray
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		ext := filepath.Ext(path)
+		if d.IsDir() || (ext != ".log" && ext != ".input") || !isSessionFile(d.Name()) {
+			return nil
+		}
+
+		metaPath := strings.TrimSuffix(path, ext) + ".meta"
+		if _, err := os.Stat(metaPath); os.IsNotExist(err) {
+			strays = append(strays, Stray{Path: path, MetaPath: metaPath})
+		}
+		return nil
+	})
+
+	return strays, err
+}
+
+// Recover writes metadata for the stray session, reconstructed from its
+// file times and its location under logs/<date>/<id>.*, where the ID
+// gives when it started, or for older sessions logs/<date>/session_<time>.*
+func (s Stray) Recover() error {
+	date := filepath.Base(filepath.Dir(s.Path))
+	name := strings.TrimSuffix(filepath.Base(s.MetaPath), ".meta")
+
+	meta := &Meta{SessionID: name}
+	if started, ok := IDTime(name); ok {
+		meta.Started = started
+		meta.Alias = NewAlias(filepath.Dir(s.Path), date, started.Local().Format("15:04:05"))
+	} else {
+		clock := strings.TrimPrefix(name, "session_")
+		meta.SessionID = fmt.Sprintf("session_%s_%s", date, clock)
+		if started, err := time.ParseInLocation("2006-01-02 15:04:05", date+" "+clock, time.Local); err == nil {
+			meta.Started = started
+		}
+	}
+	if _, err := os.Stat(strings.TrimSuffix(s.MetaPath, ".meta") + ".log"); err == nil {
+		meta.PTY = true
+	}
+	ended := lastActivity(s.MetaPath)
+	if meta.Started.IsZero() || ended.Before(meta.Started) {
+		meta.Started = ended
+	}
+	meta.Finish(ended, -1, "recovered")
+
+	return meta.Write(s.MetaPath)
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// SourcedCommand is a command a sourced file or a function ran rather than
+// one typed at the prompt, as the bash hook's DEBUG trap records them with
+// bashlog --sources
+type SourcedCommand struct {
+	Time    time.Time
+	Command string
+
+	// File and Line are where the command is, or for a function's
+	// commands, where the function is defined
+	File string
+	Line int
+	// Func is the function the command ran in, "source" for the top level
+	// of a sourced file
+	Func string
+}
+
+// Location returns where the command came from, as file:line
+func (c SourcedCommand) Location() string {
+	if c.Line == 0 {
+		return c.File
+	}
+	return c.File + ":" + strconv.Itoa(c.Line)
+}
+
+// Entry returns the command as a history entry
+func (c SourcedCommand) Entry() workspace.Entry {
+	return workspace.Entry{Command: c.Command, Time: c.Time}
+}
+
+// SourcesPath returns the file the bash hook records the commands of a
+// session's sourced files and functions to, as "<unix-seconds>\t<file>\t
+// <line>\t<function>\t<command>" lines
+func SourcesPath(histFile string) string {
+	return histFile + ".sources"
+}
+
+// ReadSources loads the sourced commands recorded beside histFile, oldest
+// first, skipping lines it can't read, such as one cut short by a crash
+func ReadSources(histFile string) ([]SourcedCommand, error) {
+	f, err := os.Open(SourcesPath(histFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sourced []SourcedCommand
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(parts) != 5 || strings.TrimSpace(parts[4]) == "" {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		line, _ := strconv.Atoi(parts[2])
+		sourced = append(sourced, SourcedCommand{
+			Time:    time.Unix(unix, 0),
+			Command: parts[4],
+			File:    parts[1],
+			Line:    line,
+			Func:    parts[3],
+		})
+	}
+	return sourced, scanner.Err()
+}
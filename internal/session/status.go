@@ -0,0 +1,146 @@
+package session
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// CommandStatus is how a command typed in a session ended, as the shell's
+// prompt hook saw it: its exit status, and the directory it ran in. Only
+// the bash, zsh and fish hooks record them
+type CommandStatus struct {
+	Time   time.Time
+	Status int
+	Dir    string
+
+	// Start and End are the uptimes the command started and ended at, 0
+	// where the hooks couldn't read them, as Clock.Uptime is for the
+	// session
+	Start time.Duration
+	End   time.Duration
+}
+
+// Elapsed returns how long the command ran by the monotonic clock, when
+// the hooks timed it
+func (s *CommandStatus) Elapsed() (time.Duration, bool) {
+	if s.Start == 0 || s.End < s.Start {
+		return 0, false
+	}
+	return s.End - s.Start, true
+}
+
+// Offset returns how far into the session described by m the command
+// started by the monotonic clock, when both were timed by it
+func (s *CommandStatus) Offset(m *Meta) (time.Duration, bool) {
+	if s.Start == 0 || m.Clock.Uptime == 0 || s.Start < m.Clock.Uptime {
+		return 0, false
+	}
+	return s.Start - m.Clock.Uptime, true
+}
+
+// StatusPath returns the file the hooks record the statuses of the
+// commands in a session's history file to, as
+// "<unix-seconds>\t<status>\t<start>\t<end>\t<directory>" lines, start
+// and end being uptimes or "-". Older hooks left out start and end
+func StatusPath(histFile string) string {
+	return histFile + ".status"
+}
+
+// StartPath returns the file the bash hook notes the uptime a command
+// started at in, for the prompt after it to read
+func StartPath(histFile string) string {
+	return histFile + ".start"
+}
+
+// ReadStatuses loads the statuses recorded for the commands in histFile,
+// oldest first
+func ReadStatuses(histFile string) ([]CommandStatus, error) {
+	f, err := os.Open(StatusPath(histFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var statuses []CommandStatus
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if s, ok := parseStatus(scanner.Text()); ok {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses, scanner.Err()
+}
+
+// parseStatus reads a line of a status file, in either format
+func parseStatus(line string) (CommandStatus, bool) {
+	parts := strings.SplitN(line, "\t", 3)
+	if len(parts) != 3 {
+		return CommandStatus{}, false
+	}
+	unix, err1 := strconv.ParseInt(parts[0], 10, 64)
+	status, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return CommandStatus{}, false
+	}
+	s := CommandStatus{Time: time.Unix(unix, 0), Status: status, Dir: parts[2]}
+
+	// The uptimes come before the directory, which an older line has
+	// straight after the status
+	timed := strings.SplitN(parts[2], "\t", 3)
+	if len(timed) == 3 && isUptime(timed[0]) && isUptime(timed[1]) {
+		s.Start, _ = parseUptime(timed[0])
+		s.End, _ = parseUptime(timed[1])
+		s.Dir = timed[2]
+	}
+	return s, true
+}
+
+// isUptime reports whether s is an uptime field of a status line
+func isUptime(s string) bool {
+	if s == "-" {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// MatchStatuses pairs entries with their statuses by the second each
+// started in, returning one status per entry, nil where none was
+// recorded
+func MatchStatuses(entries []workspace.Entry, statuses []CommandStatus) []*CommandStatus {
+	bySecond := make(map[int64][]*CommandStatus)
+	for i := range statuses {
+		unix := statuses[i].Time.Unix()
+		bySecond[unix] = append(bySecond[unix], &statuses[i])
+	}
+	matched := make([]*CommandStatus, len(entries))
+	for i, e := range entries {
+		if queue := bySecond[e.Time.Unix()]; len(queue) > 0 {
+			matched[i], bySecond[e.Time.Unix()] = queue[0], queue[1:]
+		}
+	}
+	return matched
+}
+
+// SummaryPath returns the file the summary printed when the session
+// described by metaPath ended is kept in
+func SummaryPath(metaPath string) string {
+	return strings.TrimSuffix(metaPath, ".meta") + ".summary"
+}
+
+// Summary returns the summary printed when the session ended, if one was
+func (m *Meta) Summary() (string, bool) {
+	data, err := os.ReadFile(SummaryPath(m.Path))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Terminal is the terminal a session was started in
+type Terminal struct {
+	// Term is $TERM, and Program the terminal emulator, as far as its
+	// environment tells
+	Term    string
+	Program string
+	// Cols and Rows are the window size, when started on a terminal
+	Cols, Rows int
+	// Multiplexer is the tmux, screen or zellij pane the session ran in,
+	// such as "tmux main:1.0"
+	Multiplexer string
+}
+
+// Size formats the window size as COLSxROWS, or "" when it isn't known
+func (t Terminal) Size() string {
+	if t.Cols == 0 || t.Rows == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", t.Cols, t.Rows)
+}
+
+// String describes the terminal, as in "xterm-256color, 120x40, tmux
+// main:1.0"
+func (t Terminal) String() string {
+	var parts []string
+	for _, part := range []string{t.Term, t.Size(), t.Program, t.Multiplexer} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// What changed about a session's terminal
+const (
+	TerminalResized = "size"
+	TerminalTitle   = "title"
+)
+
+// TerminalEvent is a change to the terminal during a session: the window
+// resized to a COLSxROWS Value, or a program setting its title
+type TerminalEvent struct {
+	Time  time.Time
+	Kind  string
+	Value string
+}
+
+// TerminalPath returns the file the terminal changes of the session
+// described by metaPath are recorded in
+func TerminalPath(metaPath string) string {
+	return strings.TrimSuffix(metaPath, ".meta") + ".terminal"
+}
+
+// RecordTerminal appends e to the terminal changes of the session
+// described by metaPath
+func RecordTerminal(metaPath string, e TerminalEvent) error {
+	f, err := fsperm.Default.OpenFile(TerminalPath(metaPath), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	value := strings.NewReplacer("\n", " ", "\r", " ").Replace(e.Value)
+	if _, err := fmt.Fprintf(f, "%s %s %s\n", e.Time.Format(time.RFC3339Nano), e.Kind, value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// TerminalEvents returns the changes to the session's terminal, oldest
+// first
+func (m *Meta) TerminalEvents() ([]TerminalEvent, error) {
+	f, err := os.Open(TerminalPath(m.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []TerminalEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			continue
+		}
+		e := TerminalEvent{Time: t, Kind: parts[1]}
+		if len(parts) == 3 {
+			e.Value = parts[2]
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,216 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+func init() {
+	Register(bashAdapter{})
+}
+
+type bashAdapter struct{}
+
+func (bashAdapter) Name() string { return "bash" }
+
+func (bashAdapter) DetectVersion(binary string) (string, error) {
+	return versionFromVariable(binary, `echo "$BASH_VERSION"`)
+}
+
+func (bashAdapter) InitFileName() string { return "bashlog.rc" }
+
+func (bashAdapter) GenerateInit(opts InitOptions) (string, error) {
+	return fmt.Sprintf(`# Bashlog RC Configuration
+# Generated at %s
+
+%s
+# Timezone setting
+export BASHLOG_TIMEZONE=%s
+
+# Logging directory
+export BASHLOG_LOG_DIR=%s
+
+# Session ID
+export BASHLOG_SESSION_ID=%s
+
+# Enable logging
+export BASHLOG_ENABLED=1
+
+# Log history
+export BASHLOG_HISTFILE=%s
+export HISTFILE="$BASHLOG_HISTFILE"
+export HISTSIZE=10000
+export HISTFILESIZE=10000
+export HISTTIMEFORMAT="%%F %%T "
+
+# Each session has a history file of its own; recall the day's other
+# sessions too
+for __bashlog_f in "$BASHLOG_LOG_DIR"/.bash_history*; do
+	case "$__bashlog_f" in
+	"$BASHLOG_HISTFILE" | *.native | *.seq | *.status | *.start | *.sources) ;;
+	*) [ -f "$__bashlog_f" ] && history -r "$__bashlog_f" ;;
+	esac
+done
+unset __bashlog_f
+
+# Log command execution, and how each command ended and where it ran to
+# $BASHLOG_HISTFILE.status, keeping $? for the rest of PROMPT_COMMAND.
+# Commands are also timed by the uptime, which the wall clock jumping
+# doesn't move: PS0 notes it as a command starts, in a subshell, so by file
+__bashlog_started() { local up; read -r up _ </proc/uptime && printf '%%s' "$up" >"$BASHLOG_HISTFILE.start"; } 2>/dev/null
+__bashlog_prompt() {
+	local status=$? line start=- end=-
+	{ read -r end _ </proc/uptime || end=-; } 2>/dev/null
+	if [[ -s $BASHLOG_HISTFILE.start ]]; then
+		read -r start <"$BASHLOG_HISTFILE.start"
+		: >"$BASHLOG_HISTFILE.start"
+	fi
+	declare -F __bashlog_forget >/dev/null && __bashlog_forget
+	builtin history -a
+	line=$(HISTTIMEFORMAT='%%s ' builtin history 1)
+	if [[ $line =~ ^\ *([0-9]+)[*\ ]\ ([0-9]+) ]]; then
+		if [[ -n $__bashlog_dir && ${BASH_REMATCH[1]} != "$__bashlog_last" ]]; then
+			printf '%%s\t%%s\t%%s\t%%s\t%%s\n' "${BASH_REMATCH[2]}" "$status" "${start:--}" "$end" "$__bashlog_dir" >> "$BASHLOG_HISTFILE.status"
+		fi
+		__bashlog_last=${BASH_REMATCH[1]}
+	fi
+	__bashlog_dir=$PWD
+	return $status
+}
+PROMPT_COMMAND="__bashlog_prompt; $PROMPT_COMMAND"
+PS0='$(__bashlog_started)'"$PS0"
+
+# Mark key moments in the session log: mark "reproduced the bug here"
+if ! type mark >/dev/null 2>&1; then
+	mark() { "${BASHLOG_BIN:-bashlog}" mark "$@"; }
+	export -f mark
+fi
+
+# Stop recording for a moment, e.g. to type a password: bashlog pause, then
+# bashlog resume. The shell's history is off in between
+bashlog() {
+	case "$1" in
+	pause) set +o history ;;
+	resume) set -o history ;;
+	esac
+	if [ -n "$BASHLOG_BIN" ]; then "$BASHLOG_BIN" "$@"; else command bashlog "$@"; fi
+}
+%s%s`, time.Now().UTC().Format("2006-01-02 15:04:05"), bashStartupFiles(opts.Login),
+		quoteSh(opts.Timezone), quoteSh(opts.LogDir), quoteSh(opts.SessionID), quoteSh(opts.HistFile),
+		optionalSection(opts.SearchKey, bashSearchKey), optionalSection(opts.Escalate, shEscalate)) +
+		incognitoSection(opts.IncognitoPrefix, quoteSh, bashIncognito, bashIncognitoWord) +
+		optionalSection(opts.Sources, bashSources), nil
+}
+
+// bashSources has a DEBUG trap record the commands sourced files and
+// functions run to $BASHLOG_HISTFILE.sources, as "<unix-seconds>\t<file>\t
+// <line>\t<function>\t<command>" lines. Interactive bash numbers the lines
+// of functions from 1, so theirs are recorded at the line each function is
+// defined at, looked up once. It is set last, leaving the startup files and
+// this script untraced, and not at all in shells that set a trap of their
+// own, which a second one would replace
+const bashSources = `
+# Record where commands run by sourced files and functions come from
+__bashlog_rc=${BASH_SOURCE[0]}
+declare -A __bashlog_fnline
+__bashlog_source() {
+	local src=${BASH_SOURCE[1]} fn=${FUNCNAME[1]} line=$1 now cmd
+	[[ -n $src && $src != "$__bashlog_rc" && $fn != __bashlog_* && $BASH_COMMAND != "$fn" && $BASH_COMMAND != "$fn "* && -o history ]] || return 0
+	if [[ $fn != source && $fn != main ]]; then
+		[[ -n ${__bashlog_fnline[$fn]} ]] || __bashlog_fnline[$fn]=$(shopt -s extdebug; declare -F "$fn" | { read -r _ l _; echo "$l"; })
+		line=${__bashlog_fnline[$fn]}
+	fi
+	printf -v now '%(%s)T' -1
+	cmd=${BASH_COMMAND//[$'\t\n']/ }
+	printf '%s\t%s\t%s\t%s\t%s\n' "$now" "$src" "$line" "$fn" "$cmd" >> "$BASHLOG_HISTFILE.sources"
+} 2>/dev/null
+if [[ -z $(trap -p DEBUG) ]]; then
+	set -o functrace
+	trap '__bashlog_source "$LINENO"' DEBUG
+fi
+`
+
+// bashIncognito drops the last command from the history before the
+// prompt writes it out when it starts with the prefix
+const bashIncognito = `
+# Leave commands starting with the incognito prefix unrecorded
+__bashlog_incognito=%s
+__bashlog_forget() {
+	local line
+	line=$(HISTTIMEFORMAT= builtin history 1)
+	if [[ $line =~ ^\ *([0-9]+)[*\ ]\ (.*)$ && ${BASH_REMATCH[2]} == "$__bashlog_incognito"* ]]; then
+		builtin history -d "${BASH_REMATCH[1]}"
+	fi
+}
+`
+
+// bashIncognitoWord runs what follows the prefix word, as typed
+const bashIncognitoWord = `alias %s=''
+`
+
+// bashSearchKey replaces reverse-i-search with bashlog search, editing
+// the command line through readline's variables
+const bashSearchKey = `
+# Search everything bashlog recorded with Ctrl-R
+__bashlog_search() {
+	local picked
+	picked=$("${BASHLOG_BIN:-bashlog}" search -- "$READLINE_LINE") || return
+	if [ -n "$picked" ]; then
+		READLINE_LINE=$picked
+		READLINE_POINT=${#picked}
+	fi
+}
+bind -x '"\C-r": __bashlog_search' 2>/dev/null
+
+# Complete the command line from what was run before with Alt-S, pressed
+# again for the next most likely
+__bashlog_suggest() {
+	if [[ $READLINE_LINE != "$__bashlog_suggested" ]]; then
+		__bashlog_suggest_n=0
+		mapfile -t __bashlog_suggestions < <("${BASHLOG_BIN:-bashlog}" suggest --limit 10 -- "$READLINE_LINE" 2>/dev/null)
+	fi
+	(( ${#__bashlog_suggestions[@]} )) || return
+	__bashlog_suggested=${__bashlog_suggestions[__bashlog_suggest_n++ % ${#__bashlog_suggestions[@]}]}
+	READLINE_LINE=$__bashlog_suggested
+	READLINE_POINT=${#READLINE_LINE}
+}
+bind -x '"\es": __bashlog_suggest' 2>/dev/null
+`
+
+// LaunchArgs never passes -l, since bash ignores --rcfile in login shells;
+// the init script loads the login files itself instead
+func (bashAdapter) LaunchArgs(initFile string, login bool) ([]string, []string) {
+	return []string{"--rcfile", initFile, "-i"}, nil
+}
+
+// bashStartupFiles returns the init script section loading the user's own
+// configuration, following the order bash itself uses
+func bashStartupFiles(login bool) string {
+	if !login {
+		return `# Load the user's own configuration first
+if [ -f ~/.bashrc ]; then
+	. ~/.bashrc
+fi
+`
+	}
+
+	return `# Load the user's login configuration first, as bash -l would
+if [ -f /etc/profile ]; then
+	. /etc/profile
+fi
+for __bashlog_profile in ~/.bash_profile ~/.bash_login ~/.profile; do
+	if [ -f "$__bashlog_profile" ]; then
+		. "$__bashlog_profile"
+		break
+	fi
+done
+unset __bashlog_profile
+`
+}
+
+func (bashAdapter) ParseHistory(r io.Reader) ([]workspace.Entry, error) {
+	return workspace.ParseHistory(r)
+}
@@ -0,0 +1,97 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellsFile lists the valid login shells on the system
+const shellsFile = "/etc/shells"
+
+// probeOrder is the order adapters are tried in when a binary's name does
+// not identify its shell family. Adapters whose version query only succeeds
+// in their own shell come first; plain sh is the fallback.
+var probeOrder = []string{"bash", "zsh", "ksh", "fish", "nu"}
+
+// Detect determines the shell family of the binary at path, looking at its
+// name, then the name it links to, and finally asking the binary itself
+func Detect(path string) (Adapter, error) {
+	if a, ok := lookupBinaryName(path); ok {
+		return a, nil
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if a, ok := lookupBinaryName(resolved); ok {
+			return a, nil
+		}
+	}
+
+	for _, name := range probeOrder {
+		a, ok := registry[name]
+		if !ok {
+			continue
+		}
+		if _, err := a.DetectVersion(path); err == nil {
+			return a, nil
+		}
+	}
+
+	if a, ok := registry["sh"]; ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("could not determine the shell family of %s", path)
+}
+
+// lookupBinaryName matches a binary name such as "zsh", "zsh-5.9" or
+// "-bash" (as used for login shells) against the registry
+func lookupBinaryName(path string) (Adapter, bool) {
+	name := strings.TrimPrefix(filepath.Base(path), "-")
+	if a, ok := registry[name]; ok {
+		return a, true
+	}
+
+	name = strings.TrimRight(name, "-.0123456789")
+	a, ok := registry[name]
+	return a, ok
+}
+
+// ValidateLoginShell checks that path is listed in /etc/shells, either as
+// given or after resolving symlinks. Systems without /etc/shells accept any
+// shell.
+func ValidateLoginShell(path string) error {
+	f, err := os.Open(shellsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	candidates := map[string]bool{path: true}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		candidates[resolved] = true
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if candidates[line] {
+			return nil
+		}
+		if resolved, err := filepath.EvalSymlinks(line); err == nil && candidates[resolved] {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%s is not listed in %s", path, shellsFile)
+}
@@ -0,0 +1,185 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/shellhist"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+func init() {
+	Register(fishAdapter{})
+}
+
+type fishAdapter struct{}
+
+// fishRecordHook appends each command to $BASHLOG_HISTFILE in bash
+// history format, since fish cannot be pointed at another history file,
+// and how it ended and where it ran to $BASHLOG_HISTFILE.status, timed by
+// the uptime as well as the wall clock
+const fishRecordHook = `
+function __bashlog_uptime
+	set -l up -
+	test -r /proc/uptime; and read up rest </proc/uptime
+	echo $up
+end
+
+function __bashlog_record --on-event fish_preexec
+	set -q __bashlog_paused; and return
+	set -q __bashlog_incognito; and string match -q -- "$__bashlog_incognito*" $argv[1]; and return
+	set -l now (date +%s)
+	printf '#%s\n%s\n' $now (string join '; ' -- (string split \n -- $argv[1])) >> $BASHLOG_HISTFILE
+	set -g __bashlog_pending $now (__bashlog_uptime) $PWD
+end
+
+function __bashlog_status --on-event fish_postexec
+	set -l last $status
+	set -q __bashlog_pending; or return
+	printf '%s\t%s\t%s\t%s\t%s\n' $__bashlog_pending[1] $last $__bashlog_pending[2] (__bashlog_uptime) $__bashlog_pending[3] >> $BASHLOG_HISTFILE.status
+	set -e __bashlog_pending
+end
+
+# Mark key moments in the session log: mark "reproduced the bug here"
+if not functions -q mark
+	function mark --description 'Add a marker to the bashlog session log'
+		set -q BASHLOG_BIN; or set -l BASHLOG_BIN bashlog
+		$BASHLOG_BIN mark $argv
+	end
+end
+
+# Stop recording for a moment, e.g. to type a password: bashlog pause, then
+# bashlog resume. Fish's own history skips what is typed in between, and
+# commands starting with the incognito prefix, where it asks
+# fish_should_add_to_history
+function bashlog --description 'bashlog, where pause and resume also stop the shell recording'
+	switch "$argv[1]"
+		case pause
+			set -g __bashlog_paused 1
+		case resume
+			set -e __bashlog_paused
+	end
+	if set -q BASHLOG_BIN
+		$BASHLOG_BIN $argv
+	else
+		command bashlog $argv
+	end
+end
+if not functions -q fish_should_add_to_history
+	function fish_should_add_to_history
+		set -q __bashlog_paused; and return 1
+		set -q __bashlog_incognito; and string match -q -- "$__bashlog_incognito*" $argv[1]; and return 1
+		return 0
+	end
+end
+`
+
+func (fishAdapter) Name() string { return "fish" }
+
+func (fishAdapter) DetectVersion(binary string) (string, error) {
+	return versionFromVariable(binary, `echo $version`)
+}
+
+func (fishAdapter) InitFileName() string { return "bashlog.fish" }
+
+func (fishAdapter) GenerateInit(opts InitOptions) (string, error) {
+	header := fmt.Sprintf(`# Bashlog fish Configuration
+# Generated at %s
+
+set -gx BASHLOG_TIMEZONE %s
+set -gx BASHLOG_LOG_DIR %s
+set -gx BASHLOG_SESSION_ID %s
+set -gx BASHLOG_HISTFILE %s
+set -gx BASHLOG_ENABLED 1
+`, time.Now().UTC().Format("2006-01-02 15:04:05"),
+		quoteFish(opts.Timezone), quoteFish(opts.LogDir), quoteFish(opts.SessionID), quoteFish(opts.HistFile))
+
+	return header + fishRecordHook + optionalSection(opts.SearchKey, fishSearchKey) + optionalSection(opts.Escalate, fishEscalate) +
+		incognitoSection(opts.IncognitoPrefix, quoteFish, fishIncognito, fishIncognitoWord), nil
+}
+
+// fishEscalate routes sudo and su through bashlog escalate, which records
+// the privileged shells they start
+const fishEscalate = `
+# Record privileged shells started with sudo or su as child sessions;
+# command sudo and command su leave them unrecorded
+function sudo --wraps sudo --description 'sudo, recording the shells it starts with bashlog'
+	if set -q BASHLOG_BIN
+		$BASHLOG_BIN escalate sudo $argv
+	else
+		command sudo $argv
+	end
+end
+function su --wraps su --description 'su, recording the shells it starts with bashlog'
+	if set -q BASHLOG_BIN
+		$BASHLOG_BIN escalate su $argv
+	else
+		command su $argv
+	end
+end
+`
+
+// fishIncognito sets the prefix the record hook skips
+const fishIncognito = `
+# Leave commands starting with the incognito prefix unrecorded
+set -g __bashlog_incognito %s
+`
+
+// fishIncognitoWord runs what follows the prefix word
+const fishIncognitoWord = `function %s --wraps command --description 'Run a command bashlog leaves unrecorded'
+	$argv
+end
+`
+
+// fishSearchKey replaces history-pager with bashlog search
+const fishSearchKey = `
+# Search everything bashlog recorded with Ctrl-R
+function __bashlog_search --description 'Search the commands bashlog recorded'
+	set -q BASHLOG_BIN; or set -l BASHLOG_BIN bashlog
+	set -l picked ($BASHLOG_BIN search -- (commandline) | string collect)
+	if test -n "$picked"
+		commandline --replace -- $picked
+	end
+	commandline -f repaint
+end
+bind \cr __bashlog_search
+
+# Complete the command line from what was run before with Alt-S, pressed
+# again for the next most likely
+function __bashlog_suggest --description 'Complete the command line from what bashlog recorded'
+	set -q BASHLOG_BIN; or set -l BASHLOG_BIN bashlog
+	if test "$(commandline)" != "$__bashlog_suggested"
+		set -g __bashlog_suggest_n 0
+		set -g __bashlog_suggestions ($BASHLOG_BIN suggest --limit 10 -- (commandline) 2>/dev/null)
+	end
+	set -q __bashlog_suggestions[1]; or return
+	set -g __bashlog_suggested $__bashlog_suggestions[(math "$__bashlog_suggest_n % $(count $__bashlog_suggestions) + 1")]
+	set -g __bashlog_suggest_n (math $__bashlog_suggest_n + 1)
+	commandline --replace -- $__bashlog_suggested
+	commandline -f repaint
+end
+bind \es __bashlog_suggest
+`
+
+// LaunchArgs sources the init script after fish has read the user's own
+// config.fish
+func (fishAdapter) LaunchArgs(initFile string, login bool) ([]string, []string) {
+	args := []string{"-i", "--init-command", "source " + quoteFish(initFile)}
+	if login {
+		args = append([]string{"-l"}, args...)
+	}
+	return args, nil
+}
+
+func (fishAdapter) ParseHistory(r io.Reader) ([]workspace.Entry, error) {
+	return shellhist.ParseFish(r)
+}
+
+// quoteFish quotes s for fish, where only \\ and \' are special inside
+// single quotes
+func quoteFish(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
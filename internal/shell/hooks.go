@@ -0,0 +1,173 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markers around the hook in a startup file, so it can be found again to
+// be updated or removed
+const (
+	hookBegin = "# >>> bashlog hook >>>"
+	hookEnd   = "# <<< bashlog hook <<<"
+)
+
+// HookShells are the shells a hook can be installed into
+var HookShells = []string{"bash", "zsh", "fish"}
+
+// HookFile is the startup file every interactive shell of the named kind
+// reads, where its hook goes
+func HookFile(name, home string) (string, error) {
+	switch name {
+	case "bash":
+		return filepath.Join(home, ".bashrc"), nil
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return filepath.Join(dir, ".zshrc"), nil
+	case "fish":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(dir, "fish", "config.fish"), nil
+	}
+	return "", fmt.Errorf("hooks can't be installed for '%s' (supported: %s)", name, strings.Join(HookShells, ", "))
+}
+
+// hookSnippet restarts an interactive shell under bin, recording into
+// workspace. It does nothing inside a session, which loads the startup
+// file again, when stdin isn't a terminal, when bin is gone, or with
+// BASHLOG_NO_HOOK set, the way out when recording is unwanted or broken
+func hookSnippet(name, bin, workspace string) string {
+	header := hookBegin + "\n# Added by bashlog install-hooks; remove with: bashlog uninstall-hooks\n"
+	switch name {
+	case "fish":
+		return header + fmt.Sprintf(`if status is-interactive; and not set -q BASHLOG_SESSION_ID; and not set -q BASHLOG_NO_HOOK; and isatty stdin; and test -x %[1]s
+	if status is-login
+		exec %[1]s --shell fish --workspace %[2]s --login
+	end
+	exec %[1]s --shell fish --workspace %[2]s
+end
+`, quoteFish(bin), quoteFish(workspace)) + hookEnd + "\n"
+	case "zsh":
+		return header + fmt.Sprintf(`if [[ -o interactive && -z "$BASHLOG_SESSION_ID" && -z "$BASHLOG_NO_HOOK" && -t 0 && -x %[1]s ]]; then
+	if [[ -o login ]]; then
+		exec %[1]s --shell zsh --workspace %[2]s --login
+	fi
+	exec %[1]s --shell zsh --workspace %[2]s
+fi
+`, quoteSh(bin), quoteSh(workspace)) + hookEnd + "\n"
+	}
+	return header + fmt.Sprintf(`if [[ $- == *i* && -z "$BASHLOG_SESSION_ID" && -z "$BASHLOG_NO_HOOK" && -t 0 && -x %[1]s ]]; then
+	if shopt -q login_shell; then
+		exec %[1]s --shell bash --workspace %[2]s --login
+	fi
+	exec %[1]s --shell bash --workspace %[2]s
+fi
+`, quoteSh(bin), quoteSh(workspace)) + hookEnd + "\n"
+}
+
+// InstallHook adds the hook for the named shell to its startup file, or
+// replaces the one already there, and returns the file's path
+func InstallHook(name, home, bin, workspace string) (string, error) {
+	path, err := HookFile(name, home)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return path, err
+	}
+	content, _ := removeHook(string(data))
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if content != "" {
+		content += "\n"
+	}
+	return path, writeStartupFile(path, content+hookSnippet(name, bin, workspace))
+}
+
+// UninstallHook removes the named shell's hook from its startup file,
+// reporting whether there was one
+func UninstallHook(name, home string) (string, bool, error) {
+	path, err := HookFile(name, home)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return path, false, nil
+	}
+	if err != nil {
+		return path, false, err
+	}
+	content, found := removeHook(string(data))
+	if !found {
+		return path, false, nil
+	}
+	return path, true, writeStartupFile(path, content)
+}
+
+// HookInstalled reports whether the named shell's startup file has the
+// hook
+func HookInstalled(name, home string) (string, bool) {
+	path, err := HookFile(name, home)
+	if err != nil {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return path, false
+	}
+	_, found := removeHook(string(data))
+	return path, found
+}
+
+// removeHook cuts the hook, and the blank line install put before it, out
+// of a startup file's content
+func removeHook(content string) (string, bool) {
+	start := strings.Index(content, hookBegin)
+	if start < 0 {
+		return content, false
+	}
+	end := strings.Index(content[start:], hookEnd)
+	if end < 0 {
+		// The end marker was edited away; leave the file to its owner
+		return content, false
+	}
+	end += start + len(hookEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	before := content[:start]
+	if strings.HasSuffix(before, "\n\n") {
+		before = before[:len(before)-1]
+	}
+	return before + content[end:], true
+}
+
+// writeStartupFile replaces a startup file in one step, keeping its mode
+// and, for one symlinked from a dotfiles repository, the link
+func writeStartupFile(path, content string) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".bashlog-tmp"
+	if err := os.WriteFile(tmp, []byte(content), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
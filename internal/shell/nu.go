@@ -0,0 +1,124 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+func init() {
+	Register(nuAdapter{})
+}
+
+type nuAdapter struct{}
+
+// nuRecordHook appends a pre_execution hook that writes each command line
+// to $env.BASHLOG_HISTFILE in bash history format, keeping nu sessions
+// readable by the same tooling as every other shell
+const nuRecordHook = `
+$env.config = ($env.config | upsert hooks.pre_execution (
+	($env.config.hooks?.pre_execution? | default []) | append {||
+		let typed = (commandline)
+		let cmd = ($typed | str trim | str replace --all "\n" "; ")
+		if ($cmd | is-empty) { return }
+		let incognito = ($env.__BASHLOG_INCOGNITO? | default '')
+		if ($incognito | is-not-empty) and ($typed | str starts-with $incognito) { return }
+		if $env.__BASHLOG_PAUSED { return }
+		$"#(date now | format date '%s')\n($cmd)\n" | save --append $env.BASHLOG_HISTFILE
+	}
+))
+
+# Mark key moments in the session log: mark "reproduced the bug here"
+def mark [...note: string] {
+	run-external ($env.BASHLOG_BIN? | default 'bashlog') mark ...$note
+}
+
+# Stop recording for a moment, e.g. to type a password: bashlog pause, then
+# bashlog resume
+$env.__BASHLOG_PAUSED = false
+def --env "bashlog pause" [] {
+	$env.__BASHLOG_PAUSED = true
+	run-external ($env.BASHLOG_BIN? | default 'bashlog') pause
+}
+def --env "bashlog resume" [] {
+	run-external ($env.BASHLOG_BIN? | default 'bashlog') resume
+	$env.__BASHLOG_PAUSED = false
+}
+`
+
+func (nuAdapter) Name() string { return "nu" }
+
+func (nuAdapter) DetectVersion(binary string) (string, error) {
+	return versionFromVariable(binary, `version | get version`)
+}
+
+func (nuAdapter) InitFileName() string { return "bashlog.nu" }
+
+func (nuAdapter) GenerateInit(opts InitOptions) (string, error) {
+	header := fmt.Sprintf(`# Bashlog nushell Configuration
+# Generated at %s
+
+$env.BASHLOG_TIMEZONE = %s
+$env.BASHLOG_LOG_DIR = %s
+$env.BASHLOG_SESSION_ID = %s
+$env.BASHLOG_HISTFILE = %s
+$env.BASHLOG_ENABLED = '1'
+`, time.Now().UTC().Format("2006-01-02 15:04:05"),
+		quoteNu(opts.Timezone), quoteNu(opts.LogDir), quoteNu(opts.SessionID), quoteNu(opts.HistFile))
+
+	return header + nuRecordHook + optionalSection(opts.Escalate, nuEscalate) +
+		incognitoSection(opts.IncognitoPrefix, quoteNu, nuIncognito, nuIncognitoWord), nil
+}
+
+// nuEscalate routes sudo and su through bashlog escalate, which records
+// the privileged shells they start
+const nuEscalate = `
+# Record privileged shells started with sudo or su as child sessions;
+# ^sudo and ^su leave them unrecorded
+def --wrapped sudo [...args] {
+	run-external ($env.BASHLOG_BIN? | default 'bashlog') escalate sudo ...$args
+}
+def --wrapped su [...args] {
+	run-external ($env.BASHLOG_BIN? | default 'bashlog') escalate su ...$args
+}
+`
+
+// nuIncognito sets the prefix the record hook skips
+const nuIncognito = `
+# Leave commands starting with the incognito prefix unrecorded
+$env.__BASHLOG_INCOGNITO = %s
+`
+
+// nuIncognitoWord runs the external command following the prefix word
+const nuIncognitoWord = `def --wrapped %s [...command] {
+	run-external ...$command
+}
+`
+
+// LaunchArgs sources the init script with --execute, which runs after nu
+// has loaded the user's own env.nu and config.nu
+func (nuAdapter) LaunchArgs(initFile string, login bool) ([]string, []string) {
+	args := []string{"--execute", "source " + quoteNu(initFile)}
+	if login {
+		args = append([]string{"--login"}, args...)
+	}
+	return args, nil
+}
+
+// ParseHistory reads nu's plaintext history format, one command per line
+func (nuAdapter) ParseHistory(r io.Reader) ([]workspace.Entry, error) {
+	return workspace.ParseHistory(r)
+}
+
+// quoteNu returns s as a nu raw string, which needs no escaping as long as
+// the closing delimiter does not appear in s
+func quoteNu(s string) string {
+	delim := "#"
+	for strings.Contains(s, "'"+delim) {
+		delim += "#"
+	}
+	return "r" + delim + "'" + s + "'" + delim
+}
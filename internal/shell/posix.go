@@ -0,0 +1,169 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/shellhist"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+func init() {
+	for _, name := range []string{"ksh", "ksh93", "mksh"} {
+		Register(posixAdapter{name: name, rcFile: ".kshrc", versionVar: "KSH_VERSION"})
+	}
+	for _, name := range []string{"sh", "dash"} {
+		Register(posixAdapter{name: name, rcFile: ".shrc"})
+	}
+}
+
+// posixAdapter records ksh93, mksh and plain POSIX shells. None of them
+// offer a preexec hook, so commands are recorded from a command
+// substitution in PS1 that runs each time a prompt is drawn: it reads the
+// last history entry with fc and appends it to $BASHLOG_HISTFILE in bash
+// history format. Shells without fc, such as dash, still run the session
+// but no commands are recorded.
+type posixAdapter struct {
+	name       string
+	rcFile     string
+	versionVar string
+}
+
+// posixRecordHook is kept outside GenerateInit's format string because of
+// the many % characters in its parameter expansions
+const posixRecordHook = `
+# Record the previous command as the prompt is drawn
+__bashlog_record() {
+	[ -n "${__bashlog_paused:-}" ] && return 0
+	__bashlog_last=$(fc -l -1 2>/dev/null) || return 0
+	__bashlog_last=${__bashlog_last#"${__bashlog_last%%[!	 ]*}"}
+	__bashlog_num=${__bashlog_last%%[!0-9]*}
+	[ -n "$__bashlog_num" ] || return 0
+	[ "$__bashlog_num" = "$(cat "$BASHLOG_HISTFILE.seq" 2>/dev/null)" ] && return 0
+	printf '%s\n' "$__bashlog_num" > "$BASHLOG_HISTFILE.seq"
+	__bashlog_cmd=${__bashlog_last#"$__bashlog_num"}
+	# fc separates the number with one character, after which leading
+	# blanks are the command's own
+	if [ -n "${__bashlog_incognito:-}" ]; then
+		case ${__bashlog_cmd#?} in
+		"$__bashlog_incognito"*) return 0 ;;
+		esac
+	fi
+	__bashlog_cmd=${__bashlog_cmd#"${__bashlog_cmd%%[!	 ]*}"}
+	printf '#%s\n%s\n' "$(date +%s)" "$__bashlog_cmd" >> "$BASHLOG_HISTFILE"
+}
+
+if command -v fc >/dev/null 2>&1; then
+	# Skip whatever was already in the history when the session started
+	__bashlog_last=$(fc -l -1 2>/dev/null)
+	__bashlog_last=${__bashlog_last#"${__bashlog_last%%[!	 ]*}"}
+	printf '%s\n' "${__bashlog_last%%[!0-9]*}" > "$BASHLOG_HISTFILE.seq"
+	PS1='$(__bashlog_record)'"${PS1:-\$ }"
+else
+	echo "bashlog: this shell has no fc builtin; commands will not be recorded" >&2
+fi
+
+# Mark key moments in the session log: mark "reproduced the bug here"
+if ! command -v mark >/dev/null 2>&1; then
+	mark() { "${BASHLOG_BIN:-bashlog}" mark "$@"; }
+fi
+
+# Stop recording for a moment, e.g. to type a password: bashlog pause, then
+# bashlog resume
+bashlog() {
+	case "$1" in
+	pause) __bashlog_paused=1 ;;
+	resume) __bashlog_paused= ;;
+	esac
+	if [ -n "${BASHLOG_BIN:-}" ]; then "$BASHLOG_BIN" "$@"; else command bashlog "$@"; fi
+}
+`
+
+func (a posixAdapter) Name() string { return a.name }
+
+// DetectVersion uses $KSH_VERSION where the shell sets it, and otherwise
+// reports which binary a generic name such as sh resolves to
+func (a posixAdapter) DetectVersion(binary string) (string, error) {
+	if a.versionVar != "" {
+		return versionFromVariable(binary, `echo "$`+a.versionVar+`"`)
+	}
+
+	resolved, err := filepath.EvalSymlinks(binary)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(resolved), nil
+}
+
+func (a posixAdapter) InitFileName() string { return "bashlog" + a.rcFile }
+
+func (a posixAdapter) GenerateInit(opts InitOptions) (string, error) {
+	header := fmt.Sprintf(`# Bashlog %s Configuration
+# Generated at %s
+
+# Load the user's own configuration first
+if [ -f "$HOME/%s" ]; then
+	. "$HOME/%s"
+fi
+
+export BASHLOG_TIMEZONE=%s
+export BASHLOG_LOG_DIR=%s
+export BASHLOG_SESSION_ID=%s
+export BASHLOG_HISTFILE=%s
+export BASHLOG_ENABLED=1
+
+# Keep the shell's own history alongside the session log
+HISTFILE="$BASHLOG_HISTFILE.native"
+HISTSIZE=10000
+export HISTFILE HISTSIZE
+`, a.name, time.Now().UTC().Format("2006-01-02 15:04:05"), a.rcFile, a.rcFile,
+		quoteSh(opts.Timezone), quoteSh(opts.LogDir), quoteSh(opts.SessionID), quoteSh(opts.HistFile))
+
+	return header + posixRecordHook + optionalSection(opts.Escalate, posixEscalate) +
+		incognitoSection(opts.IncognitoPrefix, quoteSh, posixIncognito, posixIncognitoWord), nil
+}
+
+// posixEscalate routes sudo and su through bashlog escalate, which records
+// the privileged shells they start
+const posixEscalate = `
+# Record privileged shells started with sudo or su as child sessions;
+# command sudo and command su leave them unrecorded
+sudo() {
+	if [ -n "${BASHLOG_BIN:-}" ]; then "$BASHLOG_BIN" escalate sudo "$@"; else command sudo "$@"; fi
+}
+su() {
+	if [ -n "${BASHLOG_BIN:-}" ]; then "$BASHLOG_BIN" escalate su "$@"; else command su "$@"; fi
+}
+`
+
+// posixIncognito sets the prefix the record hook skips. The shell's own
+// history still keeps such commands
+const posixIncognito = `
+# Leave commands starting with the incognito prefix unrecorded
+__bashlog_incognito=%s
+`
+
+// posixIncognitoWord runs what follows the prefix word, as typed
+const posixIncognitoWord = `alias %s=''
+`
+
+// LaunchArgs relies on the shell sourcing $ENV when it starts
+// interactively, which login shells do after reading ~/.profile
+func (posixAdapter) LaunchArgs(initFile string, login bool) ([]string, []string) {
+	args := []string{"-i"}
+	if login {
+		args = append([]string{"-l"}, args...)
+	}
+	return args, []string{"ENV=" + initFile}
+}
+
+// ParseHistory reads ksh93's history file; plain sh keeps no history file
+// of its own, so bash format is assumed for it
+func (a posixAdapter) ParseHistory(r io.Reader) ([]workspace.Entry, error) {
+	if a.versionVar != "" {
+		return shellhist.ParseKsh(r)
+	}
+	return workspace.ParseHistory(r)
+}
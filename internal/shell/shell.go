@@ -0,0 +1,180 @@
+// Package shell abstracts the differences between the interactive shells
+// bashlog can record.
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// InitOptions carries the session settings an init script exports
+type InitOptions struct {
+	SessionID string
+	Timezone  string
+	LogDir    string
+
+	// HistFile receives the session's commands in bash history format,
+	// whichever shell is recorded
+	HistFile string
+
+	// Login makes the init script load the user's login configuration
+	Login bool
+
+	// SearchKey binds Ctrl-R to bashlog search, and Alt-S to bashlog
+	// suggest, in shells with a line editor that can run them (bash, zsh
+	// and fish)
+	SearchKey bool
+
+	// Escalate wraps sudo and su in shell functions that have bashlog
+	// record the privileged shells they start as child sessions
+	Escalate bool
+
+	// Sources records the commands sourced files and functions run, with
+	// the file and line they come from, beside the history. Only bash can,
+	// through its DEBUG trap
+	Sources bool
+
+	// IncognitoPrefix, when set, marks commands the hook leaves out of the
+	// session and the shell's own history: whitespace, as in " ls", or a
+	// word and a space, as in ":q ls", the word then running the rest
+	IncognitoPrefix string
+}
+
+// Adapter integrates bashlog with one shell family
+type Adapter interface {
+	// Name is the name the adapter is registered under
+	Name() string
+
+	// DetectVersion reports the version of the shell at binary
+	DetectVersion(binary string) (string, error)
+
+	// InitFileName is the file name GenerateInit output must be saved as
+	InitFileName() string
+
+	// GenerateInit returns the init script that configures a session
+	GenerateInit(opts InitOptions) (string, error)
+
+	// LaunchArgs returns the arguments and extra environment that start an
+	// interactive shell, optionally as a login shell, using the init
+	// script at initFile
+	LaunchArgs(initFile string, login bool) (args []string, env []string)
+
+	// ParseHistory parses the shell's own history file format, as found
+	// in files such as ~/.zsh_history
+	ParseHistory(r io.Reader) ([]workspace.Entry, error)
+}
+
+var registry = make(map[string]Adapter)
+
+// Register makes an adapter available by name
+func Register(a Adapter) {
+	if _, exists := registry[a.Name()]; exists {
+		panic("shell: adapter registered twice: " + a.Name())
+	}
+	registry[a.Name()] = a
+}
+
+// Lookup returns the adapter registered under name
+func Lookup(name string) (Adapter, error) {
+	a, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported shell '%s' (supported: %s)", name, strings.Join(Names(), ", "))
+	}
+	return a, nil
+}
+
+// Names returns the registered adapter names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// versionFromVariable runs binary non-interactively and prints a variable
+// the shell sets to its own version
+func versionFromVariable(binary, script string) (string, error) {
+	out, err := exec.Command(binary, "-c", script).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to query %s version: %w", binary, err)
+	}
+	version := strings.TrimSpace(string(out))
+	if version == "" {
+		return "", fmt.Errorf("%s did not report a version", binary)
+	}
+	return version, nil
+}
+
+// optionalSection returns an init script section, such as the one binding
+// Ctrl-R, when it is enabled
+func optionalSection(enabled bool, section string) string {
+	if !enabled {
+		return ""
+	}
+	return section
+}
+
+// ValidateIncognitoPrefix checks prefix is whitespace, or a word of
+// letters, digits or punctuation that needs no quoting followed by one
+// space
+func ValidateIncognitoPrefix(prefix string) error {
+	if prefix == "" || strings.TrimLeft(prefix, " \t") == "" {
+		return nil
+	}
+	word, ok := strings.CutSuffix(prefix, " ")
+	if !ok || word == "" {
+		return fmt.Errorf("invalid incognito prefix %q: use whitespace, or a word followed by a space such as \":q \"", prefix)
+	}
+	for _, r := range word {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(":_.,%@+-", r)) {
+			return fmt.Errorf("invalid incognito prefix %q: %q can't be part of a command word", prefix, r)
+		}
+	}
+	return nil
+}
+
+// incognitoWord is the command word an incognito prefix such as ":q "
+// starts with, "" for a prefix of whitespace
+func incognitoWord(prefix string) string {
+	return strings.TrimSpace(prefix)
+}
+
+// incognitoSection returns the init script section for an incognito
+// prefix, when one is set, from a template taking the quoted prefix and
+// word
+func incognitoSection(prefix string, quote func(string) string, template, wordTemplate string) string {
+	if prefix == "" {
+		return ""
+	}
+	section := fmt.Sprintf(template, quote(prefix))
+	if word := incognitoWord(prefix); word != "" {
+		section += fmt.Sprintf(wordTemplate, quote(word))
+	}
+	return section
+}
+
+// shEscalate routes sudo and su through bashlog escalate, which records
+// the privileged shells they start. The function keyword keeps a user's
+// alias such as sudo='sudo ' from breaking the definitions
+const shEscalate = `
+# Record privileged shells started with sudo or su as child sessions;
+# command sudo and command su leave them unrecorded
+function sudo {
+	if [ -n "$BASHLOG_BIN" ]; then "$BASHLOG_BIN" escalate sudo "$@"; else command sudo "$@"; fi
+}
+function su {
+	if [ -n "$BASHLOG_BIN" ]; then "$BASHLOG_BIN" escalate su "$@"; else command su "$@"; fi
+}
+`
+
+// quoteSh quotes s for POSIX-style shells (bash, zsh, ksh, sh)
+func quoteSh(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
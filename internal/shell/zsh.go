@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/shellhist"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+func init() {
+	Register(zshAdapter{})
+}
+
+type zshAdapter struct{}
+
+// zshRecordHook appends each command to $BASHLOG_HISTFILE in bash history
+// format as it starts, and how it ended and where it ran to
+// $BASHLOG_HISTFILE.status at the next prompt, timed by the uptime as well
+// as the wall clock
+const zshRecordHook = `
+zmodload zsh/datetime 2>/dev/null
+__bashlog_uptime() {
+	__bashlog_up=-
+	[[ -r /proc/uptime ]] && read -r __bashlog_up _ </proc/uptime
+}
+__bashlog_record() {
+	[[ -n $__bashlog_paused ]] && return
+	[[ -n $__bashlog_incognito && $1 == "$__bashlog_incognito"* ]] && return
+	local now=${EPOCHSECONDS:-$(date +%s)}
+	print -r -- "#$now" >> "$BASHLOG_HISTFILE"
+	print -r -- "${1//$'\n'/; }" >> "$BASHLOG_HISTFILE"
+	__bashlog_uptime
+	__bashlog_pending=("$now" "$__bashlog_up" "$PWD")
+}
+__bashlog_status() {
+	local last=$?
+	if (( ${#__bashlog_pending} )); then
+		__bashlog_uptime
+		print -r -- "${__bashlog_pending[1]}"$'\t'"$last"$'\t'"${__bashlog_pending[2]}"$'\t'"$__bashlog_up"$'\t'"${__bashlog_pending[3]}" >> "$BASHLOG_HISTFILE.status"
+		__bashlog_pending=()
+	fi
+	return $last
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __bashlog_record
+# First, so that it sees the command's own status
+precmd_functions=(__bashlog_status $precmd_functions)
+
+# Stop recording for a moment, e.g. to type a password: bashlog pause, then
+# bashlog resume. The shell's own history skips what is typed in between,
+# as it does commands starting with the incognito prefix
+__bashlog_addhistory() {
+	[[ -z $__bashlog_paused ]] && [[ -z $__bashlog_incognito || $1 != "$__bashlog_incognito"* ]]
+}
+add-zsh-hook zshaddhistory __bashlog_addhistory
+bashlog() {
+	case "$1" in
+	pause) __bashlog_paused=1 ;;
+	resume) unset __bashlog_paused ;;
+	esac
+	if [[ -n $BASHLOG_BIN ]]; then "$BASHLOG_BIN" "$@"; else command bashlog "$@"; fi
+}
+
+# Mark key moments in the session log: mark "reproduced the bug here"
+if ! whence mark >/dev/null; then
+	mark() { "${BASHLOG_BIN:-bashlog}" mark "$@"; }
+fi
+`
+
+func (zshAdapter) Name() string { return "zsh" }
+
+func (zshAdapter) DetectVersion(binary string) (string, error) {
+	return versionFromVariable(binary, `echo "$ZSH_VERSION"`)
+}
+
+// InitFileName is .zshrc because zsh has no --rcfile option; the session
+// points ZDOTDIR at the directory holding the generated file instead
+func (zshAdapter) InitFileName() string { return ".zshrc" }
+
+func (zshAdapter) GenerateInit(opts InitOptions) (string, error) {
+	header := fmt.Sprintf(`# Bashlog zsh Configuration
+# Generated at %s
+
+%s
+export BASHLOG_TIMEZONE=%s
+export BASHLOG_LOG_DIR=%s
+export BASHLOG_SESSION_ID=%s
+export BASHLOG_HISTFILE=%s
+export BASHLOG_ENABLED=1
+
+# Keep the shell's own history alongside the session log
+HISTFILE="$BASHLOG_HISTFILE.native"
+HISTSIZE=10000
+SAVEHIST=10000
+setopt EXTENDED_HISTORY INC_APPEND_HISTORY
+
+# Each session has a history file of its own; recall the day's other
+# sessions too
+for __bashlog_f in "$BASHLOG_LOG_DIR"/.zsh_history*.native(N); do
+	[[ $__bashlog_f != $HISTFILE ]] && fc -RI "$__bashlog_f"
+done
+unset __bashlog_f
+`, time.Now().UTC().Format("2006-01-02 15:04:05"), zshStartupFiles(opts.Login),
+		quoteSh(opts.Timezone), quoteSh(opts.LogDir), quoteSh(opts.SessionID), quoteSh(opts.HistFile))
+
+	return header + zshRecordHook + optionalSection(opts.SearchKey, zshSearchKey) + optionalSection(opts.Escalate, shEscalate) +
+		incognitoSection(opts.IncognitoPrefix, quoteSh, zshIncognito, zshIncognitoWord), nil
+}
+
+// zshIncognito sets the prefix the record and history hooks skip
+const zshIncognito = `
+# Leave commands starting with the incognito prefix unrecorded
+__bashlog_incognito=%s
+`
+
+// zshIncognitoWord runs what follows the prefix word, as typed
+const zshIncognitoWord = `alias %s=''
+`
+
+// zshSearchKey replaces history-incremental-search-backward with bashlog
+// search as a zle widget
+const zshSearchKey = `
+# Search everything bashlog recorded with Ctrl-R
+__bashlog_search() {
+	local picked
+	picked=$("${BASHLOG_BIN:-bashlog}" search -- "$BUFFER" </dev/tty)
+	if [[ -n $picked ]]; then
+		BUFFER=$picked
+		CURSOR=${#BUFFER}
+	fi
+	zle reset-prompt
+}
+zle -N __bashlog_search
+bindkey '^R' __bashlog_search
+
+# Complete the command line from what was run before with Alt-S, pressed
+# again for the next most likely
+__bashlog_suggest() {
+	if [[ $BUFFER != "$__bashlog_suggested" ]]; then
+		__bashlog_suggest_n=0
+		__bashlog_suggestions=("${(@f)$("${BASHLOG_BIN:-bashlog}" suggest --limit 10 -- "$BUFFER" 2>/dev/null)}")
+	fi
+	(( ${#__bashlog_suggestions} )) && [[ -n ${__bashlog_suggestions[1]} ]] || return
+	__bashlog_suggested=${__bashlog_suggestions[__bashlog_suggest_n % ${#__bashlog_suggestions} + 1]}
+	(( __bashlog_suggest_n++ ))
+	BUFFER=$__bashlog_suggested
+	CURSOR=${#BUFFER}
+}
+zle -N __bashlog_suggest
+bindkey '\es' __bashlog_suggest
+`
+
+func (zshAdapter) LaunchArgs(initFile string, login bool) ([]string, []string) {
+	args := []string{"-i"}
+	if login {
+		args = append([]string{"-l"}, args...)
+	}
+	return args, []string{"ZDOTDIR=" + filepath.Dir(initFile)}
+}
+
+func (zshAdapter) ParseHistory(r io.Reader) ([]workspace.Entry, error) {
+	return shellhist.ParseZsh(r)
+}
+
+// zshStartupFiles returns the init script section loading the user's own
+// configuration. With ZDOTDIR pointing elsewhere zsh skips the user's
+// files, so the ones it would have read are sourced here in the same order.
+func zshStartupFiles(login bool) string {
+	files := []string{".zshrc"}
+	if login {
+		files = []string{".zprofile", ".zshrc", ".zlogin"}
+	}
+
+	section := "# Load the user's own configuration first\n"
+	for _, name := range files {
+		section += fmt.Sprintf("if [ -f \"$HOME/%s\" ]; then\n\t. \"$HOME/%s\"\nfi\n", name, name)
+	}
+	return section
+}
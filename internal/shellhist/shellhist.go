@@ -0,0 +1,258 @@
+// Package shellhist parses the history files written by common shells.
+package shellhist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Supported history file formats
+const (
+	FormatBash = "bash"
+	FormatZsh  = "zsh"
+	FormatFish = "fish"
+	FormatKsh  = "ksh"
+)
+
+// kshMagic starts every ksh93 history file
+const kshMagic = "\x81\x01"
+
+// ReadFile parses the history file at path. An empty format detects it
+// from the file name and contents.
+func ReadFile(path, format string) ([]workspace.Entry, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "" {
+		format = Detect(path, data)
+	}
+
+	entries, err := Parse(bytes.NewReader(data), format)
+	return entries, format, err
+}
+
+// Parse reads history in the given format
+func Parse(r io.Reader, format string) ([]workspace.Entry, error) {
+	switch format {
+	case FormatBash:
+		return workspace.ParseHistory(r)
+	case FormatZsh:
+		return ParseZsh(r)
+	case FormatFish:
+		return ParseFish(r)
+	case FormatKsh:
+		return ParseKsh(r)
+	default:
+		return nil, fmt.Errorf("unsupported history format '%s'", format)
+	}
+}
+
+// Detect guesses the format of a history file, preferring its contents
+// over its name
+func Detect(path string, data []byte) string {
+	if strings.HasPrefix(string(data), kshMagic) {
+		return FormatKsh
+	}
+
+	for _, line := range strings.SplitN(string(data), "\n", 20) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if _, _, ok := parseZshExtended(line); ok {
+			return FormatZsh
+		}
+		if strings.HasPrefix(line, "- cmd: ") {
+			return FormatFish
+		}
+		break
+	}
+
+	base := filepath.Base(path)
+	switch {
+	case strings.Contains(base, "zsh") || strings.Contains(base, "zhistory"):
+		return FormatZsh
+	case strings.Contains(base, "fish"):
+		return FormatFish
+	case strings.Contains(base, "sh_history"):
+		return FormatKsh
+	default:
+		return FormatBash
+	}
+}
+
+// ParseZsh parses zsh history, in either the plain or the extended
+// (": <start>:<elapsed>;<command>") format. Multi-line commands are
+// stored by zsh with a backslash before each embedded newline.
+func ParseZsh(r io.Reader) ([]workspace.Entry, error) {
+	var entries []workspace.Entry
+	var current *workspace.Entry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := unmetafy(scanner.Text())
+
+		if current != nil {
+			current.Command += "\n" + line
+		} else {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			entry := workspace.Entry{Command: line}
+			if ts, cmd, ok := parseZshExtended(line); ok {
+				entry = workspace.Entry{Command: cmd, Time: ts}
+			}
+			current = &entry
+		}
+
+		if strings.HasSuffix(current.Command, "\\") {
+			current.Command = strings.TrimSuffix(current.Command, "\\")
+			continue
+		}
+		entries = append(entries, *current)
+		current = nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		entries = append(entries, *current)
+	}
+
+	return entries, nil
+}
+
+// ParseFish parses fish's YAML-like history file
+func ParseFish(r io.Reader) ([]workspace.Entry, error) {
+	var entries []workspace.Entry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if cmd, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			entries = append(entries, workspace.Entry{Command: unescapeFish(cmd)})
+			continue
+		}
+
+		if when, ok := strings.CutPrefix(strings.TrimSpace(line), "when: "); ok && len(entries) > 0 {
+			if secs, err := strconv.ParseInt(when, 10, 64); err == nil {
+				entries[len(entries)-1].Time = time.Unix(secs, 0)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ParseKsh parses a ksh93 history file. Commands are stored one per line
+// after a two byte header, with NUL and 0x81 bytes used as internal markers;
+// ksh records no timestamps.
+func ParseKsh(r io.Reader) ([]workspace.Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimPrefix(string(data), kshMagic)
+
+	var entries []workspace.Entry
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Map(func(r rune) rune {
+			// Stray 0x81 marker bytes decode as utf8.RuneError
+			if r == 0 || r == utf8.RuneError {
+				return -1
+			}
+			return r
+		}, line)
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entries = append(entries, workspace.Entry{Command: line})
+	}
+
+	return entries, nil
+}
+
+func parseZshExtended(line string) (time.Time, string, bool) {
+	rest, ok := strings.CutPrefix(line, ": ")
+	if !ok {
+		return time.Time{}, "", false
+	}
+
+	meta, cmd, ok := strings.Cut(rest, ";")
+	if !ok {
+		return time.Time{}, "", false
+	}
+
+	start, _, ok := strings.Cut(meta, ":")
+	if !ok {
+		return time.Time{}, "", false
+	}
+
+	secs, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	return time.Unix(secs, 0), cmd, true
+}
+
+// unmetafy reverses zsh's encoding of bytes >= 0x83, which are written as
+// 0x83 followed by the byte XORed with 32
+func unmetafy(s string) string {
+	const meta = 0x83
+	if strings.IndexByte(s, meta) < 0 {
+		return s
+	}
+
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == meta && i+1 < len(s) {
+			i++
+			out = append(out, s[i]^32)
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+func unescapeFish(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
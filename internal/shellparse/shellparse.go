@@ -0,0 +1,314 @@
+// Package shellparse splits recorded command lines into simple commands,
+// far enough to tell which programs they run with which arguments. It
+// follows POSIX shell quoting but does not expand anything: variables,
+// globs and command substitutions are kept as written.
+package shellparse
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Simple is one simple command of a command line
+type Simple struct {
+	// Assignments are leading VAR=value words
+	Assignments []string
+	// Words are the command name and its arguments, with quotes removed
+	Words []string
+	// Redirects are the command's redirections, such as "> out.txt"
+	Redirects []Redirect
+	// Op is the operator that follows the command: "|", "&&", "||", ";",
+	// "&", or "" at the end of the line
+	Op string
+	// Raw is the command as written, without the operator
+	Raw string
+}
+
+// Redirect is a redirection such as 2>>log
+type Redirect struct {
+	Op     string
+	Target string
+}
+
+// wrappers run the command that follows their own options
+var wrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "nohup": true, "time": true,
+	"nice": true, "ionice": true, "exec": true, "command": true,
+	"builtin": true, "xargs": true, "timeout": true, "stdbuf": true,
+}
+
+// Parse splits line into simple commands. Unterminated quotes run to the
+// end of the line, as the rest of a recorded command is all there is.
+func Parse(line string) []Simple {
+	p := &parser{line: line}
+	return p.parse()
+}
+
+// Program returns the program the command runs and its arguments, looking
+// through wrappers such as sudo, env and nohup. Wrappers found on the way
+// are returned too, outermost first
+func (s Simple) Program() (name string, args []string, via []string) {
+	words := s.Words
+	for len(words) > 0 {
+		base := filepath.Base(words[0])
+		if !wrappers[base] {
+			return base, words[1:], via
+		}
+		via = append(via, base)
+		words = skipWrapperArgs(base, words[1:])
+	}
+	return "", nil, via
+}
+
+// skipWrapperArgs drops a wrapper's own options and operands
+func skipWrapperArgs(wrapper string, words []string) []string {
+	for len(words) > 0 {
+		w := words[0]
+		switch {
+		case w == "--":
+			return words[1:]
+		case wrapper == "env" && strings.Contains(w, "=") && !strings.HasPrefix(w, "-"):
+			words = words[1:]
+		case wrapper == "timeout" && !strings.HasPrefix(w, "-"):
+			// The duration comes before the command
+			return words[1:]
+		case strings.HasPrefix(w, "-"):
+			words = words[1:]
+			// Options taking a separate value
+			if len(words) > 0 && optionTakesValue(wrapper, w) {
+				words = words[1:]
+			}
+		default:
+			return words
+		}
+	}
+	return words
+}
+
+func optionTakesValue(wrapper, opt string) bool {
+	switch wrapper {
+	case "sudo":
+		return opt == "-u" || opt == "-g" || opt == "-C" || opt == "-h" || opt == "-p" || opt == "-U"
+	case "doas":
+		return opt == "-u" || opt == "-C"
+	case "nice", "ionice":
+		return opt == "-n" || opt == "-c"
+	case "env":
+		return opt == "-u" || opt == "-C"
+	case "xargs":
+		return opt == "-I" || opt == "-n" || opt == "-P" || opt == "-d" || opt == "-L" || opt == "-s"
+	}
+	return false
+}
+
+type parser struct {
+	line string
+	pos  int
+}
+
+func (p *parser) parse() []Simple {
+	var cmds []Simple
+	var cur Simple
+	started := false
+	start, end := 0, 0
+
+	flush := func(op string) {
+		if started || op != "" {
+			cur.Op = op
+			if len(cur.Words) > 0 || len(cur.Assignments) > 0 || len(cur.Redirects) > 0 {
+				cur.Raw = p.line[start:end]
+				cmds = append(cmds, cur)
+			}
+		}
+		cur = Simple{}
+		started = false
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.line) {
+			break
+		}
+
+		c := p.line[p.pos]
+		switch {
+		case c == '#':
+			// A comment runs to the end of the line
+			p.pos = len(p.line)
+		case c == '\n':
+			p.pos++
+			flush(";")
+		case strings.HasPrefix(p.line[p.pos:], "&&"), strings.HasPrefix(p.line[p.pos:], "||"):
+			op := p.line[p.pos : p.pos+2]
+			p.pos += 2
+			flush(op)
+		case c == '|' || c == ';' || c == '&':
+			p.pos++
+			flush(string(c))
+		case c == '(' || c == ')' || c == '{' && p.atWordEnd(p.pos+1) || c == '}' && p.atWordEnd(p.pos+1):
+			// Grouping only delimits the commands inside it
+			p.pos++
+			flush("")
+		default:
+			if !started {
+				start = p.pos
+			}
+			if op, ok := p.redirectOp(); ok {
+				p.skipSpace()
+				cur.Redirects = append(cur.Redirects, Redirect{Op: op, Target: p.word()})
+				started = true
+				end = p.pos
+				continue
+			}
+			w := p.word()
+			started = true
+			end = p.pos
+			if len(cur.Words) == 0 && isAssignment(w) {
+				cur.Assignments = append(cur.Assignments, w)
+				continue
+			}
+			cur.Words = append(cur.Words, w)
+		}
+	}
+	flush("")
+
+	// The last command has no following operator
+	if n := len(cmds); n > 0 && cmds[n-1].Op == ";" {
+		cmds[n-1].Op = ""
+	}
+	return cmds
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.line) && (p.line[p.pos] == ' ' || p.line[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) atWordEnd(i int) bool {
+	return i >= len(p.line) || strings.ContainsRune(" \t\n;", rune(p.line[i]))
+}
+
+// redirectOp consumes a redirection operator, with an optional leading
+// file descriptor number, if one starts at the current position
+func (p *parser) redirectOp() (string, bool) {
+	i := p.pos
+	for i < len(p.line) && p.line[i] >= '0' && p.line[i] <= '9' {
+		i++
+	}
+	if i < len(p.line) && p.line[i] == '&' && i+1 < len(p.line) && p.line[i+1] == '>' {
+		i++
+	}
+	if i >= len(p.line) || (p.line[i] != '>' && p.line[i] != '<') {
+		return "", false
+	}
+	start := p.pos
+	i++
+	for i < len(p.line) && strings.ContainsRune("<>&|", rune(p.line[i])) {
+		i++
+	}
+	p.pos = i
+	return p.line[start:i], true
+}
+
+// word consumes one word, removing quotes and keeping substitutions whole
+func (p *parser) word() string {
+	var b strings.Builder
+	for p.pos < len(p.line) {
+		c := p.line[p.pos]
+		switch {
+		case strings.ContainsRune(" \t\n;&|<>()", rune(c)):
+			return b.String()
+		case c == '\\' && p.pos+1 < len(p.line):
+			b.WriteByte(p.line[p.pos+1])
+			p.pos += 2
+		case c == '\'':
+			end := strings.IndexByte(p.line[p.pos+1:], '\'')
+			if end < 0 {
+				b.WriteString(p.line[p.pos+1:])
+				p.pos = len(p.line)
+				return b.String()
+			}
+			b.WriteString(p.line[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case c == '"':
+			p.pos++
+			for p.pos < len(p.line) && p.line[p.pos] != '"' {
+				if p.line[p.pos] == '\\' && p.pos+1 < len(p.line) && strings.ContainsRune("\"\\$`", rune(p.line[p.pos+1])) {
+					p.pos++
+				}
+				b.WriteByte(p.line[p.pos])
+				p.pos++
+			}
+			p.pos++
+		case c == '$' && p.pos+1 < len(p.line) && p.line[p.pos+1] == '(':
+			b.WriteString(p.balanced('(', ')'))
+		case c == '`':
+			end := strings.IndexByte(p.line[p.pos+1:], '`')
+			if end < 0 {
+				end = len(p.line) - p.pos - 1
+			}
+			b.WriteString(p.line[p.pos:min(len(p.line), p.pos+end+2)])
+			p.pos = min(len(p.line), p.pos+end+2)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return b.String()
+}
+
+// balanced consumes a $( ... ) substitution, returning it as written
+func (p *parser) balanced(open, close byte) string {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.line) {
+		switch p.line[p.pos] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.line[start:p.pos]
+			}
+		}
+		p.pos++
+	}
+	return p.line[start:]
+}
+
+func isAssignment(w string) bool {
+	eq := strings.IndexByte(w, '=')
+	if eq <= 0 {
+		return false
+	}
+	for i, c := range w[:eq] {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Quote returns word quoted for the shell where it needs to be
+func Quote(word string) string {
+	if word == "" {
+		return "''"
+	}
+	for _, c := range word {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-./=:,+@%^", c)) {
+			return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+		}
+	}
+	return word
+}
+
+// Join quotes words and joins them into a command line
+func Join(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = Quote(w)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,266 @@
+package shellparse
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Transfer is a file transfer a command makes, as far as its command line
+// tells: what it copies from where to where
+type Transfer struct {
+	// Tool is the program making the transfer: scp, sftp, rsync, curl or
+	// wget
+	Tool        string   `json:"tool"`
+	Sources     []string `json:"sources"`
+	Destination string   `json:"destination"`
+	// Direction is one of the Direction constants
+	Direction string `json:"direction"`
+}
+
+// Which way a transfer goes, as seen from the machine running it
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+	// DirectionRemote transfers copy between two other machines
+	DirectionRemote = "remote"
+	// DirectionLocal transfers copy between local paths, as rsync can
+	DirectionLocal = "local"
+	// DirectionSession is an interactive sftp session, whose transfers
+	// are typed at its own prompt
+	DirectionSession = "session"
+)
+
+// Directions are every Direction a transfer can have
+var Directions = []string{DirectionUpload, DirectionDownload, DirectionRemote, DirectionLocal, DirectionSession}
+
+// Options taking a value, for each tool. Only the values that say where
+// a transfer goes are looked at; the rest are skipped so they aren't
+// taken for sources
+var transferValueOptions = map[string]map[string]bool{
+	"scp":   set("-c", "-D", "-F", "-i", "-J", "-l", "-o", "-P", "-S", "-X"),
+	"sftp":  set("-B", "-b", "-c", "-D", "-F", "-i", "-J", "-l", "-o", "-P", "-R", "-S", "-s", "-X"),
+	"rsync": set("-e", "-B", "-f", "-M", "-T", "--rsh", "--exclude", "--include", "--filter", "--exclude-from", "--include-from", "--files-from", "--port", "--chmod", "--chown", "--log-file", "--backup-dir", "--suffix", "--temp-dir", "--compare-dest", "--copy-dest", "--link-dest", "--partial-dir", "--bwlimit", "--timeout", "--password-file", "--rsync-path"),
+	"curl": set("-o", "-T", "-H", "-d", "-X", "-u", "-A", "-e", "-b", "-c", "-F", "-x", "-m", "-w", "-K", "-r", "-E", "-U", "-Y", "-y", "-z", "-C",
+		"--output", "--upload-file", "--header", "--data", "--data-raw", "--data-binary", "--data-urlencode", "--request", "--user",
+		"--user-agent", "--referer", "--cookie", "--cookie-jar", "--form", "--proxy", "--max-time", "--write-out", "--config",
+		"--range", "--cert", "--key", "--cacert", "--connect-timeout", "--retry", "--output-dir", "--url", "--resolve"),
+	"wget": set("-O", "-P", "-o", "-a", "-U", "-t", "-T", "-e", "-i", "-w", "-Q", "-l", "-A", "-R", "-D", "-X", "-I",
+		"--output-document", "--directory-prefix", "--output-file", "--append-output", "--user-agent", "--tries", "--timeout",
+		"--execute", "--input-file", "--wait", "--quota", "--level", "--accept", "--reject", "--domains", "--header", "--user",
+		"--password", "--http-user", "--http-password", "--post-data", "--post-file", "--load-cookies", "--save-cookies"),
+}
+
+func set(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// Transfers returns the file transfers a command line makes
+func Transfers(line string) []Transfer {
+	var transfers []Transfer
+	for _, c := range Parse(line) {
+		if t, ok := c.Transfer(); ok {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers
+}
+
+// Transfer reports the file transfer the command makes, if it runs scp,
+// sftp, rsync, curl saving or uploading a file, or wget
+func (s Simple) Transfer() (Transfer, bool) {
+	name, args, _ := s.Program()
+	valueOptions, ok := transferValueOptions[name]
+	if !ok {
+		return Transfer{}, false
+	}
+	operands, flags, values := splitOptions(args, valueOptions)
+	t := Transfer{Tool: name}
+
+	switch name {
+	case "scp", "rsync":
+		if len(operands) < 2 {
+			return Transfer{}, false
+		}
+		t.Sources, t.Destination = operands[:len(operands)-1], operands[len(operands)-1]
+	case "sftp":
+		if len(operands) == 0 {
+			return Transfer{}, false
+		}
+		if !strings.Contains(trimUser(operands[0]), ":") || strings.HasSuffix(operands[0], ":") {
+			// Only a host: the transfers are made at sftp's own prompt
+			t.Destination = strings.TrimSuffix(operands[0], ":")
+			t.Direction = DirectionSession
+			return t, true
+		}
+		t.Sources, t.Destination = operands[:1], "."
+		if len(operands) > 1 {
+			t.Destination = operands[1]
+		}
+	case "curl":
+		urls := append(values["--url"], operands...)
+		if len(urls) == 0 {
+			return Transfer{}, false
+		}
+		t.Direction = DirectionDownload
+		switch {
+		case len(values["-T"]) > 0 || len(values["--upload-file"]) > 0:
+			t.Sources = append(values["-T"], values["--upload-file"]...)
+			t.Destination = urls[0]
+			t.Direction = DirectionUpload
+		case len(values["-o"]) > 0 || len(values["--output"]) > 0:
+			t.Sources = urls
+			t.Destination = lastOf(append(values["-o"], values["--output"]...))
+		case flags["-O"] || flags["--remote-name"] || flags["--remote-name-all"] || flags["-J"]:
+			t.Sources = urls
+			t.Destination = savedAs(urls, lastOf(values["--output-dir"]))
+		case redirectTarget(s.Redirects) != "":
+			t.Sources = urls
+			t.Destination = redirectTarget(s.Redirects)
+		default:
+			// Printed, not saved
+			return Transfer{}, false
+		}
+	case "wget":
+		if len(operands) == 0 {
+			return Transfer{}, false
+		}
+		t.Sources = operands
+		t.Direction = DirectionDownload
+		switch {
+		case len(values["-O"]) > 0 || len(values["--output-document"]) > 0:
+			t.Destination = lastOf(append(values["-O"], values["--output-document"]...))
+		default:
+			t.Destination = savedAs(operands, lastOf(append(values["-P"], values["--directory-prefix"]...)))
+		}
+	}
+
+	if t.Direction == "" {
+		t.Direction = direction(t)
+	}
+	return t, true
+}
+
+// splitOptions separates a tool's operands from its options, reporting
+// the options given and the values of those taking one. Options may
+// follow operands, as GNU tools allow, until "--"
+func splitOptions(args []string, valueOptions map[string]bool) (operands []string, flags map[string]bool, values map[string][]string) {
+	flags = make(map[string]bool)
+	values = make(map[string][]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(operands, args[i+1:]...), flags, values
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg, "=")
+			if valueOptions[name] && !hasValue && i+1 < len(args) {
+				i++
+				value, hasValue = args[i], true
+			}
+			if hasValue {
+				values[name] = append(values[name], value)
+			}
+			flags[name] = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				opt := "-" + arg[j:j+1]
+				flags[opt] = true
+				if !valueOptions[opt] {
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				values[opt] = append(values[opt], value)
+				break
+			}
+		default:
+			operands = append(operands, arg)
+		}
+	}
+	return operands, flags, values
+}
+
+// isRemote reports whether a transfer operand names another machine: a
+// URL, or an scp and rsync style [user@]host:path or host::module
+func isRemote(operand string) bool {
+	if strings.Contains(operand, "://") {
+		return true
+	}
+	host, _, found := strings.Cut(trimUser(operand), ":")
+	return found && host != "" && !strings.Contains(host, "/")
+}
+
+// trimUser drops the user@ part of an scp style operand
+func trimUser(operand string) string {
+	if at := strings.IndexByte(operand, '@'); at >= 0 && !strings.Contains(operand[:at], "/") {
+		return operand[at+1:]
+	}
+	return operand
+}
+
+// direction tells which way an scp, sftp or rsync transfer goes from
+// which of its ends are remote
+func direction(t Transfer) string {
+	sourceRemote := false
+	for _, s := range t.Sources {
+		if isRemote(s) {
+			sourceRemote = true
+		}
+	}
+	destRemote := isRemote(t.Destination)
+	switch {
+	case sourceRemote && destRemote:
+		return DirectionRemote
+	case destRemote:
+		return DirectionUpload
+	case sourceRemote:
+		return DirectionDownload
+	}
+	return DirectionLocal
+}
+
+// savedAs is where downloading urls into dir saves them: the file named
+// after the URL's path for a single URL, and dir itself for several
+func savedAs(urls []string, dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	if len(urls) != 1 {
+		return dir
+	}
+	name := "index.html"
+	if u, err := url.Parse(urls[0]); err == nil {
+		if base := path.Base(u.Path); base != "/" && base != "." {
+			name = base
+		}
+	}
+	if dir == "." {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
+// redirectTarget is the file a command's output is redirected to, if any
+func redirectTarget(redirects []Redirect) string {
+	for _, r := range redirects {
+		if r.Op == ">" || r.Op == ">>" || r.Op == "1>" || r.Op == "&>" {
+			return r.Target
+		}
+	}
+	return ""
+}
+
+func lastOf(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
@@ -0,0 +1,36 @@
+// Package sqlite3 runs SQL through the sqlite3 command-line shell, so that
+// reading and writing SQLite databases needs no cgo driver.
+package sqlite3
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Run runs sqlite3 with args, feeding it stdin unless it is nil, and
+// returns what it printed. Errors carry what it printed on stderr
+func Run(stdin *strings.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("sqlite3", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("sqlite3: %s", msg)
+		}
+		return nil, fmt.Errorf("failed to run sqlite3: %w", err)
+	}
+	return out, nil
+}
+
+// Quote returns s as an SQL string literal
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
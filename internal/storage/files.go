@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// filesBackend keeps commands in the workspace's history file, as bashlog
+// always has, with its stats and day rollups cached alongside
+type filesBackend struct{}
+
+func (filesBackend) Name() string { return Files }
+
+func (filesBackend) OpenWorkspace(wsPath string) error {
+	f, err := workspace.FileMode(wsPath).OpenFile(filepath.Join(wsPath, workspace.HistoryFile), os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (filesBackend) AppendRecord(wsPath string, entries []workspace.Entry) error {
+	return workspace.Append(wsPath, entries)
+}
+
+func (filesBackend) AppendRecords(wsPath string, records []workspace.Record) error {
+	return workspace.AppendRecords(wsPath, records)
+}
+
+func (filesBackend) Iterate(wsPath string, fn func(e workspace.Entry) bool) error {
+	return workspace.ScanHistory(filepath.Join(wsPath, workspace.HistoryFile), 0, func(e workspace.Entry, _ int64) bool {
+		return fn(e)
+	})
+}
+
+func (b filesBackend) Search(wsPath, query string, ignoreCase bool) ([]workspace.Entry, error) {
+	if ignoreCase {
+		query = strings.ToLower(query)
+	}
+	var found []workspace.Entry
+	err := b.Iterate(wsPath, func(e workspace.Entry) bool {
+		command := e.Command
+		if ignoreCase {
+			command = strings.ToLower(command)
+		}
+		if strings.Contains(command, query) {
+			found = append(found, e)
+		}
+		return true
+	})
+	return found, err
+}
+
+func (filesBackend) Stats(wsPath string, idleAfter time.Duration) (*workspace.Stats, error) {
+	return workspace.LoadStats(wsPath, idleAfter)
+}
@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/postgres"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Settings of ~/.bashlog/config.txt for the postgres backend
+const (
+	// PostgresURLSetting is the database to connect to, as
+	// postgres://user@host/database. The password is better left to
+	// $PGPASSWORD than written here
+	PostgresURLSetting = "storage.postgres.url"
+	// PostgresPoolSetting is how many connections a process keeps open at
+	// most, 4 by default
+	PostgresPoolSetting = "storage.postgres.pool"
+	// PostgresOwnerSetting is the tenant new workspaces belong to, the
+	// local user by default
+	PostgresOwnerSetting = "storage.postgres.owner"
+)
+
+// OwnerKey is the key of a workspace's config file naming the tenant its
+// rows belong to in a shared database
+const OwnerKey = "owner"
+
+// defaultPoolSize is the size of the connection pool unless set
+const defaultPoolSize = 4
+
+// postgresPage is how many commands Iterate fetches at a time
+const postgresPage = 5000
+
+// postgresBatch is how many commands AppendRecord inserts per statement,
+// well under the protocol's 65535 parameters
+const postgresBatch = 1000
+
+// postgresMigrations bring the schema up to date, each applied once in
+// order and recorded in bashlog_schema. They are only ever added to
+var postgresMigrations = []string{
+	// 1: workspaces and their commands. Workspaces are told apart by owner
+	// as well as name, so teams sharing a server can both have a "prod",
+	// and commands carry their owner too, for row-level security policies
+	// to be keyed on
+	`CREATE TABLE bashlog_workspaces (
+		id bigserial PRIMARY KEY,
+		owner text NOT NULL,
+		name text NOT NULL,
+		created timestamptz NOT NULL DEFAULT now(),
+		UNIQUE (owner, name)
+	);
+	CREATE TABLE bashlog_commands (
+		id bigserial PRIMARY KEY,
+		workspace_id bigint NOT NULL REFERENCES bashlog_workspaces (id) ON DELETE CASCADE,
+		owner text NOT NULL,
+		recorded_at timestamptz,
+		command text NOT NULL
+	);
+	CREATE INDEX bashlog_commands_workspace ON bashlog_commands (workspace_id, id);`,
+
+	// 2: a tenant's commands by time, for reporting across its workspaces
+	`CREATE INDEX bashlog_commands_owner ON bashlog_commands (owner, recorded_at);`,
+}
+
+// postgresMigrationLock is the advisory lock servers sharing a database
+// take while migrating, so only one applies each migration
+const postgresMigrationLock = 0x626173686c6f67
+
+// postgresBackend keeps commands in a PostgreSQL database, for team
+// servers whose workspaces outgrow files, or that run on several hosts.
+// The connection pool is opened, and the schema migrated, when first
+// needed
+type postgresBackend struct {
+	mu       sync.Mutex
+	url      string
+	poolSize int
+	owner    string
+	pool     *postgres.Pool
+	migrated bool
+}
+
+func (*postgresBackend) Name() string { return Postgres }
+
+// configure takes the backend's settings
+func (b *postgresBackend) configure(settings map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.url = settings[PostgresURLSetting]
+	b.poolSize = defaultPoolSize
+	if v, ok := settings[PostgresPoolSetting]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s: invalid pool size %q", PostgresPoolSetting, v)
+		}
+		b.poolSize = n
+	}
+	b.owner = settings[PostgresOwnerSetting]
+	if b.owner == "" {
+		if current, err := user.Current(); err == nil {
+			b.owner = current.Username
+		}
+	}
+	return nil
+}
+
+// connect returns the backend's pool, opening it and migrating the schema
+// on first use. A failure is retried on the next call
+func (b *postgresBackend) connect() (*postgres.Pool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pool, err := b.open()
+	if err != nil || b.migrated {
+		return pool, err
+	}
+	if err := migratePostgres(pool); err != nil {
+		return nil, err
+	}
+	b.migrated = true
+	return pool, nil
+}
+
+// open returns the backend's pool, opening it without migrating. b.mu must
+// be held
+func (b *postgresBackend) open() (*postgres.Pool, error) {
+	if b.pool != nil {
+		return b.pool, nil
+	}
+	if b.url == "" {
+		return nil, fmt.Errorf("postgres storage needs the %s setting", PostgresURLSetting)
+	}
+	config, err := postgres.ParseURL(b.url)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", PostgresURLSetting, err)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	b.pool = postgres.NewPool(config, b.poolSize)
+	return b.pool, nil
+}
+
+// SchemaVersion reports the version of the shared database, whichever
+// workspace is asked about
+func (b *postgresBackend) SchemaVersion(string) (current, latest int, err error) {
+	b.mu.Lock()
+	pool, err := b.open()
+	b.mu.Unlock()
+	if err != nil {
+		return 0, len(postgresMigrations), err
+	}
+	current, err = postgresVersion(pool)
+	return current, len(postgresMigrations), err
+}
+
+func (b *postgresBackend) MigrateSchema(string) error {
+	_, err := b.connect()
+	return err
+}
+
+// postgresVersion returns the latest migration the database has had, 0 if
+// bashlog has never set it up
+func postgresVersion(q interface {
+	Query(sql string, args ...any) (*postgres.Result, error)
+}) (int, error) {
+	result, err := q.Query("SELECT to_regclass('bashlog_schema') IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] == nil || *result.Rows[0][0] != "t" {
+		return 0, nil
+	}
+	result, err = q.Query("SELECT coalesce(max(version), 0) FROM bashlog_schema")
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	if len(result.Rows) == 1 && result.Rows[0][0] != nil {
+		current, _ = strconv.Atoi(*result.Rows[0][0])
+	}
+	return current, nil
+}
+
+// migratePostgres applies the migrations the database hasn't had yet
+func migratePostgres(pool *postgres.Pool) error {
+	return pool.Tx(func(c *postgres.Conn) error {
+		if _, err := c.Query("SELECT pg_advisory_xact_lock($1)", int64(postgresMigrationLock)); err != nil {
+			return err
+		}
+		if err := c.Exec(`CREATE TABLE IF NOT EXISTS bashlog_schema (
+			version integer PRIMARY KEY,
+			applied timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+			return err
+		}
+		current, err := postgresVersion(c)
+		if err != nil {
+			return err
+		}
+		if current > len(postgresMigrations) {
+			return fmt.Errorf("the database schema is at version %d, newer than this bashlog knows (%d)", current, len(postgresMigrations))
+		}
+		for version := current + 1; version <= len(postgresMigrations); version++ {
+			if err := c.Exec(postgresMigrations[version-1]); err != nil {
+				return fmt.Errorf("migration %d: %w", version, err)
+			}
+			if _, err := c.Query("INSERT INTO bashlog_schema (version) VALUES ($1)", version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// key returns the owner and name the workspace at wsPath has in the
+// database
+func (b *postgresBackend) key(wsPath string) (owner, name string) {
+	owner = workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))[OwnerKey]
+	if owner == "" {
+		b.mu.Lock()
+		owner = b.owner
+		b.mu.Unlock()
+	}
+	return owner, filepath.Base(wsPath)
+}
+
+func (b *postgresBackend) OpenWorkspace(wsPath string) error {
+	pool, err := b.connect()
+	if err != nil {
+		return err
+	}
+	owner, name := b.key(wsPath)
+	configPath := filepath.Join(wsPath, workspace.ConfigFile)
+	if _, ok := workspace.ReadConfig(configPath)[OwnerKey]; !ok {
+		if err := workspace.SetConfigValue(configPath, OwnerKey, owner); err != nil {
+			return err
+		}
+	}
+	_, err = pool.Query("INSERT INTO bashlog_workspaces (owner, name) VALUES ($1, $2) ON CONFLICT (owner, name) DO NOTHING", owner, name)
+	return err
+}
+
+func (b *postgresBackend) AppendRecord(wsPath string, entries []workspace.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pool, err := b.connect()
+	if err != nil {
+		return err
+	}
+
+	// The workspace lock keeps the command count in its config in step,
+	// the database needing none of its own
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	owner, name := b.key(wsPath)
+	err = pool.Tx(func(c *postgres.Conn) error {
+		// A workspace created on another server, or before the database
+		// was set up, gets its row with its first commands
+		result, err := c.Query(`INSERT INTO bashlog_workspaces (owner, name) VALUES ($1, $2)
+			ON CONFLICT (owner, name) DO UPDATE SET name = excluded.name RETURNING id`, owner, name)
+		if err != nil {
+			return err
+		}
+		if len(result.Rows) != 1 || result.Rows[0][0] == nil {
+			return errors.New("postgres: no workspace id returned")
+		}
+		id := *result.Rows[0][0]
+
+		for start := 0; start < len(entries); start += postgresBatch {
+			batch := entries[start:min(start+postgresBatch, len(entries))]
+			var sql strings.Builder
+			sql.WriteString("INSERT INTO bashlog_commands (workspace_id, owner, recorded_at, command) VALUES ")
+			args := []any{id, owner}
+			for i, e := range batch {
+				if i > 0 {
+					sql.WriteString(", ")
+				}
+				var unix any
+				if !e.Time.IsZero() {
+					unix = e.Time.Unix()
+				}
+				args = append(args, unix, workspace.FlattenCommand(e.Command))
+				fmt.Fprintf(&sql, "($1, $2, to_timestamp($%d), $%d)", len(args)-1, len(args))
+			}
+			if _, err := c.Query(sql.String(), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(wsPath, workspace.ConfigFile)
+	count := 0
+	fmt.Sscanf(workspace.ReadConfig(configPath)["commands"], "%d", &count)
+	return workspace.SetConfigValue(configPath, "commands", fmt.Sprintf("%d", count+len(entries)))
+}
+
+func (b *postgresBackend) Iterate(wsPath string, fn func(e workspace.Entry) bool) error {
+	return b.query(wsPath, "", nil, fn)
+}
+
+func (b *postgresBackend) Search(wsPath, query string, ignoreCase bool) ([]workspace.Entry, error) {
+	var where string
+	var args []any
+	switch {
+	case query == "":
+	case ignoreCase:
+		where, args = "AND strpos(lower(command), lower($4)) > 0", []any{query}
+	default:
+		where, args = "AND strpos(command, $4) > 0", []any{query}
+	}
+	var found []workspace.Entry
+	err := b.query(wsPath, where, args, func(e workspace.Entry) bool {
+		found = append(found, e)
+		return true
+	})
+	return found, err
+}
+
+func (b *postgresBackend) Stats(wsPath string, idleAfter time.Duration) (*workspace.Stats, error) {
+	var entries []workspace.Entry
+	err := b.Iterate(wsPath, func(e workspace.Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workspace.ComputeStats(entries, idleAfter), nil
+}
+
+// query calls fn with the commands of the workspace at wsPath that also
+// match where, a condition on $4 on, in the order they were recorded. They
+// are fetched a page at a time, so a large history is never held whole
+func (b *postgresBackend) query(wsPath, where string, args []any, fn func(e workspace.Entry) bool) error {
+	pool, err := b.connect()
+	if err != nil {
+		return err
+	}
+	owner, name := b.key(wsPath)
+	sql := `SELECT c.id, extract(epoch FROM c.recorded_at)::bigint, c.command
+		FROM bashlog_commands c JOIN bashlog_workspaces w ON w.id = c.workspace_id
+		WHERE w.owner = $1 AND w.name = $2 AND c.id > $3 ` + where + `
+		ORDER BY c.id LIMIT ` + strconv.Itoa(postgresPage)
+
+	var after int64
+	for {
+		result, err := pool.Query(sql, append([]any{owner, name, after}, args...)...)
+		if err != nil {
+			return err
+		}
+		for _, row := range result.Rows {
+			if len(row) != 3 || row[0] == nil || row[2] == nil {
+				return errors.New("postgres: unexpected row")
+			}
+			after, _ = strconv.ParseInt(*row[0], 10, 64)
+			e := workspace.Entry{Command: *row[2]}
+			if row[1] != nil {
+				unix, _ := strconv.ParseInt(*row[1], 10, 64)
+				e.Time = time.Unix(unix, 0)
+			}
+			if !fn(e) {
+				return nil
+			}
+		}
+		if len(result.Rows) < postgresPage {
+			return nil
+		}
+	}
+}
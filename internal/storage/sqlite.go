@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/sqlite3"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// DatabaseFile is the database of an SQLite workspace, in its directory
+const DatabaseFile = "history.db"
+
+// sqliteMigrations bring a database's schema up to date, each applied once
+// in order, the version reached kept as its user_version. They are only
+// ever added to
+var sqliteMigrations = []string{
+	// 1: one row per command, numbered in the order they were recorded.
+	// Timestamps are unix seconds, as history files have them, and NULL
+	// for commands recorded without one. Databases created before
+	// versioning already have it, at version 0
+	`CREATE TABLE IF NOT EXISTS history (
+		id integer primary key,
+		timestamp integer,
+		command text not null
+	);
+	CREATE INDEX IF NOT EXISTS history_timestamp ON history(timestamp);`,
+}
+
+// sqliteBackend keeps commands in an SQLite database in the workspace.
+// Like the atuin import, it goes through the sqlite3 command-line tool so
+// that bashlog does not need a cgo sqlite driver
+type sqliteBackend struct{}
+
+func (sqliteBackend) Name() string { return SQLite }
+
+func (b sqliteBackend) OpenWorkspace(wsPath string) error {
+	if err := b.MigrateSchema(wsPath); err != nil {
+		return err
+	}
+	return os.Chmod(filepath.Join(wsPath, DatabaseFile), workspace.FileMode(wsPath).File)
+}
+
+func (sqliteBackend) SchemaVersion(wsPath string) (current, latest int, err error) {
+	dbPath := filepath.Join(wsPath, DatabaseFile)
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, len(sqliteMigrations), err
+	}
+	out, err := sqlite3.Run(nil, "-readonly", dbPath, "PRAGMA user_version")
+	if err != nil {
+		return 0, len(sqliteMigrations), err
+	}
+	current, err = strconv.Atoi(strings.TrimSpace(string(out)))
+	return current, len(sqliteMigrations), err
+}
+
+func (b sqliteBackend) MigrateSchema(wsPath string) error {
+	current, latest, err := b.SchemaVersion(wsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%s: schema version %d is newer than this bashlog knows (%d)", DatabaseFile, current, latest)
+	}
+	var script strings.Builder
+	for version := current + 1; version <= latest; version++ {
+		fmt.Fprintf(&script, "BEGIN;\n%s\nPRAGMA user_version = %d;\nCOMMIT;\n", sqliteMigrations[version-1], version)
+	}
+	if script.Len() == 0 {
+		return nil
+	}
+	_, err = sqlite3.Run(strings.NewReader(script.String()), filepath.Join(wsPath, DatabaseFile))
+	return err
+}
+
+func (sqliteBackend) AppendRecord(wsPath string, entries []workspace.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	lock, err := workspace.LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	var script strings.Builder
+	script.WriteString("BEGIN;\n")
+	for _, e := range entries {
+		timestamp := "NULL"
+		if !e.Time.IsZero() {
+			timestamp = fmt.Sprint(e.Time.Unix())
+		}
+		fmt.Fprintf(&script, "INSERT INTO history (timestamp, command) VALUES (%s, %s);\n",
+			timestamp, sqlite3.Quote(workspace.FlattenCommand(e.Command)))
+	}
+	script.WriteString("COMMIT;\n")
+	if _, err := sqlite3.Run(strings.NewReader(script.String()), filepath.Join(wsPath, DatabaseFile)); err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(wsPath, workspace.ConfigFile)
+	count := 0
+	fmt.Sscanf(workspace.ReadConfig(configPath)["commands"], "%d", &count)
+	return workspace.SetConfigValue(configPath, "commands", fmt.Sprintf("%d", count+len(entries)))
+}
+
+func (b sqliteBackend) Iterate(wsPath string, fn func(e workspace.Entry) bool) error {
+	entries, err := b.query(wsPath, "")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !fn(e) {
+			break
+		}
+	}
+	return nil
+}
+
+func (b sqliteBackend) Search(wsPath, query string, ignoreCase bool) ([]workspace.Entry, error) {
+	if query == "" {
+		return b.query(wsPath, "")
+	}
+	// instr matches literally, where LIKE would take % and _ in the query
+	// as wildcards. SQLite's lower only folds ASCII, the files backend
+	// folds all of Unicode
+	if ignoreCase {
+		return b.query(wsPath, fmt.Sprintf("WHERE instr(lower(command), lower(%s)) > 0", sqlite3.Quote(query)))
+	}
+	return b.query(wsPath, fmt.Sprintf("WHERE instr(command, %s) > 0", sqlite3.Quote(query)))
+}
+
+func (b sqliteBackend) Stats(wsPath string, idleAfter time.Duration) (*workspace.Stats, error) {
+	entries, err := b.query(wsPath, "")
+	if err != nil {
+		return nil, err
+	}
+	return workspace.ComputeStats(entries, idleAfter), nil
+}
+
+// query returns the commands of the workspace at wsPath picked by where, a
+// WHERE clause or empty for all, in the order they were recorded
+func (sqliteBackend) query(wsPath, where string) ([]workspace.Entry, error) {
+	dbPath := filepath.Join(wsPath, DatabaseFile)
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	out, err := sqlite3.Run(nil, "-readonly", "-json", dbPath, "SELECT timestamp, command FROM history "+where+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Timestamp *int64 `json:"timestamp"`
+		Command   string `json:"command"`
+	}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	entries := make([]workspace.Entry, 0, len(rows))
+	for _, row := range rows {
+		e := workspace.Entry{Command: row.Command}
+		if row.Timestamp != nil {
+			e.Time = time.Unix(*row.Timestamp, 0)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,206 @@
+// Package storage keeps the commands recorded in workspaces behind a
+// Backend, so command handlers append, read and search them the same way
+// whatever holds them.
+//
+// Each workspace records the backend it was created with in its config
+// file. Workspaces that don't, such as those created before there was a
+// choice, keep their commands in the history file.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// Setting is the key of ~/.bashlog/config.txt choosing the backend new
+// workspaces are created with, and of a workspace's config file recording
+// its own
+const Setting = "storage"
+
+// Backends bashlog comes with
+const (
+	// Files keeps commands in the workspace's history.log, in bash history
+	// format
+	Files = "files"
+	// SQLite keeps them in a database in the workspace, history.db,
+	// through the sqlite3 command-line tool
+	SQLite = "sqlite"
+	// Postgres keeps them in a PostgreSQL database that a team server's
+	// workspaces share, as set with the storage.postgres.* settings
+	Postgres = "postgres"
+)
+
+// ErrUnknown is returned for a backend name that isn't one of Names
+var ErrUnknown = errors.New("unknown storage backend")
+
+// Backend holds the commands of workspaces. Workspaces are named by their
+// directory, which keeps their config, tags, notes and the like whatever
+// the backend, so they are moved, archived and trashed as before
+type Backend interface {
+	// Name is the name the backend is selected by
+	Name() string
+
+	// OpenWorkspace sets up the store of the workspace at wsPath, a
+	// directory already holding its config, creating it empty if new
+	OpenWorkspace(wsPath string) error
+
+	// AppendRecord adds entries to the workspace at wsPath under its lock
+	// and bumps its command count
+	AppendRecord(wsPath string, entries []workspace.Entry) error
+
+	// Iterate calls fn with each command of the workspace at wsPath,
+	// oldest first, until fn returns false
+	Iterate(wsPath string, fn func(e workspace.Entry) bool) error
+
+	// Search returns the commands of the workspace at wsPath containing
+	// query, ignoring case if asked to, oldest first. An empty query
+	// matches every command
+	Search(wsPath, query string, ignoreCase bool) ([]workspace.Entry, error)
+
+	// Stats summarizes the workspace at wsPath, counting gaps over
+	// idleAfter as idle time
+	Stats(wsPath string, idleAfter time.Duration) (*workspace.Stats, error)
+}
+
+// Migrator is implemented by backends whose stores have a schema of their
+// own, versioned apart from the workspace layout
+type Migrator interface {
+	// SchemaVersion reports the version the store of the workspace at
+	// wsPath has its schema at, and the latest this bashlog knows. A
+	// store shared by workspaces reports the same for each
+	SchemaVersion(wsPath string) (current, latest int, err error)
+
+	// MigrateSchema applies the changes the schema hasn't had yet
+	MigrateSchema(wsPath string) error
+}
+
+// RecordAppender is implemented by backends that keep the fields records
+// carry beside their entries, as the files backend does in v2 records
+type RecordAppender interface {
+	// AppendRecords adds records to the workspace at wsPath as
+	// AppendRecord adds entries
+	AppendRecords(wsPath string, records []workspace.Record) error
+}
+
+// postgresStore is configured by Configure, the other backends needing no
+// settings
+var postgresStore = &postgresBackend{poolSize: defaultPoolSize}
+
+var backends = map[string]Backend{
+	Files:    filesBackend{},
+	SQLite:   sqliteBackend{},
+	Postgres: postgresStore,
+}
+
+// Default is the backend new workspaces are created with
+var Default Backend = filesBackend{}
+
+// Names lists the backends that can be selected, sorted
+func Names() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the backend called name
+func New(name string) (Backend, error) {
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: want one of %v", ErrUnknown, name, Names())
+	}
+	return b, nil
+}
+
+// Configure sets Default from settings, leaving it Files unless they set
+// Setting, and the backends that need them their own settings
+func Configure(settings map[string]string) error {
+	if err := postgresStore.configure(settings); err != nil {
+		return err
+	}
+	name, ok := settings[Setting]
+	if !ok {
+		return nil
+	}
+	b, err := New(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", Setting, err)
+	}
+	Default = b
+	return nil
+}
+
+// For returns the backend of the workspace at wsPath, as recorded in its
+// config file
+func For(wsPath string) Backend {
+	name, ok := workspace.ReadConfig(filepath.Join(wsPath, workspace.ConfigFile))[Setting]
+	if !ok {
+		return backends[Files]
+	}
+	b, err := New(name)
+	if err != nil {
+		slog.Warn("reading workspace as files", "path", wsPath, "err", err)
+		return backends[Files]
+	}
+	return b
+}
+
+// Read returns every command of the workspace at wsPath, oldest first
+func Read(wsPath string) ([]workspace.Entry, error) {
+	b := For(wsPath)
+	if _, ok := b.(filesBackend); ok {
+		return workspace.ReadHistory(filepath.Join(wsPath, workspace.HistoryFile))
+	}
+	var entries []workspace.Entry
+	err := b.Iterate(wsPath, func(e workspace.Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	return entries, err
+}
+
+// AppendRecords adds records to the workspace at wsPath, with their fields
+// where its backend keeps them
+func AppendRecords(wsPath string, records []workspace.Record) error {
+	b := For(wsPath)
+	if a, ok := b.(RecordAppender); ok {
+		return a.AppendRecords(wsPath, records)
+	}
+	return b.AppendRecord(wsPath, workspace.EntriesOf(records))
+}
+
+// ReadRecords returns every command of the workspace at wsPath with the
+// fields its backend kept beside them, oldest first
+func ReadRecords(wsPath string) ([]workspace.Record, error) {
+	if _, ok := For(wsPath).(filesBackend); ok {
+		return workspace.ReadRecords(filepath.Join(wsPath, workspace.HistoryFile))
+	}
+	entries, err := Read(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	return workspace.RecordsOf(entries), nil
+}
+
+// ReadDay returns the commands of the workspace at wsPath run on the local
+// day of day, numbered by their place in the whole history
+func ReadDay(wsPath string, day time.Time) ([]workspace.DayEntry, error) {
+	if _, ok := For(wsPath).(filesBackend); ok {
+		// History files are rolled up by day, so this skips reading them
+		// whole
+		return workspace.ReadDay(wsPath, day)
+	}
+	entries, err := Read(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	return workspace.DayOf(entries, day), nil
+}
@@ -0,0 +1,185 @@
+// Package suggest completes command lines from what was run before.
+//
+// It keeps a frequency model of every recorded command, across sessions
+// and workspaces, in which each run weighs less the longer ago it was. The
+// same run is often kept more than once, in the session logs and in each
+// workspace it was recorded or copied into, so runs are told apart by
+// their text and timestamp and only counted once.
+package suggest
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+	"github.com/interhack86/bashlog/internal/workspace"
+)
+
+// HalfLife is how long ago a run counts for half as much as one now
+const HalfLife = 30 * 24 * time.Hour
+
+// untimedWeight is what a run without a timestamp counts for, as much as
+// one of two half-lives ago
+const untimedWeight = 0.25
+
+// Scored is a command of the model
+type Scored struct {
+	Command string  `json:"command"`
+	Score   float64 `json:"score"`
+	Runs    int     `json:"runs"`
+	// Last is when it was last run, 0 for commands with no timestamp
+	Last int64 `json:"last,omitempty"`
+}
+
+// Source is a file the model was built from, as it was then
+type Source struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// Model is the commands run before, most likely first
+type Model struct {
+	Built    time.Time `json:"built"`
+	Sources  []Source  `json:"sources"`
+	Commands []Scored  `json:"commands"`
+}
+
+// Build scores the commands of entries as of now
+func Build(entries []workspace.Entry, now time.Time) *Model {
+	type run struct {
+		command string
+		unix    int64
+	}
+	seen := make(map[run]bool)
+	byCommand := make(map[string]*Scored)
+	for _, e := range entries {
+		command := strings.TrimSpace(e.Command)
+		if command == "" {
+			continue
+		}
+		weight := untimedWeight
+		var unix int64
+		if !e.Time.IsZero() {
+			unix = e.Time.Unix()
+			r := run{command, unix}
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+			age := now.Sub(e.Time)
+			weight = math.Pow(0.5, math.Max(0, age.Hours())/HalfLife.Hours())
+		}
+
+		s := byCommand[command]
+		if s == nil {
+			s = &Scored{Command: command}
+			byCommand[command] = s
+		}
+		s.Score += weight
+		s.Runs++
+		s.Last = max(s.Last, unix)
+	}
+
+	m := &Model{Built: now}
+	for _, s := range byCommand {
+		m.Commands = append(m.Commands, *s)
+	}
+	sort.Slice(m.Commands, func(i, j int) bool {
+		a, b := m.Commands[i], m.Commands[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Last != b.Last {
+			return a.Last > b.Last
+		}
+		return a.Command < b.Command
+	})
+	return m
+}
+
+// Complete returns up to n of the most likely commands starting with
+// prefix, other than prefix itself
+func (m *Model) Complete(prefix string, n int) []Scored {
+	var found []Scored
+	for _, s := range m.Commands {
+		if len(found) == n {
+			break
+		}
+		if s.Command != prefix && strings.HasPrefix(s.Command, prefix) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// Stat describes the files at paths as they are now, skipping those that
+// are gone
+func Stat(paths []string) []Source {
+	var sources []Source
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			sources = append(sources, Source{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()})
+		}
+	}
+	return sources
+}
+
+// Current reports whether the model was built from sources as they are, so
+// there is nothing new to learn from them
+func (m *Model) Current(sources []Source) bool {
+	if len(m.Sources) != len(sources) {
+		return false
+	}
+	for i := range sources {
+		if m.Sources[i] != sources[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Load reads a model saved at path
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Save writes the model to path, for Load to read back
+func (m *Model) Save(path string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// Written aside and renamed into place, so suggestions asked for at
+	// the same time never read half a model
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(fsperm.Default.File); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,177 @@
+// Package transcript reads the terminal output bashlog records in PTY
+// mode: it renders the raw bytes down to plain text and pairs each
+// recorded command with the output that followed it.
+package transcript
+
+import (
+	"strings"
+	"time"
+)
+
+// Clean renders raw terminal output as plain text. Escape sequences
+// (colors, cursor movement, window titles, bracketed paste) are dropped,
+// and carriage returns and backspaces overwrite the current line the way
+// a terminal would show it
+func Clean(raw []byte) string {
+	var out strings.Builder
+	var line []rune
+	col := 0
+
+	put := func(r rune) {
+		if col < len(line) {
+			line[col] = r
+		} else {
+			line = append(line, r)
+		}
+		col++
+	}
+	endLine := func() {
+		out.WriteString(strings.TrimRight(string(line), " "))
+		out.WriteByte('\n')
+		line = line[:0]
+		col = 0
+	}
+
+	s := []rune(string(raw))
+	for i := 0; i < len(s); i++ {
+		r := s[i]
+		switch {
+		case r == 0x1b:
+			i = skipEscape(s, i)
+		case r == '\n':
+			endLine()
+		case r == '\r':
+			col = 0
+		case r == '\b':
+			if col > 0 {
+				col--
+			}
+		case r == '\t':
+			for put(' '); col%8 != 0; {
+				put(' ')
+			}
+		case r < 0x20 || r == 0x7f:
+			// Other control characters don't print
+		default:
+			put(r)
+		}
+	}
+	if len(line) > 0 {
+		endLine()
+	}
+	return out.String()
+}
+
+// skipEscape returns the index of the last rune of the escape sequence
+// starting at s[i]
+func skipEscape(s []rune, i int) int {
+	if i+1 >= len(s) {
+		return i
+	}
+	switch s[i+1] {
+	case '[':
+		// CSI: parameters and intermediates, then a final byte
+		j := i + 2
+		for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+			j++
+		}
+		return j
+	case ']', 'P', 'X', '^', '_':
+		// OSC and other strings, ended by BEL or ST (ESC \)
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == 0x07 {
+				return j
+			}
+			if s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(s) - 1
+	case '(', ')', '*', '+', '#', '%':
+		// Character set selection takes one more byte
+		return min(i+2, len(s)-1)
+	}
+	return i + 1
+}
+
+// Cell is a recorded command and the output it produced
+type Cell struct {
+	Command string
+	Time    time.Time
+	Output  string
+	// Found is false when the command couldn't be located in the
+	// transcript, so its output is unknown
+	Found bool
+}
+
+// Split locates each command in the cleaned transcript text, in order, and
+// takes the lines between it and the next command found as its output.
+// Commands are matched by their first line, as echoed after the prompt
+func Split(text string, commands []string, times []time.Time) []Cell {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	cells := make([]Cell, len(commands))
+	at := make([]int, len(commands))
+
+	pos := 0
+	for i, cmd := range commands {
+		cells[i].Command = cmd
+		if i < len(times) {
+			cells[i].Time = times[i]
+		}
+		at[i] = -1
+
+		first, _, _ := strings.Cut(strings.TrimSpace(cmd), "\n")
+		if first == "" {
+			continue
+		}
+		for j := pos; j < len(lines); j++ {
+			if strings.HasSuffix(strings.TrimRight(lines[j], " "), first) {
+				at[i] = j
+				pos = j + 1
+				cells[i].Found = true
+				break
+			}
+		}
+	}
+
+	for i := range cells {
+		if at[i] < 0 {
+			continue
+		}
+		end := len(lines)
+		for k := i + 1; k < len(cells); k++ {
+			if at[k] >= 0 {
+				end = at[k]
+				break
+			}
+		}
+		out := lines[at[i]+1 : end]
+		if end == len(lines) {
+			out = trimPrompt(out)
+		}
+		cells[i].Output = strings.TrimRight(strings.Join(out, "\n"), "\n ")
+	}
+	return cells
+}
+
+// trimPrompt drops the prompt left at the end of the transcript after the
+// last command, such as "user@host:~$ exit"
+func trimPrompt(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if n := len(lines); n > 0 && isPrompt(strings.TrimSpace(lines[n-1])) {
+		lines = lines[:n-1]
+	}
+	return lines
+}
+
+func isPrompt(line string) bool {
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "exit"), " ")
+	for _, end := range []string{"$", "#", "%", ">"} {
+		if strings.HasSuffix(line, end) {
+			return true
+		}
+	}
+	return false
+}
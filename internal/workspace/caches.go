@@ -0,0 +1,194 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// States a cache can be found in
+const (
+	// CacheCurrent is a cache matching the history it was derived from
+	CacheCurrent = "current"
+	// CacheStale is a cache of an older history, or of another version or
+	// time zone, rebuilt when next needed
+	CacheStale = "stale"
+	// CacheMissing is a cache not built yet, or dropped
+	CacheMissing = "missing"
+	// CacheCorrupt is a cache that can't be read, rebuilt when next needed
+	// as a stale one is, but worth knowing of
+	CacheCorrupt = "corrupt"
+)
+
+// CacheStatus is the state of one of the caches derived from a
+// workspace's history, StatsFile and DaysDir
+type CacheStatus struct {
+	Name   string
+	State  string
+	Detail string
+}
+
+// CheckCaches reports the state of the caches of the workspace at wsPath,
+// reading them through to find corruption
+func CheckCaches(wsPath string) ([]CacheStatus, error) {
+	info, err := os.Stat(filepath.Join(wsPath, HistoryFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return []CacheStatus{checkStats(wsPath, info), checkDays(wsPath, info)}, nil
+}
+
+func checkStats(wsPath string, history os.FileInfo) CacheStatus {
+	status := CacheStatus{Name: StatsFile}
+	data, err := os.ReadFile(filepath.Join(wsPath, StatsFile))
+	switch {
+	case os.IsNotExist(err):
+		status.State = CacheMissing
+		return status
+	case err != nil:
+		status.State, status.Detail = CacheCorrupt, err.Error()
+		return status
+	}
+	s, ok := readStats(wsPath)
+	if !ok {
+		status.State, status.Detail = CacheCorrupt, fmt.Sprintf("%d bytes that aren't stats", len(data))
+		return status
+	}
+	status.State = CacheStale
+	if history != nil && s.matches(history) {
+		status.State = CacheCurrent
+	}
+	status.Detail = fmt.Sprintf("%d commands", s.Commands)
+	return status
+}
+
+func checkDays(wsPath string, history os.FileInfo) CacheStatus {
+	status := CacheStatus{Name: DaysDir}
+	dir := filepath.Join(wsPath, DaysDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		status.State = CacheMissing
+		return status
+	}
+	index, ok := readDaysIndex(wsPath)
+	if !ok {
+		status.State, status.Detail = CacheCorrupt, daysIndexFile+" is missing or unreadable"
+		return status
+	}
+
+	days, commands := 0, 0
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		status.State, status.Detail = CacheCorrupt, err.Error()
+		return status
+	}
+	for _, f := range files {
+		day, ok := strings.CutSuffix(f.Name(), ".log")
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			status.State, status.Detail = CacheCorrupt, "stray file "+f.Name()
+			return status
+		}
+		entries, err := readDayFile(filepath.Join(dir, f.Name()))
+		if err == nil {
+			err = checkDay(entries, index.Commands)
+		}
+		if err != nil {
+			status.State, status.Detail = CacheCorrupt, fmt.Sprintf("%s: %v", f.Name(), err)
+			return status
+		}
+		days++
+		commands += len(entries)
+	}
+
+	status.State = CacheStale
+	if history != nil && index.matches(history) {
+		status.State = CacheCurrent
+	}
+	status.Detail = fmt.Sprintf("%d day(s), %d commands", days, commands)
+	return status
+}
+
+// checkDay reports whether a day's entries are numbered as a rollup of a
+// history of total commands numbers them, in order
+func checkDay(entries []DayEntry, total int) error {
+	last := 0
+	for _, e := range entries {
+		if e.Number <= last || e.Number > total {
+			return fmt.Errorf("command %d is out of order", e.Number)
+		}
+		last = e.Number
+	}
+	return nil
+}
+
+// RebuildCaches derives the caches of the workspace at wsPath from its
+// history afresh, under its lock, leaving nothing of the old ones behind,
+// not even temporary files of writes that were interrupted
+func RebuildCaches(wsPath string, idleAfter time.Duration) error {
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := removeCaches(wsPath); err != nil {
+		return err
+	}
+	historyPath := filepath.Join(wsPath, HistoryFile)
+	info, err := os.Stat(historyPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	history, err := ReadHistory(historyPath)
+	if err != nil {
+		return err
+	}
+
+	s := newStats(idleAfter)
+	s.add(history)
+	s.stamp(info)
+	if err := writeStats(wsPath, s); err != nil {
+		return err
+	}
+	index := &daysIndex{Version: daysVersion, Zone: statsZone(), Commands: len(history)}
+	index.HistorySize, index.HistoryModTime = info.Size(), info.ModTime()
+	return writeDays(wsPath, index, rollUp(history, 0))
+}
+
+// LeftoverFiles lists the temporary files and directories that writes of
+// the caches of the workspace at wsPath left when they were interrupted
+func LeftoverFiles(wsPath string) ([]string, error) {
+	files, err := os.ReadDir(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	var leftover []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), StatsFile+".tmp") || strings.HasPrefix(f.Name(), DaysDir+".tmp") {
+			leftover = append(leftover, f.Name())
+		}
+	}
+	return leftover, nil
+}
+
+func removeCaches(wsPath string) error {
+	leftover, err := LeftoverFiles(wsPath)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range append(leftover, StatsFile, DaysDir) {
+		if err := os.RemoveAll(filepath.Join(wsPath, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,158 @@
+package workspace
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CommentsFile holds the comments left on a workspace's commands and
+// sessions, one JSON comment per line, oldest first. Comments are only
+// ever added, so a reviewed session keeps the discussion it had
+const CommentsFile = "comments.jsonl"
+
+// ErrNoParent is returned when replying to a comment that doesn't exist
+var ErrNoParent = errors.New("no such comment to reply to")
+
+// Comment is a remark left on a recorded command or on a session, or a
+// reply to another comment, which is then on what its parent is on
+type Comment struct {
+	ID     string `json:"id"`
+	Parent string `json:"parent,omitempty"`
+	// Author is who left the comment, the name of the API token it was
+	// posted with
+	Author string    `json:"author"`
+	Time   time.Time `json:"time"`
+	// A command is identified as the tags and hosts files identify it, by
+	// its timestamp and text, which keeps the comment on it when the
+	// history is renumbered. Session is the ID of a recorded session
+	CommandTime int64  `json:"command_time,omitempty"`
+	Command     string `json:"command,omitempty"`
+	Session     string `json:"session,omitempty"`
+	Text        string `json:"text"`
+}
+
+// On reports whether the comment is on e
+func (c Comment) On(e Entry) bool {
+	return c.Command != "" && c.Command == e.Command && c.CommandTime == e.Time.Unix()
+}
+
+// ReadComments loads the comments of the workspace at wsPath, oldest first
+func ReadComments(wsPath string) ([]Comment, error) {
+	f, err := os.Open(filepath.Join(wsPath, CommentsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var comments []Comment
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var c Comment
+		if json.Unmarshal(scanner.Bytes(), &c) == nil && c.ID != "" {
+			comments = append(comments, c)
+		}
+	}
+	return comments, scanner.Err()
+}
+
+// AddComment records c in the workspace at wsPath under its lock, giving
+// it an ID and, when it replies to another, the parent's command or
+// session. It returns the comment as recorded
+func AddComment(wsPath string, c Comment) (Comment, error) {
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return c, err
+	}
+	defer lock.Unlock()
+
+	if c.Parent != "" {
+		comments, err := ReadComments(wsPath)
+		if err != nil {
+			return c, err
+		}
+		found := false
+		for _, p := range comments {
+			if p.ID == c.Parent {
+				c.CommandTime, c.Command, c.Session = p.CommandTime, p.Command, p.Session
+				found = true
+			}
+		}
+		if !found {
+			return c, fmt.Errorf("%s: %w", c.Parent, ErrNoParent)
+		}
+	}
+	if c.Command == "" && c.Session == "" {
+		return c, errors.New("a comment must be on a command, a session or another comment")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return c, err
+	}
+	c.ID = hex.EncodeToString(id)
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+	c.Command = FlattenCommand(c.Command)
+	c.Text = strings.TrimSpace(c.Text)
+
+	line, err := json.Marshal(c)
+	if err != nil {
+		return c, err
+	}
+	f, err := FileMode(wsPath).OpenFile(filepath.Join(wsPath, CommentsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return c, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return c, err
+	}
+	return c, f.Close()
+}
+
+// Threads orders comments for reading: each comment that starts a thread,
+// oldest first, followed by its replies, depth-first. Depth gives how
+// deeply each is nested, 0 for those starting threads
+func Threads(comments []Comment) (ordered []Comment, depth []int) {
+	children := make(map[string][]Comment)
+	ids := make(map[string]bool)
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+	var roots []Comment
+	for _, c := range comments {
+		if c.Parent != "" && ids[c.Parent] {
+			children[c.Parent] = append(children[c.Parent], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return roots[i].Time.Before(roots[j].Time) })
+
+	var walk func(c Comment, d int)
+	walk = func(c Comment, d int) {
+		ordered = append(ordered, c)
+		depth = append(depth, d)
+		for _, reply := range children[c.ID] {
+			walk(reply, d+1)
+		}
+	}
+	for _, c := range roots {
+		walk(c, 0)
+	}
+	return ordered, depth
+}
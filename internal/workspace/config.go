@@ -0,0 +1,152 @@
+package workspace
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// Files within a workspace directory
+const (
+	ConfigFile  = "config.txt"
+	HistoryFile = "history.log"
+	NotesFile   = "notes.md"
+)
+
+// ReadConfig parses a key=value config file. A missing or unreadable file
+// reads as empty
+func ReadConfig(configPath string) map[string]string {
+	config := make(map[string]string)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return config
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			config[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return config
+}
+
+// FileMode returns the mode files are created with in dir: that of its
+// files.mode setting when dir is a workspace with one, which makes it a
+// team workspace when shared with a group, and fsperm.Default otherwise
+func FileMode(dir string) fsperm.Mode {
+	value, ok := ReadConfig(filepath.Join(dir, ConfigFile))[fsperm.Setting]
+	if !ok {
+		return fsperm.Default
+	}
+	m, err := fsperm.Parse(value)
+	if err != nil {
+		slog.Warn("ignoring file mode of workspace", "path", dir, "err", err)
+		return fsperm.Default
+	}
+	return m
+}
+
+// SetConfigValue sets key in the config file at configPath, replacing an
+// existing line for the key or appending a new one
+func SetConfigValue(configPath, key, value string) error {
+	if wsPath := filepath.Dir(configPath); IsMounted(wsPath) {
+		return fmt.Errorf("%s: %w", filepath.Base(wsPath), ErrReadOnly)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			lines[i] = key + "=" + value
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, key+"="+value)
+	}
+	if lines[0] == "" {
+		lines = lines[1:]
+	}
+
+	return FileMode(filepath.Dir(configPath)).WriteFile(configPath, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// DeleteConfigValues removes the lines of the config file at configPath
+// whose key matches
+func DeleteConfigValues(configPath string, match func(key string) bool) error {
+	if wsPath := filepath.Dir(configPath); IsMounted(wsPath) {
+		return fmt.Errorf("%s: %w", filepath.Base(wsPath), ErrReadOnly)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && match(strings.TrimSpace(parts[0])) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return FileMode(filepath.Dir(configPath)).WriteFile(configPath, []byte(strings.Join(kept, "\n")+"\n"))
+}
+
+// Append adds entries to the workspace at wsPath under its lock and bumps
+// its command count
+func Append(wsPath string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return appendLocked(wsPath, RecordsOf(entries))
+}
+
+// appendLocked appends records to the workspace at wsPath, already locked
+func appendLocked(wsPath string, records []Record) error {
+	slog.Debug("appending to workspace", "path", wsPath, "commands", len(records))
+
+	historyPath := filepath.Join(wsPath, HistoryFile)
+	before, _ := os.Stat(historyPath)
+	f, err := FileMode(wsPath).OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if err := WriteRecords(f, records, RecordVersion(wsPath)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	entries := EntriesOf(records)
+	updateStats(wsPath, before, entries)
+	updateDays(wsPath, before, entries)
+
+	configPath := filepath.Join(wsPath, ConfigFile)
+	count := 0
+	fmt.Sscanf(ReadConfig(configPath)["commands"], "%d", &count)
+
+	return SetConfigValue(configPath, "commands", fmt.Sprintf("%d", count+len(entries)))
+}
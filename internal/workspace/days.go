@@ -0,0 +1,244 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// DaysDir rolls a workspace's history up by local day, one file per day
+// named "2006-01-02.log", so the commands of a given day are read without
+// going through the whole history. Like StatsFile it is derived data:
+// Append keeps it up to date, anything else that changes the history
+// invalidates it, and it is rebuilt when next needed
+const DaysDir = ".days"
+
+// daysIndexFile, in DaysDir, identifies the history the day files were
+// rolled up from, the same way Stats does
+const daysIndexFile = "index.json"
+
+// daysVersion changes whenever the layout of DaysDir does
+const daysVersion = 1
+
+// DayEntry is a command of a day's rollup, with its number in the whole
+// history, counting from 1 as bashlog-mgr history does
+type DayEntry struct {
+	Entry
+	Number int
+}
+
+type daysIndex struct {
+	Version        int       `json:"version"`
+	HistorySize    int64     `json:"history_size"`
+	HistoryModTime time.Time `json:"history_mtime"`
+	Zone           string    `json:"zone"`
+
+	// Commands is how many commands the history held, so appended ones
+	// are numbered on from it
+	Commands int `json:"commands"`
+}
+
+func (x *daysIndex) matches(info os.FileInfo) bool {
+	return x.Version == daysVersion && x.Zone == statsZone() &&
+		x.HistorySize == info.Size() && x.HistoryModTime.Equal(info.ModTime())
+}
+
+// ReadDay returns the commands of the workspace at wsPath run on the
+// local day of day, in history order, from its rollup if that still
+// matches the history, and otherwise from the history, rolling it up
+// afresh, as it is when the day's file is corrupt. Commands without a
+// timestamp belong to no day
+func ReadDay(wsPath string, day time.Time) ([]DayEntry, error) {
+	historyPath := filepath.Join(wsPath, HistoryFile)
+	info, err := os.Stat(historyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := day.Local().Format(time.DateOnly)
+
+	if index, ok := readDaysIndex(wsPath); ok && index.matches(info) {
+		entries, err := readDayFile(filepath.Join(wsPath, DaysDir, name+".log"))
+		if err == nil || os.IsNotExist(err) {
+			return entries, nil
+		}
+		slog.Warn("could not read day rollup, rebuilding it from the history", "path", wsPath, "day", name, "err", err)
+	}
+
+	history, err := ReadHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	days := rollUp(history, 0)
+	if !IsMounted(wsPath) {
+		index := &daysIndex{Version: daysVersion, Zone: statsZone(), Commands: len(history)}
+		index.HistorySize, index.HistoryModTime = info.Size(), info.ModTime()
+		if err := writeDays(wsPath, index, days); err != nil {
+			slog.Debug("could not roll up workspace history", "path", wsPath, "err", err)
+		}
+	}
+	return days[name], nil
+}
+
+// DayOf returns the commands of entries, a whole history, run on the
+// local day of day, as ReadDay does for a history file
+func DayOf(entries []Entry, day time.Time) []DayEntry {
+	return rollUp(entries, 0)[day.Local().Format(time.DateOnly)]
+}
+
+// rollUp groups entries by local day, numbering them on from before
+func rollUp(entries []Entry, before int) map[string][]DayEntry {
+	days := make(map[string][]DayEntry)
+	for i, e := range entries {
+		if e.Time.IsZero() {
+			continue
+		}
+		name := e.Time.Local().Format(time.DateOnly)
+		days[name] = append(days[name], DayEntry{Entry: e, Number: before + i + 1})
+	}
+	return days
+}
+
+// dayLine formats an entry of a day file: its number, timestamp and
+// command as the history holds it, tab separated
+func dayLine(e DayEntry) string {
+	return fmt.Sprintf("%d\t%d\t%s\n", e.Number, e.Time.Unix(), FlattenCommand(e.Command))
+}
+
+func readDayFile(path string) ([]DayEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// A line that doesn't parse is a file torn by a crash or damaged
+	// since, and the day is read from the history instead
+	var entries []DayEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d is malformed", line)
+		}
+		n, err1 := strconv.Atoi(fields[0])
+		unix, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d is malformed", line)
+		}
+		entries = append(entries, DayEntry{Entry: Entry{Command: fields[2], Time: time.Unix(unix, 0)}, Number: n})
+	}
+	return entries, scanner.Err()
+}
+
+func readDaysIndex(wsPath string) (*daysIndex, bool) {
+	data, err := os.ReadFile(filepath.Join(wsPath, DaysDir, daysIndexFile))
+	if err != nil {
+		return nil, false
+	}
+	var index daysIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, false
+	}
+	return &index, true
+}
+
+// writeDaysIndex replaces the index, atomically so readers never see a
+// partial file
+func writeDaysIndex(dir string, index *daysIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, daysIndexFile+".tmp")
+	if err := FileMode(filepath.Dir(dir)).WriteFile(tmp, data); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, daysIndexFile))
+}
+
+// writeDays replaces the rollup with days. It is written beside the old
+// one and swapped in, so readers see one or the other
+func writeDays(wsPath string, index *daysIndex, days map[string][]DayEntry) error {
+	tmp, err := os.MkdirTemp(wsPath, DaysDir+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	mode := FileMode(wsPath)
+	if err := os.Chmod(tmp, mode.Dir); err != nil {
+		return err
+	}
+	for name, entries := range days {
+		var b strings.Builder
+		for _, e := range entries {
+			b.WriteString(dayLine(e))
+		}
+		if err := mode.WriteFile(filepath.Join(tmp, name+".log"), []byte(b.String())); err != nil {
+			return err
+		}
+	}
+	if err := writeDaysIndex(tmp, index); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(wsPath, DaysDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// updateDays appends entries, just appended to the history, to their
+// days' files if the rollup described the history as it was before
+// (before is nil when there was none), and otherwise drops the rollup to
+// be rebuilt when next needed
+func updateDays(wsPath string, before os.FileInfo, entries []Entry) {
+	dir := filepath.Join(wsPath, DaysDir)
+	index, ok := readDaysIndex(wsPath)
+	if !ok {
+		return
+	}
+	after, err := os.Stat(filepath.Join(wsPath, HistoryFile))
+	if before == nil || err != nil || !index.matches(before) {
+		os.RemoveAll(dir)
+		return
+	}
+
+	for name, added := range rollUp(entries, index.Commands) {
+		if err := appendDay(FileMode(wsPath), filepath.Join(dir, name+".log"), added); err != nil {
+			os.RemoveAll(dir)
+			return
+		}
+	}
+	index.Commands += len(entries)
+	index.HistorySize, index.HistoryModTime = after.Size(), after.ModTime()
+	if err := writeDaysIndex(dir, index); err != nil {
+		os.RemoveAll(dir)
+	}
+}
+
+func appendDay(mode fsperm.Mode, path string, entries []DayEntry) error {
+	f, err := mode.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := f.WriteString(dayLine(e)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
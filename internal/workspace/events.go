@@ -0,0 +1,180 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// EventsFile is the append-only log of changes to a workspace's metadata,
+// one JSON object a line
+const EventsFile = "events.jsonl"
+
+// EventUndo is the operation of an event reverting an earlier one
+const EventUndo = "undo"
+
+// ErrNothingToUndo is returned by LastUndoable for a workspace whose
+// changes have all been undone, or that has none
+var ErrNothingToUndo = errors.New("no change to undo")
+
+// Event is a change to a workspace's metadata. Changes to a config value
+// carry the key with its value before and after, nil where it was or is
+// unset, and can be undone; others, such as archiving, only describe
+// what was done
+type Event struct {
+	// Seq numbers the events of a workspace from 1, as they are logged
+	Seq    int       `json:"-"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Op     string    `json:"op"`
+	Key    string    `json:"key,omitempty"`
+	Old    *string   `json:"old,omitempty"`
+	New    *string   `json:"new,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	// Undoes is the Seq of the event an undo reverted
+	Undoes int `json:"undoes,omitempty"`
+}
+
+// Describe returns what the event changed, as "files.mode: private -> group"
+func (e Event) Describe() string {
+	if e.Key == "" {
+		return e.Detail
+	}
+	value := func(v *string) string {
+		if v == nil {
+			return "(unset)"
+		}
+		return *v
+	}
+	s := e.Key + ": " + value(e.Old) + " -> " + value(e.New)
+	if e.Detail != "" {
+		s += " (" + e.Detail + ")"
+	}
+	return s
+}
+
+// ChangeConfig sets key in the config of the workspace at wsPath, as
+// SetConfigValue does, and logs the change as op. A value set to what it
+// already is logs nothing. It doesn't take the workspace lock, so callers
+// holding it can use it
+func ChangeConfig(wsPath, op, key, value string) error {
+	configPath := filepath.Join(wsPath, ConfigFile)
+	var old *string
+	if v, ok := ReadConfig(configPath)[key]; ok {
+		if v == value {
+			return nil
+		}
+		old = &v
+	}
+	if err := SetConfigValue(configPath, key, value); err != nil {
+		return err
+	}
+	return LogEvent(wsPath, Event{Op: op, Key: key, Old: old, New: &value})
+}
+
+// LogEvent appends e to the event log of the workspace at wsPath, stamped
+// with the time and user unless set. Each event is one write to a file
+// opened for appending, so events logged side by side don't interleave
+func LogEvent(wsPath string, e Event) error {
+	if IsMounted(wsPath) {
+		return fmt.Errorf("%s: %w", filepath.Base(wsPath), ErrReadOnly)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.User == "" {
+		if u, err := user.Current(); err == nil {
+			e.User = u.Username
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := FileMode(wsPath).OpenFile(filepath.Join(wsPath, EventsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadEvents loads the event log of the workspace at wsPath, oldest first.
+// A workspace without one has no events
+func ReadEvents(wsPath string) ([]Event, error) {
+	f, err := os.Open(filepath.Join(wsPath, EventsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", EventsFile, n, err)
+		}
+		e.Seq = n
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// LastUndoable returns the latest change to a config value of the
+// workspace at wsPath that hasn't been undone, so undoing again walks
+// further back; events that only describe a change are passed over. It
+// fails for a value changed since outside the log, as undoing the logged
+// change would lose that one
+func LastUndoable(wsPath string) (Event, error) {
+	events, err := ReadEvents(wsPath)
+	if err != nil {
+		return Event{}, err
+	}
+	undone := make(map[int]bool)
+	for _, e := range events {
+		if e.Op == EventUndo {
+			undone[e.Undoes] = true
+		}
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if e.Op == EventUndo || undone[e.Seq] || e.Key == "" {
+			continue
+		}
+		current, ok := ReadConfig(filepath.Join(wsPath, ConfigFile))[e.Key]
+		if e.New == nil && ok || e.New != nil && (!ok || current != *e.New) {
+			return Event{}, fmt.Errorf("%s has been changed since the last %s; set it again instead", e.Key, e.Op)
+		}
+		return e, nil
+	}
+	return Event{}, ErrNothingToUndo
+}
+
+// Undo reverts the change e, as LastUndoable returned it, and logs the
+// undo
+func Undo(wsPath string, e Event) error {
+	configPath := filepath.Join(wsPath, ConfigFile)
+	var err error
+	if e.Old == nil {
+		err = DeleteConfigValues(configPath, func(key string) bool { return key == e.Key })
+	} else {
+		err = SetConfigValue(configPath, e.Key, *e.Old)
+	}
+	if err != nil {
+		return err
+	}
+	return LogEvent(wsPath, Event{Op: EventUndo, Key: e.Key, Old: e.New, New: e.Old, Detail: "undo of " + e.Op, Undoes: e.Seq})
+}
@@ -0,0 +1,309 @@
+package workspace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is a single command recorded in a workspace history file
+type Entry struct {
+	Command string
+	// Time is the zero value when the history line carried no timestamp
+	Time time.Time
+}
+
+// UniqueEntry is a deduplicated command with its usage count
+type UniqueEntry struct {
+	Command  string
+	Count    int
+	LastUsed time.Time
+}
+
+// ReadHistory reads the history file at path
+func ReadHistory(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseHistory(f)
+}
+
+// ParseHistory parses bash history format, where a command may be preceded
+// by a "#<unix-seconds>" line as written by bash when HISTTIMEFORMAT is set,
+// or by a v2 record's, whose fields ParseRecords reads
+func ParseHistory(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var pending time.Time
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if ts, ok := parseTimestampLine(line); ok {
+			pending = ts
+			continue
+		}
+
+		entries = append(entries, Entry{Command: line, Time: pending})
+		pending = time.Time{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ScanHistory reads the history file at path from byte offset on, which
+// must be 0 or an offset ScanHistory handed out, calling fn with each entry
+// and the offset just past it until fn returns false. Unlike ReadHistory it
+// holds one entry at a time, for histories too large to load whole
+func ScanHistory(path string, offset int64, fn func(e Entry, next int64) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	var pending time.Time
+	pos := offset
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// A last line without its newline may still be being
+			// written, and is left for a later scan to pick up whole
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pos += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		switch ts, ok := parseTimestampLine(line); {
+		case strings.TrimSpace(line) == "":
+		case ok:
+			pending = ts
+		default:
+			if !fn(Entry{Command: line, Time: pending}, pos) {
+				return nil
+			}
+			pending = time.Time{}
+		}
+	}
+}
+
+// Unique collapses repeated commands into one entry each, ordered by the
+// time each command was last used (oldest first)
+func Unique(entries []Entry) []UniqueEntry {
+	index := make(map[string]int)
+	lastSeen := make(map[string]int)
+	var unique []UniqueEntry
+
+	for pos, e := range entries {
+		i, ok := index[e.Command]
+		if !ok {
+			i = len(unique)
+			index[e.Command] = i
+			unique = append(unique, UniqueEntry{Command: e.Command})
+		}
+
+		unique[i].Count++
+		if !e.Time.IsZero() {
+			unique[i].LastUsed = e.Time
+		}
+		lastSeen[e.Command] = pos
+	}
+
+	sort.SliceStable(unique, func(a, b int) bool {
+		return lastSeen[unique[a].Command] < lastSeen[unique[b].Command]
+	})
+
+	return unique
+}
+
+// Diff compares two histories. Added holds the entries of b beyond those
+// it shares with a, removed the entries of a missing from b, each in their
+// original order. Commands are compared by text, counting repeats, so an
+// appended-to history diffs as pure additions.
+func Diff(a, b []Entry) (added, removed []Entry) {
+	return missingFrom(a, b), missingFrom(b, a)
+}
+
+// missingFrom returns the entries of b left over after matching each entry
+// of base against one occurrence of the same command in b
+func missingFrom(base, b []Entry) []Entry {
+	counts := make(map[string]int)
+	for _, e := range base {
+		counts[e.Command]++
+	}
+
+	var missing []Entry
+	for _, e := range b {
+		if counts[e.Command] > 0 {
+			counts[e.Command]--
+			continue
+		}
+		missing = append(missing, e)
+	}
+	return missing
+}
+
+// AppendHistory appends entries to the history file at path
+func AppendHistory(path string, entries []Entry) error {
+	f, err := FileMode(filepath.Dir(path)).OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteHistory(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteHistory writes entries in bash history format, with a timestamp
+// line before each entry that has one. The result can be read back by bash
+// when HISTTIMEFORMAT is set.
+func WriteHistory(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if !e.Time.IsZero() {
+			fmt.Fprintf(bw, "#%d\n", e.Time.Unix())
+		}
+		fmt.Fprintln(bw, FlattenCommand(e.Command))
+	}
+	return bw.Flush()
+}
+
+// Activity splits the time spanned by timestamped entries into active and
+// idle time. A gap between consecutive commands counts as active time when
+// it is at most idleAfter, and as idle time otherwise.
+func Activity(entries []Entry, idleAfter time.Duration) (active, idle time.Duration) {
+	var prev time.Time
+	for _, e := range entries {
+		if e.Time.IsZero() {
+			continue
+		}
+		if !prev.IsZero() {
+			gap := e.Time.Sub(prev)
+			switch {
+			case gap < 0:
+				// Out of order, as with merged imports; not a real gap
+			case gap <= idleAfter:
+				active += gap
+			default:
+				idle += gap
+			}
+		}
+		prev = e.Time
+	}
+	return active, idle
+}
+
+// DailyCounts counts timestamped entries per calendar day over the days
+// ending on the day of end, oldest first, in end's location. Entries
+// without timestamps, or outside the window, are not counted.
+func DailyCounts(entries []Entry, end time.Time, days int) []int {
+	counts := make([]int, days)
+	y, m, d := end.Date()
+	last := time.Date(y, m, d, 0, 0, 0, 0, end.Location())
+
+	for _, e := range entries {
+		if e.Time.IsZero() {
+			continue
+		}
+		y, m, d := e.Time.In(end.Location()).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, end.Location())
+		// Days between the two midnights, rounded to absorb DST shifts
+		ago := int((last.Sub(day) + 12*time.Hour) / (24 * time.Hour))
+		if ago >= 0 && ago < days {
+			counts[days-1-ago]++
+		}
+	}
+	return counts
+}
+
+// FillTimestamps returns a copy of entries in which each entry without a
+// timestamp takes that of the entry before it, or fallback for leading
+// entries. Bash needs a timestamp on every entry once a file has any,
+// since it uses them to delimit entries.
+func FillTimestamps(entries []Entry, fallback time.Time) []Entry {
+	filled := make([]Entry, len(entries))
+	last := fallback
+	for i, e := range entries {
+		if e.Time.IsZero() {
+			e.Time = last
+		}
+		last = e.Time
+		filled[i] = e
+	}
+	return filled
+}
+
+// FlattenCommand joins a multi-line command onto one line, since history
+// files hold exactly one command per line. Lines are separated by "; "
+// unless they already end in something that continues the command.
+func FlattenCommand(cmd string) string {
+	lines := strings.Split(strings.TrimRight(cmd, "\n"), "\n")
+
+	var b strings.Builder
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			if continuesCommand(strings.TrimSpace(lines[i-1])) {
+				b.WriteByte(' ')
+			} else {
+				b.WriteString("; ")
+			}
+		}
+		b.WriteString(strings.TrimSpace(strings.TrimSuffix(line, "\\")))
+	}
+	return b.String()
+}
+
+func continuesCommand(line string) bool {
+	for _, suffix := range []string{"|", "&&", "||", "{", "(", ";", "\\"} {
+		if strings.HasSuffix(line, suffix) {
+			return true
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	switch fields[len(fields)-1] {
+	case "do", "then", "else", "in":
+		return true
+	}
+	return false
+}
+
+// parseTimestampLine returns the time of a record's timestamp line, v1 or
+// v2, for readers that want entries only
+func parseTimestampLine(line string) (time.Time, bool) {
+	r, ok := parseRecordLine(line)
+	return r.Time, ok
+}
@@ -0,0 +1,85 @@
+package workspace
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HostsFile records which machine each of a workspace's commands ran on,
+// one line per command as "<unix-seconds>\t<host>\t<command>", so history
+// merged from several machines can be told apart
+const HostsFile = "hosts.log"
+
+// Hosts maps recorded commands to the host they ran on
+type Hosts map[tagKey]string
+
+// Of returns the host a history entry ran on, or "" when unknown
+func (h Hosts) Of(e Entry) string {
+	if e.Time.IsZero() {
+		return ""
+	}
+	return h[keyOf(e)]
+}
+
+// Names returns every host in the workspace, sorted
+func (h Hosts) Names() []string {
+	seen := make(map[string]bool)
+	for _, host := range h {
+		seen[host] = true
+	}
+	names := make([]string, 0, len(seen))
+	for host := range seen {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadHosts loads the hosts of the workspace at wsPath. Commands recorded
+// before hosts were tracked, or imported, have none
+func ReadHosts(wsPath string) (Hosts, error) {
+	hosts := make(Hosts)
+	err := readKeyed(filepath.Join(wsPath, HostsFile), func(key tagKey, value string) {
+		hosts[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// AddHosts records that entries of the workspace at wsPath ran on host,
+// under its lock. Commands without a timestamp are skipped
+func AddHosts(wsPath, host string, entries []Entry) error {
+	if host == "" {
+		return nil
+	}
+	var lines []string
+	for _, e := range entries {
+		if !e.Time.IsZero() {
+			lines = append(lines, keyedLine(e, host))
+		}
+	}
+	return appendKeyed(wsPath, HostsFile, lines)
+}
+
+// Matches reports whether a history entry ran on host, compared without
+// regard to case; a host given without a domain matches its fully
+// qualified name
+func (h Hosts) Matches(e Entry, host string) bool {
+	name := h.Of(e)
+	short, _, _ := strings.Cut(name, ".")
+	return name != "" && (strings.EqualFold(name, host) || strings.EqualFold(short, host))
+}
+
+// FilterHost keeps the entries that ran on host
+func FilterHost(entries []Entry, hosts Hosts, host string) []Entry {
+	var kept []Entry
+	for _, e := range entries {
+		if hosts.Matches(e, host) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
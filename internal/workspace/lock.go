@@ -0,0 +1,56 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LockFile is the file within a workspace used to serialize writers
+const LockFile = ".lock"
+
+// Lock holds an advisory lock on a workspace
+type Lock struct {
+	file *os.File
+}
+
+// LockWorkspace takes an exclusive lock on the workspace at wsPath, waiting
+// for other holders to release it. Writers take it before modifying the
+// workspace's files, so it fails with ErrReadOnly for mounted workspaces
+func LockWorkspace(wsPath string) (*Lock, error) {
+	if IsMounted(wsPath) {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(wsPath), ErrReadOnly)
+	}
+	return lock(wsPath, true)
+}
+
+// RLockWorkspace takes a shared lock on the workspace at wsPath, so a
+// consistent copy can be read while writers are held off. Nothing writes
+// to a mounted workspace, which may not even be writable, so its shared
+// lock holds nothing
+func RLockWorkspace(wsPath string) (*Lock, error) {
+	if IsMounted(wsPath) {
+		return &Lock{}, nil
+	}
+	return lock(wsPath, false)
+}
+
+func lock(wsPath string, exclusive bool) (*Lock, error) {
+	f, err := FileMode(wsPath).OpenFile(filepath.Join(wsPath, LockFile), os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := Flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{file: f}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
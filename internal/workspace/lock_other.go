@@ -0,0 +1,10 @@
+//go:build !unix
+
+package workspace
+
+import "os"
+
+// Flock is a no-op where advisory file locks are unavailable
+func Flock(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// MountsFile lists the foreign workspaces mounted into a workspace
+// directory, one "<name>\t<source>" line each. A mounted workspace is a
+// symlink to the foreign directory, so it can be read like any other, and
+// is never written to
+const MountsFile = ".mounts"
+
+// ErrReadOnly is returned when modifying a mounted workspace
+var ErrReadOnly = errors.New("workspace is mounted read-only")
+
+// Mount is a foreign workspace mounted read-only
+type Mount struct {
+	Name string
+
+	// Source is the path or URL it was mounted from
+	Source string
+}
+
+// ReadMounts lists the workspaces mounted under basePath
+func ReadMounts(basePath string) ([]Mount, error) {
+	f, err := os.Open(filepath.Join(basePath, MountsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []Mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, source, ok := strings.Cut(scanner.Text(), "\t")
+		if ok && name != "" {
+			mounts = append(mounts, Mount{Name: name, Source: source})
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// MountOf returns the mount of the workspace at wsPath, if it is one
+func MountOf(wsPath string) (Mount, bool) {
+	mounts, err := ReadMounts(filepath.Dir(wsPath))
+	if err != nil {
+		return Mount{}, false
+	}
+	for _, m := range mounts {
+		if m.Name == filepath.Base(wsPath) {
+			return m, true
+		}
+	}
+	return Mount{}, false
+}
+
+// IsMounted reports whether the workspace at wsPath is mounted read-only
+func IsMounted(wsPath string) bool {
+	_, ok := MountOf(wsPath)
+	return ok
+}
+
+// AddMount links dir into basePath as the read-only workspace name
+func AddMount(basePath, name, dir, source string) error {
+	mounts, err := ReadMounts(basePath)
+	if err != nil {
+		return err
+	}
+	if err := fsperm.Default.MkdirAll(basePath); err != nil {
+		return err
+	}
+	if err := os.Symlink(dir, filepath.Join(basePath, name)); err != nil {
+		return err
+	}
+	mounts = append(mounts, Mount{Name: name, Source: source})
+	if err := writeMounts(basePath, mounts); err != nil {
+		os.Remove(filepath.Join(basePath, name))
+		return err
+	}
+	return nil
+}
+
+// RemoveMount unlinks the mounted workspace name, leaving the foreign
+// directory as it was
+func RemoveMount(basePath, name string) error {
+	mounts, err := ReadMounts(basePath)
+	if err != nil {
+		return err
+	}
+	var kept []Mount
+	for _, m := range mounts {
+		if m.Name != name {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == len(mounts) {
+		return fmt.Errorf("workspace '%s' is not mounted", name)
+	}
+
+	link := filepath.Join(basePath, name)
+	if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+	return writeMounts(basePath, kept)
+}
+
+func writeMounts(basePath string, mounts []Mount) error {
+	var b strings.Builder
+	for _, m := range mounts {
+		fmt.Fprintf(&b, "%s\t%s\n", m.Name, m.Source)
+	}
+	return fsperm.Default.WriteFile(filepath.Join(basePath, MountsFile), []byte(b.String()))
+}
@@ -0,0 +1,95 @@
+package workspace
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// OriginsFile records where a workspace's commands came from when they
+// weren't typed at a session's prompt, as "<unix-seconds>\t<origin>\t<command>"
+// lines like the hosts file
+const OriginsFile = "origins.log"
+
+// Where a command came from
+const (
+	// OriginInteractive commands were typed at the prompt of a recorded
+	// session, which is what the shell hooks record
+	OriginInteractive = "interactive"
+	// OriginScript commands were run non-interactively, by bashlog -c
+	// from a script, a tool or a Makefile
+	OriginScript = "script"
+	// OriginImport commands were imported from another history
+	OriginImport = "import"
+	// OriginSourced commands were run by a file sourced or a function
+	// called at a prompt, as bashlog --sources records them
+	OriginSourced = "sourced"
+)
+
+// Origins are the names ParseOrigin accepts
+var Origins = []string{OriginInteractive, OriginScript, OriginImport, OriginSourced}
+
+// ParseOrigin checks name is one of Origins
+func ParseOrigin(name string) (string, error) {
+	for _, o := range Origins {
+		if name == o {
+			return o, nil
+		}
+	}
+	return "", fmt.Errorf("unknown origin '%s' (expected one of %s)", name, strings.Join(Origins, ", "))
+}
+
+// CommandOrigins maps recorded commands to where they came from
+type CommandOrigins map[tagKey]string
+
+// Of returns where a history entry came from. Only commands typed at a
+// prompt go unlisted, and commands without a timestamp were all imported,
+// since sessions time every command they record
+func (o CommandOrigins) Of(e Entry) string {
+	if e.Time.IsZero() {
+		return OriginImport
+	}
+	if origin, ok := o[keyOf(e)]; ok {
+		return origin
+	}
+	return OriginInteractive
+}
+
+// ReadOrigins loads the origins of the workspace at wsPath
+func ReadOrigins(wsPath string) (CommandOrigins, error) {
+	origins := make(CommandOrigins)
+	err := readKeyed(filepath.Join(wsPath, OriginsFile), func(key tagKey, value string) {
+		origins[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return origins, nil
+}
+
+// AddOrigins records that entries of the workspace at wsPath came from
+// origin, under its lock. Interactive commands and commands without a
+// timestamp need no line
+func AddOrigins(wsPath, origin string, entries []Entry) error {
+	if origin == "" || origin == OriginInteractive {
+		return nil
+	}
+	var lines []string
+	for _, e := range entries {
+		if !e.Time.IsZero() {
+			lines = append(lines, keyedLine(e, origin))
+		}
+	}
+	return appendKeyed(wsPath, OriginsFile, lines)
+}
+
+// FilterOrigin keeps the entries that came from origin
+func FilterOrigin(entries []Entry, origins CommandOrigins, origin string) []Entry {
+	var kept []Entry
+	for _, e := range entries {
+		if origins.Of(e) == origin {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,103 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutputsFile holds what a workspace's commands printed, as captured from
+// PTY session transcripts, one JSON object per line
+const OutputsFile = "outputs.jsonl"
+
+// Output is a recorded command and the output that followed it
+type Output struct {
+	Entry
+	Output string
+}
+
+// outputRecord is a line of the outputs file. Commands are keyed the same
+// way as in the tags file
+type outputRecord struct {
+	Time    int64  `json:"time"`
+	Command string `json:"command"`
+	Output  string `json:"output"`
+}
+
+// Outputs maps recorded commands to their output
+type Outputs map[tagKey]string
+
+// Of returns the output recorded for a history entry, and whether there
+// was any
+func (o Outputs) Of(e Entry) (string, bool) {
+	if e.Time.IsZero() {
+		return "", false
+	}
+	out, ok := o[keyOf(e)]
+	return out, ok
+}
+
+// ReadOutputs loads the command output of the workspace at wsPath. A
+// workspace without an outputs file has none
+func ReadOutputs(wsPath string) (Outputs, error) {
+	outputs := make(Outputs)
+
+	f, err := os.Open(filepath.Join(wsPath, OutputsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return outputs, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r outputRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		outputs[tagKey{r.Time, r.Command}] = r.Output
+	}
+	return outputs, scanner.Err()
+}
+
+// AddOutputs records the output of commands of the workspace at wsPath,
+// under its lock. Commands without a timestamp can't be told apart and
+// are skipped
+func AddOutputs(wsPath string, outputs []Output) error {
+	var lines strings.Builder
+	for _, o := range outputs {
+		if o.Time.IsZero() {
+			continue
+		}
+		line, err := json.Marshal(outputRecord{o.Time.Unix(), FlattenCommand(o.Command), o.Output})
+		if err != nil {
+			return err
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+	if lines.Len() == 0 {
+		return nil
+	}
+
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	f, err := FileMode(wsPath).OpenFile(filepath.Join(wsPath, OutputsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(lines.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
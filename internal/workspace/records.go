@@ -0,0 +1,222 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versions of the record schema of history files. A file can mix them, as
+// records written before its workspace reached LayoutRecordsV2 stay v1
+const (
+	// RecordV1 is a command line, after a "#<unix-seconds>" line when it
+	// has a time, as bash writes history with HISTTIMEFORMAT set
+	RecordV1 = 1
+	// RecordV2 adds a JSON object of fields to the timestamp line, as
+	// "#<unix-seconds> {"v":2,"exit":0,"ms":1200,"tags":["deploy"]}". Bash
+	// still takes such a line for a timestamp, so history -r reads v2
+	// files, and readers skip fields they don't know, so a v2 reader reads
+	// the records of later versions for the fields it does
+	RecordV2 = 2
+)
+
+// LayoutKey is the key of a workspace's config file recording the layout
+// it is at, as the migrate package versions them
+const LayoutKey = "layout"
+
+// LayoutRecordsV2 is the first layout whose history file may hold v2
+// records. Workspaces at an earlier one are written v1 records only, which
+// bashlogs from before v2 read
+const LayoutRecordsV2 = 2
+
+// Record is an entry with the fields v2 records carry beside it
+type Record struct {
+	Entry
+	// Version is the schema the record was read in
+	Version int
+
+	HasExit     bool
+	Exit        int
+	HasDuration bool
+	Duration    time.Duration
+	// Tags are those the command was recorded with. Tags added later are
+	// kept apart, as ReadTags reads them
+	Tags []string
+
+	// Source is where a command a sourced file or function ran comes
+	// from, as file:line, and Func the function it ran in
+	Source string
+	Func   string
+}
+
+// recordFields is the JSON object of a v2 record's timestamp line
+type recordFields struct {
+	Version  int      `json:"v"`
+	Exit     *int     `json:"exit,omitempty"`
+	Duration *int64   `json:"ms,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Source   string   `json:"src,omitempty"`
+	Func     string   `json:"fn,omitempty"`
+}
+
+// structured reports whether r has fields only a v2 record can carry
+func (r Record) structured() bool {
+	return r.HasExit || r.HasDuration || len(r.Tags) > 0 || r.Source != ""
+}
+
+// RecordsOf returns entries as records with no fields beside them
+func RecordsOf(entries []Entry) []Record {
+	records := make([]Record, len(entries))
+	for i, e := range entries {
+		records[i] = Record{Entry: e, Version: RecordV1}
+	}
+	return records
+}
+
+// EntriesOf returns the entries of records
+func EntriesOf(records []Record) []Entry {
+	entries := make([]Entry, len(records))
+	for i, r := range records {
+		entries[i] = r.Entry
+	}
+	return entries
+}
+
+// ReadRecords reads the history file at path with the fields of its v2
+// records
+func ReadRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseRecords(f)
+}
+
+// ParseRecords parses history holding v1 and v2 records alike
+func ParseRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	var pending Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if header, ok := parseRecordLine(line); ok {
+			pending = header
+			continue
+		}
+
+		pending.Command = line
+		if pending.Version == 0 {
+			pending.Version = RecordV1
+		}
+		records = append(records, pending)
+		pending = Record{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// parseRecordLine parses the timestamp line of a record, either bash's
+// "#<unix-seconds>" or a v2 one with its fields after it. A line whose
+// fields don't parse is a command, such as a comment typed at a prompt
+func parseRecordLine(line string) (Record, bool) {
+	if len(line) < 2 || line[0] != '#' {
+		return Record{}, false
+	}
+
+	stamp, rest, structured := strings.Cut(line[1:], " ")
+	secs, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return Record{}, false
+	}
+	r := Record{Entry: Entry{Time: time.Unix(secs, 0)}, Version: RecordV1}
+	if !structured {
+		return r, true
+	}
+
+	var fields recordFields
+	if !strings.HasPrefix(rest, "{") || json.Unmarshal([]byte(rest), &fields) != nil || fields.Version < RecordV2 {
+		return Record{}, false
+	}
+	r.Version = fields.Version
+	if fields.Exit != nil {
+		r.HasExit, r.Exit = true, *fields.Exit
+	}
+	if fields.Duration != nil {
+		r.HasDuration, r.Duration = true, time.Duration(*fields.Duration)*time.Millisecond
+	}
+	r.Tags = fields.Tags
+	r.Source, r.Func = fields.Source, fields.Func
+	return r, true
+}
+
+// WriteRecords writes records in schema version, RecordV1 or RecordV2.
+// Records with no fields beside their entry, and records without a time,
+// which v2 fields need a timestamp line for, are written v1 either way
+func WriteRecords(w io.Writer, records []Record, version int) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range records {
+		switch {
+		case r.Time.IsZero():
+		case version >= RecordV2 && r.structured():
+			fields := recordFields{Version: RecordV2, Tags: r.Tags, Source: r.Source, Func: r.Func}
+			if r.HasExit {
+				fields.Exit = &r.Exit
+			}
+			if r.HasDuration {
+				ms := r.Duration.Milliseconds()
+				fields.Duration = &ms
+			}
+			data, err := json.Marshal(fields)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "#%d %s\n", r.Time.Unix(), data)
+		default:
+			fmt.Fprintf(bw, "#%d\n", r.Time.Unix())
+		}
+		fmt.Fprintln(bw, FlattenCommand(r.Command))
+	}
+	return bw.Flush()
+}
+
+// RecordVersion returns the schema version records are written to the
+// workspace at wsPath in, as its layout allows
+func RecordVersion(wsPath string) int {
+	layout, _ := strconv.Atoi(ReadConfig(filepath.Join(wsPath, ConfigFile))[LayoutKey])
+	if layout >= LayoutRecordsV2 {
+		return RecordV2
+	}
+	return RecordV1
+}
+
+// AppendRecords is Append for records, keeping their fields where the
+// workspace's layout allows v2 records
+func AppendRecords(wsPath string, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return appendLocked(wsPath, records)
+}
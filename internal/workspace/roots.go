@@ -0,0 +1,71 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalRoot names the default workspace root, ~/.bashlog-workspaces
+const LocalRoot = "local"
+
+// Root is a directory holding workspaces, such as the local one or a team
+// root on a network mount
+type Root struct {
+	Name string
+	Path string
+}
+
+// Roots lists the workspace roots: the local root at local, then those
+// configured in settings as root.<name>=<path> lines, sorted by name. A
+// path starting with ~/ is relative to the home directory, and setting
+// root.local moves the local root
+func Roots(settings map[string]string, local string) []Root {
+	home, _ := os.UserHomeDir()
+	expand := func(p string) string {
+		if rest, ok := strings.CutPrefix(p, "~/"); ok && home != "" {
+			return filepath.Join(home, rest)
+		}
+		return p
+	}
+
+	if p := settings["root."+LocalRoot]; p != "" {
+		local = expand(p)
+	}
+	roots := []Root{{Name: LocalRoot, Path: local}}
+
+	var extra []Root
+	for key, value := range settings {
+		name, ok := strings.CutPrefix(key, "root.")
+		if !ok || name == "" || name == LocalRoot || value == "" {
+			continue
+		}
+		extra = append(extra, Root{Name: name, Path: expand(value)})
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i].Name < extra[j].Name })
+	return append(roots, extra...)
+}
+
+// FindRoot returns the root called name
+func FindRoot(roots []Root, name string) (Root, bool) {
+	for _, r := range roots {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Root{}, false
+}
+
+// Find returns the path of workspace name in the first root that has it.
+// Roots are searched in order, so the local root wins when two roots hold
+// workspaces of the same name
+func Find(roots []Root, name string) (string, bool) {
+	for _, r := range roots {
+		p := filepath.Join(r.Path, name)
+		if _, err := os.Lstat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
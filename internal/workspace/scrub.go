@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scrubbers rewrite a line of each file holding a workspace's commands or
+// their output with mask applied to them
+var scrubbers = map[string]func(line string, mask func(string) string) string{
+	HistoryFile: func(line string, mask func(string) string) string {
+		// Timestamp lines hold no command, and v2 ones fields that
+		// have to stay JSON
+		if _, ok := parseRecordLine(line); ok {
+			return line
+		}
+		return mask(line)
+	},
+	TagsFile:      scrubKeyed,
+	HostsFile:     scrubKeyed,
+	OriginsFile:   scrubKeyed,
+	TransfersFile: scrubKeyed,
+	OutputsFile: func(line string, mask func(string) string) string {
+		var r outputRecord
+		if json.Unmarshal([]byte(line), &r) != nil {
+			return line
+		}
+		command, output := mask(r.Command), mask(r.Output)
+		if command == r.Command && output == r.Output {
+			return line
+		}
+		r.Command, r.Output = command, output
+		return scrubJSONLine(line, r)
+	},
+	CommentsFile: func(line string, mask func(string) string) string {
+		var c Comment
+		if json.Unmarshal([]byte(line), &c) != nil {
+			return line
+		}
+		command, text := mask(c.Command), mask(c.Text)
+		if command == c.Command && text == c.Text {
+			return line
+		}
+		c.Command, c.Text = command, text
+		return scrubJSONLine(line, c)
+	},
+}
+
+// scrubKeyed masks the command of a line of a file read by readKeyed, so
+// it keeps keying the same command as the history
+func scrubKeyed(line string, mask func(string) string) string {
+	parts := strings.SplitN(line, "\t", 3)
+	if len(parts) != 3 {
+		return line
+	}
+	parts[2] = mask(parts[2])
+	return strings.Join(parts, "\t")
+}
+
+// scrubJSONLine returns v as a line of JSON, or line as it was if v can't
+// be written
+func scrubJSONLine(line string, v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return line
+	}
+	return string(data)
+}
+
+// Scrub rewrites the files of the workspace at wsPath holding its commands
+// and their output, its history, tags, hosts, origins, transfers, outputs
+// and comments, with mask applied to them, under its lock, and drops the
+// caches derived from them for readers to rebuild. Commands are masked
+// alike in every file, so their tags, hosts and comments stay on them. It
+// returns how many lines changed in each file, and with dryRun only that
+func Scrub(wsPath string, mask func(string) string, dryRun bool) (map[string]int, error) {
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	changed := make(map[string]int)
+	mode := FileMode(wsPath)
+	for name, scrub := range scrubbers {
+		path := filepath.Join(wsPath, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if line == "" {
+				continue
+			}
+			if scrubbed := scrub(line, mask); scrubbed != line {
+				lines[i] = scrubbed
+				changed[name]++
+			}
+		}
+		if changed[name] == 0 || dryRun {
+			continue
+		}
+		// Written beside the file and swapped in, so a crash leaves one
+		// or the other
+		tmp := path + ".scrub"
+		if err := mode.WriteFile(tmp, []byte(strings.Join(lines, "\n"))); err != nil {
+			return changed, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return changed, err
+		}
+	}
+
+	if dryRun || changed[HistoryFile] == 0 {
+		return changed, nil
+	}
+	return changed, removeCaches(wsPath)
+}
@@ -0,0 +1,210 @@
+package workspace
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/risk"
+)
+
+// StatsFile caches a workspace's statistics so listing hundreds of
+// workspaces doesn't read every history. It is derived data: Append keeps
+// it up to date, anything else that changes the history invalidates it,
+// and it is rebuilt when next needed
+const StatsFile = ".stats.json"
+
+// statsVersion changes whenever what Stats holds or how it is computed
+// does, such as the risk rules, so caches written by older versions are
+// rebuilt
+const statsVersion = 1
+
+// Stats summarizes a workspace's history
+type Stats struct {
+	Version int `json:"version"`
+
+	// HistorySize and HistoryModTime identify the history the stats were
+	// computed from, and Zone the local time zone days were counted in
+	HistorySize    int64     `json:"history_size"`
+	HistoryModTime time.Time `json:"history_mtime"`
+	Zone           string    `json:"zone"`
+
+	Commands int `json:"commands"`
+
+	// Active and Idle are as Activity computes them with IdleAfter, and
+	// Last is the latest timestamp seen, from which the next gap counts
+	IdleAfter time.Duration `json:"idle_after"`
+	Active    time.Duration `json:"active"`
+	Idle      time.Duration `json:"idle"`
+	Last      time.Time     `json:"last,omitempty"`
+
+	// Daily counts timestamped commands per local day, "2006-01-02"
+	Daily map[string]int `json:"daily"`
+
+	// Risky holds the commands scoring risk.High or above, in history order
+	Risky []Entry `json:"risky,omitempty"`
+}
+
+// LoadStats returns the statistics of the workspace at wsPath for
+// idleAfter, from its cache if that still matches the history, and
+// otherwise computed afresh and cached
+func LoadStats(wsPath string, idleAfter time.Duration) (*Stats, error) {
+	historyPath := filepath.Join(wsPath, HistoryFile)
+	info, err := os.Stat(historyPath)
+	if os.IsNotExist(err) {
+		return newStats(idleAfter), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cached, ok := readStats(wsPath)
+	if ok && cached.matches(info) && cached.IdleAfter == idleAfter {
+		return cached, nil
+	}
+
+	entries, err := ReadHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	s := newStats(idleAfter)
+	s.add(entries)
+	s.stamp(info)
+	// A cache still good for another idle gap is left for the callers
+	// using that one
+	if !IsMounted(wsPath) && !(ok && cached.matches(info)) {
+		if err := writeStats(wsPath, s); err != nil {
+			slog.Debug("could not cache workspace stats", "path", wsPath, "err", err)
+		}
+	}
+	return s, nil
+}
+
+// ComputeStats returns the statistics of entries, a whole history, for
+// idleAfter, as LoadStats does for a history file
+func ComputeStats(entries []Entry, idleAfter time.Duration) *Stats {
+	s := newStats(idleAfter)
+	s.add(entries)
+	return s
+}
+
+// DailyCounts returns the commands per day over the days ending on the
+// day of end, oldest first, as DailyCounts does for entries
+func (s *Stats) DailyCounts(end time.Time, days int) []int {
+	counts := make([]int, days)
+	y, m, d := end.Date()
+	for i := 0; i < days; i++ {
+		day := time.Date(y, m, d-(days-1-i), 0, 0, 0, 0, end.Location())
+		counts[i] = s.Daily[day.Format(time.DateOnly)]
+	}
+	return counts
+}
+
+func newStats(idleAfter time.Duration) *Stats {
+	return &Stats{Version: statsVersion, Zone: statsZone(), IdleAfter: idleAfter, Daily: make(map[string]int)}
+}
+
+// statsZone names the local time zone, which decides what day a command
+// counts towards
+func statsZone() string {
+	return os.Getenv("TZ") + "|" + time.Local.String()
+}
+
+// add folds entries appended to the history into s
+func (s *Stats) add(entries []Entry) {
+	for _, e := range entries {
+		s.Commands++
+		if level, _ := risk.Score(e.Command); level >= risk.High {
+			s.Risky = append(s.Risky, e)
+		}
+		if e.Time.IsZero() {
+			continue
+		}
+		s.Daily[e.Time.Local().Format(time.DateOnly)]++
+
+		if !s.Last.IsZero() {
+			switch gap := e.Time.Sub(s.Last); {
+			case gap < 0:
+			case gap <= s.IdleAfter:
+				s.Active += gap
+			default:
+				s.Idle += gap
+			}
+		}
+		s.Last = e.Time
+	}
+}
+
+// stamp records the history file the stats now describe
+func (s *Stats) stamp(info os.FileInfo) {
+	s.HistorySize = info.Size()
+	s.HistoryModTime = info.ModTime()
+}
+
+// matches reports whether s was computed by this version, in this time
+// zone, from the history file described by info
+func (s *Stats) matches(info os.FileInfo) bool {
+	return s.Version == statsVersion && s.Zone == statsZone() &&
+		s.HistorySize == info.Size() && s.HistoryModTime.Equal(info.ModTime())
+}
+
+func readStats(wsPath string) (*Stats, bool) {
+	data, err := os.ReadFile(filepath.Join(wsPath, StatsFile))
+	if err != nil {
+		return nil, false
+	}
+	var s Stats
+	if err := json.Unmarshal(data, &s); err != nil || s.Daily == nil {
+		return nil, false
+	}
+	return &s, true
+}
+
+// writeStats replaces the cache with s, atomically so readers never see a
+// partial file
+func writeStats(wsPath string, s *Stats) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(wsPath, StatsFile+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(FileMode(wsPath).File); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(wsPath, StatsFile))
+}
+
+// updateStats folds entries, just appended to the history, into the cache
+// if it described the history as it was before (before is nil when there
+// was none), and otherwise drops the cache to be rebuilt when next needed
+func updateStats(wsPath string, before os.FileInfo, entries []Entry) {
+	statsPath := filepath.Join(wsPath, StatsFile)
+	s, ok := readStats(wsPath)
+	if !ok {
+		return
+	}
+	after, err := os.Stat(filepath.Join(wsPath, HistoryFile))
+	if before == nil || err != nil || !s.matches(before) {
+		os.Remove(statsPath)
+		return
+	}
+	s.add(entries)
+	s.stamp(after)
+	if err := writeStats(wsPath, s); err != nil {
+		os.Remove(statsPath)
+	}
+}
@@ -0,0 +1,223 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/fsperm"
+)
+
+// SyncExt is the extension of the per-host logs in a sync directory.
+// Each machine only ever appends to its own log, so a directory shared
+// through a file synchronizer or a git repository never has conflicting
+// edits; merging is a union of every host's records
+const SyncExt = ".jsonl"
+
+// SyncRecord is a command as shared between machines
+type SyncRecord struct {
+	// ID is "<seq>@<host key>". Seq counts up from 1 in each host's log,
+	// so IDs are unique across machines and ordered within one
+	ID      string   `json:"id"`
+	Seq     int64    `json:"seq"`
+	Host    string   `json:"host"`
+	Time    int64    `json:"time"`
+	Command string   `json:"command"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func (r SyncRecord) entry() Entry {
+	return Entry{Command: r.Command, Time: time.Unix(r.Time, 0)}
+}
+
+var unsafeHostKey = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// HostKey names a machine's log in a sync directory: its host name, made
+// safe for a file name, and the start of its machine ID so two machines
+// with the same name still get their own logs
+func HostKey(name, machineID string) string {
+	key := unsafeHostKey.ReplaceAllString(name, "_")
+	if key == "" {
+		key = "host"
+	}
+	if machineID != "" {
+		key += "-" + machineID[:min(8, len(machineID))]
+	}
+	return key
+}
+
+// ReadSyncLog reads a host's log from a sync directory. A missing log has
+// no records, and a torn last line, as left by an interrupted write or a
+// synchronizer that copied the file mid-append, is skipped
+func ReadSyncLog(path string) ([]SyncRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []SyncRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r SyncRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.ID == "" {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Push appends the commands of the workspace at wsPath that were recorded
+// on this machine, and aren't in its log yet, to its log in dir. Commands
+// with no recorded host are taken to be local. It returns how many
+// records were added
+func Push(wsPath, dir, hostKey, host string) (int, error) {
+	logPath := filepath.Join(dir, hostKey+SyncExt)
+	existing, err := ReadSyncLog(logPath)
+	if err != nil {
+		return 0, err
+	}
+	pushed := make(map[tagKey]bool, len(existing))
+	var seq int64
+	for _, r := range existing {
+		pushed[keyOf(r.entry())] = true
+		seq = max(seq, r.Seq)
+	}
+
+	entries, err := ReadHistory(filepath.Join(wsPath, HistoryFile))
+	if err != nil {
+		return 0, err
+	}
+	hosts, err := ReadHosts(wsPath)
+	if err != nil {
+		return 0, err
+	}
+	tags, err := ReadTags(wsPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var lines strings.Builder
+	count := 0
+	for _, e := range entries {
+		if e.Time.IsZero() || pushed[keyOf(e)] {
+			continue
+		}
+		if h := hosts.Of(e); h != "" && h != host {
+			continue
+		}
+		pushed[keyOf(e)] = true
+		seq++
+		line, err := json.Marshal(SyncRecord{
+			ID:      fmt.Sprintf("%d@%s", seq, hostKey),
+			Seq:     seq,
+			Host:    host,
+			Time:    e.Time.Unix(),
+			Command: FlattenCommand(e.Command),
+			Tags:    tags.Of(e),
+		})
+		if err != nil {
+			return 0, err
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := fsperm.Default.MkdirAll(dir); err != nil {
+		return 0, err
+	}
+	f, err := fsperm.Default.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return 0, err
+	}
+	// Start on a line of its own after a torn write
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			f.WriteString("\n")
+		}
+	}
+	if _, err := f.WriteString(lines.String()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return count, f.Close()
+}
+
+// Merge adds the commands other machines pushed to dir that the workspace
+// at wsPath doesn't have yet, oldest first, along with their hosts and
+// tags. Records are matched by time and command, so merging again, or
+// merging a command that was already copied over another way, adds
+// nothing. It returns how many commands were added
+func Merge(wsPath, dir, hostKey string) (int, error) {
+	logs, err := filepath.Glob(filepath.Join(dir, "*"+SyncExt))
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := ReadHistory(filepath.Join(wsPath, HistoryFile))
+	if err != nil {
+		return 0, err
+	}
+	have := make(map[tagKey]bool, len(entries))
+	for _, e := range entries {
+		have[keyOf(e)] = true
+	}
+
+	var incoming []SyncRecord
+	for _, path := range logs {
+		if filepath.Base(path) == hostKey+SyncExt {
+			continue
+		}
+		records, err := ReadSyncLog(path)
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range records {
+			if key := keyOf(r.entry()); !have[key] {
+				have[key] = true
+				incoming = append(incoming, r)
+			}
+		}
+	}
+	if len(incoming) == 0 {
+		return 0, nil
+	}
+	sort.SliceStable(incoming, func(i, j int) bool { return incoming[i].Time < incoming[j].Time })
+
+	added := make([]Entry, len(incoming))
+	byHost := make(map[string][]Entry)
+	var tagged []Tagged
+	for i, r := range incoming {
+		added[i] = r.entry()
+		byHost[r.Host] = append(byHost[r.Host], added[i])
+		if len(r.Tags) > 0 {
+			tagged = append(tagged, Tagged{Entry: added[i], Tags: r.Tags})
+		}
+	}
+
+	if err := Append(wsPath, added); err != nil {
+		return 0, err
+	}
+	for host, hostEntries := range byHost {
+		if err := AddHosts(wsPath, host, hostEntries); err != nil {
+			return len(added), err
+		}
+	}
+	return len(added), AddTags(wsPath, tagged)
+}
@@ -0,0 +1,182 @@
+package workspace
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagsFile holds the tags given to a workspace's commands, one line per
+// command as "<unix-seconds>\t<tag>,<tag>\t<command>"
+const TagsFile = "tags.log"
+
+// Tagged is a recorded command and the tags it was given
+type Tagged struct {
+	Entry
+	Tags []string
+}
+
+// Tags maps recorded commands to their tags
+type Tags map[tagKey][]string
+
+// tagKey identifies a command by the time it ran and its text as stored
+// in the history file
+type tagKey struct {
+	unix    int64
+	command string
+}
+
+func keyOf(e Entry) tagKey {
+	return tagKey{e.Time.Unix(), FlattenCommand(e.Command)}
+}
+
+// Of returns the tags of a history entry, or nil
+func (t Tags) Of(e Entry) []string {
+	if e.Time.IsZero() {
+		return nil
+	}
+	return t[keyOf(e)]
+}
+
+// Has reports whether a history entry carries tag
+func (t Tags) Has(e Entry, tag string) bool {
+	for _, have := range t.Of(e) {
+		if have == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns every tag in use, sorted
+func (t Tags) Names() []string {
+	seen := make(map[string]bool)
+	for _, tags := range t {
+		for _, tag := range tags {
+			seen[tag] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for tag := range seen {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadTags loads the tags of the workspace at wsPath. A workspace without
+// a tags file has no tags
+func ReadTags(wsPath string) (Tags, error) {
+	tags := make(Tags)
+	err := readKeyed(filepath.Join(wsPath, TagsFile), func(key tagKey, value string) {
+		tags[key] = mergeTags(tags[key], strings.Split(value, ","))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// AddTags records tags for commands of the workspace at wsPath, under its
+// lock. Commands without a timestamp can't be told apart and are skipped
+func AddTags(wsPath string, tagged []Tagged) error {
+	var lines []string
+	for _, t := range tagged {
+		if t.Time.IsZero() || len(t.Tags) == 0 {
+			continue
+		}
+		lines = append(lines, keyedLine(t.Entry, strings.Join(t.Tags, ",")))
+	}
+	return appendKeyed(wsPath, TagsFile, lines)
+}
+
+// FilterTag keeps the entries that carry tag
+func FilterTag(entries []Entry, tags Tags, tag string) []Entry {
+	var kept []Entry
+	for _, e := range entries {
+		if tags.Has(e, tag) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// readKeyed calls fn with the key and value of each line of a file of
+// "<unix-seconds>\t<value>\t<command>" lines, such as the tags file. A
+// missing file has no lines
+func readKeyed(path string, fn func(key tagKey, value string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		fn(tagKey{unix, parts[2]}, parts[1])
+	}
+	return scanner.Err()
+}
+
+// keyedLine formats a line for a file read by readKeyed
+func keyedLine(e Entry, value string) string {
+	return fmt.Sprintf("%d\t%s\t%s\n", e.Time.Unix(), value, FlattenCommand(e.Command))
+}
+
+// appendKeyed appends lines to the named file of the workspace at wsPath,
+// under its lock
+func appendKeyed(wsPath, name string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	lock, err := LockWorkspace(wsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	f, err := FileMode(wsPath).OpenFile(filepath.Join(wsPath, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strings.Join(lines, "")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mergeTags adds the tags in more that aren't already in tags
+func mergeTags(tags, more []string) []string {
+	for _, tag := range more {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		dup := false
+		for _, have := range tags {
+			dup = dup || have == tag
+		}
+		if !dup {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
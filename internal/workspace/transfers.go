@@ -0,0 +1,85 @@
+package workspace
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/interhack86/bashlog/internal/shellparse"
+)
+
+// TransfersFile records the file transfers (scp, sftp, rsync, curl, wget)
+// a workspace's commands made, as "<unix-seconds>\t<json>\t<command>"
+// lines like the hosts file, the JSON being the command's transfers. It is
+// only written for workspaces with TransfersKey set
+const TransfersFile = "transfers.log"
+
+// TransfersKey, set to "true" in a workspace's config, turns on recording
+// its commands' file transfers
+const TransfersKey = "transfers"
+
+// RecordsTransfers reports whether the workspace at wsPath records the
+// file transfers of its commands
+func RecordsTransfers(wsPath string) bool {
+	return ReadConfig(filepath.Join(wsPath, ConfigFile))[TransfersKey] == "true"
+}
+
+// Transfer is a file transfer a recorded command made
+type Transfer struct {
+	Entry
+	shellparse.Transfer
+}
+
+// ReadTransfers loads the recorded file transfers of the workspace at
+// wsPath, oldest first
+func ReadTransfers(wsPath string) ([]Transfer, error) {
+	var transfers []Transfer
+	err := readKeyed(filepath.Join(wsPath, TransfersFile), func(key tagKey, value string) {
+		var made []shellparse.Transfer
+		if json.Unmarshal([]byte(value), &made) != nil {
+			return
+		}
+		e := Entry{Time: time.Unix(key.unix, 0), Command: key.command}
+		for _, t := range made {
+			transfers = append(transfers, Transfer{Entry: e, Transfer: t})
+		}
+	})
+	return transfers, err
+}
+
+// DetectTransfers returns the file transfers entries make, whether or not
+// they were recorded
+func DetectTransfers(entries []Entry) []Transfer {
+	var transfers []Transfer
+	for _, e := range entries {
+		for _, t := range shellparse.Transfers(e.Command) {
+			transfers = append(transfers, Transfer{Entry: e, Transfer: t})
+		}
+	}
+	return transfers
+}
+
+// AddTransfers records the file transfers entries of the workspace at
+// wsPath make, under its lock, when the workspace records them. Commands
+// without a timestamp are skipped
+func AddTransfers(wsPath string, entries []Entry) error {
+	if !RecordsTransfers(wsPath) {
+		return nil
+	}
+	var lines []string
+	for _, e := range entries {
+		if e.Time.IsZero() {
+			continue
+		}
+		made := shellparse.Transfers(e.Command)
+		if len(made) == 0 {
+			continue
+		}
+		value, err := json.Marshal(made)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, keyedLine(e, string(value)))
+	}
+	return appendKeyed(wsPath, TransfersFile, lines)
+}
@@ -1,3 +1,3 @@
+// Package workspace provides access to bashlog workspaces and their
+// recorded command history.
 package workspace
-
-// TODO: Add workspace package implementation